@@ -44,7 +44,13 @@ var Directives = []string{
 	"rewrite",
 	"autopath",
 	"acl",
+	"rpz",
+	"blocklist",
+	"ratelimit",
+	"rrl",
+	"k8s_policy",
 	"cache",
+	"validate",
 	"header",
 	"dnssec",
 	"tls",
@@ -56,12 +62,15 @@ var Directives = []string{
 	"azure",
 	"clouddns",
 	"k8s_external",
+	"k8s_records",
 	"kubernetes",
 	"file",
 	"auto",
 	"secondary",
+	"catalog",
 	"etcd",
 	"loop",
+	"recursive",
 	"forward",
 	"grpc",
 	"erratic",
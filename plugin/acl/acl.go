@@ -3,11 +3,16 @@ package acl
 import (
 	"context"
 	"net"
+	"regexp"
 	"strings"
 
+	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/ecs"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/coredns/coredns/plugin/tsig"
 	"github.com/coredns/coredns/request"
 
 	"github.com/infobloxopen/go-trees/iptree"
@@ -33,11 +38,19 @@ type action int
 
 // policy defines the ACL policy for DNS queries.
 // A policy performs the specified action (block/allow) on all DNS queries
-// matched by source IP or QTYPE.
+// matched by source IP, QTYPE, query name, client subnet, transport and TSIG key.
+// The optional matchers are nil if they are not used.
 type policy struct {
 	action action
 	qtypes map[uint16]struct{}
 	filter *iptree.Tree
+
+	names      map[string]struct{}
+	suffixes   []string
+	regexes    []*regexp.Regexp
+	ecs        *iptree.Tree
+	transports map[string]struct{}
+	keys       map[string]struct{}
 }
 
 const (
@@ -67,7 +80,7 @@ RulesCheckLoop:
 			continue
 		}
 
-		action := matchWithPolicies(rule.policies, w, r)
+		action := matchWithPolicies(ctx, rule.policies, w, r)
 		switch action {
 		case actionDrop:
 			{
@@ -109,7 +122,7 @@ RulesCheckLoop:
 
 // matchWithPolicies matches the DNS query with a list of ACL polices and returns suitable
 // action against the query.
-func matchWithPolicies(policies []policy, w dns.ResponseWriter, r *dns.Msg) action {
+func matchWithPolicies(ctx context.Context, policies []policy, w dns.ResponseWriter, r *dns.Msg) action {
 	state := request.Request{W: w, Req: r}
 
 	var ip net.IP
@@ -139,12 +152,93 @@ func matchWithPolicies(policies []policy, w dns.ResponseWriter, r *dns.Msg) acti
 			continue
 		}
 
+		if !policy.matchName(state.Name()) || !policy.matchECS(r) || !policy.matchTransport(ctx, state) || !policy.matchKey(ctx) {
+			continue
+		}
+
 		// matched.
 		return policy.action
 	}
 	return actionNone
 }
 
+// matchName returns true if name is one of the names, below one of the suffixes, or matches one of the
+// regular expressions of p.
+func (p policy) matchName(name string) bool {
+	if p.names == nil && p.suffixes == nil && p.regexes == nil {
+		return true
+	}
+	name = strings.ToLower(name)
+	if _, ok := p.names[name]; ok {
+		return true
+	}
+	for _, s := range p.suffixes {
+		if dns.IsSubDomain(s, name) {
+			return true
+		}
+	}
+	for _, re := range p.regexes {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchECS returns true if the client subnet in r is in one of the networks of p.
+func (p policy) matchECS(r *dns.Msg) bool {
+	if p.ecs == nil {
+		return true
+	}
+	e := ecs.Get(r)
+	if e == nil {
+		return false
+	}
+	_, ok := p.ecs.GetByIP(e.Address)
+	return ok
+}
+
+// matchTransport returns true if the query came in over one of the transports of p.
+func (p policy) matchTransport(ctx context.Context, state request.Request) bool {
+	if p.transports == nil {
+		return true
+	}
+	_, ok := p.transports[queryTransport(ctx, state)]
+	return ok
+}
+
+// queryTransport returns the transport of the query: udp, tcp, tls, https, quic or grpc.
+func queryTransport(ctx context.Context, state request.Request) string {
+	if srv, ok := ctx.Value(dnsserver.Key{}).(*dnsserver.Server); ok {
+		scheme, _, found := strings.Cut(srv.Addr, "://")
+		switch {
+		case !found, scheme == transport.DNS:
+		case scheme == transport.HTTPS3:
+			return transport.HTTPS
+		default:
+			return scheme
+		}
+	}
+	return state.Proto()
+}
+
+// matchKey returns true if the query is signed with one of the TSIG keys of p. The key name is set by the
+// tsig plugin, after it verified the signature.
+func (p policy) matchKey(ctx context.Context) bool {
+	if p.keys == nil {
+		return true
+	}
+	key := tsig.KeyName(ctx)
+	if key == "" {
+		return false
+	}
+	if _, ok := p.keys["*"]; ok {
+		return true
+	}
+	_, ok := p.keys[key]
+	return ok
+}
+
 // Name implements the plugin.Handler interface.
 func (a ACL) Name() string {
 	return "acl"
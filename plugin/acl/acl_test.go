@@ -2,10 +2,15 @@ package acl
 
 import (
 	"context"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin/pkg/ecs"
 	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/plugin/tsig"
 
 	"github.com/miekg/dns"
 )
@@ -597,3 +602,87 @@ func TestACLServeDNS(t *testing.T) {
 		})
 	}
 }
+
+func TestACLServeDNSMatchers(t *testing.T) {
+	config := `acl . {
+		block name ads.example.org
+		block suffix tracker.example.org net 192.168.0.0/16
+		block regex ^[0-9]+\.example\.net\.$
+		filter ecs 10.0.0.0/8
+		drop transport tls
+		allow tsig key.example.org.
+		block suffix secret.example.org
+	}`
+	tests := []struct {
+		name      string
+		domain    string
+		sourceIP  string
+		ecs       string
+		scheme    string
+		tsig      string
+		signed    bool
+		wantRcode int
+		noReply   bool
+	}{
+		{name: "Name blocked", domain: "ads.example.org.", wantRcode: dns.RcodeRefused},
+		{name: "Name below allowed", domain: "www.ads.example.org.", wantRcode: dns.RcodeSuccess},
+		{name: "Suffix blocked", domain: "a.tracker.example.org.", sourceIP: "192.168.1.1", wantRcode: dns.RcodeRefused},
+		{name: "Suffix other network", domain: "a.tracker.example.org.", sourceIP: "10.1.1.1", wantRcode: dns.RcodeSuccess},
+		{name: "Regex blocked", domain: "1234.example.net.", wantRcode: dns.RcodeRefused},
+		{name: "Regex allowed", domain: "www.example.net.", wantRcode: dns.RcodeSuccess},
+		{name: "Client subnet filtered", domain: "example.com.", ecs: "10.1.2.0", wantRcode: dns.RcodeSuccess, noReply: false},
+		{name: "Transport dropped", domain: "example.com.", scheme: "tls://", noReply: true},
+		{name: "Transport https allowed", domain: "example.com.", scheme: "https://", wantRcode: dns.RcodeSuccess},
+		{name: "TSIG allowed", domain: "www.secret.example.org.", tsig: "key.example.org.", wantRcode: dns.RcodeSuccess},
+		{name: "TSIG other key", domain: "www.secret.example.org.", tsig: "other.example.org.", wantRcode: dns.RcodeRefused},
+		{name: "TSIG not verified", domain: "www.secret.example.org.", signed: true, wantRcode: dns.RcodeRefused},
+	}
+
+	ctr := caddy.NewTestController("dns", config)
+	a, err := parse(ctr)
+	if err != nil {
+		t.Fatalf("Error: Cannot parse acl from config: %v", err)
+	}
+	a.Next = test.NextHandler(dns.RcodeSuccess, nil)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.scheme != "" {
+				ctx = context.WithValue(ctx, dnsserver.Key{}, &dnsserver.Server{Addr: tt.scheme + "127.0.0.1:53"})
+			}
+			if tt.tsig != "" {
+				// The tsig plugin sets the key name after it verified the signature, and strips the TSIG RR.
+				ctx = context.WithValue(ctx, tsig.Key{}, tt.tsig)
+			}
+			w := &testResponseWriter{}
+			if tt.sourceIP != "" {
+				w.setRemoteIP(tt.sourceIP)
+			}
+			m := new(dns.Msg)
+			m.SetQuestion(tt.domain, dns.TypeA)
+			if tt.ecs != "" {
+				ecs.Set(m, ecs.New(net.ParseIP(tt.ecs), 24, 56))
+			}
+			if tt.signed {
+				m.SetTsig("key.example.org.", dns.HmacSHA256, 300, time.Now().Unix())
+			}
+
+			a.ServeDNS(ctx, w, m)
+			if tt.noReply {
+				if w.Msg != nil {
+					t.Errorf("Error: acl.ServeDNS() responded to client when not expected")
+				}
+				return
+			}
+			if w.Rcode != tt.wantRcode {
+				t.Errorf("Error: acl.ServeDNS() Rcode = %v, want %v", w.Rcode, tt.wantRcode)
+			}
+			if tt.name == "Client subnet filtered" {
+				if w.Msg == nil || w.Msg.IsEdns0() == nil || len(w.Msg.IsEdns0().Option) == 0 {
+					t.Errorf("Error: acl.ServeDNS() expected filtered reply, got %v", w.Msg)
+				}
+			}
+		})
+	}
+}
@@ -2,11 +2,14 @@ package acl
 
 import (
 	"net"
+	"regexp"
 	"strings"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	pkgparse "github.com/coredns/coredns/plugin/pkg/parse"
+	"github.com/coredns/coredns/plugin/pkg/transport"
 
 	"github.com/infobloxopen/go-trees/iptree"
 	"github.com/miekg/dns"
@@ -72,7 +75,7 @@ func parse(c *caddy.Controller) (ACL, error) {
 			remainingTokens := c.RemainingArgs()
 			for len(remainingTokens) > 0 {
 				if !isPreservedIdentifier(remainingTokens[0]) {
-					return a, c.Errf("unexpected token %q; expect 'type | net'", remainingTokens[0])
+					return a, c.Errf("unexpected token %q; expect 'type | net | name | suffix | regex | ecs | transport | tsig'", remainingTokens[0])
 				}
 				section := strings.ToLower(remainingTokens[0])
 
@@ -108,15 +111,67 @@ func parse(c *caddy.Controller) (ACL, error) {
 							p.filter = newDefaultFilter()
 							break
 						}
-						token = normalize(token)
+						token = pkgparse.CIDR(token)
 						_, source, err := net.ParseCIDR(token)
 						if err != nil {
 							return a, c.Errf("illegal CIDR notation %q", token)
 						}
 						p.filter.InplaceInsertNet(source, struct{}{})
 					}
+				case "name":
+					if p.names == nil {
+						p.names = make(map[string]struct{})
+					}
+					for _, token := range tokens {
+						p.names[strings.ToLower(dns.Fqdn(token))] = struct{}{}
+					}
+				case "suffix":
+					for _, token := range tokens {
+						p.suffixes = append(p.suffixes, strings.ToLower(dns.Fqdn(token)))
+					}
+				case "regex":
+					for _, token := range tokens {
+						re, err := regexp.Compile(token)
+						if err != nil {
+							return a, c.Errf("illegal regular expression %q: %v", token, err)
+						}
+						p.regexes = append(p.regexes, re)
+					}
+				case "ecs":
+					if p.ecs == nil {
+						p.ecs = iptree.NewTree()
+					}
+					for _, token := range tokens {
+						token = pkgparse.CIDR(token)
+						_, subnet, err := net.ParseCIDR(token)
+						if err != nil {
+							return a, c.Errf("illegal CIDR notation %q", token)
+						}
+						p.ecs.InplaceInsertNet(subnet, struct{}{})
+					}
+				case "transport":
+					if p.transports == nil {
+						p.transports = make(map[string]struct{})
+					}
+					for _, token := range tokens {
+						token = strings.ToLower(token)
+						if !validTransports[token] {
+							return a, c.Errf("unexpected token %q; expect 'udp | tcp | tls | https | quic | grpc'", token)
+						}
+						p.transports[token] = struct{}{}
+					}
+				case "tsig":
+					if p.keys == nil {
+						p.keys = make(map[string]struct{})
+					}
+					for _, token := range tokens {
+						if token != "*" {
+							token = strings.ToLower(dns.Fqdn(token))
+						}
+						p.keys[token] = struct{}{}
+					}
 				default:
-					return a, c.Errf("unexpected token %q; expect 'type | net'", section)
+					return a, c.Errf("unexpected token %q; expect 'type | net | name | suffix | regex | ecs | transport | tsig'", section)
 				}
 			}
 
@@ -138,18 +193,19 @@ func parse(c *caddy.Controller) (ACL, error) {
 }
 
 func isPreservedIdentifier(token string) bool {
-	identifier := strings.ToLower(token)
-	return identifier == "type" || identifier == "net"
-}
-
-// normalize appends '/32' for any single IPv4 address and '/128' for IPv6.
-func normalize(rawNet string) string {
-	if idx := strings.IndexAny(rawNet, "/"); idx >= 0 {
-		return rawNet
+	switch strings.ToLower(token) {
+	case "type", "net", "name", "suffix", "regex", "ecs", "transport", "tsig":
+		return true
 	}
+	return false
+}
 
-	if idx := strings.IndexAny(rawNet, ":"); idx >= 0 {
-		return rawNet + "/128"
-	}
-	return rawNet + "/32"
+// validTransports are the transports a query can come in over.
+var validTransports = map[string]bool{
+	"udp":           true,
+	"tcp":           true,
+	transport.TLS:   true,
+	transport.HTTPS: true,
+	transport.QUIC:  true,
+	transport.GRPC:  true,
 }
@@ -227,46 +227,72 @@ func TestSetup(t *testing.T) {
 			}`,
 			true,
 		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			ctr := caddy.NewTestController("dns", tt.config)
-			if err := setup(ctr); (err != nil) != tt.wantErr {
-				t.Errorf("Error: setup() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-}
-
-func TestNormalize(t *testing.T) {
-	type args struct {
-		rawNet string
-	}
-	tests := []struct {
-		name string
-		args args
-		want string
-	}{
+		// Name, client subnet, transport and TSIG tests.
 		{
-			"Network range 1",
-			args{"10.218.10.8/24"},
-			"10.218.10.8/24",
+			"Names 1",
+			`acl {
+				block name ads.example.org tracker.example.org net 192.168.0.0/16
+				filter suffix example.net type AAAA
+				drop regex ^[0-9a-f]{32}\.example\.com\.$
+			}`,
+			false,
 		},
 		{
-			"IP address 1",
-			args{"10.218.10.8"},
-			"10.218.10.8/32",
+			"Client subnet 1",
+			`acl {
+				block ecs 10.0.0.0/8 2001:db8::/32
+			}`,
+			false,
 		},
 		{
-			"IPv6 address 1",
-			args{"2001:0db8:85a3:0000:0000:8a2e:0370:7334"},
-			"2001:0db8:85a3:0000:0000:8a2e:0370:7334/128",
+			"Transport 1",
+			`acl {
+				allow transport tls https quic
+				block transport udp tcp
+			}`,
+			false,
+		},
+		{
+			"TSIG 1",
+			`acl {
+				allow tsig key.example.org. *
+			}`,
+			false,
+		},
+		{
+			"Illegal regex",
+			`acl {
+				block regex [a-
+			}`,
+			true,
+		},
+		{
+			"Illegal client subnet",
+			`acl {
+				block ecs 10.0.0.0/33
+			}`,
+			true,
+		},
+		{
+			"Illegal transport",
+			`acl {
+				block transport smtp
+			}`,
+			true,
+		},
+		{
+			"Missing names",
+			`acl {
+				block name type A
+			}`,
+			true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := normalize(tt.args.rawNet); got != tt.want {
-				t.Errorf("Error: normalize() = %v, want %v", got, tt.want)
+			ctr := caddy.NewTestController("dns", tt.config)
+			if err := setup(ctr); (err != nil) != tt.wantErr {
+				t.Errorf("Error: setup() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
@@ -34,6 +34,7 @@ type (
 
 		ReloadInterval time.Duration
 		upstream       *upstream.Upstream // Upstream for looking up names during the resolution process.
+		updatePolicy   *file.UpdatePolicy // Policy for dynamic updates to all loaded zones.
 	}
 )
 
@@ -66,6 +67,13 @@ func (a Auto) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (i
 		return dns.RcodeServerFailure, nil
 	}
 
+	if r.Opcode == dns.OpcodeUpdate {
+		if zone != qname {
+			return dns.RcodeNotAuth, nil
+		}
+		return z.ServeUpdate(ctx, w, r, a.transfer)
+	}
+
 	// If transfer is not loaded, we'll see these, answer with refused (no transfer allowed).
 	if state.QType() == dns.TypeAXFR || state.QType() == dns.TypeIXFR {
 		return dns.RcodeRefused, nil
@@ -10,6 +10,7 @@ import (
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/file"
 	"github.com/coredns/coredns/plugin/metrics"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
@@ -167,6 +168,16 @@ func autoParse(c *caddy.Controller) (Auto, error) {
 				// remove soon
 				c.RemainingArgs() // eat remaining args
 
+			case "update":
+				g, err := file.ParseGrant(c.RemainingArgs())
+				if err != nil {
+					return Auto{}, c.Errf("update: %s", err)
+				}
+				if a.updatePolicy == nil {
+					a.updatePolicy = &file.UpdatePolicy{}
+				}
+				a.updatePolicy.Grants = append(a.updatePolicy.Grants, g)
+
 			default:
 				return Auto{}, c.Errf("unknown property '%s'", c.Val())
 			}
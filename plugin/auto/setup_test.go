@@ -126,6 +126,20 @@ func TestAutoParse(t *testing.T) {
 			}`,
 			false, "/tmp", "${1}", `db\.(.*)`, 60 * time.Second,
 		},
+		{
+			`auto example.org {
+				directory /tmp
+				update dhcp.key. subdomain hosts.example.org. A
+			}`,
+			false, "/tmp", "${1}", `db\.(.*)`, 60 * time.Second,
+		},
+		{
+			`auto example.org {
+				directory /tmp
+				update dhcp.key. bogus
+			}`,
+			true, "/tmp", "${1}", `db\.(.*)`, 60 * time.Second,
+		},
 	}
 
 	for i, test := range tests {
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 
 	"github.com/coredns/coredns/plugin/file"
 
@@ -35,6 +36,10 @@ func (a Auto) Walk() error {
 		if info == nil || info.IsDir() {
 			return nil
 		}
+		// Journals of dynamically updated zones live next to the zone files.
+		if strings.HasSuffix(info.Name(), file.JournalSuffix) {
+			return nil
+		}
 
 		match, origin := matches(a.re, info.Name(), a.template)
 		if !match {
@@ -71,6 +76,7 @@ func (a Auto) Walk() error {
 
 		zo.ReloadInterval = a.ReloadInterval
 		zo.Upstream = a.upstream
+		zo.UpdatePolicy = a.updatePolicy
 
 		a.Add(zo, origin, a.transfer)
 
@@ -49,6 +49,27 @@ func TestWalk(t *testing.T) {
 	}
 }
 
+func TestWalkSkipsJournal(t *testing.T) {
+	t.Parallel()
+	tempdir, err := createFiles(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempdir, "db.example.org.jnl"), []byte(zoneContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a := Auto{
+		loader: loader{directory: tempdir, re: regexp.MustCompile(`db\.(.*)`), template: `${1}`},
+		Zones:  &Zones{},
+	}
+	a.Walk()
+
+	if _, ok := a.Z["example.org.jnl."]; ok {
+		t.Error("Journal should not have been loaded as a zone")
+	}
+}
+
 func TestWalkSymlinkedDirectory(t *testing.T) {
 	t.Parallel()
 	tempdir, err := createFiles(t)
@@ -409,6 +409,30 @@ func TXT(ctx context.Context, b ServiceBackend, zone string, state request.Reque
 	return records, truncated, nil
 }
 
+// Typed returns the typed records (CAA, HTTPS, NAPTR, SSHFP, SVCB and TLSA) of the query type from the
+// backend or an error.
+func Typed(ctx context.Context, b ServiceBackend, _zone string, state request.Request, opt Options) (records []dns.RR, err error) {
+	services, err := b.Services(ctx, state, false, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	dup := make(map[string]struct{})
+
+	for _, serv := range services {
+		rr := serv.NewRR(state.QName(), state.QType())
+		if rr == nil {
+			continue
+		}
+		// The header is the same for all records, so the string is the rdata.
+		if _, ok := dup[rr.String()]; !ok {
+			dup[rr.String()] = struct{}{}
+			records = append(records, rr)
+		}
+	}
+	return records, nil
+}
+
 // PTR returns the PTR records from the backend, only services that have a domain name as host are included.
 func PTR(ctx context.Context, b ServiceBackend, _zone string, state request.Request, opt Options) (records []dns.RR, err error) {
 	services, err := b.Reverse(ctx, state, true, opt)
@@ -403,6 +403,33 @@ func TestPTRDomainOnly(t *testing.T) {
 	}
 }
 
+func TestTypedOnlyQueryType(t *testing.T) {
+	b := &mockBackend{
+		mockServices: func(_ctx context.Context, _state request.Request, _exact bool, _opt Options) ([]msg.Service, error) {
+			return []msg.Service{
+				{CAA: msg.CAA{Tag: "issue", Value: "letsencrypt.org"}, TTL: 20},
+				{CAA: msg.CAA{Tag: "issue", Value: "letsencrypt.org"}, TTL: 20, Key: "/skydns/org/example/dup"},
+				{CAA: msg.CAA{Flag: 128, Tag: "iodef", Value: "mailto:security@example.org"}, TTL: 20},
+				{TLSA: msg.TLSA{Usage: 3, Selector: 1, MatchingType: 1, Certificate: "abcd"}, TTL: 20},
+				{Host: "1.2.3.4", TTL: 20},
+			}, nil
+		},
+	}
+	req := new(dns.Msg)
+	req.SetQuestion("example.org.", dns.TypeCAA)
+	state := request.Request{Req: req, W: &test.ResponseWriter{}}
+	recs, err := Typed(context.Background(), b, "example.org.", state, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("expected 2 CAA, got %d: %v", len(recs), recs)
+	}
+	if caa, ok := recs[1].(*dns.CAA); !ok || caa.Flag != 128 || caa.Tag != "iodef" {
+		t.Fatalf("unexpected CAA: %T %v", recs[1], recs[1])
+	}
+}
+
 func TestNSSuccess(t *testing.T) {
 	b := &mockBackend{
 		mockServices: func(_ctx context.Context, _state request.Request, _exact bool, _opt Options) ([]msg.Service, error) {
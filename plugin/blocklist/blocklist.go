@@ -0,0 +1,191 @@
+// Package blocklist implements a plugin that blocks the domains in block lists.
+package blocklist
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/metrics"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/request"
+
+	"github.com/infobloxopen/go-trees/iptree"
+	"github.com/miekg/dns"
+)
+
+var log = clog.NewWithPlugin("blocklist")
+
+// response is how blocked queries are answered.
+type response int
+
+const (
+	responseNXDOMAIN response = iota
+	responseNull
+	responseRefused
+)
+
+// nullTTL is the TTL of the records of a null answer.
+const nullTTL = 60
+
+// Blocklist blocks queries for the domains in block lists.
+type Blocklist struct {
+	Next plugin.Handler
+
+	groups []*group
+}
+
+// group is a set of block lists and allowlists, for some zones and clients.
+type group struct {
+	zones    []string
+	clients  *iptree.Tree // nil for all clients
+	block    []*source
+	allow    []*source
+	response response
+	refresh  time.Duration
+	client   *http.Client
+
+	sync.RWMutex
+	blocked *trie
+	allowed *trie
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (b *Blocklist) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+
+	g := b.group(state)
+	if g == nil {
+		return plugin.NextOrFailure(b.Name(), b.Next, ctx, w, r)
+	}
+
+	g.RLock()
+	blocked, allowed := g.blocked, g.allowed
+	g.RUnlock()
+
+	domain, ok := blocked.match(state.Name())
+	if !ok {
+		return plugin.NextOrFailure(b.Name(), b.Next, ctx, w, r)
+	}
+	if _, ok := allowed.match(state.Name()); ok {
+		return plugin.NextOrFailure(b.Name(), b.Next, ctx, w, r)
+	}
+
+	blockCount.WithLabelValues(metrics.WithServer(ctx), metrics.WithView(ctx)).Inc()
+	metadata.SetValueFunc(ctx, "blocklist/domain", func() string { return domain })
+
+	w.WriteMsg(g.answer(state))
+	return dns.RcodeSuccess, nil
+}
+
+// group returns the first group for the query, or nil if there is none.
+func (b *Blocklist) group(state request.Request) *group {
+	var client net.IP
+	for _, g := range b.groups {
+		if plugin.Zones(g.zones).Matches(state.Name()) == "" {
+			continue
+		}
+		if g.clients == nil {
+			return g
+		}
+		if client == nil {
+			ip := state.IP()
+			if idx := strings.IndexByte(ip, '%'); idx >= 0 {
+				ip = ip[:idx]
+			}
+			if client = net.ParseIP(ip); client == nil {
+				return nil
+			}
+		}
+		if _, ok := g.clients.GetByIP(client); ok {
+			return g
+		}
+	}
+	return nil
+}
+
+// answer returns the reply to a blocked query.
+func (g *group) answer(state request.Request) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(state.Req)
+	m.RecursionAvailable = true
+
+	switch g.response {
+	case responseNXDOMAIN:
+		m.Rcode = dns.RcodeNameError
+	case responseRefused:
+		m.Rcode = dns.RcodeRefused
+	case responseNull:
+		hdr := dns.RR_Header{Name: state.QName(), Rrtype: state.QType(), Class: dns.ClassINET, Ttl: nullTTL}
+		switch state.QType() {
+		case dns.TypeA:
+			m.Answer = []dns.RR{&dns.A{Hdr: hdr, A: net.IPv4zero}}
+		case dns.TypeAAAA:
+			m.Answer = []dns.RR{&dns.AAAA{Hdr: hdr, AAAA: net.IPv6zero}}
+		}
+	}
+
+	if state.Req.IsEdns0() != nil {
+		m.SetEdns0(4096, state.Do())
+		ede := dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeBlocked}
+		m.IsEdns0().Option = append(m.IsEdns0().Option, &ede)
+	}
+	return m
+}
+
+// load reads the lists of g and sets them live. It returns false if a list could not be read, the domains
+// read before from that list are then used.
+func (g *group) load(ctx context.Context) bool {
+	ok := true
+	var block, allow []entry
+	for _, list := range [][]*source{g.block, g.allow} {
+		for _, s := range list {
+			if err := s.read(ctx, g.client); err != nil {
+				log.Errorf("Failed to read list %s: %s", s.location, err)
+				ok = false
+			}
+			if s.allow {
+				allow = append(allow, s.block...)
+			} else {
+				block = append(block, s.block...)
+			}
+			allow = append(allow, s.except...)
+			listEntries.WithLabelValues(s.location).Set(float64(len(s.block) + len(s.except)))
+		}
+	}
+
+	blocked, allowed := newTrie(block), newTrie(allow)
+	g.Lock()
+	g.blocked, g.allowed = blocked, allowed
+	g.Unlock()
+	log.Infof("Loaded %d blocked and %d allowed domains", blocked.size, allowed.size)
+	return ok
+}
+
+// run loads the lists, and reloads them every refresh interval, and every retry interval while a list
+// can't be read, until ctx is done.
+func (g *group) run(ctx context.Context) {
+	for {
+		ok := g.load(ctx)
+		d := g.refresh
+		if !ok {
+			d = min(d, retry)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d):
+		}
+	}
+}
+
+// retry is the interval to read lists again that could not be read.
+const retry = time.Minute
+
+// Name implements the plugin.Handler interface.
+func (b *Blocklist) Name() string { return "blocklist" }
@@ -0,0 +1,225 @@
+package blocklist
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/infobloxopen/go-trees/iptree"
+	"github.com/miekg/dns"
+)
+
+func newGroup(t *testing.T, resp response, block, allow string) *group {
+	t.Helper()
+	dir := t.TempDir()
+	g := &group{zones: []string{"."}, response: resp, refresh: time.Hour, client: &http.Client{}}
+	for i, list := range []string{block, allow} {
+		if list == "" {
+			continue
+		}
+		path := filepath.Join(dir, fmt.Sprintf("list%d", i))
+		if err := os.WriteFile(path, []byte(list), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		s := &source{location: path, allow: i == 1}
+		if s.allow {
+			g.allow = append(g.allow, s)
+		} else {
+			g.block = append(g.block, s)
+		}
+	}
+	if !g.load(context.TODO()) {
+		t.Fatal("Expected lists to load")
+	}
+	return g
+}
+
+func TestServeDNS(t *testing.T) {
+	b := &Blocklist{Next: test.NextHandler(dns.RcodeSuccess, nil)}
+	b.groups = []*group{newGroup(t, responseNXDOMAIN, list, "allowed.domain.example\n")}
+
+	tests := []struct {
+		qname string
+		rcode int
+	}{
+		{"ads.example.org.", dns.RcodeNameError},
+		{"www.ads.example.org.", dns.RcodeSuccess},
+		{"x.adblock.example.com.", dns.RcodeNameError},
+		{"good.adblock.example.com.", dns.RcodeSuccess},
+		{"domain.example.", dns.RcodeNameError},
+		{"allowed.domain.example.", dns.RcodeSuccess},
+		{"example.org.", dns.RcodeSuccess},
+	}
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, dns.TypeA)
+		m.SetEdns0(4096, false)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		rcode, _ := b.ServeDNS(context.TODO(), rec, m)
+		if rec.Msg != nil {
+			rcode = rec.Msg.Rcode
+		}
+		if rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %s for %s, got %s", i, dns.RcodeToString[tc.rcode], tc.qname, dns.RcodeToString[rcode])
+		}
+		if tc.rcode == dns.RcodeNameError {
+			opt := rec.Msg.IsEdns0()
+			if opt == nil || len(opt.Option) != 1 || opt.Option[0].(*dns.EDNS0_EDE).InfoCode != dns.ExtendedErrorCodeBlocked {
+				t.Errorf("Test %d: expected EDE Blocked, got %v", i, opt)
+			}
+		}
+	}
+}
+
+func TestServeDNSResponse(t *testing.T) {
+	tests := []struct {
+		response response
+		qtype    uint16
+		rcode    int
+		answer   string
+	}{
+		{responseNull, dns.TypeA, dns.RcodeSuccess, "0.0.0.0"},
+		{responseNull, dns.TypeAAAA, dns.RcodeSuccess, "::"},
+		{responseNull, dns.TypeMX, dns.RcodeSuccess, ""},
+		{responseRefused, dns.TypeA, dns.RcodeRefused, ""},
+	}
+	for i, tc := range tests {
+		b := &Blocklist{groups: []*group{newGroup(t, tc.response, "blocked.example\n", "")}}
+		m := new(dns.Msg)
+		m.SetQuestion("blocked.example.", tc.qtype)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		b.ServeDNS(context.TODO(), rec, m)
+
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[rec.Msg.Rcode])
+		}
+		if rec.Msg.IsEdns0() != nil {
+			t.Errorf("Test %d: expected no OPT record for query without EDNS", i)
+		}
+		if tc.answer == "" {
+			if len(rec.Msg.Answer) != 0 {
+				t.Errorf("Test %d: expected no answer, got %v", i, rec.Msg.Answer)
+			}
+			continue
+		}
+		if len(rec.Msg.Answer) != 1 {
+			t.Errorf("Test %d: expected 1 answer, got %v", i, rec.Msg.Answer)
+			continue
+		}
+		var ip net.IP
+		switch x := rec.Msg.Answer[0].(type) {
+		case *dns.A:
+			ip = x.A
+		case *dns.AAAA:
+			ip = x.AAAA
+		}
+		if ip.String() != tc.answer {
+			t.Errorf("Test %d: expected %s, got %s", i, tc.answer, ip)
+		}
+	}
+}
+
+func TestServeDNSClients(t *testing.T) {
+	kids := newGroup(t, responseNXDOMAIN, "games.example\n", "")
+	kids.clients = iptree.NewTree()
+	_, n, _ := net.ParseCIDR("10.240.0.0/16")
+	kids.clients.InplaceInsertNet(n, struct{}{})
+	all := newGroup(t, responseNXDOMAIN, "ads.example\n", "")
+
+	b := &Blocklist{Next: test.NextHandler(dns.RcodeSuccess, nil), groups: []*group{kids, all}}
+
+	tests := []struct {
+		client string
+		qname  string
+		rcode  int
+	}{
+		{"10.240.0.1", "games.example.", dns.RcodeNameError},
+		// Only the first group that applies to the client is used.
+		{"10.240.0.1", "ads.example.", dns.RcodeSuccess},
+		{"192.0.2.1", "games.example.", dns.RcodeSuccess},
+		{"192.0.2.1", "ads.example.", dns.RcodeNameError},
+	}
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, dns.TypeA)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: tc.client})
+		rcode, _ := b.ServeDNS(context.TODO(), rec, m)
+		if rec.Msg != nil {
+			rcode = rec.Msg.Rcode
+		}
+		if rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[rcode])
+		}
+	}
+}
+
+func TestLoadURL(t *testing.T) {
+	fail := false
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "||ads.example^")
+	}))
+	defer s.Close()
+
+	g := &group{zones: []string{"."}, client: s.Client()}
+	g.block = []*source{{location: s.URL + "/list.txt"}}
+	if !g.load(context.TODO()) {
+		t.Fatal("Expected list to load")
+	}
+	if _, ok := g.blocked.match("www.ads.example."); !ok {
+		t.Error("Expected www.ads.example. to be blocked")
+	}
+
+	// The domains read before are kept.
+	fail = true
+	if g.load(context.TODO()) {
+		t.Fatal("Expected list to fail")
+	}
+	if _, ok := g.blocked.match("www.ads.example."); !ok {
+		t.Error("Expected www.ads.example. to be blocked")
+	}
+}
+
+func TestLoadURLTooLarge(t *testing.T) {
+	defer func(n int64) { maxListSize = n }(maxListSize)
+	maxListSize = int64(len("||ads.example^\n"))
+
+	large := false
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "||ads.example^")
+		if large {
+			fmt.Fprintln(w, "||tracker.example^")
+		}
+	}))
+	defer s.Close()
+
+	g := &group{zones: []string{"."}, client: s.Client()}
+	g.block = []*source{{location: s.URL + "/list.txt"}}
+	if !g.load(context.TODO()) {
+		t.Fatal("Expected list of the maximum size to load")
+	}
+
+	// A list that is too large is not used, the domains read before are kept.
+	large = true
+	if g.load(context.TODO()) {
+		t.Fatal("Expected list that is too large to fail")
+	}
+	if _, ok := g.blocked.match("www.ads.example."); !ok {
+		t.Error("Expected www.ads.example. to be blocked")
+	}
+	if _, ok := g.blocked.match("tracker.example."); ok {
+		t.Error("Expected tracker.example. not to be blocked")
+	}
+}
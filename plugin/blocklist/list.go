@@ -0,0 +1,175 @@
+package blocklist
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// fetchTimeout is the time allowed to download a list.
+const fetchTimeout = time.Minute
+
+// maxListSize is the maximum size in bytes of a downloaded list.
+var maxListSize int64 = 256 << 20
+
+// source is a list read from a file or downloaded from an HTTP(S) URL.
+type source struct {
+	location string
+	allow    bool // the list is an allowlist
+
+	// The domains of the list, kept until the list is read successfully again.
+	block  []entry
+	except []entry
+}
+
+// hosts file names that are not blocked.
+var ignored = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"ip6-localnet":          true,
+	"ip6-mcastprefix":       true,
+	"ip6-allnodes":          true,
+	"ip6-allrouters":        true,
+	"ip6-allhosts":          true,
+	"0.0.0.0":               true,
+}
+
+func isURL(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// read reads the list. If that fails the domains read before are kept.
+func (s *source) read(ctx context.Context, client *http.Client) error {
+	var (
+		r       io.ReadCloser
+		limited *io.LimitedReader
+	)
+	if isURL(s.location) {
+		ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.location, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		r = resp.Body
+		// Read one byte more than allowed, to tell a list of exactly maxListSize from a larger one.
+		limited = &io.LimitedReader{R: r, N: maxListSize + 1}
+	} else {
+		f, err := os.Open(s.location)
+		if err != nil {
+			return err
+		}
+		r = f
+	}
+	defer r.Close()
+
+	var body io.Reader = r
+	if limited != nil {
+		body = limited
+	}
+	block, except, err := parse(body)
+	if err != nil {
+		return err
+	}
+	if limited != nil && limited.N == 0 {
+		return fmt.Errorf("list is larger than %d bytes", maxListSize)
+	}
+	s.block, s.except = block, except
+	return nil
+}
+
+// parse reads the domains of a list. Every line is one of:
+//
+//   - a hosts file line, "0.0.0.0 ads.example.org", which matches the names only;
+//   - an AdBlock rule, "||example.org^", which matches the domain and the names below it. An exception,
+//     "@@||example.org^", is returned in except. Rules with options or paths are skipped;
+//   - a domain, "example.org", which matches the domain and the names below it, or "*.example.org", which
+//     matches the names below it.
+//
+// Comments start with a '#', or a '!' for AdBlock.
+func parse(r io.Reader) (block, except []entry, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		for i, f := range fields {
+			if strings.HasPrefix(f, "#") {
+				fields = fields[:i]
+				break
+			}
+		}
+		if len(fields) == 0 || fields[0][0] == '!' || fields[0][0] == '[' {
+			continue
+		}
+
+		line := fields[0]
+		switch {
+		case len(fields) > 1:
+			if net.ParseIP(line) == nil {
+				continue
+			}
+			for _, name := range fields[1:] {
+				if ignored[strings.ToLower(name)] {
+					continue
+				}
+				if e, ok := newEntry(name, markExact); ok {
+					block = append(block, e)
+				}
+			}
+		case strings.HasPrefix(line, "||"), strings.HasPrefix(line, "@@||"):
+			list := &block
+			if strings.HasPrefix(line, "@@") {
+				list = &except
+				line = line[2:]
+			}
+			name, ok := strings.CutSuffix(line[2:], "^")
+			if !ok {
+				continue
+			}
+			if e, ok := newEntry(name, markExact|markBelow); ok {
+				*list = append(*list, e)
+			}
+		default:
+			if name, ok := strings.CutPrefix(line, "*."); ok {
+				if e, ok := newEntry(name, markBelow); ok {
+					block = append(block, e)
+				}
+				continue
+			}
+			if e, ok := newEntry(line, markExact|markBelow); ok {
+				block = append(block, e)
+			}
+		}
+	}
+	return block, except, scanner.Err()
+}
+
+func newEntry(name string, m mark) (entry, bool) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if name == "" || strings.ContainsAny(name, "/*$^|#") {
+		return entry{}, false
+	}
+	if _, ok := dns.IsDomainName(name); !ok {
+		return entry{}, false
+	}
+	return entry{name: name, mark: m}, true
+}
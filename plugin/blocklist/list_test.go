@@ -0,0 +1,51 @@
+package blocklist
+
+import (
+	"strings"
+	"testing"
+)
+
+const list = `# A hosts file
+127.0.0.1 localhost
+0.0.0.0 ads.example.org tracker.example.org # trailing comment
+::1 ip6-localhost
+
+! AdBlock
+[Adblock Plus 2.0]
+||adblock.example.com^
+@@||good.adblock.example.com^
+||third.example.com^$third-party
+||path.example.com/ads^
+example.com##.banner
+
+# Domains
+domain.example
+*.wild.example
+not a domain line
+`
+
+func TestParse(t *testing.T) {
+	block, except, err := parse(strings.NewReader(list))
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	expected := []entry{
+		{"ads.example.org", markExact},
+		{"tracker.example.org", markExact},
+		{"adblock.example.com", markExact | markBelow},
+		{"domain.example", markExact | markBelow},
+		{"wild.example", markBelow},
+	}
+	if len(block) != len(expected) {
+		t.Fatalf("Expected %d entries, got %d: %v", len(expected), len(block), block)
+	}
+	for i := range expected {
+		if block[i] != expected[i] {
+			t.Errorf("Expected entry %v, got %v", expected[i], block[i])
+		}
+	}
+	if len(except) != 1 || except[0] != (entry{"good.adblock.example.com", markExact | markBelow}) {
+		t.Errorf("Expected exception for good.adblock.example.com, got %v", except)
+	}
+}
@@ -0,0 +1,124 @@
+package blocklist
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	pkgparse "github.com/coredns/coredns/plugin/pkg/parse"
+
+	"github.com/infobloxopen/go-trees/iptree"
+)
+
+func init() { plugin.Register("blocklist", setup) }
+
+func setup(c *caddy.Controller) error {
+	b, err := parseBlocklist(c)
+	if err != nil {
+		return plugin.Error("blocklist", err)
+	}
+
+	// The lists are read in the background, so a slow download doesn't hold up the start of the server.
+	// Until a group's lists are read, it blocks nothing.
+	ctx, cancel := context.WithCancel(context.Background())
+	c.OnStartup(func() error {
+		for _, g := range b.groups {
+			go g.run(ctx)
+		}
+		return nil
+	})
+	c.OnShutdown(func() error {
+		cancel()
+		return nil
+	})
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		b.Next = next
+		return b
+	})
+
+	return nil
+}
+
+func parseBlocklist(c *caddy.Controller) (*Blocklist, error) {
+	b := &Blocklist{}
+	config := dnsserver.GetConfig(c)
+	client := &http.Client{Timeout: fetchTimeout}
+
+	for c.Next() {
+		g := &group{refresh: 24 * time.Hour, client: client}
+		g.zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "block", "allow":
+				allow := c.Val() == "allow"
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, location := range args {
+					if !isURL(location) && !filepath.IsAbs(location) && config.Root != "" {
+						location = filepath.Join(config.Root, location)
+					}
+					s := &source{location: location, allow: allow}
+					if allow {
+						g.allow = append(g.allow, s)
+					} else {
+						g.block = append(g.block, s)
+					}
+				}
+			case "clients":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				if g.clients == nil {
+					g.clients = iptree.NewTree()
+				}
+				for _, a := range args {
+					_, n, err := net.ParseCIDR(pkgparse.CIDR(a))
+					if err != nil {
+						return nil, c.Errf("invalid network %q", a)
+					}
+					g.clients.InplaceInsertNet(n, struct{}{})
+				}
+			case "response":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				switch c.Val() {
+				case "nxdomain":
+					g.response = responseNXDOMAIN
+				case "null":
+					g.response = responseNull
+				case "refused":
+					g.response = responseRefused
+				default:
+					return nil, c.Errf("unknown response %q", c.Val())
+				}
+			case "refresh":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				d, err := time.ParseDuration(c.Val())
+				if err != nil || d <= 0 {
+					return nil, c.Errf("invalid refresh duration %q", c.Val())
+				}
+				g.refresh = d
+			default:
+				return nil, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+		if len(g.block) == 0 {
+			return nil, c.Err("no block lists")
+		}
+		b.groups = append(b.groups, g)
+	}
+	return b, nil
+}
@@ -0,0 +1,105 @@
+package blocklist
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		groups    int
+	}{
+		{`blocklist {
+			block hosts.txt
+		}`, false, 1},
+		{`blocklist {
+			block hosts.txt https://example.org/list.txt
+			allow allow.txt
+			response null
+			refresh 1h
+		}`, false, 1},
+		{`blocklist {
+			block kids.txt
+			clients 10.0.0.0/8 192.0.2.1 2001:db8::/32
+		}
+		blocklist {
+			block hosts.txt
+		}`, false, 2},
+		// fails
+		{`blocklist`, true, 0},
+		{`blocklist {
+			allow allow.txt
+		}`, true, 0},
+		{`blocklist {
+			block
+		}`, true, 0},
+		{`blocklist {
+			block hosts.txt
+			response servfail
+		}`, true, 0},
+		{`blocklist {
+			block hosts.txt
+			refresh 0s
+		}`, true, 0},
+		{`blocklist {
+			block hosts.txt
+			clients 10.0.0.0/33
+		}`, true, 0},
+		{`blocklist {
+			block hosts.txt
+			nope
+		}`, true, 0},
+	}
+
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		b, err := parseBlocklist(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		if len(b.groups) != tc.groups {
+			t.Errorf("Test %d: expected %d groups, got %d", i, tc.groups, len(b.groups))
+		}
+	}
+}
+
+func TestSetupOptions(t *testing.T) {
+	c := caddy.NewTestController("dns", `blocklist {
+		block hosts.txt https://example.org/list.txt
+		allow allow.txt
+		clients 192.0.2.1
+		response refused
+		refresh 1h
+	}`)
+	b, err := parseBlocklist(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	g := b.groups[0]
+	if len(g.block) != 2 || g.block[1].location != "https://example.org/list.txt" {
+		t.Errorf("Expected 2 block lists, got %v", g.block)
+	}
+	if len(g.allow) != 1 || !g.allow[0].allow {
+		t.Errorf("Expected 1 allowlist, got %v", g.allow)
+	}
+	if g.response != responseRefused {
+		t.Errorf("Expected response refused, got %d", g.response)
+	}
+	if g.refresh != time.Hour {
+		t.Errorf("Expected refresh 1h, got %s", g.refresh)
+	}
+	if g.clients == nil {
+		t.Error("Expected clients to be set")
+	}
+}
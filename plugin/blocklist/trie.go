@@ -0,0 +1,119 @@
+package blocklist
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// mark says which names a listed domain matches.
+type mark uint8
+
+const (
+	// markExact matches the domain itself.
+	markExact mark = 1 << iota
+	// markBelow matches the names below the domain.
+	markBelow
+)
+
+// entry is a listed domain.
+type entry struct {
+	name string // lower case, without trailing dot
+	mark mark
+}
+
+// trie is a suffix trie of listed domains, built once and then only read. Every node is a label, and the
+// children of a node are sorted, so a lookup is a binary search per label of the name.
+type trie struct {
+	root node
+	size int
+}
+
+type node struct {
+	label    string
+	mark     mark
+	children []node
+}
+
+// newTrie builds the trie from entries, domains that are listed more than once are merged.
+func newTrie(entries []entry) *trie {
+	type key struct {
+		labels []string
+		s      string
+		mark   mark
+	}
+	keys := make([]key, 0, len(entries))
+	for _, e := range entries {
+		labels := dns.SplitDomainName(e.name)
+		for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+			labels[i], labels[j] = labels[j], labels[i]
+		}
+		// The labels are joined with a NUL, so the keys sort the same as the labels one by one.
+		keys = append(keys, key{labels: labels, s: strings.Join(labels, "\x00"), mark: e.mark})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].s < keys[j].s })
+
+	t := &trie{}
+	var build func(keys []key, depth int) []node
+	build = func(keys []key, depth int) []node {
+		var nodes []node
+		for i := 0; i < len(keys); {
+			n := node{label: keys[i].labels[depth]}
+			j := i
+			for ; j < len(keys) && keys[j].labels[depth] == n.label; j++ {
+				if len(keys[j].labels) == depth+1 {
+					if n.mark == 0 {
+						t.size++
+					}
+					n.mark |= keys[j].mark
+				}
+			}
+			// Sorted, the domain itself comes before the names below it.
+			k := i
+			for k < j && len(keys[k].labels) == depth+1 {
+				k++
+			}
+			n.children = build(keys[k:j], depth+1)
+			nodes = append(nodes, n)
+			i = j
+		}
+		return nodes
+	}
+	t.root.children = build(keys, 0)
+	return t
+}
+
+// match returns the listed domain that matches name, if any.
+func (t *trie) match(name string) (string, bool) {
+	if t == nil {
+		return "", false
+	}
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if name == "" {
+		return "", false
+	}
+
+	n := &t.root
+	end := len(name)
+	for end > 0 {
+		start := strings.LastIndexByte(name[:end], '.') + 1
+		label := name[start:end]
+		i := sort.Search(len(n.children), func(i int) bool { return n.children[i].label >= label })
+		if i == len(n.children) || n.children[i].label != label {
+			return "", false
+		}
+		n = &n.children[i]
+		if start == 0 {
+			if n.mark&markExact == 0 {
+				return "", false
+			}
+			return name, true
+		}
+		if n.mark&markBelow != 0 {
+			return name[start:], true
+		}
+		end = start - 1
+	}
+	return "", false
+}
@@ -0,0 +1,64 @@
+package blocklist
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTrie(t *testing.T) {
+	tr := newTrie([]entry{
+		{"ads.example.org", markExact},
+		{"tracker.example.org", markExact | markBelow},
+		{"example.net", markBelow},
+		{"a-b.example.com", markExact},
+		{"a.example.com", markExact},
+		{"ads.example.org", markBelow}, // merged with the first
+		{"com", markBelow},
+	})
+	if tr.size != 6 {
+		t.Errorf("Expected 6 domains, got %d", tr.size)
+	}
+
+	tests := []struct {
+		name   string
+		domain string
+		match  bool
+	}{
+		{"ads.example.org.", "ads.example.org", true},
+		{"ADS.example.org.", "ads.example.org", true},
+		{"x.ads.example.org.", "ads.example.org", true},
+		{"example.org.", "", false},
+		{"www.example.org.", "", false},
+		{"tracker.example.org.", "tracker.example.org", true},
+		{"a.b.tracker.example.org.", "tracker.example.org", true},
+		{"example.net.", "", false},
+		{"www.example.net.", "example.net", true},
+		{"a.example.com.", "com", true},
+		{"org.", "", false},
+		{".", "", false},
+	}
+	for i, tc := range tests {
+		domain, ok := tr.match(tc.name)
+		if ok != tc.match || domain != tc.domain {
+			t.Errorf("Test %d: expected %q, %t for %s, got %q, %t", i, tc.domain, tc.match, tc.name, domain, ok)
+		}
+	}
+
+	var nilTrie *trie
+	if _, ok := nilTrie.match("example.org."); ok {
+		t.Error("Expected no match in nil trie")
+	}
+}
+
+func BenchmarkTrie(b *testing.B) {
+	entries := make([]entry, 1000000)
+	for i := range entries {
+		entries[i] = entry{name: fmt.Sprintf("host%d.domain%d.example", i, i%1000), mark: markExact | markBelow}
+	}
+	tr := newTrie(entries)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr.match("www.host12345.domain345.example.")
+	}
+}
@@ -0,0 +1,249 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/reuseport"
+	"github.com/coredns/coredns/plugin/pkg/uniq"
+
+	"github.com/miekg/dns"
+)
+
+var (
+	uniqAdmin = uniq.New()
+
+	adminsMu sync.Mutex
+	admins   = map[string]*admin{}
+)
+
+const (
+	defaultAdminAddr  = "localhost:9154"
+	defaultAdminLimit = 1000
+)
+
+// admin is the HTTP server that allows inspecting and purging the caches that use the same address.
+type admin struct {
+	Addr string
+
+	sync.RWMutex
+	caches []*Cache
+	ln     net.Listener
+	srv    *http.Server
+	done   bool
+}
+
+// getAdmin returns the admin server for addr, creating it if needed, and adds c to it.
+func getAdmin(addr string, c *Cache) *admin {
+	adminsMu.Lock()
+	defer adminsMu.Unlock()
+	a, ok := admins[addr]
+	if !ok {
+		a = &admin{Addr: addr}
+		admins[addr] = a
+	}
+	a.Lock()
+	a.caches = append(a.caches, c)
+	a.Unlock()
+	return a
+}
+
+// entry is an element in the cache, as returned by the admin API.
+type entry struct {
+	Zones string `json:"zones"`
+	View  string `json:"view,omitempty"`
+	Cache string `json:"cache"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Class string `json:"class"`
+	Rcode string `json:"rcode"`
+	TTL   int    `json:"ttl"`
+	Stale bool   `json:"stale"`
+}
+
+// filter selects the cache elements an admin request applies to.
+type filter struct {
+	name  string // exact name
+	zone  string // name and everything below it
+	qtype uint16
+}
+
+func (f filter) match(i *item) bool {
+	name := strings.ToLower(i.Name)
+	if f.name != "" && name != f.name {
+		return false
+	}
+	if f.zone != "" && !dns.IsSubDomain(f.zone, name) {
+		return false
+	}
+	return f.qtype == 0 || f.qtype == i.QType
+}
+
+func (f filter) empty() bool { return f.name == "" && f.zone == "" && f.qtype == 0 }
+
+func parseFilter(r *http.Request) (filter, error) {
+	f := filter{}
+	q := r.URL.Query()
+	if name := q.Get("name"); name != "" {
+		f.name = strings.ToLower(dns.Fqdn(name))
+	}
+	if zone := q.Get("zone"); zone != "" {
+		f.zone = strings.ToLower(dns.Fqdn(zone))
+	}
+	if t := q.Get("type"); t != "" {
+		qtype, ok := dns.StringToType[strings.ToUpper(t)]
+		if !ok {
+			return f, fmt.Errorf("unknown type %q", t)
+		}
+		f.qtype = qtype
+	}
+	return f, nil
+}
+
+func (a *admin) onStartup() error {
+	ln, err := reuseport.Listen("tcp", a.Addr)
+	if err != nil {
+		return err
+	}
+
+	adminsMu.Lock()
+	admins[a.Addr] = a
+	adminsMu.Unlock()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /cache", a.list)
+	mux.HandleFunc("DELETE /cache", a.purge)
+
+	a.Lock()
+	a.ln = ln
+	a.srv = &http.Server{
+		Handler:      mux,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+		IdleTimeout:  5 * time.Second,
+	}
+	a.done = true
+	a.Unlock()
+
+	go func() { a.srv.Serve(ln) }()
+	return nil
+}
+
+func (a *admin) onFinalShutdown() error {
+	a.Lock()
+	defer a.Unlock()
+	if !a.done {
+		return nil
+	}
+
+	uniqAdmin.Unset(a.Addr)
+	adminsMu.Lock()
+	if admins[a.Addr] == a {
+		delete(admins, a.Addr)
+	}
+	adminsMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := a.srv.Shutdown(ctx); err != nil {
+		log.Infof("Failed to stop cache admin http server: %s", err)
+	}
+	a.done = false
+	return nil
+}
+
+// list writes the elements matching the filter as JSON.
+func (a *admin) list(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultAdminLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if limit, err = strconv.Atoi(l); err != nil || limit <= 0 {
+			http.Error(w, fmt.Sprintf("invalid limit %q", l), http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries := []entry{}
+	a.RLock()
+	for _, c := range a.caches {
+		now := c.now()
+		for _, x := range []struct {
+			name  string
+			cache *cache.Cache[*item]
+		}{{Success, c.pcache}, {Denial, c.ncache}} {
+			x.cache.Walk(func(items map[uint64]*item, key uint64) bool {
+				if len(entries) >= limit {
+					return false
+				}
+				i, ok := items[key]
+				if !ok || !f.match(i) {
+					return true
+				}
+				ttl := i.ttl(now)
+				entries = append(entries, entry{
+					Zones: c.zonesMetricLabel,
+					View:  c.viewMetricLabel,
+					Cache: x.name,
+					Name:  i.Name,
+					Type:  dns.Type(i.QType).String(),
+					Class: dns.Class(i.QClass).String(),
+					Rcode: dns.RcodeToString[i.Rcode],
+					TTL:   max(ttl, 0),
+					Stale: ttl <= 0,
+				})
+				return true
+			})
+		}
+	}
+	a.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// purge removes the elements matching the filter. To purge everything all=true must be given explicitly.
+func (a *admin) purge(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if f.empty() && r.URL.Query().Get("all") != "true" {
+		http.Error(w, "one of name, zone or type is required, or all=true", http.StatusBadRequest)
+		return
+	}
+
+	purged := 0
+	a.RLock()
+	for _, c := range a.caches {
+		for _, ca := range []*cache.Cache[*item]{c.pcache, c.ncache} {
+			ca.Walk(func(items map[uint64]*item, key uint64) bool {
+				if i, ok := items[key]; ok && f.match(i) {
+					delete(items, key)
+					purged++
+				}
+				return true
+			})
+		}
+		if c.nsecs != nil {
+			purged += c.nsecs.purge(f)
+		}
+	}
+	a.RUnlock()
+
+	log.Infof("Purged %d cache entries (name=%q zone=%q type=%s)", purged, f.name, f.zone, dns.Type(f.qtype))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"purged": purged})
+}
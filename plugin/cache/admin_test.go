@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func newAdminCache(now time.Time) *Cache {
+	c := New()
+	c.now = func() time.Time { return now }
+	c.zonesMetricLabel = "."
+
+	for _, x := range []struct {
+		name  string
+		qtype uint16
+		ttl   time.Duration
+		age   time.Duration
+	}{
+		{"example.org.", dns.TypeA, time.Minute, 0},
+		{"example.org.", dns.TypeAAAA, time.Minute, 0},
+		{"www.example.org.", dns.TypeA, time.Minute, 2 * time.Minute}, // stale
+		{"example.net.", dns.TypeA, time.Minute, 0},
+	} {
+		m := new(dns.Msg)
+		m.SetQuestion(x.name, x.qtype)
+		m.Response = true
+		m.Answer = []dns.RR{test.A(x.name + " 60 IN A 127.0.0.53")}
+		c.pcache.Add(hash(x.name, x.qtype, dns.ClassINET, false, false), newItem(m, now.Add(-x.age), x.ttl))
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion("nx.example.org.", dns.TypeA)
+	m.Response = true
+	m.Rcode = dns.RcodeNameError
+	m.Ns = []dns.RR{test.SOA("example.org. 60 IN SOA sns.dns.icann.org. noc.dns.icann.org. 2016082540 7200 3600 1209600 3600")}
+	c.ncache.Add(hash("nx.example.org.", dns.TypeA, dns.ClassINET, false, false), newItem(m, now, time.Minute))
+	return c
+}
+
+func TestAdminList(t *testing.T) {
+	now := time.Now()
+	a := &admin{caches: []*Cache{newAdminCache(now)}}
+
+	tests := []struct {
+		query    string
+		code     int
+		expected int
+	}{
+		{"", http.StatusOK, 5},
+		{"name=example.org", http.StatusOK, 2},
+		{"name=EXAMPLE.org.&type=aaaa", http.StatusOK, 1},
+		{"zone=example.org", http.StatusOK, 4},
+		{"type=A", http.StatusOK, 4},
+		{"limit=2", http.StatusOK, 2},
+		{"type=BOGUS", http.StatusBadRequest, 0},
+		{"limit=-1", http.StatusBadRequest, 0},
+	}
+	for _, tc := range tests {
+		rec := httptest.NewRecorder()
+		a.list(rec, httptest.NewRequest(http.MethodGet, "/cache?"+tc.query, nil))
+		if rec.Code != tc.code {
+			t.Errorf("%q: expected status %d, got %d", tc.query, tc.code, rec.Code)
+			continue
+		}
+		if tc.code != http.StatusOK {
+			continue
+		}
+		var entries []entry
+		if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != tc.expected {
+			t.Errorf("%q: expected %d entries, got %d", tc.query, tc.expected, len(entries))
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	a.list(rec, httptest.NewRequest(http.MethodGet, "/cache?name=www.example.org", nil))
+	var entries []entry
+	json.NewDecoder(rec.Body).Decode(&entries)
+	if len(entries) != 1 || !entries[0].Stale || entries[0].TTL != 0 || entries[0].Cache != Success {
+		t.Errorf("Expected a single stale entry, got %+v", entries)
+	}
+	rec = httptest.NewRecorder()
+	a.list(rec, httptest.NewRequest(http.MethodGet, "/cache?name=nx.example.org", nil))
+	entries = nil
+	json.NewDecoder(rec.Body).Decode(&entries)
+	if len(entries) != 1 || entries[0].Stale || entries[0].Cache != Denial || entries[0].Rcode != "NXDOMAIN" {
+		t.Errorf("Expected a single denial entry, got %+v", entries)
+	}
+}
+
+func TestAdminPurge(t *testing.T) {
+	tests := []struct {
+		query  string
+		code   int
+		purged int
+		left   int
+	}{
+		{"name=example.org", http.StatusOK, 2, 3},
+		{"zone=example.org", http.StatusOK, 4, 1},
+		{"zone=example.org&type=A", http.StatusOK, 3, 2},
+		{"type=AAAA", http.StatusOK, 1, 4},
+		{"all=true", http.StatusOK, 5, 0},
+		{"", http.StatusBadRequest, 0, 5},
+		{"type=BOGUS", http.StatusBadRequest, 0, 5},
+	}
+	for _, tc := range tests {
+		c := newAdminCache(time.Now())
+		a := &admin{caches: []*Cache{c}}
+		rec := httptest.NewRecorder()
+		a.purge(rec, httptest.NewRequest(http.MethodDelete, "/cache?"+tc.query, nil))
+		if rec.Code != tc.code {
+			t.Errorf("%q: expected status %d, got %d", tc.query, tc.code, rec.Code)
+			continue
+		}
+		if tc.code == http.StatusOK {
+			var resp map[string]int
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp["purged"] != tc.purged {
+				t.Errorf("%q: expected %d purged, got %d", tc.query, tc.purged, resp["purged"])
+			}
+		}
+		if left := c.pcache.Len() + c.ncache.Len(); left != tc.left {
+			t.Errorf("%q: expected %d entries left, got %d", tc.query, tc.left, left)
+		}
+	}
+}
+
+func TestAdminNSEC(t *testing.T) {
+	c := newAdminCache(time.Now())
+	c.nsecs = newNSECCache(defaultCap)
+	m := new(dns.Msg)
+	m.SetQuestion("a.example.org.", dns.TypeA)
+	m.Rcode = dns.RcodeNameError
+	m.Ns = []dns.RR{
+		test.SOA("example.org.	300	IN	SOA	ns.example.org. admin.example.org. 1 3600 600 86400 300"),
+		test.RRSIG("example.org.	300	IN	RRSIG	SOA 13 2 300 " + sig),
+		test.NSEC("example.org.	300	IN	NSEC	b.example.org. NS SOA RRSIG NSEC DNSKEY"),
+		test.RRSIG("example.org.	300	IN	RRSIG	NSEC 13 2 300 " + sig),
+	}
+	c.nsecs.add(m, time.Now(), time.Hour)
+	a := &admin{caches: []*Cache{c}}
+
+	a.list(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/cache", nil))
+	if c.nsecs.size != 1 {
+		t.Fatalf("Expected listing to keep the NSEC records, got %d left", c.nsecs.size)
+	}
+
+	rec := httptest.NewRecorder()
+	a.purge(rec, httptest.NewRequest(http.MethodDelete, "/cache?zone=example.org", nil))
+	var resp map[string]int
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp["purged"] != 5 {
+		t.Errorf("Expected 5 purged, got %d", resp["purged"])
+	}
+	if c.nsecs.size != 0 || len(c.nsecs.zones) != 0 {
+		t.Errorf("Expected the NSEC records to be purged, got %d left", c.nsecs.size)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/pkg/cache"
 	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	"github.com/coredns/coredns/plugin/pkg/ecs"
 	"github.com/coredns/coredns/plugin/pkg/response"
 	"github.com/coredns/coredns/request"
 
@@ -37,6 +38,9 @@ type Cache struct {
 	minpttl time.Duration
 	failttl time.Duration // TTL for caching SERVFAIL responses
 
+	// Scope prefix lengths of the EDNS Client Subnet responses cached per key.
+	scopes *cache.Cache[scopeSet]
+
 	// Prefetch.
 	prefetch   int
 	duration   time.Duration
@@ -57,6 +61,17 @@ type Cache struct {
 	// Keep ttl option
 	keepttl bool
 
+	// NSEC and NSEC3 records of validated replies to synthesize answers from, nil if disabled.
+	nsecs   *nsecCache
+	nseccap int
+
+	// Address of the HTTP admin API, empty if disabled.
+	adminAddr string
+
+	// Persist the caches to persistFile every persistInterval, empty if disabled.
+	persistFile     string
+	persistInterval time.Duration
+
 	// Testing.
 	now func() time.Time
 }
@@ -75,6 +90,7 @@ func New() *Cache {
 		nttl:       maxNTTL,
 		minnttl:    minNTTL,
 		failttl:    minNTTL,
+		scopes:     cache.New[scopeSet](defaultCap),
 		prefetch:   0,
 		duration:   1 * time.Minute,
 		percentage: 10,
@@ -334,6 +350,8 @@ type ResponseWriter struct {
 	lastResponse *dns.Msg      // last response after cache TTL and DNSSEC adjustments.
 	lastItem     *item         // cache item written by the last response, if cacheable.
 
+	subnet *dns.EDNS0_SUBNET // client subnet the last response is valid for, nil if valid for all clients.
+
 	pexcept []string // positive zone exceptions
 	nexcept []string // negative zone exceptions
 }
@@ -419,6 +437,11 @@ func (w *ResponseWriter) WriteMsg(res *dns.Msg) error {
 
 	// key returns empty string for anything we don't want to cache.
 	hasKey, key := key(w.state.Name(), res, mt, w.do, w.cd)
+	subnet := ecs.Get(res)
+	w.subnet = scopedSubnet(res)
+	if hasKey && w.subnet != nil {
+		key = w.storeKey(key, w.subnet)
+	}
 
 	var duration time.Duration
 	switch mt {
@@ -438,6 +461,19 @@ func (w *ResponseWriter) WriteMsg(res *dns.Msg) error {
 	res.Ns = filterRRSlice(res.Ns, ttl, false)
 	res.Extra = filterRRSlice(res.Extra, ttl, false)
 
+	if w.nsecs != nil && hasKey && !w.cd && res.AuthenticatedData && w.state.Match(res) {
+		switch mt {
+		case response.NameError, response.NoData:
+			if plugin.Zones(w.nexcept).Matches(res.Question[0].Name) == "" {
+				w.nsecs.add(res, w.now(), w.nttl)
+			}
+		case response.NoError:
+			if plugin.Zones(w.pexcept).Matches(res.Question[0].Name) == "" {
+				w.nsecs.add(res, w.now(), w.pttl)
+			}
+		}
+	}
+
 	if hasKey && duration > 0 {
 		if w.state.Match(res) {
 			w.set(res, key, mt, duration)
@@ -449,6 +485,11 @@ func (w *ResponseWriter) WriteMsg(res *dns.Msg) error {
 		}
 	}
 
+	if subnet != nil && ecs.Get(w.state.Req) != nil {
+		// The OPT RR was filtered out above, only return the client subnet if the client sent one.
+		ecs.Set(res, subnet)
+	}
+
 	if !w.do && !w.ad {
 		// unset AD bit if requester is not OK with DNSSEC
 		// But retain AD bit if requester set the AD bit in the request, per RFC6840 5.7-5.8
@@ -473,6 +514,7 @@ func (w *ResponseWriter) set(m *dns.Msg, key uint64, mt response.Type, duration
 			return
 		}
 		i := newItem(m, w.now(), duration)
+		i.subnet = w.subnet
 		if w.wildcardFunc != nil {
 			i.wildcard = w.wildcardFunc()
 		}
@@ -498,6 +540,7 @@ func (w *ResponseWriter) set(m *dns.Msg, key uint64, mt response.Type, duration
 			return
 		}
 		i := newItem(m, w.now(), duration)
+		i.subnet = w.subnet
 		if w.wildcardFunc != nil {
 			i.wildcard = w.wildcardFunc()
 		}
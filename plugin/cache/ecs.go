@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"net"
+
+	"github.com/coredns/coredns/plugin/pkg/ecs"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// scopeSet records the scope prefix lengths of the responses cached under a key. Bit n is set for
+// IPv4 prefix length n, bit 33+n for IPv6 prefix length n.
+type scopeSet [3]uint64
+
+func scopeBit(family uint16, n uint8) uint {
+	if family == 2 {
+		return 33 + uint(n)
+	}
+	return uint(n)
+}
+
+func (s scopeSet) add(family uint16, n uint8) scopeSet {
+	b := scopeBit(family, n)
+	s[b/64] |= 1 << (b % 64)
+	return s
+}
+
+func (s scopeSet) has(family uint16, n uint8) bool {
+	b := scopeBit(family, n)
+	return s[b/64]&(1<<(b%64)) != 0
+}
+
+// scopedSubnet returns the client subnet that the response m applies to: the EDNS Client Subnet
+// option truncated to its scope prefix length. It returns nil if m is valid for all clients.
+func scopedSubnet(m *dns.Msg) *dns.EDNS0_SUBNET {
+	e := ecs.Get(m)
+	if e == nil || e.SourceScope == 0 || e.SourceNetmask == 0 {
+		return nil
+	}
+	return ecs.Truncate(e, e.SourceScope)
+}
+
+// subnetKey returns the key for a response to the query with key k, that is only valid for subnet.
+func subnetKey(k uint64, subnet *dns.EDNS0_SUBNET) uint64 {
+	h := fnv.New64()
+	var buf [11]byte
+	binary.BigEndian.PutUint64(buf[:], k)
+	binary.BigEndian.PutUint16(buf[8:], subnet.Family)
+	buf[10] = subnet.SourceNetmask
+	h.Write(buf[:])
+	h.Write(subnet.Address)
+	return h.Sum64()
+}
+
+// clientSubnet returns the subnet of the client: the EDNS Client Subnet option in the request, or
+// the remote address. It returns nil if neither is usable.
+func clientSubnet(state request.Request) *dns.EDNS0_SUBNET {
+	if e := ecs.Get(state.Req); e != nil {
+		return e
+	}
+	ip := net.ParseIP(state.IP())
+	if ip == nil {
+		return nil
+	}
+	return ecs.New(ip, net.IPv4len*8, net.IPv6len*8)
+}
+
+// lookupKey returns the key for the query in state. If responses for the query were cached for
+// specific client subnets, the key of the longest one that matches the client's subnet and has an
+// entry is returned. Otherwise it returns k, the key for responses valid for all clients.
+func (c *Cache) lookupKey(k uint64, state request.Request) uint64 {
+	s, ok := c.scopes.Get(k)
+	if !ok {
+		return k
+	}
+	subnet := clientSubnet(state)
+	if subnet == nil {
+		return k
+	}
+	for n := int(subnet.SourceNetmask); n > 0; n-- {
+		if !s.has(subnet.Family, uint8(n)) {
+			continue
+		}
+		sk := subnetKey(k, ecs.Truncate(subnet, uint8(n)))
+		if _, ok := c.pcache.Get(sk); ok {
+			return sk
+		}
+		if _, ok := c.ncache.Get(sk); ok {
+			return sk
+		}
+	}
+	return k
+}
+
+// storeKey returns the key to store a response to the query with key k under, when it is only valid
+// for subnet. It records the scope prefix length of subnet for lookups.
+func (c *Cache) storeKey(k uint64, subnet *dns.EDNS0_SUBNET) uint64 {
+	s, _ := c.scopes.Get(k)
+	c.scopes.Add(k, s.add(subnet.Family, subnet.SourceNetmask))
+	return subnetKey(k, subnet)
+}
+
+// replySubnet returns the EDNS Client Subnet option for a reply from the cache to a client that
+// sent e: the client's own option with the scope of the cached response.
+func replySubnet(e *dns.EDNS0_SUBNET, i *item) *dns.EDNS0_SUBNET {
+	r := &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: e.Family, SourceNetmask: e.SourceNetmask, Address: e.Address}
+	if i.subnet != nil {
+		r.SourceScope = i.subnet.SourceNetmask
+	}
+	return r
+}
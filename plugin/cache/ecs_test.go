@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/ecs"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// ecsBackend mimics forward with ecs enabled: it answers with a scope of at most 24 bits.
+func ecsBackend(calls *int) plugin.Handler {
+	return plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		*calls++
+		e := ecs.Get(r)
+		if e == nil {
+			state := request.Request{W: w}
+			e = ecs.New(net.ParseIP(state.IP()), 24, 56)
+		}
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = []dns.RR{test.A("example.org. 300 IN A " + ecs.Truncate(e, 24).Address.String())}
+		if r.IsEdns0() == nil {
+			m.SetEdns0(dns.DefaultMsgSize, false)
+		}
+		ecs.Set(m, &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: e.Family, SourceNetmask: e.SourceNetmask, SourceScope: min(e.SourceNetmask, 24), Address: e.Address})
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+}
+
+func TestCacheECS(t *testing.T) {
+	calls := 0
+	c := New()
+	c.Next = ecsBackend(&calls)
+
+	subnet := func(s string, n uint8) *dns.EDNS0_SUBNET {
+		return &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: n, Address: net.ParseIP(s).To4()}
+	}
+
+	tests := []struct {
+		client *dns.EDNS0_SUBNET
+		calls  int
+		answer string
+		scope  uint8
+	}{
+		{subnet("192.0.2.77", 32), 1, "192.0.2.0", 24},
+		{subnet("192.0.2.99", 32), 1, "192.0.2.0", 24}, // same /24, from the cache
+		{subnet("198.51.100.1", 32), 2, "198.51.100.0", 24},
+		{nil, 3, "10.240.0.0", 0}, // remote address 10.240.0.1
+		{nil, 3, "10.240.0.0", 0},
+		{subnet("192.0.2.77", 16), 4, "192.0.0.0", 16}, // source prefix shorter than the cached scope
+	}
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion("example.org.", dns.TypeA)
+		if tc.client != nil {
+			m.SetEdns0(dns.DefaultMsgSize, false)
+			ecs.Set(m, tc.client)
+		}
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		c.ServeDNS(context.TODO(), rec, m)
+
+		if calls != tc.calls {
+			t.Errorf("Test %d: expected %d upstream calls, got %d", i, tc.calls, calls)
+		}
+		if len(rec.Msg.Answer) != 1 || rec.Msg.Answer[0].(*dns.A).A.String() != tc.answer {
+			t.Errorf("Test %d: expected answer %s, got %v", i, tc.answer, rec.Msg.Answer)
+		}
+		e := ecs.Get(rec.Msg)
+		if tc.client == nil {
+			if rec.Msg.IsEdns0() != nil {
+				t.Errorf("Test %d: expected no OPT RR in the reply", i)
+			}
+			continue
+		}
+		if e == nil || !e.Address.Equal(tc.client.Address) || e.SourceNetmask != tc.client.SourceNetmask || e.SourceScope != tc.scope {
+			t.Errorf("Test %d: expected client subnet %s/%d with scope %d, got %v", i, tc.client.Address, tc.client.SourceNetmask, tc.scope, e)
+		}
+	}
+}
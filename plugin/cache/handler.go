@@ -8,6 +8,7 @@ import (
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/metadata"
 	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/ecs"
 	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
@@ -28,6 +29,8 @@ func (c *Cache) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 
 	now := c.now()
 	server := metrics.WithServer(ctx)
+	// We remove the client subnet added by plugins further down the chain ourselves.
+	ctx = ecs.WithKeep(ctx)
 
 	// On cache refresh, we will just use the DO bit from the incoming query for the refresh since we key our cache
 	// with the query DO bit. That means two separate cache items for the query DO bit true or false. In the situation
@@ -35,6 +38,12 @@ func (c *Cache) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 	// DNSSEC RRs in the response are written to cache with the response.
 
 	i := c.getIfNotStale(now, state, server)
+	if i == nil && c.nsecs != nil && !cd {
+		if resp := c.synthesize(state, server, now, do, ad); resp != nil {
+			w.WriteMsg(resp)
+			return dns.RcodeSuccess, nil
+		}
+	}
 	if i == nil {
 		refreshState := authenticatedRefreshState(state)
 		crr := &ResponseWriter{ResponseWriter: w, Cache: c, state: refreshState, server: server, do: do, ad: ad, cd: cd,
@@ -101,10 +110,46 @@ func (c *Cache) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 	} else {
 		resp = i.toMsg(r, now, do, ad)
 	}
+	if e := ecs.Get(r); e != nil {
+		ecs.Set(resp, replySubnet(e, i))
+	}
 	w.WriteMsg(resp)
 	return dns.RcodeSuccess, nil
 }
 
+// synthesize returns an answer made from the NSEC and NSEC3 records in the cache, RFC 8198, or nil if
+// they don't prove anything about the query.
+func (c *Cache) synthesize(state request.Request, server string, now time.Time, do, ad bool) *dns.Msg {
+	if state.QClass() != dns.ClassINET {
+		return nil
+	}
+	m := c.nsecs.synthesize(state.Name(), state.QType(), now)
+	if m == nil {
+		return nil
+	}
+	resp := new(dns.Msg)
+	resp.SetReply(state.Req)
+	resp.RecursionAvailable = m.RecursionAvailable
+	resp.Rcode = m.Rcode
+	// Only validated records are kept, so the answer is authenticated.
+	resp.AuthenticatedData = do || ad
+	resp.Answer, resp.Ns = m.Answer, m.Ns
+	if !do {
+		resp.Answer = stripDNSSEC(resp.Answer)
+		resp.Ns = stripDNSSEC(resp.Ns)
+	}
+
+	kind := "nxdomain"
+	switch {
+	case len(resp.Answer) > 0:
+		kind = "wildcard"
+	case resp.Rcode == dns.RcodeSuccess:
+		kind = "nodata"
+	}
+	cacheSynthesized.WithLabelValues(server, kind, c.zonesMetricLabel, c.viewMetricLabel).Inc()
+	return resp
+}
+
 func wildcardFunc(ctx context.Context) func() string {
 	return func() string {
 		// Get wildcard source record name from metadata
@@ -127,6 +172,11 @@ func (c *Cache) tryPrefetch(ctx context.Context, i *item, server string, req *dn
 	if !i.beginRefresh(nowFunc(), failureRecheck) {
 		return
 	}
+	if i.subnet != nil && ecs.Get(req) == nil {
+		// Refresh the response for the same client subnet.
+		req = req.Copy()
+		ecs.Set(req, i.subnet)
+	}
 	cw := newPrefetchResponseWriter(server, req, do, cd, c)
 	go func() {
 		refreshed := c.doPrefetch(ctx, cw, i, now, stale)
@@ -234,6 +284,7 @@ func (c *Cache) Name() string { return "cache" }
 // getIfNotStale returns an item if it exists in the cache and has not expired.
 func (c *Cache) getIfNotStale(now time.Time, state request.Request, server string) *item {
 	k := hash(state.Name(), state.QType(), state.QClass(), state.Do(), state.Req.CheckingDisabled)
+	k = c.lookupKey(k, state)
 	cacheRequests.WithLabelValues(server, c.zonesMetricLabel, c.viewMetricLabel).Inc()
 
 	if c.preferPositive && c.staleUpTo > 0 {
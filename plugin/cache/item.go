@@ -25,6 +25,8 @@ type item struct {
 	answering          bool  // immutable result of validating that this item answers its question.
 	lastKnownGood      *item // answering item retained when a non-answer overwrites this success-cache key.
 
+	subnet *dns.EDNS0_SUBNET // client subnet this item is valid for, nil if valid for all clients.
+
 	origTTL uint32
 	stored  time.Time
 
@@ -57,6 +57,13 @@ var (
 		Name:      "served_stale_total",
 		Help:      "The number of requests served from stale cache entries.",
 	}, []string{"server", "zones", "view"})
+	// cacheSynthesized is the number of answers synthesized from cached NSEC and NSEC3 records.
+	cacheSynthesized = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "cache",
+		Name:      "synthesized_total",
+		Help:      "The number of answers synthesized from cached NSEC and NSEC3 records.",
+	}, []string{"server", "type", "zones", "view"})
 	// evictions is the counter of cache evictions.
 	evictions = promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: plugin.Namespace,
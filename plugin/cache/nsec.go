@@ -0,0 +1,601 @@
+package cache
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+
+	"github.com/miekg/dns"
+)
+
+// maxNSEC3Iterations is the highest number of NSEC3 iterations of the records that are kept, RFC 9276.
+const maxNSEC3Iterations = 150
+
+// nsecCache holds the NSEC and NSEC3 records, the SOA records and the wildcard answers from DNSSEC
+// validated replies, per zone, to synthesize NXDOMAIN, NODATA and wildcard answers from, as described
+// in RFC 8198.
+type nsecCache struct {
+	sync.RWMutex
+	zones map[string]*nsecZone
+	size  int // number of NSEC and NSEC3 records and wildcard answers kept
+	cap   int
+}
+
+// signedSet is a set of records together with the signatures over it.
+type signedSet struct {
+	rrs    []dns.RR
+	expire time.Time
+}
+
+// nsecRange is an NSEC or NSEC3 record with its signatures.
+type nsecRange struct {
+	owner string // owner name for NSEC, the hash label for NSEC3
+	types []uint16
+	next  string
+	set   *signedSet
+}
+
+type nsecZone struct {
+	name      string
+	ra        bool
+	soa       *signedSet
+	nsec      []*nsecRange // sorted on owner in canonical order
+	nsec3     []*nsecRange // sorted on hash
+	params    *dns.NSEC3   // hash parameters of the NSEC3 records
+	wildcards map[wildcardKey]*signedSet
+}
+
+type wildcardKey struct {
+	name  string // the wildcard, e.g. *.example.org.
+	qtype uint16
+}
+
+func newNSECCache(capacity int) *nsecCache {
+	return &nsecCache{zones: map[string]*nsecZone{}, cap: capacity}
+}
+
+// add keeps the SOA, NSEC and NSEC3 records from the authority section of m, and the wildcard answers in
+// its answer section. m must be validated. TTLs are capped at maxTTL.
+func (n *nsecCache) add(m *dns.Msg, now time.Time, maxTTL time.Duration) {
+	answers := signedSets(m.Answer)
+	authority := signedSets(m.Ns)
+
+	zone := ""
+	var soa []dns.RR
+	for _, s := range authority {
+		if s.rrtype == dns.TypeSOA && len(s.sigs) > 0 {
+			zone, soa = strings.ToLower(s.name), s.all()
+			break
+		}
+	}
+	if zone == "" {
+		// A wildcard answer, its zone is the signer of the answer.
+		for _, s := range answers {
+			if signer, _, ok := s.signer(); ok {
+				zone = signer
+				break
+			}
+		}
+	}
+	if zone == "" {
+		return
+	}
+
+	n.Lock()
+	defer n.Unlock()
+	if n.size >= n.cap {
+		n.expire(now)
+	}
+
+	z := n.zones[zone]
+	if z == nil {
+		z = &nsecZone{name: zone, wildcards: map[wildcardKey]*signedSet{}}
+		n.zones[zone] = z
+	}
+	z.ra = m.RecursionAvailable
+	if soa != nil {
+		ttl := maxTTL
+		if s, ok := soa[0].(*dns.SOA); ok {
+			// The negative TTL of the zone, RFC 2308, section 5.
+			ttl = min(ttl, time.Duration(min(s.Hdr.Ttl, s.Minttl))*time.Second)
+		}
+		z.soa = &signedSet{rrs: soa, expire: now.Add(ttl)}
+	}
+
+	for _, s := range authority {
+		if signer, _, ok := s.signer(); !ok || signer != zone || !dns.IsSubDomain(zone, s.name) {
+			continue
+		}
+		set := &signedSet{rrs: s.all(), expire: now.Add(s.ttl(now, maxTTL))}
+		switch s.rrtype {
+		case dns.TypeNSEC:
+			nsec := s.rrs[0].(*dns.NSEC)
+			n.insert(&z.nsec, &nsecRange{owner: s.name, types: nsec.TypeBitMap, next: nsec.NextDomain, set: set}, nsecLess)
+		case dns.TypeNSEC3:
+			nsec3 := s.rrs[0].(*dns.NSEC3)
+			// Opt-out spans may hold unsigned names, they can't be used to deny names, RFC 8198, section 5.1.
+			if nsec3.Flags&1 == 1 || nsec3.Iterations > maxNSEC3Iterations || nsec3.Hash != dns.SHA1 {
+				continue
+			}
+			if z.params == nil || z.params.Iterations != nsec3.Iterations || !strings.EqualFold(z.params.Salt, nsec3.Salt) {
+				n.size -= len(z.nsec3)
+				z.nsec3, z.params = nil, nsec3
+			}
+			hash := strings.ToUpper(s.name[:strings.IndexByte(s.name, '.')])
+			n.insert(&z.nsec3, &nsecRange{owner: hash, types: nsec3.TypeBitMap, next: strings.ToUpper(nsec3.NextDomain), set: set}, hashLess)
+		}
+	}
+
+	for _, s := range answers {
+		signer, labels, ok := s.signer()
+		if !ok || signer != zone || labels >= dns.CountLabel(s.name) {
+			continue
+		}
+		// A wildcard expansion, keep the records with the wildcard as owner name.
+		wildcard := "*." + suffix(strings.ToLower(s.name), labels)
+		set := &signedSet{expire: now.Add(s.ttl(now, maxTTL))}
+		for _, rr := range s.all() {
+			rr.Header().Name = wildcard
+			set.rrs = append(set.rrs, rr)
+		}
+		k := wildcardKey{wildcard, s.rrtype}
+		if _, ok := z.wildcards[k]; !ok {
+			if n.size >= n.cap {
+				continue
+			}
+			n.size++
+		}
+		z.wildcards[k] = set
+	}
+}
+
+// insert adds r to the sorted ranges, replacing a range with the same owner.
+func (n *nsecCache) insert(ranges *[]*nsecRange, r *nsecRange, less func(a, b string) int) {
+	rs := *ranges
+	i := sort.Search(len(rs), func(i int) bool { return less(rs[i].owner, r.owner) >= 0 })
+	if i < len(rs) && less(rs[i].owner, r.owner) == 0 {
+		rs[i] = r
+		return
+	}
+	if n.size >= n.cap {
+		return
+	}
+	n.size++
+	rs = append(rs, nil)
+	copy(rs[i+1:], rs[i:])
+	rs[i] = r
+	*ranges = rs
+}
+
+// expire removes all expired records.
+func (n *nsecCache) expire(now time.Time) {
+	for name, z := range n.zones {
+		z.nsec = n.live(z.nsec, now)
+		z.nsec3 = n.live(z.nsec3, now)
+		for k, s := range z.wildcards {
+			if now.After(s.expire) {
+				delete(z.wildcards, k)
+				n.size--
+			}
+		}
+		if len(z.nsec) == 0 && len(z.nsec3) == 0 && len(z.wildcards) == 0 {
+			delete(n.zones, name)
+		}
+	}
+}
+
+func (n *nsecCache) live(rs []*nsecRange, now time.Time) []*nsecRange {
+	j := 0
+	for _, r := range rs {
+		if now.After(r.set.expire) {
+			n.size--
+			continue
+		}
+		rs[j] = r
+		j++
+	}
+	return rs[:j]
+}
+
+// purge removes the records of the zones that f applies to, and returns the number of records removed.
+func (n *nsecCache) purge(f filter) int {
+	n.Lock()
+	defer n.Unlock()
+	purged := 0
+	for name := range n.zones {
+		switch {
+		case f.name != "" && !dns.IsSubDomain(name, f.name):
+			continue
+		case f.zone != "" && !dns.IsSubDomain(name, f.zone) && !dns.IsSubDomain(f.zone, name):
+			continue
+		}
+		z := n.zones[name]
+		size := len(z.nsec) + len(z.nsec3) + len(z.wildcards)
+		n.size -= size
+		purged += size
+		delete(n.zones, name)
+	}
+	return purged
+}
+
+// synthesize returns an answer for qname and qtype made from the kept records, or nil if they don't prove
+// anything about qname.
+func (n *nsecCache) synthesize(qname string, qtype uint16, now time.Time) *dns.Msg {
+	n.RLock()
+	defer n.RUnlock()
+
+	qname = strings.ToLower(qname)
+	var z *nsecZone
+	for name, zone := range n.zones {
+		if dns.IsSubDomain(name, qname) && (z == nil || dns.CountLabel(name) > dns.CountLabel(z.name)) {
+			z = zone
+		}
+	}
+	if z == nil || (qtype == dns.TypeDS && qname == z.name) {
+		// The DS records of a zone are in its parent.
+		return nil
+	}
+
+	var p *proof
+	if len(z.nsec) > 0 {
+		p = z.nsecProof(qname, qtype, now)
+	}
+	if p == nil && len(z.nsec3) > 0 {
+		p = z.nsec3Proof(qname, qtype, now)
+	}
+	if p == nil {
+		return nil
+	}
+
+	m := new(dns.Msg)
+	m.RecursionAvailable = z.ra
+	m.Rcode = p.rcode
+	sets := p.sets
+	if p.answer == nil {
+		if z.soa == nil || now.After(z.soa.expire) {
+			return nil
+		}
+		sets = append([]*signedSet{z.soa}, sets...)
+	}
+
+	ttl := uint32(0)
+	for i, s := range append(sets, p.answer) {
+		if s == nil {
+			continue
+		}
+		left := uint32(s.expire.Sub(now).Seconds())
+		if i == 0 || left < ttl {
+			ttl = left
+		}
+	}
+	if p.answer != nil {
+		for _, rr := range p.answer.rrs {
+			rr = dns.Copy(rr)
+			rr.Header().Name = qname
+			m.Answer = append(m.Answer, rr)
+		}
+		m.Answer = filterRRSlice(m.Answer, ttl, false)
+	}
+	seen := map[*signedSet]bool{}
+	for _, s := range sets {
+		if !seen[s] {
+			m.Ns = append(m.Ns, s.rrs...)
+			seen[s] = true
+		}
+	}
+	m.Ns = filterRRSlice(m.Ns, ttl, true)
+	return m
+}
+
+// proof is what the kept records prove about a name.
+type proof struct {
+	rcode  int
+	answer *signedSet   // the wildcard records that answer the query
+	sets   []*signedSet // NSEC or NSEC3 records that prove it
+}
+
+func (z *nsecZone) nsecProof(qname string, qtype uint16, now time.Time) *proof {
+	if r := z.findNSEC(qname, now); r != nil && r.owner == qname {
+		if !nodata(r.types, qtype, qname == z.name) {
+			return nil
+		}
+		return &proof{rcode: dns.RcodeSuccess, sets: []*signedSet{r.set}}
+	}
+
+	cover := z.coverNSEC(qname, now)
+	if cover == nil || below(cover, qname) {
+		return nil
+	}
+	ce := commonSuffix(qname, cover.owner)
+	if c := commonSuffix(qname, cover.next); dns.CountLabel(c) > dns.CountLabel(ce) {
+		ce = c
+	}
+	wildcard := "*." + ce
+	if s, ok := z.wildcards[wildcardKey{wildcard, qtype}]; ok && now.Before(s.expire) {
+		return &proof{rcode: dns.RcodeSuccess, answer: s, sets: []*signedSet{cover.set}}
+	}
+	if w := z.findNSEC(wildcard, now); w != nil && w.owner == wildcard {
+		if !nodata(w.types, qtype, false) {
+			return nil
+		}
+		return &proof{rcode: dns.RcodeSuccess, sets: []*signedSet{cover.set, w.set}}
+	}
+	if w := z.coverNSEC(wildcard, now); w != nil {
+		return &proof{rcode: dns.RcodeNameError, sets: []*signedSet{cover.set, w.set}}
+	}
+	return nil
+}
+
+// findNSEC returns the NSEC record with the largest owner name that is not larger than name.
+func (z *nsecZone) findNSEC(name string, now time.Time) *nsecRange {
+	i := sort.Search(len(z.nsec), func(i int) bool { return dnsutil.CanonicalCompare(z.nsec[i].owner, name) > 0 })
+	if i == 0 {
+		return nil
+	}
+	r := z.nsec[i-1]
+	if now.After(r.set.expire) {
+		return nil
+	}
+	return r
+}
+
+// coverNSEC returns the NSEC record for which name lies between the owner and the next name.
+func (z *nsecZone) coverNSEC(name string, now time.Time) *nsecRange {
+	r := z.findNSEC(name, now)
+	if r == nil || r.owner == name {
+		return nil
+	}
+	// The last NSEC in the zone points back to the apex.
+	if dnsutil.CanonicalCompare(name, r.next) < 0 || dnsutil.CanonicalCompare(r.next, r.owner) <= 0 {
+		return r
+	}
+	return nil
+}
+
+// below returns true if name is below the owner of r, and r is a delegation or DNAME, so the zone has no
+// records for name.
+func below(r *nsecRange, name string) bool {
+	if !dns.IsSubDomain(r.owner, name) {
+		return false
+	}
+	return (has(r.types, dns.TypeNS) && !has(r.types, dns.TypeSOA)) || has(r.types, dns.TypeDNAME)
+}
+
+func (z *nsecZone) nsec3Proof(qname string, qtype uint16, now time.Time) *proof {
+	if r := z.findNSEC3(qname, now); r != nil && r.owner == z.hash(qname) {
+		if !nodata(r.types, qtype, qname == z.name) {
+			return nil
+		}
+		return &proof{rcode: dns.RcodeSuccess, sets: []*signedSet{r.set}}
+	}
+
+	// The closest encloser proof, RFC 5155, section 8.3.
+	var (
+		ce     string
+		ceSet  *signedSet
+		nc     = qname
+		ncSet  *signedSet
+		exists bool
+	)
+	for off, end := 0, false; !end; off, end = dns.NextLabel(qname, off) {
+		name := qname[off:]
+		if !dns.IsSubDomain(z.name, name) {
+			break
+		}
+		if r := z.findNSEC3(name, now); r != nil && r.owner == z.hash(name) {
+			if name != z.name && ((has(r.types, dns.TypeNS) && !has(r.types, dns.TypeSOA)) || has(r.types, dns.TypeDNAME)) {
+				return nil
+			}
+			ce, ceSet, exists = name, r.set, true
+			break
+		}
+		nc = name
+	}
+	if !exists || ce == qname {
+		return nil
+	}
+	cover := z.coverNSEC3(nc, now)
+	if cover == nil {
+		return nil
+	}
+	ncSet = cover.set
+
+	wildcard := "*." + ce
+	if s, ok := z.wildcards[wildcardKey{wildcard, qtype}]; ok && now.Before(s.expire) {
+		return &proof{rcode: dns.RcodeSuccess, answer: s, sets: []*signedSet{ncSet}}
+	}
+	if w := z.findNSEC3(wildcard, now); w != nil && w.owner == z.hash(wildcard) {
+		if !nodata(w.types, qtype, false) {
+			return nil
+		}
+		return &proof{rcode: dns.RcodeSuccess, sets: []*signedSet{ceSet, ncSet, w.set}}
+	}
+	if w := z.coverNSEC3(wildcard, now); w != nil {
+		return &proof{rcode: dns.RcodeNameError, sets: []*signedSet{ceSet, ncSet, w.set}}
+	}
+	return nil
+}
+
+func (z *nsecZone) hash(name string) string {
+	return dns.HashName(name, z.params.Hash, z.params.Iterations, z.params.Salt)
+}
+
+// findNSEC3 returns the NSEC3 record with the largest hash that is not larger than the hash of name.
+func (z *nsecZone) findNSEC3(name string, now time.Time) *nsecRange {
+	h := z.hash(name)
+	i := sort.Search(len(z.nsec3), func(i int) bool { return z.nsec3[i].owner > h })
+	if i == 0 {
+		// Below the first hash, the last NSEC3 record wraps around to the first.
+		i = len(z.nsec3)
+	}
+	r := z.nsec3[i-1]
+	if now.After(r.set.expire) {
+		return nil
+	}
+	return r
+}
+
+// coverNSEC3 returns the NSEC3 record for which the hash of name lies between the owner and the next hash.
+func (z *nsecZone) coverNSEC3(name string, now time.Time) *nsecRange {
+	r := z.findNSEC3(name, now)
+	if r == nil {
+		return nil
+	}
+	h := z.hash(name)
+	if r.owner < r.next {
+		if r.owner < h && h < r.next {
+			return r
+		}
+		return nil
+	}
+	// The last NSEC3 record wraps around.
+	if h > r.owner || h < r.next {
+		return r
+	}
+	return nil
+}
+
+// nodata returns true if a name with types has no records of qtype, and the query isn't answered by
+// a CNAME or a referral.
+func nodata(types []uint16, qtype uint16, apex bool) bool {
+	if has(types, qtype) || has(types, dns.TypeCNAME) {
+		return false
+	}
+	if !apex && has(types, dns.TypeNS) && !has(types, dns.TypeSOA) {
+		// A delegation, only the DS records are in this zone.
+		return qtype == dns.TypeDS
+	}
+	return true
+}
+
+// rrset is the set of records in a section of a message with the same owner name and type.
+type rrset struct {
+	name   string
+	rrtype uint16
+	rrs    []dns.RR
+	sigs   []*dns.RRSIG
+}
+
+// all returns copies of the records and signatures of s.
+func (s *rrset) all() []dns.RR {
+	out := make([]dns.RR, 0, len(s.rrs)+len(s.sigs))
+	for _, rr := range s.rrs {
+		out = append(out, dns.Copy(rr))
+	}
+	for _, sig := range s.sigs {
+		out = append(out, dns.Copy(sig))
+	}
+	return out
+}
+
+// signer returns the signer name, lowercased, and the number of labels of the signatures over s. The
+// cache doesn't know which of the signatures validated the set, so if they don't all agree a forged one
+// may be among them, and ok is false.
+func (s *rrset) signer() (signer string, labels int, ok bool) {
+	if len(s.sigs) == 0 {
+		return "", 0, false
+	}
+	signer, labels = strings.ToLower(s.sigs[0].SignerName), int(s.sigs[0].Labels)
+	for _, sig := range s.sigs[1:] {
+		if !strings.EqualFold(sig.SignerName, signer) || int(sig.Labels) != labels {
+			return "", 0, false
+		}
+	}
+	return signer, labels, true
+}
+
+// ttl returns how long s can be kept: the smallest TTL of its records, capped by maxTTL and the expiration
+// of the signatures.
+func (s *rrset) ttl(now time.Time, maxTTL time.Duration) time.Duration {
+	ttl := maxTTL
+	for _, rr := range s.rrs {
+		ttl = min(ttl, time.Duration(rr.Header().Ttl)*time.Second)
+	}
+	for _, sig := range s.sigs {
+		ttl = min(ttl, time.Duration(sig.OrigTtl)*time.Second)
+		if left := time.Unix(int64(sig.Expiration), 0).Sub(now); left < ttl {
+			ttl = max(left, 0)
+		}
+	}
+	return ttl
+}
+
+// signedSets groups rrs into sets, with the signatures over them.
+func signedSets(rrs []dns.RR) []*rrset {
+	var sets []*rrset
+	get := func(name string, t uint16) *rrset {
+		for _, s := range sets {
+			if s.rrtype == t && strings.EqualFold(s.name, name) {
+				return s
+			}
+		}
+		s := &rrset{name: strings.ToLower(name), rrtype: t}
+		sets = append(sets, s)
+		return s
+	}
+	for _, rr := range rrs {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			s := get(rr.Header().Name, sig.TypeCovered)
+			s.sigs = append(s.sigs, sig)
+			continue
+		}
+		if rr.Header().Rrtype == dns.TypeOPT {
+			continue
+		}
+		s := get(rr.Header().Name, rr.Header().Rrtype)
+		s.rrs = append(s.rrs, rr)
+	}
+	// Only keep sets that are signed and have records.
+	j := 0
+	for _, s := range sets {
+		if len(s.rrs) > 0 && len(s.sigs) > 0 {
+			sets[j] = s
+			j++
+		}
+	}
+	return sets[:j]
+}
+
+// stripDNSSEC removes the DNSSEC records from rrs, for clients that did not set the DO bit.
+func stripDNSSEC(rrs []dns.RR) []dns.RR {
+	j := 0
+	for _, rr := range rrs {
+		switch rr.Header().Rrtype {
+		case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3:
+			continue
+		}
+		rrs[j] = rr
+		j++
+	}
+	return rrs[:j]
+}
+
+func nsecLess(a, b string) int { return dnsutil.CanonicalCompare(a, b) }
+
+func hashLess(a, b string) int { return strings.Compare(a, b) }
+
+func commonSuffix(a, b string) string { return suffix(a, dns.CompareDomainName(a, b)) }
+
+// suffix returns the last n labels of name.
+func suffix(name string, n int) string {
+	idx := dns.Split(name)
+	if n <= 0 || len(idx) == 0 {
+		return "."
+	}
+	if n >= len(idx) {
+		return name
+	}
+	return name[idx[len(idx)-n]:]
+}
+
+func has(types []uint16, t uint16) bool {
+	for _, x := range types {
+		if x == t {
+			return true
+		}
+	}
+	return false
+}
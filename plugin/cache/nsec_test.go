@@ -0,0 +1,276 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+const sig = "20301012085750 20200912082613 57411 example.org. ijSv5FmsNjFviBcOFwQgqjt073lttxTTNqkno6oMa3DD3kC+"
+
+// nsecBackend answers with the validated reply in replies for the query name, and counts the queries.
+func nsecBackend(replies map[string]*dns.Msg, queries *int) plugin.Handler {
+	return plugin.HandlerFunc(func(_ context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		*queries++
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.AuthenticatedData = true
+		if reply, ok := replies[r.Question[0].Name]; ok {
+			m.Rcode = reply.Rcode
+			m.Answer = reply.Answer
+			m.Ns = reply.Ns
+		}
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+}
+
+func nsecSOA() []dns.RR {
+	return []dns.RR{
+		test.SOA("example.org.	300	IN	SOA	ns.example.org. admin.example.org. 1 3600 600 86400 300"),
+		test.RRSIG("example.org.	300	IN	RRSIG	SOA 13 2 300 " + sig),
+	}
+}
+
+func TestAggressiveNSECNameError(t *testing.T) {
+	replies := map[string]*dns.Msg{
+		"a.example.org.": {
+			MsgHdr: dns.MsgHdr{Rcode: dns.RcodeNameError},
+			Ns: append(nsecSOA(),
+				test.NSEC("example.org.	300	IN	NSEC	b.example.org. NS SOA RRSIG NSEC DNSKEY"),
+				test.RRSIG("example.org.	300	IN	RRSIG	NSEC 13 2 300 "+sig),
+			),
+		},
+	}
+	queries := 0
+	c := New()
+	c.nsecs = newNSECCache(defaultCap)
+	c.Next = nsecBackend(replies, &queries)
+
+	tests := []struct {
+		qname   string
+		do      bool
+		queries int
+		rcode   int
+		ns      int
+	}{
+		{"a.example.org.", true, 1, dns.RcodeNameError, 4},
+		// Covered by the same NSEC record, and so is the wildcard.
+		{"aa.example.org.", true, 1, dns.RcodeNameError, 4},
+		// Without the DO bit only the SOA record is returned.
+		{"x.aa.example.org.", false, 1, dns.RcodeNameError, 1},
+		// Not covered.
+		{"c.example.org.", true, 2, dns.RcodeSuccess, 0},
+	}
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, dns.TypeA)
+		m.SetEdns0(4096, tc.do)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		c.ServeDNS(context.TODO(), rec, m)
+
+		if queries != tc.queries {
+			t.Errorf("Test %d: expected %d queries upstream, got %d", i, tc.queries, queries)
+		}
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[rec.Msg.Rcode])
+		}
+		if len(rec.Msg.Ns) != tc.ns {
+			t.Errorf("Test %d: expected %d records in the authority section, got %d", i, tc.ns, len(rec.Msg.Ns))
+		}
+		if rec.Msg.AuthenticatedData != tc.do {
+			t.Errorf("Test %d: expected AD bit %t, got %t", i, tc.do, rec.Msg.AuthenticatedData)
+		}
+		if rec.Msg.Authoritative {
+			t.Errorf("Test %d: expected no AA bit", i)
+		}
+	}
+}
+
+func TestAggressiveNSECNoData(t *testing.T) {
+	replies := map[string]*dns.Msg{
+		"b.example.org.": {
+			Ns: append(nsecSOA(),
+				test.NSEC("b.example.org.	300	IN	NSEC	d.example.org. A RRSIG NSEC"),
+				test.RRSIG("b.example.org.	300	IN	RRSIG	NSEC 13 3 300 "+sig),
+			),
+		},
+	}
+	queries := 0
+	c := New()
+	c.nsecs = newNSECCache(defaultCap)
+	c.Next = nsecBackend(replies, &queries)
+
+	query := func(qtype uint16, cd bool) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetQuestion("b.example.org.", qtype)
+		m.SetEdns0(4096, true)
+		m.CheckingDisabled = cd
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		c.ServeDNS(context.TODO(), rec, m)
+		return rec.Msg
+	}
+
+	query(dns.TypeAAAA, false)
+	if m := query(dns.TypeTXT, false); queries != 1 || m.Rcode != dns.RcodeSuccess || len(m.Answer) != 0 || len(m.Ns) != 4 {
+		t.Errorf("Expected NODATA for TXT from the NSEC record, got %d queries upstream and %v", queries, m)
+	}
+	// The NSEC record has type A.
+	if query(dns.TypeA, false); queries != 2 {
+		t.Errorf("Expected query for A upstream, got %d queries upstream", queries)
+	}
+	// The client validates itself.
+	if query(dns.TypeMX, true); queries != 3 {
+		t.Errorf("Expected query with CD bit upstream, got %d queries upstream", queries)
+	}
+}
+
+func TestAggressiveNSECUnvalidated(t *testing.T) {
+	replies := map[string]*dns.Msg{
+		"a.example.org.": {
+			MsgHdr: dns.MsgHdr{Rcode: dns.RcodeNameError},
+			Ns: append(nsecSOA(),
+				test.NSEC("example.org.	300	IN	NSEC	b.example.org. NS SOA RRSIG NSEC DNSKEY"),
+				test.RRSIG("example.org.	300	IN	RRSIG	NSEC 13 2 300 "+sig),
+			),
+		},
+	}
+	queries := 0
+	backend := nsecBackend(replies, &queries)
+	c := New()
+	c.nsecs = newNSECCache(defaultCap)
+	c.Next = plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		backend.ServeDNS(ctx, rec, r)
+		rec.Msg.AuthenticatedData = false
+		w.WriteMsg(rec.Msg)
+		return dns.RcodeSuccess, nil
+	})
+
+	for _, qname := range []string{"a.example.org.", "aa.example.org."} {
+		m := new(dns.Msg)
+		m.SetQuestion(qname, dns.TypeA)
+		m.SetEdns0(4096, true)
+		c.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), m)
+	}
+	if queries != 2 {
+		t.Errorf("Expected 2 queries upstream, got %d", queries)
+	}
+}
+
+func TestAggressiveNSECWildcard(t *testing.T) {
+	n := newNSECCache(defaultCap)
+	now := time.Now()
+
+	m := new(dns.Msg)
+	m.SetQuestion("a.example.org.", dns.TypeA)
+	m.AuthenticatedData = true
+	m.Answer = []dns.RR{
+		test.A("a.example.org.	300	IN	A	192.0.2.1"),
+		test.RRSIG("a.example.org.	300	IN	RRSIG	A 13 2 300 " + sig),
+	}
+	m.Ns = []dns.RR{
+		test.NSEC("*.example.org.	300	IN	NSEC	z.example.org. A RRSIG NSEC"),
+		test.RRSIG("*.example.org.	300	IN	RRSIG	NSEC 13 2 300 " + sig),
+	}
+	n.add(m, now, time.Hour)
+
+	// A NODATA reply for the wildcard itself, with the SOA record.
+	m = new(dns.Msg)
+	m.SetQuestion("*.example.org.", dns.TypeTXT)
+	m.AuthenticatedData = true
+	m.Ns = append(nsecSOA(),
+		test.NSEC("*.example.org.	300	IN	NSEC	z.example.org. A RRSIG NSEC"),
+		test.RRSIG("*.example.org.	300	IN	RRSIG	NSEC 13 2 300 "+sig),
+	)
+	n.add(m, now, time.Hour)
+
+	r := n.synthesize("c.example.org.", dns.TypeA, now.Add(10*time.Second))
+	if r == nil {
+		t.Fatal("Expected wildcard answer for c.example.org., got none")
+	}
+	if len(r.Answer) != 2 {
+		t.Fatalf("Expected 2 records in the answer section, got %d", len(r.Answer))
+	}
+	if name := r.Answer[0].Header().Name; name != "c.example.org." {
+		t.Errorf("Expected answer for c.example.org., got %s", name)
+	}
+	if ttl := r.Answer[0].Header().Ttl; ttl != 290 {
+		t.Errorf("Expected TTL 290, got %d", ttl)
+	}
+	if r := n.synthesize("c.example.org.", dns.TypeAAAA, now); r == nil || r.Rcode != dns.RcodeSuccess || len(r.Answer) != 0 {
+		t.Errorf("Expected NODATA for AAAA from the wildcard NSEC, got %v", r)
+	}
+	if r := n.synthesize("c.example.org.", dns.TypeA, now.Add(time.Hour)); r != nil {
+		t.Errorf("Expected no answer after expiry, got %v", r)
+	}
+}
+
+func TestAggressiveNSECForgedWildcardSignature(t *testing.T) {
+	n := newNSECCache(defaultCap)
+	now := time.Now()
+
+	// The first signature claims a.example.org. is an expansion of *.example.org., the second one, which
+	// validated, says it is not.
+	m := new(dns.Msg)
+	m.SetQuestion("a.example.org.", dns.TypeA)
+	m.AuthenticatedData = true
+	m.Answer = []dns.RR{
+		test.A("a.example.org.	300	IN	A	192.0.2.1"),
+		test.RRSIG("a.example.org.	300	IN	RRSIG	A 13 2 300 " + sig),
+		test.RRSIG("a.example.org.	300	IN	RRSIG	A 13 3 300 " + sig),
+	}
+	m.Ns = append(nsecSOA(),
+		test.NSEC("a.example.org.	300	IN	NSEC	z.example.org. A RRSIG NSEC"),
+		test.RRSIG("a.example.org.	300	IN	RRSIG	NSEC 13 3 300 "+sig),
+	)
+	n.add(m, now, time.Hour)
+
+	if r := n.synthesize("c.example.org.", dns.TypeA, now); r != nil && len(r.Answer) > 0 {
+		t.Errorf("Expected no wildcard answer for c.example.org., got %v", r.Answer)
+	}
+	if len(n.zones["example.org."].wildcards) != 0 {
+		t.Errorf("Expected no wildcards, got %v", n.zones["example.org."].wildcards)
+	}
+}
+
+func nsec3(rr string) *dns.NSEC3 { r, _ := dns.NewRR(rr); return r.(*dns.NSEC3) }
+
+func TestAggressiveNSEC3(t *testing.T) {
+	n := newNSECCache(defaultCap)
+	now := time.Now()
+
+	apex := dns.HashName("example.org.", dns.SHA1, 0, "")
+	m := new(dns.Msg)
+	m.SetQuestion("a.example.org.", dns.TypeA)
+	m.AuthenticatedData = true
+	m.Rcode = dns.RcodeNameError
+	// A zone with just its apex, the NSEC3 record covers every other hash.
+	m.Ns = append(nsecSOA(),
+		nsec3(strings.ToLower(apex)+".example.org.	300	IN	NSEC3	1 0 0 - "+apex+" NS SOA RRSIG DNSKEY NSEC3PARAM"),
+		test.RRSIG(strings.ToLower(apex)+".example.org.	300	IN	RRSIG	NSEC3 13 3 300 "+sig),
+	)
+	n.add(m, now, time.Hour)
+
+	if r := n.synthesize("x.y.example.org.", dns.TypeA, now); r == nil || r.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected NXDOMAIN from the NSEC3 record, got %v", r)
+	}
+	if r := n.synthesize("example.org.", dns.TypeTXT, now); r == nil || r.Rcode != dns.RcodeSuccess || len(r.Answer) != 0 {
+		t.Errorf("Expected NODATA from the NSEC3 record, got %v", r)
+	}
+	if r := n.synthesize("example.org.", dns.TypeSOA, now); r != nil {
+		t.Errorf("Expected no answer for SOA, got %v", r)
+	}
+
+	n.purge(filter{zone: "example.org."})
+	if r := n.synthesize("x.example.org.", dns.TypeA, now); r != nil {
+		t.Errorf("Expected no answer after purge, got %v", r)
+	}
+}
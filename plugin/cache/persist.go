@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/cache"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	defaultPersistInterval = 5 * time.Minute
+	snapshotVersion        = 1
+)
+
+// snapshot is the on disk format of the success and denial caches.
+type snapshot struct {
+	Version int            `json:"version"`
+	Items   []snapshotItem `json:"items"`
+}
+
+// snapshotItem is a cached element: the response in wire format, with the original TTL and the time
+// it was stored. Together they tell how long the element remains valid after loading it.
+type snapshotItem struct {
+	Key      uint64    `json:"key"`
+	Denial   bool      `json:"denial,omitempty"`
+	Msg      []byte    `json:"msg"`
+	TTL      uint32    `json:"ttl"`
+	Stored   time.Time `json:"stored"`
+	Wildcard string    `json:"wildcard,omitempty"`
+}
+
+// save writes the success and denial caches to c.persistFile. The file is replaced atomically.
+func (c *Cache) save() error {
+	s := snapshot{Version: snapshotVersion, Items: []snapshotItem{}}
+	for _, x := range []struct {
+		denial bool
+		cache  *cache.Cache[*item]
+	}{{false, c.pcache}, {true, c.ncache}} {
+		x.cache.Walk(func(items map[uint64]*item, key uint64) bool {
+			i, ok := items[key]
+			if !ok || i.subnet != nil {
+				// Responses for a client subnet are not saved.
+				return true
+			}
+			buf, err := i.msg().Pack()
+			if err != nil {
+				return true
+			}
+			s.Items = append(s.Items, snapshotItem{Key: key, Denial: x.denial, Msg: buf, TTL: i.origTTL, Stored: i.stored, Wildcard: i.wildcard})
+			return true
+		})
+	}
+
+	buf, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp := c.persistFile + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.persistFile)
+}
+
+// load reads the snapshot in c.persistFile into the caches. Elements that have expired, and can't be
+// served stale anymore, are skipped. It returns the number of loaded elements. A missing file is not
+// an error.
+func (c *Cache) load() (int, error) {
+	buf, err := os.ReadFile(filepath.Clean(c.persistFile))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	s := snapshot{}
+	if err := json.Unmarshal(buf, &s); err != nil {
+		return 0, err
+	}
+	if s.Version != snapshotVersion {
+		return 0, fmt.Errorf("unsupported cache snapshot version %d", s.Version)
+	}
+
+	now := c.now()
+	n := 0
+	for _, si := range s.Items {
+		m := new(dns.Msg)
+		if err := m.Unpack(si.Msg); err != nil || len(m.Question) == 0 {
+			continue
+		}
+		i := newItem(m, si.Stored, time.Duration(si.TTL)*time.Second)
+		i.wildcard = si.Wildcard
+		if ttl := i.ttl(now); ttl <= 0 && time.Duration(-ttl)*time.Second >= c.staleUpTo {
+			continue
+		}
+		if si.Denial {
+			c.ncache.Add(si.Key, i)
+		} else {
+			c.pcache.Add(si.Key, i)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// persist saves the caches every c.persistInterval until stop is closed.
+func (c *Cache) persist(stop <-chan struct{}) {
+	ticker := time.NewTicker(c.persistInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := c.save(); err != nil {
+				log.Warningf("Failed to save cache to %q: %s", c.persistFile, err)
+			}
+		}
+	}
+}
+
+// msg returns the response stored in i.
+func (i *item) msg() *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(i.Name, i.QType)
+	m.Question[0].Qclass = i.QClass
+	m.Response = true
+	m.Rcode = i.Rcode
+	m.AuthenticatedData = i.AuthenticatedData
+	m.RecursionAvailable = i.RecursionAvailable
+	m.Answer = i.Answer
+	m.Ns = i.Ns
+	m.Extra = i.Extra
+	return m
+}
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+func TestPersist(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cache.json")
+	now := time.Now()
+	c := newAdminCache(now) // 4 success elements, of which 1 is stale, and 1 denial element.
+	c.persistFile = file
+	if err := c.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		later     time.Duration
+		staleUpTo time.Duration
+		expected  int
+	}{
+		{"immediately", 0, 0, 4},
+		{"immediately with serve_stale", 0, time.Hour, 5},
+		{"after expiration", 2 * time.Minute, 0, 0},
+		{"after expiration with serve_stale", 2 * time.Minute, time.Hour, 5},
+		{"after serve_stale window", 2 * time.Hour, time.Hour, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := New()
+			c.persistFile = file
+			c.staleUpTo = tc.staleUpTo
+			c.now = func() time.Time { return now.Add(tc.later) }
+			n, err := c.load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != tc.expected || c.pcache.Len()+c.ncache.Len() != tc.expected {
+				t.Errorf("Expected %d loaded elements, got %d", tc.expected, n)
+			}
+		})
+	}
+
+	// The loaded element keeps its remaining TTL, and is found with the original key.
+	c = New()
+	c.persistFile = file
+	c.now = func() time.Time { return now.Add(30 * time.Second) }
+	if _, err := c.load(); err != nil {
+		t.Fatal(err)
+	}
+	req := new(dns.Msg)
+	req.SetQuestion("example.org.", dns.TypeA)
+	state := request.Request{W: &test.ResponseWriter{}, Req: req}
+	i := c.getIfNotStale(c.now(), state, "test")
+	if i == nil {
+		t.Fatal("Expected element for example.org./A")
+	}
+	if ttl := i.ttl(c.now()); ttl != 30 {
+		t.Errorf("Expected TTL %d, got %d", 30, ttl)
+	}
+	if len(i.Answer) != 1 || i.Answer[0].(*dns.A).A.String() != "127.0.0.53" {
+		t.Errorf("Unexpected answer %v", i.Answer)
+	}
+}
+
+func TestPersistLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	c := New()
+
+	c.persistFile = filepath.Join(dir, "missing.json")
+	if n, err := c.load(); n != 0 || err != nil {
+		t.Errorf("Expected no elements and no error for a missing file, got %d and %v", n, err)
+	}
+
+	for _, content := range []string{"garbage", `{"version": 2, "items": []}`} {
+		c.persistFile = filepath.Join(dir, "bad.json")
+		if err := os.WriteFile(c.persistFile, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.load(); err == nil {
+			t.Errorf("Expected error for %q", content)
+		}
+	}
+}
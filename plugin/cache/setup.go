@@ -3,6 +3,8 @@ package cache
 import (
 	"errors"
 	"fmt"
+	"net"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -29,6 +31,43 @@ func setup(c *caddy.Controller) error {
 		return nil
 	})
 
+	if ca.adminAddr != "" {
+		a := getAdmin(ca.adminAddr, ca)
+		uniqAdmin.Set(a.Addr, a.onStartup)
+		c.OnStartup(func() error { uniqAdmin.Set(a.Addr, a.onStartup); return nil })
+		c.OnRestartFailed(func() error { uniqAdmin.Set(a.Addr, a.onStartup); return nil })
+
+		c.OnStartup(func() error { return uniqAdmin.ForEach() })
+		c.OnRestartFailed(func() error { return uniqAdmin.ForEach() })
+
+		c.OnRestart(a.onFinalShutdown)
+		c.OnFinalShutdown(a.onFinalShutdown)
+	}
+
+	if ca.persistFile != "" {
+		stop := make(chan struct{})
+		c.OnStartup(func() error {
+			n, err := ca.load()
+			if err != nil {
+				log.Warningf("Failed to load cache from %q: %s", ca.persistFile, err)
+			} else if n > 0 {
+				log.Infof("Loaded %d cache entries from %q", n, ca.persistFile)
+			}
+			go ca.persist(stop)
+			return nil
+		})
+		save := func() error {
+			if err := ca.save(); err != nil {
+				log.Warningf("Failed to save cache to %q: %s", ca.persistFile, err)
+			}
+			return nil
+		}
+		// Save on reload, so the new instance can load the most recent data.
+		c.OnRestart(save)
+		c.OnShutdown(func() error { close(stop); return nil })
+		c.OnFinalShutdown(save)
+	}
+
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
 		ca.Next = next
 		return ca
@@ -300,12 +339,61 @@ func cacheParse(c *caddy.Controller) (*Cache, error) {
 				default:
 					return nil, fmt.Errorf("cache type for disable must be %q or %q", Success, Denial)
 				}
+			case "aggressive_nsec":
+				args := c.RemainingArgs()
+				if len(args) > 1 {
+					return nil, c.ArgErr()
+				}
+				ca.nseccap = defaultCap
+				if len(args) == 1 {
+					nseccap, err := strconv.Atoi(args[0])
+					if err != nil {
+						return nil, err
+					}
+					if nseccap <= 0 {
+						return nil, fmt.Errorf("aggressive_nsec capacity must be positive: %d", nseccap)
+					}
+					ca.nseccap = nseccap
+				}
 			case "keepttl":
 				args := c.RemainingArgs()
 				if len(args) != 0 {
 					return nil, c.ArgErr()
 				}
 				ca.keepttl = true
+			case "persist":
+				args := c.RemainingArgs()
+				if len(args) == 0 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				ca.persistFile = args[0]
+				if root := dnsserver.GetConfig(c).Root; !filepath.IsAbs(ca.persistFile) && root != "" {
+					ca.persistFile = filepath.Join(root, ca.persistFile)
+				}
+				ca.persistInterval = defaultPersistInterval
+				if len(args) == 2 {
+					d, err := time.ParseDuration(args[1])
+					if err != nil {
+						return nil, err
+					}
+					if d <= 0 {
+						return nil, fmt.Errorf("persist interval must be positive: %s", d)
+					}
+					ca.persistInterval = d
+				}
+			case "admin":
+				args := c.RemainingArgs()
+				switch len(args) {
+				case 0:
+					ca.adminAddr = defaultAdminAddr
+				case 1:
+					if _, _, err := net.SplitHostPort(args[0]); err != nil {
+						return nil, err
+					}
+					ca.adminAddr = args[0]
+				default:
+					return nil, c.ArgErr()
+				}
 			default:
 				return nil, c.ArgErr()
 			}
@@ -318,6 +406,10 @@ func cacheParse(c *caddy.Controller) (*Cache, error) {
 		ca.zonesMetricLabel = strings.Join(origins, ",")
 		ca.pcache = cache.New[*item](ca.pcap)
 		ca.ncache = cache.New[*item](ca.ncap)
+		ca.scopes = cache.New[scopeSet](ca.pcap)
+		if ca.nseccap > 0 {
+			ca.nsecs = newNSECCache(ca.nseccap)
+		}
 	}
 
 	return ca, nil
@@ -337,6 +337,68 @@ func TestDisable(t *testing.T) {
 	}
 }
 
+func TestSetupAdmin(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  string
+	}{
+		{"admin", false, defaultAdminAddr},
+		{"admin 127.0.0.1:9999", false, "127.0.0.1:9999"},
+		{"admin 127.0.0.1", true, ""},
+		{"admin :1 :2", true, ""},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", fmt.Sprintf("cache {\n%s\n}", test.input))
+		ca, err := cacheParse(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %v: Expected error but found nil", i)
+			continue
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if test.shouldErr {
+			continue
+		}
+		if ca.adminAddr != test.expected {
+			t.Errorf("Test %v: Expected admin address %q, got %q", i, test.expected, ca.adminAddr)
+		}
+	}
+}
+
+func TestSetupPersist(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		file      string
+		interval  time.Duration
+	}{
+		{"persist /var/lib/coredns/cache.json", false, "/var/lib/coredns/cache.json", defaultPersistInterval},
+		{"persist cache.json 1m", false, "cache.json", time.Minute},
+		{"persist", true, "", 0},
+		{"persist cache.json 0s", true, "", 0},
+		{"persist cache.json 1m extra", true, "", 0},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", fmt.Sprintf("cache {\n%s\n}", test.input))
+		ca, err := cacheParse(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %v: Expected error but found nil", i)
+			continue
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if test.shouldErr {
+			continue
+		}
+		if ca.persistFile != test.file || ca.persistInterval != test.interval {
+			t.Errorf("Test %v: Expected %q and %s, got %q and %s", i, test.file, test.interval, ca.persistFile, ca.persistInterval)
+		}
+	}
+}
+
 func TestKeepttl(t *testing.T) {
 	tests := []struct {
 		input     string
@@ -365,3 +427,40 @@ func TestKeepttl(t *testing.T) {
 		}
 	}
 }
+
+func TestAggressiveNSEC(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		capacity  int
+	}{
+		// positive
+		{"aggressive_nsec", false, defaultCap},
+		{"aggressive_nsec 100", false, 100},
+		// negative
+		{"aggressive_nsec 0", true, 0},
+		{"aggressive_nsec -1", true, 0},
+		{"aggressive_nsec many", true, 0},
+		{"aggressive_nsec 1 2", true, 0},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", fmt.Sprintf("cache {\n%s\n}", test.input))
+		ca, err := cacheParse(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %v: Expected error but found nil", i)
+			continue
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if test.shouldErr {
+			continue
+		}
+		if ca.nsecs == nil {
+			t.Fatalf("Test %v: Expected aggressive_nsec enabled but disabled", i)
+		}
+		if ca.nsecs.cap != test.capacity {
+			t.Errorf("Test %v: Expected capacity %d, got %d", i, test.capacity, ca.nsecs.cap)
+		}
+	}
+}
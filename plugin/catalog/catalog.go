@@ -0,0 +1,169 @@
+// Package catalog implements a plugin that produces an RFC 9432 catalog zone.
+package catalog
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/catalog"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/transfer"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+var log = clog.NewWithPlugin("catalog")
+
+// Catalog is a plugin that serves a catalog zone listing the zones this server is primary for.
+type Catalog struct {
+	Next plugin.Handler
+
+	origin  string
+	groups  []property
+	coo     []property
+	exclude []string
+	refresh time.Duration
+
+	sources []func() []string // return the names of the zones of the *file* and *auto* plugins.
+	xfer    *transfer.Transfer
+	now     func() time.Time
+
+	mu      sync.RWMutex
+	zone    *file.Zone
+	members []catalog.Member
+	serial  uint32
+}
+
+// property is a catalog member property that applies to the member zones at or below zones, or to
+// all member zones if zones is empty.
+type property struct {
+	value string
+	zones []string
+}
+
+func (p property) applies(zone string) bool {
+	return len(p.zones) == 0 || plugin.Zones(p.zones).Matches(zone) != ""
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (c *Catalog) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+	if !dns.IsSubDomain(c.origin, state.Name()) {
+		return plugin.NextOrFailure(c.Name(), c.Next, ctx, w, r)
+	}
+
+	c.mu.RLock()
+	z := c.zone
+	c.mu.RUnlock()
+	if z == nil {
+		return dns.RcodeServerFailure, nil
+	}
+	f := file.File{Zones: file.Zones{Z: map[string]*file.Zone{c.origin: z}, Names: []string{c.origin}}}
+	return f.ServeDNS(ctx, w, r)
+}
+
+// Transfer implements the transfer.Transferer interface.
+func (c *Catalog) Transfer(zone string, serial uint32) (<-chan []dns.RR, error) {
+	if zone != c.origin {
+		return nil, transfer.ErrNotAuthoritative
+	}
+	c.mu.RLock()
+	z := c.zone
+	c.mu.RUnlock()
+	if z == nil {
+		return nil, transfer.ErrNotAuthoritative
+	}
+	return z.Transfer(serial)
+}
+
+// Name implements the plugin.Handler interface.
+func (c *Catalog) Name() string { return "catalog" }
+
+// Refresh rebuilds the catalog zone from the current member zones. If the members changed, the serial
+// is increased and secondaries are notified. It returns true if the catalog zone changed.
+func (c *Catalog) Refresh() bool {
+	members := c.collect()
+
+	c.mu.Lock()
+	if c.zone != nil && slices.EqualFunc(members, c.members, equal) {
+		c.mu.Unlock()
+		return false
+	}
+	serial := uint32(c.now().Unix()) // #nosec G115 -- serials wrap, see RFC 1982.
+	if c.zone != nil && int32(serial-c.serial) <= 0 {
+		serial = c.serial + 1
+	}
+	z := file.NewZone(c.origin, "")
+	for _, rr := range (&catalog.Catalog{Origin: c.origin, Members: members}).Records(serial) {
+		if err := z.Insert(rr); err != nil {
+			c.mu.Unlock()
+			log.Errorf("Failed to build catalog zone %q: %s", c.origin, err)
+			return false
+		}
+	}
+	c.zone, c.members, c.serial = z, members, serial
+	c.mu.Unlock()
+
+	log.Infof("Catalog zone %q has %d member zones, serial %d", c.origin, len(members), serial)
+	if c.xfer != nil {
+		if err := c.xfer.Notify(c.origin); err != nil {
+			log.Warning(err)
+		}
+	}
+	return true
+}
+
+// collect returns the sorted member zones with their properties.
+func (c *Catalog) collect() []catalog.Member {
+	var names []string
+	for _, source := range c.sources {
+		for _, name := range source() {
+			name = strings.ToLower(dns.Fqdn(name))
+			if name == c.origin || plugin.Zones(c.exclude).Matches(name) != "" {
+				continue
+			}
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	members := make([]catalog.Member, len(names))
+	for i, name := range names {
+		m := catalog.Member{ID: catalog.MemberID(name), Zone: name}
+		for _, g := range c.groups {
+			if g.applies(name) && !slices.Contains(m.Groups, g.value) {
+				m.Groups = append(m.Groups, g.value)
+			}
+		}
+		slices.Sort(m.Groups)
+		if j := slices.IndexFunc(c.coo, func(p property) bool { return p.applies(name) }); j >= 0 {
+			m.ChangeOfOwnership = c.coo[j].value
+		}
+		members[i] = m
+	}
+	return members
+}
+
+func equal(a, b catalog.Member) bool {
+	return a.ID == b.ID && a.Zone == b.Zone && a.ChangeOfOwnership == b.ChangeOfOwnership && slices.Equal(a.Groups, b.Groups)
+}
+
+// primaryZones returns a function that returns the zones of f that are not transferred in.
+func primaryZones(f file.File) func() []string {
+	return func() []string {
+		var names []string
+		for _, name := range f.Names {
+			if z, ok := f.Z[name]; ok && z != nil && len(z.TransferFrom) == 0 {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+}
@@ -0,0 +1,153 @@
+package catalog
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/catalog"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/plugin/transfer"
+
+	"github.com/miekg/dns"
+)
+
+func newCatalog(names *[]string) *Catalog {
+	now := time.Unix(1000, 0)
+	return &Catalog{
+		origin:  "catalog.example.",
+		groups:  []property{{value: "signed", zones: []string{"example.org."}}, {value: "all"}},
+		coo:     []property{{value: "new-catalog.example.", zones: []string{"moved.example."}}},
+		exclude: []string{"internal.example."},
+		sources: []func() []string{func() []string { return *names }},
+		now:     func() time.Time { return now },
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	names := []string{"example.org.", "a.example.org.", "Example.NET", "internal.example.", "moved.example.", "catalog.example."}
+	c := newCatalog(&names)
+
+	if !c.Refresh() {
+		t.Fatal("Expected catalog zone to be built")
+	}
+	if c.serial != 1000 {
+		t.Errorf("Expected serial %d, got %d", 1000, c.serial)
+	}
+
+	rrs := transferAll(t, c)
+	cat, err := catalog.Parse("catalog.example.", rrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zones := map[string]catalog.Member{}
+	for _, m := range cat.Members {
+		zones[m.Zone] = m
+	}
+	if len(zones) != 4 {
+		t.Fatalf("Expected %d member zones, got %d: %v", 4, len(zones), cat.Members)
+	}
+	if m := zones["a.example.org."]; !slices.Equal(m.Groups, []string{"all", "signed"}) || m.ID != catalog.MemberID("a.example.org.") {
+		t.Errorf("Unexpected member %+v", m)
+	}
+	if m := zones["example.net."]; !slices.Equal(m.Groups, []string{"all"}) || m.ChangeOfOwnership != "" {
+		t.Errorf("Unexpected member %+v", m)
+	}
+	if m := zones["moved.example."]; m.ChangeOfOwnership != "new-catalog.example." {
+		t.Errorf("Expected coo for %s, got %+v", "moved.example.", m)
+	}
+
+	// Nothing changed.
+	if c.Refresh() {
+		t.Error("Expected catalog zone to be unchanged")
+	}
+
+	// A new zone bumps the serial, even if the clock didn't move.
+	names = append(names, "new.example.")
+	if !c.Refresh() {
+		t.Fatal("Expected catalog zone to be changed")
+	}
+	if c.serial != 1001 {
+		t.Errorf("Expected serial %d, got %d", 1001, c.serial)
+	}
+	if x := len(c.members); x != 5 {
+		t.Errorf("Expected %d member zones, got %d", 5, x)
+	}
+}
+
+func TestServeDNS(t *testing.T) {
+	names := []string{"example.org."}
+	c := newCatalog(&names)
+	c.Next = test.NextHandler(dns.RcodeRefused, nil)
+	c.Refresh()
+
+	tests := []struct {
+		qname  string
+		qtype  uint16
+		rcode  int
+		answer int
+	}{
+		{"catalog.example.", dns.TypeSOA, dns.RcodeSuccess, 1},
+		{"version.catalog.example.", dns.TypeTXT, dns.RcodeSuccess, 1},
+		{catalog.MemberID("example.org.") + ".zones.catalog.example.", dns.TypePTR, dns.RcodeSuccess, 1},
+		{"x.zones.catalog.example.", dns.TypePTR, dns.RcodeNameError, 0},
+		{"example.org.", dns.TypeA, dns.RcodeRefused, 0},
+	}
+	for _, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		rcode, _ := c.ServeDNS(context.TODO(), rec, m)
+		if rec.Msg != nil {
+			rcode = rec.Msg.Rcode
+		}
+		if rcode != tc.rcode {
+			t.Errorf("%s/%d: expected rcode %d, got %d", tc.qname, tc.qtype, tc.rcode, rcode)
+			continue
+		}
+		if rec.Msg != nil && len(rec.Msg.Answer) != tc.answer {
+			t.Errorf("%s/%d: expected %d answers, got %d", tc.qname, tc.qtype, tc.answer, len(rec.Msg.Answer))
+		}
+	}
+}
+
+func TestTransferNotAuthoritative(t *testing.T) {
+	names := []string{"example.org."}
+	c := newCatalog(&names)
+	if _, err := c.Transfer("catalog.example.", 0); err != transfer.ErrNotAuthoritative {
+		t.Errorf("Expected %s before the first refresh, got %v", transfer.ErrNotAuthoritative, err)
+	}
+	c.Refresh()
+	if _, err := c.Transfer("example.org.", 0); err != transfer.ErrNotAuthoritative {
+		t.Errorf("Expected %s, got %v", transfer.ErrNotAuthoritative, err)
+	}
+}
+
+func TestPrimaryZones(t *testing.T) {
+	primary := file.NewZone("example.org.", "")
+	secondary := file.NewZone("example.net.", "")
+	secondary.TransferFrom = []string{"10.0.0.1:53"}
+	f := file.File{Zones: file.Zones{
+		Z:     map[string]*file.Zone{"example.org.": primary, "example.net.": secondary},
+		Names: []string{"example.org.", "example.net."},
+	}}
+	if names := primaryZones(f)(); !slices.Equal(names, []string{"example.org."}) {
+		t.Errorf("Expected only %s, got %v", "example.org.", names)
+	}
+}
+
+func transferAll(t *testing.T, c *Catalog) []dns.RR {
+	t.Helper()
+	ch, err := c.Transfer("catalog.example.", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rrs []dns.RR
+	for x := range ch {
+		rrs = append(rrs, x...)
+	}
+	return rrs[:len(rrs)-1] // drop the closing SOA
+}
@@ -0,0 +1,135 @@
+package catalog
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/auto"
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/transfer"
+
+	"github.com/miekg/dns"
+)
+
+const defaultRefresh = time.Minute
+
+func init() { plugin.Register("catalog", setup) }
+
+func setup(c *caddy.Controller) error {
+	cat, err := parse(c)
+	if err != nil {
+		return plugin.Error("catalog", err)
+	}
+
+	stop := make(chan struct{})
+	c.OnStartup(func() error {
+		config := dnsserver.GetConfig(c)
+		// Find the plugins that we are primary for and get their zones. These plugins are set up
+		// before us, so auto has already loaded its zones.
+		for _, h := range config.Handlers() {
+			switch x := h.(type) {
+			case file.File:
+				cat.sources = append(cat.sources, primaryZones(x))
+			case auto.Auto:
+				cat.sources = append(cat.sources, x.Zones.Names)
+			}
+		}
+		if t := config.Handler("transfer"); t != nil {
+			cat.xfer = t.(*transfer.Transfer)
+		}
+
+		cat.Refresh()
+		go func() {
+			ticker := time.NewTicker(cat.refresh)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-ticker.C:
+					cat.Refresh()
+				}
+			}
+		}()
+		return nil
+	})
+	c.OnShutdown(func() error {
+		close(stop)
+		return nil
+	})
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		cat.Next = next
+		return cat
+	})
+
+	return nil
+}
+
+func parse(c *caddy.Controller) (*Catalog, error) {
+	cat := &Catalog{refresh: defaultRefresh, now: time.Now}
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return nil, c.ArgErr()
+		}
+		origins := plugin.OriginsFromArgsOrServerBlock(args, c.ServerBlockKeys)
+		cat.origin = origins[0]
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "group", "coo":
+				what := c.Val()
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				p := property{value: args[0], zones: plugin.OriginsFromArgsOrServerBlock(args[1:], nil)}
+				if what == "group" {
+					cat.groups = append(cat.groups, p)
+					continue
+				}
+				if _, ok := dns.IsDomainName(p.value); !ok {
+					return nil, c.Errf("invalid catalog zone name %q", p.value)
+				}
+				p.value = strings.ToLower(dns.Fqdn(p.value))
+				cat.coo = append(cat.coo, p)
+			case "exclude":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				cat.exclude = append(cat.exclude, plugin.OriginsFromArgsOrServerBlock(args, nil)...)
+			case "refresh":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				d, err := time.ParseDuration(c.Val())
+				if err != nil {
+					return nil, c.Errf("invalid refresh %q: %s", c.Val(), err)
+				}
+				if d <= 0 {
+					return nil, fmt.Errorf("refresh must be positive: %s", d)
+				}
+				cat.refresh = d
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+			default:
+				return nil, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+	}
+	return cat, nil
+}
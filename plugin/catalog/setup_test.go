@@ -0,0 +1,72 @@
+package catalog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		origin    string
+		groups    int
+		coo       int
+		refresh   time.Duration
+	}{
+		{`catalog catalog.example`, false, "catalog.example.", 0, 0, defaultRefresh},
+		{`catalog catalog.example {
+			group signed example.org
+			group all
+			coo new.catalog.example example.net
+			exclude internal.example
+			refresh 10s
+		}`, false, "catalog.example.", 2, 1, 10 * time.Second},
+		// fails
+		{`catalog`, true, "", 0, 0, 0},
+		{`catalog a.example b.example`, true, "", 0, 0, 0},
+		{`catalog catalog.example {
+			group
+		}`, true, "", 0, 0, 0},
+		{`catalog catalog.example {
+			refresh -1s
+		}`, true, "", 0, 0, 0},
+		{`catalog catalog.example {
+			refresh 1s 2s
+		}`, true, "", 0, 0, 0},
+		{`catalog catalog.example {
+			exclude
+		}`, true, "", 0, 0, 0},
+		{`catalog catalog.example {
+			unknown
+		}`, true, "", 0, 0, 0},
+		{`catalog catalog.example
+		catalog other.example`, true, "", 0, 0, 0},
+	}
+
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		cat, err := parse(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error but found none for input %s", i, tc.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error but found one for input %s: %v", i, tc.input, err)
+			continue
+		}
+		if cat.origin != tc.origin {
+			t.Errorf("Test %d: expected origin %s, got %s", i, tc.origin, cat.origin)
+		}
+		if len(cat.groups) != tc.groups || len(cat.coo) != tc.coo {
+			t.Errorf("Test %d: expected %d groups and %d coo, got %d and %d", i, tc.groups, tc.coo, len(cat.groups), len(cat.coo))
+		}
+		if cat.refresh != tc.refresh {
+			t.Errorf("Test %d: expected refresh %s, got %s", i, tc.refresh, cat.refresh)
+		}
+	}
+}
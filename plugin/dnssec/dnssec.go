@@ -1,5 +1,5 @@
 // Package dnssec implements a plugin that signs responses on-the-fly using
-// NSEC black lies.
+// NSEC black lies, or NSEC3 black or white lies.
 package dnssec
 
 import (
@@ -23,6 +23,8 @@ type Dnssec struct {
 	splitkeys bool
 	inflight  *singleflight.Group
 	cache     *cache.Cache[[]dns.RR]
+
+	nsec3Param *nsec3Param // if set, NSEC3 is used for authenticated denial of existence instead of NSEC
 }
 
 // New returns a new Dnssec.
@@ -37,11 +39,17 @@ func New(zones []string, keys []*DNSKEY, splitkeys bool, next plugin.Handler, c
 }
 
 // Sign signs the message in state. it takes care of negative or nodata responses. It
-// uses NSEC black lies for authenticated denial of existence. For delegations it
+// uses NSEC (or NSEC3) black lies for authenticated denial of existence. For delegations it
 // will insert DS records and sign those.
 // Signatures will be cached for a short while. By default we sign for 8 days,
 // starting 3 hours ago.
 func (d Dnssec) Sign(state request.Request, now time.Time, server string) *dns.Msg {
+	return d.signMsg(state, now, server, "")
+}
+
+// signMsg is Sign, ce is the closest encloser of the qname. It's needed to prove an NXDOMAIN with
+// NSEC3 white lies, if empty the NXDOMAIN is turned into a NODATA response as with black lies.
+func (d Dnssec) signMsg(state request.Request, now time.Time, server, ce string) *dns.Msg {
 	req := state.Req
 
 	incep, expir := incepExpir(now)
@@ -61,7 +69,7 @@ func (d Dnssec) Sign(state request.Request, now time.Time, server string) *dns.M
 			}
 		}
 		if len(ds) == 0 {
-			if sigs, err := d.nsec(state, mt, ttl, incep, expir, server); err == nil {
+			if sigs, err := d.denial(state, mt, ce, ttl, incep, expir, server); err == nil {
 				req.Ns = append(req.Ns, sigs...)
 			}
 		} else if sigs, err := d.sign(ds, state.Zone, ttl, incep, expir, server); err == nil {
@@ -80,10 +88,16 @@ func (d Dnssec) Sign(state request.Request, now time.Time, server string) *dns.M
 		if sigs, err := d.sign(req.Ns, state.Zone, ttl, incep, expir, server); err == nil {
 			req.Ns = append(req.Ns, sigs...)
 		}
-		if sigs, err := d.nsec(state, mt, ttl, incep, expir, server); err == nil {
+		if sigs, err := d.denial(state, mt, ce, ttl, incep, expir, server); err == nil {
 			req.Ns = append(req.Ns, sigs...)
 		}
 		if len(req.Ns) > 1 { // actually added nsec and sigs, reset the rcode
+			if d.nsec3Param != nil {
+				if mt != response.NameError || ce == "" {
+					req.Rcode = dns.RcodeSuccess
+				}
+				return req
+			}
 			req.Rcode = dns.RcodeSuccess
 			if state.QType() == dns.TypeNSEC { // If original query was NSEC move Ns to Answer without SOA
 				req.Answer = req.Ns[len(req.Ns)-2 : len(req.Ns)]
@@ -127,6 +141,14 @@ func (d Dnssec) Sign(state request.Request, now time.Time, server string) *dns.M
 	return req
 }
 
+// denial returns the NSEC or NSEC3 records, with signatures, for the negative or delegation response in state.
+func (d Dnssec) denial(state request.Request, mt response.Type, ce string, ttl, incep, expir uint32, server string) ([]dns.RR, error) {
+	if d.nsec3Param != nil {
+		return d.nsec3(state, mt, ce, ttl, incep, expir, server)
+	}
+	return d.nsec(state, mt, ttl, incep, expir, server)
+}
+
 func (d Dnssec) sign(rrs []dns.RR, signerName string, ttl, incep, expir uint32, server string) ([]dns.RR, error) {
 	k := hash(rrs)
 	sgs, ok := d.get(k, server)
@@ -38,8 +38,19 @@ func (d Dnssec) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 		}
 	}
 
+	if qtype == dns.TypeNSEC3PARAM && d.nsec3Param != nil {
+		for _, z := range d.zones {
+			if qname == z {
+				resp := d.getNSEC3PARAM(state, z, do, server)
+				resp.Authoritative = true
+				w.WriteMsg(resp)
+				return dns.RcodeSuccess, nil
+			}
+		}
+	}
+
 	if do {
-		drr := &ResponseWriter{w, d, server}
+		drr := &ResponseWriter{w, d, server, ctx}
 		return plugin.NextOrFailure(d.Name(), d.Next, ctx, drr, r)
 	}
 
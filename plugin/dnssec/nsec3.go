@@ -0,0 +1,218 @@
+package dnssec
+
+import (
+	"context"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/nonwriter"
+	"github.com/coredns/coredns/plugin/pkg/response"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// nsec3Param holds the NSEC3 parameters used for authenticated denial of existence.
+type nsec3Param struct {
+	iterations uint16
+	salt       string // hex encoded, empty for no salt
+	whiteLies  bool   // prove NXDOMAIN instead of turning it into NODATA
+}
+
+// maxProbes is the maximum number of queries we send to find the closest encloser of a name.
+const maxProbes = 8
+
+var b32 = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// nsec3 returns NSEC3 records, and their signatures, useful for NODATA, NXDOMAIN and unsigned
+// delegation responses.
+//
+// With black lies, or when the closest encloser ce isn't known, a single NSEC3 is returned that
+// matches the qname, this makes every NXDOMAIN answer a NODATA one. With white lies an NXDOMAIN is
+// proven with the closest encloser proof of RFC 5155, section 7.2.2: a NSEC3 matching ce and NSEC3s
+// covering the next closer name and the wildcard at ce. The covering NSEC3s span only the hash
+// they cover (RFC 7129, appendix B), so they can't be used to walk the zone.
+func (d Dnssec) nsec3(state request.Request, mt response.Type, ce string, ttl, incep, expir uint32, server string) ([]dns.RR, error) {
+	p := d.nsec3Param
+	var nsec3s []dns.RR
+
+	switch {
+	case mt == response.Delegation:
+		name := state.QName()
+		for _, rr := range state.Req.Ns {
+			if rr.Header().Rrtype == dns.TypeNS {
+				name = rr.Header().Name
+				break
+			}
+		}
+		nsec3s = append(nsec3s, p.match(name, state.Zone, ttl, []uint16{dns.TypeNS}))
+
+	case mt == response.NameError && ce != "":
+		bitmap := nsec3ZoneBitmap[:]
+		if ce == state.Zone {
+			bitmap = nsec3ApexBitmap[:]
+		}
+		nsec3s = append(nsec3s,
+			p.match(ce, state.Zone, ttl, bitmap),
+			p.cover(nextCloser(state.QName(), ce), state.Zone, ttl),
+			p.cover("*."+ce, state.Zone, ttl),
+		)
+
+	default:
+		bitmap := nsec3ZoneBitmap[:]
+		if state.Name() == state.Zone {
+			bitmap = nsec3ApexBitmap[:]
+		}
+		nsec3s = append(nsec3s, p.match(state.QName(), state.Zone, ttl, filterType(state.QType(), bitmap)))
+	}
+
+	var rrs []dns.RR
+	for _, n := range nsec3s {
+		sigs, err := d.sign([]dns.RR{n}, state.Zone, ttl, incep, expir, server)
+		if err != nil {
+			return nil, err
+		}
+		rrs = append(rrs, sigs...)
+		rrs = append(rrs, n)
+	}
+	return rrs, nil
+}
+
+// closestEncloser returns the closest encloser of the qname in state: its longest ancestor that
+// exists. It asks the next plugin about every name between the zone and the qname, starting at the
+// zone, until it gets an NXDOMAIN. The empty string is returned when that takes more than maxProbes
+// queries.
+func (d Dnssec) closestEncloser(ctx context.Context, w dns.ResponseWriter, state request.Request) string {
+	qname := state.Name()
+	labels := dns.Split(qname)
+	zl := dns.CountLabel(state.Zone)
+	if len(labels)-zl-1 > maxProbes {
+		return ""
+	}
+
+	ce := state.Zone
+	for i := len(labels) - zl - 1; i > 0; i-- {
+		name := qname[labels[i]:]
+
+		m := new(dns.Msg)
+		m.SetQuestion(name, state.QType())
+		nw := nonwriter.New(w)
+		rcode, err := plugin.NextOrFailure(d.Name(), d.Next, ctx, nw, m)
+		if nw.Msg != nil {
+			rcode = nw.Msg.Rcode
+		}
+		// On errors assume the name exists, we'd rather not deny the existence of a name that is there.
+		if err == nil && rcode == dns.RcodeNameError {
+			break
+		}
+		ce = name
+	}
+	return ce
+}
+
+// nextCloser returns the name one label longer than the closest encloser ce on the way to qname.
+func nextCloser(qname, ce string) string {
+	labels := dns.Split(qname)
+	i := len(labels) - dns.CountLabel(ce) - 1
+	if i < 0 {
+		return qname
+	}
+	return qname[labels[i]:]
+}
+
+// match returns a NSEC3 record that matches name and covers nothing else.
+func (p *nsec3Param) match(name, zone string, ttl uint32, bitmap []uint16) *dns.NSEC3 {
+	h := p.hash(name)
+	return p.newNSEC3(h, increment(h), zone, ttl, bitmap)
+}
+
+// cover returns a NSEC3 record that covers name and nothing else. It has an empty bitmap.
+func (p *nsec3Param) cover(name, zone string, ttl uint32) *dns.NSEC3 {
+	h := p.hash(name)
+	return p.newNSEC3(decrement(h), increment(h), zone, ttl, nil)
+}
+
+func (p *nsec3Param) hash(name string) []byte {
+	h, _ := b32.DecodeString(dns.HashName(name, dns.SHA1, p.iterations, p.salt))
+	return h
+}
+
+func (p *nsec3Param) newNSEC3(owner, next []byte, zone string, ttl uint32, bitmap []uint16) *dns.NSEC3 {
+	return &dns.NSEC3{
+		Hdr:        dns.RR_Header{Name: strings.ToLower(b32.EncodeToString(owner)) + "." + zone, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: ttl},
+		Hash:       dns.SHA1,
+		Iterations: p.iterations,
+		SaltLength: uint8(len(p.salt) / 2), // #nosec G115 -- salt length is checked during setup
+		Salt:       p.salt,
+		HashLength: uint8(len(next)), // #nosec G115 -- a SHA1 hash is 20 bytes
+		NextDomain: b32.EncodeToString(next),
+		TypeBitMap: bitmap,
+	}
+}
+
+// getNSEC3PARAM returns the NSEC3PARAM of zone to the client. Signatures are added when do is true.
+func (d Dnssec) getNSEC3PARAM(state request.Request, zone string, do bool, server string) *dns.Msg {
+	p := d.nsec3Param
+	param := &dns.NSEC3PARAM{
+		Hdr:        dns.RR_Header{Name: zone, Rrtype: dns.TypeNSEC3PARAM, Class: dns.ClassINET, Ttl: 0},
+		Hash:       dns.SHA1,
+		Iterations: p.iterations,
+		SaltLength: uint8(len(p.salt) / 2), // #nosec G115 -- salt length is checked during setup
+		Salt:       p.salt,
+	}
+	m := new(dns.Msg)
+	m.SetReply(state.Req)
+	m.Answer = []dns.RR{param}
+	if !do {
+		return m
+	}
+
+	incep, expir := incepExpir(time.Now().UTC())
+	if sigs, err := d.sign(m.Answer, zone, 0, incep, expir, server); err == nil {
+		m.Answer = append(m.Answer, sigs...)
+	}
+	return m
+}
+
+// increment returns a copy of h plus one, wrapping around at the end of the hash space.
+func increment(h []byte) []byte {
+	n := append([]byte(nil), h...)
+	for i := len(n) - 1; i >= 0; i-- {
+		n[i]++
+		if n[i] != 0 {
+			break
+		}
+	}
+	return n
+}
+
+// decrement returns a copy of h minus one, wrapping around at the start of the hash space.
+func decrement(h []byte) []byte {
+	n := append([]byte(nil), h...)
+	for i := len(n) - 1; i >= 0; i-- {
+		n[i]--
+		if n[i] != 0xff {
+			break
+		}
+	}
+	return n
+}
+
+// filterType returns a copy of bitmap without t.
+func filterType(t uint16, bitmap []uint16) []uint16 {
+	b := make([]uint16, 0, len(bitmap))
+	for _, x := range bitmap {
+		if x != t {
+			b = append(b, x)
+		}
+	}
+	return b
+}
+
+// The NSEC3 bit maps we return, these are the NSEC ones, without NSEC and with NSEC3PARAM at the apex.
+var (
+	nsec3ZoneBitmap = [...]uint16{dns.TypeA, dns.TypeHINFO, dns.TypeTXT, dns.TypeAAAA, dns.TypeLOC, dns.TypeSRV, dns.TypeCERT, dns.TypeSSHFP, dns.TypeRRSIG, dns.TypeTLSA, dns.TypeHIP, dns.TypeOPENPGPKEY, dns.TypeSPF}
+	nsec3ApexBitmap = [...]uint16{dns.TypeA, dns.TypeNS, dns.TypeSOA, dns.TypeHINFO, dns.TypeMX, dns.TypeTXT, dns.TypeAAAA, dns.TypeLOC, dns.TypeSRV, dns.TypeCERT, dns.TypeSSHFP, dns.TypeRRSIG, dns.TypeDNSKEY, dns.TypeNSEC3PARAM, dns.TypeTLSA, dns.TypeHIP, dns.TypeOPENPGPKEY, dns.TypeSPF}
+)
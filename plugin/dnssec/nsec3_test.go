@@ -0,0 +1,177 @@
+package dnssec
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+func TestNSEC3BlackLies(t *testing.T) {
+	d, rm1, rm2 := newDnssec(t, []string{"miek.nl."})
+	defer rm1()
+	defer rm2()
+	d.nsec3Param = &nsec3Param{}
+
+	m := testNxdomainMsg()
+	state := request.Request{Req: m, Zone: "miek.nl."}
+	m = d.Sign(state, time.Now().UTC(), server)
+	if m.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected rcode %d, got %d", dns.RcodeSuccess, m.Rcode)
+	}
+	nsec3s := nsec3s(m.Ns)
+	if len(nsec3s) != 1 {
+		t.Fatalf("Expected 1 NSEC3, got %d", len(nsec3s))
+	}
+	n := nsec3s[0]
+	if !n.Match("ww.miek.nl.") {
+		t.Errorf("Expected NSEC3 %s to match %s", n, "ww.miek.nl.")
+	}
+	if slices.Contains(n.TypeBitMap, dns.TypeTXT) {
+		t.Errorf("Expected bitmap without TXT, got %v", n.TypeBitMap)
+	}
+	if !section(m.Ns, 2) {
+		t.Errorf("Authority section should have 2 sigs")
+	}
+}
+
+func TestNSEC3WhiteLies(t *testing.T) {
+	zone, err := file.Parse(strings.NewReader(dbMiekNL), "miek.nl.", "stdin", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm := file.File{Next: test.ErrorHandler(), Zones: file.Zones{Z: map[string]*file.Zone{"miek.nl.": zone}, Names: []string{"miek.nl."}}}
+	dnskey, rm1, rm2 := newKey(t)
+	defer rm1()
+	defer rm2()
+	dh := New([]string{"miek.nl."}, []*DNSKEY{dnskey}, false, fm, cache.New[[]dns.RR](defaultCap))
+	dh.nsec3Param = &nsec3Param{salt: "AABBCCDD", whiteLies: true}
+
+	tests := []struct {
+		qname   string
+		qtype   uint16
+		rcode   int
+		match   []string // names that must be matched by a NSEC3
+		cover   []string // names that must be covered by a NSEC3
+		noTypes []uint16 // types that must not be in the bitmap of the matching NSEC3
+	}{
+		{"x.miek.nl.", dns.TypeA, dns.RcodeNameError, []string{"miek.nl."}, []string{"x.miek.nl.", "*.miek.nl."}, nil},
+		{"y.x.a.miek.nl.", dns.TypeA, dns.RcodeNameError, []string{"a.miek.nl."}, []string{"x.a.miek.nl.", "*.a.miek.nl."}, nil},
+		{"a.miek.nl.", dns.TypeMX, dns.RcodeSuccess, []string{"a.miek.nl."}, nil, []uint16{dns.TypeMX}},
+		{"miek.nl.", dns.TypeHINFO, dns.RcodeSuccess, []string{"miek.nl."}, nil, []uint16{dns.TypeHINFO, dns.TypeNSEC}},
+		{"www.unsigned.miek.nl.", dns.TypeA, dns.RcodeSuccess, []string{"unsigned.miek.nl."}, nil, []uint16{dns.TypeDS, dns.TypeSOA}},
+	}
+
+	for _, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		m.SetEdns0(4096, true)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := dh.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		resp := rec.Msg
+		if resp.Rcode != tc.rcode {
+			t.Errorf("%s/%d: expected rcode %d, got %d", tc.qname, tc.qtype, tc.rcode, resp.Rcode)
+		}
+
+		nsec3s := nsec3s(resp.Ns)
+		if len(nsec3s) != len(tc.match)+len(tc.cover) {
+			t.Errorf("%s/%d: expected %d NSEC3s, got %d", tc.qname, tc.qtype, len(tc.match)+len(tc.cover), len(nsec3s))
+		}
+		for _, name := range tc.match {
+			i := slices.IndexFunc(nsec3s, func(n *dns.NSEC3) bool { return n.Match(name) })
+			if i < 0 {
+				t.Errorf("%s/%d: expected NSEC3 matching %s", tc.qname, tc.qtype, name)
+				continue
+			}
+			for _, typ := range tc.noTypes {
+				if slices.Contains(nsec3s[i].TypeBitMap, typ) {
+					t.Errorf("%s/%d: expected bitmap without %s, got %v", tc.qname, tc.qtype, dns.TypeToString[typ], nsec3s[i].TypeBitMap)
+				}
+			}
+		}
+		for _, name := range tc.cover {
+			if !slices.ContainsFunc(nsec3s, func(n *dns.NSEC3) bool { return n.Cover(name) }) {
+				t.Errorf("%s/%d: expected NSEC3 covering %s", tc.qname, tc.qtype, name)
+			}
+		}
+
+		// Every NSEC3 must be signed and validate.
+		for _, n := range nsec3s {
+			valid := false
+			for _, rr := range resp.Ns {
+				if sig, ok := rr.(*dns.RRSIG); ok && sig.Hdr.Name == n.Hdr.Name {
+					valid = sig.Verify(dnskey.K, []dns.RR{n}) == nil
+				}
+			}
+			if !valid {
+				t.Errorf("%s/%d: expected valid signature for %s", tc.qname, tc.qtype, n)
+			}
+		}
+	}
+}
+
+func TestLookupNSEC3PARAM(t *testing.T) {
+	d, rm1, rm2 := newDnssec(t, []string{"miek.nl."})
+	defer rm1()
+	defer rm2()
+	d.Next = test.ErrorHandler()
+	d.nsec3Param = &nsec3Param{iterations: 1, salt: "AABB"}
+
+	m := new(dns.Msg)
+	m.SetQuestion("miek.nl.", dns.TypeNSEC3PARAM)
+	m.SetEdns0(4096, true)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := d.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(rec.Msg.Answer) != 2 {
+		t.Fatalf("Expected NSEC3PARAM and RRSIG, got %v", rec.Msg.Answer)
+	}
+	param, ok := rec.Msg.Answer[0].(*dns.NSEC3PARAM)
+	if !ok {
+		t.Fatalf("Expected NSEC3PARAM, got %s", rec.Msg.Answer[0])
+	}
+	if param.Iterations != 1 || param.Salt != "AABB" || param.Hash != dns.SHA1 {
+		t.Errorf("Unexpected NSEC3PARAM: %s", param)
+	}
+}
+
+func TestIncrementDecrement(t *testing.T) {
+	tests := []struct {
+		h, inc, dec []byte
+	}{
+		{[]byte{0x00, 0x00}, []byte{0x00, 0x01}, []byte{0xff, 0xff}},
+		{[]byte{0x00, 0xff}, []byte{0x01, 0x00}, []byte{0x00, 0xfe}},
+		{[]byte{0x01, 0x00}, []byte{0x01, 0x01}, []byte{0x00, 0xff}},
+		{[]byte{0xff, 0xff}, []byte{0x00, 0x00}, []byte{0xff, 0xfe}},
+	}
+	for _, tc := range tests {
+		if x := increment(tc.h); !slices.Equal(x, tc.inc) {
+			t.Errorf("Expected %x + 1 to be %x, got %x", tc.h, tc.inc, x)
+		}
+		if x := decrement(tc.h); !slices.Equal(x, tc.dec) {
+			t.Errorf("Expected %x - 1 to be %x, got %x", tc.h, tc.dec, x)
+		}
+	}
+}
+
+func nsec3s(rrs []dns.RR) []*dns.NSEC3 {
+	var n []*dns.NSEC3
+	for _, rr := range rrs {
+		if x, ok := rr.(*dns.NSEC3); ok {
+			n = append(n, x)
+		}
+	}
+	return n
+}
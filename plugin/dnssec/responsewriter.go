@@ -1,6 +1,7 @@
 package dnssec
 
 import (
+	"context"
 	"time"
 
 	"github.com/coredns/coredns/plugin"
@@ -14,6 +15,8 @@ type ResponseWriter struct {
 	dns.ResponseWriter
 	d      Dnssec
 	server string // server label for metrics.
+
+	ctx context.Context // used to find the closest encloser of NXDOMAIN responses.
 }
 
 // WriteMsg implements the dns.ResponseWriter interface.
@@ -28,7 +31,12 @@ func (d *ResponseWriter) WriteMsg(res *dns.Msg) error {
 	}
 	state.Zone = zone
 
-	res = d.d.Sign(state, time.Now().UTC(), d.server)
+	ce := ""
+	if p := d.d.nsec3Param; p != nil && p.whiteLies && res.Rcode == dns.RcodeNameError {
+		ce = d.d.closestEncloser(d.ctx, d.ResponseWriter, state)
+	}
+
+	res = d.d.signMsg(state, time.Now().UTC(), d.server, ce)
 	cacheSize.WithLabelValues(d.server, "signature").Set(float64(d.d.cache.Len()))
 	// No need for EDNS0 trickery, as that is handled by the server.
 
@@ -1,6 +1,7 @@
 package dnssec
 
 import (
+	"encoding/hex"
 	"fmt"
 	"path/filepath"
 	"slices"
@@ -21,7 +22,7 @@ var log = clog.NewWithPlugin("dnssec")
 func init() { plugin.Register("dnssec", setup) }
 
 func setup(c *caddy.Controller) error {
-	zones, keys, capacity, splitkeys, err := dnssecParse(c)
+	zones, keys, capacity, splitkeys, nsec3, err := dnssecParse(c)
 	if err != nil {
 		return plugin.Error("dnssec", err)
 	}
@@ -39,21 +40,24 @@ func setup(c *caddy.Controller) error {
 	})
 
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
-		return New(zones, keys, splitkeys, next, ca)
+		d := New(zones, keys, splitkeys, next, ca)
+		d.nsec3Param = nsec3
+		return d
 	})
 
 	return nil
 }
 
-func dnssecParse(c *caddy.Controller) ([]string, []*DNSKEY, int, bool, error) {
+func dnssecParse(c *caddy.Controller) ([]string, []*DNSKEY, int, bool, *nsec3Param, error) {
 	zones := []string{}
 	keys := []*DNSKEY{}
 	capacity := defaultCap
+	var nsec3 *nsec3Param
 
 	i := 0
 	for c.Next() {
 		if i > 0 {
-			return nil, nil, 0, false, plugin.ErrOnce
+			return nil, nil, 0, false, nil, plugin.ErrOnce
 		}
 		i++
 
@@ -65,21 +69,27 @@ func dnssecParse(c *caddy.Controller) ([]string, []*DNSKEY, int, bool, error) {
 			case "key":
 				k, e := keyParse(c)
 				if e != nil {
-					return nil, nil, 0, false, e
+					return nil, nil, 0, false, nil, e
 				}
 				keys = append(keys, k...)
 			case "cache_capacity":
 				if !c.NextArg() {
-					return nil, nil, 0, false, c.ArgErr()
+					return nil, nil, 0, false, nil, c.ArgErr()
 				}
 				value := c.Val()
 				cacheCap, err := strconv.Atoi(value)
 				if err != nil {
-					return nil, nil, 0, false, err
+					return nil, nil, 0, false, nil, err
 				}
 				capacity = cacheCap
+			case "nsec3":
+				p, err := nsec3Parse(c)
+				if err != nil {
+					return nil, nil, 0, false, nil, err
+				}
+				nsec3 = p
 			default:
-				return nil, nil, 0, false, c.Errf("unknown property '%s'", x)
+				return nil, nil, 0, false, nil, c.Errf("unknown property '%s'", x)
 			}
 		}
 	}
@@ -99,13 +109,53 @@ func dnssecParse(c *caddy.Controller) ([]string, []*DNSKEY, int, bool, error) {
 		kname := plugin.Name(k.K.Header().Name)
 		ok := slices.ContainsFunc(zones, kname.Matches)
 		if !ok {
-			return zones, keys, capacity, splitkeys, fmt.Errorf("key %s (keyid: %d) can not sign any of the zones", string(kname), k.tag)
+			return zones, keys, capacity, splitkeys, nsec3, fmt.Errorf("key %s (keyid: %d) can not sign any of the zones", string(kname), k.tag)
 		}
 	}
 
-	return zones, keys, capacity, splitkeys, nil
+	return zones, keys, capacity, splitkeys, nsec3, nil
+}
+
+// nsec3Parse parses: nsec3 [black_lies|white_lies] [ITERATIONS [SALT]].
+func nsec3Parse(c *caddy.Controller) (*nsec3Param, error) {
+	p := &nsec3Param{}
+	args := c.RemainingArgs()
+	if len(args) > 0 {
+		switch args[0] {
+		case "black_lies":
+			args = args[1:]
+		case "white_lies":
+			p.whiteLies = true
+			args = args[1:]
+		}
+	}
+	if len(args) > 2 {
+		return nil, c.ArgErr()
+	}
+	if len(args) > 0 {
+		iter, err := strconv.ParseUint(args[0], 10, 16)
+		if err != nil {
+			return nil, c.Errf("invalid NSEC3 iterations '%s'", args[0])
+		}
+		if iter > maxIterations {
+			return nil, c.Errf("NSEC3 iterations %d higher than %d", iter, maxIterations)
+		}
+		p.iterations = uint16(iter)
+	}
+	if len(args) > 1 && args[1] != "-" {
+		salt, err := hex.DecodeString(args[1])
+		if err != nil || len(salt) > 255 {
+			return nil, c.Errf("invalid NSEC3 salt '%s'", args[1])
+		}
+		p.salt = strings.ToUpper(args[1])
+	}
+	return p, nil
 }
 
+// maxIterations is the highest number of extra NSEC3 iterations we allow. RFC 9276 recommends 0, as
+// validators may treat responses with higher counts as insecure or bogus.
+const maxIterations = 100
+
 func keyParse(c *caddy.Controller) ([]*DNSKEY, error) {
 	keys := []*DNSKEY{}
 	config := dnsserver.GetConfig(c)
@@ -81,7 +81,7 @@ func TestSetupDnssec(t *testing.T) {
 
 	for i, test := range tests {
 		c := caddy.NewTestController("dns", test.input)
-		zones, keys, capacity, splitkeys, err := dnssecParse(c)
+		zones, keys, capacity, splitkeys, _, err := dnssecParse(c)
 
 		if test.shouldErr && err == nil {
 			t.Errorf("Test %d: Expected error but found %s for input %s", i, err, test.input)
@@ -117,6 +117,59 @@ func TestSetupDnssec(t *testing.T) {
 	}
 }
 
+func TestSetupNSEC3(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  *nsec3Param
+	}{
+		{`dnssec`, false, nil},
+		{`dnssec {
+			nsec3
+		}`, false, &nsec3Param{}},
+		{`dnssec {
+			nsec3 white_lies
+		}`, false, &nsec3Param{whiteLies: true}},
+		{`dnssec {
+			nsec3 black_lies 5 aabb
+		}`, false, &nsec3Param{iterations: 5, salt: "AABB"}},
+		{`dnssec {
+			nsec3 white_lies 0 -
+		}`, false, &nsec3Param{whiteLies: true}},
+		// fails
+		{`dnssec {
+			nsec3 101
+		}`, true, nil},
+		{`dnssec {
+			nsec3 zero
+		}`, true, nil},
+		{`dnssec {
+			nsec3 0 salt
+		}`, true, nil},
+		{`dnssec {
+			nsec3 0 aabb extra
+		}`, true, nil},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		_, _, _, _, nsec3, err := dnssecParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but found none for input %s", i, test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error but found one for input %s. Error was: %v", i, test.input, err)
+			continue
+		}
+		if (nsec3 == nil) != (test.expected == nil) || nsec3 != nil && *nsec3 != *test.expected {
+			t.Errorf("Test %d: Expected NSEC3 parameters %+v, got %+v", i, test.expected, nsec3)
+		}
+	}
+}
+
 const keypub = `; This is a zone-signing key, keyid 45330, for cluster.local.
 ; Created: 20170901060531 (Fri Sep  1 08:05:31 2017)
 ; Publish: 20170901060531 (Fri Sep  1 08:05:31 2017)
@@ -0,0 +1,132 @@
+// Package client writes the records served by the etcd plugin into etcd, in the SkyDNS key layout.
+//
+// A record of a name lives in a key below the path of that name, the last label of the key is the ID
+// of the record. The record www.example.org. IN A 192.0.2.1 with ID "x1" and the default prefix is
+// stored as {"host":"192.0.2.1"} in /skydns/org/example/www/x1. The etcd plugin returns all records
+// below a name, so a name can have many records.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/coredns/coredns/plugin/etcd/msg"
+
+	"github.com/miekg/dns"
+	etcdcv3 "go.etcd.io/etcd/client/v3"
+)
+
+// KV is the part of the etcd client that is used, *etcdcv3.Client implements it.
+type KV interface {
+	Get(ctx context.Context, key string, opts ...etcdcv3.OpOption) (*etcdcv3.GetResponse, error)
+	Put(ctx context.Context, key, val string, opts ...etcdcv3.OpOption) (*etcdcv3.PutResponse, error)
+	Delete(ctx context.Context, key string, opts ...etcdcv3.OpOption) (*etcdcv3.DeleteResponse, error)
+}
+
+// Client reads and writes records below a prefix in etcd.
+type Client struct {
+	kv     KV
+	prefix string
+}
+
+// New returns a Client that uses the keys below prefix, the path of the etcd plugin, for instance
+// "skydns".
+func New(kv KV, prefix string) *Client {
+	return &Client{kv: kv, prefix: strings.Trim(prefix, "/")}
+}
+
+// Key returns the key of record id of name.
+func (c *Client) Key(name, id string) string {
+	return msg.Path(name, c.prefix) + "/" + id
+}
+
+// Put validates s and writes it as record id of name. Options like etcdcv3.WithLease are passed to etcd.
+// It returns the key that was written.
+func (c *Client) Put(ctx context.Context, name, id string, s *msg.Service, opts ...etcdcv3.OpOption) (string, error) {
+	if _, ok := dns.IsDomainName(name); !ok || name == "" {
+		return "", fmt.Errorf("invalid name %q", name)
+	}
+	if id == "" || strings.ContainsAny(id, "/.") {
+		return "", fmt.Errorf("invalid record id %q", id)
+	}
+	if err := s.Validate(); err != nil {
+		return "", err
+	}
+	value, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	key := c.Key(name, id)
+	if _, err := c.kv.Put(ctx, key, string(value), opts...); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// PutRR writes rr as a record of its owner name. If id is empty, ID(rr) is used, so writing the same
+// record again overwrites it. It returns the key that was written.
+func (c *Client) PutRR(ctx context.Context, rr dns.RR, id string, opts ...etcdcv3.OpOption) (string, error) {
+	s, err := msg.FromRR(rr)
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		id = ID(rr)
+	}
+	return c.Put(ctx, rr.Header().Name, id, s, opts...)
+}
+
+// ID returns an ID for rr made from its type and a hash of its rdata, for instance "caa-687df02d".
+func ID(rr dns.RR) string {
+	hdr := rr.Header().String()
+	h := fnv.New32a()
+	h.Write([]byte(strings.TrimPrefix(rr.String(), hdr)))
+	return fmt.Sprintf("%s-%08x", strings.ToLower(dns.TypeToString[rr.Header().Rrtype]), h.Sum32())
+}
+
+// List returns the records of name and the names below it, with their keys.
+func (c *Client) List(ctx context.Context, name string) ([]msg.Service, error) {
+	path := msg.Path(name, c.prefix)
+	r, err := c.kv.Get(ctx, path+"/", etcdcv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	kvs := r.Kvs
+	if r, err = c.kv.Get(ctx, path); err != nil {
+		return nil, err
+	}
+	kvs = append(r.Kvs, kvs...)
+
+	sx := make([]msg.Service, 0, len(kvs))
+	for _, kv := range kvs {
+		s := msg.Service{}
+		if err := json.Unmarshal(kv.Value, &s); err != nil {
+			return nil, fmt.Errorf("%s: %s", kv.Key, err)
+		}
+		s.Key = string(kv.Key)
+		sx = append(sx, s)
+	}
+	return sx, nil
+}
+
+// Delete removes record id of name.
+func (c *Client) Delete(ctx context.Context, name, id string) error {
+	if id == "" || strings.ContainsAny(id, "/.") {
+		return fmt.Errorf("invalid record id %q", id)
+	}
+	r, err := c.kv.Delete(ctx, c.Key(name, id))
+	if err != nil {
+		return err
+	}
+	if r.Deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ErrNotFound is returned by Delete if the record doesn't exist.
+var ErrNotFound = errors.New("record not found")
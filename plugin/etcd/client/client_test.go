@@ -0,0 +1,122 @@
+package client
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	etcdcv3 "go.etcd.io/etcd/client/v3"
+)
+
+// fakeKV is an etcd without revisions and leases.
+type fakeKV map[string]string
+
+func (f fakeKV) Get(_ context.Context, key string, opts ...etcdcv3.OpOption) (*etcdcv3.GetResponse, error) {
+	op := etcdcv3.OpGet(key, opts...)
+	end := string(op.RangeBytes())
+	var keys []string
+	for k := range f {
+		if k == key || (end != "" && k >= key && k < end) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	r := &etcdcv3.GetResponse{Header: &pb.ResponseHeader{}}
+	for _, k := range keys {
+		r.Kvs = append(r.Kvs, &mvccpb.KeyValue{Key: []byte(k), Value: []byte(f[k])})
+	}
+	return r, nil
+}
+
+func (f fakeKV) Put(_ context.Context, key, val string, _ ...etcdcv3.OpOption) (*etcdcv3.PutResponse, error) {
+	f[key] = val
+	return &etcdcv3.PutResponse{}, nil
+}
+
+func (f fakeKV) Delete(_ context.Context, key string, _ ...etcdcv3.OpOption) (*etcdcv3.DeleteResponse, error) {
+	r := &etcdcv3.DeleteResponse{}
+	if _, ok := f[key]; ok {
+		delete(f, key)
+		r.Deleted = 1
+	}
+	return r, nil
+}
+
+func TestPutRR(t *testing.T) {
+	kv := fakeKV{}
+	c := New(kv, "/skydns/")
+
+	rr, _ := dns.NewRR(`www.example.org. 300 IN CAA 0 issue "letsencrypt.org"`)
+	key, err := c.PutRR(context.TODO(), rr, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if !strings.HasPrefix(key, "/skydns/org/example/www/caa-") {
+		t.Errorf("Expected key below /skydns/org/example/www/ with a caa ID, got %s", key)
+	}
+	if v := kv[key]; v != `{"ttl":300,"caa":{"tag":"issue","value":"letsencrypt.org"}}` {
+		t.Errorf("Unexpected value %s", v)
+	}
+
+	// The same record gets the same key.
+	if key1, _ := c.PutRR(context.TODO(), rr, ""); key1 != key {
+		t.Errorf("Expected key %s, got %s", key, key1)
+	}
+
+	rr, _ = dns.NewRR("www.example.org. 300 IN A 192.0.2.1")
+	if key, err = c.PutRR(context.TODO(), rr, "x1"); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if key != "/skydns/org/example/www/x1" {
+		t.Errorf("Expected key /skydns/org/example/www/x1, got %s", key)
+	}
+	if len(kv) != 2 {
+		t.Errorf("Expected 2 keys, got %d", len(kv))
+	}
+
+	rr, _ = dns.NewRR("www.example.org. 300 IN HINFO cpu os")
+	if _, err := c.PutRR(context.TODO(), rr, ""); err == nil {
+		t.Errorf("Expected error for HINFO record")
+	}
+	rr, _ = dns.NewRR("www.example.org. 300 IN A 192.0.2.1")
+	if _, err := c.PutRR(context.TODO(), rr, "x/1"); err == nil {
+		t.Errorf("Expected error for invalid ID")
+	}
+}
+
+func TestListDelete(t *testing.T) {
+	kv := fakeKV{
+		"/skydns/org/example/www":       `{"host":"192.0.2.1"}`,
+		"/skydns/org/example/www/a":     `{"host":"192.0.2.2"}`,
+		"/skydns/org/example/www/b/c":   `{"text":"sub"}`,
+		"/skydns/org/example/www2/a":    `{"host":"192.0.2.3"}`,
+		"/skydns/org/example/ww/broken": `{`,
+	}
+	c := New(kv, "skydns")
+
+	sx, err := c.List(context.TODO(), "www.example.org.")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	var keys []string
+	for _, s := range sx {
+		keys = append(keys, s.Key)
+	}
+	if x := strings.Join(keys, ","); x != "/skydns/org/example/www,/skydns/org/example/www/a,/skydns/org/example/www/b/c" {
+		t.Errorf("Unexpected keys %s", x)
+	}
+	if _, err := c.List(context.TODO(), "ww.example.org."); err == nil {
+		t.Errorf("Expected error for invalid value")
+	}
+
+	if err := c.Delete(context.TODO(), "www.example.org.", "a"); err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	}
+	if err := c.Delete(context.TODO(), "www.example.org.", "a"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
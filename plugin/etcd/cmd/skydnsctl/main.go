@@ -0,0 +1,172 @@
+// Command skydnsctl validates and writes the records served by the etcd plugin.
+//
+// Records are given in zone file format, for instance:
+//
+//	skydnsctl put 'www.example.org. 300 IN CAA 0 issue "letsencrypt.org"'
+//	skydnsctl put _443._tcp.www.example.org. TLSA 3 1 1 0c72ac70b745ac19998811b131d662c9ac69dbdbe7cb23e5b514b56664c5d3d6
+//	skydnsctl validate 'www.example.org. HTTPS 1 . alpn=h2,h3'
+//	skydnsctl get www.example.org.
+//	skydnsctl delete www.example.org. caa-687df02d
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin/etcd/client"
+	"github.com/coredns/coredns/plugin/etcd/msg"
+	mwtls "github.com/coredns/coredns/plugin/pkg/tls"
+
+	"github.com/miekg/dns"
+	etcdcv3 "go.etcd.io/etcd/client/v3"
+)
+
+const usage = `Usage: skydnsctl [flags] COMMAND [ARGS...]
+
+Commands:
+  put RECORD...         write a record, in zone file format
+  validate RECORD...    print the JSON a record is written as, without writing it
+  get NAME              print the records of NAME and the names below it
+  delete NAME ID        delete record ID of NAME
+
+Flags:
+`
+
+func main() {
+	var (
+		endpoints = flag.String("endpoint", "http://localhost:2379", "comma separated etcd `endpoints`")
+		path      = flag.String("path", "skydns", "the `path` of the etcd plugin")
+		id        = flag.String("id", "", "the `ID` of the record to put, the default is made from its type and data")
+		lease     = flag.Duration("lease", 0, "attach the record to a new lease with this `TTL`, 0 for none")
+		tlsArgs   = flag.String("tls", "", "comma separated `CERT,KEY,CACERT` files, as for the tls property of the etcd plugin")
+		username  = flag.String("username", "", "etcd `username`")
+		password  = flag.String("password", "", "etcd `password`")
+		timeout   = flag.Duration("timeout", 5*time.Second, "`timeout` of the etcd requests")
+	)
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cmd, args := args[0], args[1:]
+	if cmd == "validate" {
+		if err := validate(args, *path, *id); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	cfg := etcdcv3.Config{Endpoints: strings.Split(*endpoints, ","), DialTimeout: *timeout, Username: *username, Password: *password}
+	if *tlsArgs != "" {
+		tc, err := mwtls.NewTLSConfigFromArgs(strings.Split(*tlsArgs, ",")...)
+		if err != nil {
+			fatal(err)
+		}
+		cfg.TLS = tc
+	}
+	cli, err := etcdcv3.New(cfg)
+	if err != nil {
+		fatal(err)
+	}
+	defer cli.Close()
+	c := client.New(cli, *path)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	switch cmd {
+	case "put":
+		rr, err := parse(args)
+		if err != nil {
+			fatal(err)
+		}
+		var opts []etcdcv3.OpOption
+		if *lease > 0 {
+			l, err := cli.Grant(ctx, int64(lease.Seconds()))
+			if err != nil {
+				fatal(err)
+			}
+			opts = append(opts, etcdcv3.WithLease(l.ID))
+		}
+		key, err := c.PutRR(ctx, rr, *id, opts...)
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Println(key)
+	case "get":
+		if len(args) != 1 {
+			fatal(errors.New("get needs a name"))
+		}
+		sx, err := c.List(ctx, dns.Fqdn(args[0]))
+		if err != nil {
+			fatal(err)
+		}
+		for _, s := range sx {
+			value, _ := json.Marshal(s)
+			fmt.Printf("%s %s\n", s.Key, value)
+		}
+	case "delete":
+		if len(args) != 2 {
+			fatal(errors.New("delete needs a name and a record ID"))
+		}
+		if err := c.Delete(ctx, dns.Fqdn(args[0]), args[1]); err != nil {
+			fatal(err)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// parse parses the record in args, which are joined with spaces.
+func parse(args []string) (dns.RR, error) {
+	if len(args) == 0 {
+		return nil, errors.New("no record")
+	}
+	rr, err := dns.NewRR(strings.Join(args, " "))
+	if err != nil {
+		return nil, err
+	}
+	if rr == nil {
+		return nil, errors.New("no record")
+	}
+	return rr, nil
+}
+
+// validate prints the key and the value rr in args is written as.
+func validate(args []string, path, id string) error {
+	rr, err := parse(args)
+	if err != nil {
+		return err
+	}
+	s, err := msg.FromRR(rr)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		id = client.ID(rr)
+	}
+	fmt.Printf("%s %s\n", client.New(nil, path).Key(rr.Header().Name, id), value)
+	return nil
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "skydnsctl: %s\n", err)
+	os.Exit(1)
+}
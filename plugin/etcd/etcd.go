@@ -42,6 +42,7 @@ type Etcd struct {
 	MaxLeaseTTL uint32 // maximum TTL for lease-based records
 
 	endpoints []string // Stored here as well, to aid in testing.
+	mirror    *mirror  // Set when the keys are watched and served from memory.
 }
 
 // Services implements the ServiceBackend interface.
@@ -76,12 +77,27 @@ func (e *Etcd) Records(ctx context.Context, state request.Request, exact bool) (
 	name := state.Name()
 
 	path, star := msg.PathWithWildcard(name, e.PathPrefix)
-	r, err := e.get(ctx, path, !exact)
+	kvs, err := e.lookup(ctx, path, !exact)
 	if err != nil {
 		return nil, err
 	}
 	segments := strings.Split(msg.Path(name, e.PathPrefix), "/")
-	return e.loopNodes(r.Kvs, segments, star, state.QType())
+	return e.loopNodes(kvs, segments, star, state.QType())
+}
+
+// lookup returns the keys for path from the mirror, or from etcd if there is no mirror or it hasn't been
+// synced yet.
+func (e *Etcd) lookup(ctx context.Context, path string, recursive bool) ([]*mvccpb.KeyValue, error) {
+	if e.mirror != nil {
+		if kvs, ok, err := e.mirror.get(path, recursive); ok {
+			return kvs, err
+		}
+	}
+	r, err := e.get(ctx, path, recursive)
+	if err != nil {
+		return nil, err
+	}
+	return r.Kvs, nil
 }
 
 func (e *Etcd) get(ctx context.Context, path string, recursive bool) (*etcdcv3.GetResponse, error) {
@@ -165,11 +181,9 @@ Nodes:
 func (e *Etcd) TTL(kv *mvccpb.KeyValue, serv *msg.Service) uint32 {
 	var etcdTTL uint32
 
-	// Get actual lease TTL from etcd if lease exists and client is available
-	if kv.Lease != 0 && e.Client != nil {
-		if resp, err := e.Client.TimeToLive(context.Background(), etcdcv3.LeaseID(kv.Lease)); err == nil && resp.TTL > 0 {
-			leaseTTL := resp.TTL
-
+	// Get actual lease TTL from the mirror or etcd if lease exists and client is available
+	if kv.Lease != 0 && (e.mirror != nil || e.Client != nil) {
+		if leaseTTL := e.leaseTTL(kv.Lease); leaseTTL > 0 {
 			// Get bounds with defaults
 			minTTL := e.MinLeaseTTL
 			if minTTL == 0 {
@@ -209,16 +223,32 @@ func (e *Etcd) TTL(kv *mvccpb.KeyValue, serv *msg.Service) uint32 {
 	return serv.TTL
 }
 
+// leaseTTL returns the remaining TTL of lease id, or with a mirror its granted TTL, so no request to etcd is
+// needed. It returns 0 if the TTL is not known.
+func (e *Etcd) leaseTTL(id int64) int64 {
+	if e.mirror != nil {
+		return e.mirror.leaseTTL(id)
+	}
+	resp, err := e.Client.TimeToLive(context.Background(), etcdcv3.LeaseID(id))
+	if err != nil {
+		return 0
+	}
+	return resp.TTL
+}
+
 // shouldInclude returns true if the service should be included in a list of records, given the qType. For all the
-// currently supported lookup types, the only one to allow for an empty Host field in the service are TXT records
-// which resolve directly.  If a TXT record is being resolved by CNAME, then we expect the Host field to have a
-// value while the TXT field will be empty.
+// currently supported lookup types, the only ones to allow for an empty Host field in the service are TXT records
+// which resolve directly, and the typed records, which are only included for their own type.  If a TXT record is
+// being resolved by CNAME, then we expect the Host field to have a value while the TXT field will be empty.
 func shouldInclude(serv *msg.Service, qType uint16) bool {
-	return (qType == dns.TypeTXT && serv.Text != "") || serv.Host != ""
+	return (qType == dns.TypeTXT && serv.Text != "") || serv.Host != "" || (qType != dns.TypeNone && serv.Type() == qType)
 }
 
 // OnShutdown shuts down etcd client when caddy instance restart
 func (e *Etcd) OnShutdown() error {
+	if e.mirror != nil {
+		e.mirror.close()
+	}
 	if e.Client != nil {
 		e.Client.Close()
 	}
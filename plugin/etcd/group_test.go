@@ -17,7 +17,7 @@ func TestGroupLookup(t *testing.T) {
 
 	for _, serv := range servicesGroup {
 		set(t, etc, serv.Key, 0, serv)
-		defer delete(t, etc, serv.Key)
+		defer remove(t, etc, serv.Key)
 	}
 	for _, tc := range dnsTestCasesGroup {
 		m := tc.Msg()
@@ -40,6 +40,8 @@ func (e *Etcd) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (
 		records, extra, err = plugin.MX(ctx, e, zone, state, opt)
 	case dns.TypeSRV:
 		records, extra, err = plugin.SRV(ctx, e, zone, state, opt)
+	case dns.TypeCAA, dns.TypeHTTPS, dns.TypeNAPTR, dns.TypeSSHFP, dns.TypeSVCB, dns.TypeTLSA:
+		records, err = plugin.Typed(ctx, e, zone, state, opt)
 	case dns.TypeSOA:
 		records, err = plugin.SOA(ctx, e, zone, state, opt)
 	case dns.TypeNS:
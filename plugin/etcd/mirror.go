@@ -0,0 +1,298 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	etcdcv3 "go.etcd.io/etcd/client/v3"
+)
+
+var log = clog.NewWithPlugin("etcd")
+
+const (
+	mirrorPageSize   = 1000             // number of keys read per request when syncing
+	mirrorMinBackoff = time.Second      // first wait before syncing again after a failure
+	mirrorMaxBackoff = 30 * time.Second // longest wait before syncing again after a failure
+)
+
+var errCompacted = errors.New("watch revision compacted")
+
+// mirrorClient is the part of the etcd client used by the mirror.
+type mirrorClient interface {
+	Get(ctx context.Context, key string, opts ...etcdcv3.OpOption) (*etcdcv3.GetResponse, error)
+	Watch(ctx context.Context, key string, opts ...etcdcv3.OpOption) etcdcv3.WatchChan
+	TimeToLive(ctx context.Context, id etcdcv3.LeaseID, opts ...etcdcv3.LeaseOption) (*etcdcv3.LeaseTimeToLiveResponse, error)
+}
+
+// mirror is an in-memory copy of the keys below prefix. It is read once with a range read and then kept up
+// to date with a watch, starting at the revision of the read. When the watch revision is compacted, or the
+// watch fails, the keys are read again. Lookups are served from memory once the first read succeeded.
+type mirror struct {
+	client mirrorClient
+	prefix string
+
+	sync.RWMutex
+	kvs    []*mvccpb.KeyValue // sorted by key
+	leases map[int64]*lease
+	rev    int64
+	synced bool
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// lease is a lease some keys in the mirror are attached to.
+type lease struct {
+	ttl  int64 // granted TTL, 0 if not known
+	refs int   // number of keys attached to it
+}
+
+func newMirror(client mirrorClient, pathPrefix string) *mirror {
+	return &mirror{
+		client: client,
+		prefix: "/" + strings.Trim(pathPrefix, "/") + "/",
+		leases: make(map[int64]*lease),
+		stop:   make(chan struct{}),
+	}
+}
+
+// run keeps the mirror up to date until close is called.
+func (m *mirror) run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-m.stop
+		cancel()
+	}()
+
+	backoff := mirrorMinBackoff
+	for {
+		err := m.sync(ctx)
+		if err == nil {
+			backoff = mirrorMinBackoff
+			err = m.watch(ctx)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errCompacted) {
+			log.Infof("Watch of %s compacted, syncing again", m.prefix)
+			continue
+		}
+		log.Warningf("Failed to mirror %s, serving the last known records: %s", m.prefix, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, mirrorMaxBackoff)
+	}
+}
+
+// close stops the mirror.
+func (m *mirror) close() {
+	m.once.Do(func() { close(m.stop) })
+}
+
+// sync reads all keys below the prefix, in pages at the same revision, and replaces the mirror with them.
+func (m *mirror) sync(ctx context.Context) error {
+	var (
+		kvs []*mvccpb.KeyValue
+		rev int64
+	)
+	key, end := m.prefix, etcdcv3.GetPrefixRangeEnd(m.prefix)
+	for {
+		opts := []etcdcv3.OpOption{etcdcv3.WithRange(end), etcdcv3.WithLimit(mirrorPageSize)}
+		if rev > 0 {
+			opts = append(opts, etcdcv3.WithRev(rev))
+		}
+		gctx, cancel := context.WithTimeout(ctx, etcdTimeout)
+		r, err := m.client.Get(gctx, key, opts...)
+		cancel()
+		if err != nil {
+			return err
+		}
+		if rev == 0 {
+			rev = r.Header.Revision
+		}
+		kvs = append(kvs, r.Kvs...)
+		if !r.More || len(r.Kvs) == 0 {
+			break
+		}
+		key = string(r.Kvs[len(r.Kvs)-1].Key) + "\x00"
+	}
+
+	leases := make(map[int64]*lease)
+	for _, kv := range kvs {
+		m.attach(ctx, leases, kv.Lease)
+	}
+
+	m.Lock()
+	m.kvs, m.leases, m.rev, m.synced = kvs, leases, rev, true
+	m.Unlock()
+	log.Infof("Mirrored %d keys of %s at revision %d", len(kvs), m.prefix, rev)
+	return nil
+}
+
+// watch applies the changes below the prefix after the revision of the mirror to it, until the watch fails.
+func (m *mirror) watch(ctx context.Context) error {
+	m.RLock()
+	rev := m.rev
+	m.RUnlock()
+
+	wctx, cancel := context.WithCancel(etcdcv3.WithRequireLeader(ctx))
+	defer cancel()
+	for resp := range m.client.Watch(wctx, m.prefix, etcdcv3.WithPrefix(), etcdcv3.WithRev(rev+1)) {
+		if resp.CompactRevision != 0 {
+			return errCompacted
+		}
+		if err := resp.Err(); err != nil {
+			return err
+		}
+		m.apply(ctx, resp.Events, resp.Header.Revision)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return errors.New("watch closed")
+}
+
+// apply applies the events of a watch response at revision rev to the mirror.
+func (m *mirror) apply(ctx context.Context, events []*etcdcv3.Event, rev int64) {
+	// The granted TTL of new leases is looked up before taking the lock.
+	m.RLock()
+	var added []int64
+	for _, ev := range events {
+		if ev.Type == etcdcv3.EventTypePut && ev.Kv.Lease != 0 {
+			if _, ok := m.leases[ev.Kv.Lease]; !ok {
+				added = append(added, ev.Kv.Lease)
+			}
+		}
+	}
+	m.RUnlock()
+	ttls := make(map[int64]int64, len(added))
+	for _, id := range added {
+		ttls[id] = m.grantedTTL(ctx, id)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	for _, ev := range events {
+		key := string(ev.Kv.Key)
+		i := sort.Search(len(m.kvs), func(i int) bool { return string(m.kvs[i].Key) >= key })
+		found := i < len(m.kvs) && string(m.kvs[i].Key) == key
+		if found {
+			m.detach(m.kvs[i].Lease)
+		}
+
+		switch ev.Type {
+		case etcdcv3.EventTypePut:
+			if found {
+				m.kvs[i] = ev.Kv
+			} else {
+				m.kvs = append(m.kvs, nil)
+				copy(m.kvs[i+1:], m.kvs[i:])
+				m.kvs[i] = ev.Kv
+			}
+			if id := ev.Kv.Lease; id != 0 {
+				l, ok := m.leases[id]
+				if !ok {
+					l = &lease{ttl: ttls[id]}
+					m.leases[id] = l
+				}
+				l.refs++
+			}
+		case etcdcv3.EventTypeDelete:
+			if found {
+				m.kvs = append(m.kvs[:i], m.kvs[i+1:]...)
+			}
+		}
+	}
+	if rev > m.rev {
+		m.rev = rev
+	}
+}
+
+// attach adds a reference to lease id in leases, looking up its granted TTL if it is new.
+func (m *mirror) attach(ctx context.Context, leases map[int64]*lease, id int64) {
+	if id == 0 {
+		return
+	}
+	l, ok := leases[id]
+	if !ok {
+		l = &lease{ttl: m.grantedTTL(ctx, id)}
+		leases[id] = l
+	}
+	l.refs++
+}
+
+// detach removes a reference to lease id, and forgets the lease if no key is attached to it anymore. The
+// mirror must be locked.
+func (m *mirror) detach(id int64) {
+	l, ok := m.leases[id]
+	if !ok {
+		return
+	}
+	if l.refs--; l.refs <= 0 {
+		delete(m.leases, id)
+	}
+}
+
+// grantedTTL returns the granted TTL of lease id, or 0 if it can't be looked up.
+func (m *mirror) grantedTTL(ctx context.Context, id int64) int64 {
+	ctx, cancel := context.WithTimeout(ctx, etcdTimeout)
+	defer cancel()
+	resp, err := m.client.TimeToLive(ctx, etcdcv3.LeaseID(id))
+	if err != nil {
+		return 0
+	}
+	return resp.GrantedTTL
+}
+
+// leaseTTL returns the granted TTL of lease id, or 0 if it is not known.
+func (m *mirror) leaseTTL(id int64) int64 {
+	m.RLock()
+	defer m.RUnlock()
+	if l, ok := m.leases[id]; ok {
+		return l.ttl
+	}
+	return 0
+}
+
+// get returns the keys for path like Etcd.get does, from memory. It returns false if the mirror hasn't been
+// synced yet.
+func (m *mirror) get(path string, recursive bool) ([]*mvccpb.KeyValue, bool, error) {
+	m.RLock()
+	defer m.RUnlock()
+	if !m.synced {
+		return nil, false, nil
+	}
+
+	if recursive {
+		prefix := path
+		if !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		i := sort.Search(len(m.kvs), func(i int) bool { return string(m.kvs[i].Key) >= prefix })
+		j := i
+		for j < len(m.kvs) && strings.HasPrefix(string(m.kvs[j].Key), prefix) {
+			j++
+		}
+		if j > i {
+			return append([]*mvccpb.KeyValue(nil), m.kvs[i:j]...), true, nil
+		}
+		path = strings.TrimSuffix(path, "/")
+	}
+
+	i := sort.Search(len(m.kvs), func(i int) bool { return string(m.kvs[i].Key) >= path })
+	if i < len(m.kvs) && string(m.kvs[i].Key) == path {
+		return []*mvccpb.KeyValue{m.kvs[i]}, true, nil
+	}
+	return nil, true, errKeyNotFound
+}
@@ -0,0 +1,308 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	etcdcv3 "go.etcd.io/etcd/client/v3"
+)
+
+// fakeClient is an etcd with a single revision of keys and watches that are fed by the test.
+type fakeClient struct {
+	sync.Mutex
+	kvs     map[string]*mvccpb.KeyValue
+	rev     int64
+	ttls    map[int64]int64
+	gets    int
+	watches chan fakeWatch
+}
+
+type fakeWatch struct {
+	rev int64
+	ch  chan etcdcv3.WatchResponse
+}
+
+func newFakeClient(rev int64, kvs ...*mvccpb.KeyValue) *fakeClient {
+	f := &fakeClient{kvs: make(map[string]*mvccpb.KeyValue), rev: rev, ttls: make(map[int64]int64), watches: make(chan fakeWatch, 10)}
+	for _, kv := range kvs {
+		f.kvs[string(kv.Key)] = kv
+	}
+	return f
+}
+
+func (f *fakeClient) Get(_ context.Context, key string, opts ...etcdcv3.OpOption) (*etcdcv3.GetResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.gets++
+	op := etcdcv3.OpGet(key, opts...)
+	end := string(op.RangeBytes())
+
+	var keys []string
+	for k := range f.kvs {
+		if k >= key && k < end {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	r := &etcdcv3.GetResponse{Header: &pb.ResponseHeader{Revision: f.rev}}
+	for _, k := range keys {
+		if op.Limit() > 0 && int64(len(r.Kvs)) == op.Limit() {
+			r.More = true
+			break
+		}
+		r.Kvs = append(r.Kvs, f.kvs[k])
+	}
+	r.Count = int64(len(keys))
+	return r, nil
+}
+
+func (f *fakeClient) Watch(ctx context.Context, key string, opts ...etcdcv3.OpOption) etcdcv3.WatchChan {
+	ch := make(chan etcdcv3.WatchResponse)
+	f.watches <- fakeWatch{rev: etcdcv3.OpGet(key, opts...).Rev(), ch: ch}
+	out := make(chan etcdcv3.WatchResponse)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case resp, ok := <-ch:
+				if !ok {
+					return
+				}
+				out <- resp
+			}
+		}
+	}()
+	return out
+}
+
+func (f *fakeClient) TimeToLive(_ context.Context, id etcdcv3.LeaseID, _ ...etcdcv3.LeaseOption) (*etcdcv3.LeaseTimeToLiveResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+	ttl, ok := f.ttls[int64(id)]
+	if !ok {
+		return nil, fmt.Errorf("lease %d not found", id)
+	}
+	return &etcdcv3.LeaseTimeToLiveResponse{ID: id, TTL: ttl, GrantedTTL: ttl}, nil
+}
+
+func kv(key, value string, lease int64) *mvccpb.KeyValue {
+	return &mvccpb.KeyValue{Key: []byte(key), Value: []byte(value), Lease: lease}
+}
+
+func put(kv *mvccpb.KeyValue) *etcdcv3.Event {
+	return &etcdcv3.Event{Type: etcdcv3.EventTypePut, Kv: kv}
+}
+
+func del(key string) *etcdcv3.Event {
+	return &etcdcv3.Event{Type: etcdcv3.EventTypeDelete, Kv: &mvccpb.KeyValue{Key: []byte(key)}}
+}
+
+func keys(kvs []*mvccpb.KeyValue) string {
+	s := make([]string, len(kvs))
+	for i, kv := range kvs {
+		s[i] = string(kv.Key)
+	}
+	return strings.Join(s, " ")
+}
+
+func TestMirrorSync(t *testing.T) {
+	var kvs []*mvccpb.KeyValue
+	for i := range 2*mirrorPageSize + 1 {
+		kvs = append(kvs, kv(fmt.Sprintf("/skydns/test/%05d", i), `{"host":"10.0.0.1"}`, 0))
+	}
+	kvs = append(kvs, kv("/other/test/a", `{"host":"10.0.0.1"}`, 0))
+	f := newFakeClient(42, kvs...)
+	m := newMirror(f, "skydns")
+
+	if _, ok, _ := m.get("/skydns/test", true); ok {
+		t.Fatal("Expected mirror not to be synced")
+	}
+	if err := m.sync(context.TODO()); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if len(m.kvs) != 2*mirrorPageSize+1 {
+		t.Errorf("Expected %d keys, got %d", 2*mirrorPageSize+1, len(m.kvs))
+	}
+	if f.gets != 3 {
+		t.Errorf("Expected 3 pages to be read, got %d", f.gets)
+	}
+	if m.rev != 42 {
+		t.Errorf("Expected revision 42, got %d", m.rev)
+	}
+}
+
+func TestMirrorGet(t *testing.T) {
+	m := newMirror(newFakeClient(1,
+		kv("/skydns/test/skydns/mx/a", `{}`, 0),
+		kv("/skydns/test/skydns/mx/b", `{}`, 0),
+		kv("/skydns/test/skydns/mx1", `{}`, 0),
+		kv("/skydns/test/skydns/www", `{}`, 0),
+	), "/skydns/")
+	if err := m.sync(context.TODO()); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	tests := []struct {
+		path      string
+		recursive bool
+		expected  string
+		err       error
+	}{
+		{"/skydns/test/skydns/mx", true, "/skydns/test/skydns/mx/a /skydns/test/skydns/mx/b", nil},
+		{"/skydns/test/skydns/mx/", true, "/skydns/test/skydns/mx/a /skydns/test/skydns/mx/b", nil},
+		{"/skydns/test/skydns/mx1", true, "/skydns/test/skydns/mx1", nil},
+		{"/skydns/test/skydns", true, "/skydns/test/skydns/mx/a /skydns/test/skydns/mx/b /skydns/test/skydns/mx1 /skydns/test/skydns/www", nil},
+		{"/skydns/test/skydns/www", false, "/skydns/test/skydns/www", nil},
+		{"/skydns/test/skydns/mx", false, "", errKeyNotFound},
+		{"/skydns/test/skydns/m", true, "", errKeyNotFound},
+	}
+	for _, tc := range tests {
+		kvs, ok, err := m.get(tc.path, tc.recursive)
+		if !ok {
+			t.Fatalf("Expected mirror to be synced")
+		}
+		if err != tc.err {
+			t.Errorf("Get %s (recursive: %t): expected error %v, got %v", tc.path, tc.recursive, tc.err, err)
+		}
+		if x := keys(kvs); x != tc.expected {
+			t.Errorf("Get %s (recursive: %t): expected %q, got %q", tc.path, tc.recursive, tc.expected, x)
+		}
+	}
+}
+
+func TestMirrorApply(t *testing.T) {
+	f := newFakeClient(1, kv("/skydns/test/b", `{}`, 7))
+	f.ttls[7] = 60
+	f.ttls[8] = 120
+	m := newMirror(f, "skydns")
+	if err := m.sync(context.TODO()); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if ttl := m.leaseTTL(7); ttl != 60 {
+		t.Errorf("Expected lease TTL 60, got %d", ttl)
+	}
+
+	m.apply(context.TODO(), []*etcdcv3.Event{
+		put(kv("/skydns/test/c", `{}`, 8)),
+		put(kv("/skydns/test/a", `{}`, 0)),
+		put(kv("/skydns/test/b", `{"host":"10.0.0.2"}`, 8)),
+	}, 5)
+	kvs, _, _ := m.get("/skydns/test", true)
+	if x := keys(kvs); x != "/skydns/test/a /skydns/test/b /skydns/test/c" {
+		t.Errorf("Expected keys a, b and c, got %q", x)
+	}
+	if string(kvs[1].Value) != `{"host":"10.0.0.2"}` {
+		t.Errorf("Expected b to be updated, got %s", kvs[1].Value)
+	}
+	if _, ok := m.leases[7]; ok {
+		t.Errorf("Expected lease 7 to be forgotten")
+	}
+	if l := m.leases[8]; l == nil || l.refs != 2 || l.ttl != 120 {
+		t.Errorf("Expected lease 8 with 2 keys and TTL 120, got %+v", l)
+	}
+	if m.rev != 5 {
+		t.Errorf("Expected revision 5, got %d", m.rev)
+	}
+
+	m.apply(context.TODO(), []*etcdcv3.Event{del("/skydns/test/b"), del("/skydns/test/c"), del("/skydns/test/x")}, 6)
+	kvs, _, _ = m.get("/skydns/test", true)
+	if x := keys(kvs); x != "/skydns/test/a" {
+		t.Errorf("Expected key a, got %q", x)
+	}
+	if len(m.leases) != 0 {
+		t.Errorf("Expected no leases, got %d", len(m.leases))
+	}
+}
+
+func TestMirrorRun(t *testing.T) {
+	f := newFakeClient(10, kv("/skydns/test/a", `{}`, 0))
+	m := newMirror(f, "skydns")
+	go m.run()
+	defer m.close()
+
+	w := <-f.watches
+	if w.rev != 11 {
+		t.Errorf("Expected watch from revision 11, got %d", w.rev)
+	}
+	w.ch <- etcdcv3.WatchResponse{Header: pb.ResponseHeader{Revision: 11}, Events: []*etcdcv3.Event{put(kv("/skydns/test/b", `{}`, 0))}}
+	waitFor(t, func() bool {
+		kvs, _, _ := m.get("/skydns/test", true)
+		return keys(kvs) == "/skydns/test/a /skydns/test/b"
+	})
+
+	// After a compaction the keys are read again, and the watch starts after the new revision.
+	f.Lock()
+	f.kvs = map[string]*mvccpb.KeyValue{"/skydns/test/c": kv("/skydns/test/c", `{}`, 0)}
+	f.rev = 20
+	f.Unlock()
+	w.ch <- etcdcv3.WatchResponse{CompactRevision: 15}
+	w = <-f.watches
+	if w.rev != 21 {
+		t.Errorf("Expected watch from revision 21, got %d", w.rev)
+	}
+	kvs, _, _ := m.get("/skydns/test", true)
+	if x := keys(kvs); x != "/skydns/test/c" {
+		t.Errorf("Expected key c after resync, got %q", x)
+	}
+}
+
+func TestMirrorRecords(t *testing.T) {
+	f := newFakeClient(1,
+		kv("/skydns/test/skydns/www/a", `{"host":"10.0.0.1"}`, 0),
+		kv("/skydns/test/skydns/www/b", `{"host":"10.0.0.2"}`, 9),
+	)
+	f.ttls[9] = 45
+	e := &Etcd{Zones: []string{"skydns.test."}, PathPrefix: "skydns", mirror: newMirror(f, "skydns")}
+	if err := e.mirror.sync(context.TODO()); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion("www.skydns.test.", dns.TypeA)
+	state := request.Request{W: &test.ResponseWriter{}, Req: m}
+	services, err := e.Records(context.TODO(), state, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if len(services) != 2 {
+		t.Fatalf("Expected 2 services, got %d", len(services))
+	}
+	// The lease TTL comes from the mirror, without a client.
+	if services[0].TTL != defaultTTL || services[1].TTL != 45 {
+		t.Errorf("Expected TTLs %d and 45, got %d and %d", defaultTTL, services[0].TTL, services[1].TTL)
+	}
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	m.SetQuestion("nx.skydns.test.", dns.TypeA)
+	if _, err := e.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if rec.Msg.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected NXDOMAIN, got %s", dns.RcodeToString[rec.Msg.Rcode])
+	}
+}
+
+func waitFor(t *testing.T, f func() bool) {
+	t.Helper()
+	for range 200 {
+		if f() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("Timed out")
+}
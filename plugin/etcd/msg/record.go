@@ -0,0 +1,212 @@
+package msg
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// CAA is the rdata of a CAA record.
+type CAA struct {
+	Flag  uint8  `json:"flag,omitempty"`
+	Tag   string `json:"tag,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// SVCB is the rdata of a SVCB or HTTPS record. Params holds the SvcParams in presentation format, for
+// instance "alpn=h2,h3 port=443".
+type SVCB struct {
+	Priority uint16 `json:"priority,omitempty"`
+	Target   string `json:"target,omitempty"`
+	Params   string `json:"params,omitempty"`
+}
+
+// NAPTR is the rdata of a NAPTR record.
+type NAPTR struct {
+	Order       uint16 `json:"order,omitempty"`
+	Preference  uint16 `json:"preference,omitempty"`
+	Flags       string `json:"flags,omitempty"`
+	Service     string `json:"service,omitempty"`
+	Regexp      string `json:"regexp,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// SSHFP is the rdata of a SSHFP record, the fingerprint is hex encoded.
+type SSHFP struct {
+	Algorithm   uint8  `json:"algorithm,omitempty"`
+	Type        uint8  `json:"type,omitempty"`
+	FingerPrint string `json:"fingerprint,omitempty"`
+}
+
+// TLSA is the rdata of a TLSA record, the certificate association data is hex encoded.
+type TLSA struct {
+	Usage        uint8  `json:"usage,omitempty"`
+	Selector     uint8  `json:"selector,omitempty"`
+	MatchingType uint8  `json:"matchingtype,omitempty"`
+	Certificate  string `json:"certificate,omitempty"`
+}
+
+// Type returns the type of the typed record s holds, or dns.TypeNone if it holds none. The typed records
+// are CAA, HTTPS, NAPTR, SSHFP, SVCB and TLSA.
+func (s *Service) Type() uint16 {
+	switch {
+	case s.CAA != CAA{}:
+		return dns.TypeCAA
+	case s.HTTPS != SVCB{}:
+		return dns.TypeHTTPS
+	case s.NAPTR != NAPTR{}:
+		return dns.TypeNAPTR
+	case s.SSHFP != SSHFP{}:
+		return dns.TypeSSHFP
+	case s.SVCB != SVCB{}:
+		return dns.TypeSVCB
+	case s.TLSA != TLSA{}:
+		return dns.TypeTLSA
+	}
+	return dns.TypeNone
+}
+
+// NewRR returns the typed record s holds as a record of type qtype, or nil if it holds no such record or
+// the record is not valid.
+func (s *Service) NewRR(name string, qtype uint16) dns.RR {
+	if qtype == dns.TypeNone || s.Type() != qtype {
+		return nil
+	}
+	hdr := dns.RR_Header{Name: name, Rrtype: qtype, Class: dns.ClassINET, Ttl: s.TTL}
+
+	switch qtype {
+	case dns.TypeCAA:
+		return &dns.CAA{Hdr: hdr, Flag: s.CAA.Flag, Tag: s.CAA.Tag, Value: s.CAA.Value}
+	case dns.TypeSVCB, dns.TypeHTTPS:
+		svcb := s.SVCB
+		if qtype == dns.TypeHTTPS {
+			svcb = s.HTTPS
+		}
+		// The SvcParams are parsed by the zone file parser, which knows all of their formats.
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %d %s %s", dns.Fqdn(name), s.TTL, dns.TypeToString[qtype], svcb.Priority, dns.Fqdn(svcb.Target), svcb.Params))
+		if err != nil || rr == nil {
+			return nil
+		}
+		rr.Header().Name = name
+		return rr
+	case dns.TypeNAPTR:
+		return &dns.NAPTR{Hdr: hdr, Order: s.NAPTR.Order, Preference: s.NAPTR.Preference, Flags: s.NAPTR.Flags,
+			Service: s.NAPTR.Service, Regexp: s.NAPTR.Regexp, Replacement: dns.Fqdn(s.NAPTR.Replacement)}
+	case dns.TypeSSHFP:
+		return &dns.SSHFP{Hdr: hdr, Algorithm: s.SSHFP.Algorithm, Type: s.SSHFP.Type, FingerPrint: strings.ToUpper(s.SSHFP.FingerPrint)}
+	case dns.TypeTLSA:
+		return &dns.TLSA{Hdr: hdr, Usage: s.TLSA.Usage, Selector: s.TLSA.Selector, MatchingType: s.TLSA.MatchingType,
+			Certificate: strings.ToUpper(s.TLSA.Certificate)}
+	}
+	return nil
+}
+
+// Validate returns an error if s can't be served. A service holds at most one typed record, and then no
+// host, text or mail record.
+func (s *Service) Validate() error {
+	n := 0
+	for _, set := range []bool{s.CAA != CAA{}, s.HTTPS != SVCB{}, s.NAPTR != NAPTR{}, s.SSHFP != SSHFP{}, s.SVCB != SVCB{}, s.TLSA != TLSA{}} {
+		if set {
+			n++
+		}
+	}
+	typ := s.Type()
+	switch {
+	case n > 1:
+		return errors.New("more than one typed record")
+	case n == 1 && (s.Host != "" || s.Text != "" || s.Mail):
+		return fmt.Errorf("%s record with a host, text or mail record", dns.TypeToString[typ])
+	case n == 0 && s.Host == "" && s.Text == "":
+		return errors.New("no host, text or typed record")
+	case n == 0:
+		return nil
+	}
+
+	switch typ {
+	case dns.TypeCAA:
+		if s.CAA.Tag == "" {
+			return errors.New("CAA record without a tag")
+		}
+	case dns.TypeSVCB:
+		if s.SVCB.Target == "" {
+			return errors.New("SVCB record without a target")
+		}
+	case dns.TypeHTTPS:
+		if s.HTTPS.Target == "" {
+			return errors.New("HTTPS record without a target")
+		}
+	case dns.TypeNAPTR:
+		if s.NAPTR.Replacement == "" {
+			return errors.New("NAPTR record without a replacement")
+		}
+	}
+
+	rr := s.NewRR("example.org.", typ)
+	if rr == nil {
+		return fmt.Errorf("invalid %s record", dns.TypeToString[typ])
+	}
+	// Packing checks the hex encoded fields and the lengths of the strings.
+	m := new(dns.Msg)
+	m.Answer = []dns.RR{rr}
+	if _, err := m.Pack(); err != nil {
+		return fmt.Errorf("invalid %s record: %s", dns.TypeToString[typ], err)
+	}
+	return nil
+}
+
+// FromRR returns a Service that holds rr. A, AAAA, CNAME, TXT, MX and SRV records become host, text and
+// mail records, CAA, HTTPS, NAPTR, SSHFP, SVCB and TLSA records become typed records.
+func FromRR(rr dns.RR) (*Service, error) {
+	s := &Service{TTL: rr.Header().Ttl}
+	switch rr := rr.(type) {
+	case *dns.A:
+		s.Host = rr.A.String()
+	case *dns.AAAA:
+		s.Host = rr.AAAA.String()
+	case *dns.CNAME:
+		s.Host = rr.Target
+	case *dns.TXT:
+		s.Text = strings.Join(rr.Txt, "")
+	case *dns.MX:
+		s.Host, s.Priority, s.Mail = rr.Mx, int(rr.Preference), true
+	case *dns.SRV:
+		s.Host, s.Port, s.Priority, s.Weight = rr.Target, int(rr.Port), int(rr.Priority), int(rr.Weight)
+	case *dns.CAA:
+		s.CAA = CAA{Flag: rr.Flag, Tag: rr.Tag, Value: rr.Value}
+	case *dns.SVCB:
+		s.SVCB = SVCB{Priority: rr.Priority, Target: rr.Target, Params: svcParams(rr.Value)}
+	case *dns.HTTPS:
+		s.HTTPS = SVCB{Priority: rr.Priority, Target: rr.Target, Params: svcParams(rr.Value)}
+	case *dns.NAPTR:
+		s.NAPTR = NAPTR{Order: rr.Order, Preference: rr.Preference, Flags: rr.Flags, Service: rr.Service, Regexp: rr.Regexp, Replacement: rr.Replacement}
+	case *dns.SSHFP:
+		s.SSHFP = SSHFP{Algorithm: rr.Algorithm, Type: rr.Type, FingerPrint: rr.FingerPrint}
+	case *dns.TLSA:
+		s.TLSA = TLSA{Usage: rr.Usage, Selector: rr.Selector, MatchingType: rr.MatchingType, Certificate: rr.Certificate}
+	default:
+		return nil, fmt.Errorf("unsupported record type %s", dns.TypeToString[rr.Header().Rrtype])
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// svcParams returns the SvcParams in presentation format.
+func svcParams(kvs []dns.SVCBKeyValue) string {
+	params := make([]string, len(kvs))
+	for i, kv := range kvs {
+		v := kv.String()
+		switch {
+		case v == "":
+			params[i] = kv.Key().String()
+		case strings.ContainsAny(v, " \t;"):
+			params[i] = kv.Key().String() + `="` + v + `"`
+		default:
+			params[i] = kv.Key().String() + "=" + v
+		}
+	}
+	return strings.Join(params, " ")
+}
@@ -0,0 +1,135 @@
+package msg
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestFromRR(t *testing.T) {
+	tests := []string{
+		`example.org. 300 IN CAA 0 issue "letsencrypt.org"`,
+		`example.org. 300 IN CAA 128 iodef "mailto:security@example.org"`,
+		`example.org. 300 IN HTTPS 1 . alpn="h2,h3" port="443" no-default-alpn`,
+		`_dns.example.org. 300 IN SVCB 1 dns.example.org. alpn="dot" port="853"`,
+		`example.org. 300 IN HTTPS 0 www.example.org.`,
+		`example.org. 300 IN NAPTR 100 10 "S" "SIP+D2U" "" _sip._udp.example.org.`,
+		`example.org. 300 IN SSHFP 4 2 123456789ABCDEF67890123456789ABCDEF67890123456789ABCDEF123456789`,
+		`_443._tcp.example.org. 300 IN TLSA 3 1 1 0C72AC70B745AC19998811B131D662C9AC69DBDBE7CB23E5B514B56664C5D3D6`,
+	}
+	for _, tc := range tests {
+		rr, err := dns.NewRR(tc)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %s", tc, err)
+		}
+		s, err := FromRR(rr)
+		if err != nil {
+			t.Errorf("Expected no error for %q, got %s", tc, err)
+			continue
+		}
+
+		// Through JSON, as the service is stored in etcd.
+		b, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s1 := &Service{}
+		if err := json.Unmarshal(b, s1); err != nil {
+			t.Fatal(err)
+		}
+		if s1.Type() != rr.Header().Rrtype {
+			t.Errorf("Expected type %s for %s, got %s", dns.TypeToString[rr.Header().Rrtype], b, dns.TypeToString[s1.Type()])
+		}
+		x := s1.NewRR(rr.Header().Name, rr.Header().Rrtype)
+		if x == nil {
+			t.Errorf("Expected a record for %s", b)
+			continue
+		}
+		if x.String() != rr.String() {
+			t.Errorf("Expected %q, got %q", rr.String(), x.String())
+		}
+		if s1.NewRR(rr.Header().Name, dns.TypeA) != nil {
+			t.Errorf("Expected no A record for %s", b)
+		}
+	}
+}
+
+func TestFromRRHost(t *testing.T) {
+	tests := []struct {
+		rr       string
+		expected Service
+	}{
+		{"example.org. 60 IN A 192.0.2.1", Service{Host: "192.0.2.1", TTL: 60}},
+		{"example.org. 60 IN CNAME www.example.org.", Service{Host: "www.example.org.", TTL: 60}},
+		{`example.org. 60 IN TXT "a" "b"`, Service{Text: "ab", TTL: 60}},
+		{"example.org. 60 IN MX 10 mx.example.org.", Service{Host: "mx.example.org.", Priority: 10, Mail: true, TTL: 60}},
+		{"_sip._udp.example.org. 60 IN SRV 10 20 5060 sip.example.org.", Service{Host: "sip.example.org.", Priority: 10, Weight: 20, Port: 5060, TTL: 60}},
+	}
+	for _, tc := range tests {
+		rr, _ := dns.NewRR(tc.rr)
+		s, err := FromRR(rr)
+		if err != nil {
+			t.Errorf("Expected no error for %q, got %s", tc.rr, err)
+			continue
+		}
+		if *s != tc.expected {
+			t.Errorf("Expected %+v for %q, got %+v", tc.expected, tc.rr, *s)
+		}
+	}
+
+	rr, _ := dns.NewRR("example.org. 60 IN HINFO cpu os")
+	if _, err := FromRR(rr); err == nil {
+		t.Errorf("Expected error for HINFO record")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		s         Service
+		shouldErr bool
+	}{
+		{Service{Host: "192.0.2.1"}, false},
+		{Service{Text: "text"}, false},
+		{Service{CAA: CAA{Tag: "issue", Value: "letsencrypt.org"}}, false},
+		{Service{TLSA: TLSA{Usage: 3, Certificate: "abcdef"}}, false},
+		{Service{}, true},
+		{Service{CAA: CAA{Value: "letsencrypt.org"}}, true},
+		{Service{CAA: CAA{Tag: "issue"}, Host: "192.0.2.1"}, true},
+		{Service{CAA: CAA{Tag: "issue"}, TLSA: TLSA{Usage: 3, Certificate: "abcdef"}}, true},
+		{Service{HTTPS: SVCB{Priority: 1}}, true},
+		{Service{HTTPS: SVCB{Priority: 1, Target: ".", Params: "port=http"}}, true},
+		{Service{SVCB: SVCB{Priority: 1, Target: ".", Params: "port=853"}}, false},
+		{Service{NAPTR: NAPTR{Order: 100}}, true},
+		{Service{SSHFP: SSHFP{Algorithm: 1, Type: 1, FingerPrint: "not hex"}}, true},
+		{Service{TLSA: TLSA{Usage: 3, Certificate: "abc"}}, true},
+	}
+	for i, tc := range tests {
+		err := tc.s.Validate()
+		if tc.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error for %+v", i, tc.s)
+		}
+		if !tc.shouldErr && err != nil {
+			t.Errorf("Test %d: expected no error for %+v, got %s", i, tc.s, err)
+		}
+	}
+}
+
+func TestServiceJSONCompatible(t *testing.T) {
+	// Services without typed records are encoded as before.
+	in := `{"host":"192.0.2.1","port":80,"priority":10,"weight":5,"text":"t","ttl":60,"group":"g"}`
+	s := &Service{}
+	if err := json.Unmarshal([]byte(in), s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Type() != dns.TypeNone {
+		t.Errorf("Expected no typed record, got %s", dns.TypeToString[s.Type()])
+	}
+	out, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != in {
+		t.Errorf("Expected %s, got %s", in, out)
+	}
+}
@@ -32,6 +32,15 @@ type Service struct {
 	// answer.
 	Group string `json:"group,omitempty"`
 
+	// Typed records, for the types that can't be expressed with the fields above. A service holds at
+	// most one of these, and then no Host, Text or Mail. See record.go.
+	CAA   CAA   `json:"caa,omitzero"`
+	SVCB  SVCB  `json:"svcb,omitzero"`
+	HTTPS SVCB  `json:"https,omitzero"`
+	NAPTR NAPTR `json:"naptr,omitzero"`
+	SSHFP SSHFP `json:"sshfp,omitzero"`
+	TLSA  TLSA  `json:"tlsa,omitzero"`
+
 	// Etcd key where we found this service and ignored from json un-/marshalling
 	Key string `json:"-"`
 }
@@ -19,7 +19,7 @@ func TestMultiLookup(t *testing.T) {
 
 	for _, serv := range servicesMulti {
 		set(t, etc, serv.Key, 0, serv)
-		defer delete(t, etc, serv.Key)
+		defer remove(t, etc, serv.Key)
 	}
 	for _, tc := range dnsTestCasesMulti {
 		m := tc.Msg()
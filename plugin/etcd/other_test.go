@@ -21,7 +21,7 @@ func TestOtherLookup(t *testing.T) {
 
 	for _, serv := range servicesOther {
 		set(t, etc, serv.Key, 0, serv)
-		defer delete(t, etc, serv.Key)
+		defer remove(t, etc, serv.Key)
 	}
 	for _, tc := range dnsTestCasesOther {
 		m := tc.Msg()
@@ -25,6 +25,12 @@ func setup(c *caddy.Controller) error {
 		return plugin.Error("etcd", err)
 	}
 
+	if e.mirror != nil {
+		c.OnStartup(func() error {
+			go e.mirror.run()
+			return nil
+		})
+	}
 	c.OnShutdown(e.OnShutdown)
 
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
@@ -48,6 +54,7 @@ func etcdParse(c *caddy.Controller) (*Etcd, error) {
 		endpoints = []string{defaultEndpoint}
 		username  string
 		password  string
+		watch     bool
 	)
 
 	etc.Upstream = upstream.New()
@@ -114,6 +121,11 @@ func etcdParse(c *caddy.Controller) (*Etcd, error) {
 					return &Etcd{}, c.Errf("invalid max-lease-ttl value: %v", err)
 				}
 				etc.MaxLeaseTTL = maxLeaseTTL
+			case "watch":
+				if c.NextArg() {
+					return &Etcd{}, c.ArgErr()
+				}
+				watch = true
 			default:
 				if c.Val() != "}" {
 					return &Etcd{}, c.Errf("unknown property '%s'", c.Val())
@@ -126,6 +138,9 @@ func etcdParse(c *caddy.Controller) (*Etcd, error) {
 		}
 		etc.Client = client
 		etc.endpoints = endpoints
+		if watch {
+			etc.mirror = newMirror(client, etc.PathPrefix)
+		}
 
 		return &etc, nil
 	}
@@ -91,6 +91,21 @@ func TestSetupEtcd(t *testing.T) {
 		}
 			`, false, "skydns", []string{"http://localhost:2379"}, "", "", "",
 		},
+		// with watch
+		{
+			`etcd {
+			endpoint http://localhost:2379
+			watch
+		}
+			`, false, "skydns", []string{"http://localhost:2379"}, "", "", "",
+		},
+		// watch takes no arguments
+		{
+			`etcd {
+			watch yes
+		}
+			`, true, "skydns", []string{"http://localhost:2379"}, "Wrong argument count", "", "",
+		},
 	}
 
 	for i, test := range tests {
@@ -139,6 +154,10 @@ func TestSetupEtcd(t *testing.T) {
 				}
 			}
 
+			if strings.Contains(test.input, "watch") != (etcd.mirror != nil) {
+				t.Errorf("Mirror not correctly set for input %s", test.input)
+			}
+
 			// Check TTL configuration for specific test cases
 			if strings.Contains(test.input, "min-lease-ttl 60") {
 				if etcd.MinLeaseTTL != 60 {
@@ -0,0 +1,83 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestTypedRecords(t *testing.T) {
+	f := newFakeClient(1,
+		kv("/skydns/test/skydns/a", `{"caa":{"tag":"issue","value":"letsencrypt.org"}}`, 0),
+		kv("/skydns/test/skydns/b", `{"caa":{"flag":128,"tag":"iodef","value":"mailto:security@skydns.test"}}`, 0),
+		kv("/skydns/test/skydns/www/a", `{"host":"10.0.0.1"}`, 0),
+		kv("/skydns/test/skydns/www/b", `{"https":{"priority":1,"target":".","params":"alpn=h2,h3"}}`, 0),
+		kv("/skydns/test/skydns/www/_tcp/_443/a", `{"tlsa":{"usage":3,"selector":1,"matchingtype":1,"certificate":"0c72ac70"}}`, 0),
+		kv("/skydns/test/skydns/sip/a", `{"naptr":{"order":100,"preference":10,"flags":"S","service":"SIP+D2U","replacement":"_sip._udp.skydns.test."}}`, 0),
+		kv("/skydns/test/skydns/host/a", `{"sshfp":{"algorithm":4,"type":2,"fingerprint":"abcdef"}}`, 0),
+		kv("/skydns/test/skydns/_dns/a", `{"svcb":{"priority":1,"target":"dns.skydns.test.","params":"alpn=dot port=853"}}`, 0),
+	)
+	e := &Etcd{Zones: []string{"skydns.test."}, PathPrefix: "skydns", mirror: newMirror(f, "skydns")}
+	if err := e.mirror.sync(context.TODO()); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	for i, tc := range []test.Case{
+		{
+			Qname: "skydns.test.", Qtype: dns.TypeCAA,
+			Answer: []dns.RR{
+				test.CAA(`skydns.test. 300 IN CAA 0 issue "letsencrypt.org"`),
+				test.CAA(`skydns.test. 300 IN CAA 128 iodef "mailto:security@skydns.test"`),
+			},
+		},
+		{
+			Qname: "www.skydns.test.", Qtype: dns.TypeHTTPS,
+			Answer: []dns.RR{mustRR(`www.skydns.test. 300 IN HTTPS 1 . alpn="h2,h3"`)},
+		},
+		{
+			Qname: "www.skydns.test.", Qtype: dns.TypeA,
+			Answer: []dns.RR{test.A("www.skydns.test. 300 IN A 10.0.0.1")},
+		},
+		{
+			Qname: "_443._tcp.www.skydns.test.", Qtype: dns.TypeTLSA,
+			Answer: []dns.RR{mustRR("_443._tcp.www.skydns.test. 300 IN TLSA 3 1 1 0C72AC70")},
+		},
+		{
+			Qname: "sip.skydns.test.", Qtype: dns.TypeNAPTR,
+			Answer: []dns.RR{mustRR(`sip.skydns.test. 300 IN NAPTR 100 10 "S" "SIP+D2U" "" _sip._udp.skydns.test.`)},
+		},
+		{
+			Qname: "host.skydns.test.", Qtype: dns.TypeSSHFP,
+			Answer: []dns.RR{mustRR("host.skydns.test. 300 IN SSHFP 4 2 ABCDEF")},
+		},
+		{
+			Qname: "_dns.skydns.test.", Qtype: dns.TypeSVCB,
+			Answer: []dns.RR{mustRR(`_dns.skydns.test. 300 IN SVCB 1 dns.skydns.test. alpn="dot" port="853"`)},
+		},
+		// A name with only typed records exists, but has no other records.
+		{
+			Qname: "host.skydns.test.", Qtype: dns.TypeA,
+			Ns: []dns.RR{test.SOA("skydns.test. 30 IN SOA ns.dns.skydns.test. hostmaster.skydns.test. 0 0 0 0 0")},
+		},
+	} {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := e.ServeDNS(context.TODO(), rec, tc.Msg()); err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		if err := test.SortAndCheck(rec.Msg, tc); err != nil {
+			t.Errorf("Test %d: %s", i, err)
+		}
+	}
+}
+
+func mustRR(s string) dns.RR {
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		panic(err)
+	}
+	return rr
+}
@@ -58,6 +58,13 @@ func (f File) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (i
 		return dns.RcodeServerFailure, nil
 	}
 
+	if r.Opcode == dns.OpcodeUpdate {
+		if zone != qname {
+			return dns.RcodeNotAuth, nil
+		}
+		return z.ServeUpdate(ctx, w, r, f.Xfer)
+	}
+
 	// If transfer is not loaded, we'll see these, answer with refused (no transfer allowed).
 	if state.QType() == dns.TypeAXFR || state.QType() == dns.TypeIXFR {
 		return dns.RcodeRefused, nil
@@ -215,5 +222,14 @@ func Parse(f io.Reader, origin, fileName string, serial int64) (*Zone, error) {
 		return nil, fmt.Errorf("file %q has no SOA record for origin %s", fileName, origin)
 	}
 
+	replayed, err := z.replayJournal()
+	if err != nil {
+		return nil, err
+	}
+	// With the journal applied, the zone may well be the one we're already serving.
+	if replayed && serial >= 0 && z.SOA.Serial == uint32(serial) { // #nosec G115 -- serial is validated non-negative, fits in uint32
+		return nil, &serialErr{err: "no change in SOA serial", origin: origin, zone: fileName, serial: serial}
+	}
+
 	return z, nil
 }
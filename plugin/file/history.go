@@ -0,0 +1,174 @@
+package file
+
+import (
+	"errors"
+
+	"github.com/coredns/coredns/plugin/file/tree"
+
+	"github.com/miekg/dns"
+)
+
+// DefaultHistory is the default number of zone differences a zone keeps to answer IXFR requests.
+const DefaultHistory = 10
+
+var (
+	errDeltaSequence = errors.New("differences do not follow on from the zone's SOA serial")
+	errMalformedIXFR = errors.New("malformed incremental transfer")
+)
+
+// diff returns the difference between the zone data in (oap, ot) and (nap, nt) as a delta.
+func diff(oap Apex, ot *tree.Tree, nap Apex, nt *tree.Tree) delta {
+	ozd, nzd := newZoneData(oap, ot), newZoneData(nap, nt)
+	d := delta{from: oap.SOA, to: nap.SOA}
+	for name, types := range ozd.sets {
+		for qtype, rrs := range types {
+			if qtype == dns.TypeSOA {
+				continue
+			}
+			d.del = append(d.del, difference(rrs, nzd.sets[name][qtype])...)
+		}
+	}
+	for name, types := range nzd.sets {
+		for qtype, rrs := range types {
+			if qtype == dns.TypeSOA {
+				continue
+			}
+			d.add = append(d.add, difference(rrs, ozd.sets[name][qtype])...)
+		}
+	}
+	return d
+}
+
+// commit replaces the zone's apex and tree like setData does, and adds deltas, the differences
+// between the current and the new data, to the zone's history. If deltas do not follow on from
+// the current SOA serial the history is reset.
+func (z *Zone) commit(ap Apex, t *tree.Tree, deltas ...delta) {
+	z.Lock()
+	defer z.Unlock()
+
+	if z.historySize <= 0 || z.Apex.SOA == nil {
+		z.history = nil
+	}
+	serial := uint32(0)
+	if z.Apex.SOA != nil {
+		serial = z.Apex.SOA.Serial
+	}
+	for _, d := range deltas {
+		if z.historySize <= 0 || d.from == nil || d.to == nil || d.from.Serial != serial || !serialGreater(d.to.Serial, d.from.Serial) {
+			z.history = nil
+			break
+		}
+		z.history = append(z.history, d)
+		serial = d.to.Serial
+	}
+	if ap.SOA == nil || serial != ap.SOA.Serial {
+		z.history = nil
+	}
+	z.trimHistory()
+
+	z.Apex = ap
+	z.Tree = t
+	z.Expired = false
+}
+
+// SetHistorySize sets the number of zone differences kept to answer IXFR requests.
+func (z *Zone) SetHistorySize(n int) {
+	z.Lock()
+	defer z.Unlock()
+	z.historySize = n
+	z.trimHistory()
+}
+
+// trimHistory removes the oldest differences from the zone's history when it holds more than
+// historySize of them. Must be called with the zone's lock held.
+func (z *Zone) trimHistory() {
+	if len(z.history) > z.historySize {
+		z.history = append([]delta(nil), z.history[len(z.history)-max(z.historySize, 0):]...)
+	}
+}
+
+// ixfr returns the zone's data together with the differences that lead from the zone with SOA
+// serial to the current version. If those are not available, the returned deltas are nil.
+func (z *Zone) ixfr(serial uint32) (Apex, *tree.Tree, []delta) {
+	z.RLock()
+	defer z.RUnlock()
+
+	for i, d := range z.history {
+		if d.from.Serial == serial {
+			return z.Apex, z.Tree, z.history[i:]
+		}
+	}
+	return z.Apex, z.Tree, nil
+}
+
+// applyDeltas applies the differences in deltas to the zone data in (ap, t) and returns the
+// resulting zone. The first delta must start at the serial of ap's SOA.
+func (z *Zone) applyDeltas(ap Apex, t *tree.Tree, deltas []delta) (*Zone, error) {
+	zd := newZoneData(ap, t)
+	for _, d := range deltas {
+		if soa := zd.soa(); soa == nil || d.from.Serial != soa.Serial {
+			return nil, errDeltaSequence
+		}
+		for _, rr := range d.del {
+			zd.remove(rr)
+		}
+		for _, rr := range d.add {
+			zd.add(rr)
+		}
+		zd.set(z.origin, dns.TypeSOA, []dns.RR{d.to})
+	}
+	return zd.zone(z.origin, z.file)
+}
+
+// isIXFR returns true if the transferred records rrs are an incremental transfer. The second
+// record of an incremental transfer is a SOA, in a full transfer it never is.
+func isIXFR(rrs []dns.RR) bool {
+	if len(rrs) < 2 {
+		return false
+	}
+	_, ok := rrs[1].(*dns.SOA)
+	return ok
+}
+
+// parseIXFR splits the records of an incremental zone transfer into its difference sequences.
+func parseIXFR(rrs []dns.RR) ([]delta, error) {
+	// The current SOA, at least one difference sequence with two SOA records and the current SOA again.
+	if len(rrs) < 4 {
+		return nil, errMalformedIXFR
+	}
+	first, ok1 := rrs[0].(*dns.SOA)
+	last, ok2 := rrs[len(rrs)-1].(*dns.SOA)
+	if !ok1 || !ok2 || first.Serial != last.Serial {
+		return nil, errMalformedIXFR
+	}
+
+	var (
+		deltas []delta
+		cur    *delta
+		adding bool
+	)
+	for _, rr := range rrs[1 : len(rrs)-1] {
+		soa, ok := rr.(*dns.SOA)
+		switch {
+		case ok && cur == nil:
+			cur = &delta{from: soa}
+		case ok && !adding:
+			cur.to = soa
+			adding = true
+		case ok && adding:
+			deltas = append(deltas, *cur)
+			cur = &delta{from: soa}
+			adding = false
+		case cur == nil:
+			return nil, errMalformedIXFR
+		case adding:
+			cur.add = append(cur.add, rr)
+		default:
+			cur.del = append(cur.del, rr)
+		}
+	}
+	if cur == nil || !adding || cur.to.Serial != last.Serial {
+		return nil, errMalformedIXFR
+	}
+	return append(deltas, *cur), nil
+}
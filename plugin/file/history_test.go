@@ -0,0 +1,276 @@
+package file
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func transferRecords(t *testing.T, z *Zone, serial uint32) []dns.RR {
+	t.Helper()
+	ch, err := z.Transfer(serial)
+	if err != nil {
+		t.Fatalf("Failed to transfer: %s", err)
+	}
+	var rrs []dns.RR
+	for r := range ch {
+		rrs = append(rrs, r...)
+	}
+	return rrs
+}
+
+func serials(rrs []dns.RR) []uint32 {
+	var s []uint32
+	for _, rr := range rrs {
+		if soa, ok := rr.(*dns.SOA); ok {
+			s = append(s, soa.Serial)
+		}
+	}
+	return s
+}
+
+func equalSerials(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// updatedZone returns a zone with serial 102, that has seen two dynamic updates since serial 100.
+func updatedZone(t *testing.T) *Zone {
+	t.Helper()
+	z := newUpdateZone(t)
+
+	m := newUpdate()
+	m.Insert([]dns.RR{test.A("new.example.org. 300 IN A 192.0.2.20")})
+	serveUpdate(t, z, "update.key.", m)
+	m = newUpdate()
+	m.Remove([]dns.RR{test.A("www.example.org. 3600 IN A 192.0.2.11")})
+	serveUpdate(t, z, "update.key.", m)
+	if z.SOA.Serial != 102 {
+		t.Fatalf("Expected SOA serial 102, got %d", z.SOA.Serial)
+	}
+	return z
+}
+
+func TestTransferIXFR(t *testing.T) {
+	z := updatedZone(t)
+
+	tests := []struct {
+		serial   uint32
+		expected []uint32 // serials of all SOA records in the transfer
+		records  int
+	}{
+		{100, []uint32{102, 100, 101, 101, 102, 102}, 8},
+		{101, []uint32{102, 101, 102, 102}, 5},
+		{102, []uint32{102}, 1},
+		{103, []uint32{102}, 1},
+		{50, []uint32{102, 102}, 7}, // not in history, full transfer
+		{0, []uint32{102, 102}, 7},
+	}
+	for _, tc := range tests {
+		rrs := transferRecords(t, z, tc.serial)
+		if x := serials(rrs); !equalSerials(x, tc.expected) {
+			t.Errorf("Serial %d: expected SOA serials %v, got %v", tc.serial, tc.expected, x)
+		}
+		if len(rrs) != tc.records {
+			t.Errorf("Serial %d: expected %d records, got %d", tc.serial, tc.records, len(rrs))
+		}
+	}
+}
+
+func TestHistorySize(t *testing.T) {
+	z := updatedZone(t)
+
+	z.SetHistorySize(1)
+	if x := serials(transferRecords(t, z, 100)); len(x) != 2 {
+		t.Errorf("Expected full transfer for serial no longer in history, got SOA serials %v", x)
+	}
+	if x := serials(transferRecords(t, z, 101)); len(x) != 4 {
+		t.Errorf("Expected incremental transfer, got SOA serials %v", x)
+	}
+
+	z.SetHistorySize(0)
+	if x := serials(transferRecords(t, z, 101)); len(x) != 2 {
+		t.Errorf("Expected full transfer with history disabled, got SOA serials %v", x)
+	}
+}
+
+func TestReloadHistory(t *testing.T) {
+	z := newUpdateZone(t)
+	newer := strings.Replace(updateZone, " 100 ", " 200 ", 1)
+	newer = strings.Replace(newer, "192.0.2.11", "192.0.2.12", 1)
+	nz, err := Parse(strings.NewReader(newer), "example.org.", z.file, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ap, tr := z.snapshot()
+	d := diff(ap, tr, nz.Apex, nz.Tree)
+	if len(d.del) != 1 || len(d.add) != 1 {
+		t.Fatalf("Expected 1 deletion and 1 addition, got %v and %v", d.del, d.add)
+	}
+	if d.del[0].(*dns.A).A.String() != "192.0.2.11" || d.add[0].(*dns.A).A.String() != "192.0.2.12" {
+		t.Errorf("Unexpected difference: %v", d.records())
+	}
+
+	z.commit(nz.Apex, nz.Tree, d)
+	if x := serials(transferRecords(t, z, 100)); !equalSerials(x, []uint32{200, 100, 200, 200}) {
+		t.Errorf("Expected incremental transfer, got SOA serials %v", x)
+	}
+
+	// A serial that doesn't increase resets the history.
+	z.commit(nz.Apex, nz.Tree, delta{from: nz.SOA, to: nz.SOA})
+	if x := serials(transferRecords(t, z, 100)); len(x) != 2 {
+		t.Errorf("Expected full transfer, got SOA serials %v", x)
+	}
+}
+
+// xfrServer serves the transfers of zone and records the types of the transfers requested.
+type xfrServer struct {
+	t      *testing.T
+	zone   *Zone
+	noIXFR bool
+
+	sync.Mutex
+	qtypes []uint16
+}
+
+func (s *xfrServer) handler(w dns.ResponseWriter, req *dns.Msg) {
+	qtype := req.Question[0].Qtype
+	s.Lock()
+	s.qtypes = append(s.qtypes, qtype)
+	s.Unlock()
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+	var serial uint32
+	switch qtype {
+	case dns.TypeIXFR:
+		if s.noIXFR {
+			m.Rcode = dns.RcodeNotImplemented
+			w.WriteMsg(m)
+			return
+		}
+		serial = req.Ns[0].(*dns.SOA).Serial
+	case dns.TypeAXFR:
+	default:
+		m.Rcode = dns.RcodeRefused
+		w.WriteMsg(m)
+		return
+	}
+	m.Answer = transferRecords(s.t, s.zone, serial)
+	w.WriteMsg(m)
+}
+
+func TestTransferInIXFR(t *testing.T) {
+	primary := updatedZone(t)
+	srv := &xfrServer{t: t, zone: primary}
+	s := dnstest.NewServer(srv.handler)
+	defer s.Close()
+
+	z, err := Parse(strings.NewReader(updateZone), "example.org.", "stdin", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z.TransferFrom = []string{s.Addr}
+
+	if err := z.TransferIn(nil); err != nil {
+		t.Fatalf("Unable to run TransferIn: %v", err)
+	}
+	if z.SOA.Serial != 102 {
+		t.Errorf("Expected SOA serial 102, got %d", z.SOA.Serial)
+	}
+	if x := len(lookupRRs(z, "new.example.org.", dns.TypeA)); x != 1 {
+		t.Errorf("Expected 1 A record for new.example.org., got %d", x)
+	}
+	if x := len(lookupRRs(z, "www.example.org.", dns.TypeA)); x != 1 {
+		t.Errorf("Expected 1 A record for www.example.org., got %d", x)
+	}
+	if len(srv.qtypes) != 1 || srv.qtypes[0] != dns.TypeIXFR {
+		t.Errorf("Expected a single IXFR, got %v", srv.qtypes)
+	}
+
+	// The secondary can serve the differences it received on to others.
+	if x := serials(transferRecords(t, z, 100)); !equalSerials(x, []uint32{102, 100, 101, 101, 102, 102}) {
+		t.Errorf("Expected incremental transfer, got SOA serials %v", x)
+	}
+
+	// Up to date, nothing changes.
+	if err := z.TransferIn(nil); err != nil {
+		t.Fatalf("Unable to run TransferIn: %v", err)
+	}
+	if z.SOA.Serial != 102 {
+		t.Errorf("Expected SOA serial 102, got %d", z.SOA.Serial)
+	}
+}
+
+func TestTransferInIXFRFallback(t *testing.T) {
+	primary := updatedZone(t)
+	srv := &xfrServer{t: t, zone: primary, noIXFR: true}
+	s := dnstest.NewServer(srv.handler)
+	defer s.Close()
+
+	z, err := Parse(strings.NewReader(updateZone), "example.org.", "stdin", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z.TransferFrom = []string{s.Addr}
+
+	if err := z.TransferIn(nil); err != nil {
+		t.Fatalf("Unable to run TransferIn: %v", err)
+	}
+	if z.SOA.Serial != 102 {
+		t.Errorf("Expected SOA serial 102, got %d", z.SOA.Serial)
+	}
+	if len(srv.qtypes) != 2 || srv.qtypes[0] != dns.TypeIXFR || srv.qtypes[1] != dns.TypeAXFR {
+		t.Errorf("Expected an IXFR followed by an AXFR, got %v", srv.qtypes)
+	}
+	// The difference is still known, as it's computed from the full transfer.
+	if x := serials(transferRecords(t, z, 100)); !equalSerials(x, []uint32{102, 100, 102, 102}) {
+		t.Errorf("Expected incremental transfer, got SOA serials %v", x)
+	}
+}
+
+func TestParseIXFR(t *testing.T) {
+	soa := func(serial string) dns.RR {
+		return test.SOA("example.org. 3600 IN SOA ns1.example.org. hostmaster.example.org. " + serial + " 7200 3600 1209600 3600")
+	}
+	a := test.A("www.example.org. 3600 IN A 192.0.2.1")
+
+	tests := []struct {
+		rrs    []dns.RR
+		deltas int
+	}{
+		{[]dns.RR{soa("3"), soa("1"), a, soa("2"), soa("2"), a, soa("3"), soa("3")}, 2},
+		{[]dns.RR{soa("2"), soa("1"), soa("2"), a, soa("2")}, 1},
+		{[]dns.RR{soa("3"), soa("1"), a, soa("2"), soa("3")}, -1}, // ends at the wrong serial
+		{[]dns.RR{soa("2"), soa("1"), a, soa("2")}, -1},           // no to SOA
+		{[]dns.RR{soa("2"), soa("1"), soa("2")}, -1},
+	}
+	for i, tc := range tests {
+		deltas, err := parseIXFR(tc.rrs)
+		if tc.deltas < 0 {
+			if err == nil {
+				t.Errorf("Test %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+		}
+		if len(deltas) != tc.deltas {
+			t.Errorf("Test %d: expected %d deltas, got %d", i, tc.deltas, len(deltas))
+		}
+	}
+}
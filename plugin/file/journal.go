@@ -0,0 +1,249 @@
+package file
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// JournalSuffix is appended to the name of a zone file to get the name of the journal that holds
+// the dynamic updates applied to that zone.
+const JournalSuffix = ".jnl"
+
+// maxJournal is the number of deltas a journal may hold before it is compacted.
+const maxJournal = 100
+
+// delta holds the difference between two versions of a zone, in the same way as IXFR (RFC 1995)
+// does: the records in del are removed from the zone with SOA from, after which the records in add
+// are added, resulting in the zone with SOA to.
+type delta struct {
+	from, to *dns.SOA
+	del, add []dns.RR
+}
+
+// records returns the delta as an IXFR difference sequence.
+func (d delta) records() []dns.RR {
+	rrs := make([]dns.RR, 0, 2+len(d.del)+len(d.add))
+	rrs = append(rrs, d.from)
+	rrs = append(rrs, d.del...)
+	rrs = append(rrs, d.to)
+	rrs = append(rrs, d.add...)
+	return rrs
+}
+
+// writeDelta writes d to b in the format of the journal.
+func writeDelta(b *strings.Builder, d delta) {
+	fmt.Fprintf(b, "; serial %d -> %d\n", d.from.Serial, d.to.Serial)
+	for _, rr := range d.records() {
+		b.WriteString(rr.String())
+		b.WriteByte('\n')
+	}
+}
+
+// appendJournal appends d to the journal of the zone file fileName and syncs it to disk.
+func appendJournal(fileName string, d delta) error {
+	f, err := os.OpenFile(filepath.Clean(fileName+JournalSuffix), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	writeDelta(&b, d)
+	if _, err := f.WriteString(b.String()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// compactJournal replaces the journal of the zone file fileName with a single delta, that has the same
+// effect as the deltas that lead to the zone with SOA serial. Older deltas, which no longer apply to the
+// zone file, are dropped. The new journal is written next to the old one and then renamed over it.
+func compactJournal(fileName, origin string, serial uint32) error {
+	deltas, err := readJournal(fileName, origin)
+	if err != nil {
+		return err
+	}
+	end := len(deltas)
+	if end == 0 || deltas[end-1].to.Serial != serial {
+		return fmt.Errorf("journal does not end at serial %d", serial)
+	}
+	start := end - 1
+	for start > 0 && deltas[start-1].to.Serial == deltas[start].from.Serial {
+		start--
+	}
+
+	var b strings.Builder
+	writeDelta(&b, compact(deltas[start:end]))
+
+	name := filepath.Clean(fileName + JournalSuffix)
+	f, err := os.OpenFile(name+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(b.String()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
+
+// compact returns a single delta with the same effect as the chained deltas: a record that is added
+// and deleted again is in neither list.
+func compact(deltas []delta) delta {
+	type change struct {
+		rr dns.RR
+		n  int // 1 if the record is added, -1 if it is deleted
+	}
+	changes := make(map[string]*change)
+	var order []string
+	record := func(rr dns.RR, n int) {
+		c := dns.Copy(rr)
+		c.Header().Name = ownerKey(c.Header().Name)
+		k := c.String()
+		if _, ok := changes[k]; !ok {
+			changes[k] = &change{rr: rr}
+			order = append(order, k)
+		}
+		changes[k].n += n
+	}
+	for _, d := range deltas {
+		for _, rr := range d.del {
+			record(rr, -1)
+		}
+		for _, rr := range d.add {
+			record(rr, 1)
+		}
+	}
+
+	c := delta{from: deltas[0].from, to: deltas[len(deltas)-1].to}
+	for _, k := range order {
+		switch ch := changes[k]; {
+		case ch.n < 0:
+			c.del = append(c.del, ch.rr)
+		case ch.n > 0:
+			c.add = append(c.add, ch.rr)
+		}
+	}
+	return c
+}
+
+// removeJournal removes the journal of the zone file fileName. A missing journal is not an error.
+func removeJournal(fileName string) error {
+	err := os.Remove(filepath.Clean(fileName + JournalSuffix))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// readJournal reads all deltas from the journal of the zone file fileName. A missing journal is
+// not an error. A partially written last delta, e.g. after a crash, is ignored.
+func readJournal(fileName, origin string) ([]delta, error) {
+	name := filepath.Clean(fileName + JournalSuffix)
+	f, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		deltas []delta
+		cur    *delta
+		adding bool
+	)
+	zp := dns.NewZoneParser(f, dns.Fqdn(origin), name)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		if soa, ok := rr.(*dns.SOA); ok {
+			switch {
+			case cur == nil:
+				cur = &delta{from: soa}
+			case adding:
+				deltas = append(deltas, *cur)
+				cur = &delta{from: soa}
+				adding = false
+			default:
+				cur.to = soa
+				adding = true
+			}
+			continue
+		}
+		if cur == nil {
+			return nil, fmt.Errorf("journal %q does not start with a SOA record", name)
+		}
+		if adding {
+			cur.add = append(cur.add, rr)
+		} else {
+			cur.del = append(cur.del, rr)
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return deltas, fmt.Errorf("failed to parse journal %q: %v", name, err)
+	}
+	if cur != nil && adding {
+		deltas = append(deltas, *cur)
+	}
+	return deltas, nil
+}
+
+// replayJournal applies the deltas from the zone's journal that follow on from the zone's
+// current SOA serial, these are also added to the zone's history. It returns true if the zone
+// was changed. A journal that does not apply to the zone is removed.
+func (z *Zone) replayJournal() (bool, error) {
+	deltas, err := readJournal(z.file, z.origin)
+	if len(deltas) == 0 || z.SOA == nil {
+		return false, err
+	}
+	z.journalLen = len(deltas)
+
+	// Older deltas are already part of the zone file. If the file got a new serial that is
+	// not in the journal, none of it applies.
+	serial := z.SOA.Serial
+	start := -1
+	for i, d := range deltas {
+		if d.from.Serial == serial {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		if err == nil {
+			z.journalLen = 0
+			err = removeJournal(z.file)
+		}
+		return false, err
+	}
+	deltas = deltas[start:]
+	for i := 1; i < len(deltas); i++ {
+		if deltas[i].from.Serial != deltas[i-1].to.Serial {
+			deltas = deltas[:i]
+			break
+		}
+	}
+
+	nz, nerr := z.applyDeltas(z.Apex, z.Tree, deltas)
+	if nerr != nil {
+		return false, nerr
+	}
+	z.Apex, z.Tree = nz.Apex, nz.Tree
+	z.history = deltas
+	z.trimHistory()
+	return true, err
+}
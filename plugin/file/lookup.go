@@ -158,6 +158,12 @@ func (z *Zone) Lookup(ctx context.Context, state request.Request, qname string)
 
 		// If we see NS records, it means the name has been delegated.
 		if nsrrs, glue, ok := delegationFromElem(tr, elem, qname, qtype, do); ok {
+			// With NSEC3 an unsigned delegation is proven by the NSEC3 matching the delegation point.
+			if do && elem.Type(dns.TypeDS) == nil {
+				if p := z.nsec3Param(tr); p != nil {
+					nsrrs = append(nsrrs, z.nsec3Match(tr, p, elem.Name())...)
+				}
+			}
 			return nil, nsrrs, glue, Delegation
 		}
 
@@ -177,8 +183,12 @@ func (z *Zone) Lookup(ctx context.Context, state request.Request, qname string)
 		if len(rrs) == 0 {
 			ret := ap.soa(do)
 			if do {
-				nsec := typeFromElem(elem, dns.TypeNSEC, do)
-				ret = append(ret, nsec...)
+				if p := z.nsec3Param(tr); p != nil {
+					ret = append(ret, z.nsec3Match(tr, p, qname)...)
+				} else {
+					nsec := typeFromElem(elem, dns.TypeNSEC, do)
+					ret = append(ret, nsec...)
+				}
 			}
 			return nil, ret, nil, NoData
 		}
@@ -220,8 +230,14 @@ func (z *Zone) Lookup(ctx context.Context, state request.Request, qname string)
 		if len(rrs) == 0 {
 			ret := ap.soa(do)
 			if do {
-				nsec := typeFromElem(wildElem, dns.TypeNSEC, do)
-				ret = append(ret, nsec...)
+				if p := z.nsec3Param(tr); p != nil {
+					// Closest encloser proof, and the NSEC3 matching the wildcard, RFC 5155, section 7.2.5.
+					proof, _ := z.nsec3ClosestEncloser(tr, p, qname)
+					ret = append(ret, appendNSEC3(proof, z.nsec3Match(tr, p, wildElem.Name()))...)
+				} else {
+					nsec := typeFromElem(wildElem, dns.TypeNSEC, do)
+					ret = append(ret, nsec...)
+				}
 			}
 			return nil, ret, nil, NoData
 		}
@@ -234,7 +250,10 @@ func (z *Zone) Lookup(ctx context.Context, state request.Request, qname string)
 		auth := ap.ns(do)
 		if do {
 			// An NSEC is needed to say no longer name exists under this wildcard.
-			if deny, found := tr.Prev(qname); found {
+			if p := z.nsec3Param(tr); p != nil {
+				// For NSEC3 this is the one covering the next closer name, RFC 5155, section 7.2.6.
+				auth = append(auth, z.nsec3Cover(tr, p, nextCloser(qname, wildElem.Name()[2:]))...)
+			} else if deny, found := tr.Prev(qname); found {
 				nsec := typeFromElem(deny, dns.TypeNSEC, do)
 				auth = append(auth, nsec...)
 			}
@@ -256,6 +275,17 @@ func (z *Zone) Lookup(ctx context.Context, state request.Request, qname string)
 
 	ret := ap.soa(do)
 	if do {
+		if p := z.nsec3Param(tr); p != nil {
+			if rcode != NameError {
+				ret = append(ret, z.nsec3Match(tr, p, qname)...)
+				goto Out
+			}
+			// Closest encloser proof, and the NSEC3 covering the wildcard, RFC 5155, section 7.2.2.
+			proof, ce := z.nsec3ClosestEncloser(tr, p, qname)
+			ret = append(ret, appendNSEC3(proof, z.nsec3Cover(tr, p, "*."+ce))...)
+			goto Out
+		}
+
 		deny, found := tr.Prev(qname)
 		if !found {
 			goto Out
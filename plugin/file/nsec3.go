@@ -0,0 +1,106 @@
+package file
+
+import (
+	"strings"
+
+	"github.com/coredns/coredns/plugin/file/tree"
+
+	"github.com/miekg/dns"
+)
+
+// nsec3Param returns the NSEC3PARAM record of the zone in tr, or nil if the zone isn't signed
+// with NSEC3.
+func (z *Zone) nsec3Param(tr *tree.Tree) *dns.NSEC3PARAM {
+	apex, found := tr.Search(z.origin)
+	if !found {
+		return nil
+	}
+	params := apex.Type(dns.TypeNSEC3PARAM)
+	if len(params) == 0 {
+		return nil
+	}
+	return params[0].(*dns.NSEC3PARAM)
+}
+
+// nsec3Match returns the NSEC3 record, and its signatures, that matches name.
+func (z *Zone) nsec3Match(tr *tree.Tree, p *dns.NSEC3PARAM, name string) []dns.RR {
+	elem, found := tr.Search(z.nsec3Owner(p, name))
+	if !found {
+		return nil
+	}
+	return typeFromElem(elem, dns.TypeNSEC3, true)
+}
+
+// nsec3Cover returns the NSEC3 record, and its signatures, that covers name. This is the NSEC3
+// with the highest hash lower than the hash of name, or the one with the highest hash if there
+// is none.
+func (z *Zone) nsec3Cover(tr *tree.Tree, p *dns.NSEC3PARAM, name string) []dns.RR {
+	// The hashed owner names are all directly below the apex, but other names are sorted in
+	// between. Skip those.
+	elem, found := tr.Prev(z.nsec3Owner(p, name))
+	for found && elem.Type(dns.TypeNSEC3) == nil {
+		elem, found = tr.Before(elem.Name())
+	}
+	if !found {
+		elem = tr.Max()
+		found = elem != nil
+		for found && elem.Type(dns.TypeNSEC3) == nil {
+			elem, found = tr.Before(elem.Name())
+		}
+	}
+	if !found {
+		return nil
+	}
+	return typeFromElem(elem, dns.TypeNSEC3, true)
+}
+
+// nsec3ClosestEncloser returns the NSEC3 records that prove that the closest encloser of qname
+// exists and that the next closer name doesn't, see RFC 5155, section 7.2.1. It also returns the
+// closest encloser.
+func (z *Zone) nsec3ClosestEncloser(tr *tree.Tree, p *dns.NSEC3PARAM, qname string) ([]dns.RR, string) {
+	ce, nc := z.origin, qname
+	name := qname
+	offset, end := dns.NextLabel(name, 0)
+	for !end && name != z.origin {
+		parent := name[offset:]
+		if _, found := tr.Search(parent); found || parent == z.origin || hasDescendant(tr, parent) {
+			ce, nc = parent, name
+			break
+		}
+		name = parent
+		offset, end = dns.NextLabel(name, 0)
+	}
+
+	rrs := z.nsec3Match(tr, p, ce)
+	return appendNSEC3(rrs, z.nsec3Cover(tr, p, nc)), ce
+}
+
+// nextCloser returns the name one label longer than the closest encloser ce on the way to qname.
+func nextCloser(qname, ce string) string {
+	labels := dns.Split(qname)
+	i := len(labels) - dns.CountLabel(ce) - 1
+	if i < 0 {
+		return qname
+	}
+	return qname[labels[i]:]
+}
+
+func (z *Zone) nsec3Owner(p *dns.NSEC3PARAM, name string) string {
+	return strings.ToLower(dns.HashName(name, p.Hash, p.Iterations, p.Salt)) + "." + z.origin
+}
+
+// appendNSEC3 appends the records in add to rrs, unless rrs already has the NSEC3 in add. A single
+// NSEC3 can take part in more than one proof.
+func appendNSEC3(rrs, add []dns.RR) []dns.RR {
+	for _, rr := range add {
+		if _, ok := rr.(*dns.NSEC3); !ok {
+			continue
+		}
+		for _, x := range rrs {
+			if _, ok := x.(*dns.NSEC3); ok && x.Header().Name == rr.Header().Name {
+				return rrs
+			}
+		}
+	}
+	return append(rrs, add...)
+}
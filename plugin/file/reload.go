@@ -40,16 +40,26 @@ func (z *Zone) Reload(t *transfer.Transfer) error {
 					continue
 				}
 
+				// Don't let a dynamic update slip in between parsing the zone and using it.
+				z.updateMu.Lock()
 				zone, err := Parse(reader, z.origin, zFile, serial)
 				reader.Close()
 				if err != nil {
+					z.updateMu.Unlock()
 					if _, ok := err.(*serialErr); !ok {
 						log.Errorf("Parsing zone %q: %v", z.origin, err)
 					}
 					continue
 				}
 
-				z.setData(zone.Apex, zone.Tree)
+				z.journalLen = zone.journalLen
+				ap, tr := z.snapshot()
+				if ap.SOA != nil && z.historySize > 0 {
+					z.commit(zone.Apex, zone.Tree, diff(ap, tr, zone.Apex, zone.Tree))
+				} else {
+					z.setData(zone.Apex, zone.Tree)
+				}
+				z.updateMu.Unlock()
 
 				log.Infof("Successfully reloaded zone %q in %q with %d SOA serial", z.origin, zFile, zone.SOA.Serial)
 				if t != nil {
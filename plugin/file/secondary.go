@@ -4,6 +4,7 @@ import (
 	"math/rand"
 	"time"
 
+	"github.com/coredns/coredns/plugin/file/tree"
 	"github.com/coredns/coredns/plugin/transfer"
 
 	"github.com/miekg/dns"
@@ -19,49 +20,69 @@ func (z *Zone) TransferIn(t *transfer.Transfer) error {
 
 // TransferInWithRecords retrieves the zone from the masters, calls validate
 // with the transferred records, and sets the zone live if validation succeeds.
+// When the zone is already loaded an incremental transfer (IXFR) is requested,
+// if that fails a full transfer is done. For an incremental transfer validate
+// is called with all the records of the resulting zone.
 func (z *Zone) TransferInWithRecords(t *transfer.Transfer, validate func([]dns.RR) error) error {
 	if len(z.TransferFrom) == 0 {
 		return nil
 	}
-	m := new(dns.Msg)
-	m.SetAxfr(z.origin)
+
+	ap, tr0 := z.snapshot()
+	axfr := new(dns.Msg)
+	axfr.SetAxfr(z.origin)
+	var ixfr *dns.Msg
+	if ap.SOA != nil {
+		ixfr = new(dns.Msg)
+		ixfr.SetIxfr(z.origin, ap.SOA.Serial, ap.SOA.Ns, ap.SOA.Mbox)
+	}
 
 	var (
-		Err error
-		tr  string
-		z1  *Zone
+		Err    error
+		tr     string
+		z1     *Zone
+		deltas []delta
 	)
 	var transferred []dns.RR
 
 Transfer:
 	for _, tr = range z.TransferFrom {
-		t := new(dns.Transfer)
-		c, err := t.In(m, tr)
+		if ixfr != nil {
+			records, err := xfrIn(ixfr, tr)
+			if err == nil {
+				z1, deltas, err = z.incremental(ap, tr0, records)
+			}
+			if err == nil {
+				if z1 == nil {
+					log.Infof("Incremental transfer of `%s' from %q: zone is up to date", z.origin, tr)
+					return nil
+				}
+				if validate != nil && deltas != nil {
+					records = z1.all()
+				}
+				transferred = records
+				Err = nil
+				break Transfer
+			}
+			log.Warningf("Failed incremental transfer `%s' from %q, trying full transfer: %v", z.origin, tr, err)
+		}
+
+		records, err := xfrIn(axfr, tr)
 		if err != nil {
-			log.Errorf("Failed to setup transfer `%s' with `%q': %v", z.origin, tr, err)
+			log.Errorf("Failed to transfer `%s' from %q: %v", z.origin, tr, err)
 			Err = err
 			continue Transfer
 		}
 		candidate := z.CopyWithoutApex()
-		var records []dns.RR
-		for env := range c {
-			if env.Error != nil {
-				log.Errorf("Failed to transfer `%s' from %q: %v", z.origin, tr, env.Error)
-				Err = env.Error
+		for _, rr := range records {
+			if err := candidate.Insert(rr); err != nil {
+				log.Errorf("Failed to parse transfer `%s' from: %q: %v", z.origin, tr, err)
+				Err = err
 				continue Transfer
 			}
-			for _, rr := range env.RR {
-				if err := candidate.Insert(rr); err != nil {
-					log.Errorf("Failed to parse transfer `%s' from: %q: %v", z.origin, tr, err)
-					Err = err
-					continue Transfer
-				}
-				if validate != nil {
-					records = append(records, rr)
-				}
-			}
 		}
 		z1 = candidate
+		deltas = nil
 		transferred = records
 		Err = nil
 		break
@@ -75,7 +96,14 @@ Transfer:
 		}
 	}
 
-	z.setData(z1.Apex, z1.Tree)
+	switch {
+	case deltas != nil:
+		z.commit(z1.Apex, z1.Tree, deltas...)
+	case ap.SOA != nil && z.historySize > 0:
+		z.commit(z1.Apex, z1.Tree, diff(ap, tr0, z1.Apex, z1.Tree))
+	default:
+		z.setData(z1.Apex, z1.Tree)
+	}
 	log.Infof("Transferred: %s from %s", z.origin, tr)
 
 	// Send notify messages to secondary servers
@@ -87,6 +115,66 @@ Transfer:
 	return nil
 }
 
+// xfrIn performs the zone transfer in m with master and returns all transferred records.
+func xfrIn(m *dns.Msg, master string) ([]dns.RR, error) {
+	t := new(dns.Transfer)
+	c, err := t.In(m, master)
+	if err != nil {
+		return nil, err
+	}
+	var records []dns.RR
+	for env := range c {
+		if env.Error != nil {
+			for range c {
+			}
+			return nil, env.Error
+		}
+		records = append(records, env.RR...)
+	}
+	return records, nil
+}
+
+// incremental interprets the records of a reply to an IXFR request for the zone in (ap, t). A
+// master may reply with differences, with a full zone transfer, or, if the zone is up to date,
+// with a single SOA record. For the latter nil is returned. The deltas are nil for a full transfer.
+func (z *Zone) incremental(ap Apex, t *tree.Tree, records []dns.RR) (*Zone, []delta, error) {
+	if len(records) == 1 {
+		if soa, ok := records[0].(*dns.SOA); ok && !less(ap.SOA.Serial, soa.Serial) {
+			return nil, nil, nil
+		}
+		return nil, nil, errMalformedIXFR
+	}
+	if !isIXFR(records) {
+		z1 := z.CopyWithoutApex()
+		for _, rr := range records {
+			if err := z1.Insert(rr); err != nil {
+				return nil, nil, err
+			}
+		}
+		return z1, nil, nil
+	}
+	deltas, err := parseIXFR(records)
+	if err != nil {
+		return nil, nil, err
+	}
+	z1, err := z.applyDeltas(ap, t, deltas)
+	if err != nil {
+		return nil, nil, err
+	}
+	return z1, deltas, nil
+}
+
+// all returns all records in z, apex records first.
+func (z *Zone) all() []dns.RR {
+	ap, t := z.snapshot()
+	rrs, _ := ap.records()
+	t.Walk(func(e *tree.Elem, _ map[uint16][]dns.RR) error {
+		rrs = append(rrs, e.All()...)
+		return nil
+	})
+	return rrs
+}
+
 // shouldTransfer checks the primaries of zone, retrieves the SOA record, checks the current serial
 // and the remote serial and will return true if the remote one is higher than the locally configured one.
 func (z *Zone) shouldTransfer() (bool, error) {
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/coredns/caddy"
@@ -96,6 +97,9 @@ func fileParse(c *caddy.Controller) (Zones, fall.F, error) {
 			openErr = err
 		}
 
+		var policy *UpdatePolicy
+		history := DefaultHistory
+
 		err = func() error {
 			defer reader.Close()
 
@@ -137,6 +141,21 @@ func fileParse(c *caddy.Controller) (Zones, fall.F, error) {
 			case "upstream":
 				// remove soon
 				c.RemainingArgs()
+			case "ixfr_history":
+				n, err := parseHistory(c)
+				if err != nil {
+					return Zones{}, fall, err
+				}
+				history = n
+			case "update":
+				g, err := ParseGrant(c.RemainingArgs())
+				if err != nil {
+					return Zones{}, fall, c.Errf("update: %s", err)
+				}
+				if policy == nil {
+					policy = &UpdatePolicy{}
+				}
+				policy.Grants = append(policy.Grants, g)
 
 			default:
 				return Zones{}, fall, c.Errf("unknown property '%s'", c.Val())
@@ -147,6 +166,8 @@ func fileParse(c *caddy.Controller) (Zones, fall.F, error) {
 			z[origins[i]].ReloadInterval = reload
 			z[origins[i]].Upstream = upstream.New()
 			z[origins[i]].ReloadByMtime = reload_by_mtime
+			z[origins[i]].UpdatePolicy = policy
+			z[origins[i]].SetHistorySize(history)
 		}
 	}
 
@@ -159,3 +180,16 @@ func fileParse(c *caddy.Controller) (Zones, fall.F, error) {
 	}
 	return Zones{Z: z, Names: names}, fall, nil
 }
+
+// parseHistory parses the argument of the ixfr_history property.
+func parseHistory(c *caddy.Controller) (int, error) {
+	args := c.RemainingArgs()
+	if len(args) != 1 {
+		return 0, c.ArgErr()
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 {
+		return 0, c.Errf("invalid ixfr_history value: %q", args[0])
+	}
+	return n, nil
+}
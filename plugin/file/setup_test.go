@@ -7,6 +7,8 @@ import (
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/plugin/pkg/fall"
 	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
 )
 
 func TestFileParse(t *testing.T) {
@@ -62,7 +64,40 @@ func TestFileParse(t *testing.T) {
 			Zones{Names: []string{"example.org."}},
 			fall.F{Zones: []string{"www.example.org."}},
 		},
+		{
+			`file ` + zoneFileName1 + ` miek.nl. {
+					update dhcp.key. subdomain hosts.miek.nl. A AAAA
+					update admin.key. zonesub
+				}`,
+			false,
+			Zones{Names: []string{"miek.nl."}},
+			fall.Zero,
+		},
+		{
+			`file ` + zoneFileName1 + ` miek.nl. {
+					ixfr_history 0
+				}`,
+			false,
+			Zones{Names: []string{"miek.nl."}},
+			fall.Zero,
+		},
 		// errors.
+		{
+			`file ` + zoneFileName1 + ` miek.nl. {
+				ixfr_history many
+			}`,
+			true,
+			Zones{},
+			fall.Zero,
+		},
+		{
+			`file ` + zoneFileName1 + ` miek.nl. {
+				update dhcp.key. subdomain
+			}`,
+			true,
+			Zones{},
+			fall.Zero,
+		},
 		{
 			`file ` + zoneFileName1 + ` miek.nl {
 				transfer from 127.0.0.1
@@ -150,3 +185,27 @@ func TestParseReload(t *testing.T) {
 		}
 	}
 }
+
+func TestParseUpdate(t *testing.T) {
+	name, rm, err := test.TempFile(".", dbMiekNL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rm()
+
+	c := caddy.NewTestController("dns", `file `+name+` example.org. {
+		update dhcp.key. subdomain hosts.example.org. A AAAA
+		update admin.key. zonesub
+	}`)
+	z, _, err := fileParse(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := z.Z["example.org."].UpdatePolicy
+	if p == nil || len(p.Grants) != 2 {
+		t.Fatalf("Expected update policy with 2 grants, got %v", p)
+	}
+	if !p.Allowed("dhcp.key.", "a.hosts.example.org.", dns.TypeA) {
+		t.Error("Expected dhcp.key. to be allowed to update a.hosts.example.org. A")
+	}
+}
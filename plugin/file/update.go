@@ -0,0 +1,467 @@
+package file
+
+import (
+	"context"
+	"strings"
+
+	"github.com/coredns/coredns/plugin/file/tree"
+	"github.com/coredns/coredns/plugin/transfer"
+	"github.com/coredns/coredns/plugin/tsig"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// ServeUpdate handles the dynamic update (RFC 2136) in r for zone z and writes the reply to w.
+// Updates must be signed with a TSIG key that is granted access by the zone's UpdatePolicy. A
+// successful update is written to the zone's journal and, if t is not nil, notifies are sent.
+func (z *Zone) ServeUpdate(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, t *transfer.Transfer) (int, error) {
+	state := request.Request{W: w, Req: r}
+
+	rcode, serial := z.update(ctx, state)
+
+	m := new(dns.Msg)
+	m.SetRcode(r, rcode)
+	w.WriteMsg(m)
+
+	if serial != 0 {
+		log.Infof("Dynamic update from %s with key %q for %s: new SOA serial %d", state.IP(), tsig.KeyName(ctx), z.origin, serial)
+		if t != nil {
+			go func() {
+				if err := t.Notify(z.origin); err != nil {
+					log.Warningf("Failed sending notifies: %s", err)
+				}
+			}()
+		}
+	}
+	return dns.RcodeSuccess, nil
+}
+
+// update applies the update in state and returns the rcode for the reply. If the zone was
+// changed the new SOA serial is returned as well, otherwise this is 0.
+func (z *Zone) update(ctx context.Context, state request.Request) (int, uint32) {
+	r := state.Req
+	if len(r.Question) != 1 || r.Question[0].Qtype != dns.TypeSOA {
+		return dns.RcodeFormatError, 0
+	}
+	zclass := r.Question[0].Qclass
+	if strings.ToLower(r.Question[0].Name) != z.origin {
+		return dns.RcodeNotAuth, 0
+	}
+	// Secondary zones can't be updated, we don't forward updates to the primary.
+	if len(z.TransferFrom) > 0 {
+		return dns.RcodeNotImplemented, 0
+	}
+
+	key := tsig.KeyName(ctx)
+	if z.UpdatePolicy == nil || key == "" {
+		return dns.RcodeRefused, 0
+	}
+
+	z.updateMu.Lock()
+	defer z.updateMu.Unlock()
+
+	z.RLock()
+	exp := z.Expired
+	z.RUnlock()
+	ap, t := z.snapshot()
+	if exp || ap.SOA == nil {
+		return dns.RcodeServerFailure, 0
+	}
+
+	zd := newZoneData(ap, t)
+
+	if rcode := zd.prerequisites(z.origin, zclass, r.Answer); rcode != dns.RcodeSuccess {
+		return rcode, 0
+	}
+	if rcode := z.prescan(key, zclass, r.Ns); rcode != dns.RcodeSuccess {
+		return rcode, 0
+	}
+
+	for _, rr := range r.Ns {
+		zd.apply(z.origin, zclass, rr)
+	}
+
+	d, changed := zd.delta(ap.SOA)
+	if !changed {
+		return dns.RcodeSuccess, 0
+	}
+	zd.set(z.origin, dns.TypeSOA, []dns.RR{d.to})
+
+	nz, err := zd.zone(z.origin, z.file)
+	if err != nil {
+		log.Errorf("Failed to apply dynamic update for %s: %s", z.origin, err)
+		return dns.RcodeServerFailure, 0
+	}
+	if err := appendJournal(z.File(), d); err != nil {
+		log.Errorf("Failed to write journal for %s: %s", z.origin, err)
+		return dns.RcodeServerFailure, 0
+	}
+	z.journalLen++
+	if z.journalLen > maxJournal {
+		if err := compactJournal(z.File(), z.origin, d.to.Serial); err != nil {
+			log.Warningf("Failed to compact journal for %s: %s", z.origin, err)
+		} else {
+			z.journalLen = 1
+		}
+	}
+	z.commit(nz.Apex, nz.Tree, d)
+
+	return dns.RcodeSuccess, d.to.Serial
+}
+
+// prescan checks the update section, see RFC 2136, section 3.4.1.
+func (z *Zone) prescan(key string, zclass uint16, updates []dns.RR) int {
+	for _, rr := range updates {
+		h := rr.Header()
+		if !dns.IsSubDomain(z.origin, strings.ToLower(h.Name)) {
+			return dns.RcodeNotZone
+		}
+		switch h.Class {
+		case zclass:
+			if isMeta(h.Rrtype) || h.Rrtype == dns.TypeANY {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassANY:
+			if h.Ttl != 0 || (isMeta(h.Rrtype) && h.Rrtype != dns.TypeANY) {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassNONE:
+			if h.Ttl != 0 || isMeta(h.Rrtype) || h.Rrtype == dns.TypeANY {
+				return dns.RcodeFormatError
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+		// Records maintained by the signer can't be updated.
+		switch h.Rrtype {
+		case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3, dns.TypeNSEC3PARAM:
+			return dns.RcodeRefused
+		}
+		if !z.UpdatePolicy.Allowed(key, h.Name, h.Rrtype) {
+			return dns.RcodeRefused
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+func isMeta(qtype uint16) bool {
+	switch qtype {
+	case dns.TypeANY, dns.TypeAXFR, dns.TypeIXFR, dns.TypeMAILA, dns.TypeMAILB, dns.TypeOPT, dns.TypeTSIG:
+		return true
+	}
+	return false
+}
+
+type rrKey struct {
+	name  string
+	qtype uint16
+}
+
+// zoneData is a mutable copy of a zone's records, used to apply updates and journals. It
+// remembers the original content of every RRset it changes, so the delta can be computed.
+type zoneData struct {
+	sets   map[string]map[uint16][]dns.RR
+	before map[rrKey][]dns.RR
+	order  []rrKey
+}
+
+func newZoneData(ap Apex, t *tree.Tree) *zoneData {
+	zd := &zoneData{sets: make(map[string]map[uint16][]dns.RR), before: make(map[rrKey][]dns.RR)}
+	if rrs, err := ap.records(); err == nil {
+		for _, rr := range rrs {
+			zd.load(rr)
+		}
+	}
+	t.Walk(func(e *tree.Elem, _ map[uint16][]dns.RR) error {
+		for _, rr := range e.All() {
+			zd.load(rr)
+		}
+		return nil
+	})
+	return zd
+}
+
+func ownerKey(name string) string { return strings.ToLower(canonicalEscape(name)) }
+
+func (zd *zoneData) load(rr dns.RR) {
+	name := ownerKey(rr.Header().Name)
+	if zd.sets[name] == nil {
+		zd.sets[name] = make(map[uint16][]dns.RR)
+	}
+	zd.sets[name][rr.Header().Rrtype] = append(zd.sets[name][rr.Header().Rrtype], rr)
+}
+
+func (zd *zoneData) get(name string, qtype uint16) []dns.RR {
+	return zd.sets[ownerKey(name)][qtype]
+}
+
+// set replaces the RRset name/qtype with rrs, an empty rrs deletes the RRset.
+func (zd *zoneData) set(name string, qtype uint16, rrs []dns.RR) {
+	name = ownerKey(name)
+	k := rrKey{name, qtype}
+	if _, ok := zd.before[k]; !ok {
+		zd.before[k] = zd.sets[name][qtype]
+		zd.order = append(zd.order, k)
+	}
+	if len(rrs) == 0 {
+		delete(zd.sets[name], qtype)
+		if len(zd.sets[name]) == 0 {
+			delete(zd.sets, name)
+		}
+		return
+	}
+	if zd.sets[name] == nil {
+		zd.sets[name] = make(map[uint16][]dns.RR)
+	}
+	zd.sets[name][qtype] = rrs
+}
+
+// inUse returns true if name owns any records.
+func (zd *zoneData) inUse(name string) bool { return len(zd.sets[ownerKey(name)]) > 0 }
+
+func (zd *zoneData) soa() *dns.SOA {
+	for _, rrs := range zd.sets {
+		if soa, ok := rrs[dns.TypeSOA]; ok && len(soa) > 0 {
+			return soa[0].(*dns.SOA)
+		}
+	}
+	return nil
+}
+
+// add adds rr to its RRset, an existing record with the same rdata is replaced.
+func (zd *zoneData) add(rr dns.RR) {
+	h := rr.Header()
+	old := zd.get(h.Name, h.Rrtype)
+	rrs := make([]dns.RR, 0, len(old)+1)
+	for _, o := range old {
+		if !dns.IsDuplicate(o, rr) {
+			rrs = append(rrs, o)
+		}
+	}
+	zd.set(h.Name, h.Rrtype, append(rrs, rr))
+}
+
+// remove removes the record with the same rdata as rr from its RRset, the class of rr is ignored.
+func (zd *zoneData) remove(rr dns.RR) {
+	h := rr.Header()
+	old := zd.get(h.Name, h.Rrtype)
+	if len(old) == 0 {
+		return
+	}
+	cmp := dns.Copy(rr)
+	rrs := make([]dns.RR, 0, len(old))
+	for _, o := range old {
+		cmp.Header().Class = o.Header().Class
+		if !dns.IsDuplicate(o, cmp) {
+			rrs = append(rrs, o)
+		}
+	}
+	if len(rrs) != len(old) {
+		zd.set(h.Name, h.Rrtype, rrs)
+	}
+}
+
+// prerequisites checks the prerequisite section, see RFC 2136, section 3.2.
+func (zd *zoneData) prerequisites(origin string, zclass uint16, prereqs []dns.RR) int {
+	values := make(map[rrKey][]dns.RR)
+	for _, rr := range prereqs {
+		h := rr.Header()
+		if h.Ttl != 0 {
+			return dns.RcodeFormatError
+		}
+		if !dns.IsSubDomain(origin, strings.ToLower(h.Name)) {
+			return dns.RcodeNotZone
+		}
+		switch h.Class {
+		case dns.ClassANY:
+			if h.Rrtype == dns.TypeANY {
+				if !zd.inUse(h.Name) {
+					return dns.RcodeNameError
+				}
+			} else if len(zd.get(h.Name, h.Rrtype)) == 0 {
+				return dns.RcodeNXRrset
+			}
+		case dns.ClassNONE:
+			if h.Rrtype == dns.TypeANY {
+				if zd.inUse(h.Name) {
+					return dns.RcodeYXDomain
+				}
+			} else if len(zd.get(h.Name, h.Rrtype)) > 0 {
+				return dns.RcodeYXRrset
+			}
+		case zclass:
+			k := rrKey{ownerKey(h.Name), h.Rrtype}
+			values[k] = append(values[k], rr)
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+
+	// Value dependent prerequisites: the RRset must exist and be equal to the one given.
+	for k, rrs := range values {
+		if !sameRRset(zd.get(k.name, k.qtype), rrs) {
+			return dns.RcodeNXRrset
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// sameRRset returns true if a and b hold the same records, TTLs are ignored.
+func sameRRset(a, b []dns.RR) bool {
+	contains := func(set []dns.RR, rr dns.RR) bool {
+		for _, s := range set {
+			if dns.IsDuplicate(s, rr) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, rr := range a {
+		if !contains(b, rr) {
+			return false
+		}
+	}
+	for _, rr := range b {
+		if !contains(a, rr) {
+			return false
+		}
+	}
+	return len(a) > 0
+}
+
+// apply applies a single update record, see RFC 2136, section 3.4.2.
+func (zd *zoneData) apply(origin string, zclass uint16, rr dns.RR) {
+	h := rr.Header()
+	apex := ownerKey(h.Name) == origin
+
+	switch h.Class {
+	case zclass:
+		switch h.Rrtype {
+		case dns.TypeSOA:
+			cur := zd.soa()
+			if !apex || cur == nil || !serialGreater(rr.(*dns.SOA).Serial, cur.Serial) {
+				return
+			}
+			zd.set(origin, dns.TypeSOA, []dns.RR{dns.Copy(rr)})
+			return
+		case dns.TypeCNAME:
+			for t := range zd.sets[ownerKey(h.Name)] {
+				if t != dns.TypeCNAME && !isDNSSEC(t) {
+					return
+				}
+			}
+			zd.set(h.Name, dns.TypeCNAME, []dns.RR{dns.Copy(rr)})
+			return
+		}
+		if !isDNSSEC(h.Rrtype) && len(zd.get(h.Name, dns.TypeCNAME)) > 0 {
+			return
+		}
+		zd.add(dns.Copy(rr))
+
+	case dns.ClassANY:
+		if h.Rrtype != dns.TypeANY {
+			if apex && (h.Rrtype == dns.TypeSOA || h.Rrtype == dns.TypeNS) {
+				return
+			}
+			zd.set(h.Name, h.Rrtype, nil)
+			return
+		}
+		for t := range zd.sets[ownerKey(h.Name)] {
+			if apex && (t == dns.TypeSOA || t == dns.TypeNS) {
+				continue
+			}
+			zd.set(h.Name, t, nil)
+		}
+
+	case dns.ClassNONE:
+		if h.Rrtype == dns.TypeSOA {
+			return
+		}
+		if apex && h.Rrtype == dns.TypeNS {
+			ns := zd.get(h.Name, dns.TypeNS)
+			if len(ns) == 1 && dns.IsDuplicate(ns[0], withClass(rr, ns[0].Header().Class)) {
+				return
+			}
+		}
+		zd.remove(rr)
+	}
+}
+
+func withClass(rr dns.RR, class uint16) dns.RR {
+	rr = dns.Copy(rr)
+	rr.Header().Class = class
+	return rr
+}
+
+func isDNSSEC(qtype uint16) bool {
+	switch qtype {
+	case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3, dns.TypeDNSKEY, dns.TypeDS:
+		return true
+	}
+	return false
+}
+
+// delta returns the difference between the zone with SOA from and the current content. The SOA
+// serial of the new version is from's serial incremented by one, unless the SOA was updated
+// to a higher serial. The boolean is false if the zone was not changed.
+func (zd *zoneData) delta(from *dns.SOA) (delta, bool) {
+	d := delta{from: from}
+	for _, k := range zd.order {
+		if k.qtype == dns.TypeSOA {
+			continue
+		}
+		before, after := zd.before[k], zd.sets[k.name][k.qtype]
+		d.del = append(d.del, difference(before, after)...)
+		d.add = append(d.add, difference(after, before)...)
+	}
+
+	to := zd.soa()
+	if len(d.del) == 0 && len(d.add) == 0 && to.Serial == from.Serial {
+		return d, false
+	}
+	if !serialGreater(to.Serial, from.Serial) {
+		to = dns.Copy(from).(*dns.SOA)
+		to.Serial++
+	}
+	d.to = to
+	return d, true
+}
+
+// difference returns the records in a that are not in b, TTLs are taken into account.
+func difference(a, b []dns.RR) []dns.RR {
+	var diff []dns.RR
+	for _, rr := range a {
+		found := false
+		for _, o := range b {
+			if dns.IsDuplicate(rr, o) && rr.Header().Ttl == o.Header().Ttl {
+				found = true
+				break
+			}
+		}
+		if !found {
+			diff = append(diff, rr)
+		}
+	}
+	return diff
+}
+
+// zone returns a new zone holding copies of the records in zd.
+func (zd *zoneData) zone(origin, file string) (*Zone, error) {
+	nz := NewZone(origin, file)
+	for _, types := range zd.sets {
+		for _, rrs := range types {
+			for _, rr := range rrs {
+				if err := nz.Insert(dns.Copy(rr)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return nz, nil
+}
+
+// serialGreater returns true if serial a is greater than b using serial number arithmetic (RFC 1982).
+func serialGreater(a, b uint32) bool {
+	return a != b && a-b < 1<<31
+}
@@ -0,0 +1,123 @@
+package file
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/miekg/dns"
+)
+
+// UpdatePolicy holds the grants that authorize dynamic updates (RFC 2136) to a zone. A zone
+// without an update policy refuses all updates.
+type UpdatePolicy struct {
+	Grants []Grant
+}
+
+// Grant allows the holder of a TSIG key to update names and types in a zone.
+type Grant struct {
+	Key   string              // TSIG key name.
+	Rule  string              // One of the rule types below.
+	Name  string              // Name used by the name and subdomain rule types.
+	Types map[uint16]struct{} // Types that may be updated, if empty all types except the ones in defaultDenied.
+}
+
+// Rule types, these have the same meaning as in BIND's update-policy.
+const (
+	// RuleName matches exactly Name.
+	RuleName = "name"
+	// RuleSubdomain matches Name and all names below it.
+	RuleSubdomain = "subdomain"
+	// RuleZonesub matches all names in the zone.
+	RuleZonesub = "zonesub"
+	// RuleSelf matches only the name that equals the key's name.
+	RuleSelf = "self"
+)
+
+// defaultDenied are the types that can only be updated if a grant lists them explicitly.
+var defaultDenied = map[uint16]struct{}{
+	dns.TypeSOA:   {},
+	dns.TypeNS:    {},
+	dns.TypeRRSIG: {},
+	dns.TypeNSEC:  {},
+	dns.TypeNSEC3: {},
+}
+
+// ParseGrant parses a grant in the form: KEY RULE [NAME] [TYPE...].
+func ParseGrant(args []string) (Grant, error) {
+	if len(args) < 2 {
+		return Grant{}, fmt.Errorf("grant needs at least a key and a rule")
+	}
+	g := Grant{Key: plugin.Name(args[0]).Normalize(), Rule: strings.ToLower(args[1]), Types: map[uint16]struct{}{}}
+	args = args[2:]
+
+	switch g.Rule {
+	case RuleName, RuleSubdomain:
+		if len(args) == 0 {
+			return Grant{}, fmt.Errorf("rule %q needs a name", g.Rule)
+		}
+		if _, ok := dns.IsDomainName(args[0]); !ok {
+			return Grant{}, fmt.Errorf("invalid name %q", args[0])
+		}
+		g.Name = plugin.Name(args[0]).Normalize()
+		args = args[1:]
+	case RuleZonesub, RuleSelf:
+	default:
+		return Grant{}, fmt.Errorf("unknown rule %q", g.Rule)
+	}
+
+	for _, t := range args {
+		qtype, ok := dns.StringToType[strings.ToUpper(t)]
+		if !ok {
+			return Grant{}, fmt.Errorf("invalid type %q", t)
+		}
+		g.Types[qtype] = struct{}{}
+	}
+	return g, nil
+}
+
+// Allowed returns true if key may update the records of type qtype owned by name. A qtype of
+// dns.TypeANY (deleting all RRsets of a name) is only allowed by grants without a type restriction.
+func (p *UpdatePolicy) Allowed(key, name string, qtype uint16) bool {
+	if p == nil || key == "" {
+		return false
+	}
+	name = strings.ToLower(name)
+	for _, g := range p.Grants {
+		if g.Key != key || !g.matchName(key, name) {
+			continue
+		}
+		if g.matchType(qtype) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g Grant) matchName(key, name string) bool {
+	switch g.Rule {
+	case RuleName:
+		return name == g.Name
+	case RuleSubdomain:
+		return dns.IsSubDomain(g.Name, name)
+	case RuleZonesub:
+		// The caller has already checked the name is in the zone.
+		return true
+	case RuleSelf:
+		return name == key
+	}
+	return false
+}
+
+func (g Grant) matchType(qtype uint16) bool {
+	if len(g.Types) == 0 {
+		_, denied := defaultDenied[qtype]
+		return !denied
+	}
+	if qtype == dns.TypeANY {
+		return false
+	}
+	_, ok := g.Types[qtype]
+	return ok
+}
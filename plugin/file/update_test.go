@@ -0,0 +1,362 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/plugin/tsig"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+const updateZone = `$ORIGIN example.org.
+@	3600 IN	SOA	ns1 hostmaster 100 7200 3600 1209600 3600
+	3600 IN	NS	ns1
+ns1	3600 IN	A	192.0.2.1
+www	3600 IN	A	192.0.2.10
+www	3600 IN	A	192.0.2.11
+alias	3600 IN	CNAME	www
+`
+
+func newUpdateZone(t *testing.T) *Zone {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), "db.example.org")
+	if err := os.WriteFile(fileName, []byte(updateZone), 0600); err != nil {
+		t.Fatal(err)
+	}
+	z, err := Parse(strings.NewReader(updateZone), "example.org.", fileName, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse zone: %s", err)
+	}
+	z.UpdatePolicy = &UpdatePolicy{}
+	for _, args := range [][]string{
+		{"update.key.", "zonesub", "A", "AAAA", "TXT", "CNAME"},
+		{"admin.key.", "zonesub"},
+	} {
+		g, err := ParseGrant(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		z.UpdatePolicy.Grants = append(z.UpdatePolicy.Grants, g)
+	}
+	return z
+}
+
+func serveUpdate(t *testing.T, z *Zone, key string, m *dns.Msg) int {
+	t.Helper()
+	ctx := context.TODO()
+	if key != "" {
+		ctx = context.WithValue(ctx, tsig.Key{}, key)
+	}
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := z.ServeUpdate(ctx, rec, m, nil); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	return rec.Msg.Rcode
+}
+
+func lookupRRs(z *Zone, name string, qtype uint16) []dns.RR {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	state := request.Request{W: &test.ResponseWriter{}, Req: m}
+	answer, _, _, _ := z.Lookup(context.TODO(), state, name)
+	return answer
+}
+
+func newUpdate() *dns.Msg {
+	m := new(dns.Msg)
+	m.SetUpdate("example.org.")
+	return m
+}
+
+func TestUpdate(t *testing.T) {
+	z := newUpdateZone(t)
+
+	m := newUpdate()
+	m.Insert([]dns.RR{test.A("new.example.org. 300 IN A 192.0.2.20"), test.TXT(`new.example.org. 300 IN TXT "hello"`)})
+	m.Remove([]dns.RR{test.A("www.example.org. 3600 IN A 192.0.2.11")})
+	if rcode := serveUpdate(t, z, "update.key.", m); rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR, got %s", dns.RcodeToString[rcode])
+	}
+
+	if x := len(lookupRRs(z, "new.example.org.", dns.TypeA)); x != 1 {
+		t.Errorf("Expected 1 A record for new.example.org., got %d", x)
+	}
+	if x := len(lookupRRs(z, "www.example.org.", dns.TypeA)); x != 1 {
+		t.Errorf("Expected 1 A record for www.example.org., got %d", x)
+	}
+	if z.SOA.Serial != 101 {
+		t.Errorf("Expected SOA serial 101, got %d", z.SOA.Serial)
+	}
+
+	// Deleting a name removes all its RRsets, this needs a grant without a type list.
+	m = newUpdate()
+	m.RemoveName([]dns.RR{test.A("new.example.org. 0 IN A 0.0.0.0")})
+	if rcode := serveUpdate(t, z, "update.key.", m); rcode != dns.RcodeRefused {
+		t.Fatalf("Expected REFUSED, got %s", dns.RcodeToString[rcode])
+	}
+	if rcode := serveUpdate(t, z, "admin.key.", m); rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR, got %s", dns.RcodeToString[rcode])
+	}
+	if x := len(lookupRRs(z, "new.example.org.", dns.TypeTXT)); x != 0 {
+		t.Errorf("Expected no TXT records for new.example.org., got %d", x)
+	}
+	if z.SOA.Serial != 102 {
+		t.Errorf("Expected SOA serial 102, got %d", z.SOA.Serial)
+	}
+
+	// Deleting something that isn't there is not a change.
+	m = newUpdate()
+	m.Remove([]dns.RR{test.A("www.example.org. 3600 IN A 192.0.2.99")})
+	if rcode := serveUpdate(t, z, "update.key.", m); rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR, got %s", dns.RcodeToString[rcode])
+	}
+	if z.SOA.Serial != 102 {
+		t.Errorf("Expected SOA serial 102, got %d", z.SOA.Serial)
+	}
+}
+
+func TestUpdateRefused(t *testing.T) {
+	tests := []struct {
+		key   string
+		rr    dns.RR
+		rcode int
+	}{
+		{"", test.A("a.example.org. 300 IN A 192.0.2.1"), dns.RcodeRefused},
+		{"other.key.", test.A("a.example.org. 300 IN A 192.0.2.1"), dns.RcodeRefused},
+		{"update.key.", test.MX("a.example.org. 300 IN MX 10 mx.example.org."), dns.RcodeRefused},
+		{"update.key.", test.NS("example.org. 300 IN NS ns2.example.org."), dns.RcodeRefused},
+		{"update.key.", test.A("a.example.net. 300 IN A 192.0.2.1"), dns.RcodeNotZone},
+	}
+	for i, tc := range tests {
+		z := newUpdateZone(t)
+		m := newUpdate()
+		m.Insert([]dns.RR{tc.rr})
+		if rcode := serveUpdate(t, z, tc.key, m); rcode != tc.rcode {
+			t.Errorf("Test %d: expected %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[rcode])
+		}
+		if z.SOA.Serial != 100 {
+			t.Errorf("Test %d: expected zone to be unchanged, got SOA serial %d", i, z.SOA.Serial)
+		}
+	}
+
+	z := newUpdateZone(t)
+	m := new(dns.Msg)
+	m.SetUpdate("example.net.")
+	if rcode := serveUpdate(t, z, "update.key.", m); rcode != dns.RcodeNotAuth {
+		t.Errorf("Expected NOTAUTH, got %s", dns.RcodeToString[rcode])
+	}
+
+	z.TransferFrom = []string{"192.0.2.53:53"}
+	if rcode := serveUpdate(t, z, "update.key.", newUpdate()); rcode != dns.RcodeNotImplemented {
+		t.Errorf("Expected NOTIMP for a secondary zone, got %s", dns.RcodeToString[rcode])
+	}
+}
+
+func TestUpdatePrerequisites(t *testing.T) {
+	tests := []struct {
+		prereq func(m *dns.Msg)
+		rcode  int
+	}{
+		{func(m *dns.Msg) { m.NameUsed([]dns.RR{test.A("www.example.org. 0 IN A 0.0.0.0")}) }, dns.RcodeSuccess},
+		{func(m *dns.Msg) { m.NameUsed([]dns.RR{test.A("nope.example.org. 0 IN A 0.0.0.0")}) }, dns.RcodeNameError},
+		{func(m *dns.Msg) { m.NameNotUsed([]dns.RR{test.A("www.example.org. 0 IN A 0.0.0.0")}) }, dns.RcodeYXDomain},
+		{func(m *dns.Msg) { m.RRsetUsed([]dns.RR{test.AAAA("www.example.org. 0 IN AAAA ::1")}) }, dns.RcodeNXRrset},
+		{func(m *dns.Msg) { m.RRsetNotUsed([]dns.RR{test.A("www.example.org. 0 IN A 0.0.0.0")}) }, dns.RcodeYXRrset},
+		{func(m *dns.Msg) {
+			m.Used([]dns.RR{test.A("www.example.org. 3600 IN A 192.0.2.10"), test.A("www.example.org. 3600 IN A 192.0.2.11")})
+		}, dns.RcodeSuccess},
+		{func(m *dns.Msg) { m.Used([]dns.RR{test.A("www.example.org. 3600 IN A 192.0.2.10")}) }, dns.RcodeNXRrset},
+		{func(m *dns.Msg) { m.NameUsed([]dns.RR{test.A("www.example.net. 0 IN A 0.0.0.0")}) }, dns.RcodeNotZone},
+	}
+	for i, tc := range tests {
+		z := newUpdateZone(t)
+		m := newUpdate()
+		tc.prereq(m)
+		m.Insert([]dns.RR{test.A("new.example.org. 300 IN A 192.0.2.20")})
+		if rcode := serveUpdate(t, z, "update.key.", m); rcode != tc.rcode {
+			t.Errorf("Test %d: expected %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[rcode])
+		}
+		added := len(lookupRRs(z, "new.example.org.", dns.TypeA)) == 1
+		if added != (tc.rcode == dns.RcodeSuccess) {
+			t.Errorf("Test %d: expected update applied to be %t", i, !added)
+		}
+	}
+}
+
+func TestUpdateCNAME(t *testing.T) {
+	z := newUpdateZone(t)
+
+	// A CNAME can't be added to a name with other data, and vice versa; these are silently ignored.
+	m := newUpdate()
+	m.Insert([]dns.RR{test.CNAME("www.example.org. 300 IN CNAME elsewhere.example.org."), test.A("alias.example.org. 300 IN A 192.0.2.30")})
+	if rcode := serveUpdate(t, z, "update.key.", m); rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR, got %s", dns.RcodeToString[rcode])
+	}
+	if z.SOA.Serial != 100 {
+		t.Errorf("Expected zone to be unchanged, got SOA serial %d", z.SOA.Serial)
+	}
+
+	// Replacing a CNAME is fine.
+	m = newUpdate()
+	m.Insert([]dns.RR{test.CNAME("alias.example.org. 300 IN CNAME ns1.example.org.")})
+	serveUpdate(t, z, "update.key.", m)
+	rrs := lookupRRs(z, "alias.example.org.", dns.TypeCNAME)
+	if len(rrs) != 1 || rrs[0].(*dns.CNAME).Target != "ns1.example.org." {
+		t.Errorf("Expected CNAME to ns1.example.org., got %v", rrs)
+	}
+}
+
+func TestUpdateJournal(t *testing.T) {
+	z := newUpdateZone(t)
+
+	m := newUpdate()
+	m.Insert([]dns.RR{test.A("new.example.org. 300 IN A 192.0.2.20")})
+	serveUpdate(t, z, "update.key.", m)
+	m = newUpdate()
+	m.RemoveRRset([]dns.RR{test.A("www.example.org. 0 IN A 0.0.0.0")})
+	serveUpdate(t, z, "update.key.", m)
+
+	// Loading the zone again must pick up the changes from the journal.
+	z2, err := Parse(strings.NewReader(updateZone), "example.org.", z.file, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse zone: %s", err)
+	}
+	if z2.SOA.Serial != 102 {
+		t.Errorf("Expected SOA serial 102, got %d", z2.SOA.Serial)
+	}
+	if x := len(lookupRRs(z2, "new.example.org.", dns.TypeA)); x != 1 {
+		t.Errorf("Expected 1 A record for new.example.org., got %d", x)
+	}
+	if x := len(lookupRRs(z2, "www.example.org.", dns.TypeA)); x != 0 {
+		t.Errorf("Expected no A records for www.example.org., got %d", x)
+	}
+
+	// Reloading the same zone is not a change.
+	if _, err := Parse(strings.NewReader(updateZone), "example.org.", z.file, 102); err == nil {
+		t.Error("Expected serial error when reloading an unchanged zone")
+	}
+
+	// A zone file with a newer serial makes the journal obsolete.
+	newer := strings.Replace(updateZone, " 100 ", " 200 ", 1)
+	z3, err := Parse(strings.NewReader(newer), "example.org.", z.file, 102)
+	if err != nil {
+		t.Fatalf("Failed to parse zone: %s", err)
+	}
+	if x := len(lookupRRs(z3, "new.example.org.", dns.TypeA)); x != 0 {
+		t.Errorf("Expected no A records for new.example.org., got %d", x)
+	}
+	// And it is removed.
+	if _, err := os.Stat(z.file + JournalSuffix); !os.IsNotExist(err) {
+		t.Errorf("Expected the obsolete journal to be removed, got %v", err)
+	}
+}
+
+func TestUpdateJournalCompaction(t *testing.T) {
+	z := newUpdateZone(t)
+
+	m := newUpdate()
+	m.Insert([]dns.RR{test.A("new.example.org. 300 IN A 192.0.2.20")})
+	serveUpdate(t, z, "update.key.", m)
+	for i := range maxJournal {
+		m = newUpdate()
+		if i%2 == 0 {
+			m.Insert([]dns.RR{test.TXT(`tmp.example.org. 300 IN TXT "tmp"`)})
+		} else {
+			m.RemoveRRset([]dns.RR{test.TXT(`tmp.example.org. 0 IN TXT ""`)})
+		}
+		serveUpdate(t, z, "update.key.", m)
+	}
+
+	deltas, err := readJournal(z.file, z.origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deltas) != 1 {
+		t.Fatalf("Expected a compacted journal with 1 delta, got %d", len(deltas))
+	}
+	d := deltas[0]
+	if d.from.Serial != 100 || d.to.Serial != 100+maxJournal+1 {
+		t.Errorf("Expected delta from serial 100 to %d, got %d to %d", 100+maxJournal+1, d.from.Serial, d.to.Serial)
+	}
+	if len(d.del) != 0 || len(d.add) != 1 {
+		t.Errorf("Expected only the A record of new.example.org. to be added, got del %v and add %v", d.del, d.add)
+	}
+
+	z2, err := Parse(strings.NewReader(updateZone), "example.org.", z.file, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse zone: %s", err)
+	}
+	if z2.SOA.Serial != 100+maxJournal+1 {
+		t.Errorf("Expected SOA serial %d, got %d", 100+maxJournal+1, z2.SOA.Serial)
+	}
+	if x := len(lookupRRs(z2, "new.example.org.", dns.TypeA)); x != 1 {
+		t.Errorf("Expected 1 A record for new.example.org., got %d", x)
+	}
+	if x := len(lookupRRs(z2, "tmp.example.org.", dns.TypeTXT)); x != 0 {
+		t.Errorf("Expected no TXT records for tmp.example.org., got %d", x)
+	}
+}
+
+func TestParseGrant(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected bool
+	}{
+		{[]string{"key.", "zonesub"}, true},
+		{[]string{"key.", "self", "A"}, true},
+		{[]string{"key.", "name", "www.example.org.", "A", "AAAA"}, true},
+		{[]string{"key.", "subdomain", "hosts.example.org."}, true},
+		{[]string{"key."}, false},
+		{[]string{"key.", "name"}, false},
+		{[]string{"key.", "bogus"}, false},
+		{[]string{"key.", "zonesub", "NOTATYPE"}, false},
+	}
+	for i, tc := range tests {
+		_, err := ParseGrant(tc.args)
+		if (err == nil) != tc.expected {
+			t.Errorf("Test %d: expected success to be %t, got error %v", i, tc.expected, err)
+		}
+	}
+}
+
+func TestUpdatePolicyAllowed(t *testing.T) {
+	var p UpdatePolicy
+	for _, args := range [][]string{
+		{"host.example.org.", "self", "A", "AAAA"},
+		{"hosts.key.", "subdomain", "hosts.example.org."},
+	} {
+		g, err := ParseGrant(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Grants = append(p.Grants, g)
+	}
+
+	tests := []struct {
+		key, name string
+		qtype     uint16
+		expected  bool
+	}{
+		{"host.example.org.", "host.example.org.", dns.TypeA, true},
+		{"host.example.org.", "HOST.example.org.", dns.TypeAAAA, true},
+		{"host.example.org.", "host.example.org.", dns.TypeTXT, false},
+		{"host.example.org.", "host.example.org.", dns.TypeANY, false},
+		{"host.example.org.", "other.example.org.", dns.TypeA, false},
+		{"hosts.key.", "a.hosts.example.org.", dns.TypeTXT, true},
+		{"hosts.key.", "a.hosts.example.org.", dns.TypeANY, true},
+		{"hosts.key.", "a.hosts.example.org.", dns.TypeNS, false},
+		{"hosts.key.", "www.example.org.", dns.TypeA, false},
+	}
+	for i, tc := range tests {
+		if x := p.Allowed(tc.key, tc.name, tc.qtype); x != tc.expected {
+			t.Errorf("Test %d: expected %t, got %t", i, tc.expected, x)
+		}
+	}
+}
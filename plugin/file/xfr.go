@@ -16,10 +16,11 @@ func (f File) Transfer(zone string, serial uint32) (<-chan []dns.RR, error) {
 	return z.Transfer(serial)
 }
 
-// Transfer transfers a zone with serial in the returned channel and implements IXFR fallback, by just
-// sending a single SOA record.
+// Transfer transfers a zone with serial in the returned channel. If serial is not 0 an incremental
+// transfer is done when the zone's history has the differences since serial, otherwise it falls back
+// to a full transfer. If serial is equal or newer than the zone's serial only the SOA is sent.
 func (z *Zone) Transfer(serial uint32) (<-chan []dns.RR, error) {
-	ap, t := z.snapshot()
+	ap, t, deltas := z.ixfr(serial)
 	apex, err := ap.records()
 	if err != nil {
 		return nil, err
@@ -27,7 +28,18 @@ func (z *Zone) Transfer(serial uint32) (<-chan []dns.RR, error) {
 
 	ch := make(chan []dns.RR)
 	go func() {
-		if serial != 0 && ap.SOA.Serial == serial { // ixfr fallback, only send SOA
+		if serial != 0 && !less(serial, ap.SOA.Serial) { // ixfr fallback, only send SOA
+			ch <- []dns.RR{ap.SOA}
+
+			close(ch)
+			return
+		}
+
+		if serial != 0 && len(deltas) > 0 {
+			ch <- []dns.RR{ap.SOA}
+			for _, d := range deltas {
+				ch <- d.records()
+			}
 			ch <- []dns.RR{ap.SOA}
 
 			close(ch)
@@ -33,6 +33,13 @@ type Zone struct {
 	reloadShutdown chan bool
 
 	Upstream *upstream.Upstream // Upstream for looking up external names during the resolution process.
+
+	UpdatePolicy *UpdatePolicy // Policy for dynamic updates, if nil updates are refused.
+	updateMu     sync.Mutex    // Serializes dynamic updates and reloads.
+	journalLen   int           // Number of deltas in the journal, protected by updateMu.
+
+	historySize int     // Number of zone differences to keep for IXFR, 0 disables IXFR.
+	history     []delta // Differences between consecutive versions of the zone, oldest first.
 }
 
 // Apex contains the apex records of a zone: SOA, NS and their potential signatures.
@@ -51,6 +58,7 @@ func NewZone(name, file string) *Zone {
 		file:           filepath.Clean(file),
 		Tree:           &tree.Tree{},
 		reloadShutdown: make(chan bool),
+		historySize:    DefaultHistory,
 	}
 }
 
@@ -58,6 +66,7 @@ func NewZone(name, file string) *Zone {
 func (z *Zone) Copy() *Zone {
 	z1 := NewZone(z.origin, z.file)
 	z1.TransferFrom = z.TransferFrom
+	z1.historySize = z.historySize
 
 	z.RLock()
 	z1.Expired = z.Expired
@@ -71,6 +80,7 @@ func (z *Zone) Copy() *Zone {
 func (z *Zone) CopyWithoutApex() *Zone {
 	z1 := NewZone(z.origin, z.file)
 	z1.TransferFrom = z.TransferFrom
+	z1.historySize = z.historySize
 
 	z.RLock()
 	z1.Expired = z.Expired
@@ -100,8 +110,6 @@ func (z *Zone) Insert(r dns.RR) error {
 
 		z.SOA = r.(*dns.SOA)
 		return nil
-	case dns.TypeNSEC3, dns.TypeNSEC3PARAM:
-		return fmt.Errorf("NSEC3 zone is not supported, dropping RR: %s for zone: %s", r.Header().Name, z.origin)
 	case dns.TypeRRSIG:
 		x := r.(*dns.RRSIG)
 		switch x.TypeCovered {
@@ -153,12 +161,14 @@ func (z *Zone) snapshot() (Apex, *tree.Tree) {
 }
 
 // setData atomically replaces the zone's apex and tree and clears the expired
-// flag. It is the write-side counterpart to snapshot.
+// flag. It is the write-side counterpart to snapshot. As the difference with the
+// previous data is unknown, the zone's history is cleared.
 func (z *Zone) setData(ap Apex, t *tree.Tree) {
 	z.Lock()
 	z.Apex = ap
 	z.Tree = t
 	z.Expired = false
+	z.history = nil
 	z.Unlock()
 }
 
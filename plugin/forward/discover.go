@@ -0,0 +1,177 @@
+package forward
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	proxyPkg "github.com/coredns/coredns/plugin/pkg/proxy"
+)
+
+const (
+	// defaultRefresh is how often the TOs are resolved again when the TTL of their records is unknown,
+	// or resolving them failed.
+	defaultRefresh = 30 * time.Second
+	minRefresh     = 5 * time.Second
+	maxRefresh     = time.Hour
+)
+
+// dynamic returns true if some of the TOs are hostnames or SRV names that need to be resolved again.
+func (f *Forward) dynamic() bool {
+	return slices.ContainsFunc(f.toEntries, func(e toEntry) bool { return !e.static })
+}
+
+// refreshInterval returns the time to wait before resolving records with ttl again.
+func refreshInterval(ttl uint32) time.Duration {
+	if ttl == 0 {
+		return defaultRefresh
+	}
+	d := time.Duration(ttl) * time.Second
+	if d < minRefresh {
+		return minRefresh
+	}
+	return min(d, maxRefresh)
+}
+
+// refreshLoop resolves the TOs again whenever the records they were resolved from expire, until stop
+// is closed. When resolving fails the current upstreams are kept.
+func (f *Forward) refreshLoop(stop <-chan struct{}) {
+	ttl := f.ttl
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(refreshInterval(ttl)):
+		}
+		var err error
+		if ttl, err = f.refresh(); err != nil {
+			log.Warningf("Failed to resolve upstreams of %q again, keeping the current ones: %s", f.from, err)
+		}
+	}
+}
+
+// refresh resolves the TOs and updates the proxies. It returns the lowest TTL of the records used.
+func (f *Forward) refresh() (uint32, error) {
+	ups, ttl, err := expandAndDedup(f.toEntries, f.resolver)
+	if err != nil {
+		return 0, err
+	}
+	f.update(ups)
+	return ttl, nil
+}
+
+// update replaces the upstreams of f with ups. Proxies for addresses that are still in use are kept,
+// proxies for new addresses are created and started. Proxies that are no longer used are removed from
+// the list and their healthchecks stopped; queries in flight to them are completed, as their
+// connections are only closed when the proxy is garbage collected. If f has been shut down in the
+// meantime, the proxies are left as they are and the new ones are stopped.
+func (f *Forward) update(ups []upstream) {
+	f.mu.RLock()
+	current := make(map[string]*proxyPkg.Proxy, len(f.proxies))
+	for i, p := range f.proxies {
+		if i < len(f.upstreams) {
+			current[f.upstreams[i].addr] = p
+		}
+	}
+	f.mu.RUnlock()
+
+	proxies := make([]*proxyPkg.Proxy, 0, len(ups))
+	added := []*proxyPkg.Proxy{}
+	for _, u := range ups {
+		p, ok := current[u.addr]
+		if ok {
+			delete(current, u.addr)
+		} else {
+			p = f.newProxy(u.addr)
+			p.Start(f.hcInterval)
+			added = append(added, p)
+		}
+		proxies = append(proxies, p)
+	}
+
+	f.mu.Lock()
+	if f.stopped {
+		f.mu.Unlock()
+		for _, p := range added {
+			p.Stop()
+		}
+		return
+	}
+	f.proxies = proxies
+	f.setUpstreams(ups)
+	f.mu.Unlock()
+
+	for _, p := range added {
+		log.Infof("Adding upstream %s for %q", p.Addr(), f.from)
+	}
+	for _, p := range current {
+		log.Infof("Removing upstream %s for %q", p.Addr(), f.from)
+		p.Stop()
+	}
+}
+
+// setUpstreams sets the upstreams of the proxies of f.
+func (f *Forward) setUpstreams(ups []upstream) {
+	f.upstreams = ups
+	f.srv = slices.ContainsFunc(ups, func(u upstream) bool { return u.srv })
+}
+
+// listSRV returns proxies grouped by the priority of their upstreams, lowest first. Upstreams that were
+// not discovered through SRV records have priority 0. Within a group the proxies are ordered by policy,
+// except for the random policy, which does a weighted random selection as described in RFC 2782.
+func listSRV(policy Policy, proxies []*proxyPkg.Proxy, ups []upstream) []*proxyPkg.Proxy {
+	idx := make([]int, len(proxies))
+	for i := range idx {
+		idx[i] = i
+	}
+	slices.SortStableFunc(idx, func(a, b int) int { return cmp.Compare(ups[a].priority, ups[b].priority) })
+
+	_, weighted := policy.(*random)
+	list := make([]*proxyPkg.Proxy, 0, len(proxies))
+	for len(idx) > 0 {
+		n := 1
+		for n < len(idx) && ups[idx[n]].priority == ups[idx[0]].priority {
+			n++
+		}
+		group := idx[:n]
+		idx = idx[n:]
+
+		if weighted {
+			list = append(list, weightedOrder(proxies, ups, group)...)
+			continue
+		}
+		gp := make([]*proxyPkg.Proxy, len(group))
+		for i, j := range group {
+			gp[i] = proxies[j]
+		}
+		list = append(list, policy.List(gp)...)
+	}
+	return list
+}
+
+// weightedOrder returns the proxies at the indexes in group, ordered by repeatedly picking one of the
+// remaining ones with a probability proportional to the weight of its upstream. If all remaining
+// weights are 0 each is picked with the same probability.
+func weightedOrder(proxies []*proxyPkg.Proxy, ups []upstream, group []int) []*proxyPkg.Proxy {
+	group = slices.Clone(group)
+	list := make([]*proxyPkg.Proxy, 0, len(group))
+	for len(group) > 0 {
+		total := 0
+		for _, j := range group {
+			total += int(ups[j].weight)
+		}
+		pick := 0
+		if total == 0 {
+			pick = rn.Int() % len(group)
+		} else {
+			r := rn.Int() % total
+			for r >= int(ups[group[pick]].weight) {
+				r -= int(ups[group[pick]].weight)
+				pick++
+			}
+		}
+		list = append(list, proxies[group[pick]])
+		group = slices.Delete(group, pick, pick+1)
+	}
+	return list
+}
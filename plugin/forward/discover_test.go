@@ -0,0 +1,227 @@
+package forward
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/proxy"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// newDiscoveryServer returns a server that answers with the records in rrs, which can be changed
+// with the returned function.
+func newDiscoveryServer(rrs ...dns.RR) (*dnstest.Server, func(...dns.RR)) {
+	var mu sync.Mutex
+	s := dnstest.NewMultipleServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		mu.Lock()
+		for _, rr := range rrs {
+			if rr.Header().Name == r.Question[0].Name && rr.Header().Rrtype == r.Question[0].Qtype {
+				ret.Answer = append(ret.Answer, rr)
+			}
+		}
+		mu.Unlock()
+		w.WriteMsg(ret)
+	})
+	return s, func(n ...dns.RR) {
+		mu.Lock()
+		rrs = n
+		mu.Unlock()
+	}
+}
+
+func TestResolveSRVEntry(t *testing.T) {
+	s, _ := newDiscoveryServer(
+		test.SRV("_dns._udp.example.com. 300 IN SRV 10 60 5353 ns1.example.com."),
+		test.SRV("_dns._udp.example.com. 300 IN SRV 20 0 53 ns2.example.com."),
+		test.SRV("_dns._udp.example.com. 300 IN SRV 10 0 53 ."),
+		test.A("ns1.example.com. 60 IN A 10.0.0.1"),
+		test.AAAA("ns1.example.com. 120 IN AAAA 2001:db8::1"),
+		test.A("ns2.example.com. 600 IN A 10.0.0.2"),
+	)
+	defer s.Close()
+
+	ups, ttl, err := resolveSRVEntry(hostEntry{hostname: "_dns._udp.example.com", transport: "dns"}, []string{s.Addr})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []upstream{
+		{addr: "10.0.0.1:5353", srv: true, priority: 10, weight: 60},
+		{addr: "[2001:db8::1]:5353", srv: true, priority: 10, weight: 60},
+		{addr: "10.0.0.2:53", srv: true, priority: 20},
+	}
+	if len(ups) != len(expected) {
+		t.Fatalf("Expected %d upstreams, got %d: %v", len(expected), len(ups), ups)
+	}
+	for i := range expected {
+		if ups[i] != expected[i] {
+			t.Errorf("Expected upstream %d to be %v, got %v", i, expected[i], ups[i])
+		}
+	}
+	if ttl != 60 {
+		t.Errorf("Expected TTL 60, got %d", ttl)
+	}
+
+	if _, _, err := resolveSRVEntry(hostEntry{hostname: "_dns._udp.example.org", transport: "dns"}, []string{s.Addr}); err == nil {
+		t.Error("Expected error for a name without SRV records, got nil")
+	}
+}
+
+func TestRefreshInterval(t *testing.T) {
+	tests := []struct {
+		ttl      uint32
+		expected time.Duration
+	}{
+		{0, defaultRefresh},
+		{1, minRefresh},
+		{60, time.Minute},
+		{86400, maxRefresh},
+	}
+	for _, tc := range tests {
+		if got := refreshInterval(tc.ttl); got != tc.expected {
+			t.Errorf("Expected interval %s for TTL %d, got %s", tc.expected, tc.ttl, got)
+		}
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	s, set := newDiscoveryServer(
+		test.A("ns.example.com. 30 IN A 10.0.0.1"),
+		test.A("ns.example.com. 30 IN A 10.0.0.2"),
+	)
+	defer s.Close()
+
+	c := caddy.NewTestController("dns", fmt.Sprintf("forward . ns.example.com 10.0.0.9 {\nresolver %s\n}\n", s.Addr))
+	fs, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	f := fs[0]
+	if !f.dynamic() {
+		t.Fatal("Expected forward with a hostname TO to be dynamic")
+	}
+	if f.ttl != 30 {
+		t.Errorf("Expected TTL 30, got %d", f.ttl)
+	}
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	before := f.List()
+	kept := proxyFor(before, "10.0.0.2:53")
+	if kept == nil || proxyFor(before, "10.0.0.1:53") == nil {
+		t.Fatalf("Expected proxies for 10.0.0.1:53 and 10.0.0.2:53, got %v", before)
+	}
+
+	set(test.A("ns.example.com. 60 IN A 10.0.0.2"), test.A("ns.example.com. 60 IN A 10.0.0.3"))
+	ttl, err := f.refresh()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ttl != 60 {
+		t.Errorf("Expected TTL 60, got %d", ttl)
+	}
+
+	after := f.List()
+	if f.Len() != 3 {
+		t.Fatalf("Expected 3 proxies, got %d", f.Len())
+	}
+	if p := proxyFor(after, "10.0.0.2:53"); p == nil || p != kept {
+		t.Error("Expected the proxy for 10.0.0.2:53 to be kept")
+	}
+	if proxyFor(after, "10.0.0.3:53") == nil {
+		t.Error("Expected a proxy for 10.0.0.3:53 to be added")
+	}
+	if proxyFor(after, "10.0.0.1:53") != nil {
+		t.Error("Expected the proxy for 10.0.0.1:53 to be removed")
+	}
+	if proxyFor(after, "10.0.0.9:53") == nil {
+		t.Error("Expected the proxy for the static TO to be kept")
+	}
+	// A failure keeps the current upstreams.
+	set()
+	if _, err := f.refresh(); err == nil {
+		t.Fatal("Expected error when the hostname does not resolve, got nil")
+	}
+	if f.Len() != 3 {
+		t.Errorf("Expected 3 proxies after a failed refresh, got %d", f.Len())
+	}
+	// A refresh that finishes after shutdown doesn't add proxies.
+	f.OnShutdown()
+	set(test.A("ns.example.com. 60 IN A 10.0.0.4"))
+	if _, err := f.refresh(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if proxyFor(f.List(), "10.0.0.4:53") != nil {
+		t.Error("Expected no proxy for 10.0.0.4:53 to be added after shutdown")
+	}
+}
+
+func TestListSRV(t *testing.T) {
+	proxies := []*proxy.Proxy{
+		proxy.NewProxy("forward", "10.0.0.1:53", "dns"),
+		proxy.NewProxy("forward", "10.0.0.2:53", "dns"),
+		proxy.NewProxy("forward", "10.0.0.3:53", "dns"),
+		proxy.NewProxy("forward", "10.0.0.4:53", "dns"),
+	}
+	ups := []upstream{
+		{addr: "10.0.0.1:53", srv: true, priority: 20, weight: 10},
+		{addr: "10.0.0.2:53", srv: true, priority: 10, weight: 0},
+		{addr: "10.0.0.3:53", srv: true, priority: 10, weight: 10},
+		{addr: "10.0.0.4:53", srv: true, priority: 30, weight: 10},
+	}
+
+	for range 20 {
+		list := listSRV(new(random), proxies, ups)
+		expected := []string{"10.0.0.3:53", "10.0.0.2:53", "10.0.0.1:53", "10.0.0.4:53"}
+		for i, p := range list {
+			if p.Addr() != expected[i] {
+				t.Fatalf("Expected %s at position %d, got %s", expected[i], i, p.Addr())
+			}
+		}
+	}
+
+	list := listSRV(new(sequential), proxies, ups)
+	expected := []string{"10.0.0.2:53", "10.0.0.3:53", "10.0.0.1:53", "10.0.0.4:53"}
+	for i, p := range list {
+		if p.Addr() != expected[i] {
+			t.Errorf("Expected %s at position %d, got %s", expected[i], i, p.Addr())
+		}
+	}
+}
+
+func TestWeightedOrder(t *testing.T) {
+	proxies := []*proxy.Proxy{
+		proxy.NewProxy("forward", "10.0.0.1:53", "dns"),
+		proxy.NewProxy("forward", "10.0.0.2:53", "dns"),
+	}
+	ups := []upstream{
+		{addr: "10.0.0.1:53", srv: true, weight: 90},
+		{addr: "10.0.0.2:53", srv: true, weight: 10},
+	}
+	first := 0
+	for range 1000 {
+		if weightedOrder(proxies, ups, []int{0, 1})[0] == proxies[0] {
+			first++
+		}
+	}
+	// Expect about 900, allow for plenty of randomness.
+	if first < 800 || first > 980 {
+		t.Errorf("Expected the upstream with weight 90 to be first about 900 times, got %d", first)
+	}
+}
+
+func proxyFor(proxies []*proxy.Proxy, addr string) *proxy.Proxy {
+	for _, p := range proxies {
+		if p.Addr() == addr {
+			return p
+		}
+	}
+	return nil
+}
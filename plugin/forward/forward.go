@@ -11,6 +11,7 @@ import (
 	"net"
 	"net/http"
 	"slices"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -18,6 +19,7 @@ import (
 	"github.com/coredns/coredns/plugin/debug"
 	"github.com/coredns/coredns/plugin/dnstap"
 	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/pkg/ecs"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 	proxyPkg "github.com/coredns/coredns/plugin/pkg/proxy"
 	"github.com/coredns/coredns/request"
@@ -66,10 +68,33 @@ type Forward struct {
 	maxConnectAttemptsSet      bool
 	sourceAddress              net.IP
 
+	// EDNS Client Subnet: when ecs is true the client's subnet, truncated to ecsV4 or ecsV6 bits, is
+	// sent upstream, except for the names in ecsExcept.
+	ecs       bool
+	ecsV4     uint8
+	ecsV6     uint8
+	ecsExcept []string
+
+	// Race: when raceCount > 1 the query is sent to raceCount upstreams concurrently, each started
+	// raceDelay after the previous one.
+	raceCount int
+	raceDelay time.Duration
+
 	// Hostname resolution fields
 	resolver  []string  // custom resolver IPs for hostname TO resolution
 	toEntries []toEntry // ordered TO entries preserving config order
 
+	// Upstream discovery: hostname and SRV TOs are resolved again when their TTL expires and the
+	// proxies are updated. mu protects proxies, upstreams and srv, which are replaced when that happens,
+	// and stop and stopped.
+	mu                     sync.RWMutex
+	upstreams              []upstream             // the upstreams of proxies, in the same order
+	srv                    bool                   // some upstreams were discovered through SRV records
+	ttl                    uint32                 // lowest TTL of the records the upstreams were resolved from
+	stop                   chan struct{}          // stops re-resolving
+	stopped                bool                   // OnShutdown has stopped the proxies, no new ones are added
+	perServerNameTLSConfig map[string]*tls.Config // TLS configs for the %zone server names of TOs
+
 	opts proxyPkg.Options // also here for testing
 
 	// ErrLimitExceeded indicates that a query was rejected because the number of concurrent queries has exceeded
@@ -89,7 +114,10 @@ func New() *Forward {
 
 // SetProxy appends p to the proxy list and starts healthchecking.
 func (f *Forward) SetProxy(p *proxyPkg.Proxy) {
+	f.mu.Lock()
 	f.proxies = append(f.proxies, p)
+	f.upstreams = append(f.upstreams, upstream{addr: p.Addr()})
+	f.mu.Unlock()
 	p.Start(f.hcInterval)
 }
 
@@ -107,7 +135,11 @@ func (f *Forward) SetTapPlugin(tapPlugin *dnstap.Dnstap) {
 }
 
 // Len returns the number of configured proxies.
-func (f *Forward) Len() int { return len(f.proxies) }
+func (f *Forward) Len() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.proxies)
+}
 
 // Name implements plugin.Handler.
 func (f *Forward) Name() string { return "forward" }
@@ -128,6 +160,19 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 		}
 	}
 
+	var subnet *dns.EDNS0_SUBNET
+	if f.ecs && plugin.Zones(f.ecsExcept).Matches(state.Name()) == "" {
+		if subnet = f.subnet(state); subnet != nil {
+			req := r.Copy()
+			ecs.Set(req, subnet)
+			state = request.Request{W: w, Req: req}
+		}
+	}
+
+	if f.raceCount > 1 {
+		return f.race(ctx, w, r, state, subnet)
+	}
+
 	fails := 0
 	failoverAttempts := 0
 	var span, child ot.Span
@@ -154,7 +199,7 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 		i++
 		if proxy.Down(f.maxfails) {
 			fails++
-			if fails < len(f.proxies) {
+			if fails < len(list) {
 				continue
 			}
 
@@ -166,7 +211,7 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 			// assume healthcheck is completely broken and randomly
 			// select an upstream to connect to.
 			r := new(random)
-			proxy = r.List(f.proxies)[0]
+			proxy = r.List(list)[0]
 		}
 
 		if span != nil {
@@ -179,27 +224,7 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 			return proxy.Addr()
 		})
 
-		var (
-			ret           *dns.Msg
-			localAddr     net.Addr
-			upstreamProto string
-			err           error
-		)
-		opts := f.opts
-
-		for {
-			ret, localAddr, upstreamProto, err = proxy.Connect(ctx, state, opts)
-
-			if err == proxyPkg.ErrCachedClosed { // Remote side closed conn, can only happen with TCP.
-				continue
-			}
-			// Retry with TCP if truncated and prefer_udp configured.
-			if ret != nil && ret.Truncated && !opts.ForceTCP && opts.PreferUDP {
-				opts.ForceTCP = true
-				continue
-			}
-			break
-		}
+		ret, localAddr, upstreamProto, err := f.connect(ctx, proxy, state)
 
 		if child != nil {
 			child.Finish()
@@ -209,6 +234,10 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 			toDnstap(ctx, f, proxy.Addr(), localAddr, upstreamProto, state, ret, start)
 		}
 
+		if err == nil && subnet != nil && !ecs.Match(subnet, ret) {
+			err = ErrECSMismatch
+		}
+
 		upstreamErr = err
 
 		if err != nil {
@@ -228,7 +257,7 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 				}
 			}
 
-			if fails < len(f.proxies) {
+			if fails < len(list) {
 				continue
 			}
 			break
@@ -248,31 +277,13 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 		tryNext := false
 		if slices.Contains(f.failoverRcodes, ret.Rcode) {
 			failoverAttempts++
-			tryNext = failoverAttempts < len(f.proxies)
+			tryNext = failoverAttempts < len(list)
 		}
 		if tryNext {
 			continue
 		}
 
-		// Check if we have an alternate Rcode defined, check if we match on the code
-		for _, alternateRcode := range f.nextAlternateRcodes {
-			if alternateRcode == ret.Rcode && f.Next != nil { // In case we do not have a Next handler, just continue normally
-				if _, ok := f.Next.(*Forward); ok { // Only continue if the next forwarder is also a Forworder
-					return plugin.NextOrFailure(f.Name(), f.Next, ctx, w, r)
-				}
-			}
-		}
-
-		if f.nextOnNodata && f.Next != nil {
-			if ret.Rcode == dns.RcodeSuccess && isEmpty(ret) {
-				if _, ok := f.Next.(*Forward); ok {
-					return plugin.NextOrFailure(f.Name(), f.Next, ctx, w, r)
-				}
-			}
-		}
-
-		w.WriteMsg(ret)
-		return 0, nil
+		return f.reply(ctx, w, r, subnet, ret)
 	}
 
 	if upstreamErr != nil {
@@ -303,6 +314,96 @@ func (f *Forward) isAllowedDomain(name string) bool {
 	return true
 }
 
+// connect sends the query in state to proxy. It retries when the remote side closed a cached
+// connection, and over TCP when the reply is truncated and prefer_udp is configured.
+func (f *Forward) connect(ctx context.Context, proxy *proxyPkg.Proxy, state request.Request) (*dns.Msg, net.Addr, string, error) {
+	opts := f.opts
+	for {
+		ret, localAddr, upstreamProto, err := proxy.Connect(ctx, state, opts)
+		if err == proxyPkg.ErrCachedClosed { // Remote side closed conn, can only happen with TCP.
+			continue
+		}
+		// Retry with TCP if truncated and prefer_udp configured.
+		if ret != nil && ret.Truncated && !opts.ForceTCP && opts.PreferUDP {
+			opts.ForceTCP = true
+			continue
+		}
+		return ret, localAddr, upstreamProto, err
+	}
+}
+
+// reply writes ret, the upstream's reply to the client's request r, to w. If the rcode of ret is one
+// for which the next forwarder should be used, the request is handed to the next plugin instead.
+func (f *Forward) reply(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, subnet *dns.EDNS0_SUBNET, ret *dns.Msg) (int, error) {
+	// Check if we have an alternate Rcode defined, check if we match on the code
+	for _, alternateRcode := range f.nextAlternateRcodes {
+		if alternateRcode == ret.Rcode && f.Next != nil { // In case we do not have a Next handler, just continue normally
+			if _, ok := f.Next.(*Forward); ok { // Only continue if the next forwarder is also a Forworder
+				return plugin.NextOrFailure(f.Name(), f.Next, ctx, w, r)
+			}
+		}
+	}
+
+	if f.nextOnNodata && f.Next != nil {
+		if ret.Rcode == dns.RcodeSuccess && isEmpty(ret) {
+			if _, ok := f.Next.(*Forward); ok {
+				return plugin.NextOrFailure(f.Name(), f.Next, ctx, w, r)
+			}
+		}
+	}
+
+	if subnet != nil {
+		replySubnet(ctx, r, subnet, ret)
+	}
+
+	w.WriteMsg(ret)
+	return 0, nil
+}
+
+// subnet returns the EDNS Client Subnet option to send upstream for state, or nil if none should
+// be sent. If the client sent the option, its source prefix length is capped at our own; a source
+// prefix length of 0 means the client opted out and its request is forwarded as is.
+func (f *Forward) subnet(state request.Request) *dns.EDNS0_SUBNET {
+	if e := ecs.Get(state.Req); e != nil {
+		if e.SourceNetmask == 0 {
+			return nil
+		}
+		if e.Family == 1 {
+			return ecs.Truncate(e, f.ecsV4)
+		}
+		return ecs.Truncate(e, f.ecsV6)
+	}
+	ip := net.ParseIP(state.IP())
+	if ip == nil {
+		return nil
+	}
+	return ecs.New(ip, f.ecsV4, f.ecsV6)
+}
+
+// replySubnet fixes up the EDNS Client Subnet option in ret, the reply to a request with subnet,
+// for the client's request r. If the client did not send the option, it is removed, unless the
+// caller asked to keep it. Otherwise the client's own option is returned with the scope of ret.
+func replySubnet(ctx context.Context, r *dns.Msg, subnet *dns.EDNS0_SUBNET, ret *dns.Msg) {
+	e := ecs.Get(r)
+	if e == nil {
+		if !ecs.Keep(ctx) {
+			ecs.Strip(ret, r)
+		}
+		return
+	}
+	re := ecs.Get(ret)
+	if re == nil {
+		return
+	}
+	ecs.Set(ret, &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        e.Family,
+		SourceNetmask: e.SourceNetmask,
+		SourceScope:   min(re.SourceScope, subnet.SourceNetmask),
+		Address:       e.Address,
+	})
+}
+
 func isEmpty(r *dns.Msg) bool {
 	if len(r.Answer) == 0 {
 		return true
@@ -322,12 +423,23 @@ func (f *Forward) ForceTCP() bool { return f.opts.ForceTCP }
 // PreferUDP returns if UDP is preferred to be used even when the request comes in over TCP.
 func (f *Forward) PreferUDP() bool { return f.opts.PreferUDP }
 
-// List returns a set of proxies to be used for this client depending on the policy in f.
-func (f *Forward) List() []*proxyPkg.Proxy { return f.p.List(f.proxies) }
+// List returns a set of proxies to be used for this client depending on the policy in f. Proxies
+// discovered through SRV records are ordered by their priority first.
+func (f *Forward) List() []*proxyPkg.Proxy {
+	f.mu.RLock()
+	proxies, upstreams, srv := f.proxies, f.upstreams, f.srv
+	f.mu.RUnlock()
+	if !srv {
+		return f.p.List(proxies)
+	}
+	return listSRV(f.p, proxies, upstreams)
+}
 
 var (
 	// ErrNoHealthy means no healthy proxies left.
 	ErrNoHealthy = errors.New("no healthy proxies")
+	// ErrECSMismatch means the EDNS Client Subnet option in the reply doesn't match the request.
+	ErrECSMismatch = errors.New("client subnet in reply does not match the request")
 	// ErrNoForward means no forwarder defined.
 	ErrNoForward = errors.New("no forwarder defined")
 	// ErrCachedClosed means cached connection was closed by peer.
@@ -14,6 +14,7 @@ import (
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin/dnstap"
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/ecs"
 	"github.com/coredns/coredns/plugin/pkg/proxy"
 	"github.com/coredns/coredns/plugin/pkg/transport"
 	"github.com/coredns/coredns/plugin/test"
@@ -417,3 +418,111 @@ func TestForwardDoesNotRetryLocalPackError(t *testing.T) {
 		t.Fatalf("expected one forwarding attempt, got %d", got)
 	}
 }
+
+func TestForwardECS(t *testing.T) {
+	var received atomic.Pointer[dns.EDNS0_SUBNET]
+	s := dnstest.NewServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		e := ecs.Get(r)
+		received.Store(e)
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		ret.Answer = append(ret.Answer, test.A(r.Question[0].Name+" IN A 127.0.0.1"))
+		if e != nil {
+			ret.SetEdns0(dns.DefaultMsgSize, false)
+			e.SourceScope = e.SourceNetmask
+			ecs.Set(ret, e)
+		}
+		w.WriteMsg(ret)
+	})
+	defer s.Close()
+
+	c := caddy.NewTestController("dns", "forward . "+s.Addr+" {\necs\necs_except example.net\n}\n")
+	fs, err := parseForward(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := fs[0]
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	tests := []struct {
+		name     string
+		qname    string
+		client   *dns.EDNS0_SUBNET
+		keep     bool
+		upstream string // subnet the upstream should see, empty for none
+		reply    string // subnet in the reply, empty for none
+		scope    uint8
+	}{
+		{"remote address", "example.org.", nil, false, "10.240.0.0/24", "", 0},
+		{"remote address kept", "example.org.", nil, true, "10.240.0.0/24", "10.240.0.0/24", 24},
+		{"client subnet", "example.org.", &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 32, Address: net.ParseIP("192.0.2.77").To4()}, false, "192.0.2.0/24", "192.0.2.77/32", 24},
+		{"client opt out", "example.org.", &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 0, Address: net.IPv4zero.To4()}, false, "0.0.0.0/0", "0.0.0.0/0", 0},
+		{"except", "www.example.net.", nil, false, "", "", 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			received.Store(nil)
+			m := new(dns.Msg)
+			m.SetQuestion(tc.qname, dns.TypeA)
+			if tc.client != nil {
+				m.SetEdns0(dns.DefaultMsgSize, false)
+				ecs.Set(m, tc.client)
+			}
+			ctx := context.Background()
+			if tc.keep {
+				ctx = ecs.WithKeep(ctx)
+			}
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+			if _, err := f.ServeDNS(ctx, rec, m); err != nil {
+				t.Fatal(err)
+			}
+			if got := subnetString(received.Load()); got != tc.upstream {
+				t.Errorf("Expected upstream to see %q, got %q", tc.upstream, got)
+			}
+			e := ecs.Get(rec.Msg)
+			if got := subnetString(e); got != tc.reply {
+				t.Errorf("Expected reply with %q, got %q", tc.reply, got)
+			}
+			if e != nil && e.SourceScope != tc.scope {
+				t.Errorf("Expected scope %d, got %d", tc.scope, e.SourceScope)
+			}
+			if tc.client == nil && !tc.keep && rec.Msg.IsEdns0() != nil {
+				t.Error("Expected no OPT RR in the reply")
+			}
+		})
+	}
+}
+
+func TestForwardECSMismatch(t *testing.T) {
+	s := dnstest.NewServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		ret.SetEdns0(dns.DefaultMsgSize, false)
+		ecs.Set(ret, &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 24, SourceScope: 24, Address: net.ParseIP("198.51.100.0").To4()})
+		w.WriteMsg(ret)
+	})
+	defer s.Close()
+
+	c := caddy.NewTestController("dns", "forward . "+s.Addr+" {\necs\nmax_connect_attempts 1\n}\n")
+	fs, err := parseForward(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := fs[0]
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	if _, err := f.ServeDNS(context.Background(), dnstest.NewRecorder(&test.ResponseWriter{}), m); err != ErrECSMismatch {
+		t.Errorf("Expected %q, got %v", ErrECSMismatch, err)
+	}
+}
+
+func subnetString(e *dns.EDNS0_SUBNET) string {
+	if e == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s/%d", e.Address, e.SourceNetmask)
+}
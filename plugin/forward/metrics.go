@@ -22,4 +22,11 @@ var (
 		Name:      "max_concurrent_rejects_total",
 		Help:      "Counter of the number of queries rejected because the concurrent queries were at maximum.",
 	})
+
+	raceWinsCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "forward",
+		Name:      "race_wins_total",
+		Help:      "Counter of the number of races won per upstream.",
+	}, []string{"to"})
 )
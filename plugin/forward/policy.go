@@ -1,6 +1,8 @@
 package forward
 
 import (
+	"cmp"
+	"slices"
 	"sync/atomic"
 	"time"
 
@@ -68,3 +70,71 @@ func (r *sequential) List(p []*proxy.Proxy) []*proxy.Proxy {
 }
 
 var rn = rand.New(time.Now().UnixNano())
+
+const (
+	// fastestBand is the fraction of the fastest RTT within which upstreams are considered equally fast.
+	fastestBand = 4 // i.e. within 25%
+	// fastestExplore is how often, one in fastestExplore queries, a slower upstream is tried first.
+	fastestExplore = 20
+)
+
+// fastest is a policy that prefers the upstreams with the lowest round trip time. Upstreams whose
+// RTT is within 25% of the fastest are considered equally fast and are shuffled, the others follow
+// ordered by RTT. To keep the RTT of the slower upstreams current, one in 20 queries is sent to a
+// random slower upstream first. Upstreams that have not answered yet have no RTT and are tried first.
+type fastest struct{}
+
+func (r *fastest) String() string { return "fastest" }
+
+func (r *fastest) List(p []*proxy.Proxy) []*proxy.Proxy {
+	if len(p) == 1 {
+		return p
+	}
+	rtts := make(map[*proxy.Proxy]time.Duration, len(p))
+	for _, x := range p {
+		rtts[x] = x.RTT()
+	}
+	sorted := slices.Clone(p)
+	slices.SortStableFunc(sorted, func(a, b *proxy.Proxy) int { return cmp.Compare(rtts[a], rtts[b]) })
+
+	best := rtts[sorted[0]]
+	band := 1
+	for band < len(sorted) && rtts[sorted[band]] <= best+best/fastestBand {
+		band++
+	}
+	front := slices.Clone(sorted[:band])
+	for i, j := range rn.Perm(band) {
+		sorted[i] = front[j]
+	}
+
+	if band < len(sorted) && rn.Int()%fastestExplore == 0 {
+		i := band + rn.Int()%(len(sorted)-band)
+		explore := sorted[i]
+		copy(sorted[1:i+1], sorted[:i])
+		sorted[0] = explore
+	}
+	return sorted
+}
+
+// p2c is a policy that implements power of two choices: of two random upstreams the one with the
+// lowest cost, the RTT times the number of queries in flight plus one, is tried first, then the
+// other. The remaining upstreams follow in random order.
+type p2c struct{}
+
+func (r *p2c) String() string { return "p2c" }
+
+func (r *p2c) List(p []*proxy.Proxy) []*proxy.Proxy {
+	if len(p) == 1 {
+		return p
+	}
+	list := make([]*proxy.Proxy, len(p))
+	for i, j := range rn.Perm(len(p)) {
+		list[i] = p[j]
+	}
+	if cost(list[1]) < cost(list[0]) {
+		list[0], list[1] = list[1], list[0]
+	}
+	return list
+}
+
+func cost(p *proxy.Proxy) int64 { return int64(p.RTT()) * (p.InFlight() + 1) }
@@ -0,0 +1,84 @@
+package forward
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/proxy"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// newTimedProxies returns a proxy for each delay, each of which has answered a query after that delay.
+func newTimedProxies(t *testing.T, delays ...time.Duration) []*proxy.Proxy {
+	t.Helper()
+	var ps []*proxy.Proxy
+	for _, d := range delays {
+		s := dnstest.NewServer(func(w dns.ResponseWriter, r *dns.Msg) {
+			time.Sleep(d)
+			ret := new(dns.Msg)
+			ret.SetReply(r)
+			w.WriteMsg(ret)
+		})
+		t.Cleanup(s.Close)
+
+		p := proxy.NewProxy("forward", s.Addr, transport.DNS)
+		p.Start(time.Minute)
+		t.Cleanup(p.Stop)
+
+		m := new(dns.Msg)
+		m.SetQuestion("example.org.", dns.TypeA)
+		if _, _, _, err := p.Connect(context.Background(), request.Request{Req: m, W: &test.ResponseWriter{}}, proxy.Options{}); err != nil {
+			t.Fatal(err)
+		}
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+func TestFastest(t *testing.T) {
+	ps := newTimedProxies(t, 60*time.Millisecond, 0, 30*time.Millisecond)
+	slow, fast, medium := ps[0], ps[1], ps[2]
+
+	f := &fastest{}
+	first := map[*proxy.Proxy]int{}
+	for range 1000 {
+		list := f.List(ps)
+		if len(list) != 3 {
+			t.Fatalf("Expected %d upstreams, got %d", 3, len(list))
+		}
+		first[list[0]]++
+		if list[0] == fast && (list[1] != medium || list[2] != slow) {
+			t.Fatalf("Expected upstreams ordered by RTT, got %s %s %s", list[0].Addr(), list[1].Addr(), list[2].Addr())
+		}
+	}
+	if first[fast] < 900 {
+		t.Errorf("Expected the fastest upstream first in most lists, got %d/1000", first[fast])
+	}
+	if first[medium] == 0 || first[slow] == 0 {
+		t.Errorf("Expected slower upstreams to be explored, got %d and %d", first[medium], first[slow])
+	}
+	if ps[0] != slow {
+		t.Error("Expected the upstreams not to be reordered in place")
+	}
+}
+
+func TestP2C(t *testing.T) {
+	ps := newTimedProxies(t, 30*time.Millisecond, 0)
+	slow, fast := ps[0], ps[1]
+
+	p := &p2c{}
+	for range 100 {
+		if list := p.List(ps); list[0] != fast || list[1] != slow {
+			t.Fatalf("Expected the fastest upstream first, got %s", list[0].Addr())
+		}
+	}
+	if ps[0] != slow {
+		t.Error("Expected the upstreams not to be reordered in place")
+	}
+}
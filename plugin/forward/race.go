@@ -0,0 +1,151 @@
+package forward
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/pkg/ecs"
+	proxyPkg "github.com/coredns/coredns/plugin/pkg/proxy"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// raceResult is the outcome of a query to one of the upstreams in a race.
+type raceResult struct {
+	proxy *proxyPkg.Proxy
+	ret   *dns.Msg
+	err   error
+}
+
+// race sends the query in state to f.raceCount upstreams concurrently and replies with the first
+// acceptable reply. Each upstream is started f.raceDelay after the previous one, or as soon as the
+// previous one failed. Replies with a failover rcode are only used when no upstream did better.
+func (f *Forward) race(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, state request.Request, subnet *dns.EDNS0_SUBNET) (int, error) {
+	var proxies []*proxyPkg.Proxy
+	list := f.List()
+	for _, p := range list {
+		if len(proxies) == f.raceCount {
+			break
+		}
+		if !p.Down(f.maxfails) {
+			proxies = append(proxies, p)
+		}
+	}
+	if len(proxies) == 0 {
+		healthcheckBrokenCount.Add(1)
+		if f.failfastUnhealthyUpstreams {
+			return dns.RcodeServerFailure, ErrNoHealthy
+		}
+		// Assume healthcheck is completely broken and randomly select the upstreams to race.
+		proxies = (&random{}).List(list)
+		proxies = proxies[:min(f.raceCount, len(proxies))]
+	}
+
+	rctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	results := make(chan raceResult, len(proxies))
+	started, pending := 0, 0
+	var next time.Time // when the next upstream is started
+	start := func() {
+		p := proxies[started]
+		started++
+		pending++
+		next = time.Now().Add(f.raceDelay)
+		// Every upstream needs its own copy, the request's ID is changed while it is sent.
+		st := request.Request{W: state.W, Req: state.Req.Copy()}
+		go func() {
+			begin := time.Now()
+			ret, localAddr, upstreamProto, err := f.connect(rctx, p, st)
+			if len(f.tapPlugins) != 0 {
+				toDnstap(rctx, f, p.Addr(), localAddr, upstreamProto, st, ret, begin)
+			}
+			results <- raceResult{proxy: p, ret: ret, err: err}
+		}()
+	}
+
+	var (
+		fallback *raceResult
+		lastErr  error
+	)
+	start()
+	for pending > 0 {
+		if started < len(proxies) && f.raceDelay == 0 {
+			start()
+			continue
+		}
+		var hedge <-chan time.Time
+		if started < len(proxies) {
+			hedge = time.After(time.Until(next))
+		}
+
+		select {
+		case <-hedge:
+			start()
+		case <-rctx.Done():
+			pending = 0
+		case res := <-results:
+			pending--
+			switch err := f.check(state, subnet, res); {
+			case err == nil:
+				raceWinsCount.WithLabelValues(res.proxy.Addr()).Inc()
+				metadata.SetValueFunc(ctx, "forward/upstream", res.proxy.Addr)
+				cancel()
+				return f.reply(ctx, w, r, subnet, res.ret)
+			case errors.Is(err, proxyPkg.ErrInvalidRequest):
+				return dns.RcodeFormatError, err
+			case errors.Is(err, errFailover):
+				fallback = &res
+			default:
+				lastErr = err
+				if res.err != nil && rctx.Err() == nil && f.maxfails != 0 {
+					// Kick off health check to see if *our* upstream is broken.
+					res.proxy.Healthcheck()
+				}
+				if started < len(proxies) {
+					// Don't wait for the hedge delay when an upstream failed.
+					start()
+				}
+			}
+		}
+	}
+
+	if fallback != nil {
+		metadata.SetValueFunc(ctx, "forward/upstream", fallback.proxy.Addr)
+		return f.reply(ctx, w, r, subnet, fallback.ret)
+	}
+	if lastErr != nil {
+		return dns.RcodeServerFailure, lastErr
+	}
+	if err := rctx.Err(); err != nil {
+		return dns.RcodeServerFailure, err
+	}
+	return dns.RcodeServerFailure, ErrNoHealthy
+}
+
+// check returns nil if res is an acceptable reply to the query in state, errFailover if it has one of
+// the failover rcodes, or the reason it is not acceptable.
+func (f *Forward) check(state request.Request, subnet *dns.EDNS0_SUBNET, res raceResult) error {
+	if res.err != nil {
+		return res.err
+	}
+	if !state.Match(res.ret) {
+		return errWrongReply
+	}
+	if subnet != nil && !ecs.Match(subnet, res.ret) {
+		return ErrECSMismatch
+	}
+	if slices.Contains(f.failoverRcodes, res.ret.Rcode) {
+		return errFailover
+	}
+	return nil
+}
+
+var (
+	errFailover   = errors.New("reply has a failover rcode")
+	errWrongReply = errors.New("reply does not match the request")
+)
@@ -0,0 +1,108 @@
+package forward
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// newRaceServer returns a server that answers with rcode after delay, and counts the queries in calls.
+func newRaceServer(t *testing.T, delay time.Duration, rcode int, calls *atomic.Int32) string {
+	t.Helper()
+	s := dnstest.NewMultipleServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		calls.Add(1)
+		time.Sleep(delay)
+		ret := new(dns.Msg)
+		ret.SetRcode(r, rcode)
+		if rcode == dns.RcodeSuccess {
+			ret.Answer = append(ret.Answer, test.A("example.org. IN A 127.0.0.1"))
+		}
+		w.WriteMsg(ret)
+	})
+	t.Cleanup(s.Close)
+	return s.Addr
+}
+
+func TestRace(t *testing.T) {
+	tests := []struct {
+		name    string
+		slow    int // rcode of the slow upstream
+		fast    int // rcode of the fast upstream
+		options string
+		rcode   int
+		maxTime time.Duration
+	}{
+		{"fastest wins", dns.RcodeSuccess, dns.RcodeSuccess, "race 2", dns.RcodeSuccess, 250 * time.Millisecond},
+		{"failover rcode loses", dns.RcodeSuccess, dns.RcodeServerFailure, "race 2\nfailover SERVFAIL", dns.RcodeSuccess, time.Second},
+		{"all failover rcodes", dns.RcodeRefused, dns.RcodeServerFailure, "race 2\nfailover SERVFAIL REFUSED", dns.RcodeRefused, time.Second},
+		{"no failover", dns.RcodeSuccess, dns.RcodeServerFailure, "race 2", dns.RcodeServerFailure, 250 * time.Millisecond},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls atomic.Int32
+			slow := newRaceServer(t, 500*time.Millisecond, tc.slow, &calls)
+			fast := newRaceServer(t, 0, tc.fast, &calls)
+
+			c := caddy.NewTestController("dns", "forward . "+slow+" "+fast+" {\npolicy sequential\n"+tc.options+"\n}\n")
+			fs, err := parseForward(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := fs[0]
+			f.OnStartup()
+			defer f.OnShutdown()
+
+			m := new(dns.Msg)
+			m.SetQuestion("example.org.", dns.TypeA)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+			start := time.Now()
+			if _, err := f.ServeDNS(context.Background(), rec, m); err != nil {
+				t.Fatal(err)
+			}
+			if d := time.Since(start); d > tc.maxTime {
+				t.Errorf("Expected a reply within %s, took %s", tc.maxTime, d)
+			}
+			if rec.Msg.Rcode != tc.rcode {
+				t.Errorf("Expected rcode %s, got %s", dns.RcodeToString[tc.rcode], dns.RcodeToString[rec.Msg.Rcode])
+			}
+			if x := calls.Load(); x != 2 {
+				t.Errorf("Expected %d upstreams to be queried, got %d", 2, x)
+			}
+		})
+	}
+}
+
+func TestRaceHedge(t *testing.T) {
+	var calls atomic.Int32
+	first := newRaceServer(t, 10*time.Millisecond, dns.RcodeSuccess, &calls)
+	second := newRaceServer(t, 0, dns.RcodeSuccess, &calls)
+
+	c := caddy.NewTestController("dns", "forward . "+first+" "+second+" {\npolicy sequential\nrace 2 1s\n}\n")
+	fs, err := parseForward(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := fs[0]
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := f.ServeDNS(context.Background(), rec, m); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Msg.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected rcode %s, got %s", dns.RcodeToString[dns.RcodeSuccess], dns.RcodeToString[rec.Msg.Rcode])
+	}
+	if x := calls.Load(); x != 1 {
+		t.Errorf("Expected only the first upstream to be queried before the hedge delay, got %d queries", x)
+	}
+}
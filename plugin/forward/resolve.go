@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,7 +18,7 @@ import (
 type hostEntry struct {
 	hostname  string // the hostname to resolve (e.g., "rbldnsd.rbldnsd.svc.cluster.local")
 	port      string // port (e.g., "53", "443", "853")
-	transport string // "dns", "tls", or "https"
+	transport string // "dns", "tls", "https", "quic" or "https3"
 	zone      string // TLS server name zone (from %zone syntax)
 }
 
@@ -26,13 +27,34 @@ type toEntry struct {
 	static bool      // true for IP/file-based entries
 	addrs  []string  // for static: resolved by HostPortOrFile
 	entry  hostEntry // for dynamic: hostname to resolve
+	srv    bool      // for dynamic: entry.hostname is an SRV name listing the upstreams
 }
 
+// upstream is a resolved TO address. Upstreams discovered through SRV records carry the priority
+// and weight of their record.
+type upstream struct {
+	addr     string
+	srv      bool
+	priority uint16
+	weight   uint16
+}
+
+// srvPrefix is the prefix of TOs that are SRV names, e.g. srv://_dns._udp.example.com.
+const srvPrefix = "srv://"
+
 // classifyToAddrs processes TO addresses in order, returning an ordered list of
 // toEntries that preserves config ordering.
 func classifyToAddrs(toAddrs []string) ([]toEntry, error) {
 	var entries []toEntry
 	for _, h := range toAddrs {
+		if name, ok := strings.CutPrefix(h, srvPrefix); ok {
+			if _, ok := dns.IsDomainName(name); !ok || name == "" || net.ParseIP(name) != nil {
+				return nil, fmt.Errorf("not a valid SRV name: %q", h)
+			}
+			entries = append(entries, toEntry{static: false, srv: true, entry: hostEntry{hostname: name, transport: transport.DNS}})
+			continue
+		}
+
 		// Try HostPortOrFile first - this handles IPs and files
 		hosts, parseErr := parse.HostPortOrFile(h)
 		if parseErr == nil {
@@ -67,18 +89,19 @@ func parseAsHostEntry(h string) (hostEntry, bool) {
 	cleanH, zone := splitZone(h)
 	trans, host := parse.Transport(cleanH)
 
-	// Only dns, tls, and https transports are supported for hostname resolution
-	if trans != transport.DNS && trans != transport.TLS && trans != transport.HTTPS {
-		return hostEntry{}, false
-	}
-
 	hostname := host
-	port := transport.Port
+	var port string
 	switch trans {
+	case transport.DNS:
+		port = transport.Port
 	case transport.TLS:
 		port = transport.TLSPort
-	case transport.HTTPS:
+	case transport.QUIC:
+		port = transport.QUICPort
+	case transport.HTTPS, transport.HTTPS3:
 		port = transport.HTTPSPort
+	default:
+		return hostEntry{}, false
 	}
 
 	// Check if there's a port
@@ -107,34 +130,62 @@ func parseAsHostEntry(h string) (hostEntry, bool) {
 	}, true
 }
 
-// expandAndDedup resolves all toEntries in order, expands hostnames to IPs,
-// and deduplicates by first-seen address. Returns the deduplicated address list.
-func expandAndDedup(entries []toEntry, resolvers []string) ([]string, error) {
+// expandAndDedup resolves all toEntries in order, expands hostnames and SRV names to IPs,
+// and deduplicates by first-seen address. Returns the deduplicated upstreams and the lowest
+// TTL of the records used, 0 if there were none or their TTL is unknown.
+func expandAndDedup(entries []toEntry, resolvers []string) ([]upstream, uint32, error) {
 	seen := make(map[string]bool)
-	var result []string
+	var (
+		result []upstream
+		ttl    uint32
+	)
 
 	for _, e := range entries {
-		var addrs []string
-		if e.static {
-			addrs = e.addrs
-		} else {
-			resolved, err := resolveHostEntry(e.entry, resolvers)
+		var ups []upstream
+		switch {
+		case e.static:
+			for _, addr := range e.addrs {
+				ups = append(ups, upstream{addr: addr})
+			}
+		case e.srv:
+			resolved, t, err := resolveSRVEntry(e.entry, resolvers)
+			if err != nil {
+				return nil, 0, err
+			}
+			ups = resolved
+			ttl = minTTL(ttl, t)
+		default:
+			resolved, t, err := resolveHostEntry(e.entry, resolvers)
 			if err != nil {
-				return nil, err
+				return nil, 0, err
+			}
+			for _, addr := range resolved {
+				ups = append(ups, upstream{addr: addr})
 			}
-			addrs = resolved
+			ttl = minTTL(ttl, t)
 		}
 
-		for _, addr := range addrs {
+		for _, u := range ups {
 			// Normalize the address for dedup comparison
-			key := normalizeAddr(addr)
+			key := normalizeAddr(u.addr)
 			if !seen[key] {
 				seen[key] = true
-				result = append(result, addr)
+				result = append(result, u)
 			}
 		}
 	}
-	return result, nil
+	return result, ttl, nil
+}
+
+// minTTL returns the lowest of the TTLs a and b, where 0 means unknown.
+func minTTL(a, b uint32) uint32 {
+	if a == 0 {
+		return b
+	}
+	if b == 0 {
+		return a
+	}
+	return min(a, b)
 }
 
 // normalizeAddr extracts the canonical IP:port from an address string
@@ -145,17 +196,59 @@ func normalizeAddr(addr string) string {
 	return h
 }
 
-// resolveHostEntry resolves a single hostname entry and returns its addresses.
-func resolveHostEntry(entry hostEntry, resolvers []string) ([]string, error) {
-	ips, err := lookupHost(entry.hostname, resolvers)
+// resolveHostEntry resolves a single hostname entry and returns its addresses and TTL.
+func resolveHostEntry(entry hostEntry, resolvers []string) ([]string, uint32, error) {
+	ips, ttl, err := lookupHost(entry.hostname, resolvers)
 	if err != nil {
-		return nil, fmt.Errorf("failed to resolve %q: %v", entry.hostname, err)
+		return nil, 0, fmt.Errorf("failed to resolve %q: %v", entry.hostname, err)
 	}
 	var addrs []string
 	for _, ip := range ips {
 		addrs = append(addrs, formatResolvedAddr(ip, entry.port, entry.transport, entry.zone))
 	}
-	return addrs, nil
+	return addrs, ttl, nil
+}
+
+// resolveSRVEntry looks up the SRV records of an SRV entry and resolves their targets. It returns
+// an upstream for every address of every target and the lowest TTL of the records. Targets that
+// fail to resolve are skipped, as long as at least one address is found.
+func resolveSRVEntry(entry hostEntry, resolvers []string) ([]upstream, uint32, error) {
+	srvs, ttl, err := lookupSRV(entry.hostname, resolvers)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to resolve SRV %q: %v", entry.hostname, err)
+	}
+	var (
+		ups     []upstream
+		lastErr error
+	)
+	for _, srv := range srvs {
+		// A target of "." means the service is decidedly not available, RFC 2782.
+		if srv.Target == "." || srv.Target == "" {
+			continue
+		}
+		ips, t, err := lookupHost(srv.Target, resolvers)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		ttl = minTTL(ttl, t)
+		port := strconv.Itoa(int(srv.Port))
+		for _, ip := range ips {
+			ups = append(ups, upstream{
+				addr:     formatResolvedAddr(ip, port, entry.transport, entry.zone),
+				srv:      true,
+				priority: srv.Priority,
+				weight:   srv.Weight,
+			})
+		}
+	}
+	if len(ups) == 0 {
+		if lastErr != nil {
+			return nil, 0, fmt.Errorf("no addresses found for SRV %q: %v", entry.hostname, lastErr)
+		}
+		return nil, 0, fmt.Errorf("no addresses found for SRV %q", entry.hostname)
+	}
+	return ups, ttl, nil
 }
 
 // formatResolvedAddr formats a resolved IP into an address string compatible
@@ -164,7 +257,7 @@ func formatResolvedAddr(ip, port, trans, zone string) string {
 	isIPv6 := strings.Contains(ip, ":")
 
 	switch trans {
-	case transport.TLS, transport.HTTPS:
+	case transport.TLS, transport.HTTPS, transport.QUIC, transport.HTTPS3:
 		if zone != "" {
 			if isIPv6 {
 				return trans + "://[" + ip + "%" + zone + "]:" + port
@@ -179,9 +272,11 @@ func formatResolvedAddr(ip, port, trans, zone string) string {
 
 // lookupHost resolves a hostname to IP addresses using the specified resolvers.
 // If resolvers is empty, the system resolver (/etc/resolv.conf) is used.
-func lookupHost(hostname string, resolvers []string) ([]string, error) {
+// It also returns the lowest TTL of the records, or 0 if it is unknown.
+func lookupHost(hostname string, resolvers []string) ([]string, uint32, error) {
 	if len(resolvers) == 0 {
-		return systemLookup(hostname)
+		ips, err := systemLookup(hostname)
+		return ips, 0, err
 	}
 	return dnsLookup(hostname, resolvers)
 }
@@ -198,10 +293,70 @@ func systemLookup(hostname string) ([]string, error) {
 	return ips, nil
 }
 
+// lookupSRV returns the SRV records of name using the specified resolvers, or the system resolver
+// if resolvers is empty. It also returns the lowest TTL of the records, or 0 if it is unknown.
+func lookupSRV(name string, resolvers []string) ([]*dns.SRV, uint32, error) {
+	if len(resolvers) == 0 {
+		_, addrs, err := net.LookupSRV("", "", name)
+		if err != nil {
+			return nil, 0, err
+		}
+		srvs := make([]*dns.SRV, 0, len(addrs))
+		for _, a := range addrs {
+			srvs = append(srvs, &dns.SRV{Priority: a.Priority, Weight: a.Weight, Port: a.Port, Target: a.Target})
+		}
+		return srvs, 0, nil
+	}
+
+	c := new(dns.Client)
+	c.ReadTimeout = 2 * time.Second
+	c.WriteTimeout = 2 * time.Second
+
+	var lastErr error
+	for _, resolver := range resolvers {
+		m := new(dns.Msg)
+		m.SetQuestion(dns.Fqdn(name), dns.TypeSRV)
+		m.RecursionDesired = true
+
+		r, _, err := c.Exchange(m, resolverAddr(resolver))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		var (
+			srvs []*dns.SRV
+			ttl  uint32
+		)
+		for _, ans := range r.Answer {
+			if srv, ok := ans.(*dns.SRV); ok {
+				srvs = append(srvs, srv)
+				ttl = minTTL(ttl, srv.Hdr.Ttl)
+			}
+		}
+		if len(srvs) > 0 {
+			return srvs, ttl, nil
+		}
+	}
+
+	if lastErr != nil {
+		return nil, 0, fmt.Errorf("no SRV records found for %q: %v", name, lastErr)
+	}
+	return nil, 0, fmt.Errorf("no SRV records found for %q", name)
+}
+
+// resolverAddr returns the address of resolver, adding port 53 if it has none.
+func resolverAddr(resolver string) string {
+	if _, _, err := net.SplitHostPort(resolver); err != nil {
+		return net.JoinHostPort(resolver, transport.Port)
+	}
+	return resolver
+}
+
 // dnsLookup resolves a hostname using specific DNS resolver addresses.
 // Each resolver can be a bare IP (port 53 is assumed) or an IP:port pair.
-// It tries each resolver in order until one succeeds.
-func dnsLookup(hostname string, resolvers []string) ([]string, error) {
+// It tries each resolver in order until one succeeds, and returns the addresses
+// and the lowest TTL of the records found.
+func dnsLookup(hostname string, resolvers []string) ([]string, uint32, error) {
 	c := new(dns.Client)
 	c.ReadTimeout = 2 * time.Second
 	c.WriteTimeout = 2 * time.Second
@@ -209,18 +364,18 @@ func dnsLookup(hostname string, resolvers []string) ([]string, error) {
 	var lastErr error
 
 	for _, resolver := range resolvers {
-		resolverAddr := resolver
-		if _, _, err := net.SplitHostPort(resolver); err != nil {
-			resolverAddr = net.JoinHostPort(resolver, transport.Port)
-		}
-		var ips []string
+		addr := resolverAddr(resolver)
+		var (
+			ips []string
+			ttl uint32
+		)
 
 		// Try A records
 		m := new(dns.Msg)
 		m.SetQuestion(dns.Fqdn(hostname), dns.TypeA)
 		m.RecursionDesired = true
 
-		r, _, err := c.Exchange(m, resolverAddr)
+		r, _, err := c.Exchange(m, addr)
 		if err != nil {
 			lastErr = err
 			continue
@@ -229,6 +384,7 @@ func dnsLookup(hostname string, resolvers []string) ([]string, error) {
 			for _, ans := range r.Answer {
 				if a, ok := ans.(*dns.A); ok {
 					ips = append(ips, a.A.String())
+					ttl = minTTL(ttl, a.Hdr.Ttl)
 				}
 			}
 		}
@@ -238,10 +394,10 @@ func dnsLookup(hostname string, resolvers []string) ([]string, error) {
 		m.SetQuestion(dns.Fqdn(hostname), dns.TypeAAAA)
 		m.RecursionDesired = true
 
-		r, _, err = c.Exchange(m, resolverAddr)
+		r, _, err = c.Exchange(m, addr)
 		if err != nil {
 			if len(ips) > 0 {
-				return ips, nil // we have A records, AAAA failure is OK
+				return ips, ttl, nil // we have A records, AAAA failure is OK
 			}
 			lastErr = err
 			continue
@@ -250,17 +406,18 @@ func dnsLookup(hostname string, resolvers []string) ([]string, error) {
 			for _, ans := range r.Answer {
 				if aaaa, ok := ans.(*dns.AAAA); ok {
 					ips = append(ips, aaaa.AAAA.String())
+					ttl = minTTL(ttl, aaaa.Hdr.Ttl)
 				}
 			}
 		}
 
 		if len(ips) > 0 {
-			return ips, nil
+			return ips, ttl, nil
 		}
 	}
 
 	if lastErr != nil {
-		return nil, fmt.Errorf("no addresses found for %q: %v", hostname, lastErr)
+		return nil, 0, fmt.Errorf("no addresses found for %q: %v", hostname, lastErr)
 	}
-	return nil, fmt.Errorf("no addresses found for %q", hostname)
+	return nil, 0, fmt.Errorf("no addresses found for %q", hostname)
 }
@@ -95,6 +95,18 @@ func TestClassifyToAddrs(t *testing.T) {
 			wantStatic:  2,
 			wantDynamic: 1,
 		},
+		{
+			name:        "SRV name",
+			input:       []string{"srv://_dns._udp.example.com", "10.0.0.1"},
+			wantStatic:  1,
+			wantDynamic: 1,
+		},
+		{
+			name:        "invalid SRV name",
+			input:       []string{"srv://10.0.0.1"},
+			wantErr:     true,
+			errContains: "not a valid SRV name",
+		},
 		{
 			name:        "an existing file not empty but without nameserver is skipped",
 			input:       []string{commentedResolv},
@@ -174,6 +186,9 @@ func TestParseAsHostEntry(t *testing.T) {
 		{"https://dns.example.com", true, "dns.example.com", "443", transport.HTTPS, ""},
 		{"https://dns.example.com:8443", true, "dns.example.com", "8443", transport.HTTPS, ""},
 		{"https://dns.example.com%servername.example.com", true, "dns.example.com", "443", transport.HTTPS, "servername.example.com"},
+		{"quic://dns.example.com", true, "dns.example.com", "853", transport.QUIC, ""},
+		{"quic://dns.example.com%servername.example.com:8853", true, "dns.example.com", "8853", transport.QUIC, "servername.example.com"},
+		{"https3://dns.example.com", true, "dns.example.com", "443", transport.HTTPS3, ""},
 		{"rbldnsd.rbldnsd.svc.cluster.local", true, "rbldnsd.rbldnsd.svc.cluster.local", "53", transport.DNS, ""},
 		// Should fail for IPs
 		{"127.0.0.1", false, "", "", "", ""},
@@ -224,6 +239,8 @@ func TestFormatResolvedAddr(t *testing.T) {
 		{"::1", "853", transport.TLS, "example.com", "tls://[::1%example.com]:853"},
 		{"::1", "443", transport.HTTPS, "", "https://[::1]:443"},
 		{"::1", "443", transport.HTTPS, "example.com", "https://[::1%example.com]:443"},
+		{"10.0.0.1", "853", transport.QUIC, "example.com", "quic://10.0.0.1%example.com:853"},
+		{"::1", "443", transport.HTTPS3, "", "https3://[::1]:443"},
 	}
 
 	for _, tc := range tests {
@@ -267,7 +284,7 @@ func TestExpandAndDedup(t *testing.T) {
 		{static: true, addrs: []string{"10.0.0.2:53"}},
 	}
 
-	result, err := expandAndDedup(entries, []string{s.Addr})
+	result, _, err := expandAndDedup(entries, []string{s.Addr})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -277,8 +294,8 @@ func TestExpandAndDedup(t *testing.T) {
 	if len(result) != len(expected) {
 		t.Fatalf("expected %d addresses, got %d: %v", len(expected), len(result), result)
 	}
-	for i, addr := range result {
-		normalized := normalizeAddr(addr)
+	for i, u := range result {
+		normalized := normalizeAddr(u.addr)
 		if normalized != expected[i] {
 			t.Errorf("position %d: expected %s, got %s", i, expected[i], normalized)
 		}
@@ -304,7 +321,7 @@ func TestExpandAndDedupOrderPreserved(t *testing.T) {
 		{static: true, addrs: []string{"192.168.1.1:53"}},
 	}
 
-	result, err := expandAndDedup(entries, []string{s.Addr})
+	result, _, err := expandAndDedup(entries, []string{s.Addr})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -313,11 +330,11 @@ func TestExpandAndDedupOrderPreserved(t *testing.T) {
 	if len(result) != 2 {
 		t.Fatalf("expected 2 addresses, got %d: %v", len(result), result)
 	}
-	if normalizeAddr(result[0]) != "10.0.0.42:53" {
-		t.Errorf("expected first addr 10.0.0.42:53, got %s", normalizeAddr(result[0]))
+	if normalizeAddr(result[0].addr) != "10.0.0.42:53" {
+		t.Errorf("expected first addr 10.0.0.42:53, got %s", normalizeAddr(result[0].addr))
 	}
-	if normalizeAddr(result[1]) != "192.168.1.1:53" {
-		t.Errorf("expected second addr 192.168.1.1:53, got %s", normalizeAddr(result[1]))
+	if normalizeAddr(result[1].addr) != "192.168.1.1:53" {
+		t.Errorf("expected second addr 192.168.1.1:53, got %s", normalizeAddr(result[1].addr))
 	}
 }
 
@@ -334,7 +351,7 @@ func TestDnsLookup(t *testing.T) {
 	defer s.Close()
 
 	// Use the full server address (IP:port) since the test server uses a random port
-	ips, err := dnsLookup("myhost.example.com", []string{s.Addr})
+	ips, _, err := dnsLookup("myhost.example.com", []string{s.Addr})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -430,7 +447,7 @@ func TestSetupWithHostnameTO(t *testing.T) {
 
 	// Test resolving a hostname entry directly
 	entry := hostEntry{hostname: "myupstream.example.com", port: "53", transport: "dns"}
-	addrs, err := resolveHostEntry(entry, []string{s.Addr})
+	addrs, _, err := resolveHostEntry(entry, []string{s.Addr})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -449,13 +466,13 @@ func TestSetupWithHostnameTO(t *testing.T) {
 		{static: false, entry: entry},
 	}
 
-	resolvedAddrs, err := expandAndDedup(f.toEntries, f.resolver)
+	resolvedAddrs, _, err := expandAndDedup(f.toEntries, f.resolver)
 	if err != nil {
 		t.Fatalf("resolution failed: %v", err)
 	}
 
-	for _, addr := range resolvedAddrs {
-		host, _ := splitZone(addr)
+	for _, u := range resolvedAddrs {
+		host, _ := splitZone(u.addr)
 		trans, h := parse.Transport(host)
 		p := proxy.NewProxy("forward", h, trans)
 		f.proxies = append(f.proxies, p)
@@ -490,13 +507,13 @@ func TestSetupMixedIPAndHostnameTO(t *testing.T) {
 		{static: true, addrs: []string{"127.0.0.1:53"}},
 	}
 
-	resolvedAddrs, err := expandAndDedup(f.toEntries, f.resolver)
+	resolvedAddrs, _, err := expandAndDedup(f.toEntries, f.resolver)
 	if err != nil {
 		t.Fatalf("expand error: %v", err)
 	}
 
-	for _, addr := range resolvedAddrs {
-		host, _ := splitZone(addr)
+	for _, u := range resolvedAddrs {
+		host, _ := splitZone(u.addr)
 		trans, h := parse.Transport(host)
 		p := proxy.NewProxy("forward", h, trans)
 		f.proxies = append(f.proxies, p)
@@ -594,7 +611,7 @@ func TestExpandAndDedupTLS(t *testing.T) {
 		{static: true, addrs: []string{"https://9.9.9.10:443"}},
 	}
 
-	result, err := expandAndDedup(entries, []string{s.Addr})
+	result, _, err := expandAndDedup(entries, []string{s.Addr})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -603,9 +620,9 @@ func TestExpandAndDedupTLS(t *testing.T) {
 	if len(result) != len(expected) {
 		t.Fatalf("expected %d addresses after dedup, got %d: %v", len(expected), len(result), result)
 	}
-	for i, addr := range result {
-		if normalizeAddr(addr) != expected[i] {
-			t.Errorf("position %d: expected %s, got %s", i, expected[i], normalizeAddr(addr))
+	for i, u := range result {
+		if normalizeAddr(u.addr) != expected[i] {
+			t.Errorf("position %d: expected %s, got %s", i, expected[i], normalizeAddr(u.addr))
 		}
 	}
 }
@@ -15,12 +15,14 @@ import (
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/dnstap"
+	"github.com/coredns/coredns/plugin/pkg/ecs"
 	"github.com/coredns/coredns/plugin/pkg/parse"
 	"github.com/coredns/coredns/plugin/pkg/proxy"
 	pkgtls "github.com/coredns/coredns/plugin/pkg/tls"
 	"github.com/coredns/coredns/plugin/pkg/transport"
 
 	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go/http3"
 )
 
 func init() {
@@ -71,16 +73,31 @@ func setup(c *caddy.Controller) error {
 	return nil
 }
 
-// OnStartup starts a goroutines for all proxies.
+// OnStartup starts a goroutines for all proxies, and one to re-resolve the hostname and SRV TOs.
 func (f *Forward) OnStartup() (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stopped = false
 	for _, p := range f.proxies {
 		p.Start(f.hcInterval)
 	}
+	if f.dynamic() {
+		f.stop = make(chan struct{})
+		go f.refreshLoop(f.stop)
+	}
 	return nil
 }
 
-// OnShutdown stops all configured proxies.
+// OnShutdown stops all configured proxies. Proxies that are added by a refresh that is still running
+// are stopped by the refresh.
 func (f *Forward) OnShutdown() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stop != nil {
+		close(f.stop)
+		f.stop = nil
+	}
+	f.stopped = true
 	for _, p := range f.proxies {
 		p.Stop()
 	}
@@ -162,7 +179,7 @@ func parseStanza(c *caddy.Controller) (*Forward, error) {
 	// Reject HTTPS upstreams that include a path, the doh implementation default to /dns-query path.
 	for _, addr := range to {
 		trans, h := parse.Transport(addr)
-		if trans == transport.HTTPS && strings.Contains(h, "/") {
+		if (trans == transport.HTTPS || trans == transport.HTTPS3) && strings.Contains(h, "/") {
 			return f, fmt.Errorf("paths are not allowed in HTTPS upstream addresses (the /dns-query path is used by default): %s", addr)
 		}
 	}
@@ -175,39 +192,34 @@ func parseStanza(c *caddy.Controller) (*Forward, error) {
 	f.toEntries = entries
 
 	// Expand hostnames and deduplicate globally (first-seen order wins).
-	toHosts, err := expandAndDedup(f.toEntries, f.resolver)
+	ups, ttl, err := expandAndDedup(f.toEntries, f.resolver)
 	if err != nil {
 		return f, err
 	}
-	if len(toHosts) == 0 {
+	if len(ups) == 0 {
 		return f, fmt.Errorf("no valid upstream addresses found")
 	}
+	f.ttl = ttl
 
-	tlsServerNames := make([]string, len(toHosts))
 	perServerNameProxyCount := make(map[string]int)
-	transports := make([]string, len(toHosts))
-	allowedTrans := map[string]bool{"dns": true, "tls": true, "https": true}
-	for i, hostWithZone := range toHosts {
-		host, serverName := splitZone(hostWithZone)
-		trans, h := parse.Transport(host)
+	allowedTrans := map[string]bool{"dns": true, "tls": true, "https": true, "quic": true, "https3": true}
+	for _, u := range ups {
+		host, serverName := splitZone(u.addr)
+		trans, _ := parse.Transport(host)
 
 		if !allowedTrans[trans] {
 			return f, fmt.Errorf("'%s' is not supported as a destination protocol in forward: %s", trans, host)
 		}
-		if trans == transport.TLS && serverName != "" {
+		if (trans == transport.TLS || trans == transport.QUIC) && serverName != "" {
 			if f.tlsServerName != "" {
 				return f, fmt.Errorf("both forward ('%s') and proxy level ('%s') TLS servernames are set for upstream proxy '%s'", f.tlsServerName, serverName, host)
 			}
 
-			tlsServerNames[i] = serverName
 			perServerNameProxyCount[serverName]++
 		}
-		p := proxy.NewProxy("forward", h, trans)
-		f.proxies = append(f.proxies, p)
-		transports[i] = trans
 	}
 
-	perServerNameTlsConfig := make(map[string]*tls.Config)
+	f.perServerNameTLSConfig = make(map[string]*tls.Config)
 	if f.tlsServerName != "" {
 		f.tlsConfig.ServerName = f.tlsServerName
 	} else {
@@ -215,53 +227,73 @@ func parseStanza(c *caddy.Controller) (*Forward, error) {
 			tlsConfig := f.tlsConfig.Clone()
 			tlsConfig.ServerName = serverName
 			tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(proxyCount)
-			perServerNameTlsConfig[serverName] = tlsConfig
+			f.perServerNameTLSConfig[serverName] = tlsConfig
 		}
 	}
 
 	// Initialize ClientSessionCache in tls.Config. This may speed up a TLS handshake
 	// in upcoming connections to the same TLS server.
-	f.tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(len(f.proxies))
+	f.tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(len(ups))
 
-	for i := range f.proxies {
-		if transports[i] == transport.HTTPS {
-			httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+	for _, u := range ups {
+		f.proxies = append(f.proxies, f.newProxy(u.addr))
+	}
+	f.setUpstreams(ups)
 
-			c := http.Client{
-				Transport: httpTransport,
-				Timeout:   2 * time.Second,
-			}
-			f.proxies[i].SetHTTPClient(&c)
-			f.proxies[i].SetTLSConfig(f.tlsConfig)
-			f.proxies[i].SetDOHRequestOptions(f.dohMethod)
-		}
+	return f, nil
+}
 
-		// Only set this for proxies that need it.
-		if transports[i] == transport.TLS {
-			if tlsConfig, ok := perServerNameTlsConfig[tlsServerNames[i]]; ok {
-				f.proxies[i].SetTLSConfig(tlsConfig)
-			} else {
-				f.proxies[i].SetTLSConfig(f.tlsConfig)
-			}
-		}
+// newProxy returns a proxy for the upstream addr, configured with the options of f.
+func (f *Forward) newProxy(addr string) *proxy.Proxy {
+	host, serverName := splitZone(addr)
+	trans, h := parse.Transport(host)
+	p := proxy.NewProxy("forward", h, trans)
+
+	if trans == transport.HTTPS {
+		httpTransport := http.DefaultTransport.(*http.Transport).Clone()
 
-		f.proxies[i].SetExpire(f.expire)
-		f.proxies[i].SetMaxAge(f.maxAge)
-		f.proxies[i].SetMaxIdleConns(f.maxIdleConns)
-		f.proxies[i].SetReadTimeout(f.readTimeout)
-		f.proxies[i].GetHealthchecker().SetRecursionDesired(f.opts.HCRecursionDesired)
-		// when TLS is used, checks are set to tcp-tls
-		if f.opts.ForceTCP && transports[i] != transport.TLS {
-			f.proxies[i].GetHealthchecker().SetTCPTransport()
+		c := http.Client{
+			Transport: httpTransport,
+			Timeout:   2 * time.Second,
 		}
-		f.proxies[i].GetHealthchecker().SetDomain(f.opts.HCDomain)
-		if f.sourceAddress != nil {
-			f.proxies[i].SetLocalAddress(f.sourceAddress)
-			f.proxies[i].GetHealthchecker().SetLocalAddress(f.sourceAddress)
+		p.SetHTTPClient(&c)
+		p.SetTLSConfig(f.tlsConfig)
+		p.SetDOHRequestOptions(f.dohMethod)
+	}
+	if trans == transport.HTTPS3 {
+		c := http.Client{
+			Transport: &http3.Transport{},
+			Timeout:   2 * time.Second,
+		}
+		p.SetHTTPClient(&c)
+		p.SetTLSConfig(f.tlsConfig)
+		p.SetDOHRequestOptions(f.dohMethod)
+	}
+
+	// Only set this for proxies that need it.
+	if trans == transport.TLS || trans == transport.QUIC {
+		if tlsConfig, ok := f.perServerNameTLSConfig[serverName]; ok {
+			p.SetTLSConfig(tlsConfig)
+		} else {
+			p.SetTLSConfig(f.tlsConfig)
 		}
 	}
 
-	return f, nil
+	p.SetExpire(f.expire)
+	p.SetMaxAge(f.maxAge)
+	p.SetMaxIdleConns(f.maxIdleConns)
+	p.SetReadTimeout(f.readTimeout)
+	p.GetHealthchecker().SetRecursionDesired(f.opts.HCRecursionDesired)
+	// when TLS is used, checks are set to tcp-tls
+	if f.opts.ForceTCP && trans != transport.TLS {
+		p.GetHealthchecker().SetTCPTransport()
+	}
+	p.GetHealthchecker().SetDomain(f.opts.HCDomain)
+	if f.sourceAddress != nil {
+		p.SetLocalAddress(f.sourceAddress)
+		p.GetHealthchecker().SetLocalAddress(f.sourceAddress)
+	}
+	return p
 }
 
 func parseBlock(c *caddy.Controller, f *Forward) error {
@@ -426,6 +458,10 @@ func parseBlock(c *caddy.Controller, f *Forward) error {
 			f.p = &roundRobin{}
 		case "sequential":
 			f.p = &sequential{}
+		case "fastest":
+			f.p = &fastest{}
+		case "p2c":
+			f.p = &p2c{}
 		default:
 			return c.Errf("unknown policy '%s'", x)
 		}
@@ -502,6 +538,52 @@ func parseBlock(c *caddy.Controller, f *Forward) error {
 			}
 		}
 		f.resolver = args
+	case "ecs":
+		args := c.RemainingArgs()
+		if len(args) > 2 {
+			return c.ArgErr()
+		}
+		f.ecs = true
+		f.ecsV4, f.ecsV6 = ecs.DefaultIPv4, ecs.DefaultIPv6
+		var err error
+		if len(args) > 0 {
+			if f.ecsV4, err = parsePrefixLength(args[0], 32); err != nil {
+				return c.Err(err.Error())
+			}
+		}
+		if len(args) > 1 {
+			if f.ecsV6, err = parsePrefixLength(args[1], 128); err != nil {
+				return c.Err(err.Error())
+			}
+		}
+	case "ecs_except":
+		except := c.RemainingArgs()
+		if len(except) == 0 {
+			return c.ArgErr()
+		}
+		for i := range except {
+			f.ecsExcept = append(f.ecsExcept, plugin.Host(except[i]).NormalizeExact()...)
+		}
+	case "race":
+		args := c.RemainingArgs()
+		if len(args) == 0 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 2 {
+			return c.Errf("race count must be at least 2: %s", args[0])
+		}
+		f.raceCount = n
+		if len(args) > 1 {
+			d, err := time.ParseDuration(args[1])
+			if err != nil {
+				return err
+			}
+			if d < 0 {
+				return c.Errf("race delay can't be negative: %s", d)
+			}
+			f.raceDelay = d
+		}
 	case "source_address":
 		if !c.NextArg() {
 			return c.ArgErr()
@@ -518,4 +600,13 @@ func parseBlock(c *caddy.Controller, f *Forward) error {
 	return nil
 }
 
+// parsePrefixLength parses a source prefix length of at most bits.
+func parsePrefixLength(s string, bits uint64) (uint8, error) {
+	n, err := strconv.ParseUint(s, 10, 8)
+	if err != nil || n > bits {
+		return 0, fmt.Errorf("invalid ecs prefix length: %s", s)
+	}
+	return uint8(n), nil
+}
+
 const max = 15 // Maximum number of upstreams.
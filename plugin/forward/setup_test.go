@@ -48,8 +48,13 @@ func TestSetup(t *testing.T) {
 		forward com ::2`, false, ".", nil, 2, proxy.Options{HCRecursionDesired: true, HCDomain: "."}, "plugin"},
 		{"forward . tls://[2400:3200::1%dns.alidns.com]:853 {\ntls\n}\n", false, ".", nil, 2, proxy.Options{HCRecursionDesired: true, HCDomain: "."}, ""},
 		{"forward . https://127.0.0.1 \n", false, ".", nil, 2, proxy.Options{HCRecursionDesired: true, HCDomain: "."}, ""},
+		{"forward . quic://127.0.0.1 \n", false, ".", nil, 2, proxy.Options{HCRecursionDesired: true, HCDomain: "."}, ""},
+		{"forward . quic://127.0.0.1%dns.example.org:8853 \n", false, ".", nil, 2, proxy.Options{HCRecursionDesired: true, HCDomain: "."}, ""},
+		{"forward . https3://127.0.0.1 \n", false, ".", nil, 2, proxy.Options{HCRecursionDesired: true, HCDomain: "."}, ""},
 		// negative
 		{"forward . https://1.1.1.1/ \n", true, "", nil, 0, proxy.Options{HCRecursionDesired: true, HCDomain: "."}, "paths are not allowed in HTTPS upstream addresses"},
+		{"forward . https3://1.1.1.1/ \n", true, "", nil, 0, proxy.Options{HCRecursionDesired: true, HCDomain: "."}, "paths are not allowed in HTTPS upstream addresses"},
+		{"forward . grpc://1.1.1.1 \n", true, "", nil, 0, proxy.Options{HCRecursionDesired: true, HCDomain: "."}, "not supported as a destination protocol"},
 		{"forward . a27.0.0.1", true, "", nil, 0, proxy.Options{HCRecursionDesired: true, HCDomain: "."}, "failed to resolve"},
 		{"forward . 127.0.0.1 {\nblaatl\n}\n", true, "", nil, 0, proxy.Options{HCRecursionDesired: true, HCDomain: "."}, "unknown property"},
 		{"forward . 127.0.0.1 {\nhealth_check 0.5s domain\n}\n", true, "", nil, 0, proxy.Options{HCRecursionDesired: true, HCDomain: "."}, "Wrong argument count or unexpected line ending after 'domain'"},
@@ -953,3 +958,77 @@ func TestSetupDOHHealthcheckTLSConfig(t *testing.T) {
 		)
 	}
 }
+
+func TestSetupECS(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		ecs       bool
+		v4, v6    uint8
+		except    int
+	}{
+		{"forward . 127.0.0.1\n", false, false, 0, 0, 0},
+		{"forward . 127.0.0.1 {\necs\n}\n", false, true, 24, 56, 0},
+		{"forward . 127.0.0.1 {\necs 20\n}\n", false, true, 20, 56, 0},
+		{"forward . 127.0.0.1 {\necs 0 48\necs_except example.org example.net\n}\n", false, true, 0, 48, 2},
+		// fails
+		{"forward . 127.0.0.1 {\necs 33\n}\n", true, false, 0, 0, 0},
+		{"forward . 127.0.0.1 {\necs 24 129\n}\n", true, false, 0, 0, 0},
+		{"forward . 127.0.0.1 {\necs 24 56 1\n}\n", true, false, 0, 0, 0},
+		{"forward . 127.0.0.1 {\necs x\n}\n", true, false, 0, 0, 0},
+		{"forward . 127.0.0.1 {\necs_except\n}\n", true, false, 0, 0, 0},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		fs, err := parseForward(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error but found none for input %s", i, tc.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error but found one for input %s: %v", i, tc.input, err)
+			continue
+		}
+		f := fs[0]
+		if f.ecs != tc.ecs || f.ecsV4 != tc.v4 || f.ecsV6 != tc.v6 || len(f.ecsExcept) != tc.except {
+			t.Errorf("Test %d: expected ecs %t %d/%d with %d exceptions, got %t %d/%d with %d", i, tc.ecs, tc.v4, tc.v6, tc.except, f.ecs, f.ecsV4, f.ecsV6, len(f.ecsExcept))
+		}
+	}
+}
+
+func TestSetupRace(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		count     int
+		delay     time.Duration
+	}{
+		{"forward . 127.0.0.1 127.0.0.2 {\nrace 2\n}\n", false, 2, 0},
+		{"forward . 127.0.0.1 127.0.0.2 {\nrace 3 50ms\n}\n", false, 3, 50 * time.Millisecond},
+		// fails
+		{"forward . 127.0.0.1 {\nrace\n}\n", true, 0, 0},
+		{"forward . 127.0.0.1 {\nrace 1\n}\n", true, 0, 0},
+		{"forward . 127.0.0.1 {\nrace 2 -1s\n}\n", true, 0, 0},
+		{"forward . 127.0.0.1 {\nrace 2 x\n}\n", true, 0, 0},
+		{"forward . 127.0.0.1 {\nrace 2 1s 3\n}\n", true, 0, 0},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		fs, err := parseForward(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error but found none for input %s", i, tc.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error but found one for input %s: %v", i, tc.input, err)
+			continue
+		}
+		if f := fs[0]; f.raceCount != tc.count || f.raceDelay != tc.delay {
+			t.Errorf("Test %d: expected race %d %s, got %d %s", i, tc.count, tc.delay, f.raceCount, f.raceDelay)
+		}
+	}
+}
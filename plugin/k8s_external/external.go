@@ -6,7 +6,8 @@ differently). We support A, AAAA and SRV request, for all other types we return
 NXDOMAIN depending on the state of the cluster.
 
 A plugin willing to provide these services must implement the Externaler interface, although it
-likely only makes sense for the *kubernetes* plugin.
+likely only makes sense for the *kubernetes* plugin. To also answer for the host names of Ingresses
+and Gateway API routes, it must implement the Router interface.
 */
 package external
 
@@ -35,6 +36,18 @@ type Externaler interface {
 	ExternalSerial(string) uint32
 }
 
+// Router defines the interface that a plugin should implement in order to be used by External for the host
+// names of Ingresses and Gateway API routes.
+type Router interface {
+	// WatchRoutes starts watching Ingresses and or Gateway API objects. It is called before the plugin starts.
+	WatchRoutes(ingress, gateway bool) error
+	// ExternalRoutes returns the addresses for name as a slice of msg.Services.
+	ExternalRoutes(name string) []msg.Service
+	// ExternalRouteServices returns the addresses of all host names in the given zone as a slice of msg.Service,
+	// the host name is in the key.
+	ExternalRouteServices(zone string) []msg.Service
+}
+
 // External serves records for External IPs and Loadbalance IPs of Services in Kubernetes clusters.
 type External struct {
 	Next  plugin.Handler
@@ -45,6 +58,8 @@ type External struct {
 	apex       string
 	ttl        uint32
 	headless   bool
+	ingress    bool
+	gateway    bool
 
 	upstream *upstream.Upstream
 
@@ -52,6 +67,8 @@ type External struct {
 	externalAddrFunc     func(request.Request, bool) []dns.RR
 	externalSerialFunc   func(string) uint32
 	externalServicesFunc func(string, bool) ([]msg.Service, map[string][]msg.Service)
+	routesFunc           func(string) []msg.Service
+	routeServicesFunc    func(string) []msg.Service
 }
 
 // New returns a new and initialized *External.
@@ -83,6 +100,12 @@ func (e *External) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Ms
 		}
 	}
 
+	if e.routesFunc != nil {
+		if svc := e.routesFunc(state.Name()); len(svc) > 0 {
+			return e.serveRoute(ctx, w, state, svc)
+		}
+	}
+
 	svc, rcode := e.externalFunc(state, e.headless)
 
 	m := new(dns.Msg)
@@ -122,5 +145,25 @@ func (e *External) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Ms
 	return 0, nil
 }
 
+// serveRoute answers for the host name of an Ingress or Gateway API route, which only has address records.
+func (e *External) serveRoute(ctx context.Context, w dns.ResponseWriter, state request.Request, svc []msg.Service) (int, error) {
+	m := new(dns.Msg)
+	m.SetReply(state.Req)
+	m.Authoritative = true
+
+	switch state.QType() {
+	case dns.TypeA:
+		m.Answer, m.Truncated = e.a(ctx, svc, state)
+	case dns.TypeAAAA:
+		m.Answer, m.Truncated = e.aaaa(ctx, svc, state)
+	}
+	if len(m.Answer) == 0 {
+		m.Ns = []dns.RR{e.soa(state)}
+	}
+
+	w.WriteMsg(m)
+	return 0, nil
+}
+
 // Name implements the Handler interface.
 func (e *External) Name() string { return "k8s_external" }
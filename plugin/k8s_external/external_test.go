@@ -4,6 +4,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/coredns/coredns/plugin/etcd/msg"
 	"github.com/coredns/coredns/plugin/kubernetes"
 	"github.com/coredns/coredns/plugin/kubernetes/object"
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
@@ -431,3 +432,61 @@ func externalAddress(_state request.Request, _headless bool) []dns.RR {
 func externalSerial(string) uint32 {
 	return 1499347823
 }
+
+func TestExternalRoutes(t *testing.T) {
+	k := kubernetes.New([]string{"cluster.local."})
+	k.Namespaces = map[string]struct{}{"testns": {}}
+	k.APIConn = &external{}
+
+	e := New()
+	e.Zones = []string{"example.com."}
+	e.Next = test.NextHandler(dns.RcodeSuccess, nil)
+	e.externalFunc = k.External
+	e.externalAddrFunc = externalAddress
+	e.externalSerialFunc = externalSerial
+	e.routesFunc = func(name string) []msg.Service {
+		switch name {
+		case "app.example.com.":
+			return []msg.Service{{Host: "5.6.7.8", TTL: 5}, {Host: "5:6::8", TTL: 5}}
+		case "svc1.testns.example.com.":
+			return []msg.Service{{Host: "5.6.7.9", TTL: 5}}
+		}
+		return nil
+	}
+
+	for i, tc := range []test.Case{
+		{
+			Qname: "app.example.com.", Qtype: dns.TypeA,
+			Answer: []dns.RR{test.A("app.example.com.	5	IN	A	5.6.7.8")},
+		},
+		{
+			Qname: "app.example.com.", Qtype: dns.TypeAAAA,
+			Answer: []dns.RR{test.AAAA("app.example.com.	5	IN	AAAA	5:6::8")},
+		},
+		{
+			Qname: "app.example.com.", Qtype: dns.TypeSRV,
+			Ns: []dns.RR{test.SOA("example.com.	5	IN	SOA	ns1.dns.example.com. hostmaster.example.com. 1499347823 7200 1800 86400 5")},
+		},
+		// The host name of a route is served before a service with the same name.
+		{
+			Qname: "svc1.testns.example.com.", Qtype: dns.TypeA,
+			Answer: []dns.RR{test.A("svc1.testns.example.com.	5	IN	A	5.6.7.9")},
+		},
+		{
+			Qname: "svc6.testns.example.com.", Qtype: dns.TypeAAAA,
+			Answer: []dns.RR{test.AAAA("svc6.testns.example.com.	5	IN	AAAA	1:2::5")},
+		},
+		{
+			Qname: "nx.example.com.", Qtype: dns.TypeA, Rcode: dns.RcodeNameError,
+			Ns: []dns.RR{test.SOA("example.com.	5	IN	SOA	ns1.dns.example.com. hostmaster.example.com. 1499347823 7200 1800 86400 5")},
+		},
+	} {
+		w := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := e.ServeDNS(context.TODO(), w, tc.Msg()); err != nil {
+			t.Fatalf("Test %d: expected no error, got %v", i, err)
+		}
+		if err := test.SortAndCheck(w.Msg, tc); err != nil {
+			t.Errorf("Test %d: %v", i, err)
+		}
+	}
+}
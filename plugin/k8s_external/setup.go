@@ -36,6 +36,19 @@ func setup(c *caddy.Controller) error {
 		e.externalAddrFunc = x.ExternalAddress
 		e.externalServicesFunc = x.ExternalServices
 		e.externalSerialFunc = x.ExternalSerial
+
+		if !e.ingress && !e.gateway {
+			return nil
+		}
+		r, ok := m.(Router)
+		if !ok {
+			return plugin.Error(pluginName, errors.New("kubernetes plugin does not implement the Router interface"))
+		}
+		if err := r.WatchRoutes(e.ingress, e.gateway); err != nil {
+			return plugin.Error(pluginName, err)
+		}
+		e.routesFunc = r.ExternalRoutes
+		e.routeServicesFunc = r.ExternalRouteServices
 		return nil
 	})
 
@@ -77,6 +90,16 @@ func parse(c *caddy.Controller) (*External, error) {
 				e.apex = args[0]
 			case "headless":
 				e.headless = true
+			case "ingress":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				e.ingress = true
+			case "gateway":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				e.gateway = true
 			case "fallthrough":
 				e.Fall.SetZonesFromArgs(c.RemainingArgs())
 			default:
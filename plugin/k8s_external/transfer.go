@@ -134,6 +134,20 @@ func (e *External) Transfer(zone string, serial uint32) (<-chan []dns.RR, error)
 				ch <- recs
 			}
 		}
+		if e.routeServicesFunc != nil {
+			for _, s := range e.routeServicesFunc(zone) {
+				// Add the A/AAAA records of host names of Ingresses and routes
+				state := request.Request{Req: &dns.Msg{Question: []dns.Question{{Name: msg.Domain(s.Key)}}}}
+				as, _ := e.a(ctx, []msg.Service{s}, state)
+				if len(as) > 0 {
+					ch <- as
+				}
+				aaaas, _ := e.aaaa(ctx, []msg.Service{s}, state)
+				if len(aaaas) > 0 {
+					ch <- aaaas
+				}
+			}
+		}
 		ch <- []dns.RR{soa}
 		close(ch)
 	}()
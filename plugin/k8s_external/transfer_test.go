@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/etcd/msg"
 	"github.com/coredns/coredns/plugin/kubernetes"
 	"github.com/coredns/coredns/plugin/test"
 	"github.com/coredns/coredns/plugin/transfer"
@@ -145,3 +146,41 @@ func difference(testRRs []dns.RR, gotRRs []dns.RR) []dns.RR {
 	}
 	return foundRRs
 }
+
+func TestTransferAXFRRoutes(t *testing.T) {
+	k := kubernetes.New([]string{"cluster.local."})
+	k.Namespaces = map[string]struct{}{"testns": {}}
+	k.APIConn = &external{}
+
+	e := New()
+	e.Zones = []string{"example.com."}
+	e.externalFunc = k.External
+	e.externalAddrFunc = externalAddress
+	e.externalSerialFunc = externalSerial
+	e.externalServicesFunc = k.ExternalServices
+	e.routeServicesFunc = func(zone string) []msg.Service {
+		return []msg.Service{
+			{Host: "5.6.7.8", Key: "/c/com/example/app"},
+			{Host: "5:6::8", Key: "/c/com/example/app"},
+			{Host: "5.6.7.9", Key: "/c/com/example/apps/*"},
+		}
+	}
+
+	ch, err := e.Transfer("example.com.", 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var records []dns.RR
+	for rrs := range ch {
+		records = append(records, rrs...)
+	}
+
+	expect := []dns.RR{
+		test.A("app.example.com.	5	IN	A	5.6.7.8"),
+		test.AAAA("app.example.com.	5	IN	AAAA	5:6::8"),
+		test.A("*.apps.example.com.	5	IN	A	5.6.7.9"),
+	}
+	if diff := difference(records, expect); len(diff) != 0 {
+		t.Errorf("Expected route records %v in transfer", diff)
+	}
+}
@@ -0,0 +1,18 @@
+package policy
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Variables declared for monitoring.
+var (
+	policyCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "k8s_policy",
+		Name:      "requests_total",
+		Help:      "Counter of DNS requests handled by the policy of the client's namespace.",
+	}, []string{"server", "namespace", "policy"})
+)
@@ -0,0 +1,181 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/kubernetes/object"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+
+	"github.com/miekg/dns"
+)
+
+// The namespace annotations that make up the policy of a namespace. Their values are JSON.
+const (
+	// deny is a list of domains, queries for them and the names below them are answered with NXDOMAIN.
+	deny = "deny"
+	// stubDomains maps domains to the name servers the queries for them are forwarded to.
+	stubDomains = "stub-domains"
+	// upstreamNameservers is a list of name servers the queries for other names are forwarded to.
+	upstreamNameservers = "upstream-nameservers"
+)
+
+// nsPolicy is the parsed policy of a namespace.
+type nsPolicy struct {
+	version string // resource version of the namespace
+
+	deny      []string
+	stubs     map[string][]string
+	stubZones []string
+	upstream  []string
+}
+
+// empty returns true if p does not change how any query is handled.
+func (p *nsPolicy) empty() bool {
+	return len(p.deny) == 0 && len(p.stubZones) == 0 && len(p.upstream) == 0
+}
+
+// policy returns the policy of namespace ns. Policies are parsed once for each version of a namespace.
+// When a new version is parsed, the cache and the proxies are pruned.
+func (p *Policy) policy(ns *object.Namespace) *nsPolicy {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pol, ok := p.cache[ns.Name]; ok && pol.version == ns.Version {
+		return pol
+	}
+	pol := p.parse(ns)
+	p.cache[ns.Name] = pol
+	p.prune()
+	return pol
+}
+
+// prune evicts the policies of the namespaces that were deleted or changed, the latter are parsed
+// again when they are used. It then removes the servers no cached policy uses, they are stopped once
+// no query uses them anymore. p.mu must be held.
+func (p *Policy) prune() {
+	if p.namespaceByName != nil {
+		for name, pol := range p.cache {
+			if ns := p.namespaceByName(name); ns == nil || ns.Version != pol.version {
+				delete(p.cache, name)
+			}
+		}
+	}
+
+	used := make(map[string]struct{})
+	for _, pol := range p.cache {
+		for _, addrs := range pol.stubs {
+			for _, addr := range addrs {
+				used[addr] = struct{}{}
+			}
+		}
+		for _, addr := range pol.upstream {
+			used[addr] = struct{}{}
+		}
+	}
+	for addr, srv := range p.proxies {
+		if _, ok := used[addr]; ok {
+			continue
+		}
+		delete(p.proxies, addr)
+		srv.retired = true
+		if srv.inUse == 0 {
+			srv.stop()
+		}
+	}
+}
+
+// parse parses the policy annotations of ns that are enabled. Annotations that can not be parsed are
+// logged and ignored.
+func (p *Policy) parse(ns *object.Namespace) *nsPolicy {
+	pol := &nsPolicy{version: ns.Version}
+	for name := range p.enabled {
+		value, ok := ns.Annotations[object.NamespaceAnnotationPrefix+name]
+		if !ok {
+			continue
+		}
+		var err error
+		switch name {
+		case deny:
+			pol.deny, err = parseDeny(value)
+		case stubDomains:
+			pol.stubs, err = parseStubDomains(value)
+			for zone := range pol.stubs {
+				pol.stubZones = append(pol.stubZones, zone)
+			}
+		case upstreamNameservers:
+			pol.upstream, err = parseUpstream(value)
+		}
+		if err != nil {
+			log.Warningf("Namespace %s: invalid %s%s annotation: %s", ns.Name, object.NamespaceAnnotationPrefix, name, err)
+		}
+	}
+	return pol
+}
+
+func parseDeny(value string) ([]string, error) {
+	var domains []string
+	if err := json.Unmarshal([]byte(value), &domains); err != nil {
+		return nil, err
+	}
+	for i, d := range domains {
+		if _, ok := dns.IsDomainName(d); !ok || d == "" {
+			return nil, fmt.Errorf("invalid domain %q", d)
+		}
+		domains[i] = plugin.Name(d).Normalize()
+	}
+	return domains, nil
+}
+
+func parseStubDomains(value string) (map[string][]string, error) {
+	var stubs map[string][]string
+	if err := json.Unmarshal([]byte(value), &stubs); err != nil {
+		return nil, err
+	}
+	normalized := make(map[string][]string, len(stubs))
+	for d, servers := range stubs {
+		if _, ok := dns.IsDomainName(d); !ok || d == "" {
+			return nil, fmt.Errorf("invalid domain %q", d)
+		}
+		addrs, err := parseNameservers(servers)
+		if err != nil {
+			return nil, err
+		}
+		normalized[plugin.Name(d).Normalize()] = addrs
+	}
+	return normalized, nil
+}
+
+func parseUpstream(value string) ([]string, error) {
+	var servers []string
+	if err := json.Unmarshal([]byte(value), &servers); err != nil {
+		return nil, err
+	}
+	return parseNameservers(servers)
+}
+
+// parseNameservers returns the addresses of servers, which are IP addresses with an optional port.
+func parseNameservers(servers []string) ([]string, error) {
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no name servers")
+	}
+	addrs := make([]string, len(servers))
+	for i, s := range servers {
+		host, port, err := net.SplitHostPort(s)
+		if err != nil {
+			host, port = strings.Trim(s, "[]"), transport.Port
+		}
+		if net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("name server %q is not an IP address", s)
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("name server %q has an invalid port", s)
+		}
+		addrs[i] = net.JoinHostPort(host, port)
+	}
+	return addrs, nil
+}
@@ -0,0 +1,188 @@
+package policy
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/kubernetes/object"
+	"github.com/coredns/coredns/plugin/pkg/proxy"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+func TestParse(t *testing.T) {
+	p := New([]string{"."})
+	ns := &object.Namespace{
+		Version: "1",
+		Name:    "team-a",
+		Annotations: map[string]string{
+			object.NamespaceAnnotationPrefix + deny:                `["Ads.example.com", "tracker.example.net."]`,
+			object.NamespaceAnnotationPrefix + stubDomains:         `{"corp.example.com": ["10.0.0.10", "10.0.0.11:5353"], "lab.example.com": ["[2001:db8::1]:53"]}`,
+			object.NamespaceAnnotationPrefix + upstreamNameservers: `["192.0.2.53"]`,
+		},
+	}
+
+	pol := p.policy(ns)
+	if expected := []string{"ads.example.com.", "tracker.example.net."}; !reflect.DeepEqual(pol.deny, expected) {
+		t.Errorf("Expected deny %v, got %v", expected, pol.deny)
+	}
+	expectedStubs := map[string][]string{
+		"corp.example.com.": {"10.0.0.10:53", "10.0.0.11:5353"},
+		"lab.example.com.":  {"[2001:db8::1]:53"},
+	}
+	if !reflect.DeepEqual(pol.stubs, expectedStubs) {
+		t.Errorf("Expected stub domains %v, got %v", expectedStubs, pol.stubs)
+	}
+	if len(pol.stubZones) != 2 {
+		t.Errorf("Expected 2 stub zones, got %v", pol.stubZones)
+	}
+	if expected := []string{"192.0.2.53:53"}; !reflect.DeepEqual(pol.upstream, expected) {
+		t.Errorf("Expected upstream %v, got %v", expected, pol.upstream)
+	}
+
+	// The same version is not parsed again.
+	if p.policy(ns) != pol {
+		t.Errorf("Expected the cached policy for the same version")
+	}
+	ns.Version = "2"
+	if p.policy(ns) == pol {
+		t.Errorf("Expected a new policy for a new version")
+	}
+}
+
+func TestParseEnabled(t *testing.T) {
+	p := New([]string{"."})
+	p.enabled = map[string]struct{}{deny: {}}
+	ns := &object.Namespace{
+		Name: "team-a",
+		Annotations: map[string]string{
+			object.NamespaceAnnotationPrefix + deny:                `["ads.example.com"]`,
+			object.NamespaceAnnotationPrefix + upstreamNameservers: `["192.0.2.53"]`,
+		},
+	}
+
+	pol := p.policy(ns)
+	if len(pol.deny) != 1 {
+		t.Errorf("Expected deny policy, got %v", pol.deny)
+	}
+	if len(pol.upstream) != 0 {
+		t.Errorf("Expected no upstream policy when it is not enabled, got %v", pol.upstream)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		annotation string
+		value      string
+	}{
+		{deny, `ads.example.com`},
+		{deny, `[""]`},
+		{deny, `["ads..example.com"]`},
+		{stubDomains, `["10.0.0.10"]`},
+		{stubDomains, `{"corp.example.com": []}`},
+		{stubDomains, `{"corp.example.com": ["ns.example.com"]}`},
+		{upstreamNameservers, `["192.0.2.53:0"]`},
+		{upstreamNameservers, `["192.0.2.53:dns"]`},
+		{upstreamNameservers, `[]`},
+	}
+
+	p := New([]string{"."})
+	for i, tc := range tests {
+		ns := &object.Namespace{Name: "team-a", Annotations: map[string]string{object.NamespaceAnnotationPrefix + tc.annotation: tc.value}}
+		if pol := p.parse(ns); !pol.empty() {
+			t.Errorf("Test %d: expected invalid %s annotation %s to be ignored, got %+v", i, tc.annotation, tc.value, pol)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	upstream := func(name, version, addr string) *object.Namespace {
+		return &object.Namespace{
+			Name:        name,
+			Version:     version,
+			Annotations: map[string]string{object.NamespaceAnnotationPrefix + upstreamNameservers: `["` + addr + `"]`},
+		}
+	}
+	namespaces := map[string]*object.Namespace{
+		"team-a": upstream("team-a", "1", "192.0.2.1"),
+		"team-b": upstream("team-b", "1", "192.0.2.2"),
+	}
+
+	p := New([]string{"."})
+	p.namespaceByName = func(name string) *object.Namespace { return namespaces[name] }
+	defer p.OnShutdown()
+
+	var servers []*server
+	for _, ns := range namespaces {
+		for _, addr := range p.policy(ns).upstream {
+			srv := p.proxy(addr)
+			p.release(srv)
+			servers = append(servers, srv)
+		}
+	}
+	if len(p.cache) != 2 || len(p.proxies) != 2 {
+		t.Fatalf("Expected 2 cached policies and 2 proxies, got %d and %d", len(p.cache), len(p.proxies))
+	}
+
+	// team-b is deleted and team-a uses another upstream, the proxies for the old upstreams are stopped.
+	delete(namespaces, "team-b")
+	namespaces["team-a"] = upstream("team-a", "2", "192.0.2.3")
+	pol := p.policy(namespaces["team-a"])
+	if !reflect.DeepEqual(pol.upstream, []string{"192.0.2.3:53"}) {
+		t.Errorf("Expected upstream %v, got %v", []string{"192.0.2.3:53"}, pol.upstream)
+	}
+	if _, ok := p.cache["team-b"]; ok || len(p.cache) != 1 {
+		t.Errorf("Expected only the policy of team-a to be cached, got %d policies", len(p.cache))
+	}
+	if len(p.proxies) != 0 {
+		t.Errorf("Expected no proxies, got %d", len(p.proxies))
+	}
+	for _, srv := range servers {
+		if !srv.stopped {
+			t.Errorf("Expected the proxy for %s to be stopped", srv.Addr())
+		}
+	}
+}
+
+func TestPruneInUse(t *testing.T) {
+	up := upstream("192.0.2.1")
+	defer up.Close()
+
+	ns := &object.Namespace{
+		Name:        "team-a",
+		Version:     "1",
+		Annotations: map[string]string{object.NamespaceAnnotationPrefix + upstreamNameservers: `["` + up.Addr + `"]`},
+	}
+	p := New([]string{"."})
+	p.namespaceByName = func(name string) *object.Namespace { return ns }
+	defer p.OnShutdown()
+
+	srv := p.proxy(p.policy(ns).upstream[0])
+
+	// The annotations change while a query uses the server: it's retired, but not stopped.
+	ns = &object.Namespace{Name: "team-a", Version: "2", Annotations: map[string]string{object.NamespaceAnnotationPrefix + deny: `["example.org"]`}}
+	p.policy(ns)
+	if len(p.proxies) != 0 {
+		t.Fatalf("Expected no proxies, got %d", len(p.proxies))
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion("www.example.com.", dns.TypeA)
+	state := request.Request{W: &test.ResponseWriter{}, Req: m}
+	if _, _, _, err := srv.Connect(context.TODO(), state, proxy.Options{}); err != nil {
+		t.Fatalf("Expected the retired server to be usable while it is in use, got %s", err)
+	}
+
+	if srv.stopped {
+		t.Error("Expected the retired server not to be stopped while it is in use")
+	}
+
+	// It's stopped when the query is done.
+	p.release(srv)
+	if !srv.stopped {
+		t.Error("Expected the retired server to be stopped")
+	}
+}
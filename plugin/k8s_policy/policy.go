@@ -0,0 +1,185 @@
+// Package policy implements a plugin that applies the DNS policy of the client's Kubernetes namespace.
+package policy
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/kubernetes/object"
+	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/proxy"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// Policy applies the policies set with annotations on the client's namespace.
+type Policy struct {
+	Next  plugin.Handler
+	Zones []string
+
+	enabled map[string]struct{} // the policies that are applied
+
+	namespaceFunc   func(ip string) *object.Namespace   // returns the namespace of the client with IP ip
+	namespaceByName func(name string) *object.Namespace // returns the namespace name, or nil if it doesn't exist
+	clusterZones    []string                            // zones of the kubernetes plugin, they are never forwarded
+
+	mu      sync.Mutex
+	cache   map[string]*nsPolicy // parsed policies by namespace
+	proxies map[string]*server   // proxies by address
+}
+
+// server is the proxy for a name server, with the number of queries that are using it.
+type server struct {
+	*proxy.Proxy
+	inUse   int
+	retired bool // no cached policy uses the name server anymore, it's stopped once inUse drops to 0
+	stopped bool
+}
+
+// stop stops the proxy of srv, if it isn't stopped yet.
+func (srv *server) stop() {
+	if !srv.stopped {
+		srv.Stop()
+		srv.stopped = true
+	}
+}
+
+// New returns an initialized Policy with all policies enabled.
+func New(zones []string) *Policy {
+	return &Policy{
+		Zones:   zones,
+		enabled: map[string]struct{}{deny: {}, stubDomains: {}, upstreamNameservers: {}},
+		cache:   make(map[string]*nsPolicy),
+		proxies: make(map[string]*server),
+	}
+}
+
+const hcInterval = 500 * time.Millisecond
+
+// ServeDNS implements the plugin.Handler interface.
+func (p *Policy) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+	qname := state.Name()
+
+	if p.namespaceFunc == nil || plugin.Zones(p.Zones).Matches(qname) == "" {
+		return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+	}
+	ns := p.namespaceFunc(state.IP())
+	if ns == nil || len(ns.Annotations) == 0 {
+		return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+	}
+	pol := p.policy(ns)
+	if pol.empty() {
+		return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+	}
+
+	if plugin.Zones(pol.deny).Matches(qname) != "" {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeNameError)
+		m.RecursionAvailable = true
+		policyCount.WithLabelValues(metrics.WithServer(ctx), ns.Name, deny).Inc()
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	}
+
+	// Names in the cluster's zones are always left to the kubernetes plugin.
+	if plugin.Zones(p.clusterZones).Matches(qname) != "" {
+		return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+	}
+	if zone := plugin.Zones(pol.stubZones).Matches(qname); zone != "" {
+		policyCount.WithLabelValues(metrics.WithServer(ctx), ns.Name, stubDomains).Inc()
+		return p.forward(ctx, w, state, pol.stubs[zone])
+	}
+	if len(pol.upstream) > 0 {
+		policyCount.WithLabelValues(metrics.WithServer(ctx), ns.Name, upstreamNameservers).Inc()
+		return p.forward(ctx, w, state, pol.upstream)
+	}
+
+	return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+}
+
+// forward forwards the query in state to the name servers in addrs, trying them in order until one of
+// them replies.
+func (p *Policy) forward(ctx context.Context, w dns.ResponseWriter, state request.Request, addrs []string) (int, error) {
+	var (
+		ret *dns.Msg
+		err error
+	)
+	for _, addr := range addrs {
+		srv := p.proxy(addr)
+		for {
+			ret, _, _, err = srv.Connect(ctx, state, proxy.Options{})
+			if err != proxy.ErrCachedClosed { // Remote side closed conn, can only happen with TCP.
+				break
+			}
+		}
+		if err != nil {
+			log.Debugf("Failed to forward %s to %s: %s", state.Name(), addr, err)
+			srv.Healthcheck()
+		}
+		p.release(srv)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return dns.RcodeServerFailure, err
+	}
+
+	if !state.Match(ret) {
+		formerr := new(dns.Msg)
+		formerr.SetRcode(state.Req, dns.RcodeFormatError)
+		w.WriteMsg(formerr)
+		return 0, nil
+	}
+
+	w.WriteMsg(ret)
+	return 0, nil
+}
+
+// proxy returns the server for addr, its proxy is started when it is first used. The server is in
+// use until it is given back with release.
+func (p *Policy) proxy(addr string) *server {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	srv, ok := p.proxies[addr]
+	if !ok {
+		srv = &server{Proxy: proxy.NewProxy(pluginName, addr, transport.DNS)}
+		srv.Start(hcInterval)
+		p.proxies[addr] = srv
+	}
+	srv.inUse++
+	return srv
+}
+
+// release gives back srv, that was returned by proxy. A retired server is stopped when the last query
+// that uses it is done.
+func (p *Policy) release(srv *server) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	srv.inUse--
+	if srv.retired && srv.inUse == 0 {
+		srv.stop()
+	}
+}
+
+// OnShutdown stops all proxies.
+func (p *Policy) OnShutdown() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, srv := range p.proxies {
+		srv.stop()
+	}
+	p.proxies = make(map[string]*server)
+	return nil
+}
+
+// Name implements the Handler interface.
+func (p *Policy) Name() string { return pluginName }
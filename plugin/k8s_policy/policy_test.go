@@ -0,0 +1,143 @@
+package policy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/kubernetes/object"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// upstream returns a server that answers every A query with ip.
+func upstream(ip string) *dnstest.Server {
+	return dnstest.NewMultipleServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		ret.Answer = append(ret.Answer, test.A(r.Question[0].Name+" 5 IN A "+ip))
+		w.WriteMsg(ret)
+	})
+}
+
+func TestServeDNS(t *testing.T) {
+	stub := upstream("10.0.0.1")
+	defer stub.Close()
+	up := upstream("192.0.2.1")
+	defer up.Close()
+
+	namespaces := map[string]*object.Namespace{
+		// test.ResponseWriter uses 10.240.0.1 as the client's IP.
+		"10.240.0.1": {
+			Version: "1",
+			Name:    "team-a",
+			Annotations: map[string]string{
+				object.NamespaceAnnotationPrefix + deny:                `["ads.example.com", "svc.cluster.local"]`,
+				object.NamespaceAnnotationPrefix + stubDomains:         `{"corp.example.com": ["` + stub.Addr + `"], "cluster.local": ["` + stub.Addr + `"]}`,
+				object.NamespaceAnnotationPrefix + upstreamNameservers: `["` + up.Addr + `"]`,
+			},
+		},
+	}
+
+	p := New([]string{"."})
+	p.clusterZones = []string{"cluster.local."}
+	p.namespaceFunc = func(ip string) *object.Namespace { return namespaces[ip] }
+	p.Next = test.NextHandler(dns.RcodeBadCookie, nil)
+	defer p.OnShutdown()
+
+	tests := []struct {
+		qname  string
+		next   bool
+		rcode  int
+		answer string
+	}{
+		{qname: "ads.example.com.", rcode: dns.RcodeNameError},
+		{qname: "www.ads.example.com.", rcode: dns.RcodeNameError},
+		{qname: "kubernetes.default.svc.cluster.local.", rcode: dns.RcodeNameError}, // deny applies to the cluster's zones
+		{qname: "www.corp.example.com.", answer: "10.0.0.1"},
+		{qname: "www.example.org.", answer: "192.0.2.1"},
+		{qname: "db.team-a.pod.cluster.local.", next: true}, // the cluster's zones are not forwarded
+	}
+
+	ctx := context.TODO()
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, dns.TypeA)
+		w := dnstest.NewRecorder(&test.ResponseWriter{})
+
+		rcode, err := p.ServeDNS(ctx, w, m)
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		if next := rcode == dns.RcodeBadCookie; next != tc.next {
+			t.Errorf("Test %d: expected next plugin to be called %t, got %t", i, tc.next, next)
+			continue
+		}
+		if tc.next {
+			continue
+		}
+		if w.Msg.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %d, got %d", i, tc.rcode, w.Msg.Rcode)
+		}
+		if tc.answer == "" {
+			continue
+		}
+		if len(w.Msg.Answer) != 1 || w.Msg.Answer[0].(*dns.A).A.String() != tc.answer {
+			t.Errorf("Test %d: expected answer %s, got %v", i, tc.answer, w.Msg.Answer)
+		}
+	}
+}
+
+func TestServeDNSNoPolicy(t *testing.T) {
+	namespaces := map[string]*object.Namespace{
+		"10.240.0.1": {Name: "team-b"},
+	}
+
+	p := New([]string{"example.org."})
+	p.Next = test.NextHandler(dns.RcodeBadCookie, nil)
+
+	ctx := context.TODO()
+	for _, fn := range []func(string) *object.Namespace{
+		nil, // no kubernetes plugin
+		func(ip string) *object.Namespace { return nil },            // unknown client
+		func(ip string) *object.Namespace { return namespaces[ip] }, // no annotations
+	} {
+		p.namespaceFunc = fn
+		m := new(dns.Msg)
+		m.SetQuestion("www.example.org.", dns.TypeA)
+		if rcode, _ := p.ServeDNS(ctx, dnstest.NewRecorder(&test.ResponseWriter{}), m); rcode != dns.RcodeBadCookie {
+			t.Errorf("Expected next plugin to be called, got rcode %d", rcode)
+		}
+	}
+
+	// Names outside the zones of the plugin do not get the policy.
+	namespaces["10.240.0.1"].Annotations = map[string]string{object.NamespaceAnnotationPrefix + deny: `["example.net"]`}
+	p.namespaceFunc = func(ip string) *object.Namespace { return namespaces[ip] }
+	m := new(dns.Msg)
+	m.SetQuestion("www.example.net.", dns.TypeA)
+	if rcode, _ := p.ServeDNS(ctx, dnstest.NewRecorder(&test.ResponseWriter{}), m); rcode != dns.RcodeBadCookie {
+		t.Errorf("Expected next plugin to be called, got rcode %d", rcode)
+	}
+}
+
+func TestServeDNSUpstreamDown(t *testing.T) {
+	namespaces := map[string]*object.Namespace{
+		"10.240.0.1": {
+			Name:        "team-a",
+			Annotations: map[string]string{object.NamespaceAnnotationPrefix + upstreamNameservers: `["127.0.0.1:1"]`},
+		},
+	}
+
+	p := New([]string{"."})
+	p.namespaceFunc = func(ip string) *object.Namespace { return namespaces[ip] }
+	defer p.OnShutdown()
+
+	m := new(dns.Msg)
+	m.SetQuestion("www.example.org.", dns.TypeA)
+	rcode, err := p.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), m)
+	if rcode != dns.RcodeServerFailure || err == nil {
+		t.Errorf("Expected SERVFAIL and an error, got %d and %v", rcode, err)
+	}
+}
@@ -0,0 +1,92 @@
+package policy
+
+import (
+	"fmt"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/kubernetes"
+	"github.com/coredns/coredns/plugin/kubernetes/object"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+)
+
+const pluginName = "k8s_policy"
+
+var log = clog.NewWithPlugin(pluginName)
+
+func init() { plugin.Register(pluginName, setup) }
+
+func setup(c *caddy.Controller) error {
+	p, err := parse(c)
+	if err != nil {
+		return plugin.Error(pluginName, err)
+	}
+
+	// Do this in OnStartup, so all plugins have been initialized.
+	c.OnStartup(func() error {
+		m := dnsserver.GetConfig(c).Handler("kubernetes")
+		if m == nil {
+			return plugin.Error(pluginName, fmt.Errorf("needs the kubernetes plugin"))
+		}
+		k, ok := m.(*kubernetes.Kubernetes)
+		if !ok {
+			return plugin.Error(pluginName, fmt.Errorf("unexpected kubernetes handler %T", m))
+		}
+		p.namespaceFunc = k.ClientNamespace
+		p.namespaceByName = func(name string) *object.Namespace {
+			ns, err := k.APIConn.GetNamespaceByName(name)
+			if err != nil {
+				return nil
+			}
+			return ns
+		}
+		p.clusterZones = k.Zones
+		return nil
+	})
+	c.OnShutdown(p.OnShutdown)
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		p.Next = next
+		return p
+	})
+
+	return nil
+}
+
+func parse(c *caddy.Controller) (*Policy, error) {
+	var p *Policy
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		p = New(plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys))
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "policies":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				p.enabled = make(map[string]struct{})
+				for _, a := range args {
+					switch a {
+					case deny, stubDomains, upstreamNameservers:
+						p.enabled[a] = struct{}{}
+					default:
+						return nil, c.Errf("unknown policy '%s'", a)
+					}
+				}
+			default:
+				return nil, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+	}
+
+	return p, nil
+}
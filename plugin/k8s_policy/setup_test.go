@@ -0,0 +1,66 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/coredns/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		input            string
+		shouldErr        bool
+		expectedZones    []string
+		expectedPolicies []string
+	}{
+		{`k8s_policy`, false, nil, []string{deny, stubDomains, upstreamNameservers}},
+		{`k8s_policy example.org`, false, []string{"example.org."}, []string{deny, stubDomains, upstreamNameservers}},
+		{`k8s_policy {
+	policies deny
+}`, false, nil, []string{deny}},
+		{`k8s_policy {
+	policies stub-domains upstream-nameservers
+}`, false, nil, []string{stubDomains, upstreamNameservers}},
+		{`k8s_policy {
+	policies
+}`, true, nil, nil},
+		{`k8s_policy {
+	policies forward
+}`, true, nil, nil},
+		{`k8s_policy {
+	foo
+}`, true, nil, nil},
+		{`k8s_policy
+k8s_policy`, true, nil, nil},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		p, err := parse(c)
+
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but found none for input %s", i, test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error but found one for input %s. Error was: %v", i, test.input, err)
+			continue
+		}
+
+		if test.expectedZones != nil {
+			if len(p.Zones) != len(test.expectedZones) || p.Zones[0] != test.expectedZones[0] {
+				t.Errorf("Test %d: expected zones %v, got: %v", i, test.expectedZones, p.Zones)
+			}
+		}
+		if len(p.enabled) != len(test.expectedPolicies) {
+			t.Errorf("Test %d: expected policies %v, got: %v", i, test.expectedPolicies, p.enabled)
+		}
+		for _, e := range test.expectedPolicies {
+			if _, ok := p.enabled[e]; !ok {
+				t.Errorf("Test %d: expected policy %s to be enabled", i, e)
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package records
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/coredns/coredns/plugin/kubernetes/object"
+
+	api "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+)
+
+// controller watches the DNSZone and DNSRecord objects.
+type controller struct {
+	zoneLister       cache.Indexer
+	zoneController   cache.Controller
+	recordLister     cache.Indexer
+	recordController cache.Controller
+
+	// changed receives a value when an object was added, updated or deleted.
+	changed chan struct{}
+
+	// stopLock is used to enforce only a single call to Stop is active.
+	stopLock sync.Mutex
+	shutdown bool
+	stopCh   chan struct{}
+}
+
+// newController returns a controller that watches the DNSZone and DNSRecord objects in all namespaces.
+func newController(ctx context.Context, client dynamic.Interface) *controller {
+	c := controller{
+		changed: make(chan struct{}, 1),
+		stopCh:  make(chan struct{}),
+	}
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(_ any) { c.notify() },
+		UpdateFunc: func(_, _ any) { c.notify() },
+		DeleteFunc: func(_ any) { c.notify() },
+	}
+
+	c.zoneLister, c.zoneController = object.NewIndexerInformer(
+		listWatch(ctx, client, zoneResource),
+		&unstructured.Unstructured{},
+		handler,
+		cache.Indexers{},
+		object.DefaultProcessor(toZone, nil),
+	)
+	c.recordLister, c.recordController = object.NewIndexerInformer(
+		listWatch(ctx, client, recordResource),
+		&unstructured.Unstructured{},
+		handler,
+		cache.Indexers{},
+		object.DefaultProcessor(toRecord, nil),
+	)
+	return &c
+}
+
+func listWatch(ctx context.Context, client dynamic.Interface, resource schema.GroupVersionResource) cache.ListerWatcher {
+	return cache.ToListWatcherWithWatchListSemantics(
+		&cache.ListWatch{
+			ListFunc: func(opts meta.ListOptions) (runtime.Object, error) {
+				return client.Resource(resource).Namespace(api.NamespaceAll).List(ctx, opts)
+			},
+			WatchFunc: func(opts meta.ListOptions) (watch.Interface, error) {
+				return client.Resource(resource).Namespace(api.NamespaceAll).Watch(ctx, opts)
+			},
+		},
+		client,
+	)
+}
+
+// notify signals a change, without blocking if one is already pending.
+func (c *controller) notify() {
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Changed returns the channel that receives a value when the objects have changed.
+func (c *controller) Changed() <-chan struct{} { return c.changed }
+
+// ZoneList returns the DNSZone objects.
+func (c *controller) ZoneList() []*dnsZone {
+	os := c.zoneLister.List()
+	zones := make([]*dnsZone, 0, len(os))
+	for _, o := range os {
+		z, ok := o.(*dnsZone)
+		if !ok {
+			continue
+		}
+		zones = append(zones, z)
+	}
+	return zones
+}
+
+// RecordList returns the DNSRecord objects.
+func (c *controller) RecordList() []*dnsRecord {
+	os := c.recordLister.List()
+	records := make([]*dnsRecord, 0, len(os))
+	for _, o := range os {
+		r, ok := o.(*dnsRecord)
+		if !ok {
+			continue
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+// Run starts the controller.
+func (c *controller) Run() {
+	go c.zoneController.Run(c.stopCh)
+	go c.recordController.Run(c.stopCh)
+	<-c.stopCh
+}
+
+// HasSynced calls on all controllers.
+func (c *controller) HasSynced() bool {
+	return c.zoneController.HasSynced() && c.recordController.HasSynced()
+}
+
+// Stop stops the controller.
+func (c *controller) Stop() error {
+	c.stopLock.Lock()
+	defer c.stopLock.Unlock()
+
+	if !c.shutdown {
+		close(c.stopCh)
+		c.shutdown = true
+
+		return nil
+	}
+
+	return fmt.Errorf("shutdown already in progress")
+}
@@ -0,0 +1,87 @@
+package records
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func newUnstructured(kind, namespace, name string, spec map[string]any) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]any{"spec": spec}}
+	u.SetGroupVersionKind(schema.GroupVersionKind{Group: group, Version: version, Kind: kind})
+	u.SetNamespace(namespace)
+	u.SetName(name)
+	u.SetCreationTimestamp(meta.NewTime(created))
+	return u
+}
+
+func TestController(t *testing.T) {
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{zoneResource: "DNSZoneList", recordResource: "DNSRecordList"},
+		newUnstructured("DNSZone", "infra", "org", map[string]any{"zone": "Example.org", "namespaces": []any{"team-a"}}),
+		newUnstructured("DNSRecord", "team-a", "verify", map[string]any{"name": "example.org", "type": "TXT", "data": []any{`"verification=abc"`}}),
+	)
+
+	k := New([]string{"example.org."})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := make(chan struct{})
+	defer close(stop)
+	k.start(ctx, client, stop)
+	defer k.ctrl.Stop()
+
+	waitFor(t, "ready", k.Ready)
+	if rcode := query(k, "example.org.", dns.TypeTXT); rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected TXT record for example.org., got rcode %d", rcode)
+	}
+
+	mx := newUnstructured("DNSRecord", "team-a", "mx", map[string]any{"name": "example.org.", "type": "MX", "ttl": int64(60), "data": []any{"10 mx.example.net."}})
+	if _, err := client.Resource(recordResource).Namespace("team-a").Create(ctx, mx, meta.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "MX record", func() bool { return query(k, "example.org.", dns.TypeMX) == dns.RcodeSuccess })
+
+	if err := client.Resource(zoneResource).Namespace("infra").Delete(ctx, "org", meta.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "zone deletion", func() bool { return query(k, "example.org.", dns.TypeTXT) == dns.RcodeBadCookie })
+}
+
+// query returns the rcode of the answer k gives for qname and qtype, and RcodeBadCookie if the next
+// plugin was called. A NOERROR answer without records is returned as RcodeServerFailure.
+func query(k *Records, qname string, qtype uint16) int {
+	k.Next = test.NextHandler(dns.RcodeBadCookie, nil)
+	m := new(dns.Msg)
+	m.SetQuestion(qname, qtype)
+	w := dnstest.NewRecorder(&test.ResponseWriter{})
+
+	rcode, _ := k.ServeDNS(context.TODO(), w, m)
+	if rcode == dns.RcodeBadCookie || w.Msg == nil {
+		return rcode
+	}
+	if w.Msg.Rcode == dns.RcodeSuccess && len(w.Msg.Answer) == 0 {
+		return dns.RcodeServerFailure
+	}
+	return w.Msg.Rcode
+}
+
+func waitFor(t *testing.T, what string, f func() bool) {
+	t.Helper()
+	for range 50 {
+		if f() {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %s", what)
+}
@@ -0,0 +1,251 @@
+package records
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin/kubernetes/object"
+
+	"github.com/miekg/dns"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// group and version of the DNSZone and DNSRecord custom resources.
+const (
+	group   = "dns.coredns.io"
+	version = "v1alpha1"
+)
+
+var (
+	zoneResource   = schema.GroupVersionResource{Group: group, Version: version, Resource: "dnszones"}
+	recordResource = schema.GroupVersionResource{Group: group, Version: version, Resource: "dnsrecords"}
+)
+
+// zoneSpec is the spec of a DNSZone.
+type zoneSpec struct {
+	// Zone is the origin of the zone.
+	Zone string `json:"zone"`
+	// Namespaces are the namespaces, in addition to the DNSZone's own, that may publish records in the
+	// zone. "*" allows all namespaces.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Nameservers are the name servers of the zone, they are used for the NS records and the SOA.
+	Nameservers []string `json:"nameservers,omitempty"`
+}
+
+// recordSpec is the spec of a DNSRecord.
+type recordSpec struct {
+	// Name is the fully qualified owner name of the records.
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// TTL is the TTL of the records, if not set the TTL of the plugin is used.
+	TTL *uint32 `json:"ttl,omitempty"`
+	// Data holds the rdata of each record in zone file format.
+	Data []string `json:"data"`
+}
+
+// dnsZone is a stripped down DNSZone with only the items we need for CoreDNS.
+type dnsZone struct {
+	Version   string
+	Name      string
+	Namespace string
+	Created   time.Time
+	Spec      zoneSpec
+
+	*object.Empty
+}
+
+// dnsRecord is a stripped down DNSRecord with only the items we need for CoreDNS.
+type dnsRecord struct {
+	Version   string
+	Name      string
+	Namespace string
+	Created   time.Time
+	Spec      recordSpec
+
+	*object.Empty
+}
+
+// toZone converts an unstructured DNSZone to a *dnsZone.
+func toZone(obj meta.Object) (meta.Object, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object %v", obj)
+	}
+	z := &dnsZone{
+		Version:   u.GetResourceVersion(),
+		Name:      u.GetName(),
+		Namespace: u.GetNamespace(),
+		Created:   u.GetCreationTimestamp().Time,
+	}
+	if spec, ok := u.Object["spec"].(map[string]any); ok {
+		// An invalid spec leaves the zone without an origin, it is ignored when the zones are built.
+		runtime.DefaultUnstructuredConverter.FromUnstructured(spec, &z.Spec)
+	}
+	if z.Spec.Zone != "" {
+		z.Spec.Zone = dns.Fqdn(strings.ToLower(z.Spec.Zone))
+	}
+	for i := range z.Spec.Nameservers {
+		z.Spec.Nameservers[i] = dns.Fqdn(strings.ToLower(z.Spec.Nameservers[i]))
+	}
+
+	*u = unstructured.Unstructured{}
+	return z, nil
+}
+
+// toRecord converts an unstructured DNSRecord to a *dnsRecord.
+func toRecord(obj meta.Object) (meta.Object, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object %v", obj)
+	}
+	r := &dnsRecord{
+		Version:   u.GetResourceVersion(),
+		Name:      u.GetName(),
+		Namespace: u.GetNamespace(),
+		Created:   u.GetCreationTimestamp().Time,
+	}
+	if spec, ok := u.Object["spec"].(map[string]any); ok {
+		// An invalid spec leaves the record without a name, it is rejected when the zones are built.
+		runtime.DefaultUnstructuredConverter.FromUnstructured(spec, &r.Spec)
+	}
+	if r.Spec.Name != "" {
+		r.Spec.Name = dns.Fqdn(strings.ToLower(r.Spec.Name))
+	}
+
+	*u = unstructured.Unstructured{}
+	return r, nil
+}
+
+// allows returns true if records from namespace may be published in the zone.
+func (z *dnsZone) allows(namespace string) bool {
+	if namespace == z.Namespace {
+		return true
+	}
+	for _, ns := range z.Spec.Namespaces {
+		if ns == "*" || ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// rrs returns the records of r, ttl is used if r has no TTL.
+func (r *dnsRecord) rrs(ttl uint32) ([]dns.RR, error) {
+	name := r.Spec.Name
+	if _, ok := dns.IsDomainName(name); !ok || name == "" {
+		return nil, fmt.Errorf("invalid name %q", name)
+	}
+	qtype, ok := dns.StringToType[strings.ToUpper(r.Spec.Type)]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %q", r.Spec.Type)
+	}
+	if qtype == dns.TypeSOA {
+		return nil, fmt.Errorf("type %s is not allowed", r.Spec.Type)
+	}
+	if len(r.Spec.Data) == 0 {
+		return nil, fmt.Errorf("no data")
+	}
+	if r.Spec.TTL != nil {
+		ttl = *r.Spec.TTL
+	}
+
+	rrs := make([]dns.RR, 0, len(r.Spec.Data))
+	for _, d := range r.Spec.Data {
+		if strings.ContainsAny(d, "\n\r") {
+			return nil, fmt.Errorf("invalid data %q", d)
+		}
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", name, ttl, dns.TypeToString[qtype], d))
+		if err != nil {
+			return nil, fmt.Errorf("invalid data %q: %s", d, err)
+		}
+		// The data should not be able to change the name or the type of the record.
+		if rr == nil || rr.Header().Rrtype != qtype || !strings.EqualFold(rr.Header().Name, name) {
+			return nil, fmt.Errorf("invalid data %q", d)
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs, nil
+}
+
+var _ runtime.Object = &dnsZone{}
+
+// DeepCopyObject implements the ObjectKind interface.
+func (z *dnsZone) DeepCopyObject() runtime.Object {
+	z1 := &dnsZone{
+		Version:   z.Version,
+		Name:      z.Name,
+		Namespace: z.Namespace,
+		Created:   z.Created,
+		Spec: zoneSpec{
+			Zone:        z.Spec.Zone,
+			Namespaces:  make([]string, len(z.Spec.Namespaces)),
+			Nameservers: make([]string, len(z.Spec.Nameservers)),
+		},
+	}
+	copy(z1.Spec.Namespaces, z.Spec.Namespaces)
+	copy(z1.Spec.Nameservers, z.Spec.Nameservers)
+	return z1
+}
+
+// GetNamespace implements the meta.Object interface.
+func (z *dnsZone) GetNamespace() string { return z.Namespace }
+
+// SetNamespace implements the meta.Object interface.
+func (z *dnsZone) SetNamespace(_namespace string) {}
+
+// GetName implements the meta.Object interface.
+func (z *dnsZone) GetName() string { return z.Name }
+
+// SetName implements the meta.Object interface.
+func (z *dnsZone) SetName(_name string) {}
+
+// GetResourceVersion implements the meta.Object interface.
+func (z *dnsZone) GetResourceVersion() string { return z.Version }
+
+// SetResourceVersion implements the meta.Object interface.
+func (z *dnsZone) SetResourceVersion(_version string) {}
+
+var _ runtime.Object = &dnsRecord{}
+
+// DeepCopyObject implements the ObjectKind interface.
+func (r *dnsRecord) DeepCopyObject() runtime.Object {
+	r1 := &dnsRecord{
+		Version:   r.Version,
+		Name:      r.Name,
+		Namespace: r.Namespace,
+		Created:   r.Created,
+		Spec: recordSpec{
+			Name: r.Spec.Name,
+			Type: r.Spec.Type,
+			Data: make([]string, len(r.Spec.Data)),
+		},
+	}
+	if r.Spec.TTL != nil {
+		ttl := *r.Spec.TTL
+		r1.Spec.TTL = &ttl
+	}
+	copy(r1.Spec.Data, r.Spec.Data)
+	return r1
+}
+
+// GetNamespace implements the meta.Object interface.
+func (r *dnsRecord) GetNamespace() string { return r.Namespace }
+
+// SetNamespace implements the meta.Object interface.
+func (r *dnsRecord) SetNamespace(_namespace string) {}
+
+// GetName implements the meta.Object interface.
+func (r *dnsRecord) GetName() string { return r.Name }
+
+// SetName implements the meta.Object interface.
+func (r *dnsRecord) SetName(_name string) {}
+
+// GetResourceVersion implements the meta.Object interface.
+func (r *dnsRecord) GetResourceVersion() string { return r.Version }
+
+// SetResourceVersion implements the meta.Object interface.
+func (r *dnsRecord) SetResourceVersion(_version string) {}
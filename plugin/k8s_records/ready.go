@@ -0,0 +1,5 @@
+package records
+
+// Ready implements the ready.Readiness interface. It returns true once the zones are built from the
+// synced DNSZone and DNSRecord objects.
+func (k *Records) Ready() bool { return k.synced.Load() }
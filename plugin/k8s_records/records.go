@@ -0,0 +1,108 @@
+// Package records implements a plugin that serves the records of DNSZone and DNSRecord custom resources.
+package records
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/fall"
+	"github.com/coredns/coredns/plugin/pkg/upstream"
+	"github.com/coredns/coredns/plugin/transfer"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Records serves the records published with DNSRecord objects in the zones of DNSZone objects.
+type Records struct {
+	Next  plugin.Handler
+	Zones []string
+	Fall  fall.F
+
+	ttl          uint32
+	namespaces   map[string]struct{}
+	clientConfig clientcmd.ClientConfig
+	upstream     *upstream.Upstream
+
+	ctrl     *controller
+	transfer *transfer.Transfer
+	synced   atomic.Bool // set when the zones were built from the synced objects
+
+	mu     sync.RWMutex
+	z      map[string]*file.Zone // the zones keyed by origin
+	names  []string              // the origins of z
+	serial uint32
+}
+
+// New returns an initialized Records.
+func New(zones []string) *Records {
+	return &Records{
+		Zones:      zones,
+		ttl:        defaultTTL,
+		namespaces: make(map[string]struct{}),
+		upstream:   upstream.New(),
+		z:          make(map[string]*file.Zone),
+	}
+}
+
+const defaultTTL = 300
+
+// ServeDNS implements the plugin.Handler interface.
+func (k *Records) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+	qname := state.Name()
+
+	zone := plugin.Zones(k.Zones).Matches(qname)
+	if zone == "" {
+		return plugin.NextOrFailure(k.Name(), k.Next, ctx, w, r)
+	}
+
+	k.mu.RLock()
+	origin := plugin.Zones(k.names).Matches(qname)
+	z := k.z[origin]
+	k.mu.RUnlock()
+
+	// No DNSZone (yet) for this name.
+	if z == nil {
+		return plugin.NextOrFailure(k.Name(), k.Next, ctx, w, r)
+	}
+
+	// If transfer is not loaded, we'll see these, answer with refused (no transfer allowed).
+	if state.QType() == dns.TypeAXFR || state.QType() == dns.TypeIXFR {
+		return dns.RcodeRefused, nil
+	}
+
+	answer, ns, extra, result := z.Lookup(ctx, state, qname)
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	m.Answer, m.Ns, m.Extra = answer, ns, extra
+
+	switch result {
+	case file.Success:
+	case file.NoData:
+	case file.NameError:
+		if k.Fall.Through(qname) {
+			return plugin.NextOrFailure(k.Name(), k.Next, ctx, w, r)
+		}
+		m.Rcode = dns.RcodeNameError
+	case file.Delegation:
+		m.Authoritative = false
+	case file.ServerFailure:
+		if len(m.Answer) == 0 {
+			return dns.RcodeServerFailure, nil
+		}
+		m.Rcode = dns.RcodeServerFailure
+	}
+
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+}
+
+// Name implements the Handler interface.
+func (k *Records) Name() string { return "k8s_records" }
@@ -0,0 +1,166 @@
+package records
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/fall"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/plugin/transfer"
+
+	"github.com/miekg/dns"
+)
+
+// newTestRecords returns a Records for example.org. with the zones of testZones and testRecords.
+func newTestRecords() *Records {
+	k := New([]string{"example.org."})
+	k.z = k.build(testZones(), testRecords(), 10)
+	k.names = []string{"example.org.", "sub.example.org."}
+	k.Next = test.NextHandler(dns.RcodeBadCookie, nil)
+	return k
+}
+
+func TestServeDNS(t *testing.T) {
+	k := newTestRecords()
+
+	ctx := context.TODO()
+	for i, tc := range dnsTestCases {
+		r := tc.Msg()
+		w := dnstest.NewRecorder(&test.ResponseWriter{})
+
+		if _, err := k.ServeDNS(ctx, w, r); err != nil {
+			t.Errorf("Test %d: expected no error, got %v", i, err)
+			continue
+		}
+		if w.Msg == nil {
+			t.Fatalf("Test %d: got nil message for %q", i, r.Question[0].Name)
+		}
+		if !w.Msg.Authoritative {
+			t.Errorf("Test %d: expected authoritative answer", i)
+		}
+		if err := test.SortAndCheck(w.Msg, tc); err != nil {
+			t.Errorf("Test %d: %v", i, err)
+		}
+	}
+}
+
+var dnsTestCases = []test.Case{
+	{
+		Qname: "example.org.", Qtype: dns.TypeTXT,
+		Answer: []dns.RR{test.TXT(`example.org.	300	IN	TXT	"verification=abc"`)},
+		Ns:     []dns.RR{test.NS("example.org.	300	IN	NS	ns1.example.org.")},
+	},
+	{
+		Qname: "example.org.", Qtype: dns.TypeMX,
+		Answer: []dns.RR{test.MX("example.org.	60	IN	MX	10 mx.example.net.")},
+		Ns:     []dns.RR{test.NS("example.org.	300	IN	NS	ns1.example.org.")},
+	},
+	{
+		Qname: "www.example.org.", Qtype: dns.TypeCNAME,
+		Answer: []dns.RR{test.CNAME("www.example.org.	300	IN	CNAME	app.saas.example.net.")},
+		Ns:     []dns.RR{test.NS("example.org.	300	IN	NS	ns1.example.org.")},
+	},
+	{
+		Qname: "api.sub.example.org.", Qtype: dns.TypeAAAA,
+		Answer: []dns.RR{
+			test.AAAA("api.sub.example.org.	300	IN	AAAA	2001:db8::1"),
+			test.AAAA("api.sub.example.org.	300	IN	AAAA	2001:db8::2"),
+		},
+		Ns: []dns.RR{test.NS("sub.example.org.	300	IN	NS	ns1.sub.example.org.")},
+	},
+	// NODATA
+	{
+		Qname: "api.sub.example.org.", Qtype: dns.TypeA,
+		Ns: []dns.RR{test.SOA("sub.example.org.	300	IN	SOA	ns1.sub.example.org. hostmaster.sub.example.org. 10 7200 1800 86400 300")},
+	},
+	// Not published by team-b, so NXDOMAIN
+	{
+		Qname: "app.example.org.", Qtype: dns.TypeA,
+		Rcode: dns.RcodeNameError,
+		Ns:    []dns.RR{test.SOA("example.org.	300	IN	SOA	ns1.example.org. hostmaster.example.org. 10 7200 1800 86400 300")},
+	},
+}
+
+func TestServeDNSNext(t *testing.T) {
+	k := newTestRecords()
+
+	tests := []struct {
+		qname string
+		fall  fall.F
+		next  bool
+	}{
+		{"example.net.", fall.Zero, true},         // not our zone
+		{"app.example.org.", fall.Zero, false},    // NXDOMAIN
+		{"app.example.org.", fall.Root, true},     // NXDOMAIN with fallthrough
+		{"www.example.org.", fall.Root, false},    // exists
+		{"app.sub.example.org.", fall.Root, true}, // NXDOMAIN in sub.example.org. with fallthrough
+	}
+
+	ctx := context.TODO()
+	for i, tc := range tests {
+		k.Fall = tc.fall
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, dns.TypeTXT)
+		w := dnstest.NewRecorder(&test.ResponseWriter{})
+
+		rcode, _ := k.ServeDNS(ctx, w, m)
+		if next := rcode == dns.RcodeBadCookie; next != tc.next {
+			t.Errorf("Test %d: expected next plugin to be called %t, got %t", i, tc.next, next)
+		}
+	}
+}
+
+func TestServeDNSNoZones(t *testing.T) {
+	k := New([]string{"example.org."})
+	k.Next = test.NextHandler(dns.RcodeBadCookie, nil)
+
+	m := new(dns.Msg)
+	m.SetQuestion("www.example.org.", dns.TypeA)
+	w := dnstest.NewRecorder(&test.ResponseWriter{})
+
+	if rcode, _ := k.ServeDNS(context.TODO(), w, m); rcode != dns.RcodeBadCookie {
+		t.Errorf("Expected the next plugin to be called without a DNSZone, got rcode %d", rcode)
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	k := newTestRecords()
+
+	if _, err := k.Transfer("example.com.", 0); err != transfer.ErrNotAuthoritative {
+		t.Errorf("Expected %v, got %v", transfer.ErrNotAuthoritative, err)
+	}
+	// Only the exact zone is transferred.
+	if _, err := k.Transfer("www.example.org.", 0); err != transfer.ErrNotAuthoritative {
+		t.Errorf("Expected %v, got %v", transfer.ErrNotAuthoritative, err)
+	}
+
+	ch, err := k.Transfer("sub.example.org.", 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var rrs []dns.RR
+	for x := range ch {
+		rrs = append(rrs, x...)
+	}
+	// SOA, NS, 2 AAAA and the closing SOA.
+	if len(rrs) != 5 {
+		t.Fatalf("Expected 5 records, got %d: %v", len(rrs), rrs)
+	}
+	if rrs[0].Header().Rrtype != dns.TypeSOA || rrs[4].Header().Rrtype != dns.TypeSOA {
+		t.Errorf("Expected transfer to start and end with the SOA, got %v", rrs)
+	}
+
+	// Up to date secondaries only get the SOA.
+	ch, err = k.Transfer("sub.example.org.", 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	rrs = nil
+	for x := range ch {
+		rrs = append(rrs, x...)
+	}
+	if len(rrs) != 1 {
+		t.Errorf("Expected only the SOA, got %v", rrs)
+	}
+}
@@ -0,0 +1,152 @@
+package records
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strconv"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/coremain"
+	"github.com/coredns/coredns/plugin"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/transfer"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const pluginName = "k8s_records"
+
+var log = clog.NewWithPlugin(pluginName)
+
+func init() { plugin.Register(pluginName, setup) }
+
+func setup(c *caddy.Controller) error {
+	k, err := parse(c)
+	if err != nil {
+		return plugin.Error(pluginName, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := make(chan struct{})
+
+	c.OnStartup(func() error {
+		t := dnsserver.GetConfig(c).Handler("transfer")
+		if t != nil {
+			k.transfer = t.(*transfer.Transfer)
+		}
+
+		config, err := k.getClientConfig()
+		if err != nil {
+			return plugin.Error(pluginName, err)
+		}
+		client, err := dynamic.NewForConfig(config)
+		if err != nil {
+			return plugin.Error(pluginName, fmt.Errorf("failed to create dynamic client: %q", err))
+		}
+		k.start(ctx, client, stop)
+		return nil
+	})
+
+	c.OnShutdown(func() error {
+		cancel()
+		close(stop)
+		if k.ctrl != nil {
+			return k.ctrl.Stop()
+		}
+		return nil
+	})
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		k.Next = next
+		return k
+	})
+
+	return nil
+}
+
+// start starts watching the DNSZone and DNSRecord objects with client, until stop is closed.
+func (k *Records) start(ctx context.Context, client dynamic.Interface, stop <-chan struct{}) {
+	k.ctrl = newController(ctx, client)
+	go k.ctrl.Run()
+	go k.run(stop)
+}
+
+func (k *Records) getClientConfig() (*rest.Config, error) {
+	var (
+		cc  *rest.Config
+		err error
+	)
+	if k.clientConfig != nil {
+		cc, err = k.clientConfig.ClientConfig()
+	} else {
+		cc, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, err
+	}
+	cc.UserAgent = fmt.Sprintf("%s/%s git_commit:%s (%s/%s/%s)", coremain.CoreName, coremain.CoreVersion, coremain.GitCommit, runtime.GOOS, runtime.GOARCH, runtime.Version())
+	return cc, nil
+}
+
+func parse(c *caddy.Controller) (*Records, error) {
+	var k *Records
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		k = New(plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys))
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "kubeconfig":
+				args := c.RemainingArgs()
+				if len(args) != 1 && len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				overrides := &clientcmd.ConfigOverrides{}
+				if len(args) == 2 {
+					overrides.CurrentContext = args[1]
+				}
+				k.clientConfig = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+					&clientcmd.ClientConfigLoadingRules{ExplicitPath: args[0]},
+					overrides,
+				)
+			case "namespaces":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, a := range args {
+					k.namespaces[a] = struct{}{}
+				}
+			case "ttl":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				t, err := strconv.Atoi(args[0])
+				if err != nil {
+					return nil, err
+				}
+				if t < 0 || t > 3600 {
+					return nil, c.Errf("ttl must be in range [0, 3600]: %d", t)
+				}
+				k.ttl = uint32(t)
+			case "fallthrough":
+				k.Fall.SetZonesFromArgs(c.RemainingArgs())
+			default:
+				return nil, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+	}
+
+	return k, nil
+}
@@ -0,0 +1,89 @@
+package records
+
+import (
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/fall"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		input               string
+		shouldErr           bool
+		expectedZones       []string
+		expectedTTL         uint32
+		expectedNamespaces  int
+		expectedKubeconfig  bool
+		expectedFallthrough fall.F
+	}{
+		{`k8s_records`, false, nil, defaultTTL, 0, false, fall.Zero},
+		{`k8s_records example.org example.net`, false, []string{"example.org.", "example.net."}, defaultTTL, 0, false, fall.Zero},
+		{`k8s_records example.org {
+	ttl 30
+	namespaces team-a team-b
+}`, false, []string{"example.org."}, 30, 2, false, fall.Zero},
+		{`k8s_records example.org {
+	kubeconfig /etc/kubeconfig.conf context
+}`, false, []string{"example.org."}, defaultTTL, 0, true, fall.Zero},
+		{`k8s_records example.org {
+	fallthrough
+}`, false, []string{"example.org."}, defaultTTL, 0, false, fall.Root},
+		{`k8s_records example.org {
+	ttl 3601
+}`, true, nil, 0, 0, false, fall.Zero},
+		{`k8s_records example.org {
+	ttl
+}`, true, nil, 0, 0, false, fall.Zero},
+		{`k8s_records example.org {
+	namespaces
+}`, true, nil, 0, 0, false, fall.Zero},
+		{`k8s_records example.org {
+	kubeconfig
+}`, true, nil, 0, 0, false, fall.Zero},
+		{`k8s_records example.org {
+	foo
+}`, true, nil, 0, 0, false, fall.Zero},
+		{`k8s_records
+k8s_records`, true, nil, 0, 0, false, fall.Zero},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		k, err := parse(c)
+
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but found none for input %s", i, test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error but found one for input %s. Error was: %v", i, test.input, err)
+			continue
+		}
+
+		if test.expectedZones != nil {
+			if len(k.Zones) != len(test.expectedZones) {
+				t.Fatalf("Test %d: expected zones %v, got: %v", i, test.expectedZones, k.Zones)
+			}
+			for j := range k.Zones {
+				if k.Zones[j] != test.expectedZones[j] {
+					t.Errorf("Test %d: expected zones %v, got: %v", i, test.expectedZones, k.Zones)
+				}
+			}
+		}
+		if k.ttl != test.expectedTTL {
+			t.Errorf("Test %d: expected ttl %d, got: %d", i, test.expectedTTL, k.ttl)
+		}
+		if len(k.namespaces) != test.expectedNamespaces {
+			t.Errorf("Test %d: expected %d namespaces, got: %d", i, test.expectedNamespaces, len(k.namespaces))
+		}
+		if (k.clientConfig != nil) != test.expectedKubeconfig {
+			t.Errorf("Test %d: expected kubeconfig %t, got: %t", i, test.expectedKubeconfig, k.clientConfig != nil)
+		}
+		if !k.Fall.Equal(test.expectedFallthrough) {
+			t.Errorf("Test %d: expected fallthrough %v, got: %v", i, test.expectedFallthrough, k.Fall)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package records
+
+import (
+	"github.com/coredns/coredns/plugin/transfer"
+
+	"github.com/miekg/dns"
+)
+
+// Transfer implements the transfer.Transferer interface.
+func (k *Records) Transfer(zone string, serial uint32) (<-chan []dns.RR, error) {
+	k.mu.RLock()
+	z, ok := k.z[zone]
+	k.mu.RUnlock()
+
+	if !ok || z == nil {
+		return nil, transfer.ErrNotAuthoritative
+	}
+	return z.Transfer(serial)
+}
+
+// Notify sends notifies for all zones with secondaries configured with the transfer plugin.
+func (k *Records) Notify() error {
+	k.mu.RLock()
+	names := k.names
+	k.mu.RUnlock()
+
+	var err error
+	for _, origin := range names {
+		e := k.transfer.Notify(origin)
+		if e != nil {
+			err = e
+		}
+	}
+	return err
+}
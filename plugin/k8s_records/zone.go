@@ -0,0 +1,215 @@
+package records
+
+import (
+	"sort"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/file"
+
+	"github.com/miekg/dns"
+)
+
+// run builds the zones once the controller has synced, and rebuilds them whenever the objects change,
+// until stop is closed.
+func (k *Records) run(stop <-chan struct{}) {
+	for !k.ctrl.HasSynced() {
+		select {
+		case <-stop:
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	for {
+		k.update(k.ctrl.ZoneList(), k.ctrl.RecordList())
+		k.synced.Store(true)
+		if err := k.Notify(); err != nil {
+			log.Warning(err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-k.ctrl.Changed():
+		}
+	}
+}
+
+// update replaces the zones with the ones built from zones and records.
+func (k *Records) update(zones []*dnsZone, records []*dnsRecord) {
+	k.mu.RLock()
+	serial := k.serial
+	k.mu.RUnlock()
+
+	// The serial is the unix time of the update, but it always goes up.
+	now := uint32(time.Now().Unix()) // #nosec G115 -- Unix time fits in uint32 until 2106
+	if now > serial {
+		serial = now
+	} else {
+		serial++
+	}
+
+	z := k.build(zones, records, serial)
+	names := make([]string, 0, len(z))
+	for origin := range z {
+		names = append(names, origin)
+	}
+	sort.Strings(names)
+
+	k.mu.Lock()
+	k.z, k.names, k.serial = z, names, serial
+	k.mu.Unlock()
+}
+
+// build returns the zones of the DNSZone objects in zones with the records of the DNSRecord objects in
+// records. Objects are handled oldest first, and when they conflict the oldest one wins:
+//
+//   - a DNSZone is ignored if its zone is not one of ours, or if an older DNSZone has the same zone;
+//   - a DNSZone below another DNSZone is ignored, unless its namespace is allowed to publish records in
+//     the enclosing zone;
+//   - a DNSRecord is added to the DNSZone with the longest zone that contains its name, if its namespace
+//     is allowed to publish records in there;
+//   - a CNAME DNSRecord is ignored if its name already has records, and other DNSRecords are ignored if
+//     their name has a CNAME.
+func (k *Records) build(zones []*dnsZone, records []*dnsRecord, serial uint32) map[string]*file.Zone {
+	sort.Slice(zones, func(i, j int) bool {
+		return older(zones[i].Created, zones[j].Created, zones[i].Namespace+"/"+zones[i].Name, zones[j].Namespace+"/"+zones[j].Name)
+	})
+	sort.Slice(records, func(i, j int) bool {
+		return older(records[i].Created, records[j].Created, records[i].Namespace+"/"+records[i].Name, records[j].Namespace+"/"+records[j].Name)
+	})
+
+	owners := make(map[string]*dnsZone)
+	origins := []string{}
+	for _, dz := range zones {
+		if !k.namespaceExposed(dz.Namespace) {
+			continue
+		}
+		origin := dz.Spec.Zone
+		if origin == "" || plugin.Zones(k.Zones).Matches(origin) == "" {
+			log.Warningf("DNSZone %s/%s: zone %q is not served by this plugin", dz.Namespace, dz.Name, origin)
+			continue
+		}
+		if o, ok := owners[origin]; ok {
+			log.Warningf("DNSZone %s/%s: zone %q is already defined by DNSZone %s/%s", dz.Namespace, dz.Name, origin, o.Namespace, o.Name)
+			continue
+		}
+		owners[origin] = dz
+		origins = append(origins, origin)
+	}
+
+	// A DNSZone below another DNSZone is only used if its namespace may publish records in the enclosing
+	// zone, otherwise it would take over names of that zone. The zones are checked from the top down, so
+	// the enclosing zone is settled first.
+	sort.SliceStable(origins, func(i, j int) bool { return dns.CountLabel(origins[i]) < dns.CountLabel(origins[j]) })
+	kept := make([]string, 0, len(origins))
+	for _, origin := range origins {
+		dz := owners[origin]
+		if parent := plugin.Zones(kept).Matches(origin); parent != "" && !owners[parent].allows(dz.Namespace) {
+			pz := owners[parent]
+			log.Warningf("DNSZone %s/%s: namespace %q may not define zones in DNSZone %s/%s", dz.Namespace, dz.Name, dz.Namespace, pz.Namespace, pz.Name)
+			delete(owners, origin)
+			continue
+		}
+		kept = append(kept, origin)
+	}
+	origins = kept
+
+	fz := make(map[string]*file.Zone, len(owners))
+	for origin, dz := range owners {
+		fz[origin] = k.newZone(dz, serial)
+	}
+
+	// types holds the types each name has, to find CNAMEs that conflict with other records.
+	types := make(map[string]map[uint16]struct{})
+	for _, dr := range records {
+		if !k.namespaceExposed(dr.Namespace) {
+			continue
+		}
+		origin := plugin.Zones(origins).Matches(dr.Spec.Name)
+		if origin == "" {
+			log.Warningf("DNSRecord %s/%s: no DNSZone for %q", dr.Namespace, dr.Name, dr.Spec.Name)
+			continue
+		}
+		if dz := owners[origin]; !dz.allows(dr.Namespace) {
+			log.Warningf("DNSRecord %s/%s: namespace %q may not publish records in DNSZone %s/%s", dr.Namespace, dr.Name, dr.Namespace, dz.Namespace, dz.Name)
+			continue
+		}
+		rrs, err := dr.rrs(k.ttl)
+		if err != nil {
+			log.Warningf("DNSRecord %s/%s: %s", dr.Namespace, dr.Name, err)
+			continue
+		}
+
+		name, qtype := rrs[0].Header().Name, rrs[0].Header().Rrtype
+		if conflicts(types[name], qtype) {
+			log.Warningf("DNSRecord %s/%s: %q can not have a CNAME and other records", dr.Namespace, dr.Name, name)
+			continue
+		}
+		if types[name] == nil {
+			types[name] = make(map[uint16]struct{})
+		}
+		types[name][qtype] = struct{}{}
+
+		for _, rr := range rrs {
+			fz[origin].Insert(rr)
+		}
+	}
+
+	return fz
+}
+
+// newZone returns the zone for dz, with only the apex records.
+func (k *Records) newZone(dz *dnsZone, serial uint32) *file.Zone {
+	origin := dz.Spec.Zone
+	z := file.NewZone(origin, "")
+	z.Upstream = k.upstream
+
+	mname := "ns.dns." + origin
+	if len(dz.Spec.Nameservers) > 0 {
+		mname = dz.Spec.Nameservers[0]
+	}
+	z.Insert(&dns.SOA{
+		Hdr:     dns.RR_Header{Name: origin, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: k.ttl},
+		Ns:      mname,
+		Mbox:    "hostmaster." + origin,
+		Serial:  serial,
+		Refresh: 7200,
+		Retry:   1800,
+		Expire:  86400,
+		Minttl:  k.ttl,
+	})
+	for _, ns := range dz.Spec.Nameservers {
+		z.Insert(&dns.NS{Hdr: dns.RR_Header{Name: origin, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: k.ttl}, Ns: ns})
+	}
+	return z
+}
+
+// namespaceExposed returns true when the objects in namespace are used.
+func (k *Records) namespaceExposed(namespace string) bool {
+	if len(k.namespaces) == 0 {
+		return true
+	}
+	_, ok := k.namespaces[namespace]
+	return ok
+}
+
+// conflicts returns true if a record of qtype can not be added to a name that has records of types.
+func conflicts(types map[uint16]struct{}, qtype uint16) bool {
+	if len(types) == 0 {
+		return false
+	}
+	if qtype == dns.TypeCNAME {
+		return true
+	}
+	_, ok := types[dns.TypeCNAME]
+	return ok
+}
+
+// older returns true if the object created at t1 with key1 sorts before the one created at t2 with key2.
+func older(t1, t2 time.Time, key1, key2 string) bool {
+	if !t1.Equal(t2) {
+		return t1.Before(t2)
+	}
+	return key1 < key2
+}
@@ -0,0 +1,219 @@
+package records
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var created = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func zone(namespace, name, origin string, age int, namespaces ...string) *dnsZone {
+	return &dnsZone{
+		Name:      name,
+		Namespace: namespace,
+		Created:   created.Add(time.Duration(age) * time.Minute),
+		Spec:      zoneSpec{Zone: origin, Namespaces: namespaces, Nameservers: []string{"ns1." + origin}},
+	}
+}
+
+func record(namespace, name, owner, qtype string, age int, data ...string) *dnsRecord {
+	return &dnsRecord{
+		Name:      name,
+		Namespace: namespace,
+		Created:   created.Add(time.Duration(age) * time.Minute),
+		Spec:      recordSpec{Name: owner, Type: qtype, Data: data},
+	}
+}
+
+// testZones returns the DNSZone objects of the tests: example.org. is owned by namespace infra, which
+// allows team-a and team-b to publish records in it. sub.example.org. is owned by team-b. A newer DNSZone
+// for example.org. in team-c and one for example.com., which is not ours, are ignored.
+func testZones() []*dnsZone {
+	return []*dnsZone{
+		zone("team-c", "org", "example.org.", 5),
+		zone("infra", "org", "example.org.", 0, "team-a", "team-b"),
+		zone("team-b", "sub", "sub.example.org.", 1),
+		zone("infra", "com", "example.com.", 0),
+	}
+}
+
+func testRecords() []*dnsRecord {
+	ttl := uint32(60)
+	r := record("infra", "apex-mx", "example.org.", "MX", 0, "10 mx.example.net.")
+	r.Spec.TTL = &ttl
+
+	return []*dnsRecord{
+		r,
+		record("team-a", "verify", "example.org.", "TXT", 1, `"verification=abc"`),
+		record("team-a", "www", "www.example.org.", "CNAME", 1, "app.saas.example.net."),
+		record("infra", "www-a", "www.example.org.", "A", 2, "192.0.2.1"),                        // conflicts with the older CNAME
+		record("team-c", "app", "app.example.org.", "A", 1, "192.0.2.2"),                         // team-c may not publish in example.org.
+		record("team-b", "api", "api.sub.example.org.", "AAAA", 1, "2001:db8::1", "2001:db8::2"), // in the zone of team-b
+		record("team-a", "sub", "team-a.sub.example.org.", "A", 1, "192.0.2.3"),                  // team-a may not publish in sub.example.org.
+		record("infra", "mail", "mail.example.com.", "A", 1, "192.0.2.4"),                        // no DNSZone
+		record("team-a", "bad", "bad.example.org.", "A", 1, "not-an-ip"),
+		record("team-a", "soa", "example.org.", "SOA", 1, "ns. hostmaster. 1 2 3 4 5"),
+	}
+}
+
+func TestBuild(t *testing.T) {
+	k := New([]string{"example.org."})
+	z := k.build(testZones(), testRecords(), 10)
+
+	if len(z) != 2 {
+		t.Fatalf("Expected 2 zones, got %d", len(z))
+	}
+	if _, ok := z["example.com."]; ok {
+		t.Errorf("Expected no zone for example.com.")
+	}
+
+	tests := []struct {
+		zone     string
+		expected []string
+	}{
+		{
+			"example.org.", []string{
+				"example.org.\t300\tIN\tSOA\tns1.example.org. hostmaster.example.org. 10 7200 1800 86400 300",
+				"example.org.\t300\tIN\tNS\tns1.example.org.",
+				"example.org.\t300\tIN\tTXT\t\"verification=abc\"",
+				"example.org.\t60\tIN\tMX\t10 mx.example.net.",
+				"www.example.org.\t300\tIN\tCNAME\tapp.saas.example.net.",
+			},
+		},
+		{
+			"sub.example.org.", []string{
+				"sub.example.org.\t300\tIN\tSOA\tns1.sub.example.org. hostmaster.sub.example.org. 10 7200 1800 86400 300",
+				"sub.example.org.\t300\tIN\tNS\tns1.sub.example.org.",
+				"api.sub.example.org.\t300\tIN\tAAAA\t2001:db8::1",
+				"api.sub.example.org.\t300\tIN\tAAAA\t2001:db8::2",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		ch, err := z[tc.zone].Transfer(0)
+		if err != nil {
+			t.Fatalf("Zone %s: %s", tc.zone, err)
+		}
+		var rrs []dns.RR
+		for x := range ch {
+			rrs = append(rrs, x...)
+		}
+		rrs = rrs[:len(rrs)-1] // the closing SOA
+
+		if len(rrs) != len(tc.expected) {
+			t.Fatalf("Zone %s: expected %d records, got %d: %v", tc.zone, len(tc.expected), len(rrs), rrs)
+		}
+		// The records of a name are not ordered.
+		got := make([]string, len(rrs))
+		for i, rr := range rrs {
+			got[i] = rr.String()
+		}
+		sort.Strings(got)
+		sort.Strings(tc.expected)
+		for i := range got {
+			if got[i] != tc.expected[i] {
+				t.Errorf("Zone %s: expected record %q, got %q", tc.zone, tc.expected[i], got[i])
+			}
+		}
+	}
+}
+
+func TestBuildNamespaces(t *testing.T) {
+	k := New([]string{"example.org."})
+	k.namespaces = map[string]struct{}{"team-b": {}}
+	z := k.build(testZones(), testRecords(), 10)
+
+	if len(z) != 1 {
+		t.Fatalf("Expected 1 zone, got %d", len(z))
+	}
+	if _, ok := z["sub.example.org."]; !ok {
+		t.Errorf("Expected zone sub.example.org.")
+	}
+}
+
+func TestBuildNestedZone(t *testing.T) {
+	k := New([]string{"example.org."})
+	zones := []*dnsZone{
+		zone("infra", "corp", "corp.example.org.", 1, "team-a"),
+		zone("team-a", "dev", "dev.corp.example.org.", 2),
+		zone("team-c", "www", "www.corp.example.org.", 0), // older, but team-c may not publish in corp.example.org.
+		zone("team-c", "old", "old.www.corp.example.org.", 0),
+	}
+	records := []*dnsRecord{
+		record("team-a", "api", "api.dev.corp.example.org.", "A", 3, "192.0.2.1"),
+		record("team-c", "www", "www.corp.example.org.", "A", 3, "192.0.2.2"),
+		record("team-c", "old", "old.www.corp.example.org.", "A", 3, "192.0.2.3"),
+	}
+	z := k.build(zones, records, 10)
+
+	if len(z) != 2 {
+		t.Fatalf("Expected 2 zones, got %d", len(z))
+	}
+	for _, origin := range []string{"www.corp.example.org.", "old.www.corp.example.org."} {
+		if _, ok := z[origin]; ok {
+			t.Errorf("Expected no zone for %s", origin)
+		}
+	}
+	if _, ok := z["dev.corp.example.org."].Search("api.dev.corp.example.org."); !ok {
+		t.Errorf("Expected api.dev.corp.example.org. to be published")
+	}
+	// The records of team-c fall in corp.example.org., where team-c may not publish.
+	for _, name := range []string{"www.corp.example.org.", "old.www.corp.example.org."} {
+		if _, ok := z["corp.example.org."].Search(name); ok {
+			t.Errorf("Expected %s not to be published", name)
+		}
+	}
+}
+
+func TestUpdateSerial(t *testing.T) {
+	k := New([]string{"example.org."})
+	k.serial = 4294967000 // in the future
+
+	k.update(testZones(), testRecords())
+	if k.serial != 4294967001 {
+		t.Errorf("Expected serial %d, got %d", 4294967001, k.serial)
+	}
+	if len(k.names) != 2 || k.names[0] != "example.org." || k.names[1] != "sub.example.org." {
+		t.Errorf("Expected names [example.org. sub.example.org.], got %v", k.names)
+	}
+}
+
+func TestRRs(t *testing.T) {
+	ttl := uint32(10)
+	tests := []struct {
+		r         *dnsRecord
+		shouldErr bool
+		expected  string
+	}{
+		{record("ns", "a", "a.example.org.", "a", 0, "192.0.2.1"), false, "a.example.org.\t300\tIN\tA\t192.0.2.1"},
+		{&dnsRecord{Spec: recordSpec{Name: "a.example.org.", Type: "A", TTL: &ttl, Data: []string{"192.0.2.1"}}}, false, "a.example.org.\t10\tIN\tA\t192.0.2.1"},
+		{record("ns", "txt", "t.example.org.", "TXT", 0, `"a b" c`), false, "t.example.org.\t300\tIN\tTXT\t\"a b\" \"c\""},
+		{record("ns", "noname", "", "A", 0, "192.0.2.1"), true, ""},
+		{record("ns", "notype", "a.example.org.", "FOO", 0, "192.0.2.1"), true, ""},
+		{record("ns", "nodata", "a.example.org.", "A", 0), true, ""},
+		{record("ns", "soa", "a.example.org.", "SOA", 0, "ns. hostmaster. 1 2 3 4 5"), true, ""},
+		{record("ns", "newline", "t.example.org.", "TXT", 0, "a\nb.example.org. IN A 192.0.2.1"), true, ""},
+		{record("ns", "bad", "a.example.org.", "A", 0, "192.0.2"), true, ""},
+	}
+
+	for i, tc := range tests {
+		rrs, err := tc.r.rrs(defaultTTL)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got %v", i, rrs)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		if len(rrs) != 1 || rrs[0].String() != tc.expected {
+			t.Errorf("Test %d: expected %q, got %v", i, tc.expected, rrs)
+		}
+	}
+}
@@ -211,7 +211,11 @@ func (k *Kubernetes) ExternalServices(zone string, headless bool) (services []ms
 
 // ExternalSerial returns the serial of the external zone
 func (k *Kubernetes) ExternalSerial(string) uint32 {
-	return uint32(k.APIConn.Modified(ModifiedExternal)) // #nosec G115 -- Unix time to SOA serial
+	modified := k.APIConn.Modified(ModifiedExternal)
+	if k.routes != nil {
+		modified = max(modified, k.routes.Modified())
+	}
+	return uint32(modified) // #nosec G115 -- Unix time to SOA serial
 }
 
 // ExternalReverse does a reverse lookup for the external IPs
@@ -236,3 +240,146 @@ func (k *Kubernetes) serviceRecordForExternalIP(ip string) []msg.Service {
 	}
 	return svcs
 }
+
+// ExternalRoutes returns the addresses for name from the Ingresses and Gateway API routes watched since
+// WatchRoutes. A host name of a route matches name exactly, or as a wildcard; an Ingress wildcard only
+// matches a single label, a route wildcard any number of them. Exact matches hide wildcard matches.
+func (k *Kubernetes) ExternalRoutes(name string) []msg.Service {
+	if k.routes == nil {
+		return nil
+	}
+	host := strings.TrimSuffix(strings.ToLower(name), ".")
+	if host == "" {
+		return nil
+	}
+
+	addrs := k.hostAddresses(host, host, true)
+	// Routes without host names use the host names of their listeners.
+	for _, r := range k.routes.RouteIndex("") {
+		addrs = append(addrs, k.gatewayAddresses(r, host)...)
+	}
+	if len(addrs) == 0 {
+		labels := dns.SplitDomainName(host)
+		for i := 1; i < len(labels) && len(addrs) == 0; i++ {
+			addrs = k.hostAddresses("*."+strings.Join(labels[i:], "."), host, i == 1)
+		}
+	}
+
+	key := msg.Path(dns.Fqdn(host), coredns)
+	services := make([]msg.Service, 0, len(addrs))
+	seen := make(map[string]struct{}, len(addrs))
+	for _, a := range addrs {
+		if _, ok := seen[a]; ok {
+			continue
+		}
+		seen[a] = struct{}{}
+		services = append(services, msg.Service{Host: a, TTL: k.ttl, Key: key})
+	}
+	return services
+}
+
+// hostAddresses returns the addresses of the routes with host name hostname, and of the Ingresses with it
+// if ingress is true. A route that is attached to some of its listeners only gets the addresses of the
+// Gateway if one of those listeners accepts host.
+func (k *Kubernetes) hostAddresses(hostname, host string, ingress bool) (addrs []string) {
+	if ingress {
+		for _, i := range k.routes.IngressIndex(hostname) {
+			if k.namespaceExposed(i.Namespace) {
+				addrs = append(addrs, i.Addresses...)
+			}
+		}
+	}
+	for _, r := range k.routes.RouteIndex(hostname) {
+		addrs = append(addrs, k.gatewayAddresses(r, host)...)
+	}
+	return addrs
+}
+
+// gatewayAddresses returns the addresses of the Gateways r is attached to, for host. If r has no host
+// names, only the listeners with a host name that matches host are used.
+func (k *Kubernetes) gatewayAddresses(r *object.Route, host string) (addrs []string) {
+	if !k.namespaceExposed(r.Namespace) {
+		return nil
+	}
+	for _, p := range r.Parents {
+		for _, g := range k.routes.GatewayIndex(object.GatewayKey(p.Name, p.Namespace)) {
+			if len(r.Hostnames) > 0 && p.SectionName == "" {
+				addrs = append(addrs, g.Addresses...)
+				continue
+			}
+			for _, l := range g.Listeners {
+				if p.SectionName != "" && l.Name != p.SectionName {
+					continue
+				}
+				if len(r.Hostnames) == 0 && !matchHostname(l.Hostname, host) {
+					continue
+				}
+				addrs = append(addrs, g.Addresses...)
+				break
+			}
+		}
+	}
+	return addrs
+}
+
+// matchHostname returns true if the Gateway API hostname matches host. The wildcard *.example.org
+// matches names below example.org, but not example.org itself. An empty hostname matches nothing.
+func matchHostname(hostname, host string) bool {
+	if suffix, ok := strings.CutPrefix(hostname, "*"); ok {
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+	return hostname != "" && hostname == host
+}
+
+// ExternalRouteServices returns a msg.Service for each address of each host name in zone of the Ingresses
+// and Gateway API routes watched since WatchRoutes. The host name is in the key.
+func (k *Kubernetes) ExternalRouteServices(zone string) []msg.Service {
+	if k.routes == nil {
+		return nil
+	}
+	type item struct{ name, addr string }
+	var (
+		services []msg.Service
+		seen     = make(map[item]struct{})
+	)
+	add := func(hostname string, addrs []string) {
+		name := dns.Fqdn(hostname)
+		if !dns.IsSubDomain(dns.Fqdn(zone), name) {
+			return
+		}
+		for _, a := range addrs {
+			if _, ok := seen[item{name, a}]; ok {
+				continue
+			}
+			seen[item{name, a}] = struct{}{}
+			services = append(services, msg.Service{Host: a, TTL: k.ttl, Key: msg.Path(name, coredns)})
+		}
+	}
+
+	for _, i := range k.routes.IngressList() {
+		if !k.namespaceExposed(i.Namespace) {
+			continue
+		}
+		for _, h := range i.Hosts {
+			add(h, i.Addresses)
+		}
+	}
+	for _, r := range k.routes.RouteList() {
+		if len(r.Hostnames) > 0 {
+			for _, h := range r.Hostnames {
+				add(h, k.gatewayAddresses(r, h))
+			}
+			continue
+		}
+		for _, p := range r.Parents {
+			for _, g := range k.routes.GatewayIndex(object.GatewayKey(p.Name, p.Namespace)) {
+				for _, l := range g.Listeners {
+					if l.Hostname != "" && (p.SectionName == "" || l.Name == p.SectionName) {
+						add(l.Hostname, k.gatewayAddresses(r, l.Hostname))
+					}
+				}
+			}
+		}
+	}
+	return services
+}
@@ -41,6 +41,8 @@ type Kubernetes struct {
 	APIClientKey     string
 	ClientConfig     clientcmd.ClientConfig
 	APIConn          dnsController
+	routes           routeController // nil unless WatchRoutes was called
+	restConfig       *rest.Config
 	Namespaces       map[string]struct{}
 	podMode          string
 	endpointNameMode bool
@@ -307,6 +309,7 @@ func (k *Kubernetes) InitKubeCache(ctx context.Context) (onStart func() error, o
 	k.opts.endpointNameMode = k.endpointNameMode
 
 	k.APIConn = newdnsController(ctx, kubeClient, mcsClient, k.opts)
+	k.restConfig = config
 
 	onStart = func() error {
 		go func() {
@@ -323,7 +326,7 @@ func (k *Kubernetes) InitKubeCache(ctx context.Context) (onStart func() error, o
 		for {
 			select {
 			case <-checkSyncTicker.C:
-				if k.APIConn.HasSynced() {
+				if k.APIConn.HasSynced() && (k.routes == nil || k.routes.HasSynced()) {
 					return nil
 				}
 			case <-logTicker.C:
@@ -336,6 +339,9 @@ func (k *Kubernetes) InitKubeCache(ctx context.Context) (onStart func() error, o
 	}
 
 	onShut = func() error {
+		if k.routes != nil {
+			k.routes.Stop()
+		}
 		return k.APIConn.Stop()
 	}
 
@@ -92,7 +92,30 @@ func deepCopyCases() []struct {
 				AppProtocol: ptrTo("kubernetes.io/h2c"),
 			}},
 		}},
-		{"Namespace", &Namespace{Version: "1", Name: "testns"}},
+		{"Namespace", &Namespace{Version: "1", Name: "testns", Annotations: map[string]string{NamespaceAnnotationPrefix + "deny": `["example.org."]`}}},
+		{"Ingress", &Ingress{
+			Version:   "1",
+			Name:      "ing1",
+			Namespace: "testns",
+			Hosts:     []string{"app.example.org"},
+			Addresses: []string{"1.2.3.4"},
+		}},
+		{"Gateway", &Gateway{
+			Version:   "1",
+			Name:      "gw1",
+			Namespace: "testns",
+			Index:     GatewayKey("gw1", "testns"),
+			Listeners: []Listener{{Name: "https", Hostname: "*.example.org"}},
+			Addresses: []string{"1.2.3.5"},
+		}},
+		{"Route", &Route{
+			Version:   "1",
+			Kind:      "HTTPRoute",
+			Name:      "route1",
+			Namespace: "testns",
+			Hostnames: []string{"www.example.org"},
+			Parents:   []ParentRef{{Name: "gw1", Namespace: "testns", SectionName: "https"}},
+		}},
 	}
 }
 
@@ -2,6 +2,7 @@ package object
 
 import (
 	"fmt"
+	"strings"
 
 	api "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -13,10 +14,16 @@ type Namespace struct {
 	// Don't add new fields to this struct without talking to the CoreDNS maintainers.
 	Version string
 	Name    string
+	// Annotations only holds the annotations with the NamespaceAnnotationPrefix.
+	Annotations map[string]string
 
 	*Empty
 }
 
+// NamespaceAnnotationPrefix is the prefix of the namespace annotations that are kept, they are used for the
+// DNS policy of the namespace.
+const NamespaceAnnotationPrefix = "dns.coredns.io/"
+
 // ToNamespace returns a function that converts an api.Namespace to a *Namespace.
 func ToNamespace(obj meta.Object) (meta.Object, error) {
 	ns, ok := obj.(*api.Namespace)
@@ -27,6 +34,15 @@ func ToNamespace(obj meta.Object) (meta.Object, error) {
 		Version: ns.GetResourceVersion(),
 		Name:    ns.GetName(),
 	}
+	for k, v := range ns.GetAnnotations() {
+		if !strings.HasPrefix(k, NamespaceAnnotationPrefix) {
+			continue
+		}
+		if n.Annotations == nil {
+			n.Annotations = make(map[string]string)
+		}
+		n.Annotations[k] = v
+	}
 	*ns = api.Namespace{}
 	return n, nil
 }
@@ -39,6 +55,12 @@ func (n *Namespace) DeepCopyObject() runtime.Object {
 		Version: n.Version,
 		Name:    n.Name,
 	}
+	if n.Annotations != nil {
+		n1.Annotations = make(map[string]string, len(n.Annotations))
+		for k, v := range n.Annotations {
+			n1.Annotations[k] = v
+		}
+	}
 	return n1
 }
 
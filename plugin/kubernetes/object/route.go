@@ -0,0 +1,307 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	gw "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// Ingress is a stripped down networking.Ingress with only the items we need for CoreDNS.
+type Ingress struct {
+	Version   string
+	Name      string
+	Namespace string
+	// Hosts are the hosts of the rules, lower cased and without a trailing dot.
+	Hosts []string
+	// Addresses are the IPs and host names of the load balancer.
+	Addresses []string
+
+	*Empty
+}
+
+// ToIngress converts a networking.Ingress to an *Ingress.
+func ToIngress(obj meta.Object) (meta.Object, error) {
+	ing, ok := obj.(*networking.Ingress)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object %v", obj)
+	}
+	i := &Ingress{
+		Version:   ing.GetResourceVersion(),
+		Name:      ing.GetName(),
+		Namespace: ing.GetNamespace(),
+	}
+	for _, r := range ing.Spec.Rules {
+		if r.Host != "" {
+			i.Hosts = appendHost(i.Hosts, r.Host)
+		}
+	}
+	for _, lb := range ing.Status.LoadBalancer.Ingress {
+		if lb.IP != "" {
+			i.Addresses = append(i.Addresses, lb.IP)
+			continue
+		}
+		if lb.Hostname != "" {
+			i.Addresses = append(i.Addresses, lb.Hostname)
+		}
+	}
+
+	*ing = networking.Ingress{}
+	return i, nil
+}
+
+var _ runtime.Object = &Ingress{}
+
+// DeepCopyObject implements the ObjectKind interface.
+func (i *Ingress) DeepCopyObject() runtime.Object {
+	i1 := &Ingress{
+		Version:   i.Version,
+		Name:      i.Name,
+		Namespace: i.Namespace,
+		Hosts:     make([]string, len(i.Hosts)),
+		Addresses: make([]string, len(i.Addresses)),
+	}
+	copy(i1.Hosts, i.Hosts)
+	copy(i1.Addresses, i.Addresses)
+	return i1
+}
+
+// GetNamespace implements the meta.Object interface.
+func (i *Ingress) GetNamespace() string { return i.Namespace }
+
+// SetNamespace implements the meta.Object interface.
+func (i *Ingress) SetNamespace(_namespace string) {}
+
+// GetName implements the meta.Object interface.
+func (i *Ingress) GetName() string { return i.Name }
+
+// SetName implements the meta.Object interface.
+func (i *Ingress) SetName(_name string) {}
+
+// GetResourceVersion implements the meta.Object interface.
+func (i *Ingress) GetResourceVersion() string { return i.Version }
+
+// SetResourceVersion implements the meta.Object interface.
+func (i *Ingress) SetResourceVersion(_version string) {}
+
+// Gateway is a stripped down Gateway API Gateway with only the items we need for CoreDNS.
+type Gateway struct {
+	Version   string
+	Name      string
+	Namespace string
+	Index     string
+	Listeners []Listener
+	// Addresses are the IPs and host names the gateway is reachable on.
+	Addresses []string
+
+	*Empty
+}
+
+// Listener is a listener of a Gateway. Hostname is empty if the listener accepts any host name.
+type Listener struct {
+	Name     string
+	Hostname string
+}
+
+// GatewayKey returns a string using for the index.
+func GatewayKey(name, namespace string) string { return name + "." + namespace }
+
+// ToGateway converts a Gateway API Gateway to a *Gateway.
+func ToGateway(obj meta.Object) (meta.Object, error) {
+	gtw, ok := obj.(*gw.Gateway)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object %v", obj)
+	}
+	g := &Gateway{
+		Version:   gtw.GetResourceVersion(),
+		Name:      gtw.GetName(),
+		Namespace: gtw.GetNamespace(),
+		Index:     GatewayKey(gtw.GetName(), gtw.GetNamespace()),
+		Listeners: make([]Listener, len(gtw.Spec.Listeners)),
+	}
+	for i, l := range gtw.Spec.Listeners {
+		g.Listeners[i].Name = string(l.Name)
+		if l.Hostname != nil {
+			g.Listeners[i].Hostname = normalizeHost(string(*l.Hostname))
+		}
+	}
+	for _, a := range gtw.Status.Addresses {
+		if a.Type != nil && *a.Type != gw.IPAddressType && *a.Type != gw.HostnameAddressType {
+			continue
+		}
+		if a.Value != "" {
+			g.Addresses = append(g.Addresses, a.Value)
+		}
+	}
+
+	*gtw = gw.Gateway{}
+	return g, nil
+}
+
+var _ runtime.Object = &Gateway{}
+
+// DeepCopyObject implements the ObjectKind interface.
+func (g *Gateway) DeepCopyObject() runtime.Object {
+	g1 := &Gateway{
+		Version:   g.Version,
+		Name:      g.Name,
+		Namespace: g.Namespace,
+		Index:     g.Index,
+		Listeners: make([]Listener, len(g.Listeners)),
+		Addresses: make([]string, len(g.Addresses)),
+	}
+	copy(g1.Listeners, g.Listeners)
+	copy(g1.Addresses, g.Addresses)
+	return g1
+}
+
+// GetNamespace implements the meta.Object interface.
+func (g *Gateway) GetNamespace() string { return g.Namespace }
+
+// SetNamespace implements the meta.Object interface.
+func (g *Gateway) SetNamespace(_namespace string) {}
+
+// GetName implements the meta.Object interface.
+func (g *Gateway) GetName() string { return g.Name }
+
+// SetName implements the meta.Object interface.
+func (g *Gateway) SetName(_name string) {}
+
+// GetResourceVersion implements the meta.Object interface.
+func (g *Gateway) GetResourceVersion() string { return g.Version }
+
+// SetResourceVersion implements the meta.Object interface.
+func (g *Gateway) SetResourceVersion(_version string) {}
+
+// Route is a stripped down Gateway API HTTPRoute or GRPCRoute with only the items we need for CoreDNS.
+type Route struct {
+	Version   string
+	Kind      string
+	Name      string
+	Namespace string
+	// Hostnames are the host names of the route, lower cased. If empty, the route uses the host names
+	// of the listeners it is attached to.
+	Hostnames []string
+	// Parents are the Gateways that accepted the route.
+	Parents []ParentRef
+
+	*Empty
+}
+
+// ParentRef refers to a Gateway a route is attached to, and if SectionName is set, to one of its
+// listeners.
+type ParentRef struct {
+	Name        string
+	Namespace   string
+	SectionName string
+}
+
+// ToHTTPRoute converts a Gateway API HTTPRoute to a *Route.
+func ToHTTPRoute(obj meta.Object) (meta.Object, error) {
+	rt, ok := obj.(*gw.HTTPRoute)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object %v", obj)
+	}
+	r := toRoute("HTTPRoute", rt, rt.Spec.Hostnames, rt.Status.Parents)
+	*rt = gw.HTTPRoute{}
+	return r, nil
+}
+
+// ToGRPCRoute converts a Gateway API GRPCRoute to a *Route.
+func ToGRPCRoute(obj meta.Object) (meta.Object, error) {
+	rt, ok := obj.(*gw.GRPCRoute)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object %v", obj)
+	}
+	r := toRoute("GRPCRoute", rt, rt.Spec.Hostnames, rt.Status.Parents)
+	*rt = gw.GRPCRoute{}
+	return r, nil
+}
+
+// toRoute returns a *Route for a route with hostnames and parents. Only the Gateways that accepted the
+// route are kept as parents.
+func toRoute(kind string, obj meta.Object, hostnames []gw.Hostname, parents []gw.RouteParentStatus) *Route {
+	r := &Route{
+		Version:   obj.GetResourceVersion(),
+		Kind:      kind,
+		Name:      obj.GetName(),
+		Namespace: obj.GetNamespace(),
+	}
+	for _, h := range hostnames {
+		r.Hostnames = appendHost(r.Hostnames, string(h))
+	}
+	for _, p := range parents {
+		ref := p.ParentRef
+		if ref.Group != nil && *ref.Group != gw.GroupName {
+			continue
+		}
+		if ref.Kind != nil && *ref.Kind != "Gateway" {
+			continue
+		}
+		if !apimeta.IsStatusConditionTrue(p.Conditions, string(gw.RouteConditionAccepted)) {
+			continue
+		}
+		pr := ParentRef{Name: string(ref.Name), Namespace: r.Namespace}
+		if ref.Namespace != nil {
+			pr.Namespace = string(*ref.Namespace)
+		}
+		if ref.SectionName != nil {
+			pr.SectionName = string(*ref.SectionName)
+		}
+		r.Parents = append(r.Parents, pr)
+	}
+	return r
+}
+
+var _ runtime.Object = &Route{}
+
+// DeepCopyObject implements the ObjectKind interface.
+func (r *Route) DeepCopyObject() runtime.Object {
+	r1 := &Route{
+		Version:   r.Version,
+		Kind:      r.Kind,
+		Name:      r.Name,
+		Namespace: r.Namespace,
+		Hostnames: make([]string, len(r.Hostnames)),
+		Parents:   make([]ParentRef, len(r.Parents)),
+	}
+	copy(r1.Hostnames, r.Hostnames)
+	copy(r1.Parents, r.Parents)
+	return r1
+}
+
+// GetNamespace implements the meta.Object interface.
+func (r *Route) GetNamespace() string { return r.Namespace }
+
+// SetNamespace implements the meta.Object interface.
+func (r *Route) SetNamespace(_namespace string) {}
+
+// GetName implements the meta.Object interface.
+func (r *Route) GetName() string { return r.Name }
+
+// SetName implements the meta.Object interface.
+func (r *Route) SetName(_name string) {}
+
+// GetResourceVersion implements the meta.Object interface.
+func (r *Route) GetResourceVersion() string { return r.Version }
+
+// SetResourceVersion implements the meta.Object interface.
+func (r *Route) SetResourceVersion(_version string) {}
+
+// normalizeHost lower cases host and removes a trailing dot.
+func normalizeHost(host string) string { return strings.TrimSuffix(strings.ToLower(host), ".") }
+
+// appendHost appends the normalized host to hosts, unless it is already in there.
+func appendHost(hosts []string, host string) []string {
+	host = normalizeHost(host)
+	for _, h := range hosts {
+		if h == host {
+			return hosts
+		}
+	}
+	return append(hosts, host)
+}
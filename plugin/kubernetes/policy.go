@@ -0,0 +1,17 @@
+package kubernetes
+
+import "github.com/coredns/coredns/plugin/kubernetes/object"
+
+// ClientNamespace returns the namespace of the pod with IP ip, it is used by the k8s_policy plugin. It
+// returns nil if the pod or its namespace can not be found, this needs "pods verified".
+func (k *Kubernetes) ClientNamespace(ip string) *object.Namespace {
+	pod := k.podWithIP(ip)
+	if pod == nil {
+		return nil
+	}
+	ns, err := k.APIConn.GetNamespaceByName(pod.Namespace)
+	if err != nil {
+		return nil
+	}
+	return ns
+}
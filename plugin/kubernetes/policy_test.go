@@ -0,0 +1,20 @@
+package kubernetes
+
+import "testing"
+
+func TestClientNamespace(t *testing.T) {
+	k := New([]string{"cluster.local."})
+	k.APIConn = &APIConnServeTest{}
+
+	if ns := k.ClientNamespace("10.240.0.1"); ns != nil {
+		t.Errorf("Expected no namespace without pods verified, got %v", ns)
+	}
+
+	k.podMode = podModeVerified
+	if ns := k.ClientNamespace("10.240.0.1"); ns == nil || ns.Name != "podns" {
+		t.Errorf("Expected namespace podns, got %v", ns)
+	}
+	if ns := k.ClientNamespace("10.240.0.2"); ns != nil {
+		t.Errorf("Expected no namespace for an unknown IP, got %v", ns)
+	}
+}
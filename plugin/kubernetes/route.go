@@ -0,0 +1,401 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coredns/coredns/plugin/kubernetes/object"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	gw "sigs.k8s.io/gateway-api/apis/v1"
+	gwClientset "sigs.k8s.io/gateway-api/pkg/client/clientset/versioned"
+)
+
+const (
+	ingressHostIndex          = "IngressHost"
+	routeHostnameIndex        = "RouteHostname"
+	gatewayNameNamespaceIndex = "GatewayNameNamespace"
+)
+
+// routeController watches the objects that route traffic into the cluster by host name: Ingresses, and
+// Gateway API Gateways, HTTPRoutes and GRPCRoutes. They are only used by the k8s_external plugin.
+type routeController interface {
+	IngressList() []*object.Ingress
+	RouteList() []*object.Route
+	// IngressIndex returns the Ingresses with a rule for host.
+	IngressIndex(host string) []*object.Ingress
+	// RouteIndex returns the routes with hostname, the empty hostname returns the routes without
+	// hostnames.
+	RouteIndex(hostname string) []*object.Route
+	// GatewayIndex returns the Gateways with the key object.GatewayKey.
+	GatewayIndex(key string) []*object.Gateway
+
+	Run()
+	HasSynced() bool
+	Stop() error
+
+	// Modified returns the timestamp of the most recent changes.
+	Modified() int64
+}
+
+type routeControl struct {
+	// modified tracks timestamp of the most recent changes
+	modified atomic.Int64
+
+	client   kubernetes.Interface
+	gwClient gwClientset.Interface
+	selector labels.Selector
+
+	controllers []cache.Controller
+
+	ingressLister   cache.Indexer
+	gatewayLister   cache.Indexer
+	httpRouteLister cache.Indexer
+	grpcRouteLister cache.Indexer
+
+	// stopLock is used to enforce only a single call to Stop is active.
+	stopLock sync.Mutex
+	shutdown bool
+	stopCh   chan struct{}
+}
+
+// newRouteController returns a controller that watches Ingresses if kubeClient is not nil, and Gateway API
+// objects if gwClient is not nil. Ingresses and routes are filtered with selector.
+func newRouteController(ctx context.Context, kubeClient kubernetes.Interface, gwClient gwClientset.Interface, selector labels.Selector) *routeControl {
+	rc := routeControl{
+		client:   kubeClient,
+		gwClient: gwClient,
+		selector: selector,
+		stopCh:   make(chan struct{}),
+	}
+	handler := cache.ResourceEventHandlerFuncs{AddFunc: rc.Add, UpdateFunc: rc.Update, DeleteFunc: rc.Delete}
+
+	if kubeClient != nil {
+		var c cache.Controller
+		rc.ingressLister, c = object.NewIndexerInformer(
+			cache.ToListWatcherWithWatchListSemantics(
+				&cache.ListWatch{
+					ListFunc: func(opts meta.ListOptions) (runtime.Object, error) {
+						rc.selectorOptions(&opts)
+						return kubeClient.NetworkingV1().Ingresses(api.NamespaceAll).List(ctx, opts)
+					},
+					WatchFunc: func(opts meta.ListOptions) (watch.Interface, error) {
+						rc.selectorOptions(&opts)
+						return kubeClient.NetworkingV1().Ingresses(api.NamespaceAll).Watch(ctx, opts)
+					},
+				},
+				kubeClient,
+			),
+			&networking.Ingress{},
+			handler,
+			cache.Indexers{ingressHostIndex: ingressHostIndexFunc},
+			object.DefaultProcessor(object.ToIngress, nil),
+		)
+		rc.controllers = append(rc.controllers, c)
+	}
+
+	if gwClient != nil {
+		var c cache.Controller
+		rc.gatewayLister, c = object.NewIndexerInformer(
+			cache.ToListWatcherWithWatchListSemantics(
+				&cache.ListWatch{
+					ListFunc: func(opts meta.ListOptions) (runtime.Object, error) {
+						return gwClient.GatewayV1().Gateways(api.NamespaceAll).List(ctx, opts)
+					},
+					WatchFunc: func(opts meta.ListOptions) (watch.Interface, error) {
+						return gwClient.GatewayV1().Gateways(api.NamespaceAll).Watch(ctx, opts)
+					},
+				},
+				gwClient,
+			),
+			&gw.Gateway{},
+			handler,
+			cache.Indexers{gatewayNameNamespaceIndex: gatewayNameNamespaceIndexFunc},
+			object.DefaultProcessor(object.ToGateway, nil),
+		)
+		rc.controllers = append(rc.controllers, c)
+
+		rc.httpRouteLister, c = object.NewIndexerInformer(
+			cache.ToListWatcherWithWatchListSemantics(
+				&cache.ListWatch{
+					ListFunc: func(opts meta.ListOptions) (runtime.Object, error) {
+						rc.selectorOptions(&opts)
+						return gwClient.GatewayV1().HTTPRoutes(api.NamespaceAll).List(ctx, opts)
+					},
+					WatchFunc: func(opts meta.ListOptions) (watch.Interface, error) {
+						rc.selectorOptions(&opts)
+						return gwClient.GatewayV1().HTTPRoutes(api.NamespaceAll).Watch(ctx, opts)
+					},
+				},
+				gwClient,
+			),
+			&gw.HTTPRoute{},
+			handler,
+			cache.Indexers{routeHostnameIndex: routeHostnameIndexFunc},
+			object.DefaultProcessor(object.ToHTTPRoute, nil),
+		)
+		rc.controllers = append(rc.controllers, c)
+
+		rc.grpcRouteLister, c = object.NewIndexerInformer(
+			cache.ToListWatcherWithWatchListSemantics(
+				&cache.ListWatch{
+					ListFunc: func(opts meta.ListOptions) (runtime.Object, error) {
+						rc.selectorOptions(&opts)
+						return gwClient.GatewayV1().GRPCRoutes(api.NamespaceAll).List(ctx, opts)
+					},
+					WatchFunc: func(opts meta.ListOptions) (watch.Interface, error) {
+						rc.selectorOptions(&opts)
+						return gwClient.GatewayV1().GRPCRoutes(api.NamespaceAll).Watch(ctx, opts)
+					},
+				},
+				gwClient,
+			),
+			&gw.GRPCRoute{},
+			handler,
+			cache.Indexers{routeHostnameIndex: routeHostnameIndexFunc},
+			object.DefaultProcessor(object.ToGRPCRoute, nil),
+		)
+		rc.controllers = append(rc.controllers, c)
+	}
+
+	return &rc
+}
+
+func (rc *routeControl) selectorOptions(opts *meta.ListOptions) {
+	if rc.selector != nil {
+		opts.LabelSelector = rc.selector.String()
+	}
+}
+
+func ingressHostIndexFunc(obj any) ([]string, error) {
+	i, ok := obj.(*object.Ingress)
+	if !ok {
+		return nil, errObj
+	}
+	return i.Hosts, nil
+}
+
+func routeHostnameIndexFunc(obj any) ([]string, error) {
+	r, ok := obj.(*object.Route)
+	if !ok {
+		return nil, errObj
+	}
+	if len(r.Hostnames) == 0 {
+		return []string{""}, nil
+	}
+	return r.Hostnames, nil
+}
+
+func gatewayNameNamespaceIndexFunc(obj any) ([]string, error) {
+	g, ok := obj.(*object.Gateway)
+	if !ok {
+		return nil, errObj
+	}
+	return []string{g.Index}, nil
+}
+
+// Run starts the controller.
+func (rc *routeControl) Run() {
+	for _, c := range rc.controllers {
+		go c.Run(rc.stopCh)
+	}
+	<-rc.stopCh
+}
+
+// HasSynced calls on all controllers.
+func (rc *routeControl) HasSynced() bool {
+	for _, c := range rc.controllers {
+		if !c.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// Stop stops the controller.
+func (rc *routeControl) Stop() error {
+	rc.stopLock.Lock()
+	defer rc.stopLock.Unlock()
+
+	if !rc.shutdown {
+		close(rc.stopCh)
+		rc.shutdown = true
+		return nil
+	}
+	return fmt.Errorf("shutdown already in progress")
+}
+
+func (rc *routeControl) IngressList() []*object.Ingress {
+	if rc.ingressLister == nil {
+		return nil
+	}
+	return toIngresses(rc.ingressLister.List())
+}
+
+func (rc *routeControl) RouteList() []*object.Route {
+	if rc.httpRouteLister == nil {
+		return nil
+	}
+	return toRoutes(append(rc.httpRouteLister.List(), rc.grpcRouteLister.List()...))
+}
+
+func (rc *routeControl) IngressIndex(host string) []*object.Ingress {
+	if rc.ingressLister == nil {
+		return nil
+	}
+	os, err := rc.ingressLister.ByIndex(ingressHostIndex, host)
+	if err != nil {
+		return nil
+	}
+	return toIngresses(os)
+}
+
+func (rc *routeControl) RouteIndex(hostname string) []*object.Route {
+	if rc.httpRouteLister == nil {
+		return nil
+	}
+	os, err := rc.httpRouteLister.ByIndex(routeHostnameIndex, hostname)
+	if err != nil {
+		return nil
+	}
+	grpc, err := rc.grpcRouteLister.ByIndex(routeHostnameIndex, hostname)
+	if err != nil {
+		return nil
+	}
+	return toRoutes(append(os, grpc...))
+}
+
+func (rc *routeControl) GatewayIndex(key string) (gws []*object.Gateway) {
+	if rc.gatewayLister == nil {
+		return nil
+	}
+	os, err := rc.gatewayLister.ByIndex(gatewayNameNamespaceIndex, key)
+	if err != nil {
+		return nil
+	}
+	gws = make([]*object.Gateway, 0, len(os))
+	for _, o := range os {
+		g, ok := o.(*object.Gateway)
+		if !ok {
+			continue
+		}
+		gws = append(gws, g)
+	}
+	return gws
+}
+
+func toIngresses(os []any) []*object.Ingress {
+	ings := make([]*object.Ingress, 0, len(os))
+	for _, o := range os {
+		i, ok := o.(*object.Ingress)
+		if !ok {
+			continue
+		}
+		ings = append(ings, i)
+	}
+	return ings
+}
+
+func toRoutes(os []any) []*object.Route {
+	routes := make([]*object.Route, 0, len(os))
+	for _, o := range os {
+		r, ok := o.(*object.Route)
+		if !ok {
+			continue
+		}
+		routes = append(routes, r)
+	}
+	return routes
+}
+
+func (rc *routeControl) Add(_obj any)    { rc.updateModified() }
+func (rc *routeControl) Delete(_obj any) { rc.updateModified() }
+
+// Update updates the modified timestamp if anything but the resource version changed, the objects only
+// hold what is visible in DNS.
+func (rc *routeControl) Update(oldObj, newObj any) {
+	o, ok1 := oldObj.(meta.Object)
+	n, ok2 := newObj.(meta.Object)
+	if ok1 && ok2 && o.GetResourceVersion() == n.GetResourceVersion() {
+		return
+	}
+	if routeObjectEquivalent(oldObj, newObj) {
+		return
+	}
+	rc.updateModified()
+}
+
+// routeObjectEquivalent returns true if a and b only differ in their resource version.
+func routeObjectEquivalent(a, b any) bool {
+	switch a := a.(type) {
+	case *object.Ingress:
+		b, ok := b.(*object.Ingress)
+		return ok && a.Name == b.Name && a.Namespace == b.Namespace &&
+			reflect.DeepEqual(a.Hosts, b.Hosts) && reflect.DeepEqual(a.Addresses, b.Addresses)
+	case *object.Gateway:
+		b, ok := b.(*object.Gateway)
+		return ok && a.Index == b.Index &&
+			reflect.DeepEqual(a.Listeners, b.Listeners) && reflect.DeepEqual(a.Addresses, b.Addresses)
+	case *object.Route:
+		b, ok := b.(*object.Route)
+		return ok && a.Kind == b.Kind && a.Name == b.Name && a.Namespace == b.Namespace &&
+			reflect.DeepEqual(a.Hostnames, b.Hostnames) && reflect.DeepEqual(a.Parents, b.Parents)
+	}
+	return false
+}
+
+// Modified returns the timestamp of the most recent changes.
+func (rc *routeControl) Modified() int64 { return rc.modified.Load() }
+
+// updateModified set rc.modified to the current time.
+func (rc *routeControl) updateModified() {
+	unix := time.Now().Unix()
+	rc.modified.Store(unix)
+}
+
+// WatchRoutes makes k watch Ingresses if ingress is true, and Gateway API Gateways, HTTPRoutes and
+// GRPCRoutes if gateway is true, so ExternalRoutes can answer for their host names. It must be called
+// before the plugin starts, the server then waits for them like for the other objects.
+func (k *Kubernetes) WatchRoutes(ingress, gateway bool) error {
+	if k.routes != nil {
+		return errors.New("routes are already watched")
+	}
+	if k.restConfig == nil {
+		return errors.New("not connected to the Kubernetes API")
+	}
+
+	var (
+		kubeClient kubernetes.Interface
+		gwClient   gwClientset.Interface
+		err        error
+	)
+	if ingress {
+		kubeClient, err = kubernetes.NewForConfig(k.restConfig)
+		if err != nil {
+			return fmt.Errorf("failed to create kubernetes ingress notification controller: %q", err)
+		}
+	}
+	if gateway {
+		gwClient, err = gwClientset.NewForConfig(k.restConfig)
+		if err != nil {
+			return fmt.Errorf("failed to create kubernetes gateway notification controller: %q", err)
+		}
+	}
+
+	rc := newRouteController(context.Background(), kubeClient, gwClient, k.opts.selector)
+	go rc.Run()
+	k.routes = rc
+	return nil
+}
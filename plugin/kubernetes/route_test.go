@@ -0,0 +1,293 @@
+package kubernetes
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/etcd/msg"
+	"github.com/coredns/coredns/plugin/kubernetes/object"
+
+	networking "k8s.io/api/networking/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	gw "sigs.k8s.io/gateway-api/apis/v1"
+	gwFake "sigs.k8s.io/gateway-api/pkg/client/clientset/versioned/fake"
+)
+
+// routeTest is a routeController that serves the objects in it.
+type routeTest struct {
+	ingresses []*object.Ingress
+	routes    []*object.Route
+	gateways  []*object.Gateway
+}
+
+func (r *routeTest) IngressList() []*object.Ingress { return r.ingresses }
+func (r *routeTest) RouteList() []*object.Route     { return r.routes }
+func (r *routeTest) Run()                           {}
+func (r *routeTest) HasSynced() bool                { return true }
+func (r *routeTest) Stop() error                    { return nil }
+func (r *routeTest) Modified() int64                { return 10 }
+
+func (r *routeTest) IngressIndex(host string) (ings []*object.Ingress) {
+	for _, i := range r.ingresses {
+		for _, h := range i.Hosts {
+			if h == host {
+				ings = append(ings, i)
+			}
+		}
+	}
+	return ings
+}
+
+func (r *routeTest) RouteIndex(hostname string) (routes []*object.Route) {
+	for _, rt := range r.routes {
+		if hostname == "" && len(rt.Hostnames) == 0 {
+			routes = append(routes, rt)
+		}
+		for _, h := range rt.Hostnames {
+			if h == hostname {
+				routes = append(routes, rt)
+			}
+		}
+	}
+	return routes
+}
+
+func (r *routeTest) GatewayIndex(key string) (gws []*object.Gateway) {
+	for _, g := range r.gateways {
+		if g.Index == key {
+			gws = append(gws, g)
+		}
+	}
+	return gws
+}
+
+var routesExternal = &routeTest{
+	ingresses: []*object.Ingress{
+		{Name: "ing1", Namespace: "testns", Hosts: []string{"app.example.com"}, Addresses: []string{"1.1.1.1"}},
+		{Name: "ing2", Namespace: "testns", Hosts: []string{"*.wild.example.com"}, Addresses: []string{"1.1.1.2"}},
+		{Name: "ing3", Namespace: "nsnoexist", Hosts: []string{"hidden.example.com"}, Addresses: []string{"1.1.1.3"}},
+		{Name: "ing4", Namespace: "testns", Hosts: []string{"lb.example.com"}, Addresses: []string{"lb.cloud.example.net"}},
+	},
+	gateways: []*object.Gateway{
+		{
+			Name: "gw1", Namespace: "infra", Index: object.GatewayKey("gw1", "infra"),
+			Listeners: []object.Listener{{Name: "http"}, {Name: "https", Hostname: "*.gw.example.com"}},
+			Addresses: []string{"2.2.2.1", "2::1"},
+		},
+		{
+			Name: "gw2", Namespace: "testns", Index: object.GatewayKey("gw2", "testns"),
+			Listeners: []object.Listener{{Name: "grpc", Hostname: "grpc.example.com"}},
+			Addresses: []string{"2.2.2.2"},
+		},
+	},
+	routes: []*object.Route{
+		{
+			Kind: "HTTPRoute", Name: "web", Namespace: "testns", Hostnames: []string{"www.example.com", "*.apps.example.com"},
+			Parents: []object.ParentRef{{Name: "gw1", Namespace: "infra"}},
+		},
+		// Attached to a listener of gw1, without host names of its own.
+		{
+			Kind: "HTTPRoute", Name: "any", Namespace: "testns",
+			Parents: []object.ParentRef{{Name: "gw1", Namespace: "infra", SectionName: "https"}},
+		},
+		{
+			Kind: "GRPCRoute", Name: "grpc", Namespace: "testns",
+			Parents: []object.ParentRef{{Name: "gw2", Namespace: "testns"}},
+		},
+		// Not accepted by any gateway.
+		{Kind: "HTTPRoute", Name: "orphan", Namespace: "testns", Hostnames: []string{"orphan.example.com"}},
+		{
+			Kind: "HTTPRoute", Name: "hidden", Namespace: "nsnoexist", Hostnames: []string{"hidden.gw.example.com"},
+			Parents: []object.ParentRef{{Name: "gw2", Namespace: "testns"}},
+		},
+	},
+}
+
+func hosts(svcs []msg.Service) string {
+	h := make([]string, len(svcs))
+	for i, s := range svcs {
+		h[i] = s.Host
+	}
+	sort.Strings(h)
+	return strings.Join(h, ",")
+}
+
+func TestExternalRoutes(t *testing.T) {
+	k := New([]string{"cluster.local."})
+	k.APIConn = &APIConnServeTest{}
+	k.routes = routesExternal
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"app.example.com.", "1.1.1.1"},
+		{"APP.example.com", "1.1.1.1"},
+		{"lb.example.com.", "lb.cloud.example.net"},
+		{"a.wild.example.com.", "1.1.1.2"},
+		// Ingress wildcards match a single label only.
+		{"a.b.wild.example.com.", ""},
+		{"wild.example.com.", ""},
+		{"hidden.example.com.", ""},
+		{"www.example.com.", "2.2.2.1,2::1"},
+		// Route wildcards match any number of labels.
+		{"a.b.apps.example.com.", "2.2.2.1,2::1"},
+		{"apps.example.com.", ""},
+		// The route without host names uses the host name of its listener.
+		{"x.gw.example.com.", "2.2.2.1,2::1"},
+		{"gw.example.com.", ""},
+		{"grpc.example.com.", "2.2.2.2"},
+		{"orphan.example.com.", ""},
+		// The route in a hidden namespace is ignored, the listener host name still matches.
+		{"hidden.gw.example.com.", "2.2.2.1,2::1"},
+		{"svc1.testns.example.com.", ""},
+	}
+	for i, tc := range tests {
+		svcs := k.ExternalRoutes(tc.name)
+		if x := hosts(svcs); x != tc.expected {
+			t.Errorf("Test %d: expected %q for %s, got %q", i, tc.expected, tc.name, x)
+		}
+		for _, s := range svcs {
+			if s.TTL != k.ttl || msg.Domain(s.Key) != strings.ToLower(tc.name) && msg.Domain(s.Key) != strings.ToLower(tc.name)+"." {
+				t.Errorf("Test %d: unexpected service %+v for %s", i, s, tc.name)
+			}
+		}
+	}
+
+	k.routes = nil
+	if svcs := k.ExternalRoutes("app.example.com."); svcs != nil {
+		t.Errorf("Expected no services without routes, got %v", svcs)
+	}
+}
+
+func TestExternalRouteServices(t *testing.T) {
+	k := New([]string{"cluster.local."})
+	k.APIConn = &APIConnServeTest{}
+	k.routes = routesExternal
+
+	var names []string
+	for _, s := range k.ExternalRouteServices("example.com.") {
+		names = append(names, msg.Domain(s.Key)+"="+s.Host)
+	}
+	sort.Strings(names)
+	expected := []string{
+		"*.apps.example.com.=2.2.2.1", "*.apps.example.com.=2::1",
+		"*.gw.example.com.=2.2.2.1", "*.gw.example.com.=2::1",
+		"*.wild.example.com.=1.1.1.2",
+		"app.example.com.=1.1.1.1",
+		"grpc.example.com.=2.2.2.2",
+		"lb.example.com.=lb.cloud.example.net",
+		"www.example.com.=2.2.2.1", "www.example.com.=2::1",
+	}
+	if x, y := strings.Join(names, " "), strings.Join(expected, " "); x != y {
+		t.Errorf("Expected %s, got %s", y, x)
+	}
+
+	if svcs := k.ExternalRouteServices("example.org."); len(svcs) != 0 {
+		t.Errorf("Expected no services in other zone, got %v", svcs)
+	}
+
+	if serial := k.ExternalSerial("example.com."); serial != 10 {
+		t.Errorf("Expected serial 10, got %d", serial)
+	}
+}
+
+func TestRouteController(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset()
+	gwClient := gwFake.NewSimpleClientset()
+
+	pathType := networking.PathTypePrefix
+	_, err := client.NetworkingV1().Ingresses("testns").Create(ctx, &networking.Ingress{
+		ObjectMeta: meta.ObjectMeta{Name: "ing1", Namespace: "testns"},
+		Spec: networking.IngressSpec{Rules: []networking.IngressRule{
+			{Host: "App.example.com", IngressRuleValue: networking.IngressRuleValue{HTTP: &networking.HTTPIngressRuleValue{
+				Paths: []networking.HTTPIngressPath{{Path: "/", PathType: &pathType}},
+			}}},
+			{Host: "app.example.com"},
+		}},
+		Status: networking.IngressStatus{LoadBalancer: networking.IngressLoadBalancerStatus{
+			Ingress: []networking.IngressLoadBalancerIngress{{IP: "1.1.1.1"}, {Hostname: "lb.example.net"}},
+		}},
+	}, meta.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hostname := gw.Hostname("*.gw.example.com")
+	ipType := gw.IPAddressType
+	_, err = gwClient.GatewayV1().Gateways("infra").Create(ctx, &gw.Gateway{
+		ObjectMeta: meta.ObjectMeta{Name: "gw1", Namespace: "infra"},
+		Spec: gw.GatewaySpec{Listeners: []gw.Listener{
+			{Name: "http", Port: 80, Protocol: gw.HTTPProtocolType},
+			{Name: "https", Port: 443, Protocol: gw.HTTPSProtocolType, Hostname: &hostname},
+		}},
+		Status: gw.GatewayStatus{Addresses: []gw.GatewayStatusAddress{{Type: &ipType, Value: "2.2.2.1"}}},
+	}, meta.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accepted := []meta.Condition{{Type: string(gw.RouteConditionAccepted), Status: meta.ConditionTrue}}
+	infra := gw.Namespace("infra")
+	section := gw.SectionName("https")
+	_, err = gwClient.GatewayV1().HTTPRoutes("testns").Create(ctx, &gw.HTTPRoute{
+		ObjectMeta: meta.ObjectMeta{Name: "web", Namespace: "testns"},
+		Spec:       gw.HTTPRouteSpec{Hostnames: []gw.Hostname{"www.example.com"}},
+		Status: gw.HTTPRouteStatus{RouteStatus: gw.RouteStatus{Parents: []gw.RouteParentStatus{
+			{ParentRef: gw.ParentReference{Name: "gw1", Namespace: &infra}, Conditions: accepted},
+			{ParentRef: gw.ParentReference{Name: "gw2"}, Conditions: []meta.Condition{{Type: string(gw.RouteConditionAccepted), Status: meta.ConditionFalse}}},
+		}}},
+	}, meta.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = gwClient.GatewayV1().GRPCRoutes("testns").Create(ctx, &gw.GRPCRoute{
+		ObjectMeta: meta.ObjectMeta{Name: "grpc", Namespace: "testns"},
+		Status: gw.GRPCRouteStatus{RouteStatus: gw.RouteStatus{Parents: []gw.RouteParentStatus{
+			{ParentRef: gw.ParentReference{Name: "gw1", Namespace: &infra, SectionName: &section}, Conditions: accepted},
+		}}},
+	}, meta.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc := newRouteController(ctx, client, gwClient, nil)
+	go rc.Run()
+	defer rc.Stop()
+	for i := 0; !rc.HasSynced(); i++ {
+		if i > 500 {
+			t.Fatal("Timed out waiting for the controller to sync")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ings := rc.IngressIndex("app.example.com")
+	if len(ings) != 1 || strings.Join(ings[0].Hosts, ",") != "app.example.com" || strings.Join(ings[0].Addresses, ",") != "1.1.1.1,lb.example.net" {
+		t.Errorf("Unexpected ingresses %+v", ings)
+	}
+
+	gws := rc.GatewayIndex(object.GatewayKey("gw1", "infra"))
+	if len(gws) != 1 || len(gws[0].Listeners) != 2 || gws[0].Listeners[1].Hostname != "*.gw.example.com" || strings.Join(gws[0].Addresses, ",") != "2.2.2.1" {
+		t.Errorf("Unexpected gateways %+v", gws)
+	}
+
+	routes := rc.RouteIndex("www.example.com")
+	if len(routes) != 1 || routes[0].Kind != "HTTPRoute" || len(routes[0].Parents) != 1 || routes[0].Parents[0] != (object.ParentRef{Name: "gw1", Namespace: "infra"}) {
+		t.Errorf("Unexpected routes %+v", routes)
+	}
+	routes = rc.RouteIndex("")
+	if len(routes) != 1 || routes[0].Kind != "GRPCRoute" || routes[0].Parents[0].SectionName != "https" {
+		t.Errorf("Unexpected routes without host names %+v", routes)
+	}
+	if n := len(rc.RouteList()); n != 2 {
+		t.Errorf("Expected 2 routes, got %d", n)
+	}
+	if rc.Modified() == 0 {
+		t.Error("Expected modified to be set")
+	}
+}
@@ -1,7 +1,9 @@
-// Package catalog parses DNS catalog zones as defined by RFC 9432.
+// Package catalog parses and produces DNS catalog zones as defined by RFC 9432.
 package catalog
 
 import (
+	"crypto/sha1" // #nosec G505 -- only used to derive member labels, not for security.
+	"encoding/hex"
 	"fmt"
 	"sort"
 	"strings"
@@ -122,6 +124,49 @@ func Parse(origin string, rrs []dns.RR) (*Catalog, error) {
 	return &Catalog{Origin: origin, Members: members}, nil
 }
 
+// MemberID returns the member node label for zone: the hex encoded SHA1 hash of the lowercased zone
+// name in wire format. This keeps the label stable for as long as the zone is a member.
+func MemberID(zone string) string {
+	buf := make([]byte, 256)
+	off, err := dns.PackDomainName(normalizeName(zone), buf, 0, nil, false)
+	if err != nil {
+		// Not a valid domain name, hash the text instead.
+		buf, off = []byte(zone), len(zone)
+	}
+	h := sha1.Sum(buf[:off]) // #nosec G401 -- see above.
+	return hex.EncodeToString(h[:])
+}
+
+// Records returns the resource records of the catalog zone c, with serial as the SOA's serial. The
+// SOA record is returned first. Members without an ID get one from MemberID.
+func (c *Catalog) Records(serial uint32) []dns.RR {
+	origin := normalizeName(c.Origin)
+	hdr := func(name string, rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: 0}
+	}
+
+	rrs := []dns.RR{
+		&dns.SOA{Hdr: hdr(origin, dns.TypeSOA), Ns: "invalid.", Mbox: "invalid.", Serial: serial, Refresh: 3600, Retry: 600, Expire: 2147483646, Minttl: 0},
+		&dns.NS{Hdr: hdr(origin, dns.TypeNS), Ns: "invalid."},
+		&dns.TXT{Hdr: hdr("version."+origin, dns.TypeTXT), Txt: []string{Version}},
+	}
+	for _, m := range c.Members {
+		id := m.ID
+		if id == "" {
+			id = MemberID(m.Zone)
+		}
+		owner := id + ".zones." + origin
+		rrs = append(rrs, &dns.PTR{Hdr: hdr(owner, dns.TypePTR), Ptr: normalizeName(m.Zone)})
+		for _, g := range m.Groups {
+			rrs = append(rrs, &dns.TXT{Hdr: hdr("group."+owner, dns.TypeTXT), Txt: []string{g}})
+		}
+		if m.ChangeOfOwnership != "" {
+			rrs = append(rrs, &dns.PTR{Hdr: hdr("coo."+owner, dns.TypePTR), Ptr: normalizeName(m.ChangeOfOwnership)})
+		}
+	}
+	return rrs
+}
+
 func normalizeName(name string) string {
 	return strings.ToLower(dns.Fqdn(name))
 }
@@ -166,6 +166,35 @@ a.zones 0 CH PTR example.com.
 	}
 }
 
+func TestRecords(t *testing.T) {
+	cat := &Catalog{Origin: "Catalog.Example", Members: []Member{
+		{Zone: "example.com.", Groups: []string{"signed"}},
+		{ID: "b", Zone: "Example.NET", ChangeOfOwnership: "other-catalog.example."},
+	}}
+	rrs := cat.Records(10)
+	if soa, ok := rrs[0].(*dns.SOA); !ok || soa.Serial != 10 {
+		t.Fatalf("expected SOA with serial 10 first, got %s", rrs[0])
+	}
+
+	parsed, err := Parse("catalog.example.", rrs)
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if len(parsed.Members) != 2 {
+		t.Fatalf("expected 2 members, got %d", len(parsed.Members))
+	}
+	id := MemberID("example.com.")
+	if id != MemberID("EXAMPLE.com") || len(id) != 40 {
+		t.Fatalf("expected stable 40 character member ID, got %q", id)
+	}
+	members := map[string]Member{}
+	for _, m := range parsed.Members {
+		members[m.ID] = m
+	}
+	assertMember(t, members[id], Member{ID: id, Zone: "example.com.", Groups: []string{"signed"}})
+	assertMember(t, members["b"], Member{ID: "b", Zone: "example.net.", ChangeOfOwnership: "other-catalog.example."})
+}
+
 func assertMember(t *testing.T, got, want Member) {
 	t.Helper()
 	if got.ID != want.ID || got.Zone != want.Zone || got.ChangeOfOwnership != want.ChangeOfOwnership {
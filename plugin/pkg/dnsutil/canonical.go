@@ -0,0 +1,56 @@
+package dnsutil
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// CanonicalCompare compares the names a and b in the canonical order of RFC 4034, section 6.1: label by
+// label from the right, ignoring case. It returns <0 when a sorts before b, 0 when they are equal and >0
+// when a sorts after b.
+func CanonicalCompare(a, b string) int {
+	la := dns.SplitDomainName(a)
+	lb := dns.SplitDomainName(b)
+	i, j := len(la)-1, len(lb)-1
+	for ; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(canonicalLabel(la[i]), canonicalLabel(lb[j])); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case i < 0 && j < 0:
+		return 0
+	case i < 0:
+		return -1
+	}
+	return 1
+}
+
+// canonicalLabel returns label in lower case, with the \DDD and \X escapes turned into the bytes they
+// stand for.
+func canonicalLabel(label string) string {
+	if !strings.Contains(label, `\`) {
+		return strings.ToLower(label)
+	}
+	b := make([]byte, 0, len(label))
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		if c == '\\' && i+1 < len(label) {
+			if i+3 < len(label) && isDigit(label[i+1]) && isDigit(label[i+2]) && isDigit(label[i+3]) {
+				c = (label[i+1]-'0')*100 + (label[i+2]-'0')*10 + (label[i+3] - '0')
+				i += 3
+			} else {
+				c = label[i+1]
+				i++
+			}
+		}
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
@@ -0,0 +1,19 @@
+package dnsutil
+
+import "testing"
+
+func TestCanonicalCompare(t *testing.T) {
+	// The example of RFC 4034, section 6.1.
+	names := []string{
+		"example.", "a.example.", "yljkjljk.a.example.", "Z.a.example.", "zABC.a.EXAMPLE.", "z.example.",
+		`\001.z.example.`, "*.z.example.", `\200.z.example.`,
+	}
+	for i := 1; i < len(names); i++ {
+		if CanonicalCompare(names[i-1], names[i]) >= 0 {
+			t.Errorf("Expected %q before %q", names[i-1], names[i])
+		}
+	}
+	if CanonicalCompare("A.example.", `\097.EXAMPLE.`) != 0 {
+		t.Error("Expected names that differ in case and escapes to be equal")
+	}
+}
@@ -0,0 +1,130 @@
+// Package ecs provides functions to add, inspect and remove the EDNS Client Subnet option (RFC 7871)
+// in messages.
+package ecs
+
+import (
+	"context"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// Default source prefix lengths, as recommended by RFC 7871, section 11.1.
+const (
+	DefaultIPv4 = 24
+	DefaultIPv6 = 56
+)
+
+// Get returns the EDNS Client Subnet option in m, or nil if there is none.
+func Get(m *dns.Msg) *dns.EDNS0_SUBNET {
+	o := m.IsEdns0()
+	if o == nil {
+		return nil
+	}
+	for _, s := range o.Option {
+		if e, ok := s.(*dns.EDNS0_SUBNET); ok {
+			return e
+		}
+	}
+	return nil
+}
+
+// Set sets the EDNS Client Subnet option in m to e, replacing any existing one. If m does not have
+// an OPT RR, one is added.
+func Set(m *dns.Msg, e *dns.EDNS0_SUBNET) {
+	o := m.IsEdns0()
+	if o == nil {
+		o = &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}}
+		o.SetUDPSize(dns.MinMsgSize)
+		m.Extra = append(m.Extra, o)
+	}
+	for i, s := range o.Option {
+		if _, ok := s.(*dns.EDNS0_SUBNET); ok {
+			o.Option[i] = e
+			return
+		}
+	}
+	o.Option = append(o.Option, e)
+}
+
+// Strip removes the EDNS Client Subnet option from the response m. If the request req does not have
+// an OPT RR the entire OPT RR is removed from m, as the client does not support EDNS.
+func Strip(m, req *dns.Msg) {
+	if req.IsEdns0() == nil {
+		extra := m.Extra[:0]
+		for _, rr := range m.Extra {
+			if rr.Header().Rrtype != dns.TypeOPT {
+				extra = append(extra, rr)
+			}
+		}
+		m.Extra = extra
+		return
+	}
+	o := m.IsEdns0()
+	if o == nil {
+		return
+	}
+	opts := o.Option[:0]
+	for _, s := range o.Option {
+		if _, ok := s.(*dns.EDNS0_SUBNET); !ok {
+			opts = append(opts, s)
+		}
+	}
+	o.Option = opts
+}
+
+// New returns an EDNS Client Subnet option for ip, with the source prefix length set to v4 or v6,
+// depending on the family of ip. The address is truncated to the source prefix length. It returns
+// nil if ip is not a valid address.
+func New(ip net.IP, v4, v6 uint8) *dns.EDNS0_SUBNET {
+	if ip4 := ip.To4(); ip4 != nil {
+		return Truncate(&dns.EDNS0_SUBNET{Family: 1, SourceNetmask: net.IPv4len * 8, Address: ip4}, v4)
+	}
+	if len(ip) == net.IPv6len {
+		return Truncate(&dns.EDNS0_SUBNET{Family: 2, SourceNetmask: net.IPv6len * 8, Address: ip}, v6)
+	}
+	return nil
+}
+
+// Truncate returns a copy of e with the source prefix length set to the smallest of its own source
+// prefix length and n, and the address truncated accordingly. The scope prefix length is set to 0.
+func Truncate(e *dns.EDNS0_SUBNET, n uint8) *dns.EDNS0_SUBNET {
+	bits := maxBits(e.Family)
+	n = min(n, e.SourceNetmask, bits)
+	addr := e.Address.Mask(net.CIDRMask(int(n), int(bits)))
+	if e.Family == 1 {
+		addr = addr.To4()
+	}
+	return &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: e.Family, SourceNetmask: n, Address: addr}
+}
+
+// Match returns true if the family, source prefix length and address of the option in the response
+// are those of e, as required by RFC 7871, section 7.3. A response without the option matches.
+func Match(e *dns.EDNS0_SUBNET, res *dns.Msg) bool {
+	r := Get(res)
+	if r == nil {
+		return true
+	}
+	return r.Family == e.Family && r.SourceNetmask == e.SourceNetmask && r.Address.Equal(e.Address) && r.SourceScope <= maxBits(r.Family)
+}
+
+func maxBits(family uint16) uint8 {
+	if family == 2 {
+		return net.IPv6len * 8
+	}
+	return net.IPv4len * 8
+}
+
+type keepKey struct{}
+
+// WithKeep returns a context that tells plugins that add the option to a request to leave it in the
+// response, because the caller removes it itself. The cache uses this to see the scope of responses.
+func WithKeep(ctx context.Context) context.Context {
+	return context.WithValue(ctx, keepKey{}, true)
+}
+
+// Keep returns true if ctx was returned by WithKeep.
+func Keep(ctx context.Context) bool {
+	keep, _ := ctx.Value(keepKey{}).(bool)
+	return keep
+}
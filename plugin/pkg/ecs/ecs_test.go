@@ -0,0 +1,82 @@
+package ecs
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		ip     string
+		family uint16
+		source uint8
+		addr   string
+	}{
+		{"192.0.2.77", 1, 24, "192.0.2.0"},
+		{"2001:db8:1:2ff:3::1", 2, 56, "2001:db8:1:200::"},
+		{"::ffff:192.0.2.77", 1, 24, "192.0.2.0"},
+	}
+	for _, tc := range tests {
+		e := New(net.ParseIP(tc.ip), DefaultIPv4, DefaultIPv6)
+		if e.Family != tc.family || e.SourceNetmask != tc.source || e.Address.String() != tc.addr {
+			t.Errorf("%s: expected %d %s/%d, got %d %s/%d", tc.ip, tc.family, tc.addr, tc.source, e.Family, e.Address, e.SourceNetmask)
+		}
+	}
+	if e := New(nil, DefaultIPv4, DefaultIPv6); e != nil {
+		t.Errorf("Expected nil for an invalid address, got %v", e)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	e := &dns.EDNS0_SUBNET{Family: 1, SourceNetmask: 20, SourceScope: 24, Address: net.ParseIP("192.0.2.77")}
+	if x := Truncate(e, 24); x.SourceNetmask != 20 || x.SourceScope != 0 || x.Address.String() != "192.0.0.0" || len(x.Address) != net.IPv4len {
+		t.Errorf("Expected 192.0.0.0/20, got %s/%d", x.Address, x.SourceNetmask)
+	}
+	if x := Truncate(e, 8); x.SourceNetmask != 8 || x.Address.String() != "192.0.0.0" {
+		t.Errorf("Expected 192.0.0.0/8, got %s/%d", x.Address, x.SourceNetmask)
+	}
+}
+
+func TestSetStrip(t *testing.T) {
+	req := new(dns.Msg)
+	req.SetQuestion("example.org.", dns.TypeA)
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+	Set(m, New(net.ParseIP("192.0.2.77"), 24, 56))
+	Set(m, New(net.ParseIP("198.51.100.1"), 24, 56))
+	if o := m.IsEdns0(); o == nil || len(o.Option) != 1 {
+		t.Fatalf("Expected a single option, got %v", m.Extra)
+	}
+	if e := Get(m); e.Address.String() != "198.51.100.0" {
+		t.Errorf("Expected option to be replaced, got %s", e.Address)
+	}
+	if !Match(Get(m), m) || Match(New(net.ParseIP("192.0.2.77"), 24, 56), m) {
+		t.Error("Expected the option only to match itself")
+	}
+
+	// The request has no OPT RR, so neither should the response.
+	Strip(m, req)
+	if m.IsEdns0() != nil {
+		t.Errorf("Expected no OPT RR, got %v", m.Extra)
+	}
+
+	req.SetEdns0(dns.DefaultMsgSize, false)
+	Set(m, New(net.ParseIP("192.0.2.77"), 24, 56))
+	Strip(m, req)
+	if m.IsEdns0() == nil || Get(m) != nil {
+		t.Errorf("Expected OPT RR without client subnet, got %v", m.Extra)
+	}
+}
+
+func TestKeep(t *testing.T) {
+	if Keep(context.Background()) {
+		t.Error("Expected no keep")
+	}
+	if !Keep(WithKeep(context.Background())) {
+		t.Error("Expected keep")
+	}
+}
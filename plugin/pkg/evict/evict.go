@@ -0,0 +1,32 @@
+// Package evict makes room in the tables of per-key state plugins keep, like the token buckets of the
+// rate limiting plugins.
+package evict
+
+import "time"
+
+// Table removes the entries of table that have been idle for at least idle at time now. If that leaves
+// max or more entries, roughly the least recently used half of them is removed too. last returns the time
+// an entry was last used.
+func Table[K comparable, V any](table map[K]V, last func(V) time.Time, idle time.Duration, max int, now time.Time) {
+	for k, v := range table {
+		if now.Sub(last(v)) >= idle {
+			delete(table, k)
+		}
+	}
+	if len(table) < max {
+		return
+	}
+	cutoff := now
+	for _, v := range table {
+		if t := last(v); t.Before(cutoff) {
+			cutoff = t
+		}
+	}
+	// Average of the oldest entry and now approximates the median age.
+	cutoff = cutoff.Add(now.Sub(cutoff) / 2)
+	for k, v := range table {
+		if !last(v).After(cutoff) {
+			delete(table, k)
+		}
+	}
+}
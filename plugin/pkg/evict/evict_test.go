@@ -0,0 +1,41 @@
+package evict
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTable(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	last := func(t time.Time) time.Time { return t }
+
+	// The idle entries are removed.
+	table := map[int]time.Time{}
+	for i := range 10 {
+		table[i] = now.Add(-time.Duration(i) * time.Second)
+	}
+	Table(table, last, 5*time.Second, 10, now)
+	if len(table) != 5 {
+		t.Errorf("Expected %d entries, got %d", 5, len(table))
+	}
+	for i := range 5 {
+		if _, ok := table[i]; !ok {
+			t.Errorf("Expected entry %d to be kept", i)
+		}
+	}
+
+	// Without idle entries, the least recently used half is removed.
+	table = map[int]time.Time{}
+	for i := range 10 {
+		table[i] = now.Add(-time.Duration(i) * time.Second)
+	}
+	Table(table, last, time.Minute, 10, now)
+	if len(table) != 5 {
+		t.Errorf("Expected %d entries, got %d", 5, len(table))
+	}
+	for i := range 5 {
+		if _, ok := table[i]; !ok {
+			t.Errorf("Expected entry %d to be kept", i)
+		}
+	}
+}
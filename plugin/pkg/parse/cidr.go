@@ -0,0 +1,15 @@
+package parse
+
+import "strings"
+
+// CIDR returns s in CIDR notation: a single IPv4 address gets '/32' appended and a single IPv6
+// address '/128'. Networks are returned as is.
+func CIDR(s string) string {
+	if strings.Contains(s, "/") {
+		return s
+	}
+	if strings.Contains(s, ":") {
+		return s + "/128"
+	}
+	return s + "/32"
+}
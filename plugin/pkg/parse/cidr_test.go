@@ -0,0 +1,23 @@
+package parse
+
+import "testing"
+
+func TestCIDR(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"Network range 1", "10.218.10.8/24", "10.218.10.8/24"},
+		{"IP address 1", "10.218.10.8", "10.218.10.8/32"},
+		{"IPv6 address 1", "2001:0db8:85a3:0000:0000:8a2e:0370:7334", "2001:0db8:85a3:0000:0000:8a2e:0370:7334/128"},
+		{"IPv6 network", "2001:db8::/32", "2001:db8::/32"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CIDR(tt.in); got != tt.want {
+				t.Errorf("Error: CIDR() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
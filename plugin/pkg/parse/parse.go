@@ -3,6 +3,7 @@ package parse
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/plugin/pkg/transport"
@@ -35,3 +36,17 @@ func TransferIn(c *caddy.Controller) (froms []string, err error) {
 	}
 	return froms, nil
 }
+
+// IntArg parses the single argument of the current property as an integer in [low, high].
+func IntArg(c *caddy.Controller, low, high int) (int, error) {
+	name := c.Val()
+	args := c.RemainingArgs()
+	if len(args) != 1 {
+		return 0, c.ArgErr()
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < low || n > high {
+		return 0, c.Errf("invalid value for %s: %q, must be between %d and %d", name, args[0], low, high)
+	}
+	return n, nil
+}
@@ -57,3 +57,30 @@ func TestTransferIn(t *testing.T) {
 		}
 	}
 }
+
+func TestIntArg(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  int
+	}{
+		{`window 15`, false, 15},
+		{`window 1`, false, 1},
+		{`window 0`, true, 0},
+		{`window 3601`, true, 0},
+		{`window fifteen`, true, 0},
+		{`window`, true, 0},
+		{`window 1 2`, true, 0},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		c.Next()
+		n, err := IntArg(c, 1, 3600)
+		if (err != nil) != tc.shouldErr {
+			t.Fatalf("Test %d expected error %t, got %v", i, tc.shouldErr, err)
+		}
+		if n != tc.expected {
+			t.Errorf("Test %d expected %d, got %d", i, tc.expected, n)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"net/http/httptrace"
 	"strconv"
 	"strings"
@@ -20,6 +21,7 @@ import (
 	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go/http3"
 )
 
 const (
@@ -225,9 +227,12 @@ func (p *Proxy) lookupDNS(_ctx context.Context, state request.Request, opts Opti
 }
 
 func (p *Proxy) lookupDoH(ctx context.Context, state request.Request, _ Options) (*dns.Msg, net.Addr, string, error) {
-	// DoH always runs over TCP (HTTPS), regardless of the downstream
-	// client's protocol.
-	const proto = "tcp"
+	// DoH always runs over TCP (HTTPS) or UDP (HTTP/3), regardless of the
+	// downstream client's protocol.
+	proto := "tcp"
+	if p.protocol == transport.HTTPS3 {
+		proto = "udp"
+	}
 	// records the origin Id before upstream.
 	originId := state.Req.Id
 	// RFC8484 has DNS ID of 0 as a SHOULD
@@ -248,6 +253,10 @@ func (p *Proxy) lookupDoH(ctx context.Context, state request.Request, _ Options)
 	if err != nil {
 		return nil, nil, proto, err
 	}
+	// Over HTTP/3 a GET of a plain query is idempotent and may be sent as 0-RTT early data.
+	if p.protocol == transport.HTTPS3 && req.Method == http.MethodGet && state.Req.Opcode == dns.OpcodeQuery {
+		req.Method = http3.MethodGet0RTT
+	}
 
 	resp, err := p.transport.httpClient.Do(req)
 	if err != nil {
@@ -274,6 +283,8 @@ func (p *Proxy) lookupDoH(ctx context.Context, state request.Request, _ Options)
 func (p *Proxy) Connect(ctx context.Context, state request.Request, opts Options) (*dns.Msg, net.Addr, string, error) {
 	start := time.Now()
 	originId := state.Req.Id
+	atomic.AddInt64(&p.inflight, 1)
+	defer atomic.AddInt64(&p.inflight, -1)
 
 	var (
 		ret       *dns.Msg
@@ -282,16 +293,24 @@ func (p *Proxy) Connect(ctx context.Context, state request.Request, opts Options
 		err       error
 	)
 	switch p.protocol {
-	case transport.HTTPS:
+	case transport.HTTPS, transport.HTTPS3:
 		ret, localAddr, proto, err = p.lookupDoH(ctx, state, opts)
+	case transport.QUIC:
+		ret, localAddr, proto, err = p.lookupDoQ(ctx, state, opts)
 	case transport.DNS, transport.TLS:
 		ret, localAddr, proto, err = p.lookupDNS(ctx, state, opts)
 	default:
 		return nil, nil, "", fmt.Errorf("transport %s not supported to proxy", p.protocol)
 	}
 	if err != nil {
+		if err != ErrCachedClosed && ctx.Err() == nil {
+			// Count a failure as a query that took at least the read timeout, this steers latency aware
+			// policies away from this upstream.
+			p.updateRTT(max(time.Since(start), p.readTimeout))
+		}
 		return nil, localAddr, proto, err
 	}
+	p.updateRTT(time.Since(start))
 
 	// recovery the origin Id after upstream.
 	ret.Id = originId
@@ -13,6 +13,8 @@ import (
 	"github.com/coredns/coredns/plugin/pkg/transport"
 
 	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
 )
 
 // HealthChecker checks the upstream health.
@@ -60,6 +62,25 @@ func NewHealthChecker(proxyName, protocol string, recursionDesired bool, domain
 			domain:           domain,
 			proxyName:        proxyName,
 		}
+	case transport.QUIC:
+		return &doqHc{
+			tlsConfig:        new(tls.Config),
+			recursionDesired: recursionDesired,
+			domain:           domain,
+			proxyName:        proxyName,
+			readTimeout:      defaultTimeout,
+			writeTimeout:     defaultTimeout,
+		}
+	case transport.HTTPS3:
+		return &dohHc{
+			client: &http.Client{
+				Transport: &http3.Transport{TLSClientConfig: new(tls.Config)},
+				Timeout:   defaultTimeout,
+			},
+			recursionDesired: recursionDesired,
+			domain:           domain,
+			proxyName:        proxyName,
+		}
 	case transport.HTTPS:
 		httpTransport := http.DefaultTransport.(*http.Transport).Clone()
 		httpTransport.TLSClientConfig = new(tls.Config)
@@ -248,12 +269,31 @@ func (h *dohHc) send(addr, host string) error {
 	return nil
 }
 
+// close closes the QUIC connections of an HTTP/3 health checker. HTTP/1 and HTTP/2 connections are
+// closed when they are idle.
+func (h *dohHc) close() {
+	if rt, ok := h.client.Transport.(*http3.Transport); ok {
+		rt.Close()
+	}
+}
+
 func (h *dohHc) SetTLSConfig(cfg *tls.Config) {
-	h.client.Transport.(*http.Transport).TLSClientConfig = cfg
+	switch rt := h.client.Transport.(type) {
+	case *http.Transport:
+		rt.TLSClientConfig = cfg
+	case *http3.Transport:
+		rt.TLSClientConfig = cfg
+	}
 }
 
 func (h *dohHc) GetTLSConfig() *tls.Config {
-	return h.client.Transport.(*http.Transport).TLSClientConfig
+	switch rt := h.client.Transport.(type) {
+	case *http.Transport:
+		return rt.TLSClientConfig
+	case *http3.Transport:
+		return rt.TLSClientConfig
+	}
+	return nil
 }
 
 func (h *dohHc) SetRecursionDesired(recursionDesired bool) {
@@ -274,12 +314,20 @@ func (h *dohHc) SetTCPTransport() {
 	// no-op for DoH
 }
 
+// GetReadTimeout returns the response header timeout. HTTP/3 has no separate
+// read timeout, so the overall client timeout is returned instead.
 func (h *dohHc) GetReadTimeout() time.Duration {
-	return h.client.Transport.(*http.Transport).ResponseHeaderTimeout
+	if rt, ok := h.client.Transport.(*http.Transport); ok {
+		return rt.ResponseHeaderTimeout
+	}
+	return h.client.Timeout
 }
 
+// SetReadTimeout sets the response header timeout. This is a no-op for HTTP/3.
 func (h *dohHc) SetReadTimeout(t time.Duration) {
-	h.client.Transport.(*http.Transport).ResponseHeaderTimeout = t
+	if rt, ok := h.client.Transport.(*http.Transport); ok {
+		rt.ResponseHeaderTimeout = t
+	}
 }
 
 func (h *dohHc) GetWriteTimeout() time.Duration {
@@ -292,15 +340,108 @@ func (h *dohHc) SetWriteTimeout(t time.Duration) {
 
 func (h *dohHc) SetLocalAddress(localAddr net.IP) {
 	h.localAddress = localAddr
-	httpTransport := h.client.Transport.(*http.Transport)
-	if localAddr == nil {
-		httpTransport.DialContext = nil
-		return
-	}
-	dialer := &net.Dialer{LocalAddr: &net.TCPAddr{IP: localAddr}}
-	httpTransport.DialContext = dialer.DialContext
+	setHTTPLocalAddress(h.client.Transport, localAddr)
 }
 
 func (h *dohHc) GetLocalAddress() net.IP {
 	return h.localAddress
 }
+
+// doqHc is a health checker for a DNS-over-QUIC (DoQ) endpoint. Each check uses a fresh
+// connection, so a broken cached connection doesn't hide a healthy upstream (or vice versa).
+type doqHc struct {
+	tlsConfig        *tls.Config
+	recursionDesired bool
+	domain           string
+	proxyName        string
+	localAddress     net.IP
+	readTimeout      time.Duration
+	writeTimeout     time.Duration
+}
+
+func (h *doqHc) Check(p *Proxy) error {
+	err := h.send(p.addr)
+	if err != nil {
+		healthcheckFailureCount.WithLabelValues(p.proxyName, p.addr).Add(1)
+		p.incrementFails()
+		return err
+	}
+
+	atomic.StoreUint32(&p.fails, 0)
+	return nil
+}
+
+func (h *doqHc) send(addr string) error {
+	ping := new(dns.Msg)
+	ping.SetQuestion(h.domain, dns.TypeNS)
+	ping.RecursionDesired = h.recursionDesired
+	ping.Id = 0
+
+	wire, err := ping.Pack()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.writeTimeout+h.readTimeout)
+	defer cancel()
+
+	tlsConfig := h.tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{doqALPN}
+
+	var conn *quic.Conn
+	if h.localAddress != nil {
+		raddr, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			return err
+		}
+		pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: h.localAddress})
+		if err != nil {
+			return err
+		}
+		defer pc.Close()
+		conn, err = quic.Dial(ctx, pc, raddr, tlsConfig, nil)
+		if err != nil {
+			return err
+		}
+	} else {
+		conn, err = quic.DialAddr(ctx, addr, tlsConfig, nil)
+		if err != nil {
+			return err
+		}
+	}
+	defer conn.CloseWithError(doqCodeNoError, "")
+
+	// If we got a reply, we're alright.
+	_, err = exchangeDoQ(ctx, conn, wire, h.readTimeout)
+	return err
+}
+
+func (h *doqHc) SetTLSConfig(cfg *tls.Config) { h.tlsConfig = cfg }
+func (h *doqHc) GetTLSConfig() *tls.Config    { return h.tlsConfig }
+
+func (h *doqHc) SetRecursionDesired(recursionDesired bool) {
+	h.recursionDesired = recursionDesired
+}
+func (h *doqHc) GetRecursionDesired() bool {
+	return h.recursionDesired
+}
+
+func (h *doqHc) SetDomain(domain string) {
+	h.domain = domain
+}
+func (h *doqHc) GetDomain() string {
+	return h.domain
+}
+
+func (h *doqHc) SetTCPTransport() {
+	// no-op for DoQ
+}
+
+func (h *doqHc) GetReadTimeout() time.Duration  { return h.readTimeout }
+func (h *doqHc) SetReadTimeout(t time.Duration) { h.readTimeout = t }
+
+func (h *doqHc) GetWriteTimeout() time.Duration  { return h.writeTimeout }
+func (h *doqHc) SetWriteTimeout(t time.Duration) { h.writeTimeout = t }
+
+func (h *doqHc) SetLocalAddress(localAddr net.IP) { h.localAddress = localAddr }
+func (h *doqHc) GetLocalAddress() net.IP          { return h.localAddress }
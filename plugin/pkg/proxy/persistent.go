@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
 )
 
 // a persistConn holds the dns.Conn, its creation time, and the last used time.
@@ -31,6 +32,13 @@ type Transport struct {
 	proxyName    string
 	localAddress net.IP
 
+	// DNS-over-QUIC multiplexes all queries over a single connection.
+	quicMu         sync.Mutex
+	quicConn       *quic.Conn
+	quicCreated    time.Time
+	quicPacketConn net.PacketConn // only set when a local address is configured
+	quicSessions   tls.ClientSessionCache
+
 	mu   sync.Mutex
 	stop chan struct{}
 }
@@ -58,6 +66,10 @@ func (t *Transport) connManager() {
 			t.cleanup(false)
 		case <-t.stop:
 			t.cleanup(true)
+			t.quicMu.Lock()
+			t.closeQUIC()
+			t.quicMu.Unlock()
+			t.closeHTTP3()
 			return
 		}
 	}
@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"context"
 	"crypto/tls"
 	"net"
 	"net/http"
@@ -10,10 +11,16 @@ import (
 
 	"github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/pkg/up"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
 )
 
 // Proxy defines an upstream host.
 type Proxy struct {
+	rtt      int64 // moving average of the round trip time in nanoseconds, 0 if unknown; atomic counters need to be first in struct for proper alignment
+	inflight int64 // number of queries waiting for a reply
+
 	fails     uint32
 	addr      string
 	proxyName string
@@ -57,7 +64,12 @@ func (p *Proxy) SetTLSConfig(cfg *tls.Config) {
 	p.transport.SetTLSConfig(cfg)
 	p.health.SetTLSConfig(cfg)
 	if p.transport.httpClient != nil {
-		p.transport.httpClient.Transport.(*http.Transport).TLSClientConfig = cfg
+		switch rt := p.transport.httpClient.Transport.(type) {
+		case *http.Transport:
+			rt.TLSClientConfig = cfg
+		case *http3.Transport:
+			rt.TLSClientConfig = cfg
+		}
 	}
 }
 
@@ -73,8 +85,11 @@ func (p *Proxy) SetMaxAge(maxAge time.Duration) { p.transport.SetMaxAge(maxAge)
 func (p *Proxy) SetMaxIdleConns(n int) {
 	p.transport.SetMaxIdleConns(n)
 	if p.transport.httpClient != nil {
-		p.transport.httpClient.Transport.(*http.Transport).MaxIdleConns = n
-		p.transport.httpClient.Transport.(*http.Transport).MaxIdleConnsPerHost = n
+		// HTTP/3 multiplexes all requests over a single QUIC connection, so this only applies to HTTP/1 and HTTP/2.
+		if rt, ok := p.transport.httpClient.Transport.(*http.Transport); ok {
+			rt.MaxIdleConns = n
+			rt.MaxIdleConnsPerHost = n
+		}
 	}
 }
 
@@ -104,6 +119,21 @@ func (p *Proxy) Fails() uint32 {
 	return atomic.LoadUint32(&p.fails)
 }
 
+// RTT returns the moving average of the round trip time of queries to this upstream. It returns 0 if no
+// query has been answered yet.
+func (p *Proxy) RTT() time.Duration { return time.Duration(atomic.LoadInt64(&p.rtt)) }
+
+// InFlight returns the number of queries sent to this upstream that are waiting for a reply.
+func (p *Proxy) InFlight() int64 { return atomic.LoadInt64(&p.inflight) }
+
+// updateRTT moves the round trip time average towards rtt. The first observation is taken as is.
+func (p *Proxy) updateRTT(rtt time.Duration) {
+	if atomic.CompareAndSwapInt64(&p.rtt, 0, int64(rtt)) {
+		return
+	}
+	averageTimeout(&p.rtt, rtt, cumulativeAvgWeight)
+}
+
 // Healthcheck kicks of a round of health checks for this proxy.
 func (p *Proxy) Healthcheck() {
 	if p.health == nil {
@@ -126,8 +156,14 @@ func (p *Proxy) Down(maxfails uint32) bool {
 	return fails > maxfails
 }
 
-// Stop close stops the health checking goroutine.
-func (p *Proxy) Stop()      { p.probe.Stop() }
+// Stop close stops the health checking goroutine, and closes the connections of the health checker.
+func (p *Proxy) Stop() {
+	p.probe.Stop()
+	if h, ok := p.health.(*dohHc); ok {
+		h.close()
+	}
+}
+
 func (p *Proxy) finalizer() { p.transport.Stop() }
 
 // Start starts the proxy's healthchecking.
@@ -154,13 +190,45 @@ func (p *Proxy) incrementFails() {
 func (p *Proxy) SetLocalAddress(addr net.IP) {
 	p.transport.SetLocalAddress(addr)
 	if p.transport.httpClient != nil {
-		httpTransport := p.transport.httpClient.Transport.(*http.Transport)
+		setHTTPLocalAddress(p.transport.httpClient.Transport, addr)
+	}
+}
+
+// setHTTPLocalAddress makes the HTTP round tripper rt dial from the local address addr.
+func setHTTPLocalAddress(rt http.RoundTripper, addr net.IP) {
+	switch rt := rt.(type) {
+	case *http.Transport:
 		if addr == nil {
-			httpTransport.DialContext = nil
+			rt.DialContext = nil
 			return
 		}
 		dialer := &net.Dialer{LocalAddr: &net.TCPAddr{IP: addr}}
-		httpTransport.DialContext = dialer.DialContext
+		rt.DialContext = dialer.DialContext
+	case *http3.Transport:
+		if addr == nil {
+			rt.Dial = nil
+			return
+		}
+		rt.Dial = func(ctx context.Context, target string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+			raddr, err := net.ResolveUDPAddr("udp", target)
+			if err != nil {
+				return nil, err
+			}
+			pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: addr})
+			if err != nil {
+				return nil, err
+			}
+			conn, err := quic.DialEarly(ctx, pc, raddr, tlsCfg, cfg)
+			if err != nil {
+				pc.Close()
+				return nil, err
+			}
+			go func() {
+				<-conn.Context().Done()
+				pc.Close()
+			}()
+			return conn, nil
+		}
 	}
 }
 
@@ -391,3 +391,38 @@ func TestProxyMalformedUDPThenValid(t *testing.T) {
 		})
 	}
 }
+
+func TestProxyRTT(t *testing.T) {
+	s := dnstest.NewServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		time.Sleep(20 * time.Millisecond)
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		w.WriteMsg(ret)
+	})
+	defer s.Close()
+
+	p := NewProxy("TestProxyRTT", s.Addr, transport.DNS)
+	p.Start(5 * time.Second)
+	defer p.Stop()
+	if p.RTT() != 0 {
+		t.Fatalf("Expected no RTT before the first query, got %s", p.RTT())
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	req := request.Request{Req: m, W: &test.ResponseWriter{}}
+	if _, _, _, err := p.Connect(context.Background(), req, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if rtt := p.RTT(); rtt < 20*time.Millisecond || rtt > time.Second {
+		t.Errorf("Expected RTT of about 20ms, got %s", rtt)
+	}
+	if p.InFlight() != 0 {
+		t.Errorf("Expected no queries in flight, got %d", p.InFlight())
+	}
+
+	p.updateRTT(100 * time.Millisecond)
+	if rtt := p.RTT(); rtt < 40*time.Millisecond || rtt > 100*time.Millisecond {
+		t.Errorf("Expected RTT to move towards 100ms, got %s", rtt)
+	}
+}
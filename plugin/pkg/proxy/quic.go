@@ -0,0 +1,249 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// doqALPN is the ALPN token for DNS-over-QUIC, see RFC 9250, section 4.1.1.
+const doqALPN = "doq"
+
+// doqCodeNoError is the DOQ_NO_ERROR application error code (RFC 9250, section 4.3).
+const doqCodeNoError = 0
+
+// quicConfig returns the QUIC configuration used for upstream DoQ connections. Idle
+// connections are closed after the same expire duration used for the TCP and UDP cache.
+func (t *Transport) quicConfig() *quic.Config {
+	return &quic.Config{MaxIdleTimeout: t.expire}
+}
+
+// quicTLSConfig returns a copy of the transport's TLS config with the DoQ ALPN set. The session
+// cache is shared with the original config, which allows resumption and 0-RTT on reconnects.
+// Must be called with quicMu held.
+func (t *Transport) quicTLSConfig() *tls.Config {
+	var cfg *tls.Config
+	if t.tlsConfig == nil {
+		cfg = new(tls.Config)
+	} else {
+		cfg = t.tlsConfig.Clone()
+	}
+	cfg.NextProtos = []string{doqALPN}
+	if cfg.ClientSessionCache == nil {
+		if t.quicSessions == nil {
+			t.quicSessions = tls.NewLRUClientSessionCache(1)
+		}
+		cfg.ClientSessionCache = t.quicSessions
+	}
+	return cfg
+}
+
+// DialQUIC returns the cached QUIC connection to the upstream, or dials a new one. All queries
+// to the upstream are multiplexed as separate streams over this single connection. The returned
+// bool is true when an already established connection was reused.
+func (t *Transport) DialQUIC(ctx context.Context) (*quic.Conn, bool, error) {
+	select {
+	case <-t.stop:
+		return nil, false, errors.New(ErrTransportStopped)
+	default:
+	}
+
+	t.quicMu.Lock()
+	defer t.quicMu.Unlock()
+
+	if t.quicConn != nil {
+		if t.quicConn.Context().Err() == nil && !t.quicExpired() {
+			connCacheHitsCount.WithLabelValues(t.proxyName, t.addr, "udp").Add(1)
+			return t.quicConn, true, nil
+		}
+		t.closeQUIC()
+	}
+
+	connCacheMissesCount.WithLabelValues(t.proxyName, t.addr, "udp").Add(1)
+
+	reqTime := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, t.dialTimeout())
+	defer cancel()
+
+	var (
+		conn *quic.Conn
+		err  error
+	)
+	if t.localAddress != nil {
+		raddr, rerr := net.ResolveUDPAddr("udp", t.addr)
+		if rerr != nil {
+			return nil, false, rerr
+		}
+		pc, lerr := net.ListenUDP("udp", &net.UDPAddr{IP: t.localAddress})
+		if lerr != nil {
+			return nil, false, lerr
+		}
+		// DialEarly allows sending 0-RTT data when we have a session ticket for this upstream.
+		conn, err = quic.DialEarly(ctx, pc, raddr, t.quicTLSConfig(), t.quicConfig())
+		if err != nil {
+			pc.Close()
+		} else {
+			t.quicPacketConn = pc
+		}
+	} else {
+		conn, err = quic.DialAddrEarly(ctx, t.addr, t.quicTLSConfig(), t.quicConfig())
+	}
+	t.updateDialTimeout(time.Since(reqTime))
+	if err != nil {
+		return nil, false, err
+	}
+
+	t.quicConn = conn
+	t.quicCreated = time.Now()
+	return conn, false, nil
+}
+
+// quicExpired returns true if the cached QUIC connection is older than the configured max age.
+// Must be called with quicMu held.
+func (t *Transport) quicExpired() bool {
+	return t.maxAge > 0 && time.Since(t.quicCreated) > t.maxAge
+}
+
+// closeQUIC closes the cached QUIC connection. Must be called with quicMu held.
+func (t *Transport) closeQUIC() {
+	if t.quicConn != nil {
+		t.quicConn.CloseWithError(doqCodeNoError, "")
+		t.quicConn = nil
+	}
+	if t.quicPacketConn != nil {
+		t.quicPacketConn.Close()
+		t.quicPacketConn = nil
+	}
+}
+
+// closeHTTP3 closes the QUIC connections of the DNS-over-HTTP/3 client, if there is one.
+func (t *Transport) closeHTTP3() {
+	if t.httpClient == nil {
+		return
+	}
+	if rt, ok := t.httpClient.Transport.(*http3.Transport); ok {
+		rt.Close()
+	}
+}
+
+// replaceQUIC caches next instead of conn, if conn is still the cached connection.
+func (t *Transport) replaceQUIC(conn, next *quic.Conn) {
+	t.quicMu.Lock()
+	defer t.quicMu.Unlock()
+	if t.quicConn == conn {
+		t.quicConn = next
+	}
+}
+
+// dropQUIC removes conn from the cache if it is still the cached connection.
+func (t *Transport) dropQUIC(conn *quic.Conn) {
+	t.quicMu.Lock()
+	defer t.quicMu.Unlock()
+	if t.quicConn == conn {
+		t.closeQUIC()
+	}
+}
+
+func (p *Proxy) lookupDoQ(ctx context.Context, state request.Request, _ Options) (*dns.Msg, net.Addr, string, error) {
+	// DoQ always runs over UDP, regardless of the downstream client's protocol.
+	const proto = "udp"
+
+	// The DNS Message ID MUST be set to 0, see RFC 9250, section 4.2.1.
+	originId := state.Req.Id
+	state.Req.Id = 0
+	defer func() {
+		state.Req.Id = originId
+	}()
+
+	wire, err := state.Req.Pack()
+	if err != nil {
+		return nil, nil, proto, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	conn, cached, err := p.transport.DialQUIC(ctx)
+	if err != nil {
+		return nil, nil, proto, err
+	}
+	localAddr := conn.LocalAddr()
+
+	// 0-RTT data can be replayed by an attacker, so only plain queries are allowed to
+	// be sent before the handshake is complete, see RFC 9250, section 4.5.
+	if state.Req.Opcode != dns.OpcodeQuery {
+		select {
+		case <-conn.HandshakeComplete():
+		case <-ctx.Done():
+			return nil, localAddr, proto, ctx.Err()
+		}
+	}
+
+	ret, err := exchangeDoQ(ctx, conn, wire, p.readTimeout)
+	if errors.Is(err, quic.Err0RTTRejected) {
+		// The server didn't accept our early data, resend it once the handshake is done. The connection
+		// for after the handshake replaces the rejected one in the cache, so later queries use it.
+		var next *quic.Conn
+		if next, err = conn.NextConnection(ctx); err == nil {
+			p.transport.replaceQUIC(conn, next)
+			conn = next
+			ret, err = exchangeDoQ(ctx, conn, wire, p.readTimeout)
+		}
+	}
+	if err != nil {
+		if conn.Context().Err() != nil {
+			p.transport.dropQUIC(conn)
+			if cached {
+				return nil, localAddr, proto, ErrCachedClosed
+			}
+		}
+		return nil, localAddr, proto, err
+	}
+
+	ret.Id = originId
+	return ret, localAddr, proto, nil
+}
+
+// exchangeDoQ sends the packed message in wire on a new stream on conn and reads back the reply.
+func exchangeDoQ(ctx context.Context, conn *quic.Conn, wire []byte, timeout time.Duration) (*dns.Msg, error) {
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stream.SetDeadline(time.Now().Add(timeout))
+
+	buf := make([]byte, 2+len(wire))
+	binary.BigEndian.PutUint16(buf, uint16(len(wire))) // #nosec G115 -- DNS message length fits in uint16
+	copy(buf[2:], wire)
+	if _, err := stream.Write(buf); err != nil {
+		stream.CancelRead(doqCodeNoError)
+		return nil, err
+	}
+	// Signal we're done sending with a STREAM FIN, see RFC 9250, section 4.2.
+	stream.Close()
+
+	var length uint16
+	if err := binary.Read(stream, binary.BigEndian, &length); err != nil {
+		stream.CancelRead(doqCodeNoError)
+		return nil, err
+	}
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(stream, msg); err != nil {
+		stream.CancelRead(doqCodeNoError)
+		return nil, err
+	}
+
+	ret := new(dns.Msg)
+	if err := ret.Unpack(msg); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,292 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/doh"
+	ctls "github.com/coredns/coredns/plugin/pkg/tls"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+func serverTLSConfig(t *testing.T, nextProto string) *tls.Config {
+	t.Helper()
+	cfg, err := ctls.NewTLSConfig("../../tls/test_cert.pem", "../../tls/test_key.pem", "")
+	if err != nil {
+		t.Fatalf("Failed to create TLS config: %s", err)
+	}
+	cfg.NextProtos = []string{nextProto}
+	return cfg
+}
+
+func reply(r *dns.Msg) *dns.Msg {
+	ret := new(dns.Msg)
+	ret.SetReply(r)
+	ret.Answer = append(ret.Answer, test.A("example.org. IN A 127.0.0.1"))
+	return ret
+}
+
+// newDoQServer starts a minimal DNS-over-QUIC server and returns its address. The channel receives
+// the message ID of every query that was received.
+func newDoQServer(t *testing.T) (string, chan uint16) {
+	t.Helper()
+	ln, err := quic.ListenAddrEarly("127.0.0.1:0", serverTLSConfig(t, doqALPN), &quic.Config{Allow0RTT: true})
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	ids := make(chan uint16, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				for {
+					stream, err := conn.AcceptStream(context.Background())
+					if err != nil {
+						return
+					}
+					go func() {
+						defer stream.Close()
+						var length uint16
+						if err := binary.Read(stream, binary.BigEndian, &length); err != nil {
+							return
+						}
+						buf := make([]byte, length)
+						if _, err := io.ReadFull(stream, buf); err != nil {
+							return
+						}
+						m := new(dns.Msg)
+						if err := m.Unpack(buf); err != nil {
+							return
+						}
+						ids <- m.Id
+						out, _ := reply(m).Pack()
+						binary.Write(stream, binary.BigEndian, uint16(len(out)))
+						stream.Write(out)
+					}()
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), ids
+}
+
+func TestProxyQUIC(t *testing.T) {
+	addr, ids := newDoQServer(t)
+
+	p := NewProxy("TestProxyQUIC", addr, transport.QUIC)
+	p.SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+	p.Start(5 * time.Second)
+	defer p.Stop()
+
+	for i := range 2 {
+		m := new(dns.Msg)
+		m.SetQuestion("example.org.", dns.TypeA)
+		req := request.Request{W: &test.ResponseWriter{TCP: true}, Req: m}
+
+		resp, _, proto, err := p.Connect(context.Background(), req, Options{})
+		if err != nil {
+			t.Fatalf("Query %d: failed to connect to DoQ server: %s", i, err)
+		}
+		if proto != "udp" {
+			t.Errorf("Query %d: expected proto %q, got %q", i, "udp", proto)
+		}
+		if resp.Id != m.Id {
+			t.Errorf("Query %d: expected reply id %d, got %d", i, m.Id, resp.Id)
+		}
+		if x := resp.Answer[0].Header().Name; x != "example.org." {
+			t.Errorf("Query %d: expected %s, got %s", i, "example.org.", x)
+		}
+		if id := <-ids; id != 0 {
+			t.Errorf("Query %d: expected DoQ message id 0 on the wire, got %d", i, id)
+		}
+	}
+
+	// Both queries must have been sent over the same connection.
+	p.transport.quicMu.Lock()
+	conn := p.transport.quicConn
+	p.transport.quicMu.Unlock()
+	if conn == nil {
+		t.Fatal("Expected a cached QUIC connection")
+	}
+}
+
+func TestProxyQUICReconnect(t *testing.T) {
+	addr, _ := newDoQServer(t)
+
+	p := NewProxy("TestProxyQUICReconnect", addr, transport.QUIC)
+	p.SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+	p.Start(5 * time.Second)
+	defer p.Stop()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	req := request.Request{W: &test.ResponseWriter{}, Req: m}
+
+	if _, _, _, err := p.Connect(context.Background(), req, Options{}); err != nil {
+		t.Fatalf("Failed to connect to DoQ server: %s", err)
+	}
+
+	p.transport.quicMu.Lock()
+	first := p.transport.quicConn
+	p.transport.quicMu.Unlock()
+	first.CloseWithError(0, "")
+
+	if _, _, _, err := p.Connect(context.Background(), req, Options{}); err != nil {
+		t.Fatalf("Failed to reconnect to DoQ server: %s", err)
+	}
+	p.transport.quicMu.Lock()
+	second := p.transport.quicConn
+	p.transport.quicMu.Unlock()
+	if second == first {
+		t.Error("Expected a new QUIC connection after the old one was closed")
+	}
+}
+
+func TestHealthQUIC(t *testing.T) {
+	addr, _ := newDoQServer(t)
+
+	p := NewProxy("TestHealthQUIC", addr, transport.QUIC)
+	p.SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+	if err := p.health.Check(p); err != nil {
+		t.Errorf("Expected healthy DoQ upstream, got: %s", err)
+	}
+
+	// Nothing listens here.
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadAddr := pc.LocalAddr().String()
+	pc.Close()
+
+	p = NewProxy("TestHealthQUIC", deadAddr, transport.QUIC)
+	p.SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+	p.health.SetReadTimeout(10 * time.Millisecond)
+	p.health.SetWriteTimeout(10 * time.Millisecond)
+	if err := p.health.Check(p); err == nil {
+		t.Error("Expected unhealthy DoQ upstream")
+	}
+	if p.Fails() != 1 {
+		t.Errorf("Expected 1 fail, got %d", p.Fails())
+	}
+}
+
+func TestProxyHTTPS3(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &http3.Server{
+		TLSConfig: serverTLSConfig(t, http3.NextProtoH3),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			msg, err := doh.RequestToMsg(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			buf, _ := reply(msg).Pack()
+			w.Header().Set("Content-Type", doh.MimeType)
+			w.Write(buf)
+		}),
+	}
+	go s.Serve(pc)
+	defer s.Close()
+
+	for _, method := range []string{http.MethodPost, http.MethodGet} {
+		p := NewProxy("TestProxyHTTPS3", pc.LocalAddr().String(), transport.HTTPS3)
+		p.SetHTTPClient(&http.Client{Transport: &http3.Transport{}, Timeout: 2 * time.Second})
+		p.SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+		p.SetDOHRequestOptions(method)
+
+		m := new(dns.Msg)
+		m.SetQuestion("example.org.", dns.TypeA)
+		req := request.Request{W: &test.ResponseWriter{TCP: true}, Req: m}
+
+		resp, _, proto, err := p.Connect(context.Background(), req, Options{})
+		if err != nil {
+			t.Fatalf("%s: failed to connect to DoH3 server: %s", method, err)
+		}
+		if proto != "udp" {
+			t.Errorf("%s: expected proto %q, got %q", method, "udp", proto)
+		}
+		if x := resp.Answer[0].Header().Name; x != "example.org." {
+			t.Errorf("%s: expected %s, got %s", method, "example.org.", x)
+		}
+		if err := p.health.Check(p); err != nil {
+			t.Errorf("%s: expected healthy DoH3 upstream, got: %s", method, err)
+		}
+	}
+}
+
+func TestProxyHTTPS3Stop(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &http3.Server{
+		TLSConfig: serverTLSConfig(t, http3.NextProtoH3),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			msg, err := doh.RequestToMsg(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			buf, _ := reply(msg).Pack()
+			w.Header().Set("Content-Type", doh.MimeType)
+			w.Write(buf)
+		}),
+	}
+	go s.Serve(pc)
+	defer s.Close()
+
+	p := NewProxy("TestProxyHTTPS3Stop", pc.LocalAddr().String(), transport.HTTPS3)
+	p.SetHTTPClient(&http.Client{Transport: &http3.Transport{}, Timeout: 2 * time.Second})
+	p.SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+	p.Start(time.Hour)
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	req := request.Request{W: &test.ResponseWriter{TCP: true}, Req: m}
+	if _, _, _, err := p.Connect(context.Background(), req, Options{}); err != nil {
+		t.Fatalf("Failed to connect to DoH3 server: %s", err)
+	}
+	if err := p.health.Check(p); err != nil {
+		t.Fatalf("Expected healthy DoH3 upstream, got: %s", err)
+	}
+
+	p.Stop()
+	if err := p.health.Check(p); !errors.Is(err, http3.ErrTransportClosed) {
+		t.Errorf("Expected the health checker to be closed, got: %v", err)
+	}
+
+	p.transport.Stop()
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, _, _, err := p.Connect(context.Background(), req, Options{})
+		if errors.Is(err, http3.ErrTransportClosed) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the DoH3 transport to be closed, got: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,18 @@
+package ratelimit
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// limitedCount is the number of queries that exceeded the rate limit, by key and what was done with them.
+	limitedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "limited_requests_total",
+		Help:      "Counter of queries that exceeded the rate limit, per key and action (refused, dropped or truncated).",
+	}, []string{"server", "zone", "view", "key", "action"})
+)
@@ -0,0 +1,162 @@
+// Package ratelimit implements a plugin that limits the rate of queries per client.
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/ecs"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/request"
+
+	"github.com/infobloxopen/go-trees/iptree"
+	"github.com/miekg/dns"
+)
+
+var log = clog.NewWithPlugin(pluginName)
+
+// namespaceLabel is the metadata label of the namespace of the client pod, set by the kubernetes plugin.
+const namespaceLabel = "kubernetes/client-namespace"
+
+// Ratelimit limits the rate of queries per client with a token bucket for every key.
+type Ratelimit struct {
+	Next  plugin.Handler
+	Zones []string
+
+	by         by
+	ipv4Prefix int
+	ipv6Prefix int
+	action     action
+
+	allow           *iptree.Tree
+	allowNamespaces map[string]struct{}
+	ecsFrom         *iptree.Tree // the forwarders whose client subnets are used with byECS
+
+	table  *table
+	labels *labels
+	now    func() time.Time
+}
+
+// by is what the buckets are keyed by.
+type by uint8
+
+const (
+	// byClient keys on the network of the client address.
+	byClient by = iota
+	// byECS keys on the network of the EDNS0 client subnet of queries from trusted forwarders, and on
+	// the network of the client address otherwise.
+	byECS
+	// byNamespace keys on the namespace of the client pod, or on the network of the client address if it
+	// is not known.
+	byNamespace
+)
+
+// action is how limited queries are answered.
+type action uint8
+
+const (
+	actionRefused action = iota
+	actionDrop
+	actionTruncate
+)
+
+var actionNames = [...]string{actionRefused: "refused", actionDrop: "dropped", actionTruncate: "truncated"}
+
+// ServeDNS implements the plugin.Handler interface.
+func (rl *Ratelimit) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+
+	zone := plugin.Zones(rl.Zones).Matches(state.Name())
+	if zone == "" {
+		return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, w, r)
+	}
+	k, ok := rl.key(ctx, state)
+	if !ok || rl.table.take(k, rl.now()) {
+		return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, w, r)
+	}
+
+	act := rl.action
+	if act == actionTruncate && state.Proto() != "udp" {
+		// Only UDP clients retry over TCP, truncating a TCP reply makes no sense.
+		act = actionRefused
+	}
+	limitedCount.WithLabelValues(metrics.WithServer(ctx), zone, metrics.WithView(ctx), rl.labels.label(k), actionNames[act]).Inc()
+
+	switch act {
+	case actionDrop:
+		// Nothing is written, and RcodeSuccess makes sure the server doesn't write a reply either.
+		return dns.RcodeSuccess, nil
+	case actionTruncate:
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Truncated = true
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	}
+	m := new(dns.Msg)
+	m.SetRcode(r, dns.RcodeRefused)
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+}
+
+// key returns the key of the bucket for the query. It returns false if the query is never limited. Only
+// the client address is checked against the allowed networks: the client subnet is set by the client,
+// and is only used for queries from the forwarders in ecsFrom.
+func (rl *Ratelimit) key(ctx context.Context, state request.Request) (string, bool) {
+	ip := parseIP(state.IP())
+	if ip == nil {
+		return "", false
+	}
+	if _, ok := rl.allow.GetByIP(ip); ok {
+		return "", false
+	}
+
+	switch rl.by {
+	case byECS:
+		if _, ok := rl.ecsFrom.GetByIP(ip); !ok {
+			break
+		}
+		if e := ecs.Get(state.Req); e != nil {
+			bits := int(e.SourceNetmask)
+			if e.Family == 1 {
+				return prefix(e.Address.To4(), min(bits, rl.ipv4Prefix), 32), true
+			}
+			return prefix(e.Address, min(bits, rl.ipv6Prefix), 128), true
+		}
+	case byNamespace:
+		if f := metadata.ValueFunc(ctx, namespaceLabel); f != nil {
+			if ns := f(); ns != "" {
+				if _, ok := rl.allowNamespaces[ns]; ok {
+					return "", false
+				}
+				return ns, true
+			}
+		}
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return prefix(ip4, rl.ipv4Prefix, 32), true
+	}
+	return prefix(ip, rl.ipv6Prefix, 128), true
+}
+
+// Name implements the plugin.Handler interface.
+func (rl *Ratelimit) Name() string { return pluginName }
+
+// prefix returns the network of ip with a prefix length of ones, in CIDR notation.
+func prefix(ip net.IP, ones, bits int) string {
+	mask := net.CIDRMask(ones, bits)
+	return (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String()
+}
+
+func parseIP(s string) net.IP {
+	if idx := strings.IndexByte(s, '%'); idx >= 0 {
+		s = s[:idx]
+	}
+	return net.ParseIP(s)
+}
@@ -0,0 +1,228 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/ecs"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// answer is a handler that replies with a positive answer.
+var answer = plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Answer = []dns.RR{test.A(r.Question[0].Name + " 300 IN A 192.0.2.1")}
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+})
+
+func newRatelimit(t *testing.T, config string) (*Ratelimit, *time.Time) {
+	t.Helper()
+	c := caddy.NewTestController("dns", config)
+	rl, err := parse(c)
+	if err != nil {
+		t.Fatalf("Failed to parse %q: %s", config, err)
+	}
+	now := time.Unix(1700000000, 0)
+	rl.now = func() time.Time { return now }
+	rl.Next = answer
+	return rl, &now
+}
+
+// query sends a query from ip and returns the response, nil if nothing was written.
+func query(t *testing.T, ctx context.Context, rl *Ratelimit, ip string, tcp bool, opt func(*dns.Msg)) *dns.Msg {
+	t.Helper()
+	m := new(dns.Msg)
+	m.SetQuestion("www.example.org.", dns.TypeA)
+	if opt != nil {
+		opt(m)
+	}
+	rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: ip, TCP: tcp})
+	if _, err := rl.ServeDNS(ctx, rec, m); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	return rec.Msg
+}
+
+// outcome describes what happened to a query.
+func outcome(m *dns.Msg) string {
+	switch {
+	case m == nil:
+		return "dropped"
+	case m.Truncated:
+		return "truncated"
+	case m.Rcode == dns.RcodeRefused:
+		return "refused"
+	case len(m.Answer) > 0:
+		return "answered"
+	}
+	return "unknown"
+}
+
+func TestRatelimit(t *testing.T) {
+	rl, now := newRatelimit(t, `ratelimit . {
+		rate 2
+		burst 3
+		ipv4_prefix_length 24
+		allow 192.0.2.0/24
+	}`)
+	ctx := context.TODO()
+
+	for i, expected := range []string{"answered", "answered", "answered", "refused", "refused"} {
+		if x := outcome(query(t, ctx, rl, "10.0.0.1", false, nil)); x != expected {
+			t.Errorf("Query %d: expected %s, got %s", i, expected, x)
+		}
+	}
+	// The same network shares the bucket, over any transport.
+	if x := outcome(query(t, ctx, rl, "10.0.0.2", true, nil)); x != "refused" {
+		t.Errorf("Expected query from the same network to be refused, got %s", x)
+	}
+	// Other networks and allowed clients are not limited.
+	if x := outcome(query(t, ctx, rl, "10.0.1.1", false, nil)); x != "answered" {
+		t.Errorf("Expected query from another network to be answered, got %s", x)
+	}
+	for i := range 10 {
+		if x := outcome(query(t, ctx, rl, "192.0.2.1", false, nil)); x != "answered" {
+			t.Errorf("Query %d: expected query from allowed client to be answered, got %s", i, x)
+		}
+	}
+
+	// Half a second refills one token.
+	*now = now.Add(500 * time.Millisecond)
+	for i, expected := range []string{"answered", "refused"} {
+		if x := outcome(query(t, ctx, rl, "10.0.0.1", false, nil)); x != expected {
+			t.Errorf("Query %d after refill: expected %s, got %s", i, expected, x)
+		}
+	}
+}
+
+func TestRatelimitActions(t *testing.T) {
+	tests := []struct {
+		action   string
+		tcp      bool
+		expected string
+	}{
+		{"refused", false, "refused"},
+		{"drop", false, "dropped"},
+		{"drop", true, "dropped"},
+		{"truncate", false, "truncated"},
+		{"truncate", true, "refused"},
+	}
+	for _, tc := range tests {
+		rl, _ := newRatelimit(t, `ratelimit . {
+			rate 1
+			action `+tc.action+`
+		}`)
+		query(t, context.TODO(), rl, "10.0.0.1", tc.tcp, nil)
+		if x := outcome(query(t, context.TODO(), rl, "10.0.0.1", tc.tcp, nil)); x != tc.expected {
+			t.Errorf("Action %s (tcp: %t): expected %s, got %s", tc.action, tc.tcp, tc.expected, x)
+		}
+	}
+}
+
+func TestRatelimitECS(t *testing.T) {
+	rl, _ := newRatelimit(t, `ratelimit . {
+		rate 1
+		key ecs 10.0.0.1
+		ipv4_prefix_length 24
+		allow 198.51.100.0/24
+	}`)
+	subnet := func(ip string, bits uint8) func(*dns.Msg) {
+		return func(m *dns.Msg) {
+			m.SetEdns0(4096, false)
+			ecs.Set(m, ecs.New(net.ParseIP(ip), bits, 56))
+		}
+	}
+	ctx := context.TODO()
+
+	// Clients behind the same forwarder are told apart by their subnet.
+	for i, ip := range []string{"203.0.113.1", "192.0.2.1", "198.18.0.1"} {
+		if x := outcome(query(t, ctx, rl, "10.0.0.1", false, subnet(ip, 32))); x != "answered" {
+			t.Errorf("Query %d: expected query for subnet %s to be answered, got %s", i, ip, x)
+		}
+	}
+	// The subnet is truncated to the prefix length.
+	if x := outcome(query(t, ctx, rl, "10.0.0.1", false, subnet("203.0.113.200", 32))); x != "refused" {
+		t.Errorf("Expected query for a limited subnet to be refused, got %s", x)
+	}
+	// The allowed networks apply to the client address, not to the subnet.
+	for i, expected := range []string{"answered", "refused"} {
+		if x := outcome(query(t, ctx, rl, "10.0.0.1", false, subnet("198.51.100.1", 24))); x != expected {
+			t.Errorf("Query %d for allowed subnet: expected %s, got %s", i, expected, x)
+		}
+	}
+	for range 3 {
+		if x := outcome(query(t, ctx, rl, "198.51.100.1", false, subnet("203.0.113.1", 32))); x != "answered" {
+			t.Errorf("Expected query from allowed client to be answered, got %s", x)
+		}
+	}
+	// Without a subnet, the client address is used.
+	for i, expected := range []string{"answered", "refused"} {
+		if x := outcome(query(t, ctx, rl, "10.0.0.1", false, nil)); x != expected {
+			t.Errorf("Query %d without subnet: expected %s, got %s", i, expected, x)
+		}
+	}
+	// The subnet of other clients is ignored, so rotating it doesn't get them a new bucket.
+	for i, expected := range []string{"answered", "refused", "refused"} {
+		ip := net.IPv4(192, 0, byte(i), 1).String()
+		if x := outcome(query(t, ctx, rl, "10.9.0.1", false, subnet(ip, 32))); x != expected {
+			t.Errorf("Query %d from an untrusted client: expected %s, got %s", i, expected, x)
+		}
+	}
+}
+
+func TestRatelimitNamespace(t *testing.T) {
+	rl, _ := newRatelimit(t, `ratelimit . {
+		rate 1
+		key namespace
+		allow_namespace kube-system
+	}`)
+	withNamespace := func(ns string) context.Context {
+		ctx := metadata.ContextWithMetadata(context.TODO())
+		metadata.SetValueFunc(ctx, namespaceLabel, func() string { return ns })
+		return ctx
+	}
+
+	// Pods in one namespace share the bucket.
+	if x := outcome(query(t, withNamespace("noisy"), rl, "10.0.0.1", false, nil)); x != "answered" {
+		t.Errorf("Expected first query to be answered, got %s", x)
+	}
+	if x := outcome(query(t, withNamespace("noisy"), rl, "10.0.0.2", false, nil)); x != "refused" {
+		t.Errorf("Expected query from the same namespace to be refused, got %s", x)
+	}
+	if x := outcome(query(t, withNamespace("quiet"), rl, "10.0.0.1", false, nil)); x != "answered" {
+		t.Errorf("Expected query from another namespace to be answered, got %s", x)
+	}
+	for range 3 {
+		if x := outcome(query(t, withNamespace("kube-system"), rl, "10.0.0.3", false, nil)); x != "answered" {
+			t.Errorf("Expected query from allowed namespace to be answered, got %s", x)
+		}
+	}
+	// Clients that are not pods are keyed on their address.
+	if x := outcome(query(t, context.TODO(), rl, "10.0.0.1", false, nil)); x != "answered" {
+		t.Errorf("Expected query without namespace to be answered, got %s", x)
+	}
+	if x := outcome(query(t, context.TODO(), rl, "10.0.0.1", false, nil)); x != "refused" {
+		t.Errorf("Expected second query without namespace to be refused, got %s", x)
+	}
+}
+
+func TestRatelimitZones(t *testing.T) {
+	rl, _ := newRatelimit(t, `ratelimit example.net {
+		rate 1
+	}`)
+	for range 3 {
+		if x := outcome(query(t, context.TODO(), rl, "10.0.0.1", false, nil)); x != "answered" {
+			t.Errorf("Expected query outside the zones to be answered, got %s", x)
+		}
+	}
+}
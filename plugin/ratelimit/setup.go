@@ -0,0 +1,191 @@
+package ratelimit
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	pkgparse "github.com/coredns/coredns/plugin/pkg/parse"
+
+	"github.com/infobloxopen/go-trees/iptree"
+)
+
+const pluginName = "ratelimit"
+
+const (
+	defaultIPv4Prefix    = 32
+	defaultIPv6Prefix    = 64
+	defaultMaxKeys       = 100000
+	defaultMaxMetricKeys = 100
+)
+
+func init() { plugin.Register(pluginName, setup) }
+
+func setup(c *caddy.Controller) error {
+	rl, err := parse(c)
+	if err != nil {
+		return plugin.Error(pluginName, err)
+	}
+
+	if rl.by == byNamespace {
+		// Do this in OnStartup, so all plugins have been initialized.
+		c.OnStartup(func() error {
+			config := dnsserver.GetConfig(c)
+			if config.Handler("kubernetes") == nil || config.Handler("metadata") == nil {
+				log.Warning("The kubernetes and metadata plugins are needed to key on namespaces, keying on client networks")
+			}
+			return nil
+		})
+	}
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		rl.Next = next
+		return rl
+	})
+
+	return nil
+}
+
+func parse(c *caddy.Controller) (*Ratelimit, error) {
+	rl := &Ratelimit{
+		ipv4Prefix: defaultIPv4Prefix,
+		ipv6Prefix: defaultIPv6Prefix,
+		allow:      iptree.NewTree(),
+		ecsFrom:    iptree.NewTree(),
+		now:        time.Now,
+	}
+	var rate, burst float64
+	maxKeys, maxMetricKeys := defaultMaxKeys, defaultMaxMetricKeys
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		rl.Zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "rate":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				f, err := strconv.ParseFloat(args[0], 64)
+				if err != nil || f <= 0 || f > 1000000 {
+					return nil, c.Errf("invalid value for rate: %q, must be between 0 and 1000000", args[0])
+				}
+				rate = f
+			case "burst":
+				n, err := pkgparse.IntArg(c, 1, 1000000)
+				if err != nil {
+					return nil, err
+				}
+				burst = float64(n)
+			case "key":
+				args := c.RemainingArgs()
+				if len(args) == 0 || (args[0] != "ecs" && len(args) != 1) {
+					return nil, c.ArgErr()
+				}
+				switch args[0] {
+				case "client":
+					rl.by = byClient
+				case "ecs":
+					// The client subnet is only trusted from the forwarders listed.
+					if len(args) == 1 {
+						return nil, c.Err("key ecs needs the networks of the forwarders whose client subnets are trusted")
+					}
+					rl.by = byECS
+					for _, a := range args[1:] {
+						_, n, err := net.ParseCIDR(pkgparse.CIDR(a))
+						if err != nil {
+							return nil, c.Errf("invalid network %q", a)
+						}
+						rl.ecsFrom.InplaceInsertNet(n, struct{}{})
+					}
+				case "namespace":
+					rl.by = byNamespace
+				default:
+					return nil, c.Errf("unknown key %q", args[0])
+				}
+			case "ipv4_prefix_length":
+				n, err := pkgparse.IntArg(c, 0, 32)
+				if err != nil {
+					return nil, err
+				}
+				rl.ipv4Prefix = n
+			case "ipv6_prefix_length":
+				n, err := pkgparse.IntArg(c, 0, 128)
+				if err != nil {
+					return nil, err
+				}
+				rl.ipv6Prefix = n
+			case "action":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				switch args[0] {
+				case "refused":
+					rl.action = actionRefused
+				case "drop":
+					rl.action = actionDrop
+				case "truncate":
+					rl.action = actionTruncate
+				default:
+					return nil, c.Errf("unknown action %q", args[0])
+				}
+			case "allow":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, a := range args {
+					_, n, err := net.ParseCIDR(pkgparse.CIDR(a))
+					if err != nil {
+						return nil, c.Errf("invalid network %q", a)
+					}
+					rl.allow.InplaceInsertNet(n, struct{}{})
+				}
+			case "allow_namespace":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				if rl.allowNamespaces == nil {
+					rl.allowNamespaces = make(map[string]struct{})
+				}
+				for _, a := range args {
+					rl.allowNamespaces[a] = struct{}{}
+				}
+			case "max_keys":
+				n, err := pkgparse.IntArg(c, 1, 100000000)
+				if err != nil {
+					return nil, err
+				}
+				maxKeys = n
+			case "max_metric_keys":
+				n, err := pkgparse.IntArg(c, 0, 10000)
+				if err != nil {
+					return nil, err
+				}
+				maxMetricKeys = n
+			default:
+				return nil, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+	}
+	if rate == 0 {
+		return nil, c.Err("no rate set")
+	}
+	if burst == 0 {
+		burst = max(1, rate)
+	}
+	rl.table = newTable(rate, burst, maxKeys)
+	rl.labels = newLabels(maxMetricKeys)
+	return rl, nil
+}
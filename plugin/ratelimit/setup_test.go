@@ -0,0 +1,135 @@
+package ratelimit
+
+import (
+	"testing"
+
+	"github.com/coredns/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+	}{
+		{`ratelimit {
+			rate 10
+		}`, false},
+		{`ratelimit example.org example.net {
+			rate 0.5
+			burst 5
+			key ecs 10.0.0.53 10.1.0.0/16
+			ipv4_prefix_length 24
+			ipv6_prefix_length 56
+			action truncate
+			allow 10.0.0.0/8 192.168.1.1 ::1
+			max_keys 1000
+			max_metric_keys 0
+		}`, false},
+		{`ratelimit {
+			rate 100
+			key namespace
+			allow_namespace kube-system monitoring
+			action drop
+		}`, false},
+		// errors.
+		{`ratelimit`, true},
+		{`ratelimit {
+			burst 10
+		}`, true},
+		{`ratelimit {
+			rate
+		}`, true},
+		{`ratelimit {
+			rate -1
+		}`, true},
+		{`ratelimit {
+			rate 10
+			burst 0
+		}`, true},
+		{`ratelimit {
+			rate 10
+			key pod
+		}`, true},
+		{`ratelimit {
+			rate 10
+			key ecs
+		}`, true},
+		{`ratelimit {
+			rate 10
+			key ecs 10.0.0.300
+		}`, true},
+		{`ratelimit {
+			rate 10
+			key client 10.0.0.1
+		}`, true},
+		{`ratelimit {
+			rate 10
+			action servfail
+		}`, true},
+		{`ratelimit {
+			rate 10
+			ipv4_prefix_length 33
+		}`, true},
+		{`ratelimit {
+			rate 10
+			allow 10.0.0.0/33
+		}`, true},
+		{`ratelimit {
+			rate 10
+			allow_namespace
+		}`, true},
+		{`ratelimit {
+			rate 10
+			max_keys 0
+		}`, true},
+		{`ratelimit {
+			rate 10
+			unknown
+		}`, true},
+		{`ratelimit {
+			rate 10
+		}
+		ratelimit {
+			rate 10
+		}`, true},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		err := setup(c)
+		if tc.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error for input %q", i, tc.input)
+		}
+		if !tc.shouldErr && err != nil {
+			t.Errorf("Test %d: unexpected error for input %q: %s", i, tc.input, err)
+		}
+	}
+}
+
+func TestSetupDefaults(t *testing.T) {
+	c := caddy.NewTestController("dns", `ratelimit {
+		rate 10
+	}`)
+	rl, err := parse(c)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if rl.by != byClient || rl.action != actionRefused {
+		t.Errorf("Expected to key on clients and refuse, got key %d and action %d", rl.by, rl.action)
+	}
+	if rl.ipv4Prefix != defaultIPv4Prefix || rl.ipv6Prefix != defaultIPv6Prefix {
+		t.Errorf("Expected default prefix lengths, got %d and %d", rl.ipv4Prefix, rl.ipv6Prefix)
+	}
+	if rl.table.burst != 10 || rl.table.max != defaultMaxKeys {
+		t.Errorf("Expected burst 10 and %d keys, got %f and %d", defaultMaxKeys, rl.table.burst, rl.table.max)
+	}
+
+	c = caddy.NewTestController("dns", `ratelimit {
+		rate 0.1
+	}`)
+	if rl, err = parse(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if rl.table.burst != 1 {
+		t.Errorf("Expected burst of at least 1, got %f", rl.table.burst)
+	}
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/evict"
+)
+
+// bucket is a token bucket, it holds the number of queries a key can still send.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// table holds the buckets of all tracked keys. Every bucket is refilled with rate tokens per second, up
+// to burst tokens.
+type table struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	rate    float64
+	burst   float64
+	max     int
+}
+
+func newTable(rate, burst float64, max int) *table {
+	return &table{buckets: make(map[string]*bucket), rate: rate, burst: burst, max: max}
+}
+
+// take takes a token from the bucket of k. It returns false if the bucket is empty, the query must then
+// be limited.
+func (t *table) take(k string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b, ok := t.buckets[k]
+	if !ok {
+		if len(t.buckets) >= t.max {
+			t.evict(now)
+		}
+		b = &bucket{tokens: t.burst, last: now}
+		t.buckets[k] = b
+	}
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(t.burst, b.tokens+elapsed*t.rate)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// evict removes the buckets that are full again, these are the same as new ones. If that doesn't free
+// enough space, the least recently used half of the table is removed.
+func (t *table) evict(now time.Time) {
+	full := time.Duration(t.burst / t.rate * float64(time.Second))
+	evict.Table(t.buckets, func(b *bucket) time.Time { return b.last }, full, t.max, now)
+}
+
+// otherKey is the metric label of the keys that don't get their own label.
+const otherKey = "other"
+
+// labels bounds the cardinality of the key label of the metrics: the first max keys that are limited get
+// their own label, all others share otherKey.
+type labels struct {
+	mu   sync.Mutex
+	seen map[string]struct{}
+	max  int
+}
+
+func newLabels(max int) *labels {
+	return &labels{seen: make(map[string]struct{}), max: max}
+}
+
+// label returns the metric label for k.
+func (l *labels) label(k string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.seen[k]; ok {
+		return k
+	}
+	if len(l.seen) < l.max {
+		l.seen[k] = struct{}{}
+		return k
+	}
+	return otherKey
+}
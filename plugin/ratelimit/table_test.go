@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTableEvict(t *testing.T) {
+	tb := newTable(1, 2, 4)
+	now := time.Unix(1700000000, 0)
+
+	// Fill the table, emptying the bucket of a.
+	for _, k := range []string{"a", "a", "b", "c", "d"} {
+		tb.take(k, now)
+	}
+	if tb.take("a", now) {
+		t.Fatal("Expected bucket of a to be empty")
+	}
+
+	// After a second no bucket is full yet, so the oldest half is removed.
+	now = now.Add(time.Second)
+	tb.take("a", now)
+	tb.take("e", now)
+	if len(tb.buckets) != 2 {
+		t.Errorf("Expected 2 buckets after evicting the oldest half, got %d", len(tb.buckets))
+	}
+
+	// Buckets that are full again are removed first.
+	now = now.Add(3 * time.Second)
+	tb.take("f", now)
+	tb.take("g", now)
+	tb.take("h", now)
+	tb.take("i", now)
+	if _, ok := tb.buckets["a"]; ok {
+		t.Errorf("Expected full bucket of a to be removed")
+	}
+}
+
+func TestLabels(t *testing.T) {
+	l := newLabels(2)
+	for i, k := range []string{"a", "b", "a", "c", "b"} {
+		expected := k
+		if k == "c" {
+			expected = otherKey
+		}
+		if x := l.label(k); x != expected {
+			t.Errorf("Label %d: expected %s, got %s", i, expected, x)
+		}
+	}
+
+	l = newLabels(0)
+	if x := l.label("a"); x != otherKey {
+		t.Errorf("Expected %s with no keys, got %s", otherKey, x)
+	}
+}
+
+func BenchmarkTable(b *testing.B) {
+	tb := newTable(100, 100, 10000)
+	keys := make([]string, 50000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("10.%d.%d.0/24", i/256, i%256)
+	}
+	now := time.Unix(1700000000, 0)
+	b.ResetTimer()
+	for i := range b.N {
+		tb.take(keys[i%len(keys)], now.Add(time.Duration(i)*time.Microsecond))
+	}
+}
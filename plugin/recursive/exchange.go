@@ -0,0 +1,75 @@
+package recursive
+
+import (
+	"context"
+	"crypto/rand"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	udpSize    = 1232 // EDNS buffer size that avoids fragmentation, see https://www.dnsflagday.net/2020/
+	minTimeout = 200 * time.Millisecond
+	maxTimeout = 2 * time.Second
+)
+
+// exchange sends m to addr over UDP and retries over TCP if the reply is truncated.
+func exchange(ctx context.Context, m *dns.Msg, addr string, timeout time.Duration) (*dns.Msg, error) {
+	c := &dns.Client{Net: "udp", Timeout: timeout, UDPSize: udpSize}
+	r, _, err := c.ExchangeContext(ctx, m, addr)
+	if err != nil || !r.Truncated {
+		return r, err
+	}
+	c.Net = "tcp"
+	r, _, err = c.ExchangeContext(ctx, m, addr)
+	return r, err
+}
+
+// timeout returns the time to wait for a reply from a name server with the round trip time rtt.
+func timeout(rtt time.Duration) time.Duration {
+	return min(max(3*rtt, minTimeout), maxTimeout)
+}
+
+// randomiseCase returns name with the case of its letters randomised, as described in
+// draft-vixie-dnsext-dns0x20. Name servers echo the name in the question, an attacker that tries to
+// spoof a reply also has to guess the case. The case is the entropy that makes that hard, so every letter
+// gets a bit from crypto/rand.
+func randomiseCase(name string) string {
+	b := []byte(name)
+	letters := 0
+	for _, c := range b {
+		if isLetter(c) {
+			letters++
+		}
+	}
+	bits := make([]byte, (letters+7)/8)
+	rand.Read(bits)
+
+	n := 0
+	for i, c := range b {
+		if !isLetter(c) {
+			continue
+		}
+		if bits[n/8]&(1<<(n%8)) != 0 {
+			b[i] ^= 0x20
+		}
+		n++
+	}
+	return string(b)
+}
+
+func isLetter(c byte) bool { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+
+// echoed returns true if the question in m is for name and qtype. If exact is true the case of the name
+// must be the same too.
+func echoed(m *dns.Msg, name string, qtype uint16, exact bool) bool {
+	if len(m.Question) != 1 || m.Question[0].Qtype != qtype {
+		return false
+	}
+	if exact {
+		return m.Question[0].Name == name
+	}
+	return strings.EqualFold(m.Question[0].Name, name)
+}
@@ -0,0 +1,160 @@
+package recursive
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/cache"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	defaultInfraSize = 10000
+	maxInfraTTL      = 24 * time.Hour
+
+	unknownRTT = 376 * time.Millisecond // servers that were never queried compete with the ones that were
+	maxRTT     = 2 * time.Second
+)
+
+// delegation is a zone cut: the name servers of a zone.
+type delegation struct {
+	zone     string
+	servers  []string // addresses of name servers, from glue or hints
+	glueless []string // names of name servers without glue
+	expire   time.Time
+}
+
+// host holds the addresses of a name server that were looked up, as there was no glue for it.
+type host struct {
+	name   string
+	addrs  []string
+	expire time.Time
+}
+
+// server holds the smoothed round trip time to a name server, and whether it echoes the case of the name.
+type server struct {
+	addr   string
+	srtt   time.Duration
+	noCase bool // the server does not echo the case of the name, it is not randomised
+}
+
+// infra is the infrastructure cache, it holds delegations, addresses of name servers without glue, and
+// the round trip times to name servers.
+type infra struct {
+	delegations *cache.Cache[*delegation]
+	hosts       *cache.Cache[*host]
+	servers     *cache.Cache[server]
+
+	now func() time.Time
+}
+
+func newInfra(size int) *infra {
+	return &infra{
+		delegations: cache.New[*delegation](size),
+		hosts:       cache.New[*host](size),
+		servers:     cache.New[server](size),
+		now:         time.Now,
+	}
+}
+
+func key(name string) uint64 { return cache.Hash([]byte(strings.ToLower(name))) }
+
+// delegation returns the cached delegation of zone, or nil if there is none or it expired.
+func (i *infra) delegation(zone string) *delegation {
+	d, ok := i.delegations.Get(key(zone))
+	if !ok || !strings.EqualFold(d.zone, zone) || i.now().After(d.expire) {
+		return nil
+	}
+	return d
+}
+
+// closest returns the delegation of the zone closest to name, or nil if no delegation at or above name is
+// known. The root zone is never cached, its name servers are the root hints.
+func (i *infra) closest(name string) *delegation {
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if d := i.delegation(name[off:]); d != nil {
+			return d
+		}
+	}
+	return nil
+}
+
+// addDelegation caches d for ttl.
+func (i *infra) addDelegation(d *delegation, ttl uint32) {
+	d.expire = i.now().Add(min(time.Duration(ttl)*time.Second, maxInfraTTL))
+	i.delegations.Add(key(d.zone), d)
+}
+
+// host returns the cached addresses of the name server name.
+func (i *infra) host(name string) []string {
+	h, ok := i.hosts.Get(key(name))
+	if !ok || !strings.EqualFold(h.name, name) || i.now().After(h.expire) {
+		return nil
+	}
+	return h.addrs
+}
+
+// addHost caches the addresses of the name server name for ttl.
+func (i *infra) addHost(name string, addrs []string, ttl uint32) {
+	i.hosts.Add(key(name), &host{name: name, addrs: addrs, expire: i.now().Add(min(time.Duration(ttl)*time.Second, maxInfraTTL))})
+}
+
+// rtt returns the smoothed round trip time to addr.
+func (i *infra) rtt(addr string) time.Duration {
+	s, ok := i.servers.Get(key(addr))
+	if !ok || s.addr != addr {
+		return unknownRTT
+	}
+	return s.srtt
+}
+
+// update records the round trip time of a reply from addr.
+func (i *infra) update(addr string, rtt time.Duration) {
+	s, ok := i.servers.Get(key(addr))
+	if !ok || s.addr != addr {
+		i.servers.Add(key(addr), server{addr: addr, srtt: rtt})
+		return
+	}
+	s.srtt = (7*s.srtt + rtt) / 8
+	i.servers.Add(key(addr), s)
+}
+
+// timeout records that addr did not reply, this doubles its round trip time.
+func (i *infra) timeout(addr string) {
+	s, ok := i.servers.Get(key(addr))
+	if !ok || s.addr != addr {
+		s = server{addr: addr, srtt: unknownRTT}
+	}
+	s.srtt = min(2*s.srtt, maxRTT)
+	i.servers.Add(key(addr), s)
+}
+
+// caseRand returns false if addr does not echo the case of the name, see noCaseRand.
+func (i *infra) caseRand(addr string) bool {
+	s, ok := i.servers.Get(key(addr))
+	return !ok || s.addr != addr || !s.noCase
+}
+
+// noCaseRand records that addr does not echo the case of the name, it is no longer randomised for addr.
+func (i *infra) noCaseRand(addr string) {
+	s, ok := i.servers.Get(key(addr))
+	if !ok || s.addr != addr {
+		s = server{addr: addr, srtt: unknownRTT}
+	}
+	s.noCase = true
+	i.servers.Add(key(addr), s)
+}
+
+// sort orders addrs by their round trip time, fastest first.
+func (i *infra) sort(addrs []string) []string {
+	rtts := make(map[string]time.Duration, len(addrs))
+	for _, a := range addrs {
+		rtts[a] = i.rtt(a)
+	}
+	addrs = slices.Clone(addrs)
+	slices.SortStableFunc(addrs, func(a, b string) int { return cmp.Compare(rtts[a], rtts[b]) })
+	return addrs
+}
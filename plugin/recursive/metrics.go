@@ -0,0 +1,25 @@
+package recursive
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Variables declared for monitoring.
+var (
+	upstreamQueryCount = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "recursive",
+		Name:      "upstream_queries_total",
+		Help:      "Counter of the number of queries sent to authoritative name servers.",
+	})
+
+	upstreamErrorCount = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "recursive",
+		Name:      "upstream_errors_total",
+		Help:      "Counter of the number of queries to authoritative name servers that failed or timed out.",
+	})
+)
@@ -0,0 +1,84 @@
+// Package recursive implements a plugin that resolves queries iteratively, starting at the root
+// name servers.
+package recursive
+
+import (
+	"context"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+var log = clog.NewWithPlugin("recursive")
+
+const (
+	defaultTimeout  = 5 * time.Second // time to resolve a query
+	defaultMaxDepth = 5               // levels of nested lookups of name server addresses
+	maxQueries      = 64              // queries sent to resolve a single client query
+	maxCNAME        = 8               // CNAMEs followed
+)
+
+// Recursive is a plugin that resolves queries by following the delegations from the root zone down.
+type Recursive struct {
+	Next  plugin.Handler
+	Zones []string
+
+	roots    []string // addresses of the root name servers
+	port     string   // port of the name servers found in delegations
+	qmin     bool     // QNAME minimisation, RFC 9156
+	caseRand bool     // 0x20 case randomisation of the names sent
+	maxDepth int
+
+	infra *infra
+
+	// exchange sends m to addr and returns the reply, it is replaced in tests.
+	exchange func(ctx context.Context, m *dns.Msg, addr string, timeout time.Duration) (*dns.Msg, error)
+}
+
+// New returns a new Recursive that uses the root name servers in roots.
+func New(roots []string) *Recursive {
+	return &Recursive{
+		roots:    roots,
+		port:     "53",
+		qmin:     true,
+		caseRand: true,
+		maxDepth: defaultMaxDepth,
+		infra:    newInfra(defaultInfraSize),
+		exchange: exchange,
+	}
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (r *Recursive) ServeDNS(ctx context.Context, w dns.ResponseWriter, req *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: req}
+	if plugin.Zones(r.Zones).Matches(state.Name()) == "" || state.QClass() != dns.ClassINET {
+		return plugin.NextOrFailure(r.Name(), r.Next, ctx, w, req)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	l := &lookup{budget: maxQueries, do: state.Do()}
+	res, err := r.resolve(ctx, l, state.Name(), state.QType())
+	if err != nil {
+		return dns.RcodeServerFailure, err
+	}
+
+	m := new(dns.Msg)
+	m.SetRcode(req, res.Rcode)
+	m.RecursionAvailable = true
+	m.Answer = res.Answer
+	m.Ns = res.Ns
+
+	state.SizeAndDo(m)
+	m = state.Scrub(m)
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+}
+
+// Name implements the plugin.Handler interface.
+func (r *Recursive) Name() string { return "recursive" }
@@ -0,0 +1,342 @@
+package recursive
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+const rootZone = `$TTL 3600
+.                 IN SOA a.root.test. hostmaster.root.test. 1 7200 3600 1209600 3600
+.                 IN NS  a.root.test.
+a.root.test.      IN A   10.0.0.1
+com.              IN NS  ns1.nic.com.
+ns1.nic.com.      IN A   10.0.0.2
+`
+
+const comZone = `$TTL 3600
+com.              IN SOA ns1.nic.com. hostmaster.nic.com. 1 7200 3600 1209600 300
+com.              IN NS  ns1.nic.com.
+ns1.nic.com.      IN A   10.0.0.2
+example.com.      IN NS  ns1.example.com.
+ns1.example.com.  IN A   10.0.0.3
+glueless.com.     IN NS  ns.example.com.
+`
+
+const exampleZone = `$TTL 3600
+example.com.      IN SOA ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 300
+example.com.      IN NS  ns1.example.com.
+ns1.example.com.  IN A   10.0.0.3
+ns.example.com.   IN A   10.0.0.4
+www.example.com.  IN A   192.0.2.1
+a.b.example.com.  IN A   192.0.2.3
+alias.example.com. IN CNAME www.example.com.
+`
+
+const gluelessZone = `$TTL 3600
+glueless.com.     IN SOA ns.example.com. hostmaster.glueless.com. 1 7200 3600 1209600 300
+glueless.com.     IN NS  ns.example.com.
+www.glueless.com. IN A   192.0.2.2
+`
+
+// world is a set of authoritative name servers that answer from zone files, by address.
+type world struct {
+	servers map[string]plugin.Handler
+
+	mu      sync.Mutex
+	queries []*dns.Msg // all queries received
+}
+
+func newWorld(t *testing.T) *world {
+	t.Helper()
+	w := &world{servers: map[string]plugin.Handler{}}
+	for addr, z := range map[string][2]string{
+		"10.0.0.1:53": {".", rootZone},
+		"10.0.0.2:53": {"com.", comZone},
+		"10.0.0.3:53": {"example.com.", exampleZone},
+		"10.0.0.4:53": {"glueless.com.", gluelessZone},
+	} {
+		zone, err := file.Parse(strings.NewReader(z[1]), z[0], "stdin", 0)
+		if err != nil {
+			t.Fatalf("Failed to parse zone %s: %s", z[0], err)
+		}
+		w.servers[addr] = file.File{Next: test.ErrorHandler(), Zones: file.Zones{Z: map[string]*file.Zone{z[0]: zone}, Names: []string{z[0]}}}
+	}
+	// The file plugin looks up the targets of CNAMEs to other zones through the server, which does
+	// not exist here, reply with just the CNAME instead.
+	example := w.servers["10.0.0.3:53"]
+	w.servers["10.0.0.3:53"] = plugin.HandlerFunc(func(ctx context.Context, rw dns.ResponseWriter, r *dns.Msg) (int, error) {
+		if !strings.EqualFold(r.Question[0].Name, "ext.example.com.") {
+			return example.ServeDNS(ctx, rw, r)
+		}
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Authoritative = true
+		m.Answer = []dns.RR{test.CNAME("ext.example.com. 3600 IN CNAME www.glueless.com.")}
+		rw.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+	return w
+}
+
+func (w *world) exchange(ctx context.Context, m *dns.Msg, addr string, _ time.Duration) (*dns.Msg, error) {
+	w.mu.Lock()
+	w.queries = append(w.queries, m.Copy())
+	w.mu.Unlock()
+
+	f, ok := w.servers[addr]
+	if !ok {
+		return nil, context.DeadlineExceeded
+	}
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	f.ServeDNS(ctx, rec, m)
+	return rec.Msg, nil
+}
+
+func (w *world) names() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var names []string
+	for _, q := range w.queries {
+		names = append(names, q.Question[0].Name+" "+dns.TypeToString[q.Question[0].Qtype])
+	}
+	return names
+}
+
+func newTestRecursive(w *world) *Recursive {
+	r := New([]string{"10.0.0.1:53"})
+	r.Zones = []string{"."}
+	r.exchange = w.exchange
+	return r
+}
+
+func TestRecursive(t *testing.T) {
+	tests := []struct {
+		qname  string
+		qtype  uint16
+		rcode  int
+		answer []dns.RR
+		ns     []dns.RR
+	}{
+		{
+			qname:  "www.example.com.",
+			qtype:  dns.TypeA,
+			answer: []dns.RR{test.A("www.example.com. 3600 IN A 192.0.2.1")},
+		},
+		{
+			qname:  "a.b.example.com.",
+			qtype:  dns.TypeA,
+			answer: []dns.RR{test.A("a.b.example.com. 3600 IN A 192.0.2.3")},
+		},
+		{
+			qname: "alias.example.com.",
+			qtype: dns.TypeA,
+			answer: []dns.RR{
+				test.CNAME("alias.example.com. 3600 IN CNAME www.example.com."),
+				test.A("www.example.com. 3600 IN A 192.0.2.1"),
+			},
+		},
+		{
+			// CNAME into another zone, which has a glueless delegation.
+			qname: "ext.example.com.",
+			qtype: dns.TypeA,
+			answer: []dns.RR{
+				test.CNAME("ext.example.com. 3600 IN CNAME www.glueless.com."),
+				test.A("www.glueless.com. 3600 IN A 192.0.2.2"),
+			},
+		},
+		{
+			qname: "nope.example.com.",
+			qtype: dns.TypeA,
+			rcode: dns.RcodeNameError,
+			ns:    []dns.RR{test.SOA("example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 300")},
+		},
+		{
+			qname: "www.example.com.",
+			qtype: dns.TypeAAAA,
+			ns:    []dns.RR{test.SOA("example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 300")},
+		},
+	}
+
+	for _, tc := range tests {
+		r := newTestRecursive(newWorld(t))
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := r.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Errorf("Expected no error for %s, got %s", tc.qname, err)
+			continue
+		}
+		if !rec.Msg.RecursionAvailable {
+			t.Errorf("Expected RA bit for %s", tc.qname)
+		}
+		if err := test.SortAndCheck(rec.Msg, test.Case{Qname: tc.qname, Qtype: tc.qtype, Rcode: tc.rcode, Answer: tc.answer, Ns: tc.ns}); err != nil {
+			t.Errorf("Query %s: %s", tc.qname, err)
+		}
+	}
+}
+
+func TestQnameMinimisation(t *testing.T) {
+	w := newWorld(t)
+	r := newTestRecursive(w)
+	r.caseRand = false
+	if _, err := r.resolve(context.TODO(), &lookup{budget: maxQueries}, "a.b.example.com.", dns.TypeA); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	expected := []string{"com. A", "example.com. A", "b.example.com. A", "a.b.example.com. A"}
+	if got := w.names(); strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected queries %v, got %v", expected, got)
+	}
+
+	w = newWorld(t)
+	r = newTestRecursive(w)
+	r.caseRand, r.qmin = false, false
+	if _, err := r.resolve(context.TODO(), &lookup{budget: maxQueries}, "a.b.example.com.", dns.TypeA); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	expected = []string{"a.b.example.com. A", "a.b.example.com. A", "a.b.example.com. A"}
+	if got := w.names(); strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected queries %v, got %v", expected, got)
+	}
+}
+
+func TestInfraCache(t *testing.T) {
+	w := newWorld(t)
+	r := newTestRecursive(w)
+	if _, err := r.resolve(context.TODO(), &lookup{budget: maxQueries}, "www.example.com.", dns.TypeA); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	d := r.infra.closest("foo.example.com.")
+	if d == nil || d.zone != "example.com." {
+		t.Fatalf("Expected delegation for example.com. to be cached, got %v", d)
+	}
+	if r.infra.rtt("10.0.0.3:53") == unknownRTT {
+		t.Errorf("Expected the RTT of 10.0.0.3:53 to be known")
+	}
+
+	// The second query goes straight to the name servers of example.com.
+	n := len(w.names())
+	if _, err := r.resolve(context.TODO(), &lookup{budget: maxQueries}, "alias.example.com.", dns.TypeA); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if got := len(w.names()) - n; got != 1 {
+		t.Errorf("Expected 1 query for a name in a cached zone, got %d", got)
+	}
+
+	// Glueless name server addresses are cached too.
+	if _, err := r.resolve(context.TODO(), &lookup{budget: maxQueries}, "www.glueless.com.", dns.TypeA); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if addrs := r.infra.host("ns.example.com."); len(addrs) != 1 || addrs[0] != "10.0.0.4:53" {
+		t.Errorf("Expected address of ns.example.com. to be cached, got %v", addrs)
+	}
+}
+
+func TestCaseRandomisation(t *testing.T) {
+	w := newWorld(t)
+	r := newTestRecursive(w)
+	// Servers that lower case the name are asked again without randomising the case, and this is
+	// remembered.
+	var (
+		mixed = map[string]bool{} // servers that were sent a name with upper case letters
+		sent  []string            // the names sent to the servers in mixed
+	)
+	r.exchange = func(ctx context.Context, m *dns.Msg, addr string, timeout time.Duration) (*dns.Msg, error) {
+		name := m.Question[0].Name
+		if mixed[addr] {
+			sent = append(sent, name)
+		}
+		if name != strings.ToLower(name) {
+			mixed[addr] = true
+		}
+		ret, err := w.exchange(ctx, m, addr, timeout)
+		if ret != nil {
+			ret.Question[0].Name = strings.ToLower(ret.Question[0].Name)
+		}
+		return ret, err
+	}
+	if _, err := r.resolve(context.TODO(), &lookup{budget: maxQueries}, "www.example.com.", dns.TypeA); err != nil {
+		t.Fatalf("Expected no error for servers that lower case the name, got %s", err)
+	}
+	if len(mixed) == 0 {
+		t.Fatal("Expected names with upper case letters to be sent")
+	}
+	for addr := range mixed {
+		if r.infra.caseRand(addr) {
+			t.Errorf("Expected the case of names not to be randomised for %s", addr)
+		}
+	}
+	if _, err := r.resolve(context.TODO(), &lookup{budget: maxQueries}, "www2.example.com.", dns.TypeA); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range sent {
+		if name != strings.ToLower(name) {
+			t.Errorf("Expected query for %q not to be randomised", name)
+		}
+	}
+
+	// A reply for another name is not trusted.
+	r = newTestRecursive(w)
+	r.exchange = func(ctx context.Context, m *dns.Msg, addr string, timeout time.Duration) (*dns.Msg, error) {
+		ret, err := w.exchange(ctx, m, addr, timeout)
+		if ret != nil {
+			ret.Question[0].Name = "spoofed.example.net."
+		}
+		return ret, err
+	}
+	if _, err := r.resolve(context.TODO(), &lookup{budget: maxQueries}, "www.example.com.", dns.TypeA); err == nil {
+		t.Fatal("Expected error for replies that do not echo the name")
+	}
+
+	for range 10 {
+		if s := randomiseCase("www.example.com."); !strings.EqualFold(s, "www.example.com.") {
+			t.Fatalf("Expected randomised name to equal www.example.com., got %s", s)
+		}
+	}
+
+	// Every letter of a long name is randomised.
+	name := strings.Repeat("abcdefghij.", 10)
+	upper := make([]bool, len(name))
+	for range 64 {
+		for i, c := range randomiseCase(name) {
+			if c >= 'A' && c <= 'Z' {
+				upper[i] = true
+			}
+		}
+	}
+	for i, u := range upper {
+		if name[i] != '.' && !u {
+			t.Errorf("Expected letter %d of %s to be upper case at least once", i, name)
+		}
+	}
+}
+
+func TestBudget(t *testing.T) {
+	r := newTestRecursive(newWorld(t))
+	if _, err := r.resolve(context.TODO(), &lookup{budget: 2}, "www.example.com.", dns.TypeA); err != errBudget {
+		t.Errorf("Expected %q, got %v", errBudget, err)
+	}
+}
+
+func TestChase(t *testing.T) {
+	answer := []dns.RR{
+		test.CNAME("a.example.org. 300 IN CNAME b.example.org."),
+		test.CNAME("b.example.org. 300 IN CNAME c.example.net."),
+	}
+	if got := chase(answer, "a.example.org.", dns.TypeA); got != "c.example.net." {
+		t.Errorf("Expected c.example.net., got %q", got)
+	}
+	answer = append(answer, test.A("c.example.net. 300 IN A 192.0.2.1"))
+	if got := chase(answer, "a.example.org.", dns.TypeA); got != "" {
+		t.Errorf("Expected nothing to chase, got %q", got)
+	}
+}
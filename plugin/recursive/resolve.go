@@ -0,0 +1,399 @@
+package recursive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+var (
+	errBudget    = errors.New("too many queries needed to resolve")
+	errDepth     = errors.New("name server lookups nested too deep")
+	errCNAME     = errors.New("too many CNAMEs")
+	errNoServers = errors.New("no name server addresses")
+	errLame      = errors.New("no usable reply from any name server")
+	errCase      = errors.New("reply does not match the case of the query")
+)
+
+// lookup holds the state of the resolution of a single client query.
+type lookup struct {
+	budget int  // number of queries that may still be sent
+	depth  int  // nesting of name server address lookups
+	do     bool // set the DO bit, the client wants DNSSEC records
+}
+
+// resolve resolves name and qtype and follows the CNAMEs in the answers. The returned message has the
+// answer and authority sections of the final reply, with the CNAMEs followed prepended to the answer.
+func (r *Recursive) resolve(ctx context.Context, l *lookup, name string, qtype uint16) (*dns.Msg, error) {
+	var answer []dns.RR
+	for range maxCNAME + 1 {
+		m, err := r.iterate(ctx, l, name, qtype)
+		if err != nil {
+			return nil, err
+		}
+		answer = append(answer, m.Answer...)
+		m.Answer = answer
+		if m.Rcode != dns.RcodeSuccess || qtype == dns.TypeCNAME {
+			return m, nil
+		}
+		target := chase(answer, name, qtype)
+		if target == "" {
+			return m, nil
+		}
+		name = target
+	}
+	return nil, errCNAME
+}
+
+// chase follows the CNAMEs for name in answer and returns the target that still needs to be resolved, or
+// "" if answer has the records of qtype for name, or no CNAME for it.
+func chase(answer []dns.RR, name string, qtype uint16) string {
+	cname := false
+	for range maxCNAME + 1 {
+		next := ""
+		for _, rr := range answer {
+			if !strings.EqualFold(rr.Header().Name, name) {
+				continue
+			}
+			if rr.Header().Rrtype == qtype {
+				return ""
+			}
+			if c, ok := rr.(*dns.CNAME); ok {
+				next = c.Target
+			}
+		}
+		if next == "" {
+			break
+		}
+		name, cname = next, true
+	}
+	if !cname {
+		return ""
+	}
+	return name
+}
+
+// iterate resolves name and qtype by following the delegations from the closest known zone cut down,
+// and returns the final reply.
+func (r *Recursive) iterate(ctx context.Context, l *lookup, name string, qtype uint16) (*dns.Msg, error) {
+	// The DS records of a zone are served by its parent.
+	cut := name
+	if qtype == dns.TypeDS && name != "." {
+		parent, _ := dns.NextLabel(name, 0)
+		cut = name[parent:]
+	}
+	d := r.infra.closest(cut)
+	if d == nil {
+		d = r.hints()
+	}
+
+	at := d.zone // the name below which QNAME minimisation asks for the next label
+	full := !r.qmin
+	for {
+		qname, qt := name, qtype
+		minimised := false
+		if !full {
+			// Never minimise the name itself, for DS this stops at the parent.
+			if n := dns.CountLabel(at); n+1 < dns.CountLabel(name) {
+				qname, qt, minimised = suffix(name, n+1), dns.TypeA, true
+			}
+		}
+
+		m, err := r.query(ctx, l, d, qname, qt)
+		if err != nil {
+			return nil, err
+		}
+
+		if nd := r.referral(d, m, qname); nd != nil {
+			d, at = nd, nd.zone
+			continue
+		}
+		if !minimised {
+			return clean(m, d.zone), nil
+		}
+
+		switch {
+		case m.Rcode == dns.RcodeSuccess && !hasType(m.Answer, dns.TypeCNAME) && !hasType(m.Answer, dns.TypeDNAME):
+			// qname exists and is not a zone cut, go down one more label.
+			at = qname
+		default:
+			// NXDOMAIN or an alias for one of the names above the one asked for. Not all servers get
+			// NXDOMAIN for empty non-terminals right, so ask for the full name instead, see RFC 9156,
+			// section 2.3.
+			full = true
+		}
+	}
+}
+
+// referral returns the delegation in m, a reply from the name servers of d to a query for qname, or nil if
+// m is not a referral to a zone below the zone of d.
+func (r *Recursive) referral(d *delegation, m *dns.Msg, qname string) *delegation {
+	if m.Rcode != dns.RcodeSuccess || len(m.Answer) > 0 || m.Authoritative {
+		return nil
+	}
+	var (
+		zone string
+		ns   []string
+		ttl  uint32
+	)
+	for _, rr := range m.Ns {
+		n, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+		owner := n.Hdr.Name
+		// Only accept delegations to zones below the zone of d that contain qname.
+		if dns.CountLabel(owner) <= dns.CountLabel(d.zone) || !dns.IsSubDomain(d.zone, owner) || !dns.IsSubDomain(owner, qname) {
+			continue
+		}
+		if zone != "" && !strings.EqualFold(zone, owner) {
+			continue
+		}
+		if zone == "" || n.Hdr.Ttl < ttl {
+			ttl = n.Hdr.Ttl
+		}
+		zone = owner
+		ns = append(ns, n.Ns)
+	}
+	if zone == "" {
+		return nil
+	}
+
+	nd := &delegation{zone: strings.ToLower(zone)}
+	for _, name := range ns {
+		var addrs []string
+		for _, rr := range m.Extra {
+			// Glue is only accepted from the zone of d.
+			if !strings.EqualFold(rr.Header().Name, name) || !dns.IsSubDomain(d.zone, name) {
+				continue
+			}
+			switch a := rr.(type) {
+			case *dns.A:
+				addrs = append(addrs, net.JoinHostPort(a.A.String(), r.port))
+			case *dns.AAAA:
+				addrs = append(addrs, net.JoinHostPort(a.AAAA.String(), r.port))
+			}
+		}
+		if len(addrs) == 0 {
+			nd.glueless = append(nd.glueless, name)
+			continue
+		}
+		nd.servers = append(nd.servers, addrs...)
+	}
+	r.infra.addDelegation(nd, ttl)
+	return nd
+}
+
+// query sends a query for qname and qtype to the name servers of d, the fastest first, until one of them
+// gives a usable reply.
+func (r *Recursive) query(ctx context.Context, l *lookup, d *delegation, qname string, qtype uint16) (*dns.Msg, error) {
+	addrs := r.addrs(ctx, l, d)
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("%w for %q", errNoServers, d.zone)
+	}
+
+	lastErr := errLame
+	for _, addr := range r.infra.sort(addrs) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if l.budget--; l.budget < 0 {
+			return nil, errBudget
+		}
+
+		caseRand := r.caseRand && r.infra.caseRand(addr)
+		reply, sent, err := r.send(ctx, l, addr, qname, qtype, caseRand)
+		if err == nil && caseRand && !echoed(reply, sent, qtype, true) && echoed(reply, sent, qtype, false) {
+			// Many name servers don't echo the case of the name. Like Unbound, ask the server again without
+			// randomising the case, and remember not to randomise it for this server.
+			log.Debugf("Name server %s does not echo the case of %q, not randomising it", addr, sent)
+			r.infra.noCaseRand(addr)
+			if l.budget--; l.budget < 0 {
+				return nil, errBudget
+			}
+			caseRand = false
+			reply, sent, err = r.send(ctx, l, addr, qname, qtype, false)
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !echoed(reply, sent, qtype, caseRand) {
+			// With 0x20 the name must be echoed exactly, anything else may be a spoofed reply.
+			lastErr = errCase
+			continue
+		}
+		reply.Question[0].Name = qname
+		switch reply.Rcode {
+		case dns.RcodeSuccess, dns.RcodeNameError:
+		default:
+			lastErr = fmt.Errorf("%w: %s from %s", errLame, dns.RcodeToString[reply.Rcode], addr)
+			continue
+		}
+		if lame(d, reply) {
+			lastErr = fmt.Errorf("%w: lame reply from %s", errLame, addr)
+			continue
+		}
+		return reply, nil
+	}
+	return nil, lastErr
+}
+
+// send sends a query for qname and qtype to addr, with the case of qname randomised if caseRand is true.
+// It returns the reply and the name as it was sent.
+func (r *Recursive) send(ctx context.Context, l *lookup, addr, qname string, qtype uint16, caseRand bool) (*dns.Msg, string, error) {
+	m := new(dns.Msg)
+	sent := qname
+	if caseRand {
+		sent = randomiseCase(qname)
+	}
+	m.SetQuestion(sent, qtype)
+	m.RecursionDesired = false
+	m.SetEdns0(udpSize, l.do)
+
+	start := r.infra.now()
+	reply, err := r.exchange(ctx, m, addr, timeout(r.infra.rtt(addr)))
+	upstreamQueryCount.Inc()
+	if err != nil {
+		if ctx.Err() == nil {
+			r.infra.timeout(addr)
+		}
+		upstreamErrorCount.Inc()
+		return nil, sent, err
+	}
+	r.infra.update(addr, r.infra.now().Sub(start))
+	return reply, sent, nil
+}
+
+// lame returns true if m is an upward or sideways referral: a non-authoritative reply without an answer,
+// that delegates to a zone that is not below the zone of d.
+func lame(d *delegation, m *dns.Msg) bool {
+	if m.Authoritative || len(m.Answer) > 0 || m.Rcode != dns.RcodeSuccess {
+		return false
+	}
+	for _, rr := range m.Ns {
+		switch rr.Header().Rrtype {
+		case dns.TypeSOA:
+			return false
+		case dns.TypeNS:
+			if dns.CountLabel(rr.Header().Name) <= dns.CountLabel(d.zone) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// addrs returns the addresses of the name servers of d. If d has no glue, the addresses of its name
+// servers are looked up.
+func (r *Recursive) addrs(ctx context.Context, l *lookup, d *delegation) []string {
+	addrs := d.servers
+	for _, name := range d.glueless {
+		addrs = append(addrs, r.infra.host(name)...)
+	}
+	if len(addrs) > 0 {
+		return addrs
+	}
+	if l.depth >= r.maxDepth {
+		log.Debugf("Not looking up name servers of %q: %s", d.zone, errDepth)
+		return nil
+	}
+
+	l.depth++
+	defer func() { l.depth-- }()
+	for _, name := range d.glueless {
+		found, ttl := r.lookupHost(ctx, l, name)
+		if len(found) == 0 {
+			continue
+		}
+		r.infra.addHost(name, found, ttl)
+		return found
+	}
+	return nil
+}
+
+// lookupHost resolves the addresses of the name server name. It returns the addresses and their TTL.
+func (r *Recursive) lookupHost(ctx context.Context, l *lookup, name string) ([]string, uint32) {
+	var (
+		addrs []string
+		ttl   uint32
+	)
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		m, err := r.resolve(ctx, l, name, qtype)
+		if err != nil {
+			log.Debugf("Failed to look up name server %q: %s", name, err)
+			continue
+		}
+		for _, rr := range m.Answer {
+			var ip net.IP
+			switch a := rr.(type) {
+			case *dns.A:
+				ip = a.A
+			case *dns.AAAA:
+				ip = a.AAAA
+			default:
+				continue
+			}
+			if len(addrs) == 0 || rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+			}
+			addrs = append(addrs, net.JoinHostPort(ip.String(), r.port))
+		}
+		if len(addrs) > 0 {
+			break
+		}
+	}
+	return addrs, ttl
+}
+
+// hints returns the delegation of the root zone to the root name servers.
+func (r *Recursive) hints() *delegation {
+	return &delegation{zone: ".", servers: r.roots}
+}
+
+// clean returns the final reply m from the name servers of zone with only the records the client needs:
+// the records in the answer section that zone is authoritative for, and the SOA record in the authority
+// section of negative replies, so they can be cached.
+func clean(m *dns.Msg, zone string) *dns.Msg {
+	res := &dns.Msg{MsgHdr: dns.MsgHdr{Rcode: m.Rcode}}
+	for _, rr := range m.Answer {
+		if dns.IsSubDomain(zone, rr.Header().Name) {
+			res.Answer = append(res.Answer, rr)
+		}
+	}
+	if len(res.Answer) > 0 && m.Rcode == dns.RcodeSuccess {
+		return res
+	}
+	for _, rr := range m.Ns {
+		if !dns.IsSubDomain(zone, rr.Header().Name) {
+			continue
+		}
+		switch rr.Header().Rrtype {
+		case dns.TypeSOA, dns.TypeNSEC, dns.TypeNSEC3, dns.TypeRRSIG:
+			res.Ns = append(res.Ns, rr)
+		}
+	}
+	return res
+}
+
+// suffix returns the last n labels of name.
+func suffix(name string, n int) string {
+	idx := dns.Split(name)
+	if n >= len(idx) {
+		return name
+	}
+	return name[idx[len(idx)-n]:]
+}
+
+func hasType(rrs []dns.RR, qtype uint16) bool {
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == qtype {
+			return true
+		}
+	}
+	return false
+}
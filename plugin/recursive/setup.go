@@ -0,0 +1,104 @@
+package recursive
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+)
+
+func init() { plugin.Register("recursive", setup) }
+
+func setup(c *caddy.Controller) error {
+	r, err := parse(c)
+	if err != nil {
+		return plugin.Error("recursive", err)
+	}
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		r.Next = next
+		return r
+	})
+
+	return nil
+}
+
+func parse(c *caddy.Controller) (*Recursive, error) {
+	var roots []string
+	for _, h := range rootHints {
+		roots = append(roots, net.JoinHostPort(h, "53"))
+	}
+	r := New(roots)
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		r.Zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "roots":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				r.roots = nil
+				for _, a := range args {
+					addr, err := hostPort(a)
+					if err != nil {
+						return nil, c.Errf("invalid root name server address %q", a)
+					}
+					r.roots = append(r.roots, addr)
+				}
+			case "port":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				if _, err := strconv.ParseUint(c.Val(), 10, 16); err != nil {
+					return nil, c.Errf("invalid port %q", c.Val())
+				}
+				r.port = c.Val()
+			case "max_depth":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				n, err := strconv.Atoi(c.Val())
+				if err != nil || n < 0 {
+					return nil, c.Errf("invalid max_depth %q", c.Val())
+				}
+				r.maxDepth = n
+			case "no_qname_minimisation":
+				r.qmin = false
+			case "no_0x20":
+				r.caseRand = false
+			default:
+				return nil, c.Errf("unknown property '%s'", c.Val())
+			}
+			if c.NextArg() {
+				return nil, c.ArgErr()
+			}
+		}
+	}
+	return r, nil
+}
+
+// hostPort returns the address a, an IP address with an optional port, with port 53 added if it has none.
+func hostPort(a string) (string, error) {
+	host, port, err := net.SplitHostPort(a)
+	if err != nil {
+		host, port = a, "53"
+	}
+	if net.ParseIP(host) == nil {
+		return "", net.InvalidAddrError(a)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, port), nil
+}
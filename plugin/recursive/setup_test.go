@@ -0,0 +1,79 @@
+package recursive
+
+import (
+	"testing"
+
+	"github.com/coredns/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		roots     []string
+		port      string
+		qmin      bool
+		caseRand  bool
+		depth     int
+	}{
+		{`recursive`, false, nil, "53", true, true, defaultMaxDepth},
+		{`recursive {
+			roots 127.0.0.1:1053 ::1
+			port 1053
+		}`, false, []string{"127.0.0.1:1053", "[::1]:53"}, "1053", true, true, defaultMaxDepth},
+		{`recursive example.org {
+			no_qname_minimisation
+			no_0x20
+			max_depth 2
+		}`, false, nil, "53", false, false, 2},
+		{`recursive {
+			roots example.org
+		}`, true, nil, "", false, false, 0},
+		{`recursive {
+			roots
+		}`, true, nil, "", false, false, 0},
+		{`recursive {
+			port 100000
+		}`, true, nil, "", false, false, 0},
+		{`recursive {
+			max_depth -1
+		}`, true, nil, "", false, false, 0},
+		{`recursive {
+			no_0x20 yes
+		}`, true, nil, "", false, false, 0},
+		{`recursive {
+			blah
+		}`, true, nil, "", false, false, 0},
+		{"recursive\nrecursive", true, nil, "", false, false, 0},
+	}
+
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		r, err := parse(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		if tc.roots == nil && len(r.roots) != len(rootHints) {
+			t.Errorf("Test %d: expected %d root hints, got %d", i, len(rootHints), len(r.roots))
+		}
+		if tc.roots != nil && (len(r.roots) != len(tc.roots) || r.roots[0] != tc.roots[0] || r.roots[1] != tc.roots[1]) {
+			t.Errorf("Test %d: expected roots %v, got %v", i, tc.roots, r.roots)
+		}
+		if r.port != tc.port {
+			t.Errorf("Test %d: expected port %s, got %s", i, tc.port, r.port)
+		}
+		if r.qmin != tc.qmin || r.caseRand != tc.caseRand {
+			t.Errorf("Test %d: expected qmin %t and 0x20 %t, got %t and %t", i, tc.qmin, tc.caseRand, r.qmin, r.caseRand)
+		}
+		if r.maxDepth != tc.depth {
+			t.Errorf("Test %d: expected max_depth %d, got %d", i, tc.depth, r.maxDepth)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package rpz
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Variables declared for monitoring.
+var (
+	hitCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "rpz",
+		Name:      "hits_total",
+		Help:      "Counter of queries that matched a policy rule.",
+	}, []string{"server", "policy", "trigger", "action"})
+
+	policyRules = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "rpz",
+		Name:      "rules",
+		Help:      "Number of rules in a policy zone.",
+	}, []string{"policy"})
+)
@@ -0,0 +1,131 @@
+package rpz
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/transfer"
+
+	"github.com/miekg/dns"
+)
+
+// policy is a policy zone, read from a file or transferred from a primary.
+type policy struct {
+	origin string
+
+	path  string     // file the policy zone is read from, or
+	zone  *file.Zone // zone the policy zone is transferred into
+	mtime time.Time
+	size  int64
+
+	sync.RWMutex
+	r *rules
+}
+
+func newFilePolicy(origin, path string) *policy {
+	return &policy{origin: origin, path: path}
+}
+
+func newSecondaryPolicy(origin string, from []string) *policy {
+	z := file.NewZone(origin, "stdin")
+	z.TransferFrom = from
+	return &policy{origin: origin, zone: z}
+}
+
+// rules returns the rules of the policy zone, or nil if it isn't loaded yet.
+func (p *policy) rules() *rules {
+	p.RLock()
+	defer p.RUnlock()
+	return p.r
+}
+
+func (p *policy) set(r *rules) {
+	p.Lock()
+	p.r = r
+	p.Unlock()
+	policyRules.WithLabelValues(p.origin).Set(float64(r.count))
+}
+
+// load reads the policy zone from its file, if it changed since it was last read.
+func (p *policy) load() error {
+	f, err := os.Open(p.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if p.mtime.Equal(stat.ModTime()) && p.size == stat.Size() {
+		return nil
+	}
+
+	zp := dns.NewZoneParser(f, p.origin, p.path)
+	rrs := []dns.RR{}
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		rrs = append(rrs, rr)
+	}
+	if err := zp.Err(); err != nil {
+		return err
+	}
+	r, err := newRules(p.origin, rrs)
+	if err != nil {
+		return err
+	}
+	p.set(r)
+	p.mtime, p.size = stat.ModTime(), stat.Size()
+	log.Infof("Loaded policy zone %s with %d rules from %s", p.origin, r.count, p.path)
+	return nil
+}
+
+// reload reads the policy zone from its file every interval, until stop is closed.
+func (p *policy) reload(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := p.load(); err != nil {
+				log.Errorf("Failed to reload policy zone %s from %s: %s", p.origin, p.path, err)
+			}
+		}
+	}
+}
+
+// transferIn transfers the policy zone into z and makes the rules from it.
+func (p *policy) transferIn(z *file.Zone, t *transfer.Transfer) error {
+	return z.TransferInWithRecords(t, func(rrs []dns.RR) error {
+		r, err := newRules(p.origin, rrs)
+		if err != nil {
+			return err
+		}
+		p.set(r)
+		log.Infof("Transferred policy zone %s with %d rules", p.origin, r.count)
+		return nil
+	})
+}
+
+// update transfers the policy zone and keeps it up to date, until stop is closed.
+func (p *policy) update(stop chan bool) {
+	dur := 250 * time.Millisecond
+	for {
+		err := p.transferIn(p.zone, nil)
+		if err == nil {
+			break
+		}
+		log.Warningf("All '%s' primaries failed to transfer, retrying in %s: %s", p.origin, dur, err)
+		select {
+		case <-stop:
+			return
+		case <-time.After(dur):
+		}
+		dur = min(2*dur, 10*time.Second)
+	}
+	p.zone.UpdateWithTransfer(stop, nil, p.transferIn)
+}
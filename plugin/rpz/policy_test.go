@@ -0,0 +1,46 @@
+package rpz
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPolicyLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.rpz")
+	if err := os.WriteFile(path, []byte(policyZone), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newFilePolicy("rpz.local.", path)
+	if err := p.load(); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if r := p.rules(); r == nil || r.count != 14 {
+		t.Fatalf("Expected 14 rules, got %v", r)
+	}
+
+	// A broken file keeps the rules that were loaded.
+	if err := os.WriteFile(path, []byte("$TTL 300\nbad.example CNAME .\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Minute))
+	if err := p.load(); err == nil {
+		t.Error("Expected error for policy zone without SOA, got none")
+	}
+	if r := p.rules(); r == nil || r.count != 14 {
+		t.Errorf("Expected 14 rules, got %v", r)
+	}
+
+	if err := os.WriteFile(path, []byte("$TTL 300\n@ SOA localhost. hostmaster.localhost. 2 3600 600 86400 60\nbad.example CNAME .\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(path, time.Now(), time.Now().Add(2*time.Minute))
+	if err := p.load(); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if r := p.rules(); r == nil || r.count != 1 {
+		t.Errorf("Expected 1 rule, got %v", r)
+	}
+}
@@ -0,0 +1,114 @@
+// Package rpz implements response policy zones.
+package rpz
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/metrics"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/nonwriter"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+var log = clog.NewWithPlugin("rpz")
+
+// RPZ applies the rules of response policy zones to queries and their replies.
+type RPZ struct {
+	Next  plugin.Handler
+	Zones []string
+
+	policies []*policy // in order of precedence
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (p *RPZ) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+	if plugin.Zones(p.Zones).Matches(state.Name()) == "" {
+		return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+	}
+
+	client := clientIP(state)
+	var (
+		nw    *nonwriter.Writer // the reply of the next plugins, when a policy has rules for replies
+		rcode int
+		err   error
+	)
+	for _, pol := range p.policies {
+		rs := pol.rules()
+		if rs == nil {
+			continue
+		}
+		h := rs.query(client, state.Name())
+		if h == nil && rs.response() {
+			if nw == nil {
+				nw = nonwriter.New(w)
+				rcode, err = plugin.NextOrFailure(p.Name(), p.Next, ctx, nw, r)
+			}
+			if nw.Msg != nil {
+				h = rs.reply(nw.Msg)
+			}
+		}
+		if h == nil {
+			continue
+		}
+		h.policy = pol.origin
+		return p.apply(ctx, state, h, nw, rcode, err)
+	}
+	return p.pass(ctx, state, nw, rcode, err)
+}
+
+// apply carries out the action of the rule in h.
+func (p *RPZ) apply(ctx context.Context, state request.Request, h *hit, nw *nonwriter.Writer, rcode int, err error) (int, error) {
+	hitCount.WithLabelValues(metrics.WithServer(ctx), h.policy, h.trigger.String(), h.rule.action.String()).Inc()
+	metadata.SetValueFunc(ctx, "rpz/policy", func() string { return h.policy })
+	metadata.SetValueFunc(ctx, "rpz/trigger", func() string { return h.trigger.String() })
+	metadata.SetValueFunc(ctx, "rpz/rule", func() string { return h.rule.owner })
+	metadata.SetValueFunc(ctx, "rpz/action", func() string { return h.rule.action.String() })
+
+	switch h.rule.action {
+	case actionPassthru:
+		return p.pass(ctx, state, nw, rcode, err)
+	case actionDrop:
+		return dns.RcodeSuccess, nil
+	case actionTCPOnly:
+		if state.Proto() == "tcp" {
+			return p.pass(ctx, state, nw, rcode, err)
+		}
+		m := new(dns.Msg)
+		m.SetReply(state.Req)
+		m.Truncated = true
+		state.W.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	}
+	state.W.WriteMsg(h.answer(state.Req))
+	return dns.RcodeSuccess, nil
+}
+
+// pass answers the query as if there were no policy: with the reply in nw if the next plugins were asked
+// already, or by asking them.
+func (p *RPZ) pass(ctx context.Context, state request.Request, nw *nonwriter.Writer, rcode int, err error) (int, error) {
+	if nw == nil {
+		return plugin.NextOrFailure(p.Name(), p.Next, ctx, state.W, state.Req)
+	}
+	if nw.Msg != nil {
+		state.W.WriteMsg(nw.Msg)
+	}
+	return rcode, err
+}
+
+// Name implements the plugin.Handler interface.
+func (p *RPZ) Name() string { return "rpz" }
+
+func clientIP(state request.Request) net.IP {
+	ip := state.IP()
+	if idx := strings.IndexByte(ip, '%'); idx >= 0 {
+		ip = ip[:idx]
+	}
+	return net.ParseIP(ip)
+}
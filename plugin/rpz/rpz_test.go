@@ -0,0 +1,176 @@
+package rpz
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// backend answers every query with an A record, or with an NS record and glue for ns.example.org.
+func backend(queries *int) plugin.Handler {
+	return plugin.HandlerFunc(func(_ context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		*queries++
+		m := new(dns.Msg)
+		m.SetReply(r)
+		switch r.Question[0].Name {
+		case "resolved.example.":
+			m.Answer = []dns.RR{test.A("resolved.example. 300 IN A 198.0.2.200")}
+		case "delegated.example.":
+			m.Ns = []dns.RR{test.NS("delegated.example. 300 IN NS ns.evil.example.")}
+		default:
+			m.Answer = []dns.RR{test.A(r.Question[0].Name + " 300 IN A 192.0.2.1")}
+		}
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+}
+
+func newTestRPZ(t *testing.T, queries *int) *RPZ {
+	t.Helper()
+	p := &RPZ{Zones: []string{"."}, Next: backend(queries)}
+
+	allow := &policy{origin: "allow.local."}
+	rs, err := newRules(allow.origin, parseZone(t, allow.origin, `@ 300 IN SOA localhost. hostmaster.localhost. 1 3600 600 86400 60
+tcp.example 300 IN CNAME rpz-passthru.`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	allow.set(rs)
+
+	block := &policy{origin: "rpz.local."}
+	rs, err = newRules(block.origin, parseZone(t, block.origin, policyZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.set(rs)
+
+	p.policies = []*policy{allow, block}
+	return p
+}
+
+func TestServeDNS(t *testing.T) {
+	tests := []struct {
+		qname   string
+		qtype   uint16
+		proto   string
+		queries int // queries to the next plugin
+		rcode   int
+		answer  []dns.RR
+		ns      int
+		tc      bool
+		dropped bool
+	}{
+		{qname: "example.org.", qtype: dns.TypeA, queries: 1, answer: []dns.RR{test.A("example.org. 300 IN A 192.0.2.1")}},
+		{qname: "bad.example.", qtype: dns.TypeA, rcode: dns.RcodeNameError, ns: 1},
+		{qname: "good.bad.example.", qtype: dns.TypeA, queries: 1, answer: []dns.RR{test.A("good.bad.example. 300 IN A 192.0.2.1")}},
+		{qname: "empty.example.", qtype: dns.TypeA, ns: 1},
+		{qname: "drop.example.", qtype: dns.TypeA, dropped: true},
+		{qname: "local.example.", qtype: dns.TypeA, answer: []dns.RR{test.A("local.example. 300 IN A 192.0.2.80")}},
+		{qname: "local.example.", qtype: dns.TypeTXT, answer: []dns.RR{test.TXT(`local.example. 300 IN TXT "blocked"`)}},
+		{qname: "local.example.", qtype: dns.TypeMX, ns: 1},
+		{qname: "garden.example.", qtype: dns.TypeA, answer: []dns.RR{test.CNAME("garden.example. 300 IN CNAME walled.garden.")}},
+		{qname: "a.wild.example.", qtype: dns.TypeA, answer: []dns.RR{test.CNAME("a.wild.example. 300 IN CNAME a.wild.example.walled.garden.")}},
+		// The passthru rule in the first policy zone wins.
+		{qname: "tcp.example.", qtype: dns.TypeA, queries: 1, answer: []dns.RR{test.A("tcp.example. 300 IN A 192.0.2.1")}},
+		{qname: "resolved.example.", qtype: dns.TypeA, queries: 1, rcode: dns.RcodeNameError, ns: 1},
+		{qname: "delegated.example.", qtype: dns.TypeA, queries: 1, rcode: dns.RcodeNameError, ns: 1},
+	}
+	for i, tc := range tests {
+		queries := 0
+		p := newTestRPZ(t, &queries)
+
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		p.ServeDNS(context.TODO(), rec, m)
+
+		if queries != tc.queries {
+			t.Errorf("Test %d: expected %d queries to the next plugin, got %d", i, tc.queries, queries)
+		}
+		if tc.dropped {
+			if rec.Msg != nil {
+				t.Errorf("Test %d: expected no reply, got %v", i, rec.Msg)
+			}
+			continue
+		}
+		if rec.Msg == nil {
+			t.Errorf("Test %d: expected a reply, got none", i)
+			continue
+		}
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[rec.Msg.Rcode])
+		}
+		if err := test.Section(test.Case{Answer: tc.answer}, test.Answer, rec.Msg.Answer); err != nil {
+			t.Errorf("Test %d: %s", i, err)
+		}
+		if len(rec.Msg.Ns) != tc.ns {
+			t.Errorf("Test %d: expected %d records in the authority section, got %d", i, tc.ns, len(rec.Msg.Ns))
+		}
+	}
+}
+
+func TestServeDNSTCPOnly(t *testing.T) {
+	queries := 0
+	p := newTestRPZ(t, &queries)
+	p.policies = p.policies[1:]
+
+	m := new(dns.Msg)
+	m.SetQuestion("tcp.example.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	p.ServeDNS(context.TODO(), rec, m)
+	if !rec.Msg.Truncated || len(rec.Msg.Answer) != 0 || queries != 0 {
+		t.Errorf("Expected truncated reply over UDP, got %v", rec.Msg)
+	}
+
+	rec = dnstest.NewRecorder(&test.ResponseWriter{TCP: true})
+	p.ServeDNS(context.TODO(), rec, m)
+	if rec.Msg.Truncated || len(rec.Msg.Answer) != 1 || queries != 1 {
+		t.Errorf("Expected answer over TCP, got %v", rec.Msg)
+	}
+}
+
+func TestServeDNSClientIP(t *testing.T) {
+	queries := 0
+	p := newTestRPZ(t, &queries)
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: "192.0.2.1"})
+	p.ServeDNS(context.TODO(), rec, m)
+	if rec.Msg != nil || queries != 0 {
+		t.Errorf("Expected query from 192.0.2.1 to be dropped, got %v", rec.Msg)
+	}
+}
+
+func TestServeDNSMetadata(t *testing.T) {
+	queries := 0
+	p := newTestRPZ(t, &queries)
+
+	ctx := metadata.ContextWithMetadata(context.TODO())
+	m := new(dns.Msg)
+	m.SetQuestion("a.bad.example.", dns.TypeA)
+	p.ServeDNS(ctx, dnstest.NewRecorder(&test.ResponseWriter{}), m)
+
+	expected := map[string]string{
+		"rpz/policy":  "rpz.local.",
+		"rpz/trigger": "qname",
+		"rpz/rule":    "*.bad.example.rpz.local.",
+		"rpz/action":  "nxdomain",
+	}
+	for label, value := range expected {
+		f := metadata.ValueFunc(ctx, label)
+		if f == nil {
+			t.Errorf("Expected metadata %s, got none", label)
+			continue
+		}
+		if f() != value {
+			t.Errorf("Expected metadata %s to be %q, got %q", label, value, f())
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package rpz
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/infobloxopen/go-trees/iptree"
+	"github.com/miekg/dns"
+)
+
+// action is what is done with a query that triggers a rule.
+type action int
+
+const (
+	// actionNXDOMAIN answers that the name does not exist.
+	actionNXDOMAIN action = iota
+	// actionNODATA answers that the name has no records of the type asked.
+	actionNODATA
+	// actionPassthru answers the query as if there were no policy.
+	actionPassthru
+	// actionDrop does not answer at all.
+	actionDrop
+	// actionTCPOnly answers UDP queries with a truncated reply, so the client retries over TCP.
+	actionTCPOnly
+	// actionLocalData answers with the records of the rule.
+	actionLocalData
+)
+
+func (a action) String() string {
+	switch a {
+	case actionNXDOMAIN:
+		return "nxdomain"
+	case actionNODATA:
+		return "nodata"
+	case actionPassthru:
+		return "passthru"
+	case actionDrop:
+		return "drop"
+	case actionTCPOnly:
+		return "tcp-only"
+	}
+	return "local-data"
+}
+
+// trigger is the part of a query or its reply that matched a rule. They are listed in order of precedence.
+type trigger int
+
+const (
+	triggerClientIP trigger = iota
+	triggerQNAME
+	triggerIP
+	triggerNSDNAME
+	triggerNSIP
+)
+
+func (t trigger) String() string {
+	switch t {
+	case triggerClientIP:
+		return "client-ip"
+	case triggerQNAME:
+		return "qname"
+	case triggerIP:
+		return "ip"
+	case triggerNSDNAME:
+		return "nsdname"
+	}
+	return "nsip"
+}
+
+// The labels that mark the triggers in owner names of a policy zone.
+const (
+	labelClientIP = "rpz-client-ip"
+	labelIP       = "rpz-ip"
+	labelNSDNAME  = "rpz-nsdname"
+	labelNSIP     = "rpz-nsip"
+)
+
+// rule is the policy for one owner name in a policy zone.
+type rule struct {
+	owner  string // owner name in the policy zone
+	action action
+	data   []dns.RR // records for actionLocalData
+}
+
+// rules holds the rules of a policy zone by trigger.
+type rules struct {
+	soa      *dns.SOA
+	qname    map[string]*rule // names and wildcards, e.g. *.example.org.
+	nsdname  map[string]*rule
+	clientIP *iptree.Tree
+	ip       *iptree.Tree
+	nsip     *iptree.Tree
+	count    int
+}
+
+// hit is a rule that applies to a query.
+type hit struct {
+	policy  string
+	trigger trigger
+	rule    *rule
+	soa     *dns.SOA
+}
+
+// newRules makes the rules from the records of the policy zone origin.
+func newRules(origin string, rrs []dns.RR) (*rules, error) {
+	origin = strings.ToLower(dns.Fqdn(origin))
+	rs := &rules{qname: map[string]*rule{}, nsdname: map[string]*rule{}}
+
+	owners := []string{}
+	byOwner := map[string][]dns.RR{}
+	for _, rr := range rrs {
+		name := strings.ToLower(rr.Header().Name)
+		if !dns.IsSubDomain(origin, name) {
+			continue
+		}
+		if name == origin {
+			if soa, ok := rr.(*dns.SOA); ok {
+				rs.soa = soa
+			}
+			continue
+		}
+		switch rr.Header().Rrtype {
+		case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3:
+			continue
+		}
+		if _, ok := byOwner[name]; !ok {
+			owners = append(owners, name)
+		}
+		byOwner[name] = append(byOwner[name], rr)
+	}
+	if rs.soa == nil {
+		return nil, fmt.Errorf("no SOA record in policy zone %s", origin)
+	}
+
+	for _, owner := range owners {
+		r, err := newRule(owner, byOwner[owner])
+		if err == nil {
+			err = rs.add(strings.TrimSuffix(owner, "."+origin), r)
+		}
+		if err != nil {
+			// A feed with a bad rule is still useful, skip the rule.
+			log.Warningf("Skipping rule %s in policy zone %s: %s", owner, origin, err)
+			continue
+		}
+		rs.count++
+	}
+	return rs, nil
+}
+
+// add adds the rule with the owner name rel, relative to the origin of the policy zone.
+func (rs *rules) add(rel string, r *rule) error {
+	labels := dns.SplitDomainName(rel)
+	last := labels[len(labels)-1]
+	switch last {
+	case labelClientIP, labelIP, labelNSIP:
+		n, err := parsePrefix(labels[:len(labels)-1])
+		if err != nil {
+			return err
+		}
+		tree := &rs.clientIP
+		if last == labelIP {
+			tree = &rs.ip
+		} else if last == labelNSIP {
+			tree = &rs.nsip
+		}
+		if *tree == nil {
+			*tree = iptree.NewTree()
+		}
+		*tree = (*tree).InsertNet(n, r)
+	case labelNSDNAME:
+		if len(labels) == 1 {
+			return fmt.Errorf("no name server name")
+		}
+		rs.nsdname[strings.Join(labels[:len(labels)-1], ".")+"."] = r
+	default:
+		rs.qname[rel+"."] = r
+	}
+	return nil
+}
+
+// newRule makes the rule from the records rrs at owner.
+func newRule(owner string, rrs []dns.RR) (*rule, error) {
+	r := &rule{owner: owner, action: actionLocalData}
+	for _, rr := range rrs {
+		cname, ok := rr.(*dns.CNAME)
+		if !ok {
+			continue
+		}
+		if len(rrs) > 1 {
+			return nil, fmt.Errorf("CNAME and other records at %s", owner)
+		}
+		switch strings.ToLower(cname.Target) {
+		case ".":
+			r.action = actionNXDOMAIN
+		case "*.":
+			r.action = actionNODATA
+		case "rpz-passthru.":
+			r.action = actionPassthru
+		case "rpz-drop.":
+			r.action = actionDrop
+		case "rpz-tcp-only.":
+			r.action = actionTCPOnly
+		}
+	}
+	if r.action == actionLocalData {
+		r.data = rrs
+	}
+	return r, nil
+}
+
+// parsePrefix parses the prefix in the labels of a client IP, IP or NSIP trigger: the prefix length
+// followed by the address in reverse order, e.g. 24.0.2.0.192 or 48.zz.db8.2001, where zz stands for
+// "::".
+func parsePrefix(labels []string) (*net.IPNet, error) {
+	if len(labels) < 2 {
+		return nil, fmt.Errorf("invalid prefix %q", strings.Join(labels, "."))
+	}
+	bits, err := strconv.Atoi(labels[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid prefix length %q", labels[0])
+	}
+
+	addr := make([]string, 0, len(labels)-1)
+	for i := len(labels) - 1; i > 0; i-- {
+		addr = append(addr, labels[i])
+	}
+
+	size := 128
+	var s string
+	if len(addr) == 4 && bits <= 32 && net.ParseIP(strings.Join(addr, ".")).To4() != nil {
+		size = 32
+		s = strings.Join(addr, ".")
+	} else {
+		s = strings.ReplaceAll(strings.Join(addr, ":"), "zz", "")
+		if strings.HasPrefix(s, ":") {
+			s = ":" + s
+		}
+		if strings.HasSuffix(s, ":") {
+			s += ":"
+		}
+	}
+	ip := net.ParseIP(s)
+	if ip == nil || bits < 1 || bits > size {
+		return nil, fmt.Errorf("invalid prefix %q", strings.Join(labels, "."))
+	}
+	if size == 32 {
+		ip = ip.To4()
+	}
+	return &net.IPNet{IP: ip.Mask(net.CIDRMask(bits, size)), Mask: net.CIDRMask(bits, size)}, nil
+}
+
+// query returns the rule for a query for qname from client, if any.
+func (rs *rules) query(client net.IP, qname string) *hit {
+	if rs.clientIP != nil && client != nil {
+		if r, ok := rs.clientIP.GetByIP(client); ok {
+			return &hit{trigger: triggerClientIP, rule: r.(*rule), soa: rs.soa}
+		}
+	}
+	if r := matchName(rs.qname, qname); r != nil {
+		return &hit{trigger: triggerQNAME, rule: r, soa: rs.soa}
+	}
+	return nil
+}
+
+// response returns true if there are rules that apply to the reply.
+func (rs *rules) response() bool {
+	return rs.ip != nil || len(rs.nsdname) > 0 || rs.nsip != nil
+}
+
+// reply returns the rule that applies to the reply m, if any.
+func (rs *rules) reply(m *dns.Msg) *hit {
+	if rs.ip != nil {
+		for _, rr := range m.Answer {
+			if r := lookupIP(rs.ip, rr); r != nil {
+				return &hit{trigger: triggerIP, rule: r, soa: rs.soa}
+			}
+		}
+	}
+
+	if len(rs.nsdname) == 0 && rs.nsip == nil {
+		return nil
+	}
+	names := []string{}
+	ns := map[string]bool{}
+	for _, section := range [][]dns.RR{m.Answer, m.Ns} {
+		for _, rr := range section {
+			if x, ok := rr.(*dns.NS); ok && !ns[strings.ToLower(x.Ns)] {
+				names = append(names, strings.ToLower(x.Ns))
+				ns[strings.ToLower(x.Ns)] = true
+			}
+		}
+	}
+	for _, name := range names {
+		if r := matchName(rs.nsdname, name); r != nil {
+			return &hit{trigger: triggerNSDNAME, rule: r, soa: rs.soa}
+		}
+	}
+	if rs.nsip != nil {
+		for _, rr := range m.Extra {
+			if !ns[strings.ToLower(rr.Header().Name)] {
+				continue
+			}
+			if r := lookupIP(rs.nsip, rr); r != nil {
+				return &hit{trigger: triggerNSIP, rule: r, soa: rs.soa}
+			}
+		}
+	}
+	return nil
+}
+
+func lookupIP(tree *iptree.Tree, rr dns.RR) *rule {
+	var ip net.IP
+	switch x := rr.(type) {
+	case *dns.A:
+		ip = x.A
+	case *dns.AAAA:
+		ip = x.AAAA
+	default:
+		return nil
+	}
+	if r, ok := tree.GetByIP(ip); ok {
+		return r.(*rule)
+	}
+	return nil
+}
+
+// matchName returns the rule for name in names, an exact match wins over a wildcard, and a longer wildcard
+// over a shorter one.
+func matchName(names map[string]*rule, name string) *rule {
+	if len(names) == 0 {
+		return nil
+	}
+	name = strings.ToLower(name)
+	if r, ok := names[name]; ok {
+		return r
+	}
+	for off, end := dns.NextLabel(name, 0); !end; off, end = dns.NextLabel(name, off) {
+		if r, ok := names["*."+name[off:]]; ok {
+			return r
+		}
+	}
+	return nil
+}
+
+// answer returns the reply to r for the rule, which has action actionNXDOMAIN, actionNODATA or
+// actionLocalData.
+func (h *hit) answer(r *dns.Msg) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.RecursionAvailable = true
+
+	qname, qtype := r.Question[0].Name, r.Question[0].Qtype
+	switch h.rule.action {
+	case actionNXDOMAIN:
+		m.Rcode = dns.RcodeNameError
+	case actionLocalData:
+		for _, rr := range h.rule.data {
+			rrtype := rr.Header().Rrtype
+			if rrtype != qtype && qtype != dns.TypeANY && rrtype != dns.TypeCNAME {
+				continue
+			}
+			rr = dns.Copy(rr)
+			rr.Header().Name = qname
+			if cname, ok := rr.(*dns.CNAME); ok && strings.HasPrefix(cname.Target, "*.") {
+				// A wildcard target is replaced by the query name, e.g. a.example.org. CNAME *.garden. becomes
+				// a.example.org. CNAME a.example.org.garden.
+				cname.Target = qname + cname.Target[2:]
+			}
+			m.Answer = append(m.Answer, rr)
+		}
+	}
+	if len(m.Answer) == 0 {
+		soa := dns.Copy(h.soa).(*dns.SOA)
+		soa.Hdr.Ttl = min(soa.Hdr.Ttl, soa.Minttl)
+		m.Ns = []dns.RR{soa}
+	}
+	return m
+}
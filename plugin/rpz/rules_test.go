@@ -0,0 +1,185 @@
+package rpz
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+const policyZone = `$TTL 300
+@                           SOA    localhost. hostmaster.localhost. 1 3600 600 86400 60
+                            NS     localhost.
+bad.example                 CNAME  .
+*.bad.example               CNAME  .
+empty.example               CNAME  *.
+good.bad.example            CNAME  rpz-passthru.
+drop.example                CNAME  rpz-drop.
+tcp.example                 CNAME  rpz-tcp-only.
+garden.example              CNAME  walled.garden.
+*.wild.example              CNAME  *.walled.garden.
+local.example               A      192.0.2.80
+local.example               TXT    "blocked"
+32.1.2.0.192.rpz-client-ip  CNAME  rpz-drop.
+24.0.2.0.198.rpz-ip         CNAME  .
+48.zz.db8.2001.rpz-ip       CNAME  .
+ns.evil.example.rpz-nsdname CNAME  .
+32.1.113.0.203.rpz-nsip     CNAME  *.
+1.2.3.rpz-ip                CNAME  .
+`
+
+func parseZone(t *testing.T, origin, zone string) []dns.RR {
+	t.Helper()
+	zp := dns.NewZoneParser(strings.NewReader(zone), origin, "")
+	rrs := []dns.RR{}
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		rrs = append(rrs, rr)
+	}
+	if err := zp.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return rrs
+}
+
+func TestNewRules(t *testing.T) {
+	rs, err := newRules("rpz.local.", parseZone(t, "rpz.local.", policyZone))
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	// The invalid IP trigger is skipped.
+	if rs.count != 14 {
+		t.Errorf("Expected 14 rules, got %d", rs.count)
+	}
+
+	tests := []struct {
+		client  string
+		qname   string
+		trigger trigger
+		action  action
+		owner   string
+	}{
+		{"10.0.0.1", "bad.example.", triggerQNAME, actionNXDOMAIN, "bad.example.rpz.local."},
+		{"10.0.0.1", "BAD.example.", triggerQNAME, actionNXDOMAIN, "bad.example.rpz.local."},
+		{"10.0.0.1", "a.b.bad.example.", triggerQNAME, actionNXDOMAIN, "*.bad.example.rpz.local."},
+		{"10.0.0.1", "good.bad.example.", triggerQNAME, actionPassthru, "good.bad.example.rpz.local."},
+		{"10.0.0.1", "empty.example.", triggerQNAME, actionNODATA, "empty.example.rpz.local."},
+		{"10.0.0.1", "drop.example.", triggerQNAME, actionDrop, "drop.example.rpz.local."},
+		{"10.0.0.1", "tcp.example.", triggerQNAME, actionTCPOnly, "tcp.example.rpz.local."},
+		{"10.0.0.1", "local.example.", triggerQNAME, actionLocalData, "local.example.rpz.local."},
+		{"192.0.2.1", "example.org.", triggerClientIP, actionDrop, "32.1.2.0.192.rpz-client-ip.rpz.local."},
+		{"192.0.2.1", "bad.example.", triggerClientIP, actionDrop, "32.1.2.0.192.rpz-client-ip.rpz.local."},
+	}
+	for i, tc := range tests {
+		h := rs.query(net.ParseIP(tc.client), tc.qname)
+		if h == nil {
+			t.Errorf("Test %d: expected a rule for %s, got none", i, tc.qname)
+			continue
+		}
+		if h.trigger != tc.trigger || h.rule.action != tc.action || h.rule.owner != tc.owner {
+			t.Errorf("Test %d: expected %s %s %s, got %s %s %s", i, tc.trigger, tc.action, tc.owner, h.trigger, h.rule.action, h.rule.owner)
+		}
+	}
+	for _, qname := range []string{"example.org.", "wild.example.", "bad.example.org."} {
+		if h := rs.query(net.ParseIP("10.0.0.1"), qname); h != nil {
+			t.Errorf("Expected no rule for %s, got %s", qname, h.rule.owner)
+		}
+	}
+}
+
+func TestRulesReply(t *testing.T) {
+	rs, err := newRules("rpz.local.", parseZone(t, "rpz.local.", policyZone))
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	tests := []struct {
+		answer  []string
+		ns      []string
+		extra   []string
+		trigger trigger
+		owner   string
+	}{
+		{answer: []string{"a.example.org. IN A 198.0.2.200"}, trigger: triggerIP, owner: "24.0.2.0.198.rpz-ip.rpz.local."},
+		{answer: []string{"a.example.org. IN AAAA 2001:db8::1"}, trigger: triggerIP, owner: "48.zz.db8.2001.rpz-ip.rpz.local."},
+		{ns: []string{"example.org. IN NS ns.evil.example."}, trigger: triggerNSDNAME, owner: "ns.evil.example.rpz-nsdname.rpz.local."},
+		{
+			ns:      []string{"example.org. IN NS ns.example.org."},
+			extra:   []string{"ns.example.org. IN A 203.0.113.1"},
+			trigger: triggerNSIP, owner: "32.1.113.0.203.rpz-nsip.rpz.local.",
+		},
+		// Glue for another name.
+		{extra: []string{"ns.example.org. IN A 203.0.113.1"}},
+		{answer: []string{"a.example.org. IN A 192.0.2.1"}},
+	}
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		for _, s := range tc.answer {
+			m.Answer = append(m.Answer, mustRR(t, s))
+		}
+		for _, s := range tc.ns {
+			m.Ns = append(m.Ns, mustRR(t, s))
+		}
+		for _, s := range tc.extra {
+			m.Extra = append(m.Extra, mustRR(t, s))
+		}
+		h := rs.reply(m)
+		if tc.owner == "" {
+			if h != nil {
+				t.Errorf("Test %d: expected no rule, got %s", i, h.rule.owner)
+			}
+			continue
+		}
+		if h == nil {
+			t.Errorf("Test %d: expected rule %s, got none", i, tc.owner)
+			continue
+		}
+		if h.trigger != tc.trigger || h.rule.owner != tc.owner {
+			t.Errorf("Test %d: expected %s %s, got %s %s", i, tc.trigger, tc.owner, h.trigger, h.rule.owner)
+		}
+	}
+}
+
+func TestParsePrefix(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"32.1.2.0.192", "192.0.2.1/32"},
+		{"24.0.2.0.192", "192.0.2.0/24"},
+		{"8.255.255.255.10", "10.0.0.0/8"},
+		{"128.1.zz.db8.2001", "2001:db8::1/128"},
+		{"48.zz.db8.2001", "2001:db8::/48"},
+		{"128.1.zz", "::1/128"},
+		{"33.1.2.0.192", ""},
+		{"0.1.2.0.192", ""},
+		{"32.1.2.0", ""},
+		{"x.1.2.0.192", ""},
+		{"24", ""},
+	}
+	for _, tc := range tests {
+		n, err := parsePrefix(strings.Split(tc.in, "."))
+		if tc.out == "" {
+			if err == nil {
+				t.Errorf("Expected error for %s, got %s", tc.in, n)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Expected no error for %s, got %s", tc.in, err)
+			continue
+		}
+		if n.String() != tc.out {
+			t.Errorf("Expected %s for %s, got %s", tc.out, tc.in, n)
+		}
+	}
+}
+
+func mustRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rr
+}
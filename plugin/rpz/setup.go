@@ -0,0 +1,120 @@
+package rpz
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/parse"
+
+	"github.com/miekg/dns"
+)
+
+func init() { plugin.Register("rpz", setup) }
+
+func setup(c *caddy.Controller) error {
+	p, reload, err := rpzParse(c)
+	if err != nil {
+		return plugin.Error("rpz", err)
+	}
+
+	stop := make(chan struct{})
+	updateShutdown := make(chan bool)
+	var once sync.Once
+	c.OnStartup(func() error {
+		for _, pol := range p.policies {
+			if pol.zone != nil {
+				go pol.update(updateShutdown)
+				continue
+			}
+			if err := pol.load(); err != nil {
+				return plugin.Error("rpz", err)
+			}
+			if reload > 0 {
+				go pol.reload(reload, stop)
+			}
+		}
+		return nil
+	})
+	c.OnShutdown(func() error {
+		once.Do(func() {
+			close(stop)
+			close(updateShutdown)
+		})
+		return nil
+	})
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		p.Next = next
+		return p
+	})
+
+	return nil
+}
+
+func rpzParse(c *caddy.Controller) (*RPZ, time.Duration, error) {
+	p := &RPZ{}
+	reload := time.Minute
+	config := dnsserver.GetConfig(c)
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, 0, plugin.ErrOnce
+		}
+		i++
+
+		p.Zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+
+		origins := map[string]bool{}
+		for c.NextBlock() {
+			switch c.Val() {
+			case "file":
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return nil, 0, c.ArgErr()
+				}
+				origin := dns.Fqdn(args[0])
+				path := args[1]
+				if !filepath.IsAbs(path) && config.Root != "" {
+					path = filepath.Join(config.Root, path)
+				}
+				p.policies = append(p.policies, newFilePolicy(origin, path))
+			case "secondary":
+				if !c.NextArg() {
+					return nil, 0, c.ArgErr()
+				}
+				origin := dns.Fqdn(c.Val())
+				from, err := parse.TransferIn(c)
+				if err != nil {
+					return nil, 0, err
+				}
+				p.policies = append(p.policies, newSecondaryPolicy(origin, from))
+			case "reload":
+				if !c.NextArg() {
+					return nil, 0, c.ArgErr()
+				}
+				d, err := time.ParseDuration(c.Val())
+				if err != nil || d < 0 {
+					return nil, 0, c.Errf("invalid reload duration %q", c.Val())
+				}
+				reload = d
+			default:
+				return nil, 0, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+		for _, pol := range p.policies {
+			if origins[pol.origin] {
+				return nil, 0, c.Errf("policy zone %s is listed more than once", pol.origin)
+			}
+			origins[pol.origin] = true
+		}
+		if len(p.policies) == 0 {
+			return nil, 0, c.Err("no policy zones")
+		}
+	}
+	return p, reload, nil
+}
@@ -0,0 +1,96 @@
+package rpz
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		policies  []string
+		reload    time.Duration
+	}{
+		{`rpz {
+			file rpz.local db.rpz
+		}`, false, []string{"rpz.local."}, time.Minute},
+		{`rpz example.org {
+			file allow.local db.allow
+			secondary feed.example from 192.0.2.53 192.0.2.54:5353
+			reload 10s
+		}`, false, []string{"allow.local.", "feed.example."}, 10 * time.Second},
+		{`rpz {
+			file rpz.local db.rpz
+			reload 0s
+		}`, false, []string{"rpz.local."}, 0},
+		// fails
+		{`rpz`, true, nil, 0},
+		{`rpz {
+			file rpz.local
+		}`, true, nil, 0},
+		{`rpz {
+			secondary feed.example 192.0.2.53
+		}`, true, nil, 0},
+		{`rpz {
+			file rpz.local db.rpz
+			reload -1s
+		}`, true, nil, 0},
+		{`rpz {
+			file rpz.local db.rpz
+			file rpz.local db.other
+		}`, true, nil, 0},
+		{`rpz {
+			file rpz.local db.rpz
+			blocklist
+		}`, true, nil, 0},
+		{`rpz {
+			file rpz.local db.rpz
+		}
+		rpz {
+			file other.local db.other
+		}`, true, nil, 0},
+	}
+
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		p, reload, err := rpzParse(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		if len(p.policies) != len(tc.policies) {
+			t.Errorf("Test %d: expected %d policy zones, got %d", i, len(tc.policies), len(p.policies))
+			continue
+		}
+		for j, origin := range tc.policies {
+			if p.policies[j].origin != origin {
+				t.Errorf("Test %d: expected policy zone %s, got %s", i, origin, p.policies[j].origin)
+			}
+		}
+		if reload != tc.reload {
+			t.Errorf("Test %d: expected reload %s, got %s", i, tc.reload, reload)
+		}
+	}
+}
+
+func TestSetupSecondary(t *testing.T) {
+	c := caddy.NewTestController("dns", `rpz {
+		secondary feed.example from 192.0.2.53
+	}`)
+	p, _, err := rpzParse(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if z := p.policies[0].zone; z == nil || len(z.TransferFrom) != 1 || z.TransferFrom[0] != "192.0.2.53:53" {
+		t.Errorf("Expected transfer from 192.0.2.53:53, got %v", z)
+	}
+}
@@ -0,0 +1,18 @@
+package rrl
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// limitedCount is the number of responses that exceeded the rate limit, by what was done with them.
+	limitedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "limited_responses_total",
+		Help:      "Counter of responses that exceeded the rate limit, per category and action (dropped, slipped or leaked).",
+	}, []string{"server", "zone", "category", "action"})
+)
@@ -0,0 +1,63 @@
+package rrl
+
+import (
+	"github.com/miekg/dns"
+)
+
+// ResponseWriter applies the rate limit to the responses written to it.
+type ResponseWriter struct {
+	dns.ResponseWriter
+	rrl    *RRL
+	prefix string
+	server string
+	zone   string
+}
+
+// WriteMsg implements the dns.ResponseWriter interface.
+func (w *ResponseWriter) WriteMsg(m *dns.Msg) error {
+	switch w.limit(m) {
+	case actionDrop:
+		return nil
+	case actionSlip:
+		return w.ResponseWriter.WriteMsg(truncated(m))
+	}
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// Write implements the dns.ResponseWriter interface.
+func (w *ResponseWriter) Write(buf []byte) (int, error) {
+	m := new(dns.Msg)
+	if err := m.Unpack(buf); err != nil {
+		return w.ResponseWriter.Write(buf)
+	}
+	switch w.limit(m) {
+	case actionDrop:
+		return len(buf), nil
+	case actionSlip:
+		if err := w.ResponseWriter.WriteMsg(truncated(m)); err != nil {
+			return 0, err
+		}
+		return len(buf), nil
+	}
+	return w.ResponseWriter.Write(buf)
+}
+
+// limit returns what to do with m and updates the metrics.
+func (w *ResponseWriter) limit(m *dns.Msg) action {
+	act, cat := w.rrl.decide(w.prefix, m)
+	if act != actionSend {
+		limitedCount.WithLabelValues(w.server, w.zone, cat.String(), actionNames[act]).Inc()
+	}
+	return act
+}
+
+// truncated returns an empty copy of m with the TC bit set, this makes a real client retry over TCP.
+func truncated(m *dns.Msg) *dns.Msg {
+	tc := m.Copy()
+	tc.Truncated = true
+	tc.Answer, tc.Ns, tc.Extra = nil, nil, nil
+	if opt := m.IsEdns0(); opt != nil {
+		tc.Extra = []dns.RR{opt}
+	}
+	return tc
+}
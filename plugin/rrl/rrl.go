@@ -0,0 +1,207 @@
+// Package rrl implements response rate limiting (RRL) for authoritative servers.
+package rrl
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/response"
+	"github.com/coredns/coredns/request"
+
+	"github.com/infobloxopen/go-trees/iptree"
+	"github.com/miekg/dns"
+)
+
+var log = clog.NewWithPlugin(pluginName)
+
+// RRL limits the rate of identical UDP responses sent to a client network, to prevent the server
+// being used as an amplifier in reflection attacks.
+type RRL struct {
+	Next  plugin.Handler
+	Zones []string
+
+	window     time.Duration
+	ipv4Prefix int
+	ipv6Prefix int
+
+	rates [numCategories]float64 // Allowed responses per second per category, 0 disables limiting.
+
+	slip   int // Every slip'th limited response is sent truncated, 0 disables.
+	leak   int // Every leak'th limited response is sent as is, 0 disables.
+	exempt *iptree.Tree
+
+	table *table
+	now   func() time.Time
+}
+
+// category is the kind of response being limited, each has its own rate.
+type category uint8
+
+const (
+	catResponse category = iota
+	catNodata
+	catNXDomain
+	catReferral
+	catError
+	numCategories
+)
+
+var categoryNames = [numCategories]string{"response", "nodata", "nxdomain", "referral", "error"}
+
+func (c category) String() string { return categoryNames[c] }
+
+// ServeDNS implements the plugin.Handler interface.
+func (r *RRL) ServeDNS(ctx context.Context, w dns.ResponseWriter, req *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: req}
+
+	// Responses over TCP can't be spoofed, so they are never limited.
+	if state.Proto() != "udp" {
+		return plugin.NextOrFailure(r.Name(), r.Next, ctx, w, req)
+	}
+	zone := plugin.Zones(r.Zones).Matches(state.Name())
+	if zone == "" {
+		return plugin.NextOrFailure(r.Name(), r.Next, ctx, w, req)
+	}
+	ip := parseIP(state.IP())
+	if ip == nil {
+		return plugin.NextOrFailure(r.Name(), r.Next, ctx, w, req)
+	}
+	if _, exempt := r.exempt.GetByIP(ip); exempt {
+		return plugin.NextOrFailure(r.Name(), r.Next, ctx, w, req)
+	}
+
+	rw := &ResponseWriter{ResponseWriter: w, rrl: r, prefix: r.prefix(ip), server: metrics.WithServer(ctx), zone: zone}
+	rcode, err := plugin.NextOrFailure(r.Name(), r.Next, ctx, rw, req)
+	if !plugin.ClientWrite(rcode) {
+		// The error response would be written by the server, bypassing us; write it here so
+		// errors are limited as well.
+		m := new(dns.Msg)
+		m.SetRcode(req, rcode)
+		rw.WriteMsg(m)
+		return dns.RcodeSuccess, err
+	}
+	return rcode, err
+}
+
+// Name implements the plugin.Handler interface.
+func (r *RRL) Name() string { return pluginName }
+
+// prefix returns the client network of ip as a string.
+func (r *RRL) prefix(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(r.ipv4Prefix, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(r.ipv6Prefix, 128)).String()
+}
+
+// action is what to do with a response.
+type action uint8
+
+const (
+	actionSend action = iota
+	actionDrop
+	actionSlip
+	actionLeak
+)
+
+var actionNames = map[action]string{actionDrop: "dropped", actionSlip: "slipped", actionLeak: "leaked"}
+
+// decide debits the bucket for the response m to the client network prefix and returns what to do
+// with the response.
+func (r *RRL) decide(prefix string, m *dns.Msg) (action, category) {
+	k, cat, ok := r.key(prefix, m)
+	if !ok || r.rates[cat] == 0 {
+		return actionSend, cat
+	}
+	allowed, limited := r.table.debit(k, r.rates[cat], r.window, r.now())
+	if allowed {
+		return actionSend, cat
+	}
+	switch {
+	case r.leak > 0 && limited%r.leak == 0:
+		return actionLeak, cat
+	case r.slip > 0 && limited%r.slip == 0:
+		return actionSlip, cat
+	}
+	return actionDrop, cat
+}
+
+// key returns the table key for a response m to the client network prefix. The name in the key
+// is the one an attacker can't vary at will: the qname for positive answers, the zone for
+// negative answers and errors, and the delegation point for referrals. Answers synthesized from
+// a wildcard (detected by the labels field of their signature) use the wildcard name. The
+// boolean is false for responses that should never be limited.
+func (r *RRL) key(prefix string, m *dns.Msg) (key, category, bool) {
+	if len(m.Question) == 0 {
+		return key{}, catError, false
+	}
+	k := key{prefix: prefix, qtype: m.Question[0].Qtype}
+
+	typ, _ := response.Typify(m, r.now().UTC())
+	switch typ {
+	case response.NoError:
+		k.category = catResponse
+		k.name = strings.ToLower(m.Question[0].Name)
+		if w := wildcard(m.Answer); w != "" {
+			k.name = w
+		}
+	case response.NoData:
+		k.category = catNodata
+		k.name = authorityOwner(m, dns.TypeSOA)
+	case response.NameError:
+		k.category = catNXDomain
+		k.name = authorityOwner(m, dns.TypeSOA)
+		k.qtype = 0
+	case response.Delegation:
+		k.category = catReferral
+		k.name = authorityOwner(m, dns.TypeNS)
+		k.qtype = 0
+	case response.ServerError, response.OtherError:
+		k.category = catError
+		k.qtype = 0
+	default:
+		return key{}, catError, false
+	}
+	return k, k.category, true
+}
+
+// authorityOwner returns the owner name of the first record of type qtype in the authority section of m.
+func authorityOwner(m *dns.Msg, qtype uint16) string {
+	for _, rr := range m.Ns {
+		if rr.Header().Rrtype == qtype {
+			return strings.ToLower(rr.Header().Name)
+		}
+	}
+	return ""
+}
+
+// wildcard returns the wildcard name that the answer was synthesized from, or the empty string.
+func wildcard(answer []dns.RR) string {
+	for _, rr := range answer {
+		sig, ok := rr.(*dns.RRSIG)
+		if !ok {
+			continue
+		}
+		labels := dns.SplitDomainName(sig.Hdr.Name)
+		if int(sig.Labels) >= len(labels) {
+			continue
+		}
+		if sig.Labels == 0 {
+			return "*."
+		}
+		return "*." + strings.ToLower(dns.Fqdn(strings.Join(labels[len(labels)-int(sig.Labels):], ".")))
+	}
+	return ""
+}
+
+func parseIP(s string) net.IP {
+	if idx := strings.IndexByte(s, '%'); idx >= 0 {
+		s = s[:idx]
+	}
+	return net.ParseIP(s)
+}
@@ -0,0 +1,199 @@
+package rrl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// answer is a handler that replies with a positive answer, NXDOMAIN for nx.example.org., or a
+// SERVFAIL (without writing) for fail.example.org.
+var answer = plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	switch r.Question[0].Name {
+	case "fail.example.org.":
+		return dns.RcodeServerFailure, nil
+	case "nx.example.org.", "nx2.example.org.":
+		m.Rcode = dns.RcodeNameError
+		m.Ns = []dns.RR{test.SOA("example.org. 300 IN SOA ns.example.org. hostmaster.example.org. 1 7200 3600 1209600 300")}
+	default:
+		m.Answer = []dns.RR{test.A(r.Question[0].Name + " 300 IN A 192.0.2.1")}
+	}
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+})
+
+func newRRL(t *testing.T, config string) (*RRL, *time.Time) {
+	t.Helper()
+	c := caddy.NewTestController("dns", config)
+	r, err := parse(c)
+	if err != nil {
+		t.Fatalf("Failed to parse %q: %s", config, err)
+	}
+	now := time.Unix(1700000000, 0)
+	r.now = func() time.Time { return now }
+	r.Next = answer
+	return r, &now
+}
+
+// query sends a query for qname from ip and returns the response, nil if nothing was written.
+func query(t *testing.T, r *RRL, ip, qname string, tcp bool) *dns.Msg {
+	t.Helper()
+	m := new(dns.Msg)
+	m.SetQuestion(qname, dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: ip, TCP: tcp})
+	if _, err := r.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	return rec.Msg
+}
+
+func TestRRL(t *testing.T) {
+	r, now := newRRL(t, `rrl example.org {
+		responses_per_second 2
+		slip 2
+	}`)
+
+	// The first two are within the rate, after that every other response is slipped.
+	for i, expected := range []string{"sent", "sent", "dropped", "slipped", "dropped", "slipped"} {
+		m := query(t, r, "192.0.2.10", "www.example.org.", false)
+		if x := outcome(m); x != expected {
+			t.Errorf("Response %d: expected %s, got %s", i, expected, x)
+		}
+	}
+
+	// Same /24 shares the bucket.
+	if x := outcome(query(t, r, "192.0.2.99", "www.example.org.", false)); x == "sent" {
+		t.Errorf("Expected response to another host in the same network to be limited")
+	}
+	// Another network, another name, TCP and other zones are not limited.
+	if x := outcome(query(t, r, "198.51.100.1", "www.example.org.", false)); x != "sent" {
+		t.Errorf("Expected response to another network to be sent, got %s", x)
+	}
+	if x := outcome(query(t, r, "192.0.2.10", "other.example.org.", false)); x != "sent" {
+		t.Errorf("Expected response for another name to be sent, got %s", x)
+	}
+	if x := outcome(query(t, r, "192.0.2.10", "www.example.org.", true)); x != "sent" {
+		t.Errorf("Expected response over TCP to be sent, got %s", x)
+	}
+	if x := outcome(query(t, r, "192.0.2.10", "www.example.net.", false)); x != "sent" {
+		t.Errorf("Expected response for another zone to be sent, got %s", x)
+	}
+
+	// The bucket is in debt; after the window it's full again.
+	*now = now.Add(r.window + time.Second)
+	if x := outcome(query(t, r, "192.0.2.10", "www.example.org.", false)); x != "sent" {
+		t.Errorf("Expected response to be sent after the window, got %s", x)
+	}
+}
+
+func TestRRLNXDomain(t *testing.T) {
+	r, _ := newRRL(t, `rrl example.org {
+		responses_per_second 10
+		nxdomains_per_second 1
+		slip 0
+	}`)
+
+	// Random names in the same zone share a bucket.
+	if x := outcome(query(t, r, "192.0.2.10", "nx.example.org.", false)); x != "sent" {
+		t.Errorf("Expected first NXDOMAIN to be sent, got %s", x)
+	}
+	if x := outcome(query(t, r, "192.0.2.10", "nx2.example.org.", false)); x != "dropped" {
+		t.Errorf("Expected second NXDOMAIN to be dropped, got %s", x)
+	}
+	if x := outcome(query(t, r, "192.0.2.10", "www.example.org.", false)); x != "sent" {
+		t.Errorf("Expected positive answer to be sent, got %s", x)
+	}
+}
+
+func TestRRLErrors(t *testing.T) {
+	r, _ := newRRL(t, `rrl example.org {
+		responses_per_second 1
+		slip 0
+	}`)
+
+	m := query(t, r, "192.0.2.10", "fail.example.org.", false)
+	if m == nil || m.Rcode != dns.RcodeServerFailure {
+		t.Fatalf("Expected SERVFAIL to be written, got %v", m)
+	}
+	if x := outcome(query(t, r, "192.0.2.10", "fail.example.org.", false)); x != "dropped" {
+		t.Errorf("Expected second SERVFAIL to be dropped, got %s", x)
+	}
+}
+
+func TestRRLLeakExempt(t *testing.T) {
+	r, _ := newRRL(t, `rrl example.org {
+		responses_per_second 1
+		slip 0
+		leak 2
+		exempt 192.0.2.0/28 2001:db8::1
+	}`)
+
+	for i, expected := range []string{"sent", "dropped", "sent", "dropped", "sent"} {
+		if x := outcome(query(t, r, "198.51.100.1", "www.example.org.", false)); x != expected {
+			t.Errorf("Response %d: expected %s, got %s", i, expected, x)
+		}
+	}
+	for _, ip := range []string{"192.0.2.1", "2001:db8::1"} {
+		for range 3 {
+			if x := outcome(query(t, r, ip, "www.example.org.", false)); x != "sent" {
+				t.Errorf("Expected responses to exempt %s to be sent, got %s", ip, x)
+			}
+		}
+	}
+}
+
+func outcome(m *dns.Msg) string {
+	switch {
+	case m == nil:
+		return "dropped"
+	case m.Truncated:
+		if len(m.Answer) != 0 || len(m.Ns) != 0 {
+			return "truncated with data"
+		}
+		return "slipped"
+	}
+	return "sent"
+}
+
+func TestKeyWildcard(t *testing.T) {
+	r, _ := newRRL(t, `rrl {
+		responses_per_second 1
+	}`)
+	m := new(dns.Msg)
+	m.SetQuestion("a.b.example.org.", dns.TypeA)
+	m.Response = true
+	m.Answer = []dns.RR{
+		test.A("a.b.example.org. 300 IN A 192.0.2.1"),
+		test.RRSIG("a.b.example.org. 300 IN RRSIG A 8 2 300 20991231000000 20200101000000 12345 example.org. c2lnbmF0dXJl"),
+	}
+	k, cat, ok := r.key("192.0.2.0", m)
+	if !ok || cat != catResponse {
+		t.Fatalf("Expected a response key, got %v %s", ok, cat)
+	}
+	if k.name != "*.example.org." {
+		t.Errorf("Expected wildcard name %q, got %q", "*.example.org.", k.name)
+	}
+}
+
+func TestTableEvict(t *testing.T) {
+	tbl := newTable(2)
+	now := time.Unix(1700000000, 0)
+	for i, name := range []string{"a.", "b.", "c."} {
+		tbl.debit(key{name: name}, 1, time.Second, now.Add(time.Duration(i)*time.Millisecond))
+	}
+	if len(tbl.buckets) > 2 {
+		t.Errorf("Expected at most 2 buckets, got %d", len(tbl.buckets))
+	}
+	if _, ok := tbl.buckets[key{name: "c."}]; !ok {
+		t.Error("Expected newest bucket to be kept")
+	}
+}
@@ -0,0 +1,143 @@
+package rrl
+
+import (
+	"net"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	pkgparse "github.com/coredns/coredns/plugin/pkg/parse"
+
+	"github.com/infobloxopen/go-trees/iptree"
+)
+
+const pluginName = "rrl"
+
+const (
+	defaultWindow       = 15 * time.Second
+	defaultIPv4Prefix   = 24
+	defaultIPv6Prefix   = 56
+	defaultSlip         = 2
+	defaultMaxTableSize = 100000
+)
+
+func init() { plugin.Register(pluginName, setup) }
+
+func setup(c *caddy.Controller) error {
+	r, err := parse(c)
+	if err != nil {
+		return plugin.Error(pluginName, err)
+	}
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		r.Next = next
+		return r
+	})
+
+	return nil
+}
+
+func parse(c *caddy.Controller) (*RRL, error) {
+	r := &RRL{
+		window:     defaultWindow,
+		ipv4Prefix: defaultIPv4Prefix,
+		ipv6Prefix: defaultIPv6Prefix,
+		slip:       defaultSlip,
+		exempt:     iptree.NewTree(),
+		now:        time.Now,
+	}
+	maxTableSize := defaultMaxTableSize
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		r.Zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+
+		// Categories without their own rate use the responses_per_second rate.
+		set := [numCategories]bool{}
+		for c.NextBlock() {
+			switch c.Val() {
+			case "window":
+				n, err := pkgparse.IntArg(c, 1, 3600)
+				if err != nil {
+					return nil, err
+				}
+				r.window = time.Duration(n) * time.Second
+			case "ipv4_prefix_length":
+				n, err := pkgparse.IntArg(c, 0, 32)
+				if err != nil {
+					return nil, err
+				}
+				r.ipv4Prefix = n
+			case "ipv6_prefix_length":
+				n, err := pkgparse.IntArg(c, 0, 128)
+				if err != nil {
+					return nil, err
+				}
+				r.ipv6Prefix = n
+			case "responses_per_second", "nodata_per_second", "nxdomains_per_second", "referrals_per_second", "errors_per_second":
+				cat := rateCategories[c.Val()]
+				n, err := pkgparse.IntArg(c, 0, 1000000)
+				if err != nil {
+					return nil, err
+				}
+				r.rates[cat] = float64(n)
+				set[cat] = true
+			case "slip":
+				n, err := pkgparse.IntArg(c, 0, 10)
+				if err != nil {
+					return nil, err
+				}
+				r.slip = n
+			case "leak":
+				n, err := pkgparse.IntArg(c, 0, 1000)
+				if err != nil {
+					return nil, err
+				}
+				r.leak = n
+			case "exempt":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, a := range args {
+					_, n, err := net.ParseCIDR(pkgparse.CIDR(a))
+					if err != nil {
+						return nil, c.Errf("invalid network %q", a)
+					}
+					r.exempt.InplaceInsertNet(n, struct{}{})
+				}
+			case "max_table_size":
+				n, err := pkgparse.IntArg(c, 1, 100000000)
+				if err != nil {
+					return nil, err
+				}
+				maxTableSize = n
+			default:
+				return nil, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+		for cat := catNodata; cat < numCategories; cat++ {
+			if !set[cat] {
+				r.rates[cat] = r.rates[catResponse]
+			}
+		}
+	}
+	if r.rates == [numCategories]float64{} {
+		return nil, c.Err("no rate limit set")
+	}
+	r.table = newTable(maxTableSize)
+	return r, nil
+}
+
+var rateCategories = map[string]category{
+	"responses_per_second": catResponse,
+	"nodata_per_second":    catNodata,
+	"nxdomains_per_second": catNXDomain,
+	"referrals_per_second": catReferral,
+	"errors_per_second":    catError,
+}
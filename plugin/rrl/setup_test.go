@@ -0,0 +1,92 @@
+package rrl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+	}{
+		{`rrl {
+			responses_per_second 10
+		}`, false},
+		{`rrl example.org example.net {
+			window 5
+			ipv4_prefix_length 32
+			ipv6_prefix_length 64
+			responses_per_second 10
+			nodata_per_second 5
+			nxdomains_per_second 5
+			referrals_per_second 5
+			errors_per_second 5
+			slip 0
+			leak 10
+			exempt 10.0.0.0/8 192.168.1.1 ::1
+			max_table_size 1000
+		}`, false},
+		{`rrl {
+			errors_per_second 1
+		}`, false},
+		// errors.
+		{`rrl`, true},
+		{`rrl {
+			responses_per_second
+		}`, true},
+		{`rrl {
+			responses_per_second -1
+		}`, true},
+		{`rrl {
+			responses_per_second 10
+			ipv4_prefix_length 33
+		}`, true},
+		{`rrl {
+			responses_per_second 10
+			exempt 10.0.0.0/33
+		}`, true},
+		{`rrl {
+			responses_per_second 10
+			bogus
+		}`, true},
+		{`rrl {
+			responses_per_second 10
+		}
+		rrl {
+			responses_per_second 10
+		}`, true},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		err := setup(c)
+		if tc.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error but got none", i)
+		}
+		if !tc.shouldErr && err != nil {
+			t.Errorf("Test %d: expected no error but got: %s", i, err)
+		}
+	}
+}
+
+func TestSetupDefaults(t *testing.T) {
+	c := caddy.NewTestController("dns", `rrl {
+		responses_per_second 10
+		nxdomains_per_second 2
+	}`)
+	r, err := parse(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.window != defaultWindow || r.slip != defaultSlip || r.ipv4Prefix != 24 || r.ipv6Prefix != 56 {
+		t.Errorf("Unexpected defaults: window %s, slip %d, prefixes %d/%d", r.window, r.slip, r.ipv4Prefix, r.ipv6Prefix)
+	}
+	if r.rates[catNodata] != 10 || r.rates[catNXDomain] != 2 {
+		t.Errorf("Expected nodata rate 10 and nxdomain rate 2, got %v", r.rates)
+	}
+	if r.window != 15*time.Second {
+		t.Errorf("Expected window of 15s, got %s", r.window)
+	}
+}
@@ -0,0 +1,71 @@
+package rrl
+
+import (
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/evict"
+)
+
+// key identifies a response tuple that is rate limited.
+type key struct {
+	prefix   string // Client network.
+	category category
+	name     string
+	qtype    uint16
+}
+
+// bucket is a token bucket, it holds the number of responses that can still be sent.
+type bucket struct {
+	tokens  float64
+	last    time.Time
+	limited int // Number of responses limited since the bucket last had tokens.
+}
+
+// table holds the buckets of all tracked response tuples.
+type table struct {
+	mu      sync.Mutex
+	buckets map[key]*bucket
+	max     int
+}
+
+func newTable(max int) *table {
+	return &table{buckets: make(map[key]*bucket), max: max}
+}
+
+// debit takes a token from the bucket of k, which is refilled with rate tokens per second up to
+// rate tokens. The bucket can go into debt for up to window seconds worth of tokens, so a client
+// that keeps sending stays limited. It returns true if the response may be sent, otherwise the
+// number of responses limited in a row is returned.
+func (t *table) debit(k key, rate float64, window time.Duration, now time.Time) (bool, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b, ok := t.buckets[k]
+	if !ok {
+		if len(t.buckets) >= t.max {
+			t.evict(window, now)
+		}
+		b = &bucket{tokens: rate, last: now}
+		t.buckets[k] = b
+	}
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(rate, b.tokens+elapsed*rate)
+	}
+	b.last = now
+	b.tokens = max(b.tokens-1, -rate*window.Seconds())
+
+	if b.tokens >= 0 {
+		b.limited = 0
+		return true, 0
+	}
+	b.limited++
+	return false, b.limited
+}
+
+// evict removes the buckets that have not been used for a window, these are full again. If that
+// doesn't free enough space, the least recently used half of the table is removed.
+func (t *table) evict(window time.Duration, now time.Time) {
+	evict.Table(t.buckets, func(b *bucket) time.Time { return b.last }, window, t.max, now)
+}
@@ -2,6 +2,7 @@ package secondary
 
 import (
 	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
@@ -165,6 +166,18 @@ func secondaryParse(c *caddy.Controller) (file.Zones, fall.F, map[string]plugin.
 					}
 				case "fallthrough":
 					fall.SetZonesFromArgs(c.RemainingArgs())
+				case "ixfr_history":
+					args := c.RemainingArgs()
+					if len(args) != 1 {
+						return file.Zones{}, fall, nil, c.ArgErr()
+					}
+					n, err := strconv.Atoi(args[0])
+					if err != nil || n < 0 {
+						return file.Zones{}, fall, nil, c.Errf("invalid ixfr_history value: %q", args[0])
+					}
+					for _, origin := range origins {
+						z[origin].SetHistorySize(n)
+					}
 				default:
 					return file.Zones{}, fall, nil, c.Errf("unknown property '%s'", c.Val())
 				}
@@ -113,6 +113,28 @@ func TestSecondaryParse(t *testing.T) {
 			fall.F{},
 			nil,
 		},
+		{
+			`secondary example.org {
+				transfer from 127.0.0.1
+				ixfr_history 50
+			}`,
+			false,
+			"127.0.0.1:53",
+			[]string{"example.org."},
+			fall.F{},
+			nil,
+		},
+		{
+			`secondary example.org {
+				transfer from 127.0.0.1
+				ixfr_history -1
+			}`,
+			true,
+			"",
+			nil,
+			fall.F{},
+			nil,
+		},
 		// fallthrough: bare (all zones)
 		{
 			`secondary {
@@ -57,8 +57,8 @@ func write(w io.Writer, z *file.Zone) error {
 
 // Parse parses the zone in filename and returns a new Zone or an error. This
 // is similar to the Parse function in the *file* plugin. However when parsing
-// the record types DNSKEY, RRSIG, CDNSKEY and CDS are *not* included in the returned
-// zone (if encountered).
+// the record types DNSKEY, RRSIG, CDNSKEY, CDS, NSEC, NSEC3 and NSEC3PARAM are *not*
+// included in the returned zone (if encountered).
 func Parse(f io.Reader, origin, fileName string) (*file.Zone, error) {
 	zp := dns.NewZoneParser(f, dns.Fqdn(origin), fileName)
 	zp.SetIncludeAllowed(true)
@@ -67,7 +67,7 @@ func Parse(f io.Reader, origin, fileName string) (*file.Zone, error) {
 
 	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
 		switch rr.(type) {
-		case *dns.DNSKEY, *dns.RRSIG, *dns.CDNSKEY, *dns.CDS:
+		case *dns.DNSKEY, *dns.RRSIG, *dns.CDNSKEY, *dns.CDS, *dns.NSEC, *dns.NSEC3, *dns.NSEC3PARAM:
 			continue
 		case *dns.SOA:
 			seenSOA = true
@@ -1,6 +1,7 @@
 package sign
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/rsa"
@@ -10,6 +11,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
@@ -23,12 +25,22 @@ type Pair struct {
 	Public  *dns.DNSKEY
 	KeyTag  uint16
 	Private crypto.Signer
+
+	// Timing metadata of the key, zero if not set. The key is in the DNSKEY RRset from Publish until Delete,
+	// and signs from Activate until Inactive.
+	Publish  time.Time
+	Activate time.Time
+	Inactive time.Time
+	Delete   time.Time
+
+	base string // path of the key files without the .key or .private extension.
 }
 
-// keyParse reads the public and private key from disk.
-func keyParse(c *caddy.Controller) ([]Pair, error) {
+// keyParse reads the public and private key from disk. For "directory" the directories are
+// returned, as the keys in them are read each time we sign.
+func keyParse(c *caddy.Controller) ([]Pair, []string, error) {
 	if !c.NextArg() {
-		return nil, c.ArgErr()
+		return nil, nil, c.ArgErr()
 	}
 	pairs := []Pair{}
 	config := dnsserver.GetConfig(c)
@@ -37,7 +49,7 @@ func keyParse(c *caddy.Controller) ([]Pair, error) {
 	case "file":
 		ks := c.RemainingArgs()
 		if len(ks) == 0 {
-			return nil, c.ArgErr()
+			return nil, nil, c.ArgErr()
 		}
 		for _, k := range ks {
 			base := k
@@ -54,14 +66,43 @@ func keyParse(c *caddy.Controller) ([]Pair, error) {
 
 			pair, err := readKeyPair(base+".key", base+".private")
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			pairs = append(pairs, pair)
 		}
 	case "directory":
-		return nil, fmt.Errorf("directory: not implemented")
+		dirs := c.RemainingArgs()
+		if len(dirs) == 0 {
+			return nil, nil, c.ArgErr()
+		}
+		for i := range dirs {
+			if !filepath.IsAbs(dirs[i]) && config.Root != "" {
+				dirs[i] = filepath.Join(config.Root, dirs[i])
+			}
+		}
+		return nil, dirs, nil
+	default:
+		return nil, nil, c.Errf("unknown key source '%s'", c.Val())
 	}
 
+	return pairs, nil, nil
+}
+
+// readKeyDir reads all key pairs for origin from dir, these are named K<origin>+<alg>+<id>.
+func readKeyDir(dir, origin string) ([]Pair, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "K"+origin+"+*.key"))
+	if err != nil {
+		return nil, err
+	}
+	pairs := []Pair{}
+	for _, f := range files {
+		base := f[:len(f)-4]
+		pair, err := readKeyPair(base+".key", base+".private")
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+	}
 	return pairs, nil
 }
 
@@ -81,31 +122,85 @@ func readKeyPair(public, private string) (Pair, error) {
 	if _, ok := dnskey.(*dns.DNSKEY); !ok {
 		return Pair{}, fmt.Errorf("RR in %q is not a DNSKEY: %d", public, dnskey.Header().Rrtype)
 	}
-	ksk := dnskey.(*dns.DNSKEY).Flags&(1<<8) == (1<<8) && dnskey.(*dns.DNSKEY).Flags&1 == 1
-	if !ksk {
-		return Pair{}, fmt.Errorf("DNSKEY in %q is not a CSK/KSK", public)
+	zone := dnskey.(*dns.DNSKEY).Flags&(1<<8) == (1 << 8)
+	if !zone {
+		return Pair{}, fmt.Errorf("DNSKEY in %q is not a zone key", public)
 	}
 
-	rp, err := os.Open(filepath.Clean(private))
+	bp, err := os.ReadFile(filepath.Clean(private))
 	if err != nil {
 		return Pair{}, err
 	}
-	privkey, err := dnskey.(*dns.DNSKEY).ReadPrivateKey(rp, private)
+	privkey, err := dnskey.(*dns.DNSKEY).ReadPrivateKey(bytes.NewReader(bp), private)
 	if err != nil {
 		return Pair{}, err
 	}
+	pair := Pair{Public: dnskey.(*dns.DNSKEY), KeyTag: dnskey.(*dns.DNSKEY).KeyTag(), base: strings.TrimSuffix(public, ".key")}
 	switch signer := privkey.(type) {
 	case *ecdsa.PrivateKey:
-		return Pair{Public: dnskey.(*dns.DNSKEY), KeyTag: dnskey.(*dns.DNSKEY).KeyTag(), Private: signer}, nil
+		pair.Private = signer
 	case ed25519.PrivateKey:
-		return Pair{Public: dnskey.(*dns.DNSKEY), KeyTag: dnskey.(*dns.DNSKEY).KeyTag(), Private: signer}, nil
+		pair.Private = signer
 	case *rsa.PrivateKey:
-		return Pair{Public: dnskey.(*dns.DNSKEY), KeyTag: dnskey.(*dns.DNSKEY).KeyTag(), Private: signer}, nil
+		pair.Private = signer
 	default:
 		return Pair{}, fmt.Errorf("unsupported algorithm %s", signer)
 	}
+	if err := pair.readTiming(bp); err != nil {
+		return Pair{}, fmt.Errorf("%q: %s", private, err)
+	}
+	return pair, nil
 }
 
+// readTiming reads the timing metadata, as written by dnssec-keygen, from the private key file.
+func (p *Pair) readTiming(private []byte) error {
+	for line := range strings.Lines(string(private)) {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		var t *time.Time
+		switch key {
+		case "Publish":
+			t = &p.Publish
+		case "Activate":
+			t = &p.Activate
+		case "Inactive":
+			t = &p.Inactive
+		case "Delete":
+			t = &p.Delete
+		default:
+			continue
+		}
+		x, err := time.Parse(timingFmt, strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid %s time: %s", key, err)
+		}
+		*t = x
+	}
+	return nil
+}
+
+// isKSK returns true if the SEP bit is set, these keys sign the DNSKEY RRset.
+func (p Pair) isKSK() bool { return p.Public.Flags&1 == 1 }
+
+// published returns true if the key is in the DNSKEY RRset at time now.
+func (p Pair) published(now time.Time) bool {
+	publish := p.Publish
+	if publish.IsZero() || !p.Activate.IsZero() && p.Activate.Before(publish) {
+		publish = p.Activate
+	}
+	return !now.Before(publish) && (p.Delete.IsZero() || now.Before(p.Delete))
+}
+
+// active returns true if the key signs at time now.
+func (p Pair) active(now time.Time) bool {
+	return p.published(now) && !now.Before(p.Activate) && (p.Inactive.IsZero() || now.Before(p.Inactive))
+}
+
+// timingFmt is the format of the timing metadata in key files.
+const timingFmt = "20060102150405"
+
 // keyTag returns the key tags of the keys in ps as a formatted string.
 func keyTag(ps []Pair) string {
 	if len(ps) == 0 {
@@ -0,0 +1,110 @@
+package sign
+
+import (
+	"bytes"
+	"encoding/base32"
+	"slices"
+	"strings"
+
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/file/tree"
+
+	"github.com/miekg/dns"
+)
+
+// nsec3Param holds the parameters for the NSEC3 chain.
+type nsec3Param struct {
+	iterations uint16
+	salt       string // hex encoded, empty for no salt
+}
+
+var b32 = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// chain adds the NSEC3PARAM record and the NSEC3 chain to z. Every authoritative name, and every empty
+// non-terminal above those, gets an NSEC3 record. The TTL of these is ttl, the NSEC3PARAM has a TTL of 0.
+func (p *nsec3Param) chain(z *file.Zone, origin string, ttl uint32) error {
+	type hashed struct {
+		hash   []byte
+		bitmap []uint16
+	}
+	var (
+		chain []hashed
+		seen  = map[string]bool{}
+		ents  []string
+	)
+
+	err := z.AuthWalk(func(e *tree.Elem, _ map[uint16][]dns.RR, auth bool) error {
+		if !auth {
+			return nil
+		}
+		name := e.Name()
+		seen[name] = true
+
+		types := e.Types()
+		switch {
+		case name == origin:
+			// NS and SOA are kept separately in the zone.
+			types = append(types, dns.TypeNS, dns.TypeSOA, dns.TypeRRSIG, dns.TypeNSEC3PARAM)
+		case e.Type(dns.TypeNS) != nil:
+			// An (unsigned) delegation only has a signature if it has a DS.
+			if e.Type(dns.TypeDS) != nil {
+				types = append(types, dns.TypeRRSIG)
+			}
+		default:
+			types = append(types, dns.TypeRRSIG)
+		}
+		chain = append(chain, hashed{p.hash(name), types})
+
+		for offset, end := dns.NextLabel(name, 0); !end && name != origin; offset, end = dns.NextLabel(name, 0) {
+			name = name[offset:]
+			if dns.IsSubDomain(origin, name) && name != origin {
+				ents = append(ents, name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range ents {
+		if !seen[name] {
+			seen[name] = true
+			chain = append(chain, hashed{p.hash(name), nil})
+		}
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+
+	slices.SortFunc(chain, func(a, b hashed) int { return bytes.Compare(a.hash, b.hash) })
+	for i, h := range chain {
+		slices.Sort(h.bitmap)
+		next := chain[(i+1)%len(chain)].hash
+		nsec3 := &dns.NSEC3{
+			Hdr:        dns.RR_Header{Name: strings.ToLower(b32.EncodeToString(h.hash)) + "." + origin, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: ttl},
+			Hash:       dns.SHA1,
+			Iterations: p.iterations,
+			SaltLength: uint8(len(p.salt) / 2), // #nosec G115 -- salt length is checked during setup
+			Salt:       p.salt,
+			HashLength: uint8(len(next)), // #nosec G115 -- a SHA1 hash is 20 bytes
+			NextDomain: b32.EncodeToString(next),
+			TypeBitMap: slices.Compact(h.bitmap),
+		}
+		if err := z.Insert(nsec3); err != nil {
+			return err
+		}
+	}
+
+	return z.Insert(&dns.NSEC3PARAM{
+		Hdr:        dns.RR_Header{Name: origin, Rrtype: dns.TypeNSEC3PARAM, Class: dns.ClassINET, Ttl: 0},
+		Hash:       dns.SHA1,
+		Iterations: p.iterations,
+		SaltLength: uint8(len(p.salt) / 2), // #nosec G115 -- salt length is checked during setup
+		Salt:       p.salt,
+	})
+}
+
+func (p *nsec3Param) hash(name string) []byte {
+	h, _ := b32.DecodeString(dns.HashName(name, dns.SHA1, p.iterations, p.salt))
+	return h
+}
@@ -0,0 +1,106 @@
+package sign
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/file/tree"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+func TestSignNSEC3(t *testing.T) {
+	input := `sign testdata/db.miek.nl miek.nl {
+		key file testdata/Kmiek.nl.+013+59725
+		directory testdata
+		nsec3 1 aabbccdd
+	}`
+	c := caddy.NewTestController("dns", input)
+	sign, err := parse(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z, err := sign.signers[0].Sign(time.Now().UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apex, _ := z.Search("miek.nl.")
+	if x := apex.Type(dns.TypeNSEC3PARAM); len(x) != 1 {
+		t.Fatalf("Expected 1 NSEC3PARAM record, got %d", len(x))
+	}
+	nsec3, nsec := 0, 0
+	z.Walk(func(e *tree.Elem, _ map[uint16][]dns.RR) error {
+		nsec3 += len(e.Type(dns.TypeNSEC3))
+		nsec += len(e.Type(dns.TypeNSEC))
+		return nil
+	})
+	// miek.nl., a, www, bla, ns3.blaaat and the empty non-terminal blaaat.
+	if nsec3 != 6 {
+		t.Errorf("Expected %d NSEC3 records, got %d", 6, nsec3)
+	}
+	if nsec != 0 {
+		t.Errorf("Expected %d NSEC records, got %d", 0, nsec)
+	}
+
+	tests := []struct {
+		qname string
+		qtype uint16
+		rcode int
+		match []string // names that must be matched by a NSEC3
+		cover []string // names that must be covered by a NSEC3
+	}{
+		{"x.miek.nl.", dns.TypeA, dns.RcodeNameError, []string{"miek.nl."}, []string{"x.miek.nl.", "*.miek.nl."}},
+		{"y.blaaat.miek.nl.", dns.TypeA, dns.RcodeNameError, []string{"blaaat.miek.nl."}, []string{"y.blaaat.miek.nl.", "*.blaaat.miek.nl."}},
+		{"a.miek.nl.", dns.TypeMX, dns.RcodeSuccess, []string{"a.miek.nl."}, nil},
+		{"blaaat.miek.nl.", dns.TypeA, dns.RcodeSuccess, []string{"blaaat.miek.nl."}, nil},
+	}
+	for _, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		m.SetEdns0(4096, true)
+		state := request.Request{Req: m, W: &test.ResponseWriter{}}
+		_, ns, _, result := z.Lookup(context.TODO(), state, tc.qname)
+		if rcode := rcodeFromResult(result); rcode != tc.rcode {
+			t.Errorf("%s/%d: expected rcode %d, got %d", tc.qname, tc.qtype, tc.rcode, rcode)
+		}
+
+		var nsec3s []*dns.NSEC3
+		for _, rr := range ns {
+			if x, ok := rr.(*dns.NSEC3); ok {
+				nsec3s = append(nsec3s, x)
+			}
+		}
+		for _, name := range tc.match {
+			if !slices.ContainsFunc(nsec3s, func(n *dns.NSEC3) bool { return n.Match(name) }) {
+				t.Errorf("%s/%d: expected NSEC3 matching %s", tc.qname, tc.qtype, name)
+			}
+		}
+		for _, name := range tc.cover {
+			if !slices.ContainsFunc(nsec3s, func(n *dns.NSEC3) bool { return n.Cover(name) }) {
+				t.Errorf("%s/%d: expected NSEC3 covering %s", tc.qname, tc.qtype, name)
+			}
+		}
+		for _, n := range nsec3s {
+			if !slices.ContainsFunc(ns, func(rr dns.RR) bool {
+				sig, ok := rr.(*dns.RRSIG)
+				return ok && sig.TypeCovered == dns.TypeNSEC3 && sig.Hdr.Name == n.Hdr.Name
+			}) {
+				t.Errorf("%s/%d: expected signature for %s", tc.qname, tc.qtype, n.Hdr.Name)
+			}
+		}
+	}
+}
+
+func rcodeFromResult(r file.Result) int {
+	if r == file.NameError {
+		return dns.RcodeNameError
+	}
+	return dns.RcodeSuccess
+}
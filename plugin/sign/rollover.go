@@ -0,0 +1,346 @@
+package sign
+
+import (
+	"crypto"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// readKeys returns all keys of the zone: the ones given as files and the ones found in the key directories.
+func (s *Signer) readKeys() ([]Pair, error) {
+	keys := slices.Clone(s.keys)
+	for _, dir := range s.keydirs {
+		pairs, err := readKeyDir(dir, s.origin)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, pairs...)
+	}
+	return keys, nil
+}
+
+// signingKeys returns the keys that should be published in the DNSKEY RRset at time now, the
+// active KSKs that sign the DNSKEY RRset and the active ZSKs that sign everything else. Without
+// active ZSKs, the KSKs sign the whole zone, i.e. they are used as CSKs.
+func signingKeys(keys []Pair, now time.Time) (dnskeys, ksks, zsks []Pair) {
+	for _, k := range keys {
+		if !k.published(now) {
+			continue
+		}
+		dnskeys = append(dnskeys, k)
+		if !k.active(now) {
+			continue
+		}
+		if k.isKSK() {
+			ksks = append(ksks, k)
+		} else {
+			zsks = append(zsks, k)
+		}
+	}
+	if len(zsks) == 0 {
+		zsks = ksks
+	}
+	return dnskeys, ksks, zsks
+}
+
+// keyEvent returns an error describing the first key timing event that happened after since, and
+// before or at now. If the zone was signed before such an event, it must be signed again.
+func keyEvent(keys []Pair, since, now time.Time) error {
+	for _, k := range keys {
+		for _, e := range []struct {
+			what string
+			t    time.Time
+		}{{"published", k.Publish}, {"activated", k.Activate}, {"inactivated", k.Inactive}, {"deleted", k.Delete}} {
+			if e.t.After(since) && !e.t.After(now) {
+				return fmt.Errorf("key %d was %s at %s", k.KeyTag, e.what, e.t.Format(timeFmt))
+			}
+		}
+	}
+	return nil
+}
+
+// rollover makes sure there are keys for the roles that have a lifetime set. When the newest key
+// of a role is about to reach the end of its lifetime a successor is generated in the (first) key
+// directory.
+//
+// A ZSK is rolled with the pre-publish method: the successor is published durationPrepublish before
+// it becomes active, and the current ZSK is retired at that time. A KSK is rolled with the double
+// signature method: the successor is published and signs the DNSKEY RRset right away. The CDS and
+// CDNSKEY records of both are published in the meantime, to let the parent pick up the new DS. The
+// current KSK is only retired after the DS of the successor is seen at the parent, see retireKSKs.
+//
+// Rollover returns the key tags of the generated keys.
+func (s *Signer) rollover(now time.Time) ([]uint16, error) {
+	if s.kskLifetime == 0 && s.zskLifetime == 0 {
+		return nil, nil
+	}
+	keys, err := s.readKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []uint16
+	for _, role := range []struct {
+		ksk      bool
+		lifetime time.Duration
+	}{{true, s.kskLifetime}, {false, s.zskLifetime}} {
+		if role.lifetime == 0 {
+			continue
+		}
+		var newest *Pair
+		for i, k := range keys {
+			if k.isKSK() != role.ksk || !k.Delete.IsZero() && !now.Before(k.Delete) {
+				continue
+			}
+			if newest == nil || k.Activate.After(newest.Activate) {
+				newest = &keys[i]
+			}
+		}
+
+		if newest != nil && role.ksk {
+			if err := s.retireKSKs(keys, *newest, now); err != nil {
+				log.Warningf("Error retiring key-signing keys for %q: %s", s.origin, err)
+			}
+		}
+
+		if newest == nil {
+			k, err := s.generateKey(role.ksk, algorithm(keys), now, now)
+			if err != nil {
+				return tags, err
+			}
+			keys = append(keys, k)
+			tags = append(tags, k.KeyTag)
+			continue
+		}
+
+		end := newest.Inactive
+		if end.IsZero() {
+			end = newest.Activate.Add(role.lifetime)
+		}
+		if now.Before(end.Add(-durationPrepublish)) {
+			continue
+		}
+
+		inactive := end
+		if earliest := now.Add(durationPrepublish); inactive.Before(earliest) {
+			inactive = earliest
+		}
+		if role.ksk {
+			k, err := s.generateKey(true, newest.Public.Algorithm, now, now)
+			if err != nil {
+				return tags, err
+			}
+			tags = append(tags, k.KeyTag)
+			keys = append(keys, k)
+			continue
+		}
+		k, err := s.generateKey(false, newest.Public.Algorithm, now, inactive)
+		if err != nil {
+			return tags, err
+		}
+		tags = append(tags, k.KeyTag)
+
+		newest.Inactive = inactive
+		newest.Delete = inactive.Add(durationRetire)
+		if err := newest.writeTiming(); err != nil {
+			return tags, err
+		}
+		keys = append(keys, k)
+	}
+	return tags, nil
+}
+
+// retireKSKs retires the active KSKs that are older than newest and have no Inactive time, once the
+// parent publishes the DS of newest. Until then they keep signing, so the zone stays valid for
+// resolvers that only know the DS of an old KSK. The DS is looked up at the servers from
+// `parent_ds`; without them the old KSKs are held until the operator sets their Inactive time.
+// A retired KSK stops signing durationPrepublish later, to let the old DS RRset expire from caches.
+func (s *Signer) retireKSKs(keys []Pair, newest Pair, now time.Time) error {
+	if !newest.active(now) {
+		return nil
+	}
+	var old []Pair
+	for _, k := range keys {
+		if k.isKSK() && k.KeyTag != newest.KeyTag && k.active(now) && k.Inactive.IsZero() {
+			old = append(old, k)
+		}
+	}
+	if len(old) == 0 {
+		return nil
+	}
+
+	if len(s.dsServers) == 0 {
+		log.Infof("Holding key-signing keys %s for %q, set their Inactive time once the parent publishes the DS of key %d", keyTag(old), s.origin, newest.KeyTag)
+		return nil
+	}
+	ok, err := s.parentDS(newest)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		log.Infof("Holding key-signing keys %s for %q, until the parent publishes the DS of key %d", keyTag(old), s.origin, newest.KeyTag)
+		return nil
+	}
+
+	inactive := now.Add(durationPrepublish).UTC().Truncate(time.Second)
+	for _, k := range old {
+		k.Inactive = inactive
+		k.Delete = inactive.Add(durationRetire)
+		if err := k.writeTiming(); err != nil {
+			return err
+		}
+		log.Infof("Parent publishes the DS of key %d for %q, key-signing key %d becomes inactive at %s", newest.KeyTag, s.origin, k.KeyTag, inactive.Format(timeFmt))
+	}
+	return nil
+}
+
+// parentDS returns true if the DS RRset of the zone, looked up at the servers from `parent_ds`, holds
+// a DS for key k. The servers are tried in order until one of them replies.
+func (s *Signer) parentDS(k Pair) (bool, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(s.origin, dns.TypeDS)
+
+	var err error
+	for _, server := range s.dsServers {
+		var r *dns.Msg
+		r, err = dns.Exchange(m, server)
+		if err != nil {
+			continue
+		}
+		if r.Rcode != dns.RcodeSuccess {
+			err = fmt.Errorf("%s replied with %s to the DS query", server, dns.RcodeToString[r.Rcode])
+			continue
+		}
+		for _, rr := range r.Answer {
+			ds, ok := rr.(*dns.DS)
+			if !ok {
+				continue
+			}
+			if x := k.Public.ToDS(ds.DigestType); x != nil && x.KeyTag == ds.KeyTag && strings.EqualFold(x.Digest, ds.Digest) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, err
+}
+
+// algorithm returns the algorithm of the newest key, or ECDSAP256SHA256 if there are none.
+func algorithm(keys []Pair) uint8 {
+	alg := uint8(dns.ECDSAP256SHA256)
+	var activate time.Time
+	for _, k := range keys {
+		if k.Activate.After(activate) || activate.IsZero() {
+			alg, activate = k.Public.Algorithm, k.Activate
+		}
+	}
+	return alg
+}
+
+// generateKey generates a new key and writes it to the first key directory.
+func (s *Signer) generateKey(ksk bool, alg uint8, publish, activate time.Time) (Pair, error) {
+	if len(s.keydirs) == 0 {
+		return Pair{}, fmt.Errorf("no key directory to write generated keys to")
+	}
+	bits, ok := keySize[alg]
+	if !ok {
+		return Pair{}, fmt.Errorf("can not generate keys for algorithm %s", dns.AlgorithmToString[alg])
+	}
+
+	flags := uint16(256)
+	if ksk {
+		flags = 257
+	}
+	dnskey := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: s.origin, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     flags,
+		Protocol:  3,
+		Algorithm: alg,
+	}
+	priv, err := dnskey.Generate(bits)
+	if err != nil {
+		return Pair{}, err
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return Pair{}, fmt.Errorf("unsupported algorithm %s", dns.AlgorithmToString[alg])
+	}
+
+	pair := Pair{
+		Public:   dnskey,
+		KeyTag:   dnskey.KeyTag(),
+		Private:  signer,
+		Publish:  publish.UTC().Truncate(time.Second),
+		Activate: activate.UTC().Truncate(time.Second),
+		base:     filepath.Join(s.keydirs[0], fmt.Sprintf("K%s+%03d+%05d", s.origin, alg, dnskey.KeyTag())),
+	}
+
+	kind := "zone-signing"
+	if ksk {
+		kind = "key-signing"
+	}
+	public := fmt.Sprintf("; This is a %s key, keyid %d, for %s\n; Created: %s\n%s\n", kind, pair.KeyTag, s.origin, publish.UTC().Format(timingFmt), dnskey)
+	if err := os.WriteFile(pair.base+".key", []byte(public), 0644); err != nil { // #nosec G306 -- public key
+		return Pair{}, err
+	}
+	if err := os.WriteFile(pair.base+".private", []byte(dnskey.PrivateKeyString(priv)), 0600); err != nil {
+		return Pair{}, err
+	}
+	if err := pair.writeTiming(); err != nil {
+		return Pair{}, err
+	}
+
+	log.Infof("Generated %s key %d for %q, publish at %s, activate at %s", kind, pair.KeyTag, s.origin, pair.Publish.Format(timeFmt), pair.Activate.Format(timeFmt))
+	return pair, nil
+}
+
+// writeTiming (re)writes the timing metadata in the private key file of p.
+func (p Pair) writeTiming() error {
+	if p.base == "" {
+		return fmt.Errorf("key %d has no key file", p.KeyTag)
+	}
+	private := p.base + ".private"
+	buf, err := os.ReadFile(filepath.Clean(private))
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	for line := range strings.Lines(string(buf)) {
+		key, _, _ := strings.Cut(line, ":")
+		switch key {
+		case "Publish", "Activate", "Inactive", "Delete":
+			continue
+		}
+		sb.WriteString(line)
+	}
+	for _, e := range []struct {
+		key string
+		t   time.Time
+	}{{"Publish", p.Publish}, {"Activate", p.Activate}, {"Inactive", p.Inactive}, {"Delete", p.Delete}} {
+		if !e.t.IsZero() {
+			fmt.Fprintf(&sb, "%s: %s\n", e.key, e.t.UTC().Format(timingFmt))
+		}
+	}
+
+	tmp := private + ".tmp"
+	if err := os.WriteFile(tmp, []byte(sb.String()), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, private)
+}
+
+// keySize holds the key sizes used when generating keys.
+var keySize = map[uint8]int{
+	dns.RSASHA256:       2048,
+	dns.RSASHA512:       2048,
+	dns.ECDSAP256SHA256: 256,
+	dns.ECDSAP384SHA384: 384,
+	dns.ED25519:         256,
+}
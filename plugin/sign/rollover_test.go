@@ -0,0 +1,201 @@
+package sign
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+
+	"github.com/miekg/dns"
+)
+
+func TestRollover(t *testing.T) {
+	dir := t.TempDir()
+	s := &Signer{
+		origin:      "miek.nl.",
+		dbfile:      "testdata/db.miek.nl",
+		keydirs:     []string{dir},
+		kskLifetime: 365 * 24 * time.Hour,
+		zskLifetime: 30 * 24 * time.Hour,
+	}
+	day := 24 * time.Hour
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// No keys yet, a KSK and a ZSK are generated.
+	tags, err := s.rollover(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 {
+		t.Fatalf("Expected %d generated keys, got %d", 2, len(tags))
+	}
+	keys, err := s.readKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dnskeys, ksks, zsks := signingKeys(keys, now)
+	if len(dnskeys) != 2 || len(ksks) != 1 || len(zsks) != 1 {
+		t.Fatalf("Expected 2 published keys, 1 KSK and 1 ZSK, got %d, %d and %d", len(dnskeys), len(ksks), len(zsks))
+	}
+	zsk := zsks[0]
+
+	// Signing uses the ZSK for the zone data and the KSK for the DNSKEY RRset.
+	z, err := s.Sign(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apex, _ := z.Search("miek.nl.")
+	if x := apex.Type(dns.TypeDNSKEY); len(x) != 2 {
+		t.Errorf("Expected %d DNSKEY records, got %d", 2, len(x))
+	}
+	if x := apex.Type(dns.TypeCDNSKEY); len(x) != 1 {
+		t.Errorf("Expected %d CDNSKEY record, got %d", 1, len(x))
+	}
+	for _, rr := range apex.Type(dns.TypeRRSIG) {
+		sig := rr.(*dns.RRSIG)
+		expected := zsk.KeyTag
+		if sig.TypeCovered == dns.TypeDNSKEY || sig.TypeCovered == dns.TypeCDS || sig.TypeCovered == dns.TypeCDNSKEY {
+			expected = ksks[0].KeyTag
+		}
+		if sig.KeyTag != expected {
+			t.Errorf("Expected RRSIG for %s to be made with key %d, got %d", dns.TypeToString[sig.TypeCovered], expected, sig.KeyTag)
+		}
+	}
+
+	// Nothing to do half way through the ZSK lifetime.
+	if tags, _ := s.rollover(now.Add(15 * day)); len(tags) != 0 {
+		t.Fatalf("Expected no generated keys, got %d", len(tags))
+	}
+
+	// Within the pre-publish interval of the end of the ZSK lifetime a successor is generated.
+	roll := now.Add(24 * day)
+	tags, err = s.rollover(roll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 {
+		t.Fatalf("Expected %d generated key, got %d", 1, len(tags))
+	}
+	keys, _ = s.readKeys()
+	var old, successor Pair
+	for _, k := range keys {
+		switch k.KeyTag {
+		case zsk.KeyTag:
+			old = k
+		case tags[0]:
+			successor = k
+		}
+	}
+	activate := roll.Add(durationPrepublish)
+	if !successor.Publish.Equal(roll) || !successor.Activate.Equal(activate) || successor.isKSK() {
+		t.Errorf("Expected ZSK published at %s and active at %s, got %s and %s", roll, activate, successor.Publish, successor.Activate)
+	}
+	if !old.Inactive.Equal(activate) || !old.Delete.Equal(activate.Add(durationRetire)) {
+		t.Errorf("Expected old ZSK inactive at %s and deleted at %s, got %s and %s", activate, activate.Add(durationRetire), old.Inactive, old.Delete)
+	}
+
+	// The successor is published but not used, until it becomes active.
+	_, _, zsks = signingKeys(keys, roll.Add(day))
+	if len(zsks) != 1 || zsks[0].KeyTag != zsk.KeyTag {
+		t.Errorf("Expected ZSK %d to be used, got %v", zsk.KeyTag, keyTag(zsks))
+	}
+	dnskeys, _, zsks = signingKeys(keys, activate)
+	if len(dnskeys) != 3 || len(zsks) != 1 || zsks[0].KeyTag != successor.KeyTag {
+		t.Errorf("Expected 3 published keys and ZSK %d to be used, got %d and %v", successor.KeyTag, len(dnskeys), keyTag(zsks))
+	}
+	dnskeys, _, _ = signingKeys(keys, old.Delete)
+	if len(dnskeys) != 2 {
+		t.Errorf("Expected %d published keys, got %d", 2, len(dnskeys))
+	}
+
+	// A second rollover isn't started for the successor.
+	if tags, _ := s.rollover(roll.Add(day)); len(tags) != 0 {
+		t.Fatalf("Expected no generated keys, got %d", len(tags))
+	}
+
+	if err := keyEvent(keys, roll.Add(day), activate.Add(-time.Second)); err != nil {
+		t.Errorf("Expected no key event, got %s", err)
+	}
+	if err := keyEvent(keys, roll.Add(day), activate); err == nil {
+		t.Errorf("Expected key event for the activation of %d", successor.KeyTag)
+	}
+}
+
+func TestRolloverKSK(t *testing.T) {
+	dir := t.TempDir()
+	s := &Signer{origin: "miek.nl.", keydirs: []string{dir}, kskLifetime: 365 * 24 * time.Hour}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := s.rollover(now); err != nil {
+		t.Fatal(err)
+	}
+	roll := now.Add(360 * 24 * time.Hour)
+	tags, err := s.rollover(roll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 {
+		t.Fatalf("Expected %d generated key, got %d", 1, len(tags))
+	}
+	keys, _ := s.readKeys()
+	var successor Pair
+	for _, k := range keys {
+		if k.KeyTag == tags[0] {
+			successor = k
+		}
+	}
+
+	// Double signature: both KSKs sign the DNSKEY RRset, and act as CSKs as there are no ZSKs.
+	dnskeys, ksks, zsks := signingKeys(keys, roll)
+	if len(dnskeys) != 2 || len(ksks) != 2 || len(zsks) != 2 {
+		t.Errorf("Expected 2 published and 2 active keys, got %d and %d", len(dnskeys), len(ksks))
+	}
+
+	// Without parent_ds the old KSK is held until its Inactive time is set by hand.
+	later := roll.Add(2 * durationPrepublish)
+	if _, err := s.rollover(later); err != nil {
+		t.Fatal(err)
+	}
+	keys, _ = s.readKeys()
+	if _, ksks, _ = signingKeys(keys, later); len(ksks) != 2 {
+		t.Errorf("Expected %d active KSKs, got %d", 2, len(ksks))
+	}
+
+	// The old KSK is held until the parent publishes the DS of the successor.
+	var published atomic.Bool
+	srv := dnstest.NewServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if published.Load() {
+			m.Answer = append(m.Answer, successor.Public.ToDS(dns.SHA256))
+		}
+		w.WriteMsg(m)
+	})
+	defer srv.Close()
+	s.dsServers = []string{srv.Addr}
+
+	if _, err := s.rollover(later); err != nil {
+		t.Fatal(err)
+	}
+	keys, _ = s.readKeys()
+	if _, ksks, _ = signingKeys(keys, later.Add(durationPrepublish)); len(ksks) != 2 {
+		t.Errorf("Expected %d active KSKs, got %d", 2, len(ksks))
+	}
+
+	published.Store(true)
+	if _, err := s.rollover(later); err != nil {
+		t.Fatal(err)
+	}
+	keys, _ = s.readKeys()
+	if _, ksks, _ = signingKeys(keys, later.Add(durationPrepublish).Add(-time.Second)); len(ksks) != 2 {
+		t.Errorf("Expected %d active KSKs, got %d", 2, len(ksks))
+	}
+	_, ksks, _ = signingKeys(keys, later.Add(durationPrepublish))
+	if len(ksks) != 1 || ksks[0].KeyTag != successor.KeyTag {
+		t.Errorf("Expected KSK %d to be active, got %v", successor.KeyTag, keyTag(ksks))
+	}
+	if dnskeys, _, _ = signingKeys(keys, later.Add(durationPrepublish+durationRetire)); len(dnskeys) != 1 {
+		t.Errorf("Expected %d published key, got %d", 1, len(dnskeys))
+	}
+}
@@ -1,15 +1,18 @@
 package sign
 
 import (
+	"encoding/hex"
 	"fmt"
 	"math/rand"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	pkgparse "github.com/coredns/coredns/plugin/pkg/parse"
 )
 
 func init() { plugin.Register("sign", setup) }
@@ -73,7 +76,7 @@ func parse(c *caddy.Controller) (*Sign, error) {
 		for c.NextBlock() {
 			switch c.Val() {
 			case "key":
-				pairs, err := keyParse(c)
+				pairs, dirs, err := keyParse(c)
 				if err != nil {
 					return sign, err
 				}
@@ -82,6 +85,7 @@ func parse(c *caddy.Controller) (*Sign, error) {
 						p.Public.Header().Name = signers[i].origin
 					}
 					signers[i].keys = append(signers[i].keys, pairs...)
+					signers[i].keydirs = append(signers[i].keydirs, dirs...)
 				}
 			case "directory":
 				dir := c.RemainingArgs()
@@ -95,12 +99,108 @@ func parse(c *caddy.Controller) (*Sign, error) {
 					signers[i].directory = dir[0]
 					signers[i].signedfile = fmt.Sprintf("db.%ssigned", signers[i].origin)
 				}
+			case "nsec3":
+				p, err := nsec3Parse(c)
+				if err != nil {
+					return sign, err
+				}
+				for i := range signers {
+					signers[i].nsec3 = p
+				}
+			case "ksk_lifetime", "zsk_lifetime":
+				what := c.Val()
+				if !c.NextArg() {
+					return sign, c.ArgErr()
+				}
+				d, err := parseLifetime(c.Val())
+				if err != nil {
+					return sign, c.Errf("invalid %s %q: %s", what, c.Val(), err)
+				}
+				if c.NextArg() {
+					return sign, c.ArgErr()
+				}
+				for i := range signers {
+					if what == "ksk_lifetime" {
+						signers[i].kskLifetime = d
+					} else {
+						signers[i].zskLifetime = d
+					}
+				}
+			case "parent_ds":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return sign, c.ArgErr()
+				}
+				servers, err := pkgparse.HostPortOrFile(args...)
+				if err != nil {
+					return sign, err
+				}
+				for i := range signers {
+					signers[i].dsServers = servers
+				}
 			default:
 				return nil, c.Errf("unknown property '%s'", c.Val())
 			}
 		}
+		for i := range signers {
+			if (signers[i].kskLifetime > 0 || signers[i].zskLifetime > 0) && len(signers[i].keydirs) == 0 {
+				return sign, fmt.Errorf("key rollover for %q needs a key directory", signers[i].origin)
+			}
+		}
 		sign.signers = append(sign.signers, signers...)
 	}
 
 	return sign, nil
 }
+
+// nsec3Parse parses: nsec3 [ITERATIONS [SALT]].
+func nsec3Parse(c *caddy.Controller) (*nsec3Param, error) {
+	p := &nsec3Param{}
+	args := c.RemainingArgs()
+	if len(args) > 2 {
+		return nil, c.ArgErr()
+	}
+	if len(args) > 0 {
+		i, err := strconv.ParseUint(args[0], 10, 16)
+		if err != nil {
+			return nil, c.Errf("invalid NSEC3 iterations %q: %s", args[0], err)
+		}
+		if i > maxIterations {
+			return nil, c.Errf("NSEC3 iterations %d exceeds the maximum of %d", i, maxIterations)
+		}
+		p.iterations = uint16(i)
+	}
+	if len(args) > 1 && args[1] != "-" {
+		salt, err := hex.DecodeString(args[1])
+		if err != nil || len(salt) > 255 {
+			return nil, c.Errf("invalid NSEC3 salt %q", args[1])
+		}
+		p.salt = strings.ToUpper(args[1])
+	}
+	return p, nil
+}
+
+// parseLifetime parses a Go duration, with the extra unit "d" for days.
+func parseLifetime(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		d, err := strconv.ParseUint(days, 10, 16)
+		if err != nil {
+			return 0, err
+		}
+		if d == 0 {
+			return 0, fmt.Errorf("must be positive")
+		}
+		return time.Duration(d) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return d, nil
+}
+
+// maxIterations is the maximum number of extra NSEC3 iterations, see RFC 9276.
+const maxIterations = 100
@@ -2,6 +2,7 @@ package sign
 
 import (
 	"testing"
+	"time"
 
 	"github.com/coredns/caddy"
 )
@@ -84,3 +85,75 @@ func TestParseRejectsInvalidDbfileToken(t *testing.T) {
 		t.Fatalf("expected parse to fail for invalid dbfile token")
 	}
 }
+
+func TestParseNSEC3AndRollover(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		nsec3     *nsec3Param
+		ksk, zsk  time.Duration
+	}{
+		{`sign testdata/db.miek.nl miek.nl {
+			key file testdata/Kmiek.nl.+013+59725
+			nsec3
+		}`, false, &nsec3Param{}, 0, 0},
+		{`sign testdata/db.miek.nl miek.nl {
+			key file testdata/Kmiek.nl.+013+59725
+			nsec3 5 aabb
+		}`, false, &nsec3Param{iterations: 5, salt: "AABB"}, 0, 0},
+		{`sign testdata/db.miek.nl miek.nl {
+			key directory testdata
+			ksk_lifetime 365d
+			zsk_lifetime 720h
+		}`, false, nil, 365 * 24 * time.Hour, 720 * time.Hour},
+		{`sign testdata/db.miek.nl miek.nl {
+			key directory testdata
+			ksk_lifetime 365d
+			parent_ds 192.0.2.1 192.0.2.2:5353
+		}`, false, nil, 365 * 24 * time.Hour, 0},
+		// errors
+		{`sign testdata/db.miek.nl miek.nl {
+			key directory testdata
+			parent_ds
+		}`, true, nil, 0, 0},
+		{`sign testdata/db.miek.nl miek.nl {
+			key file testdata/Kmiek.nl.+013+59725
+			nsec3 101
+		}`, true, nil, 0, 0},
+		{`sign testdata/db.miek.nl miek.nl {
+			key file testdata/Kmiek.nl.+013+59725
+			nsec3 1 salt
+		}`, true, nil, 0, 0},
+		{`sign testdata/db.miek.nl miek.nl {
+			key file testdata/Kmiek.nl.+013+59725
+			zsk_lifetime 30d
+		}`, true, nil, 0, 0},
+		{`sign testdata/db.miek.nl miek.nl {
+			key directory testdata
+			zsk_lifetime 0d
+		}`, true, nil, 0, 0},
+		{`sign testdata/db.miek.nl miek.nl {
+			key ldap testdata
+		}`, true, nil, 0, 0},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		sign, err := parse(c)
+		if err == nil && tc.shouldErr {
+			t.Fatalf("Test %d expected errors, but got no error", i)
+		}
+		if err != nil && !tc.shouldErr {
+			t.Fatalf("Test %d expected no errors, but got '%v'", i, err)
+		}
+		if tc.shouldErr {
+			continue
+		}
+		signer := sign.signers[0]
+		if (signer.nsec3 == nil) != (tc.nsec3 == nil) || signer.nsec3 != nil && *signer.nsec3 != *tc.nsec3 {
+			t.Errorf("Test %d expected NSEC3 parameters %+v, got %+v", i, tc.nsec3, signer.nsec3)
+		}
+		if signer.kskLifetime != tc.ksk || signer.zskLifetime != tc.zsk {
+			t.Errorf("Test %d expected lifetimes %s and %s, got %s and %s", i, tc.ksk, tc.zsk, signer.kskLifetime, signer.zskLifetime)
+		}
+	}
+}
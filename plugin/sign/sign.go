@@ -33,6 +33,8 @@ const (
 	durationInceptionJitter         = -18 * time.Hour     // default max jitter for the inception
 	durationExpirationDayJitter     = 5 * 24 * time.Hour  // default max jitter for the expiration
 	durationSignatureInceptionHours = -3 * time.Hour      // -(2+1) hours, be sure to catch daylight saving time and such, jitter is subtracted
+	durationPrepublish              = 7 * 24 * time.Hour  // publish a successor key this long before it is used
+	durationRetire                  = 7 * 24 * time.Hour  // keep publishing an inactive key this long
 )
 
 const timeFmt = "2006-01-02T15:04:05.000Z07:00"
@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"time"
 
 	"github.com/coredns/coredns/plugin/file"
@@ -18,13 +19,19 @@ var log = clog.NewWithPlugin("sign")
 
 // Signer holds the data needed to sign a zone file.
 type Signer struct {
-	keys        []Pair
+	keys        []Pair   // keys given as files
+	keydirs     []string // directories with keys, these are read each time we sign
 	origin      string
 	dbfile      string
 	directory   string
 	jitterIncep time.Duration
 	jitterExpir time.Duration
 
+	nsec3       *nsec3Param   // if set, NSEC3 is used instead of NSEC
+	kskLifetime time.Duration // if set, KSKs are rolled automatically
+	zskLifetime time.Duration // if set, ZSKs are rolled automatically
+	dsServers   []string      // if set, the DS of a new KSK is looked up here before the old KSK is retired
+
 	signedfile string
 	stop       chan struct{}
 }
@@ -41,23 +48,41 @@ func (s *Signer) Sign(now time.Time) (*file.Zone, error) {
 		return nil, err
 	}
 
+	keys, err := s.readKeys()
+	if err != nil {
+		return nil, err
+	}
+	dnskeys, ksks, zsks := signingKeys(keys, now)
+	if len(ksks) == 0 {
+		return nil, fmt.Errorf("no active key signing key")
+	}
+
 	mttl := z.SOA.Minttl
 	ttl := z.SOA.Header().Ttl
 	inception, expiration := lifetime(now, s.jitterIncep, s.jitterExpir)
 	z.SOA.Serial = uint32(now.Unix()) // #nosec G115 -- Unix time to SOA serial, Year 2106 problem accepted
 
-	for _, pair := range s.keys {
+	for _, pair := range dnskeys {
 		pair.Public.Header().Ttl = ttl // set TTL on key so it matches the RRSIG.
 		z.Insert(pair.Public)
+	}
+	// Only the active KSKs get CDS and CDNSKEY records, so the parent replaces the DS of a KSK that is rolled.
+	for _, pair := range ksks {
 		z.Insert(pair.Public.ToDS(dns.SHA1).ToCDS())
 		z.Insert(pair.Public.ToDS(dns.SHA256).ToCDS())
 		z.Insert(pair.Public.ToCDNSKEY())
 	}
 
+	if s.nsec3 != nil {
+		if err := s.nsec3.chain(z, s.origin, mttl); err != nil {
+			return nil, err
+		}
+	}
+
 	names := names(s.origin, z)
 	ln := len(names)
 
-	for _, pair := range s.keys {
+	for _, pair := range zsks {
 		rrsig, err := pair.signRRs([]dns.RR{z.SOA}, s.origin, ttl, inception, expiration)
 		if err != nil {
 			return nil, err
@@ -80,7 +105,9 @@ func (s *Signer) Sign(now time.Time) (*file.Zone, error) {
 			return nil
 		}
 
-		if e.Name() == s.origin {
+		if s.nsec3 != nil {
+			// The NSEC3 records have been added already.
+		} else if e.Name() == s.origin {
 			nsec := NSEC(e.Name(), names[(ln+i)%ln], mttl, append(e.Types(), dns.TypeNS, dns.TypeSOA, dns.TypeRRSIG, dns.TypeNSEC))
 			z.Insert(nsec)
 		} else {
@@ -94,7 +121,11 @@ func (s *Signer) Sign(now time.Time) (*file.Zone, error) {
 			if t == dns.TypeRRSIG || t == dns.TypeNS {
 				continue
 			}
-			for _, pair := range s.keys {
+			signers := zsks
+			if t == dns.TypeDNSKEY || t == dns.TypeCDS || t == dns.TypeCDNSKEY {
+				signers = ksks
+			}
+			for _, pair := range signers {
 				rrsig, err := pair.signRRs(rrs, s.origin, rrs[0].Header().Ttl, inception, expiration)
 				if err != nil {
 					return err
@@ -108,16 +139,39 @@ func (s *Signer) Sign(now time.Time) (*file.Zone, error) {
 	return z, err
 }
 
-// resign checks if the signed zone exists, or needs resigning.
+// resign checks if the signed zone exists, or needs resigning. Keys that reach the end of their
+// lifetime are rolled first.
 func (s *Signer) resign() error {
 	signedfile := filepath.Join(s.directory, s.signedfile)
 	rd, err := os.Open(filepath.Clean(signedfile))
 	if err != nil && os.IsNotExist(err) {
 		return err
 	}
+	defer rd.Close()
 
 	now := time.Now().UTC()
-	return resign(rd, now)
+	tags, err := s.rollover(now)
+	if err != nil {
+		log.Warningf("Error rolling keys for %q: %s", s.origin, err)
+	}
+	if len(tags) > 0 {
+		return fmt.Errorf("keys with tags %v were generated", tags)
+	}
+
+	if why := resign(rd, now); why != nil {
+		return why
+	}
+
+	// A key timing event since the zone was signed changes the keys we sign with.
+	info, err := rd.Stat()
+	if err != nil {
+		return err
+	}
+	keys, err := s.readKeys()
+	if err != nil {
+		return err
+	}
+	return keyEvent(keys, info.ModTime(), now)
 }
 
 // resign will scan rd and check the signature on the SOA record. We will resign on the basis
@@ -168,8 +222,11 @@ func signAndLog(s *Signer, why error) {
 	now := time.Now().UTC()
 	z, err := s.Sign(now)
 	log.Infof("Signing %q because %s", s.origin, why)
+
+	keys, _ := s.readKeys()
+	tags := keyTag(slices.DeleteFunc(keys, func(k Pair) bool { return !k.active(now) }))
 	if err != nil {
-		log.Warningf("Error signing %q with key tags %q in %s: %s, next: %s", s.origin, keyTag(s.keys), time.Since(now), err, now.Add(durationRefreshHours).Format(timeFmt))
+		log.Warningf("Error signing %q with key tags %q in %s: %s, next: %s", s.origin, tags, time.Since(now), err, now.Add(durationRefreshHours).Format(timeFmt))
 		return
 	}
 
@@ -177,7 +234,7 @@ func signAndLog(s *Signer, why error) {
 		log.Warningf("Error signing %q: failed to move zone file into place: %s", s.origin, err)
 		return
 	}
-	log.Infof("Successfully signed zone %q in %q with key tags %q and %d SOA serial, elapsed %f, next: %s", s.origin, filepath.Join(s.directory, s.signedfile), keyTag(s.keys), z.SOA.Serial, time.Since(now).Seconds(), now.Add(durationRefreshHours).Format(timeFmt))
+	log.Infof("Successfully signed zone %q in %q with key tags %q and %d SOA serial, elapsed %f, next: %s", s.origin, filepath.Join(s.directory, s.signedfile), tags, z.SOA.Serial, time.Since(now).Seconds(), now.Add(durationRefreshHours).Format(timeFmt))
 }
 
 // refresh checks every val if some zones need to be resigned.
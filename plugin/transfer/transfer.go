@@ -43,8 +43,10 @@ type Transferer interface {
 	//
 	// If serial is not 0, it will be handled as an IXFR request. If the serial is equal to or greater (newer) than
 	// the current serial for the zone, send a single SOA record to the channel and then close it.
-	// If the serial is less (older) than the current serial for the zone, perform an AXFR fallback
-	// by proceeding as if an AXFR was requested (as above).
+	// If the serial is less (older) than the current serial for the zone and the plugin knows the differences
+	// since that serial, it may send an incremental transfer (RFC 1995): the current SOA, followed by the
+	// difference sequences (old SOA, deleted records, new SOA, added records), and the current SOA again.
+	// Otherwise perform an AXFR fallback by proceeding as if an AXFR was requested (as above).
 	Transfer(zone string, serial uint32) (<-chan []dns.RR, error)
 }
 
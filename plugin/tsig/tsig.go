@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/binary"
 	"encoding/hex"
+	"strings"
 	"time"
 
 	"github.com/coredns/coredns/plugin"
@@ -24,6 +25,17 @@ type TSIGServer struct {
 	Next       plugin.Handler
 }
 
+// Key is the context key under which the name of the TSIG key a request was signed with is stored,
+// after its signature has been verified.
+type Key struct{}
+
+// KeyName returns the (lower cased) name of the TSIG key that signed the request in ctx. If the
+// request wasn't signed, or the tsig plugin isn't loaded, the empty string is returned.
+func KeyName(ctx context.Context) string {
+	k, _ := ctx.Value(Key{}).(string)
+	return k
+}
+
 type qTypes map[uint16]struct{}
 type opCodes map[int]struct{}
 
@@ -71,6 +83,7 @@ func (t *TSIGServer) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.
 	}
 
 	tsigRR.Error = dns.RcodeSuccess
+	ctx = context.WithValue(ctx, Key{}, strings.ToLower(tsigRR.Hdr.Name))
 	rcode, err := plugin.NextOrFailure(t.Name(), t.Next, ctx, w, r)
 	if err != nil {
 		log.Errorf("request handler returned an error: %v\n", err)
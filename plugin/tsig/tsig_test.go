@@ -414,6 +414,38 @@ func TestServeDNSTsigNext(t *testing.T) {
 	}
 }
 
+func TestServeDNSKeyName(t *testing.T) {
+	for _, signed := range []bool{true, false} {
+		var keyName string
+		tsig := TSIGServer{
+			Zones: []string{"."},
+			Next: test.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+				keyName = KeyName(ctx)
+				return testHandler()(ctx, w, r)
+			}),
+		}
+
+		w := dnstest.NewRecorder(&ErrWriter{})
+		r := new(dns.Msg)
+		r.SetQuestion("test.example.", dns.TypeA)
+		if signed {
+			r.SetTsig("Test.Key.", dns.HmacSHA256, 300, time.Now().Unix())
+		}
+
+		if _, err := tsig.ServeDNS(context.TODO(), w, r); err != nil {
+			t.Fatal(err)
+		}
+
+		expect := ""
+		if signed {
+			expect = "test.key."
+		}
+		if keyName != expect {
+			t.Errorf("Signed %t: expected key name %q, got %q", signed, expect, keyName)
+		}
+	}
+}
+
 func testHandler() test.HandlerFunc {
 	return func(_ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
 		state := request.Request{W: w, Req: r}
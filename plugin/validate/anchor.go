@@ -0,0 +1,296 @@
+package validate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// The root trust anchors published by IANA, https://data.iana.org/root-anchors/root-anchors.xml.
+var rootAnchors = []string{
+	". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+// holdDown is the add and remove hold-down time of RFC 5011, section 2.4.1.
+const holdDown = 30 * 24 * time.Hour
+
+// state is the state of a trust anchor, RFC 5011, section 4.
+type state int
+
+const (
+	valid   state = iota // the key is trusted
+	pending              // the key is new, it is trusted after the hold-down time
+	revoked              // the key revoked itself, it is removed after the hold-down time
+)
+
+var stateNames = map[state]string{valid: "valid", pending: "pending", revoked: "revoked"}
+
+// anchor is a trust anchor: a DS or DNSKEY record.
+type anchor struct {
+	rr    dns.RR
+	state state
+	since time.Time // when the anchor entered its state
+}
+
+// anchors holds the trust anchors, per zone.
+type anchors struct {
+	mu    sync.RWMutex
+	zones map[string][]*anchor
+	file  string // file the anchors are saved to on updates, empty if they are not saved
+}
+
+// defaultAnchors returns the root trust anchors.
+func defaultAnchors() *anchors {
+	a, err := parseAnchors(strings.NewReader(strings.Join(rootAnchors, "\n")), "")
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// readAnchors reads the trust anchors in file.
+func readAnchors(file string) (*anchors, error) {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseAnchors(f, file)
+}
+
+// parseAnchors parses DS and DNSKEY records in zone file format. The state of an anchor is read from an
+// optional comment after it, as written by save: "; state=pending since=2006-01-02T15:04:05Z".
+func parseAnchors(r io.Reader, file string) (*anchors, error) {
+	a := &anchors{zones: map[string][]*anchor{}, file: file}
+	zp := dns.NewZoneParser(r, ".", file)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		switch rr.(type) {
+		case *dns.DS, *dns.DNSKEY:
+		default:
+			return nil, fmt.Errorf("trust anchor must be a DS or DNSKEY record: %s", rr)
+		}
+		an := &anchor{rr: rr}
+		if err := an.parseComment(zp.Comment()); err != nil {
+			return nil, fmt.Errorf("trust anchor %s: %s", rr, err)
+		}
+		zone := strings.ToLower(rr.Header().Name)
+		a.zones[zone] = append(a.zones[zone], an)
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+	if len(a.zones) == 0 {
+		return nil, fmt.Errorf("no trust anchors in %q", file)
+	}
+	return a, nil
+}
+
+func (an *anchor) parseComment(comment string) error {
+	for _, f := range strings.Fields(strings.TrimLeft(comment, "; ")) {
+		k, val, ok := strings.Cut(f, "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "state":
+			found := false
+			for s, name := range stateNames {
+				if name == val {
+					an.state, found = s, true
+				}
+			}
+			if !found {
+				return fmt.Errorf("unknown state %q", val)
+			}
+		case "since":
+			t, err := time.Parse(time.RFC3339, val)
+			if err != nil {
+				return err
+			}
+			an.since = t
+		}
+	}
+	return nil
+}
+
+// closest returns the zone with trust anchors that is closest to name, or "" if name is not below one.
+func (a *anchors) closest(name string) string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	zone := ""
+	for z := range a.zones {
+		if dns.IsSubDomain(z, name) && (zone == "" || dns.CountLabel(z) > dns.CountLabel(zone)) {
+			zone = z
+		}
+	}
+	return zone
+}
+
+// list returns the zones with trust anchors.
+func (a *anchors) list() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	zones := make([]string, 0, len(a.zones))
+	for z := range a.zones {
+		zones = append(zones, z)
+	}
+	sort.Strings(zones)
+	return zones
+}
+
+// trusts returns true if k is a key of zone that matches a valid trust anchor.
+func (a *anchors) trusts(zone string, k *dns.DNSKEY) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, an := range a.zones[strings.ToLower(zone)] {
+		if an.state == valid && an.matches(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns true if k is the key of the anchor. The REVOKE flag is ignored, because it changes
+// the key tag.
+func (an *anchor) matches(k *dns.DNSKEY) bool {
+	switch x := an.rr.(type) {
+	case *dns.DS:
+		return matchDS(k, []*dns.DS{x})
+	case *dns.DNSKEY:
+		return x.Algorithm == k.Algorithm && x.Protocol == k.Protocol && x.PublicKey == k.PublicKey &&
+			x.Flags&^dns.REVOKE == k.Flags&^dns.REVOKE
+	}
+	return false
+}
+
+// update updates the trust anchors of zone with keys, the validated DNSKEY records of zone, following
+// RFC 5011 at time now. Revoked keys are only accepted if they signed the keys themselves, sigs are
+// the signatures over keys. It returns true if the anchors changed.
+func (a *anchors) update(zone string, keys []*dns.DNSKEY, sigs []*dns.RRSIG, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	zone = strings.ToLower(zone)
+	list := a.zones[zone]
+	changed := false
+
+	rrs := make([]dns.RR, len(keys))
+	for i, k := range keys {
+		rrs[i] = k
+	}
+
+	for _, k := range keys {
+		if k.Flags&dns.SEP == 0 || k.Flags&dns.ZONE == 0 {
+			continue
+		}
+		var an *anchor
+		for _, x := range list {
+			if x.matches(k) {
+				an = x
+				break
+			}
+		}
+
+		if k.Flags&dns.REVOKE != 0 {
+			if an == nil || an.state == revoked || !selfSigned(k, rrs, sigs) {
+				continue
+			}
+			an.state, an.since, an.rr, changed = revoked, now, k, true
+			continue
+		}
+
+		switch {
+		case an == nil:
+			list = append(list, &anchor{rr: k, state: pending, since: now})
+			changed = true
+		case an.state == pending && now.Sub(an.since) >= holdDown:
+			an.state, an.since, changed = valid, now, true
+		}
+		if an != nil {
+			if _, ok := an.rr.(*dns.DS); ok && an.state == valid {
+				// Once the key of a DS anchor is seen, keep the key itself.
+				an.rr, changed = k, true
+			}
+		}
+	}
+
+	// Drop pending keys that are gone and revoked keys after the hold-down time.
+	j := 0
+	for _, an := range list {
+		switch an.state {
+		case pending:
+			if !present(an, keys) {
+				changed = true
+				continue
+			}
+		case revoked:
+			if now.Sub(an.since) >= holdDown {
+				changed = true
+				continue
+			}
+		}
+		list[j] = an
+		j++
+	}
+	a.zones[zone] = list[:j]
+	return changed
+}
+
+// present returns true if the key of an is in keys.
+func present(an *anchor, keys []*dns.DNSKEY) bool {
+	for _, k := range keys {
+		if an.matches(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// selfSigned returns true if one of sigs over rrs is made with k.
+func selfSigned(k *dns.DNSKEY, rrs []dns.RR, sigs []*dns.RRSIG) bool {
+	tag := k.KeyTag()
+	for _, sig := range sigs {
+		if sig.KeyTag == tag && sig.Algorithm == k.Algorithm && sig.Verify(k, rrs) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// save writes the trust anchors to the file they were read from.
+func (a *anchors) save() error {
+	if a.file == "" {
+		return nil
+	}
+	a.mu.RLock()
+	buf := &bytes.Buffer{}
+	zones := make([]string, 0, len(a.zones))
+	for z := range a.zones {
+		zones = append(zones, z)
+	}
+	sort.Strings(zones)
+	for _, z := range zones {
+		for _, an := range a.zones[z] {
+			fmt.Fprintf(buf, "%s ; state=%s", an.rr, stateNames[an.state])
+			if !an.since.IsZero() {
+				fmt.Fprintf(buf, " since=%s", an.since.UTC().Format(time.RFC3339))
+			}
+			buf.WriteByte('\n')
+		}
+	}
+	a.mu.RUnlock()
+
+	tmp := a.file + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.file)
+}
@@ -0,0 +1,129 @@
+package validate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestParseAnchors(t *testing.T) {
+	a := defaultAnchors()
+	if z := a.closest("example.org."); z != "." {
+		t.Errorf("Expected the root trust anchor, got %q", z)
+	}
+
+	in := `. IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D
+example.org. IN DS 1 13 2 0000000000000000000000000000000000000000000000000000000000000000 ; state=pending since=2026-01-02T15:04:05Z
+`
+	a, err := parseAnchors(strings.NewReader(in), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z := a.closest("www.example.org."); z != "example.org." {
+		t.Errorf("Expected example.org., got %q", z)
+	}
+	an := a.zones["example.org."][0]
+	if an.state != pending || an.since.Year() != 2026 {
+		t.Errorf("Expected a pending anchor since 2026, got %d since %s", an.state, an.since)
+	}
+
+	for _, bad := range []string{
+		"example.org. IN A 127.0.0.1",
+		". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D ; state=unknown",
+		"",
+	} {
+		if _, err := parseAnchors(strings.NewReader(bad), ""); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	old := newSigner(t, ".")
+	next := newSigner(t, ".")
+	now := time.Now()
+
+	file := filepath.Join(t.TempDir(), "anchors")
+	if err := os.WriteFile(file, []byte(old.ds().String()+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := readAnchors(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []*dns.DNSKEY{old.key, next.key}
+	sigs := []*dns.RRSIG{old.sign(t, []dns.RR{old.key, next.key}, now, now.Add(time.Hour))}
+
+	// A new key becomes pending, the DS anchor is replaced by its key.
+	if !a.update(".", keys, sigs, now) {
+		t.Fatal("Expected the anchors to change")
+	}
+	if a.trusts(".", next.key) {
+		t.Error("Expected the new key not to be trusted during the hold-down time")
+	}
+	if _, ok := a.zones["."][0].rr.(*dns.DNSKEY); !ok {
+		t.Error("Expected the DS anchor to be replaced by its key")
+	}
+	if a.update(".", keys, sigs, now.Add(24*time.Hour)) {
+		t.Error("Expected no change during the hold-down time")
+	}
+
+	// After the hold-down time it is trusted.
+	if !a.update(".", keys, sigs, now.Add(holdDown)) || !a.trusts(".", next.key) {
+		t.Error("Expected the new key to be trusted after the hold-down time")
+	}
+
+	// The old key revokes itself.
+	revokedKey := *old.key
+	revokedKey.Flags |= dns.REVOKE
+	keys = []*dns.DNSKEY{&revokedKey, next.key}
+	set := []dns.RR{&revokedKey, next.key}
+	revoked := &signer{key: &revokedKey, priv: old.priv}
+	sigs = []*dns.RRSIG{revoked.sign(t, set, now, now.Add(time.Hour)), next.sign(t, set, now, now.Add(time.Hour))}
+	if !a.update(".", keys, sigs, now.Add(holdDown+time.Hour)) || a.trusts(".", old.key) {
+		t.Error("Expected the old key to be revoked")
+	}
+	if !a.update(".", keys, sigs, now.Add(3*holdDown)) || len(a.zones["."]) != 1 {
+		t.Errorf("Expected the revoked key to be removed, got %d anchors", len(a.zones["."]))
+	}
+
+	// A pending key that disappears is dropped.
+	pendingKey := newSigner(t, ".")
+	a.update(".", []*dns.DNSKEY{next.key, pendingKey.key}, nil, now)
+	a.update(".", []*dns.DNSKEY{next.key}, nil, now.Add(time.Hour))
+	if len(a.zones["."]) != 1 {
+		t.Errorf("Expected the pending key to be dropped, got %d anchors", len(a.zones["."]))
+	}
+
+	if err := a.save(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := readAnchors(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.trusts(".", next.key) {
+		t.Error("Expected the saved anchors to trust the new key")
+	}
+}
+
+func TestUpdateRevokeNotSelfSigned(t *testing.T) {
+	k := newSigner(t, ".")
+	a, err := parseAnchors(strings.NewReader(k.key.String()), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedKey := *k.key
+	revokedKey.Flags |= dns.REVOKE
+	if a.update(".", []*dns.DNSKEY{&revokedKey}, nil, time.Now()) {
+		t.Error("Expected a revoked key without its own signature to be ignored")
+	}
+	if !a.trusts(".", k.key) {
+		t.Error("Expected the key to be trusted still")
+	}
+}
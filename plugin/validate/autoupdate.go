@@ -0,0 +1,88 @@
+package validate
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	minProbe = time.Hour
+	maxProbe = 15 * 24 * time.Hour
+)
+
+// probeAddr is the address the queries to look up the DNSKEY records of trust anchors come from.
+var probeAddr = &net.UDPAddr{IP: net.IPv6loopback, Port: 0}
+
+// probeWriter is the dns.ResponseWriter for the lookups of the DNSKEY records of the trust anchors, which
+// have no client.
+type probeWriter struct{}
+
+func (probeWriter) LocalAddr() net.Addr         { return probeAddr }
+func (probeWriter) RemoteAddr() net.Addr        { return probeAddr }
+func (probeWriter) WriteMsg(*dns.Msg) error     { return nil }
+func (probeWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (probeWriter) Close() error                { return nil }
+func (probeWriter) TsigStatus() error           { return nil }
+func (probeWriter) TsigTimersOnly(bool)         {}
+func (probeWriter) Hijack()                     {}
+
+// autoUpdate probes the DNSKEY records of the zones with trust anchors until stop is closed, and updates
+// the trust anchors as described in RFC 5011.
+func (v *Validate) autoUpdate(stop <-chan struct{}) {
+	for {
+		wait := maxProbe
+		for _, zone := range v.anchors.list() {
+			wait = min(wait, v.probe(zone))
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// probe looks up the DNSKEY records of zone, and updates its trust anchors. It returns when zone should be
+// probed again, RFC 5011, section 2.3.
+func (v *Validate) probe(zone string) time.Duration {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	m, err := v.lookup(ctx, probeWriter{}, zone, dns.TypeDNSKEY)
+	if err != nil {
+		log.Warningf("Failed to look up the DNSKEY records of trust anchor %q: %s", zone, err)
+		return minProbe
+	}
+	set := rrsets(m.Answer).get(zone, dns.TypeDNSKEY)
+	if set == nil {
+		log.Warningf("No DNSKEY records for trust anchor %q", zone)
+		return minProbe
+	}
+
+	var keys, trusted []*dns.DNSKEY
+	for _, rr := range set.rrs {
+		k := rr.(*dns.DNSKEY)
+		keys = append(keys, k)
+		if k.Flags&dns.REVOKE == 0 && v.anchors.trusts(zone, k) {
+			trusted = append(trusted, k)
+		}
+	}
+	if _, err := v.verify(set, trusted); err != nil {
+		log.Warningf("DNSKEY records of trust anchor %q are not signed by a trusted key: %s", zone, err)
+		return minProbe
+	}
+
+	if v.anchors.update(zone, keys, set.sigs, v.now()) {
+		log.Infof("Trust anchors of %q changed", zone)
+		v.cuts.Remove(key(zone))
+		if err := v.anchors.save(); err != nil {
+			log.Errorf("Failed to save the trust anchors: %s", err)
+		}
+	}
+
+	wait := time.Duration(set.ttl()) * time.Second / 2
+	return min(max(wait, minProbe), maxProbe)
+}
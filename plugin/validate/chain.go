@@ -0,0 +1,225 @@
+package validate
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+
+	"github.com/miekg/dns"
+)
+
+const maxCutTTL = 24 * time.Hour
+
+// kind is what is known about a name in the chain of trust.
+type kind int
+
+const (
+	zoneCut  kind = iota // the name is a signed zone, with validated keys
+	unsigned             // the name is a zone cut to an unsigned zone
+	notCut               // the name is not a zone cut
+)
+
+// cut holds what is known about a name in the chain of trust.
+type cut struct {
+	name   string
+	kind   kind
+	keys   []*dns.DNSKEY // validated keys of the zone, for zoneCut
+	expire time.Time
+}
+
+func key(name string) uint64 { return cache.Hash([]byte(strings.ToLower(name))) }
+
+// cached returns the cached cut for name, or nil if there is none or it expired.
+func (v *Validate) cached(name string) *cut {
+	c, ok := v.cuts.Get(key(name))
+	if !ok || !strings.EqualFold(c.name, name) || v.now().After(c.expire) {
+		return nil
+	}
+	return c
+}
+
+func (v *Validate) store(c *cut, ttl uint32) *cut {
+	c.expire = v.now().Add(min(time.Duration(ttl)*time.Second, maxCutTTL))
+	v.cuts.Add(key(c.name), c)
+	return c
+}
+
+// chain follows the chain of trust from the closest trust anchor down to name. It returns the closest
+// signed zone at or above name and its validated keys, and secure. If there is an unsigned zone cut
+// between the trust anchor and name, or name is not below a trust anchor, it returns insecure.
+func (v *Validate) chain(ctx context.Context, w dns.ResponseWriter, name string) (string, []*dns.DNSKEY, status, error) {
+	if plugin.Zones(v.nta).Matches(name) != "" {
+		return "", nil, insecure, nil
+	}
+	zone := v.anchors.closest(name)
+	if zone == "" {
+		return "", nil, insecure, nil
+	}
+	keys, err := v.anchorKeys(ctx, w, zone)
+	if err != nil {
+		return "", nil, bogus, err
+	}
+
+	for _, child := range below(zone, name) {
+		c, err := v.cut(ctx, w, zone, keys, child)
+		if err != nil {
+			return "", nil, bogus, err
+		}
+		switch c.kind {
+		case zoneCut:
+			zone, keys = child, c.keys
+		case unsigned:
+			return child, nil, insecure, nil
+		}
+	}
+	return zone, keys, secure, nil
+}
+
+// below returns the names below zone down to and including name, top down.
+func below(zone, name string) []string {
+	var names []string
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		n := name[off:]
+		if dns.CountLabel(n) <= dns.CountLabel(zone) {
+			break
+		}
+		names = append(names, n)
+	}
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return names
+}
+
+// anchorKeys returns the validated keys of zone, which has a trust anchor.
+func (v *Validate) anchorKeys(ctx context.Context, w dns.ResponseWriter, zone string) ([]*dns.DNSKEY, error) {
+	if c := v.cached(zone); c != nil && c.kind == zoneCut {
+		return c.keys, nil
+	}
+	keys, ttl, err := v.dnskeys(ctx, w, zone, func(k *dns.DNSKEY) bool { return v.anchors.trusts(zone, k) })
+	if err != nil {
+		return nil, err
+	}
+	return v.store(&cut{name: zone, kind: zoneCut, keys: keys}, ttl).keys, nil
+}
+
+// cut finds out whether child, a name below zone, is a zone cut, by looking up its DS records, which are
+// validated with keys, the keys of zone.
+func (v *Validate) cut(ctx context.Context, w dns.ResponseWriter, zone string, keys []*dns.DNSKEY, child string) (*cut, error) {
+	if c := v.cached(child); c != nil {
+		return c, nil
+	}
+
+	m, err := v.lookup(ctx, w, child, dns.TypeDS)
+	if err != nil {
+		return nil, err
+	}
+
+	sets := rrsets(m.Answer)
+	if ds := sets.get(child, dns.TypeDS); ds != nil {
+		if _, err := v.verify(ds, keys); err != nil {
+			return nil, err
+		}
+		var supported []*dns.DS
+		for _, rr := range ds.rrs {
+			if d := rr.(*dns.DS); supportedAlgorithm(d.Algorithm) && supportedDigest(d.DigestType) {
+				supported = append(supported, d)
+			}
+		}
+		// If no DS can be used, the zone is treated as unsigned, RFC 4035, section 5.2.
+		if len(supported) == 0 {
+			return v.store(&cut{name: child, kind: unsigned}, ds.ttl()), nil
+		}
+		childKeys, ttl, err := v.dnskeys(ctx, w, child, func(k *dns.DNSKEY) bool { return matchDS(k, supported) })
+		if err != nil {
+			return nil, err
+		}
+		return v.store(&cut{name: child, kind: zoneCut, keys: childKeys}, min(ttl, ds.ttl())), nil
+	}
+	if len(m.Answer) > 0 {
+		// A CNAME, child is not a zone cut.
+		return v.store(&cut{name: child, kind: notCut}, minTTL(m.Answer)), nil
+	}
+
+	// There is no DS, this must be proven by the NSEC or NSEC3 records of zone.
+	d, err := v.denial(m, zone, keys)
+	if err != nil {
+		return nil, err
+	}
+	k, err := d.ds(child)
+	if err != nil {
+		return nil, err
+	}
+	return v.store(&cut{name: child, kind: k}, minTTL(m.Ns)), nil
+}
+
+// dnskeys looks up the DNSKEY records of zone, and validates them with the keys for which trust returns
+// true. It returns the zone keys and their TTL.
+func (v *Validate) dnskeys(ctx context.Context, w dns.ResponseWriter, zone string, trust func(*dns.DNSKEY) bool) ([]*dns.DNSKEY, uint32, error) {
+	m, err := v.lookup(ctx, w, zone, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, 0, err
+	}
+	set := rrsets(m.Answer).get(zone, dns.TypeDNSKEY)
+	if set == nil {
+		return nil, 0, &bogusError{code: dns.ExtendedErrorCodeDNSKEYMissing, reason: "no DNSKEY for " + zone}
+	}
+
+	var (
+		keys    []*dns.DNSKEY
+		trusted []*dns.DNSKEY
+	)
+	for _, rr := range set.rrs {
+		k := rr.(*dns.DNSKEY)
+		if k.Flags&dns.ZONE == 0 || k.Flags&dns.REVOKE != 0 || k.Protocol != 3 {
+			continue
+		}
+		keys = append(keys, k)
+		if trust(k) {
+			trusted = append(trusted, k)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, 0, &bogusError{code: dns.ExtendedErrorCodeNoZoneKeyBitSet, reason: "no zone keys for " + zone}
+	}
+	if len(trusted) == 0 {
+		return nil, 0, &bogusError{code: dns.ExtendedErrorCodeDNSKEYMissing, reason: "no DNSKEY matching the DS or trust anchor of " + zone}
+	}
+	if _, err := v.verify(set, trusted); err != nil {
+		return nil, 0, err
+	}
+	return keys, set.ttl(), nil
+}
+
+// matchDS returns true if k matches one of ds.
+func matchDS(k *dns.DNSKEY, ds []*dns.DS) bool {
+	tag := k.KeyTag()
+	for _, d := range ds {
+		if d.KeyTag != tag || d.Algorithm != k.Algorithm {
+			continue
+		}
+		if kds := k.ToDS(d.DigestType); kds != nil && strings.EqualFold(kds.Digest, d.Digest) {
+			return true
+		}
+	}
+	return false
+}
+
+func supportedAlgorithm(alg uint8) bool {
+	switch alg {
+	case dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512, dns.ECDSAP256SHA256, dns.ECDSAP384SHA384, dns.ED25519:
+		return true
+	}
+	return false
+}
+
+func supportedDigest(t uint8) bool {
+	switch t {
+	case dns.SHA1, dns.SHA256, dns.SHA384:
+		return true
+	}
+	return false
+}
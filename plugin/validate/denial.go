@@ -0,0 +1,296 @@
+package validate
+
+import (
+	"strings"
+
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+
+	"github.com/miekg/dns"
+)
+
+// maxIterations is the highest number of NSEC3 iterations accepted, zones using more are treated as
+// insecure, RFC 9276, section 3.2.
+const maxIterations = 150
+
+// denial holds the validated NSEC and NSEC3 records of a zone from a reply, that prove that names or
+// types do not exist.
+type denial struct {
+	zone  string
+	nsec  []*dns.NSEC
+	nsec3 []*dns.NSEC3
+}
+
+// denial returns the NSEC and NSEC3 records in the authority section of m that are in zone and are
+// validated with keys.
+func (v *Validate) denial(m *dns.Msg, zone string, keys []*dns.DNSKEY) (*denial, error) {
+	d := &denial{zone: zone}
+	for _, s := range rrsets(m.Ns) {
+		if s.rrtype != dns.TypeNSEC && s.rrtype != dns.TypeNSEC3 {
+			continue
+		}
+		if !dns.IsSubDomain(zone, s.name) {
+			continue
+		}
+		if _, err := v.verify(s, keys); err != nil {
+			return nil, err
+		}
+		for _, rr := range s.rrs {
+			switch x := rr.(type) {
+			case *dns.NSEC:
+				d.nsec = append(d.nsec, x)
+			case *dns.NSEC3:
+				d.nsec3 = append(d.nsec3, x)
+			}
+		}
+	}
+	if len(d.nsec) == 0 && len(d.nsec3) == 0 {
+		return nil, &bogusError{code: dns.ExtendedErrorCodeNSECMissing, reason: "no NSEC or NSEC3 records in " + zone}
+	}
+	return d, nil
+}
+
+func (d *denial) errMissing(what string) error {
+	return &bogusError{code: dns.ExtendedErrorCodeNSECMissing, reason: "no proof that " + what}
+}
+
+// highIterations returns true if the NSEC3 records use too many iterations to be checked.
+func (d *denial) highIterations() bool {
+	for _, n := range d.nsec3 {
+		if n.Iterations > maxIterations {
+			return true
+		}
+	}
+	return false
+}
+
+// ds tells if child, which has no DS records, is a zone cut to an unsigned zone, or no zone cut.
+func (d *denial) ds(child string) (kind, error) {
+	if n := d.matchNSEC(child); n != nil {
+		return cutKind(n.TypeBitMap, child)
+	}
+	if n := d.coverNSEC(child); n != nil {
+		// child does not exist, so it is no zone cut.
+		return notCut, nil
+	}
+
+	if len(d.nsec3) == 0 {
+		return notCut, d.errMissing(child + " has no DS")
+	}
+	if d.highIterations() {
+		return unsigned, nil
+	}
+	if n := d.matchNSEC3(child); n != nil {
+		return cutKind(n.TypeBitMap, child)
+	}
+	// An opt-out span may hold unsigned delegations, RFC 5155, section 8.6.
+	_, nc, ok := d.closestEncloser(child)
+	if !ok || nc == nil {
+		return notCut, d.errMissing(child + " has no DS")
+	}
+	if nc.Flags&1 == 1 {
+		return unsigned, nil
+	}
+	return notCut, nil
+}
+
+func cutKind(types []uint16, child string) (kind, error) {
+	switch {
+	case has(types, dns.TypeDS):
+		return notCut, &bogusError{code: dns.ExtendedErrorCodeDNSBogus, reason: "DS records of " + child + " are missing"}
+	case has(types, dns.TypeNS) && !has(types, dns.TypeSOA):
+		return unsigned, nil
+	}
+	return notCut, nil
+}
+
+// nxdomain checks the proof that name does not exist: name and the wildcard at its closest encloser are
+// covered.
+func (d *denial) nxdomain(name string) (status, error) {
+	if n := d.coverNSEC(name); n != nil {
+		ce := closestEncloser(name, n)
+		if d.coverNSEC("*."+ce) == nil {
+			return bogus, d.errMissing("*." + ce + " does not exist")
+		}
+		return secure, nil
+	}
+
+	if len(d.nsec3) == 0 {
+		return bogus, d.errMissing(name + " does not exist")
+	}
+	if d.highIterations() {
+		return insecure, nil
+	}
+	ce, nc, ok := d.closestEncloser(name)
+	if !ok || nc == nil {
+		return bogus, d.errMissing(name + " does not exist")
+	}
+	if d.coverNSEC3("*."+ce) == nil {
+		return bogus, d.errMissing("*." + ce + " does not exist")
+	}
+	if nc.Flags&1 == 1 {
+		return insecure, nil
+	}
+	return secure, nil
+}
+
+// nodata checks the proof that name has no records of qtype.
+func (d *denial) nodata(name string, qtype uint16) (status, error) {
+	if n := d.matchNSEC(name); n != nil {
+		if has(n.TypeBitMap, qtype) || has(n.TypeBitMap, dns.TypeCNAME) {
+			return bogus, &bogusError{code: dns.ExtendedErrorCodeDNSBogus, reason: "NSEC of " + name + " has type " + dns.TypeToString[qtype]}
+		}
+		return secure, nil
+	}
+	if n := d.coverNSEC(name); n != nil {
+		// An empty non-terminal, the next name is below it, RFC 4035, section 3.1.3.2.
+		if dns.IsSubDomain(name, n.NextDomain) && !strings.EqualFold(name, n.NextDomain) {
+			return secure, nil
+		}
+		// A wildcard without qtype, RFC 4035, section 3.1.3.4.
+		ce := closestEncloser(name, n)
+		if w := d.matchNSEC("*." + ce); w != nil && !has(w.TypeBitMap, qtype) && !has(w.TypeBitMap, dns.TypeCNAME) {
+			return secure, nil
+		}
+		return bogus, d.errMissing(name + " has no " + dns.TypeToString[qtype])
+	}
+
+	if len(d.nsec3) == 0 {
+		return bogus, d.errMissing(name + " has no " + dns.TypeToString[qtype])
+	}
+	if d.highIterations() {
+		return insecure, nil
+	}
+	if n := d.matchNSEC3(name); n != nil {
+		if has(n.TypeBitMap, qtype) || has(n.TypeBitMap, dns.TypeCNAME) {
+			return bogus, &bogusError{code: dns.ExtendedErrorCodeDNSBogus, reason: "NSEC3 of " + name + " has type " + dns.TypeToString[qtype]}
+		}
+		return secure, nil
+	}
+	ce, nc, ok := d.closestEncloser(name)
+	if !ok || nc == nil {
+		return bogus, d.errMissing(name + " has no " + dns.TypeToString[qtype])
+	}
+	// No DS in an opt-out span, RFC 5155, section 8.6.
+	if qtype == dns.TypeDS && nc.Flags&1 == 1 {
+		return insecure, nil
+	}
+	if w := d.matchNSEC3("*." + ce); w != nil && !has(w.TypeBitMap, qtype) && !has(w.TypeBitMap, dns.TypeCNAME) {
+		return secure, nil
+	}
+	return bogus, d.errMissing(name + " has no " + dns.TypeToString[qtype])
+}
+
+// wildcard checks the proof that name, which was answered from a wildcard with labels labels, does not
+// exist itself, RFC 4035, section 5.3.4 and RFC 5155, section 8.8.
+func (d *denial) wildcard(name string, labels int) (status, error) {
+	if d.coverNSEC(name) != nil {
+		return secure, nil
+	}
+	if len(d.nsec3) > 0 {
+		if d.highIterations() {
+			return insecure, nil
+		}
+		nc := suffix(name, labels+1)
+		if d.coverNSEC3(nc) != nil {
+			return secure, nil
+		}
+	}
+	return bogus, d.errMissing(name + " does not exist")
+}
+
+func (d *denial) matchNSEC(name string) *dns.NSEC {
+	for _, n := range d.nsec {
+		if strings.EqualFold(n.Hdr.Name, name) {
+			return n
+		}
+	}
+	return nil
+}
+
+// coverNSEC returns the NSEC record for which name lies between the owner and the next name.
+func (d *denial) coverNSEC(name string) *dns.NSEC {
+	for _, n := range d.nsec {
+		if dnsutil.CanonicalCompare(n.Hdr.Name, name) >= 0 {
+			continue
+		}
+		// The last NSEC in the zone points back to the apex.
+		if dnsutil.CanonicalCompare(name, n.NextDomain) < 0 || dnsutil.CanonicalCompare(n.NextDomain, n.Hdr.Name) <= 0 {
+			return n
+		}
+	}
+	return nil
+}
+
+func (d *denial) matchNSEC3(name string) *dns.NSEC3 {
+	for _, n := range d.nsec3 {
+		if n.Match(name) {
+			return n
+		}
+	}
+	return nil
+}
+
+func (d *denial) coverNSEC3(name string) *dns.NSEC3 {
+	for _, n := range d.nsec3 {
+		if n.Cover(name) {
+			return n
+		}
+	}
+	return nil
+}
+
+// closestEncloser finds the closest encloser proof for name, RFC 5155, section 8.3. It returns the
+// closest encloser and the NSEC3 record that covers the next closer name.
+func (d *denial) closestEncloser(name string) (string, *dns.NSEC3, bool) {
+	next := name
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		n := name[off:]
+		if !dns.IsSubDomain(d.zone, n) {
+			break
+		}
+		if d.matchNSEC3(n) != nil {
+			if n == next {
+				return n, nil, true
+			}
+			return n, d.coverNSEC3(next), true
+		}
+		next = n
+	}
+	return "", nil, false
+}
+
+// closestEncloser returns the closest encloser of name, which is covered by n: the longest name that is a
+// parent of name and of the owner or next name of n.
+func closestEncloser(name string, n *dns.NSEC) string {
+	ce := commonSuffix(name, n.Hdr.Name)
+	if c := commonSuffix(name, n.NextDomain); dns.CountLabel(c) > dns.CountLabel(ce) {
+		ce = c
+	}
+	return ce
+}
+
+func commonSuffix(a, b string) string {
+	n := dns.CompareDomainName(a, b)
+	return suffix(a, n)
+}
+
+// suffix returns the last n labels of name.
+func suffix(name string, n int) string {
+	idx := dns.Split(name)
+	if n >= len(idx) {
+		return name
+	}
+	if n <= 0 {
+		return "."
+	}
+	return name[idx[len(idx)-n]:]
+}
+
+func has(types []uint16, t uint16) bool {
+	for _, x := range types {
+		if x == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package validate
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// nsec3Chain returns the NSEC3 records of zone with the names in types, without signatures.
+func nsec3Chain(zone string, types map[string][]uint16, optOut bool) []*dns.NSEC3 {
+	type entry struct {
+		hash  string
+		types []uint16
+	}
+	var entries []entry
+	for name, t := range types {
+		entries = append(entries, entry{dns.HashName(name, dns.SHA1, 0, ""), t})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].hash < entries[j].hash })
+
+	var chain []*dns.NSEC3
+	for i, e := range entries {
+		n := &dns.NSEC3{
+			Hdr:        dns.RR_Header{Name: strings.ToLower(e.hash) + "." + zone, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 3600},
+			Hash:       dns.SHA1,
+			NextDomain: entries[(i+1)%len(entries)].hash,
+			TypeBitMap: e.types,
+		}
+		if optOut {
+			n.Flags = 1
+		}
+		chain = append(chain, n)
+	}
+	return chain
+}
+
+func TestNSEC3(t *testing.T) {
+	types := map[string][]uint16{
+		"example.":       {dns.TypeSOA, dns.TypeNS, dns.TypeDNSKEY},
+		"a.example.":     {dns.TypeA},
+		"*.w.example.":   {dns.TypeA},
+		"w.example.":     {},
+		"sub.example.":   {dns.TypeNS},
+		"child.example.": {dns.TypeNS, dns.TypeDS},
+	}
+	d := &denial{zone: "example.", nsec3: nsec3Chain("example.", types, false)}
+
+	if st, err := d.nxdomain("nx.example."); st != secure {
+		t.Errorf("Expected secure NXDOMAIN proof for nx.example., got %s: %v", st, err)
+	}
+	if st, _ := d.nxdomain("a.example."); st != bogus {
+		t.Errorf("Expected bogus NXDOMAIN proof for a.example., got %s", st)
+	}
+	if st, err := d.nodata("a.example.", dns.TypeMX); st != secure {
+		t.Errorf("Expected secure NODATA proof for a.example. MX, got %s: %v", st, err)
+	}
+	if st, _ := d.nodata("a.example.", dns.TypeA); st != bogus {
+		t.Errorf("Expected bogus NODATA proof for a.example. A, got %s", st)
+	}
+	if st, err := d.nodata("x.w.example.", dns.TypeMX); st != secure {
+		t.Errorf("Expected secure wildcard NODATA proof for x.w.example. MX, got %s: %v", st, err)
+	}
+	if st, err := d.wildcard("x.w.example.", 2); st != secure {
+		t.Errorf("Expected secure wildcard proof for x.w.example., got %s: %v", st, err)
+	}
+
+	tests := []struct {
+		name string
+		kind kind
+		err  bool
+	}{
+		{"sub.example.", unsigned, false},
+		{"a.example.", notCut, false},
+		{"child.example.", notCut, true},
+		{"nx.example.", notCut, false},
+	}
+	for _, tc := range tests {
+		k, err := d.ds(tc.name)
+		if (err != nil) != tc.err {
+			t.Errorf("Expected error %t for DS of %s, got %v", tc.err, tc.name, err)
+		}
+		if err == nil && k != tc.kind {
+			t.Errorf("Expected kind %d for %s, got %d", tc.kind, tc.name, k)
+		}
+	}
+}
+
+func TestNSEC3OptOut(t *testing.T) {
+	types := map[string][]uint16{
+		"example.":   {dns.TypeSOA, dns.TypeNS, dns.TypeDNSKEY},
+		"a.example.": {dns.TypeA},
+	}
+	d := &denial{zone: "example.", nsec3: nsec3Chain("example.", types, true)}
+
+	if k, err := d.ds("unsigned.example."); err != nil || k != unsigned {
+		t.Errorf("Expected an unsigned delegation in an opt-out span, got %d: %v", k, err)
+	}
+	if st, _ := d.nxdomain("nx.example."); st != insecure {
+		t.Errorf("Expected insecure NXDOMAIN proof in an opt-out span, got %s", st)
+	}
+	if st, _ := d.nodata("unsigned.example.", dns.TypeDS); st != insecure {
+		t.Errorf("Expected insecure DS NODATA proof in an opt-out span, got %s", st)
+	}
+
+	d.nsec3[0].Iterations = maxIterations + 1
+	if st, _ := d.nxdomain("nx.example."); st != insecure {
+		t.Errorf("Expected insecure with too many iterations, got %s", st)
+	}
+}
+
+func TestNSEC(t *testing.T) {
+	chain := []string{
+		"example. 3600 IN NSEC a.example. SOA NS DNSKEY NSEC RRSIG",
+		"a.example. 3600 IN NSEC b.c.example. A NSEC RRSIG",
+		"b.c.example. 3600 IN NSEC sub.example. A NSEC RRSIG",
+		"sub.example. 3600 IN NSEC example. NS NSEC RRSIG",
+	}
+	d := &denial{zone: "example."}
+	for _, s := range chain {
+		rr, _ := dns.NewRR(s)
+		d.nsec = append(d.nsec, rr.(*dns.NSEC))
+	}
+
+	if st, err := d.nxdomain("nx.example."); st != secure {
+		t.Errorf("Expected secure NXDOMAIN proof, got %s: %v", st, err)
+	}
+	if st, err := d.nodata("c.example.", dns.TypeA); st != secure {
+		t.Errorf("Expected secure NODATA proof for the empty non-terminal c.example., got %s: %v", st, err)
+	}
+	if st, _ := d.nodata("a.example.", dns.TypeA); st != bogus {
+		t.Errorf("Expected bogus NODATA proof for a.example. A, got %s", st)
+	}
+	if k, err := d.ds("sub.example."); err != nil || k != unsigned {
+		t.Errorf("Expected sub.example. to be an unsigned delegation, got %d: %v", k, err)
+	}
+	if k, err := d.ds("zz.example."); err != nil || k != notCut {
+		t.Errorf("Expected zz.example. to be no zone cut, got %d: %v", k, err)
+	}
+}
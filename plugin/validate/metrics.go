@@ -0,0 +1,16 @@
+package validate
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// resultCount is the number of replies validated, per result.
+var resultCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "validate",
+	Name:      "results_total",
+	Help:      "Counter of the number of replies validated, by result: secure, insecure or bogus.",
+}, []string{"server", "result"})
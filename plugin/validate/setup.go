@@ -0,0 +1,98 @@
+package validate
+
+import (
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+)
+
+func init() { plugin.Register("validate", setup) }
+
+func setup(c *caddy.Controller) error {
+	v, auto, err := parse(c)
+	if err != nil {
+		return plugin.Error("validate", err)
+	}
+
+	if auto {
+		stop := make(chan struct{})
+		c.OnStartup(func() error {
+			go v.autoUpdate(stop)
+			return nil
+		})
+		c.OnShutdown(func() error {
+			close(stop)
+			return nil
+		})
+	}
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		v.Next = next
+		return v
+	})
+
+	return nil
+}
+
+func parse(c *caddy.Controller) (*Validate, bool, error) {
+	var (
+		a    *anchors
+		nta  []string
+		auto bool
+		err  error
+	)
+
+	i := 0
+	zones := []string{}
+	for c.Next() {
+		if i > 0 {
+			return nil, false, plugin.ErrOnce
+		}
+		i++
+
+		zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "trust_anchor":
+				if !c.NextArg() {
+					return nil, false, c.ArgErr()
+				}
+				a, err = readAnchors(c.Val())
+				if err != nil {
+					return nil, false, c.Errf("reading trust anchors: %s", err)
+				}
+				if c.NextArg() {
+					return nil, false, c.ArgErr()
+				}
+			case "auto_update":
+				if c.NextArg() {
+					return nil, false, c.ArgErr()
+				}
+				auto = true
+			case "negative_trust_anchor":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, false, c.ArgErr()
+				}
+				for _, n := range args {
+					nta = append(nta, plugin.Host(n).NormalizeExact()...)
+				}
+			default:
+				return nil, false, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+	}
+
+	if auto && a == nil {
+		return nil, false, c.Err("auto_update needs a trust_anchor file to save the trust anchors to")
+	}
+	if a == nil {
+		a = defaultAnchors()
+	}
+
+	v := New(a)
+	v.Zones = zones
+	v.nta = nta
+	return v, auto, nil
+}
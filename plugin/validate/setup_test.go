@@ -0,0 +1,64 @@
+package validate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coredns/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "anchors")
+	anchor := "example.org. IN DS 1 13 2 0000000000000000000000000000000000000000000000000000000000000000\n"
+	if err := os.WriteFile(file, []byte(anchor), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input     string
+		shouldErr bool
+		zones     []string
+		anchor    string
+		nta       []string
+		auto      bool
+	}{
+		{`validate`, false, nil, ".", nil, false},
+		{`validate example.org`, false, []string{"example.org."}, ".", nil, false},
+		{"validate {\n trust_anchor " + file + "\n auto_update\n}", false, nil, "example.org.", nil, true},
+		{"validate {\n negative_trust_anchor example.net test.\n}", false, nil, ".", []string{"example.net.", "test."}, false},
+		// fails
+		{"validate {\n auto_update\n}", true, nil, "", nil, false},
+		{"validate {\n trust_anchor\n}", true, nil, "", nil, false},
+		{"validate {\n trust_anchor /does/not/exist\n}", true, nil, "", nil, false},
+		{"validate {\n negative_trust_anchor\n}", true, nil, "", nil, false},
+		{"validate {\n blah\n}", true, nil, "", nil, false},
+		{"validate\nvalidate", true, nil, "", nil, false},
+	}
+
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		v, auto, err := parse(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		if len(v.Zones) != len(tc.zones) || (len(tc.zones) > 0 && v.Zones[0] != tc.zones[0]) {
+			t.Errorf("Test %d: expected zones %v, got %v", i, tc.zones, v.Zones)
+		}
+		if z := v.anchors.closest("www.example.org."); z != tc.anchor {
+			t.Errorf("Test %d: expected trust anchor %q, got %q", i, tc.anchor, z)
+		}
+		if len(v.nta) != len(tc.nta) {
+			t.Errorf("Test %d: expected negative trust anchors %v, got %v", i, tc.nta, v.nta)
+		}
+		if auto != tc.auto {
+			t.Errorf("Test %d: expected auto_update %t, got %t", i, tc.auto, auto)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Package validate implements a plugin that validates DNSSEC signed replies.
+package validate
+
+import (
+	"context"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/nonwriter"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+var log = clog.NewWithPlugin("validate")
+
+const defaultCacheSize = 10000
+
+// Validate is a plugin that validates the replies of the next plugins with DNSSEC, following the chain
+// of trust from the trust anchors down.
+type Validate struct {
+	Next  plugin.Handler
+	Zones []string
+
+	anchors *anchors
+	nta     []string // negative trust anchors: names below these are not validated
+
+	cuts *cache.Cache[*cut] // validated zone cuts and keys
+	now  func() time.Time
+}
+
+// New returns a new Validate that uses the trust anchors in a.
+func New(a *anchors) *Validate {
+	return &Validate{anchors: a, cuts: cache.New[*cut](defaultCacheSize), now: time.Now}
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (v *Validate) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+	// With CD the client validates itself, RFC 4035, section 3.2.2.
+	if plugin.Zones(v.Zones).Matches(state.Name()) == "" || r.CheckingDisabled {
+		return plugin.NextOrFailure(v.Name(), v.Next, ctx, w, r)
+	}
+
+	do := state.Do()
+	req := r.Copy()
+	if o := req.IsEdns0(); o != nil {
+		o.SetDo()
+	} else {
+		req.SetEdns0(dns.DefaultMsgSize, true)
+	}
+
+	nw := nonwriter.New(w)
+	rcode, err := plugin.NextOrFailure(v.Name(), v.Next, ctx, nw, req)
+	if nw.Msg == nil {
+		return rcode, err
+	}
+	m := nw.Msg
+	m.AuthenticatedData = false
+
+	server := metrics.WithServer(ctx)
+	st, err := v.validate(ctx, w, m)
+	resultCount.WithLabelValues(server, st.String()).Inc()
+	switch st {
+	case bogus:
+		log.Debugf("Bogus reply for %s %s: %s", state.Name(), state.Type(), err)
+		fail := new(dns.Msg).SetRcode(r, dns.RcodeServerFailure).SetEdns0(dns.DefaultMsgSize, do)
+		fail.IsEdns0().Option = append(fail.IsEdns0().Option, ede(err))
+		w.WriteMsg(fail)
+		return dns.RcodeSuccess, nil
+	case secure:
+		// Only set AD for clients that show they understand it, RFC 6840, section 5.8.
+		m.AuthenticatedData = do || r.AuthenticatedData
+	}
+
+	if !do {
+		strip(m, state.QType())
+	}
+	if r.IsEdns0() == nil {
+		removeOPT(m)
+	}
+	state.SizeAndDo(m)
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+}
+
+// Name implements the plugin.Handler interface.
+func (v *Validate) Name() string { return "validate" }
+
+// lookup sends a query for name and qtype with the CD bit set to the next plugins, and returns the reply.
+func (v *Validate) lookup(ctx context.Context, w dns.ResponseWriter, name string, qtype uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.SetEdns0(dns.DefaultMsgSize, true)
+	m.CheckingDisabled = true
+
+	nw := nonwriter.New(w)
+	rcode, err := plugin.NextOrFailure(v.Name(), v.Next, ctx, nw, m)
+	if nw.Msg == nil {
+		if err == nil {
+			err = errNoReply
+		}
+		return nil, &bogusError{code: dns.ExtendedErrorCodeNetworkError, reason: "looking up " + name + " " + dns.TypeToString[qtype] + ": " + dns.RcodeToString[rcode] + ": " + err.Error()}
+	}
+	if nw.Msg.Rcode != dns.RcodeSuccess && nw.Msg.Rcode != dns.RcodeNameError {
+		return nil, &bogusError{code: dns.ExtendedErrorCodeNetworkError, reason: "looking up " + name + " " + dns.TypeToString[qtype] + ": " + dns.RcodeToString[nw.Msg.Rcode]}
+	}
+	return nw.Msg, nil
+}
+
+// strip removes the DNSSEC records from m that a client without the DO bit did not ask for.
+func strip(m *dns.Msg, qtype uint16) {
+	m.Answer = stripSection(m.Answer, qtype)
+	m.Ns = stripSection(m.Ns, 0)
+	m.Extra = stripSection(m.Extra, 0)
+}
+
+func stripSection(rrs []dns.RR, qtype uint16) []dns.RR {
+	j := 0
+	for _, rr := range rrs {
+		switch t := rr.Header().Rrtype; t {
+		case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3:
+			if t != qtype {
+				continue
+			}
+		}
+		rrs[j] = rr
+		j++
+	}
+	return rrs[:j]
+}
+
+func removeOPT(m *dns.Msg) {
+	j := 0
+	for _, rr := range m.Extra {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			m.Extra[j] = rr
+			j++
+		}
+	}
+	m.Extra = m.Extra[:j]
+}
@@ -0,0 +1,460 @@
+package validate
+
+import (
+	"context"
+	"crypto"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	"github.com/coredns/coredns/plugin/pkg/nonwriter"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// signer is the key of a zone in the test world.
+type signer struct {
+	key  *dns.DNSKEY
+	priv crypto.Signer
+}
+
+func newSigner(t *testing.T, zone string) *signer {
+	t.Helper()
+	k := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE | dns.SEP,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := k.Generate(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &signer{key: k, priv: priv.(crypto.Signer)}
+}
+
+func (s *signer) ds() dns.RR { return s.key.ToDS(dns.SHA256) }
+
+func (s *signer) sign(t *testing.T, rrs []dns.RR, inception, expiration time.Time) *dns.RRSIG {
+	t.Helper()
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Name: rrs[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: rrs[0].Header().Ttl},
+		KeyTag:     s.key.KeyTag(),
+		SignerName: s.key.Hdr.Name,
+		Algorithm:  s.key.Algorithm,
+		Inception:  uint32(inception.Unix()),
+		Expiration: uint32(expiration.Unix()),
+	}
+	if err := sig.Sign(s.priv, rrs); err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+func rrs(t *testing.T, lines ...string) []dns.RR {
+	t.Helper()
+	var out []dns.RR
+	for _, l := range lines {
+		rr, err := dns.NewRR(l)
+		if err != nil {
+			t.Fatalf("%q: %s", l, err)
+		}
+		out = append(out, rr)
+	}
+	return out
+}
+
+// signZone adds the NSEC chain and signatures to the records of zone. If s is nil, the zone is unsigned.
+func signZone(t *testing.T, zone string, records []dns.RR, s *signer, inception, expiration time.Time) []dns.RR {
+	t.Helper()
+	if s == nil {
+		return records
+	}
+	records = append(records, s.key)
+
+	byName := map[string][]dns.RR{}
+	for _, rr := range records {
+		byName[rr.Header().Name] = append(byName[rr.Header().Name], rr)
+	}
+	names := make([]string, 0, len(byName))
+	for n := range byName {
+		names = append(names, n)
+	}
+	sort.Slice(names, func(i, j int) bool { return dnsutil.CanonicalCompare(names[i], names[j]) < 0 })
+
+	out := []dns.RR{}
+	for i, n := range names {
+		cut := n != zone && hasRR(byName[n], dns.TypeNS)
+		types := map[uint16][]dns.RR{}
+		for _, rr := range byName[n] {
+			types[rr.Header().Rrtype] = append(types[rr.Header().Rrtype], rr)
+		}
+		nsec := &dns.NSEC{
+			Hdr:        dns.RR_Header{Name: n, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 3600},
+			NextDomain: names[(i+1)%len(names)],
+			TypeBitMap: []uint16{dns.TypeNSEC, dns.TypeRRSIG},
+		}
+		for typ := range types {
+			nsec.TypeBitMap = append(nsec.TypeBitMap, typ)
+		}
+		sort.Slice(nsec.TypeBitMap, func(i, j int) bool { return nsec.TypeBitMap[i] < nsec.TypeBitMap[j] })
+		types[dns.TypeNSEC] = []dns.RR{nsec}
+
+		for typ, set := range types {
+			out = append(out, set...)
+			if cut && typ == dns.TypeNS {
+				continue
+			}
+			out = append(out, s.sign(t, set, inception, expiration))
+		}
+	}
+	return out
+}
+
+func hasRR(rrs []dns.RR, t uint16) bool {
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == t {
+			return true
+		}
+	}
+	return false
+}
+
+// world is a set of zones, served by the file plugin, that sends DS queries to the parent zone.
+type world struct {
+	zones  map[string]file.File
+	tamper bool // change the address of a.example. in replies
+	forge  bool // put a forged signature before the ones of wildcard expansions, and drop the NSEC proof
+}
+
+func (wo *world) add(t *testing.T, zone string, records []dns.RR) {
+	t.Helper()
+	var b strings.Builder
+	for _, rr := range records {
+		b.WriteString(rr.String() + "\n")
+	}
+	z, err := file.Parse(strings.NewReader(b.String()), zone, "stdin", 0)
+	if err != nil {
+		t.Fatalf("zone %s: %s", zone, err)
+	}
+	wo.zones[zone] = file.File{Zones: file.Zones{Z: map[string]*file.Zone{zone: z}, Names: []string{zone}}}
+}
+
+func (wo *world) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	name := r.Question[0].Name
+	if r.Question[0].Qtype == dns.TypeDS && name != "." {
+		off, _ := dns.NextLabel(name, 0)
+		name = name[off:]
+	}
+	zone := ""
+	for z := range wo.zones {
+		if dns.IsSubDomain(z, name) && (zone == "" || dns.CountLabel(z) > dns.CountLabel(zone)) {
+			zone = z
+		}
+	}
+	nw := nonwriter.New(w)
+	rcode, err := wo.zones[zone].ServeDNS(ctx, nw, r)
+	if nw.Msg == nil {
+		return rcode, err
+	}
+	if wo.tamper {
+		for _, rr := range nw.Msg.Answer {
+			if a, ok := rr.(*dns.A); ok && a.Hdr.Name == "a.example." {
+				a.A = a.A.To4()
+				a.A[3]++
+			}
+		}
+	}
+	if wo.forge {
+		forgeWildcard(nw.Msg)
+	}
+	w.WriteMsg(nw.Msg)
+	return dns.RcodeSuccess, nil
+}
+
+// forgeWildcard puts a signature that claims m's wildcard expansions are not expanded before their real
+// signatures, and removes the NSEC records that prove the expansion is allowed.
+func forgeWildcard(m *dns.Msg) {
+	answer := []dns.RR{}
+	for _, rr := range m.Answer {
+		if sig, ok := rr.(*dns.RRSIG); ok && int(sig.Labels) < dns.CountLabel(sig.Hdr.Name) {
+			forged := dns.Copy(sig).(*dns.RRSIG)
+			forged.Labels = uint8(dns.CountLabel(sig.Hdr.Name))
+			answer = append(answer, forged)
+		}
+		answer = append(answer, rr)
+	}
+	m.Answer = answer
+
+	ns := []dns.RR{}
+	for _, rr := range m.Ns {
+		switch x := rr.(type) {
+		case *dns.NSEC:
+			continue
+		case *dns.RRSIG:
+			if x.TypeCovered == dns.TypeNSEC {
+				continue
+			}
+		}
+		ns = append(ns, rr)
+	}
+	m.Ns = ns
+}
+
+func (wo *world) Name() string { return "world" }
+
+// newWorld returns the test world and the key of its root zone.
+func newWorld(t *testing.T) (*world, *signer) {
+	t.Helper()
+	now := time.Now()
+	in, ex := now.Add(-time.Hour), now.Add(24*time.Hour)
+
+	root := newSigner(t, ".")
+	example := newSigner(t, "example.")
+	broken := newSigner(t, "broken.")
+	expired := newSigner(t, "expired.")
+	other := newSigner(t, "broken.") // signs broken., but its DS is not in the root zone
+
+	wo := &world{zones: map[string]file.File{}}
+	wo.add(t, ".", signZone(t, ".", append(rrs(t,
+		". 3600 IN SOA ns.root. hostmaster.root. 1 7200 3600 1209600 3600",
+		". 3600 IN NS ns.root.",
+		"example. 3600 IN NS ns.example.",
+		"insecure. 3600 IN NS ns.insecure.",
+		"broken. 3600 IN NS ns.broken.",
+		"expired. 3600 IN NS ns.expired.",
+	), example.ds(), broken.ds(), expired.ds()), root, in, ex))
+
+	wo.add(t, "example.", signZone(t, "example.", rrs(t,
+		"example. 3600 IN SOA ns.example. hostmaster.example. 1 7200 3600 1209600 3600",
+		"example. 3600 IN NS ns.example.",
+		"a.example. 3600 IN A 192.0.2.1",
+		"c.example. 3600 IN CNAME a.example.",
+		"*.w.example. 3600 IN A 192.0.2.2",
+	), example, in, ex))
+
+	wo.add(t, "insecure.", rrs(t,
+		"insecure. 3600 IN SOA ns.insecure. hostmaster.insecure. 1 7200 3600 1209600 3600",
+		"insecure. 3600 IN NS ns.insecure.",
+		"a.insecure. 3600 IN A 192.0.2.3",
+	))
+
+	wo.add(t, "broken.", signZone(t, "broken.", rrs(t,
+		"broken. 3600 IN SOA ns.broken. hostmaster.broken. 1 7200 3600 1209600 3600",
+		"broken. 3600 IN NS ns.broken.",
+		"a.broken. 3600 IN A 192.0.2.4",
+	), other, in, ex))
+
+	wo.add(t, "expired.", signZone(t, "expired.", rrs(t,
+		"expired. 3600 IN SOA ns.expired. hostmaster.expired. 1 7200 3600 1209600 3600",
+		"expired. 3600 IN NS ns.expired.",
+		"a.expired. 3600 IN A 192.0.2.5",
+	), expired, now.Add(-48*time.Hour), now.Add(-24*time.Hour)))
+
+	return wo, root
+}
+
+func newValidate(t *testing.T, wo *world, root *signer) *Validate {
+	t.Helper()
+	a, err := parseAnchors(strings.NewReader(root.key.String()), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := New(a)
+	v.Zones = []string{"."}
+	v.Next = wo
+	return v
+}
+
+func TestValidate(t *testing.T) {
+	wo, root := newWorld(t)
+	v := newValidate(t, wo, root)
+
+	tests := []struct {
+		qname   string
+		qtype   uint16
+		do      bool
+		ad      bool // set AD in the query
+		cd      bool
+		rcode   int
+		wantAD  bool
+		ede     int // expected extended error code, -1 for none
+		answers int // expected number of records in the answer section, -1 to skip
+	}{
+		{qname: "a.example.", qtype: dns.TypeA, do: true, rcode: dns.RcodeSuccess, wantAD: true, ede: -1, answers: 2},
+		{qname: "a.example.", qtype: dns.TypeA, rcode: dns.RcodeSuccess, ede: -1, answers: 1},
+		{qname: "a.example.", qtype: dns.TypeA, ad: true, rcode: dns.RcodeSuccess, wantAD: true, ede: -1, answers: 1},
+		{qname: "nx.example.", qtype: dns.TypeA, do: true, rcode: dns.RcodeNameError, wantAD: true, ede: -1, answers: 0},
+		{qname: "a.example.", qtype: dns.TypeMX, do: true, rcode: dns.RcodeSuccess, wantAD: true, ede: -1, answers: 0},
+		{qname: "c.example.", qtype: dns.TypeA, do: true, rcode: dns.RcodeSuccess, wantAD: true, ede: -1, answers: 4},
+		{qname: "x.w.example.", qtype: dns.TypeA, do: true, rcode: dns.RcodeSuccess, wantAD: true, ede: -1, answers: 2},
+		{qname: "a.insecure.", qtype: dns.TypeA, do: true, rcode: dns.RcodeSuccess, ede: -1, answers: 1},
+		{qname: "nx.", qtype: dns.TypeA, do: true, rcode: dns.RcodeNameError, wantAD: true, ede: -1, answers: 0},
+		{qname: "a.broken.", qtype: dns.TypeA, do: true, rcode: dns.RcodeServerFailure, ede: int(dns.ExtendedErrorCodeDNSKEYMissing), answers: 0},
+		{qname: "a.expired.", qtype: dns.TypeA, do: true, rcode: dns.RcodeServerFailure, ede: int(dns.ExtendedErrorCodeSignatureExpired), answers: 0},
+		// With CD the reply is passed on as is.
+		{qname: "a.broken.", qtype: dns.TypeA, do: true, cd: true, rcode: dns.RcodeSuccess, ede: -1, answers: -1},
+	}
+
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		if tc.do {
+			m.SetEdns0(4096, true)
+		}
+		m.AuthenticatedData = tc.ad
+		m.CheckingDisabled = tc.cd
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := v.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Test %d: %s", i, err)
+		}
+		resp := rec.Msg
+		if resp.Rcode != tc.rcode {
+			t.Errorf("Test %d, %s %s: expected rcode %s, got %s", i, tc.qname, dns.TypeToString[tc.qtype], dns.RcodeToString[tc.rcode], dns.RcodeToString[resp.Rcode])
+			continue
+		}
+		if resp.AuthenticatedData != tc.wantAD {
+			t.Errorf("Test %d, %s %s: expected AD %t, got %t", i, tc.qname, dns.TypeToString[tc.qtype], tc.wantAD, resp.AuthenticatedData)
+		}
+		if got := edeCode(resp); got != tc.ede {
+			t.Errorf("Test %d, %s %s: expected extended error %d, got %d", i, tc.qname, dns.TypeToString[tc.qtype], tc.ede, got)
+		}
+		if tc.answers >= 0 && len(resp.Answer) != tc.answers {
+			t.Errorf("Test %d, %s %s: expected %d answers, got %d: %v", i, tc.qname, dns.TypeToString[tc.qtype], tc.answers, len(resp.Answer), resp.Answer)
+		}
+		if !tc.do && resp.IsEdns0() != nil {
+			t.Errorf("Test %d, %s %s: expected no OPT record", i, tc.qname, dns.TypeToString[tc.qtype])
+		}
+	}
+}
+
+func TestValidateTampered(t *testing.T) {
+	wo, root := newWorld(t)
+	v := newValidate(t, wo, root)
+	wo.tamper = true
+
+	m := new(dns.Msg)
+	m.SetQuestion("a.example.", dns.TypeA)
+	m.SetEdns0(4096, true)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	v.ServeDNS(context.TODO(), rec, m)
+
+	if rec.Msg.Rcode != dns.RcodeServerFailure {
+		t.Fatalf("Expected SERVFAIL, got %s", dns.RcodeToString[rec.Msg.Rcode])
+	}
+	if got := edeCode(rec.Msg); got != int(dns.ExtendedErrorCodeDNSBogus) {
+		t.Errorf("Expected extended error %d, got %d", dns.ExtendedErrorCodeDNSBogus, got)
+	}
+}
+
+func TestValidateForgedWildcardSignature(t *testing.T) {
+	wo, root := newWorld(t)
+	v := newValidate(t, wo, root)
+	wo.forge = true
+
+	m := new(dns.Msg)
+	m.SetQuestion("x.w.example.", dns.TypeA)
+	m.SetEdns0(4096, true)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	v.ServeDNS(context.TODO(), rec, m)
+
+	if rec.Msg.Rcode != dns.RcodeServerFailure {
+		t.Fatalf("Expected SERVFAIL, got %s", dns.RcodeToString[rec.Msg.Rcode])
+	}
+	if got := edeCode(rec.Msg); got != int(dns.ExtendedErrorCodeNSECMissing) {
+		t.Errorf("Expected extended error %d, got %d", dns.ExtendedErrorCodeNSECMissing, got)
+	}
+}
+
+func TestValidateNegativeTrustAnchor(t *testing.T) {
+	wo, root := newWorld(t)
+	v := newValidate(t, wo, root)
+	v.nta = []string{"broken."}
+
+	for _, name := range []string{"a.broken.", "a.example."} {
+		m := new(dns.Msg)
+		m.SetQuestion(name, dns.TypeA)
+		m.SetEdns0(4096, true)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		v.ServeDNS(context.TODO(), rec, m)
+
+		if rec.Msg.Rcode != dns.RcodeSuccess {
+			t.Fatalf("Expected NOERROR for %s, got %s", name, dns.RcodeToString[rec.Msg.Rcode])
+		}
+		if want := name == "a.example."; rec.Msg.AuthenticatedData != want {
+			t.Errorf("Expected AD %t for %s, got %t", want, name, rec.Msg.AuthenticatedData)
+		}
+	}
+}
+
+func TestValidateNoAnchor(t *testing.T) {
+	wo, _ := newWorld(t)
+	a, err := parseAnchors(strings.NewReader(". IN DS 1 13 2 0000000000000000000000000000000000000000000000000000000000000000"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := New(a)
+	v.Zones = []string{"."}
+	v.Next = wo
+
+	m := new(dns.Msg)
+	m.SetQuestion("a.example.", dns.TypeA)
+	m.SetEdns0(4096, true)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	v.ServeDNS(context.TODO(), rec, m)
+
+	if rec.Msg.Rcode != dns.RcodeServerFailure {
+		t.Fatalf("Expected SERVFAIL, got %s", dns.RcodeToString[rec.Msg.Rcode])
+	}
+	if got := edeCode(rec.Msg); got != int(dns.ExtendedErrorCodeDNSKEYMissing) {
+		t.Errorf("Expected extended error %d, got %d", dns.ExtendedErrorCodeDNSKEYMissing, got)
+	}
+}
+
+func TestCutCache(t *testing.T) {
+	wo, root := newWorld(t)
+	v := newValidate(t, wo, root)
+
+	queries := 0
+	v.Next = plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		if r.CheckingDisabled {
+			queries++
+		}
+		return wo.ServeDNS(ctx, w, r)
+	})
+
+	for i := range 2 {
+		m := new(dns.Msg)
+		m.SetQuestion("a.example.", dns.TypeA)
+		m.SetEdns0(4096, true)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		v.ServeDNS(context.TODO(), rec, m)
+		if !rec.Msg.AuthenticatedData {
+			t.Fatalf("Query %d: expected AD", i)
+		}
+	}
+	// DNSKEY of the root, DS and DNSKEY of example.
+	if queries != 3 {
+		t.Errorf("Expected 3 lookups for the chain of trust, got %d", queries)
+	}
+}
+
+func edeCode(m *dns.Msg) int {
+	o := m.IsEdns0()
+	if o == nil {
+		return -1
+	}
+	for _, opt := range o.Option {
+		if e, ok := opt.(*dns.EDNS0_EDE); ok {
+			return int(e.InfoCode)
+		}
+	}
+	return -1
+}
@@ -0,0 +1,296 @@
+package validate
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// status is the outcome of the validation of a reply, RFC 4035, section 4.3.
+type status int
+
+const (
+	secure   status = iota // the chain of trust and all signatures are valid
+	insecure               // there is no chain of trust, because of an unsigned zone cut or no trust anchor
+	bogus                  // there should be a chain of trust, but it or a signature is not valid
+)
+
+func (s status) String() string {
+	switch s {
+	case secure:
+		return "secure"
+	case insecure:
+		return "insecure"
+	}
+	return "bogus"
+}
+
+var errNoReply = errors.New("no reply")
+
+// bogusError is the reason a reply is bogus, with the extended DNS error code for it, RFC 8914.
+type bogusError struct {
+	code   uint16
+	reason string
+}
+
+func (e *bogusError) Error() string { return e.reason }
+
+// ede returns the extended DNS error option for err.
+func ede(err error) *dns.EDNS0_EDE {
+	code := dns.ExtendedErrorCodeDNSBogus
+	var b *bogusError
+	if errors.As(err, &b) {
+		code = b.code
+	}
+	text := ""
+	if err != nil {
+		text = err.Error()
+	}
+	return &dns.EDNS0_EDE{InfoCode: code, ExtraText: text}
+}
+
+// rrset is a set of records with the same owner name and type, and the signatures over it.
+type rrset struct {
+	name   string
+	rrtype uint16
+	rrs    []dns.RR
+	sigs   []*dns.RRSIG
+}
+
+// ttl returns the TTL of the set, which is capped by the original TTL of its signatures, RFC 4035,
+// section 5.3.3.
+func (s *rrset) ttl() uint32 {
+	ttl := minTTL(s.rrs)
+	for _, sig := range s.sigs {
+		ttl = min(ttl, sig.OrigTtl)
+	}
+	return ttl
+}
+
+type sets []*rrset
+
+// rrsets groups rrs into sets, and adds the signatures to the set they cover.
+func rrsets(rrs []dns.RR) sets {
+	var ss sets
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		t := hdr.Rrtype
+		sig, isSig := rr.(*dns.RRSIG)
+		if isSig {
+			t = sig.TypeCovered
+		}
+		s := ss.get(hdr.Name, t)
+		if s == nil {
+			s = &rrset{name: hdr.Name, rrtype: t}
+			ss = append(ss, s)
+		}
+		if isSig {
+			s.sigs = append(s.sigs, sig)
+			continue
+		}
+		s.rrs = append(s.rrs, rr)
+	}
+	return ss
+}
+
+// get returns the set for name and rrtype, or nil if there is none.
+func (ss sets) get(name string, rrtype uint16) *rrset {
+	for _, s := range ss {
+		if s.rrtype == rrtype && strings.EqualFold(s.name, name) {
+			return s
+		}
+	}
+	return nil
+}
+
+func minTTL(rrs []dns.RR) uint32 {
+	var ttl uint32
+	for i, rr := range rrs {
+		if i == 0 || rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+	}
+	return ttl
+}
+
+// verify checks that one of the signatures over s is made with one of keys and currently valid, and
+// returns that signature.
+func (v *Validate) verify(s *rrset, keys []*dns.DNSKEY) (*dns.RRSIG, error) {
+	if len(s.rrs) == 0 {
+		return nil, &bogusError{code: dns.ExtendedErrorCodeDNSBogus, reason: "only signatures for " + s.name + " " + dns.TypeToString[s.rrtype]}
+	}
+	if len(s.sigs) == 0 {
+		return nil, &bogusError{code: dns.ExtendedErrorCodeRRSIGsMissing, reason: "no signatures for " + s.name + " " + dns.TypeToString[s.rrtype]}
+	}
+
+	now := v.now()
+	err := &bogusError{code: dns.ExtendedErrorCodeDNSKEYMissing, reason: "no key for the signatures of " + s.name + " " + dns.TypeToString[s.rrtype]}
+	for _, sig := range s.sigs {
+		for _, k := range keys {
+			if sig.KeyTag != k.KeyTag() || sig.Algorithm != k.Algorithm || !strings.EqualFold(sig.SignerName, k.Hdr.Name) {
+				continue
+			}
+			if e := sig.Verify(k, s.rrs); e != nil {
+				err = &bogusError{code: dns.ExtendedErrorCodeDNSBogus, reason: "signature of " + s.name + " " + dns.TypeToString[s.rrtype] + ": " + e.Error()}
+				continue
+			}
+			if !sig.ValidityPeriod(now) {
+				code := uint16(dns.ExtendedErrorCodeSignatureExpired)
+				if now.Unix() < int64(sig.Inception) {
+					code = dns.ExtendedErrorCodeSignatureNotYetValid
+				}
+				err = &bogusError{code: code, reason: "signature of " + s.name + " " + dns.TypeToString[s.rrtype] + " is not valid now"}
+				continue
+			}
+			return sig, nil
+		}
+	}
+	return nil, err
+}
+
+// validate validates the reply m and returns its status. If it is bogus, the error says why.
+func (v *Validate) validate(ctx context.Context, w dns.ResponseWriter, m *dns.Msg) (status, error) {
+	if len(m.Question) == 0 {
+		return insecure, nil
+	}
+	if m.Rcode != dns.RcodeSuccess && m.Rcode != dns.RcodeNameError {
+		return insecure, nil
+	}
+	qname, qtype := m.Question[0].Name, m.Question[0].Qtype
+
+	st := secure
+	answers := rrsets(m.Answer)
+	for _, s := range answers {
+		if s.rrtype == dns.TypeCNAME && len(s.sigs) == 0 && synthesized(answers, s.name) {
+			// Synthesized from a DNAME, which is validated itself, RFC 6672, section 5.3.1.
+			continue
+		}
+		sst, err := v.verifySet(ctx, w, s, m.Ns)
+		if sst == bogus {
+			return bogus, err
+		}
+		st = max(st, sst)
+	}
+
+	name := final(m.Answer, qname)
+	if answers.get(name, qtype) != nil || (len(m.Answer) > 0 && qtype == dns.TypeCNAME) {
+		return st, nil
+	}
+	if synthesized(answers, name) {
+		return st, nil
+	}
+
+	nst, err := v.validateNegative(ctx, w, m, name, qtype)
+	if nst == bogus {
+		return bogus, err
+	}
+	return max(st, nst), nil
+}
+
+// verifySet validates the set s from the answer section. Wildcard expansions are proven with the NSEC
+// or NSEC3 records in ns.
+func (v *Validate) verifySet(ctx context.Context, w dns.ResponseWriter, s *rrset, ns []dns.RR) (status, error) {
+	if len(s.sigs) == 0 {
+		_, _, st, err := v.chain(ctx, w, s.name)
+		if st == secure {
+			return bogus, &bogusError{code: dns.ExtendedErrorCodeRRSIGsMissing, reason: "no signatures for " + s.name + " " + dns.TypeToString[s.rrtype]}
+		}
+		return st, err
+	}
+
+	signer := s.sigs[0].SignerName
+	if !dns.IsSubDomain(signer, s.name) {
+		return bogus, &bogusError{code: dns.ExtendedErrorCodeDNSBogus, reason: "signer " + signer + " is not a parent of " + s.name}
+	}
+	zone, keys, st, err := v.chain(ctx, w, signer)
+	if st != secure {
+		return st, err
+	}
+	if !strings.EqualFold(zone, signer) {
+		return bogus, &bogusError{code: dns.ExtendedErrorCodeDNSKEYMissing, reason: "signer " + signer + " of " + s.name + " is not a zone"}
+	}
+	sig, err := v.verify(s, keys)
+	if err != nil {
+		return bogus, err
+	}
+
+	// A signature with fewer labels than the owner name is over a wildcard, RFC 4035, section 5.3.4. Only
+	// the signature that verified is used, the others may be forged.
+	labels := int(sig.Labels)
+	if labels >= dns.CountLabel(s.name) {
+		return secure, nil
+	}
+	d, err := v.denial(&dns.Msg{Ns: ns}, zone, keys)
+	if err != nil {
+		return bogus, err
+	}
+	return d.wildcard(s.name, labels)
+}
+
+// validateNegative validates that name does not exist, or has no records of qtype.
+func (v *Validate) validateNegative(ctx context.Context, w dns.ResponseWriter, m *dns.Msg, name string, qtype uint16) (status, error) {
+	var soa *rrset
+	for _, s := range rrsets(m.Ns) {
+		if s.rrtype == dns.TypeSOA && dns.IsSubDomain(s.name, name) {
+			soa = s
+			break
+		}
+	}
+	if soa == nil {
+		_, _, st, err := v.chain(ctx, w, name)
+		if st == secure {
+			return bogus, &bogusError{code: dns.ExtendedErrorCodeNSECMissing, reason: "no SOA in the negative reply for " + name}
+		}
+		return st, err
+	}
+
+	zone, keys, st, err := v.chain(ctx, w, soa.name)
+	if st != secure {
+		return st, err
+	}
+	if !strings.EqualFold(zone, soa.name) {
+		return bogus, &bogusError{code: dns.ExtendedErrorCodeDNSBogus, reason: soa.name + " is not a zone"}
+	}
+	if _, err := v.verify(soa, keys); err != nil {
+		return bogus, err
+	}
+
+	d, err := v.denial(m, zone, keys)
+	if err != nil {
+		return bogus, err
+	}
+	if m.Rcode == dns.RcodeNameError {
+		return d.nxdomain(name)
+	}
+	return d.nodata(name, qtype)
+}
+
+// final returns the name the CNAMEs for qname in answer lead to.
+func final(answer []dns.RR, qname string) string {
+	name := qname
+	for range len(answer) {
+		next := ""
+		for _, rr := range answer {
+			if c, ok := rr.(*dns.CNAME); ok && strings.EqualFold(c.Hdr.Name, name) {
+				next = c.Target
+			}
+		}
+		if next == "" {
+			break
+		}
+		name = next
+	}
+	return name
+}
+
+// synthesized returns true if there is a DNAME in ss that a CNAME for name may have been synthesized from.
+func synthesized(ss sets, name string) bool {
+	for _, s := range ss {
+		if s.rrtype == dns.TypeDNAME && !strings.EqualFold(s.name, name) && dns.IsSubDomain(s.name, name) {
+			return true
+		}
+	}
+	return false
+}
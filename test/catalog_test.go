@@ -0,0 +1,63 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/catalog"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestCatalogZoneTransfer(t *testing.T) {
+	name, rm, err := test.TempFile(".", exampleOrg)
+	if err != nil {
+		t.Fatalf("Failed to create zone: %s", err)
+	}
+	defer rm()
+
+	corefile := `.:0 {
+		file ` + name + ` example.org
+		catalog catalog.example {
+			group primary
+		}
+		transfer catalog.example {
+			to *
+		}
+	}`
+
+	i, _, tcp, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i.Stop()
+
+	m := new(dns.Msg)
+	m.SetAxfr("catalog.example.")
+	tr := new(dns.Transfer)
+	env, err := tr.In(m, tcp)
+	if err != nil {
+		t.Fatalf("Expected to start the transfer, got %s", err)
+	}
+	var rrs []dns.RR
+	for e := range env {
+		if e.Error != nil {
+			t.Fatalf("Expected no transfer error, got %s", e.Error)
+		}
+		rrs = append(rrs, e.RR...)
+	}
+	if len(rrs) < 2 {
+		t.Fatalf("Expected a catalog zone, got %v", rrs)
+	}
+
+	cat, err := catalog.Parse("catalog.example.", rrs[:len(rrs)-1])
+	if err != nil {
+		t.Fatalf("Expected a valid catalog zone, got %s", err)
+	}
+	if len(cat.Members) != 1 || cat.Members[0].Zone != "example.org." {
+		t.Fatalf("Expected example.org. as the only member, got %v", cat.Members)
+	}
+	if g := cat.Members[0].Groups; len(g) != 1 || g[0] != "primary" {
+		t.Errorf("Expected group %q, got %v", "primary", g)
+	}
+}
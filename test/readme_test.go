@@ -21,10 +21,23 @@ var contents = map[string]string{
 	"Kexample.org.+013+45330.key":     examplePub,
 	"Kexample.org.+013+45330.private": examplePriv,
 	"example.org.signed":              exampleOrg, // not signed, but does not matter for this test.
+	"root.key":                        rootKey,
+	"allow.rpz":                       allowRPZ,
+	"blocked.hosts":                   "0.0.0.0 ads.example.org\n",
+	"adblock.txt":                     "||tracker.example.org^\n",
+	"allowed.txt":                     "example.org\n",
+	"games.txt":                       "games.example\n",
 }
 
 const (
 	examplePub = `example.org. IN DNSKEY 256 3 13 eNMYFZYb6e0oJOV47IPo5f/UHy7wY9aBebotvcKakIYLyyGscBmXJQhbKLt/LhrMNDE2Q96hQnI5PdTBeOLzhQ==
+`
+	rootKey = `. IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D
+`
+	allowRPZ = `$TTL 300
+@            SOA  localhost. hostmaster.localhost. 1 3600 600 86400 300
+             NS   localhost.
+good.example CNAME rpz-passthru.
 `
 	examplePriv = `Private-key-format: v1.3
 Algorithm: 13 (ECDSAP256SHA256)
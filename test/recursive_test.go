@@ -0,0 +1,108 @@
+package test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+const recursiveRoot = `$TTL 3600
+.                 IN SOA a.root.test. hostmaster.root.test. 1 7200 3600 1209600 3600
+.                 IN NS  a.root.test.
+a.root.test.      IN A   127.0.0.1
+com.              IN NS  ns1.nic.com.
+ns1.nic.com.      IN A   127.0.0.1
+`
+
+const recursiveCom = `$TTL 3600
+com.              IN SOA ns1.nic.com. hostmaster.nic.com. 1 7200 3600 1209600 300
+com.              IN NS  ns1.nic.com.
+ns1.nic.com.      IN A   127.0.0.1
+example.com.      IN NS  ns1.example.com.
+ns1.example.com.  IN A   127.0.0.1
+`
+
+const recursiveExample = `$TTL 3600
+example.com.      IN SOA ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 300
+example.com.      IN NS  ns1.example.com.
+ns1.example.com.  IN A   127.0.0.1
+www.example.com.  IN A   192.0.2.1
+alias.example.com. IN CNAME www.example.com.
+`
+
+func TestRecursive(t *testing.T) {
+	var names []string
+	for _, z := range []string{recursiveRoot, recursiveCom, recursiveExample} {
+		name, rm, err := test.TempFile(".", z)
+		if err != nil {
+			t.Fatalf("Failed to create zone: %s", err)
+		}
+		defer rm()
+		names = append(names, name)
+	}
+
+	// All zones are served by a single authoritative server.
+	auth, udp, _, err := CoreDNSServerAndPorts(`.:0 {
+		file ` + names[0] + ` .
+		file ` + names[1] + ` com.
+		file ` + names[2] + ` example.com.
+	}`)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer auth.Stop()
+
+	_, port, _ := net.SplitHostPort(udp)
+	resolver, rudp, _, err := CoreDNSServerAndPorts(`.:0 {
+		cache
+		recursive {
+			roots ` + udp + `
+			port ` + port + `
+		}
+	}`)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer resolver.Stop()
+
+	tests := []test.Case{
+		{
+			Qname: "www.example.com.", Qtype: dns.TypeA,
+			Answer: []dns.RR{test.A("www.example.com. 3600 IN A 192.0.2.1")},
+		},
+		{
+			Qname: "alias.example.com.", Qtype: dns.TypeA,
+			Answer: []dns.RR{
+				test.CNAME("alias.example.com. 3600 IN CNAME www.example.com."),
+				test.A("www.example.com. 3600 IN A 192.0.2.1"),
+			},
+		},
+		{
+			Qname: "nope.example.com.", Qtype: dns.TypeA, Rcode: dns.RcodeNameError,
+			Ns: []dns.RR{test.SOA("example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 300")},
+		},
+	}
+	for _, tc := range tests {
+		m := tc.Msg()
+		r, err := dns.Exchange(m, rudp)
+		if err != nil {
+			t.Fatalf("Expected to receive reply for %s, but got: %s", tc.Qname, err)
+		}
+		if !r.RecursionAvailable {
+			t.Errorf("Expected RA bit for %s", tc.Qname)
+		}
+		// The TTLs may have been capped by the cache.
+		for _, rr := range append(r.Answer, r.Ns...) {
+			if rr.Header().Ttl == 0 || rr.Header().Ttl > 3600 {
+				t.Errorf("Expected TTL of at most 3600, got %d", rr.Header().Ttl)
+			}
+			rr.Header().Ttl = 3600
+		}
+		if err := test.SortAndCheck(r, tc); err != nil {
+			t.Error(err)
+		}
+	}
+}